@@ -105,6 +105,13 @@ type BuilderOptions struct {
 	// recognized by Extenions nor known to the calling program, trying to build
 	// the descriptor will fail.
 	RequireInterpretedOptions bool
+
+	// If this option is true, building does not stop at the first problem.
+	// Instead, every check is run across the whole tree of builders and, if
+	// any problems are found, the returned error is a BuildErrors value that
+	// lists each one, along with the name of the offending element and the
+	// kind of problem.
+	CollectAllErrors bool
 }
 
 // Build processes the given builder into a descriptor using these options.
@@ -237,9 +244,11 @@ func addCommentsTo(sourceInfo *descriptorpb.SourceCodeInfo, path []int32, c *Com
 // and provides a kernel of builder-wiring support (to reduce boiler-plate in
 // each implementation).
 type baseBuilder struct {
-	name     string
-	parent   Builder
-	comments Comments
+	name       string
+	parent     Builder
+	comments   Comments
+	customOpts customOptions
+	lossless   *losslessInfo
 }
 
 func baseBuilderWithName(name string) baseBuilder {
@@ -331,7 +340,11 @@ func (b *baseBuilder) GetComments() *Comments {
 // doBuild is a helper for implementing the Build() method that each builder
 // exposes. It is used for all builders except for the root FileBuilder type.
 func doBuild(b Builder, opts BuilderOptions) (desc.Descriptor, error) {
-	fd, err := newResolver(opts).resolveElement(b, nil)
+	r := newResolver(opts)
+	fd, err := r.resolveElement(b, nil)
+	if r.rep.count() > 0 {
+		return nil, r.rep.errs
+	}
 	if err != nil {
 		return nil, err
 	}
@@ -1,6 +1,7 @@
 package builder
 
 import (
+	"errors"
 	"fmt"
 	"io/ioutil"
 	"os"
@@ -9,6 +10,7 @@ import (
 	"testing"
 
 	"github.com/golang/protobuf/proto"
+	"google.golang.org/protobuf/encoding/protowire"
 	"google.golang.org/protobuf/types/descriptorpb"
 	"google.golang.org/protobuf/types/known/anypb"
 	"google.golang.org/protobuf/types/known/emptypb"
@@ -340,6 +342,57 @@ func TestProto3Optional(t *testing.T) {
 	testutil.Eq(t, "_bar", fld.GetOneOf().GetName())
 }
 
+func TestEditions(t *testing.T) {
+	grp := NewGroupField(NewMessage("Bar").AddField(NewField("baz", FieldTypeString()))).
+		SetFeatures(&descriptorpb.FeatureSet{Utf8Validation: descriptorpb.FeatureSet_NONE.Enum()})
+	mb := NewMessage("Foo").
+		AddField(NewField("name", FieldTypeString())).
+		AddField(NewField("id", FieldTypeInt32()).
+			SetFeatures(&descriptorpb.FeatureSet{FieldPresence: descriptorpb.FeatureSet_EXPLICIT.Enum()})).
+		AddField(NewField("key", FieldTypeUInt64()).SetRequired()).
+		AddField(grp)
+	fb := NewFile("foo.proto").
+		SetEdition(descriptorpb.Edition_EDITION_2023).
+		SetFeatures(&descriptorpb.FeatureSet{FieldPresence: descriptorpb.FeatureSet_IMPLICIT.Enum()}).
+		AddMessage(mb)
+	testutil.Eq(t, descriptorpb.Edition_EDITION_2023, fb.GetEdition())
+
+	fd, err := fb.Build()
+	testutil.Ok(t, err)
+	testutil.Require(t, fd.IsEditions())
+	testutil.Eq(t, "editions", fd.AsFileDescriptorProto().GetSyntax())
+	testutil.Eq(t, descriptorpb.Edition_EDITION_2023, fd.GetEdition())
+
+	md := fd.FindMessage("Foo")
+	testutil.Require(t, !md.FindFieldByName("name").HasPresence())
+	testutil.Require(t, md.FindFieldByName("id").HasPresence())
+
+	key := md.FindFieldByName("key")
+	testutil.Require(t, key.IsRequired())
+	testutil.Eq(t, descriptorpb.FieldDescriptorProto_LABEL_OPTIONAL, key.AsFieldDescriptorProto().GetLabel())
+	testutil.Eq(t, descriptorpb.FeatureSet_LEGACY_REQUIRED, key.AsFieldDescriptorProto().GetOptions().GetFeatures().GetFieldPresence())
+
+	bar := md.FindFieldByName("bar")
+	testutil.Require(t, bar.IsDelimited())
+	testutil.Eq(t, descriptorpb.FieldDescriptorProto_TYPE_MESSAGE, bar.AsFieldDescriptorProto().GetType())
+	testutil.Eq(t, descriptorpb.FeatureSet_DELIMITED, bar.GetResolvedFeatures().GetMessageEncoding())
+	// explicitly set features are retained
+	testutil.Eq(t, descriptorpb.FeatureSet_NONE, bar.GetResolvedFeatures().GetUtf8Validation())
+	// and the builder is not modified
+	testutil.Require(t, grp.Options.GetFeatures().MessageEncoding == nil)
+
+	// legacy editions are the same as setting syntax
+	fb.SetEdition(descriptorpb.Edition_EDITION_PROTO3)
+	testutil.Require(t, fb.IsProto3)
+	testutil.Eq(t, descriptorpb.Edition_EDITION_PROTO3, fb.GetEdition())
+}
+
+func TestBuildersFromDescriptors_Editions(t *testing.T) {
+	fd, err := loadProtoset("../../internal/testprotos/desc_test_editions.protoset")
+	testutil.Ok(t, err)
+	roundTripFile(t, fd)
+}
+
 func TestBuildersFromDescriptors(t *testing.T) {
 	for _, s := range []string{"desc_test1.proto", "desc_test2.proto", "desc_test_defaults.proto", "desc_test_options.proto", "desc_test_proto3.proto", "desc_test_wellknowntypes.proto", "nopkg/desc_test_nopkg.proto", "nopkg/desc_test_nopkg_new.proto", "pkg/desc_test_pkg.proto"} {
 		fd, err := desc.LoadFileDescriptor(s)
@@ -519,12 +572,14 @@ func roundTripFile(t *testing.T, fd *desc.FileDescriptor) {
 	// That way, a simple proto.Equal() check will suffice to confirm that
 	// the file descriptor survived the round trip.
 
+	// (We modify a copy, so that the original descriptor is left intact.)
+	fdp := proto.Clone(fd.AsFileDescriptorProto()).(*descriptorpb.FileDescriptorProto)
+
 	// The files we are testing have one occurrence of a public import. The
 	// file nopkg/desc_test_nopkg.proto declares nothing and public imports
 	// nopkg/desc_test_nopkg_new.proto. So any file that depends on the
 	// former will be updated to instead depend on the latter (since it is
 	// the actual file that declares used elements).
-	fdp := fd.AsFileDescriptorProto()
 	needsNopkgNew := false
 	hasNoPkgNew := false
 	for _, dep := range fdp.Dependency {
@@ -1404,6 +1459,143 @@ func TestRemoveField(t *testing.T) {
 	testutil.Eq(t, "three", children[1].GetName())
 }
 
+func TestRemoveFieldAndReserve(t *testing.T) {
+	msg := NewMessage("FancyMessage").
+		AddField(NewField("one", FieldTypeInt64()).SetNumber(1)).
+		AddField(NewField("two", FieldTypeString()).SetNumber(2)).
+		AddField(NewField("three", FieldTypeString()).SetNumber(3)).
+		AddField(NewField("four", FieldTypeString()).SetNumber(4)).
+		AddField(NewField("auto", FieldTypeString())).
+		AddOneOf(NewOneOf("choice").
+			AddChoice(NewField("ten", FieldTypeString()).SetNumber(10)).
+			AddChoice(NewField("eleven", FieldTypeString()).SetNumber(11))).
+		AddReservedRange(20, 30)
+
+	testutil.Require(t, !msg.TryRemoveFieldAndReserve("five"))
+	testutil.Require(t, msg.TryRemoveFieldAndReserve("two"))
+	msg.RemoveFieldAndReserve("four").
+		RemoveFieldAndReserve("three").
+		RemoveFieldAndReserve("auto").
+		RemoveOneOfAndReserve("choice")
+	testutil.Eq(t, 1, len(msg.GetChildren()))
+
+	testutil.Eq(t, []string{"two", "four", "three", "auto", "ten", "eleven"}, msg.ReservedNames)
+	var ranges [][2]int32
+	for _, rr := range msg.ReservedRanges {
+		ranges = append(ranges, [2]int32{rr.GetStart(), rr.GetEnd()})
+	}
+	// end is exclusive; 2 through 4 were merged, as were 10 and 11
+	testutil.Eq(t, [][2]int32{{20, 31}, {2, 5}, {10, 12}}, ranges)
+
+	// re-using removed names and tags is rejected immediately, when the
+	// message enforces reservations
+	msg.EnforceReservations = true
+	err := msg.TryAddField(NewField("two", FieldTypeString()).SetNumber(100))
+	testutil.Require(t, err != nil && strings.Contains(err.Error(), `reserved field name "two"`), "unexpected error: %v", err)
+	err = msg.TryAddField(NewField("new", FieldTypeString()).SetNumber(3))
+	testutil.Require(t, err != nil && strings.Contains(err.Error(), "reserved tag 3"), "unexpected error: %v", err)
+	err = msg.TryAddField(NewField("new", FieldTypeString()).SetNumber(25))
+	testutil.Require(t, err != nil && strings.Contains(err.Error(), "reserved tag 25"), "unexpected error: %v", err)
+	err = msg.TryAddOneOf(NewOneOf("other").AddChoice(NewField("eleven", FieldTypeString()).SetNumber(12)))
+	testutil.Require(t, err != nil && strings.Contains(err.Error(), `reserved field name "eleven"`), "unexpected error: %v", err)
+	err = msg.GetField("one").TrySetNumber(10)
+	testutil.Require(t, err != nil && strings.Contains(err.Error(), "reserved tag 10"), "unexpected error: %v", err)
+	testutil.Eq(t, int32(1), msg.GetField("one").GetNumber())
+	err = msg.GetField("one").TrySetName("three")
+	testutil.Require(t, err != nil && strings.Contains(err.Error(), `reserved field name "three"`), "unexpected error: %v", err)
+	testutil.Eq(t, "one", msg.GetChildren()[0].GetName())
+
+	msg.AddField(NewField("new", FieldTypeString()).SetNumber(5))
+	_, err = NewFile("foo.proto").AddMessage(msg).Build()
+	testutil.Ok(t, err)
+}
+
+func TestRemoveEnumValueAndReserve(t *testing.T) {
+	en := NewEnum("FancyEnum").
+		AddValue(NewEnumValue("ZERO").SetNumber(0)).
+		AddValue(NewEnumValue("ONE").SetNumber(1)).
+		AddValue(NewEnumValue("TWO").SetNumber(2)).
+		AddValue(NewEnumValue("THREE").SetNumber(3)).
+		AddValue(NewEnumValue("AUTO")).
+		AddReservedRange(4, 6)
+
+	testutil.Require(t, !en.TryRemoveValueAndReserve("FOUR"))
+	testutil.Require(t, en.TryRemoveValueAndReserve("ONE"))
+	en.RemoveValueAndReserve("THREE").
+		RemoveValueAndReserve("AUTO")
+	testutil.Eq(t, []string{"ONE", "THREE", "AUTO"}, en.ReservedNames)
+	var ranges [][2]int32
+	for _, rr := range en.ReservedRanges {
+		ranges = append(ranges, [2]int32{rr.GetStart(), rr.GetEnd()})
+	}
+	// end is inclusive; 3 was merged with the existing 4-6 range
+	testutil.Eq(t, [][2]int32{{3, 6}, {1, 1}}, ranges)
+
+	en.EnforceReservations = true
+	err := en.TryAddValue(NewEnumValue("ONE").SetNumber(10))
+	testutil.Require(t, err != nil && strings.Contains(err.Error(), `reserved value name "ONE"`), "unexpected error: %v", err)
+	err = en.TryAddValue(NewEnumValue("UNO").SetNumber(1))
+	testutil.Require(t, err != nil && strings.Contains(err.Error(), "reserved number 1"), "unexpected error: %v", err)
+	err = en.GetValue("TWO").TrySetNumber(5)
+	testutil.Require(t, err != nil && strings.Contains(err.Error(), "reserved number 5"), "unexpected error: %v", err)
+	testutil.Eq(t, int32(2), en.GetValue("TWO").GetNumber())
+	err = en.GetValue("TWO").TrySetName("THREE")
+	testutil.Require(t, err != nil && strings.Contains(err.Error(), `reserved value name "THREE"`), "unexpected error: %v", err)
+
+	// removing the number in between merges the two ranges
+	en.RemoveValueAndReserve("TWO")
+	ranges = nil
+	for _, rr := range en.ReservedRanges {
+		ranges = append(ranges, [2]int32{rr.GetStart(), rr.GetEnd()})
+	}
+	testutil.Eq(t, [][2]int32{{1, 6}}, ranges)
+
+	_, err = NewFile("foo.proto").AddEnum(en).Build()
+	testutil.Ok(t, err)
+}
+
+func TestReservationsNotEnforcedByDefault(t *testing.T) {
+	// conflicts with reservations are allowed until the message is built
+	msg := NewMessage("M").
+		AddReservedRange(1, 5).
+		AddReservedName("b").
+		AddField(NewField("a", FieldTypeString()).SetNumber(2)).
+		AddField(NewField("b", FieldTypeString()).SetNumber(10))
+	en := NewEnum("E").
+		AddReservedRange(1, 5).
+		AddReservedName("ONE").
+		AddValue(NewEnumValue("ZERO").SetNumber(0)).
+		AddValue(NewEnumValue("ONE").SetNumber(10)).
+		AddValue(NewEnumValue("TWO").SetNumber(20))
+	en.GetValue("TWO").SetNumber(2)
+	file := NewFile("foo.proto").AddMessage(msg).AddEnum(en)
+
+	_, err := BuilderOptions{CollectAllErrors: true}.Build(file)
+	testutil.Nok(t, err)
+	errs, ok := err.(BuildErrors)
+	testutil.Require(t, ok, "expecting BuildErrors, got %T", err)
+	var names []string
+	for _, e := range errs {
+		names = append(names, e.Name)
+	}
+	testutil.Eq(t, []string{"M.a", "M.b", "E.ONE", "E.TWO"}, names)
+
+	// reservations that conflict with existing elements are rejected when
+	// enforced
+	msg.EnforceReservations = true
+	err = msg.TryAddReservedName("a")
+	testutil.Require(t, err != nil && strings.Contains(err.Error(), `cannot reserve name "a"`), "unexpected error: %v", err)
+	err = msg.TryAddReservedRange(9, 11)
+	testutil.Require(t, err != nil && strings.Contains(err.Error(), "cannot reserve tag 10"), "unexpected error: %v", err)
+	en.EnforceReservations = true
+	err = en.TryAddReservedName("ZERO")
+	testutil.Require(t, err != nil && strings.Contains(err.Error(), `cannot reserve name "ZERO"`), "unexpected error: %v", err)
+	err = en.TryAddReservedRange(-1, 0)
+	testutil.Require(t, err != nil && strings.Contains(err.Error(), "cannot reserve number 0"), "unexpected error: %v", err)
+	testutil.Eq(t, []string{"b"}, msg.ReservedNames)
+	testutil.Eq(t, []string{"ONE"}, en.ReservedNames)
+}
+
 func TestInterleavedFieldNumbers(t *testing.T) {
 	msg := NewMessage("MessageWithInterleavedFieldNumbers").
 		AddField(NewField("one", FieldTypeInt64()).SetNumber(1)).
@@ -1524,9 +1716,7 @@ func TestInvalid(t *testing.T) {
 						NewMessage("Foo").AddField(NewGroupField(NewMessage("Bar"))),
 					)
 			},
-			// NB: This is the actual error message returned by the protobuf runtime. It is
-			//     misleading since it says proto2 instead of proto3.
-			expectedError: "invalid group: invalid under proto2 semantics",
+			expectedError: "invalid group: invalid under proto3 semantics",
 		},
 		{
 			name: "default value in proto3",
@@ -1536,7 +1726,7 @@ func TestInvalid(t *testing.T) {
 						NewMessage("Foo").AddField(NewField("foo", FieldTypeString()).SetDefaultValue("abc")),
 					)
 			},
-			expectedError: "invalid default: cannot be specified under proto3 semantics",
+			expectedError: "invalid default: cannot be specified with implicit field presence",
 		},
 		{
 			name: "extension tag outside range",
@@ -1597,3 +1787,152 @@ func TestInvalid(t *testing.T) {
 		})
 	}
 }
+
+func TestCollectAllErrors(t *testing.T) {
+	unknownOpt := &descriptorpb.MessageOptions{}
+	unknownOpt.ProtoReflect().SetUnknown(protowire.AppendVarint(protowire.AppendTag(nil, 54321, protowire.VarintType), 1))
+
+	dep, err := NewFile("dep.proto").SetPackageName("foo.bar").
+		AddMessage(NewMessage("Dup")).
+		Build()
+	testutil.Ok(t, err)
+
+	msg := NewMessage("Foo").
+		AddReservedName("reserved").
+		AddReservedRange(10, 20).
+		AddExtensionRange(100, 200).
+		AddField(NewField("reserved", FieldTypeBool()).SetNumber(1)).
+		AddField(NewField("a", FieldTypeBool()).SetNumber(15)).
+		AddField(NewField("b", FieldTypeBool()).SetNumber(150)).
+		AddField(NewField("c", FieldTypeBool()).SetNumber(2).SetRequired()).
+		SetOptions(unknownOpt)
+	en := NewEnum("Enum").
+		AddValue(NewEnumValue("ONE").SetNumber(1)).
+		AddValue(NewEnumValue("UNO").SetNumber(1))
+	file := NewFile("foo.proto").SetPackageName("foo.bar").SetProto3(true).
+		AddImportedDependency(dep).
+		AddMessage(msg).
+		AddMessage(NewMessage("Dup")).
+		AddEnum(en).
+		AddEnum(NewEnum("Empty"))
+
+	// default mode stops at the first problem
+	_, err = file.Build()
+	testutil.Nok(t, err)
+	_, ok := err.(BuildErrors)
+	testutil.Require(t, !ok, "expecting a single error, not BuildErrors")
+
+	opts := BuilderOptions{CollectAllErrors: true, RequireInterpretedOptions: true}
+	_, err = opts.Build(file)
+	testutil.Nok(t, err)
+	errs, ok := err.(BuildErrors)
+	testutil.Require(t, ok, "expecting BuildErrors, got %T", err)
+
+	type problem struct {
+		name     string
+		category ErrorCategory
+	}
+	var actual []problem
+	for _, e := range errs {
+		actual = append(actual, problem{name: e.Name, category: e.Category})
+	}
+	expected := []problem{
+		{"foo.bar.Foo", CategoryUninterpretableOption},
+		{"foo.bar.Foo.c", CategoryInvalidDefinition},
+		{"foo.bar.Foo.reserved", CategoryNameConflict},
+		{"foo.bar.Foo.a", CategoryInvalidTag},
+		{"foo.bar.Foo.b", CategoryInvalidTag},
+		{"foo.bar.Dup", CategoryNameConflict},
+		{"foo.bar.Enum.ONE", CategoryInvalidDefinition},
+		{"foo.bar.Enum.UNO", CategoryInvalidTag},
+		{"foo.bar.Empty", CategoryInvalidDefinition},
+	}
+	testutil.Eq(t, expected, actual)
+	testutil.Require(t, strings.HasPrefix(err.Error(), "9 errors building descriptors:"), "unexpected error message: %s", err.Error())
+
+	// once the problems are fixed, the file builds successfully
+	msg.SetOptions(nil).
+		RemoveField("reserved").
+		RemoveField("a").
+		RemoveField("b").
+		RemoveField("c").
+		SetExtensionRanges(nil)
+	file.RemoveMessage("Dup").
+		RemoveEnum("Empty")
+	en.RemoveValue("UNO")
+	en.AddValue(NewEnumValue("ZERO").SetNumber(0))
+	en.RemoveValue("ONE")
+	en.AddValue(NewEnumValue("ONE").SetNumber(1))
+	_, err = opts.Build(file)
+	testutil.Ok(t, err)
+}
+
+func TestCollectAllErrors_Dependencies(t *testing.T) {
+	// problems in a dependency are reported, and the file that depends on
+	// it does not get built
+	depMsg := NewMessage("Bar").
+		AddField(NewField("a", FieldTypeString()).SetNumber(1).SetProto3Optional(true)).
+		AddField(NewField("b", FieldTypeString()).SetNumber(2).SetProto3Optional(true))
+	NewFile("dep.proto").AddMessage(depMsg)
+	msg := NewMessage("Foo").
+		AddField(NewField("bar", FieldTypeMessage(depMsg))).
+		AddField(NewField("baz", FieldTypeBool()).SetNumber(100).SetRequired())
+	file := NewFile("foo.proto").SetProto3(true).AddMessage(msg)
+
+	opts := BuilderOptions{CollectAllErrors: true}
+	_, err := opts.Build(file)
+	testutil.Nok(t, err)
+	errs, ok := err.(BuildErrors)
+	testutil.Require(t, ok, "expecting BuildErrors, got %T", err)
+	testutil.Eq(t, 3, len(errs))
+	testutil.Eq(t, "Bar.a", errs[0].Name)
+	testutil.Eq(t, "Bar.b", errs[1].Name)
+	testutil.Eq(t, "Foo.baz", errs[2].Name)
+	for _, e := range errs {
+		testutil.Eq(t, CategoryInvalidDefinition, e.Category)
+		testutil.Eq(t, e.Err, errors.Unwrap(e))
+	}
+
+	// a cycle between files is reported as a dependency problem
+	depMsg.GetFile().SetProto3(true)
+	depMsg.AddField(NewField("foo", FieldTypeMessage(msg)))
+	msg.RemoveField("baz")
+	_, err = opts.Build(file)
+	testutil.Nok(t, err)
+	errs, ok = err.(BuildErrors)
+	testutil.Require(t, ok, "expecting BuildErrors, got %T", err)
+	testutil.Eq(t, 1, len(errs))
+	testutil.Eq(t, CategoryDependency, errs[0].Category)
+	testutil.Require(t, strings.Contains(errs[0].Error(), "cyclic dependency"), "unexpected error message: %s", errs[0].Error())
+}
+
+func TestCollectAllErrors_UnresolvedType(t *testing.T) {
+	// two different versions of the same file; only one of them can be used,
+	// so types that are only in the other can't be resolved
+	v1, err := NewFile("dep.proto").AddMessage(NewMessage("A")).Build()
+	testutil.Ok(t, err)
+	v2, err := NewFile("dep.proto").AddMessage(NewMessage("B")).Build()
+	testutil.Ok(t, err)
+	msg := NewMessage("Foo").
+		AddField(NewField("a", FieldTypeImportedMessage(v1.FindMessage("A")))).
+		AddField(NewField("b", FieldTypeImportedMessage(v2.FindMessage("B"))))
+	file := NewFile("foo.proto").AddMessage(msg)
+
+	opts := BuilderOptions{CollectAllErrors: true}
+	_, err = opts.Build(file)
+	testutil.Nok(t, err)
+	errs, ok := err.(BuildErrors)
+	testutil.Require(t, ok, "expecting BuildErrors, got %T", err)
+	testutil.Eq(t, 2, len(errs))
+	testutil.Eq(t, CategoryDependency, errs[0].Category)
+	testutil.Eq(t, CategoryUnresolvedType, errs[1].Category)
+	// which version is used is not defined
+	if errs[1].Name == "Foo.a" {
+		testutil.Require(t, errs[1].Builder == msg.GetField("a"))
+		testutil.Require(t, strings.Contains(errs[1].Error(), "refers to type A, which cannot be resolved"), "unexpected error message: %s", errs[1].Error())
+	} else {
+		testutil.Eq(t, "Foo.b", errs[1].Name)
+		testutil.Require(t, errs[1].Builder == msg.GetField("b"))
+		testutil.Require(t, strings.Contains(errs[1].Error(), "refers to type B, which cannot be resolved"), "unexpected error message: %s", errs[1].Error())
+	}
+}
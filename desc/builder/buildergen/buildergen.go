@@ -0,0 +1,1039 @@
+// Package buildergen generates Go source code that reconstructs proto files
+// using the builder package. This allows small schemas to be embedded in Go
+// programs as readable, reviewable code, instead of as opaque serialized
+// descriptors.
+//
+// For each proto file, a function is generated that creates a
+// *builder.FileBuilder, using builder.NewMessage, builder.NewField, and the
+// like, and that returns it. The returned builder can be modified or built
+// into a descriptor.
+//
+// Files that the proto file imports are not reconstructed. Instead, the
+// generated code loads them using desc.LoadFileDescriptor, which means that
+// their generated Go code (such as the packages in
+// google.golang.org/protobuf/types/known for the well-known types) must be
+// linked into the program.
+package buildergen
+
+import (
+	"fmt"
+	"math"
+	"path"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+	"unicode"
+
+	"github.com/jhump/gopoet"
+	"google.golang.org/protobuf/encoding/protowire"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protoreflect"
+	"google.golang.org/protobuf/reflect/protoregistry"
+	"google.golang.org/protobuf/types/descriptorpb"
+
+	"github.com/jhump/protoreflect/desc"
+	"github.com/jhump/protoreflect/desc/builder"
+	"github.com/jhump/protoreflect/dynamic"
+)
+
+const (
+	builderPath = "github.com/jhump/protoreflect/desc/builder"
+	descPath    = "github.com/jhump/protoreflect/desc"
+	protoPath   = "google.golang.org/protobuf/proto"
+	mathPath    = "math"
+)
+
+// Generator generates Go source code that reconstructs proto files using the
+// builder package.
+type Generator struct {
+	// The import path of the Go package into which code is generated. This is
+	// required when GenerateFile or GenerateFileBuilder creates a new Go file.
+	PackagePath string
+	// The name of the Go package into which code is generated. If empty, the
+	// last element of PackagePath is used.
+	PackageName string
+	// The name of the generated function. If empty, the name is derived from
+	// the name of the proto file, so "foo/bar_baz.proto" results in a function
+	// named "BarBazProto".
+	FuncName string
+}
+
+// GenerateFile returns a new Go file that contains a function which
+// reconstructs the given file descriptor. The function has the following
+// signature:
+//
+//	func FooProto() (*builder.FileBuilder, error)
+//
+// An error is only returned from the generated function if a file that the
+// proto file imports cannot be loaded. The generated Go file can be written
+// using gopoet.WriteGoFile.
+func (g *Generator) GenerateFile(fd *desc.FileDescriptor) (*gopoet.GoFile, error) {
+	if g.PackagePath == "" {
+		return nil, fmt.Errorf("package path must be specified")
+	}
+	pkgName := g.PackageName
+	if pkgName == "" {
+		pkgName = goPackageName(g.PackagePath)
+	}
+	fileName := strings.TrimSuffix(path.Base(fd.GetName()), ".proto") + ".pb.builder.go"
+	f := gopoet.NewGoFile(fileName, g.PackagePath, pkgName)
+	f.FileComment = "Code generated by buildergen. DO NOT EDIT.\n" +
+		"source: " + fd.GetName()
+	if err := g.AddFile(f, fd); err != nil {
+		return nil, err
+	}
+	return f, nil
+}
+
+// GenerateFileBuilder is like GenerateFile, except that it accepts a file
+// builder. The builder is first built into a descriptor, so the generated code
+// reconstructs the file that results from building it.
+func (g *Generator) GenerateFileBuilder(fb *builder.FileBuilder) (*gopoet.GoFile, error) {
+	fd, err := fb.Build()
+	if err != nil {
+		return nil, err
+	}
+	return g.GenerateFile(fd)
+}
+
+// AddFile adds a function which reconstructs the given file descriptor to the
+// given Go file. This can be used to generate code for multiple proto files
+// into a single Go file. See GenerateFile for more details.
+func (g *Generator) AddFile(f *gopoet.GoFile, fd *desc.FileDescriptor) error {
+	funcName := g.FuncName
+	if funcName == "" {
+		funcName = camelCase(strings.TrimSuffix(path.Base(fd.GetName()), ".proto"), true) + "Proto"
+	}
+	fg := newFileGen(fd)
+	if err := fg.generate(); err != nil {
+		return err
+	}
+	fn := gopoet.NewFunc(funcName).
+		SetComment(fmt.Sprintf("%s returns a builder that reconstructs %q.", funcName, fd.GetName())).
+		AddResult("", gopoet.PointerType(gopoet.NamedType(gopoet.NewSymbol(builderPath, "FileBuilder")))).
+		AddResult("", gopoet.ErrorType).
+		AddCode(&fg.loads).
+		AddCode(&fg.body)
+	f.AddElement(fn)
+	return nil
+}
+
+type extensionKey struct {
+	extendee string
+	tag      int32
+}
+
+// fileGen generates the body of the function for a single file.
+type fileGen struct {
+	fd *desc.FileDescriptor
+	// code that loads dependencies; this precedes body in the generated code
+	loads gopoet.CodeBlock
+	body  gopoet.CodeBlock
+	// the statement currently being generated, and the number of chained
+	// method calls generated so far
+	cur   *gopoet.CodeBlock
+	calls int
+
+	names    map[string]struct{}
+	msgVars  map[*desc.MessageDescriptor]string
+	enumVars map[*desc.EnumDescriptor]string
+	fileVars map[string]string
+	// extensions in direct dependencies, used to interpret custom options
+	exts map[extensionKey]*desc.FieldDescriptor
+}
+
+func newFileGen(fd *desc.FileDescriptor) *fileGen {
+	fg := &fileGen{
+		fd:       fd,
+		names:    map[string]struct{}{"fb": {}, "err": {}, "opts": {}},
+		msgVars:  map[*desc.MessageDescriptor]string{},
+		enumVars: map[*desc.EnumDescriptor]string{},
+		fileVars: map[string]string{},
+		exts:     map[extensionKey]*desc.FieldDescriptor{},
+	}
+	for _, dep := range fd.GetDependencies() {
+		for _, extd := range allExtensions(dep) {
+			fg.exts[extensionKey{extendee: extd.GetOwner().GetFullyQualifiedName(), tag: extd.GetNumber()}] = extd
+		}
+	}
+	return fg
+}
+
+func (fg *fileGen) generate() error {
+	for _, dep := range fg.fd.GetDependencies() {
+		fg.fileVar(dep)
+	}
+	// Declare all messages and enums first, so they can refer to one another
+	// regardless of the order in which they are defined.
+	for _, md := range fg.fd.GetMessageTypes() {
+		fg.declareMessage(md)
+	}
+	for _, ed := range fg.fd.GetEnumTypes() {
+		fg.declareEnum(ed)
+	}
+	fg.body.Println("")
+
+	for _, md := range fg.fd.GetMessageTypes() {
+		if err := fg.defineMessage(md); err != nil {
+			return err
+		}
+	}
+	for _, ed := range fg.fd.GetEnumTypes() {
+		if err := fg.defineEnum(ed); err != nil {
+			return err
+		}
+	}
+	return fg.defineFile()
+}
+
+// startStatement starts a new statement, which consists of method calls
+// chained to the given variable.
+func (fg *fileGen) startStatement(v string) int {
+	fg.cur = &gopoet.CodeBlock{}
+	fg.cur.Print(v)
+	return fg.calls
+}
+
+// endStatement adds the current statement to the function body, unless no
+// methods were called since the given call count was returned from
+// startStatement.
+func (fg *fileGen) endStatement(calls int) {
+	if fg.calls > calls {
+		fg.body.AddCode(fg.cur)
+		fg.body.Println("")
+		fg.body.Println("")
+	}
+	fg.cur = nil
+}
+
+// chain prints a method call that is chained to the preceding expression.
+func (fg *fileGen) chain(format string, args ...interface{}) {
+	fg.cur.Printf(".\n"+format, args...)
+	fg.calls++
+}
+
+func (fg *fileGen) varName(base string) string {
+	name := base
+	for i := 2; ; i++ {
+		if _, ok := fg.names[name]; !ok {
+			break
+		}
+		name = base + strconv.Itoa(i)
+	}
+	fg.names[name] = struct{}{}
+	return name
+}
+
+func (fg *fileGen) relativeName(d desc.Descriptor) string {
+	if pkg := fg.fd.GetPackage(); pkg != "" {
+		return strings.TrimPrefix(d.GetFullyQualifiedName(), pkg+".")
+	}
+	return d.GetFullyQualifiedName()
+}
+
+func (fg *fileGen) declareMessage(md *desc.MessageDescriptor) {
+	if md.IsMapEntry() {
+		return
+	}
+	v := fg.varName(camelCase(fg.relativeName(md), false) + "Msg")
+	fg.msgVars[md] = v
+	fg.body.Printlnf("%s := %s(%q)", v, gopoet.NewSymbol(builderPath, "NewMessage"), md.GetName())
+	for _, nmd := range md.GetNestedMessageTypes() {
+		fg.declareMessage(nmd)
+	}
+	for _, ed := range md.GetNestedEnumTypes() {
+		fg.declareEnum(ed)
+	}
+}
+
+func (fg *fileGen) declareEnum(ed *desc.EnumDescriptor) {
+	v := camelCase(fg.relativeName(ed), false)
+	if !strings.HasSuffix(v, "Enum") {
+		v += "Enum"
+	}
+	v = fg.varName(v)
+	fg.enumVars[ed] = v
+	fg.body.Printlnf("%s := %s(%q)", v, gopoet.NewSymbol(builderPath, "NewEnum"), ed.GetName())
+}
+
+// fileVar returns the name of a variable that holds the descriptor for the
+// given imported file, generating code to load it if necessary.
+func (fg *fileGen) fileVar(fd *desc.FileDescriptor) string {
+	if v, ok := fg.fileVars[fd.GetName()]; ok {
+		return v
+	}
+	v := fg.varName(camelCase(strings.TrimSuffix(path.Base(fd.GetName()), ".proto"), false) + "File")
+	fg.fileVars[fd.GetName()] = v
+	fg.loads.Printlnf("%s, err := %s(%q)", v, gopoet.NewSymbol(descPath, "LoadFileDescriptor"), fd.GetName())
+	fg.loads.Println("if err != nil {")
+	fg.loads.Println("return nil, err")
+	fg.loads.Println("}")
+	return v
+}
+
+func (fg *fileGen) isLocal(d desc.Descriptor) bool {
+	return d.GetFile().GetName() == fg.fd.GetName()
+}
+
+// isGroup returns true if the given field should be created with
+// builder.NewGroupField.
+func (fg *fileGen) isGroup(fld *desc.FieldDescriptor) bool {
+	if fld.GetType() != descriptorpb.FieldDescriptorProto_TYPE_GROUP || fld.IsExtension() || fg.fd.IsEditions() {
+		return false
+	}
+	md := fld.GetMessageType()
+	return fg.isLocal(md) && md.GetParent() == fld.GetOwner() && strings.ToLower(md.GetName()) == fld.GetName()
+}
+
+func (fg *fileGen) defineMessage(md *desc.MessageDescriptor) error {
+	if md.IsMapEntry() {
+		return nil
+	}
+	calls := fg.startStatement(fg.msgVars[md])
+	cb := fg.cur
+	fg.printComments(md)
+	if err := fg.printOptions(md.GetMessageOptions(), true); err != nil {
+		return err
+	}
+
+	groups := map[*desc.MessageDescriptor]struct{}{}
+	seenOneOfs := map[*desc.OneOfDescriptor]struct{}{}
+	for _, fld := range md.GetFields() {
+		if fg.isGroup(fld) {
+			groups[fld.GetMessageType()] = struct{}{}
+		}
+		if ood := fld.GetOneOf(); ood != nil && !ood.IsSynthetic() {
+			if _, ok := seenOneOfs[ood]; ok {
+				continue
+			}
+			seenOneOfs[ood] = struct{}{}
+			fg.chain("AddOneOf(%s(%q)", gopoet.NewSymbol(builderPath, "NewOneOf"), ood.GetName())
+			fg.printComments(ood)
+			if err := fg.printOptions(ood.GetOneOfOptions(), true); err != nil {
+				return err
+			}
+			for _, choice := range ood.GetChoices() {
+				if fg.isGroup(choice) {
+					groups[choice.GetMessageType()] = struct{}{}
+				}
+				fg.chain("AddChoice(")
+				if err := fg.printField(choice); err != nil {
+					return err
+				}
+				cb.Print(")")
+			}
+			cb.Print(")")
+			continue
+		}
+		fg.chain("AddField(")
+		if err := fg.printField(fld); err != nil {
+			return err
+		}
+		cb.Print(")")
+	}
+	for _, nmd := range md.GetNestedMessageTypes() {
+		if _, ok := groups[nmd]; ok || nmd.IsMapEntry() {
+			continue
+		}
+		fg.chain("AddNestedMessage(%s)", fg.msgVars[nmd])
+	}
+	for _, ed := range md.GetNestedEnumTypes() {
+		fg.chain("AddNestedEnum(%s)", fg.enumVars[ed])
+	}
+	for _, exd := range md.GetNestedExtensions() {
+		fg.chain("AddNestedExtension(")
+		if err := fg.printField(exd); err != nil {
+			return err
+		}
+		cb.Print(")")
+	}
+	mdp := md.AsDescriptorProto()
+	for _, er := range mdp.GetExtensionRange() {
+		if er.Options == nil {
+			fg.chain("AddExtensionRange(%d, %d)", er.GetStart(), er.GetEnd()-1)
+			continue
+		}
+		fg.chain("AddExtensionRangeWithOptions(%d, %d, ", er.GetStart(), er.GetEnd()-1)
+		if err := fg.printOptionsValue(er.Options); err != nil {
+			return err
+		}
+		cb.Print(")")
+	}
+	for _, rr := range mdp.GetReservedRange() {
+		fg.chain("AddReservedRange(%d, %d)", rr.GetStart(), rr.GetEnd()-1)
+	}
+	for _, name := range mdp.GetReservedName() {
+		fg.chain("AddReservedName(%q)", name)
+	}
+	fg.endStatement(calls)
+
+	for _, nmd := range md.GetNestedMessageTypes() {
+		if err := fg.defineMessage(nmd); err != nil {
+			return err
+		}
+	}
+	for _, ed := range md.GetNestedEnumTypes() {
+		if err := fg.defineEnum(ed); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (fg *fileGen) defineEnum(ed *desc.EnumDescriptor) error {
+	calls := fg.startStatement(fg.enumVars[ed])
+	cb := fg.cur
+	fg.printComments(ed)
+	if err := fg.printOptions(ed.GetEnumOptions(), true); err != nil {
+		return err
+	}
+	for _, evd := range ed.GetValues() {
+		fg.chain("AddValue(%s(%q)", gopoet.NewSymbol(builderPath, "NewEnumValue"), evd.GetName())
+		fg.chain("SetNumber(%d)", evd.GetNumber())
+		fg.printComments(evd)
+		if err := fg.printOptions(evd.GetEnumValueOptions(), true); err != nil {
+			return err
+		}
+		cb.Print(")")
+	}
+	edp := ed.AsEnumDescriptorProto()
+	for _, rr := range edp.GetReservedRange() {
+		fg.chain("AddReservedRange(%d, %d)", rr.GetStart(), rr.GetEnd())
+	}
+	for _, name := range edp.GetReservedName() {
+		fg.chain("AddReservedName(%q)", name)
+	}
+	fg.endStatement(calls)
+	return nil
+}
+
+func (fg *fileGen) defineFile() error {
+	fd := fg.fd
+	fg.startStatement("fb := ")
+	cb := fg.cur
+	cb.Printf("%s(%q)", gopoet.NewSymbol(builderPath, "NewFile"), fd.GetName())
+	if fd.GetPackage() != "" {
+		fg.chain("SetPackageName(%q)", fd.GetPackage())
+	}
+	switch {
+	case fd.IsEditions():
+		fg.chain("SetEdition(%s)", enumConstant(reflect.ValueOf(fd.GetEdition())))
+	case fd.IsProto3():
+		fg.chain("SetProto3(true)")
+	}
+	fg.printComments(fd)
+	for _, loc := range fd.AsFileDescriptorProto().GetSourceCodeInfo().GetLocation() {
+		if len(loc.Path) != 1 {
+			continue
+		}
+		switch loc.Path[0] {
+		case 12: // syntax
+			fg.printCommentsCall("SetSyntaxComments", loc)
+		case 2: // package
+			fg.printCommentsCall("SetPackageComments", loc)
+		}
+	}
+	if err := fg.printOptions(fd.GetFileOptions(), true); err != nil {
+		return err
+	}
+	for _, dep := range fd.GetDependencies() {
+		fg.chain("AddImportedDependency(%s)", fg.fileVar(dep))
+	}
+	for _, md := range fd.GetMessageTypes() {
+		fg.chain("AddMessage(%s)", fg.msgVars[md])
+	}
+	for _, ed := range fd.GetEnumTypes() {
+		fg.chain("AddEnum(%s)", fg.enumVars[ed])
+	}
+	for _, exd := range fd.GetExtensions() {
+		fg.chain("AddExtension(")
+		if err := fg.printField(exd); err != nil {
+			return err
+		}
+		cb.Print(")")
+	}
+	for _, sd := range fd.GetServices() {
+		fg.chain("AddService(%s(%q)", gopoet.NewSymbol(builderPath, "NewService"), sd.GetName())
+		fg.printComments(sd)
+		if err := fg.printOptions(sd.GetServiceOptions(), true); err != nil {
+			return err
+		}
+		for _, mtd := range sd.GetMethods() {
+			fg.chain("AddMethod(%s(%q, ", gopoet.NewSymbol(builderPath, "NewMethod"), mtd.GetName())
+			fg.printRpcType(mtd.GetInputType(), mtd.IsClientStreaming())
+			cb.Print(", ")
+			fg.printRpcType(mtd.GetOutputType(), mtd.IsServerStreaming())
+			cb.Print(")")
+			fg.printComments(mtd)
+			if err := fg.printOptions(mtd.GetMethodOptions(), true); err != nil {
+				return err
+			}
+			cb.Print(")")
+		}
+		cb.Print(")")
+	}
+	fg.body.AddCode(cb)
+	fg.body.Println("")
+	fg.body.Println("return fb, nil")
+	fg.cur = nil
+	return nil
+}
+
+func (fg *fileGen) printRpcType(md *desc.MessageDescriptor, stream bool) {
+	if fg.isLocal(md) {
+		fg.cur.Printf("%s(%s, %t)", gopoet.NewSymbol(builderPath, "RpcTypeMessage"), fg.msgVars[md], stream)
+	} else {
+		fg.cur.Printf("%s(%s.FindMessage(%q), %t)", gopoet.NewSymbol(builderPath, "RpcTypeImportedMessage"),
+			fg.fileVar(md.GetFile()), md.GetFullyQualifiedName(), stream)
+	}
+}
+
+var scalarTypeFuncs = map[descriptorpb.FieldDescriptorProto_Type]string{
+	descriptorpb.FieldDescriptorProto_TYPE_INT32:    "FieldTypeInt32",
+	descriptorpb.FieldDescriptorProto_TYPE_UINT32:   "FieldTypeUInt32",
+	descriptorpb.FieldDescriptorProto_TYPE_SINT32:   "FieldTypeSInt32",
+	descriptorpb.FieldDescriptorProto_TYPE_FIXED32:  "FieldTypeFixed32",
+	descriptorpb.FieldDescriptorProto_TYPE_SFIXED32: "FieldTypeSFixed32",
+	descriptorpb.FieldDescriptorProto_TYPE_INT64:    "FieldTypeInt64",
+	descriptorpb.FieldDescriptorProto_TYPE_UINT64:   "FieldTypeUInt64",
+	descriptorpb.FieldDescriptorProto_TYPE_SINT64:   "FieldTypeSInt64",
+	descriptorpb.FieldDescriptorProto_TYPE_FIXED64:  "FieldTypeFixed64",
+	descriptorpb.FieldDescriptorProto_TYPE_SFIXED64: "FieldTypeSFixed64",
+	descriptorpb.FieldDescriptorProto_TYPE_FLOAT:    "FieldTypeFloat",
+	descriptorpb.FieldDescriptorProto_TYPE_DOUBLE:   "FieldTypeDouble",
+	descriptorpb.FieldDescriptorProto_TYPE_BOOL:     "FieldTypeBool",
+	descriptorpb.FieldDescriptorProto_TYPE_STRING:   "FieldTypeString",
+	descriptorpb.FieldDescriptorProto_TYPE_BYTES:    "FieldTypeBytes",
+}
+
+func (fg *fileGen) printFieldType(fld *desc.FieldDescriptor) {
+	cb := fg.cur
+	if md := fld.GetMessageType(); md != nil {
+		if fg.isLocal(md) {
+			cb.Printf("%s(%s)", gopoet.NewSymbol(builderPath, "FieldTypeMessage"), fg.msgVars[md])
+		} else {
+			cb.Printf("%s(%s.FindMessage(%q))", gopoet.NewSymbol(builderPath, "FieldTypeImportedMessage"),
+				fg.fileVar(md.GetFile()), md.GetFullyQualifiedName())
+		}
+		return
+	}
+	if ed := fld.GetEnumType(); ed != nil {
+		if fg.isLocal(ed) {
+			cb.Printf("%s(%s)", gopoet.NewSymbol(builderPath, "FieldTypeEnum"), fg.enumVars[ed])
+		} else {
+			cb.Printf("%s(%s.FindEnum(%q))", gopoet.NewSymbol(builderPath, "FieldTypeImportedEnum"),
+				fg.fileVar(ed.GetFile()), ed.GetFullyQualifiedName())
+		}
+		return
+	}
+	cb.Printf("%s()", gopoet.NewSymbol(builderPath, scalarTypeFuncs[fld.GetType()]))
+}
+
+func (fg *fileGen) printField(fld *desc.FieldDescriptor) error {
+	cb := fg.cur
+	fdp := fld.AsFieldDescriptorProto()
+	switch {
+	case fld.IsExtension():
+		extendee := fld.GetOwner()
+		if fg.isLocal(extendee) {
+			cb.Printf("%s(%q, %d, ", gopoet.NewSymbol(builderPath, "NewExtension"), fld.GetName(), fld.GetNumber())
+			fg.printFieldType(fld)
+			cb.Printf(", %s)", fg.msgVars[extendee])
+		} else {
+			cb.Printf("%s(%q, %d, ", gopoet.NewSymbol(builderPath, "NewExtensionImported"), fld.GetName(), fld.GetNumber())
+			fg.printFieldType(fld)
+			cb.Printf(", %s.FindMessage(%q))", fg.fileVar(extendee.GetFile()), extendee.GetFullyQualifiedName())
+		}
+	case fld.IsMap():
+		cb.Printf("%s(%q, ", gopoet.NewSymbol(builderPath, "NewMapField"), fld.GetName())
+		fg.printFieldType(fld.GetMapKeyType())
+		cb.Print(", ")
+		fg.printFieldType(fld.GetMapValueType())
+		cb.Print(")")
+		fg.chain("SetNumber(%d)", fld.GetNumber())
+	case fg.isGroup(fld):
+		cb.Printf("%s(%s)", gopoet.NewSymbol(builderPath, "NewGroupField"), fg.msgVars[fld.GetMessageType()])
+		fg.chain("SetNumber(%d)", fld.GetNumber())
+	default:
+		cb.Printf("%s(%q, ", gopoet.NewSymbol(builderPath, "NewField"), fld.GetName())
+		fg.printFieldType(fld)
+		cb.Print(")")
+		fg.chain("SetNumber(%d)", fld.GetNumber())
+	}
+
+	if !fld.IsMap() {
+		switch fdp.GetLabel() {
+		case descriptorpb.FieldDescriptorProto_LABEL_REPEATED:
+			fg.chain("SetRepeated()")
+		case descriptorpb.FieldDescriptorProto_LABEL_REQUIRED:
+			fg.chain("SetRequired()")
+		}
+	}
+	if fld.IsProto3Optional() {
+		fg.chain("SetProto3Optional(true)")
+	}
+	if fdp.DefaultValue != nil {
+		fg.chain("SetDefaultValue(%q)", fdp.GetDefaultValue())
+	}
+	if fdp.JsonName != nil && fdp.GetJsonName() != defaultJSONName(fld.GetName()) {
+		fg.chain("SetJsonName(%q)", fdp.GetJsonName())
+	}
+	fg.printComments(fld)
+	return fg.printOptions(fld.GetFieldOptions(), true)
+}
+
+func (fg *fileGen) printComments(d desc.Descriptor) {
+	if loc := d.GetSourceInfo(); loc != nil {
+		fg.printCommentsCall("SetComments", loc)
+	}
+}
+
+func (fg *fileGen) printCommentsCall(method string, loc *descriptorpb.SourceCodeInfo_Location) {
+	if loc.LeadingComments == nil && loc.TrailingComments == nil && len(loc.LeadingDetachedComments) == 0 {
+		return
+	}
+	cb := fg.cur
+	fg.chain("%s(%s{", method, gopoet.NewSymbol(builderPath, "Comments"))
+	if len(loc.LeadingDetachedComments) > 0 {
+		cb.Print("\nLeadingDetachedComments: []string{")
+		for _, c := range loc.LeadingDetachedComments {
+			cb.Printf("\n%q,", c)
+		}
+		cb.Print("\n},")
+	}
+	if loc.LeadingComments != nil {
+		cb.Printf("\nLeadingComment: %q,", loc.GetLeadingComments())
+	}
+	if loc.TrailingComments != nil {
+		cb.Printf("\nTrailingComment: %q,", loc.GetTrailingComments())
+	}
+	cb.Print("\n})")
+}
+
+// customOption is a custom option whose value can be set with a call to
+// SetOption on the builder.
+type customOption struct {
+	extd *desc.FieldDescriptor
+	val  interface{}
+}
+
+// splitOptions separates the given options into the standard options, custom
+// options whose extensions are defined in direct dependencies and that have
+// scalar values, and the encoded bytes for all other custom options.
+func (fg *fileGen) splitOptions(opts proto.Message) (proto.Message, []customOption, []byte, error) {
+	data, err := proto.MarshalOptions{Deterministic: true}.Marshal(opts)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	std := opts.ProtoReflect().New().Interface()
+	// with an empty resolver, all extensions end up as unknown fields
+	if err := (proto.UnmarshalOptions{Resolver: &protoregistry.Types{}}).Unmarshal(data, std); err != nil {
+		return nil, nil, nil, err
+	}
+	unknown := std.ProtoReflect().GetUnknown()
+	std.ProtoReflect().SetUnknown(nil)
+	if len(unknown) == 0 {
+		return std, nil, nil, nil
+	}
+
+	// group the encoded custom options by tag, retaining their order
+	var tags []protowire.Number
+	byTag := map[protowire.Number][]byte{}
+	for b := unknown; len(b) > 0; {
+		tag, _, n := protowire.ConsumeField(b)
+		if n < 0 {
+			return nil, nil, nil, protowire.ParseError(n)
+		}
+		if _, ok := byTag[tag]; !ok {
+			tags = append(tags, tag)
+		}
+		byTag[tag] = append(byTag[tag], b[:n]...)
+		b = b[n:]
+	}
+
+	md, err := desc.WrapMessage(opts.ProtoReflect().Descriptor())
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	var custom []customOption
+	var raw []byte
+	for _, tag := range tags {
+		extd := fg.exts[extensionKey{extendee: md.GetFullyQualifiedName(), tag: int32(tag)}]
+		if extd == nil || extd.GetMessageType() != nil {
+			raw = append(raw, byTag[tag]...)
+			continue
+		}
+		var er dynamic.ExtensionRegistry
+		if err := er.AddExtension(extd); err != nil {
+			return nil, nil, nil, err
+		}
+		dm := dynamic.NewMessageWithExtensionRegistry(md, &er)
+		if err := dm.Unmarshal(byTag[tag]); err != nil {
+			return nil, nil, nil, err
+		}
+		val, err := dm.TryGetField(extd)
+		if err != nil {
+			return nil, nil, nil, err
+		}
+		custom = append(custom, customOption{extd: extd, val: val})
+	}
+	return std, custom, raw, nil
+}
+
+// printOptions prints calls that set the given options on a builder. If
+// allowCustom is true, custom options are set using SetOption where possible.
+func (fg *fileGen) printOptions(opts proto.Message, allowCustom bool) error {
+	if isNil(opts) || proto.Size(opts) == 0 {
+		return nil
+	}
+	std, custom, raw, err := fg.splitOptions(opts)
+	if err != nil {
+		return err
+	}
+	cb := fg.cur
+	if proto.Size(std) > 0 || len(raw) > 0 {
+		fg.chain("SetOptions(")
+		fg.printOptionsLiteral(std, raw)
+		cb.Print(")")
+	}
+	for _, opt := range custom {
+		fg.chain("SetOption(%s.FindExtensionByName(%q), ", fg.fileVar(opt.extd.GetFile()), opt.extd.GetFullyQualifiedName())
+		fg.printOptionValue(opt.extd, opt.val)
+		cb.Print(")")
+	}
+	return nil
+}
+
+// printOptionsValue prints an expression for the given options.
+func (fg *fileGen) printOptionsValue(opts proto.Message) error {
+	data, err := proto.MarshalOptions{Deterministic: true}.Marshal(opts)
+	if err != nil {
+		return err
+	}
+	std := opts.ProtoReflect().New().Interface()
+	if err := (proto.UnmarshalOptions{Resolver: &protoregistry.Types{}}).Unmarshal(data, std); err != nil {
+		return err
+	}
+	raw := std.ProtoReflect().GetUnknown()
+	std.ProtoReflect().SetUnknown(nil)
+	fg.printOptionsLiteral(std, raw)
+	return nil
+}
+
+func (fg *fileGen) printOptionsLiteral(std proto.Message, raw []byte) {
+	cb := fg.cur
+	if len(raw) == 0 {
+		fg.printLiteral(reflect.ValueOf(std))
+		return
+	}
+	// Options that can't otherwise be expressed are set as unknown fields.
+	cb.Printf("func() %s {\nopts := ", reflect.TypeOf(std))
+	fg.printLiteral(reflect.ValueOf(std))
+	cb.Print("\n// custom options, in binary form")
+	cb.Print("\nopts.ProtoReflect().SetUnknown([]byte{")
+	for i, b := range raw {
+		if i%16 == 0 {
+			cb.Print("\n")
+		} else {
+			cb.Print(" ")
+		}
+		cb.Printf("0x%02x,", b)
+	}
+	cb.Print("\n})\nreturn opts\n}()")
+}
+
+// printLiteral prints a Go expression for the given value, which is a field of
+// a generated message struct (or the message itself).
+func (fg *fileGen) printLiteral(v reflect.Value) {
+	cb := fg.cur
+	t := v.Type()
+	switch t.Kind() {
+	case reflect.Ptr:
+		elem := t.Elem()
+		switch {
+		case elem.Kind() == reflect.Struct:
+			cb.Print("&")
+			fg.printStructLiteral(v.Elem())
+		case isEnum(elem):
+			cb.Printf("%s.Enum()", enumConstant(v.Elem()))
+		default:
+			fn := strings.ToUpper(elem.Name()[:1]) + elem.Name()[1:]
+			cb.Printf("%s(", gopoet.NewSymbol(protoPath, fn))
+			fg.printScalar(v.Elem())
+			cb.Print(")")
+		}
+	case reflect.Slice:
+		if t.Elem().Kind() == reflect.Uint8 {
+			cb.Printf("[]byte(%q)", v.Bytes())
+			return
+		}
+		cb.Printf("%s{", t)
+		for i := 0; i < v.Len(); i++ {
+			cb.Print("\n")
+			e := v.Index(i)
+			if e.Kind() == reflect.Ptr && e.Type().Elem().Kind() == reflect.Struct {
+				// type is elided in slice literal
+				fg.printStructLiteral(e.Elem())
+			} else {
+				fg.printLiteral(e)
+			}
+			cb.Print(",")
+		}
+		cb.Print("\n}")
+	default:
+		if isEnum(t) {
+			cb.Printf("%s", enumConstant(v))
+		} else {
+			fg.printScalar(v)
+		}
+	}
+}
+
+func (fg *fileGen) printStructLiteral(v reflect.Value) {
+	cb := fg.cur
+	t := v.Type()
+	cb.Printf("%s{", t)
+	empty := true
+	for i := 0; i < t.NumField(); i++ {
+		sf := t.Field(i)
+		if !sf.IsExported() || sf.Tag.Get("protobuf") == "" {
+			continue
+		}
+		fv := v.Field(i)
+		if fv.IsZero() {
+			continue
+		}
+		cb.Printf("\n%s: ", sf.Name)
+		fg.printLiteral(fv)
+		cb.Print(",")
+		empty = false
+	}
+	if !empty {
+		cb.Print("\n")
+	}
+	cb.Print("}")
+}
+
+func (fg *fileGen) printScalar(v reflect.Value) {
+	cb := fg.cur
+	switch v.Kind() {
+	case reflect.Float32, reflect.Float64:
+		fg.printFloat(v.Float(), v.Type().Bits())
+	case reflect.String:
+		cb.Printf("%q", v.String())
+	default:
+		cb.Printf("%v", v.Interface())
+	}
+}
+
+func (fg *fileGen) printOptionValue(extd *desc.FieldDescriptor, val interface{}) {
+	cb := fg.cur
+	if extd.IsRepeated() {
+		vals := val.([]interface{})
+		cb.Printf("[]%s{", goTypeForField(extd))
+		for i, v := range vals {
+			if i > 0 {
+				cb.Print(", ")
+			}
+			fg.printOptionScalar(extd, v, false)
+		}
+		cb.Print("}")
+		return
+	}
+	fg.printOptionScalar(extd, val, true)
+}
+
+func (fg *fileGen) printOptionScalar(extd *desc.FieldDescriptor, val interface{}, typed bool) {
+	cb := fg.cur
+	switch val := val.(type) {
+	case string:
+		cb.Printf("%q", val)
+		return
+	case []byte:
+		cb.Printf("[]byte(%q)", val)
+		return
+	case bool:
+		cb.Printf("%t", val)
+		return
+	}
+	if typed {
+		cb.Printf("%s(", goTypeForField(extd))
+	}
+	switch val := val.(type) {
+	case float32:
+		fg.printFloat(float64(val), 32)
+	case float64:
+		fg.printFloat(val, 64)
+	default:
+		cb.Printf("%v", val)
+	}
+	if typed {
+		cb.Print(")")
+	}
+}
+
+func goTypeForField(fld *desc.FieldDescriptor) string {
+	switch fld.GetType() {
+	case descriptorpb.FieldDescriptorProto_TYPE_INT32, descriptorpb.FieldDescriptorProto_TYPE_SINT32,
+		descriptorpb.FieldDescriptorProto_TYPE_SFIXED32, descriptorpb.FieldDescriptorProto_TYPE_ENUM:
+		return "int32"
+	case descriptorpb.FieldDescriptorProto_TYPE_INT64, descriptorpb.FieldDescriptorProto_TYPE_SINT64,
+		descriptorpb.FieldDescriptorProto_TYPE_SFIXED64:
+		return "int64"
+	case descriptorpb.FieldDescriptorProto_TYPE_UINT32, descriptorpb.FieldDescriptorProto_TYPE_FIXED32:
+		return "uint32"
+	case descriptorpb.FieldDescriptorProto_TYPE_UINT64, descriptorpb.FieldDescriptorProto_TYPE_FIXED64:
+		return "uint64"
+	case descriptorpb.FieldDescriptorProto_TYPE_FLOAT:
+		return "float32"
+	case descriptorpb.FieldDescriptorProto_TYPE_DOUBLE:
+		return "float64"
+	case descriptorpb.FieldDescriptorProto_TYPE_BOOL:
+		return "bool"
+	case descriptorpb.FieldDescriptorProto_TYPE_STRING:
+		return "string"
+	default:
+		return "[]byte"
+	}
+}
+
+func (fg *fileGen) printFloat(f float64, bits int) {
+	cb := fg.cur
+	switch {
+	case math.IsNaN(f):
+		cb.Printf("%s()", gopoet.NewSymbol(mathPath, "NaN"))
+	case math.IsInf(f, 1):
+		cb.Printf("%s(1)", gopoet.NewSymbol(mathPath, "Inf"))
+	case math.IsInf(f, -1):
+		cb.Printf("%s(-1)", gopoet.NewSymbol(mathPath, "Inf"))
+	default:
+		s := strconv.FormatFloat(f, 'g', -1, bits)
+		if !strings.ContainsAny(s, ".eEn") {
+			s += ".0"
+		}
+		cb.Print(s)
+	}
+}
+
+var typeOfProtoEnum = reflect.TypeOf((*protoreflect.Enum)(nil)).Elem()
+
+func isEnum(t reflect.Type) bool {
+	return t.Kind() == reflect.Int32 && t.Implements(typeOfProtoEnum)
+}
+
+// enumConstant returns the symbol for the Go constant that corresponds to the
+// given value of a generated enum type.
+func enumConstant(v reflect.Value) interface{} {
+	t := v.Type()
+	ed := v.Interface().(protoreflect.Enum).Descriptor()
+	evd := ed.Values().ByNumber(protoreflect.EnumNumber(v.Int()))
+	if evd == nil {
+		return fmt.Sprintf("%s(%d)", gopoet.TypeNameForReflectType(t), v.Int())
+	}
+	prefix := t.Name() + "_"
+	if _, ok := ed.Parent().(protoreflect.MessageDescriptor); ok {
+		// constants for nested enums are prefixed with the message's name
+		prefix = strings.TrimSuffix(t.Name(), string(ed.Name()))
+	}
+	return gopoet.NewSymbol(t.PkgPath(), prefix+string(evd.Name()))
+}
+
+func isNil(opts proto.Message) bool {
+	rv := reflect.ValueOf(opts)
+	return !rv.IsValid() || (rv.Kind() == reflect.Ptr && rv.IsNil())
+}
+
+// allExtensions returns all extensions defined in the given file, including
+// nested ones, sorted by name.
+func allExtensions(fd *desc.FileDescriptor) []*desc.FieldDescriptor {
+	exts := append([]*desc.FieldDescriptor(nil), fd.GetExtensions()...)
+	var addNested func(mds []*desc.MessageDescriptor)
+	addNested = func(mds []*desc.MessageDescriptor) {
+		for _, md := range mds {
+			exts = append(exts, md.GetNestedExtensions()...)
+			addNested(md.GetNestedMessageTypes())
+		}
+	}
+	addNested(fd.GetMessageTypes())
+	sort.Slice(exts, func(i, j int) bool {
+		return exts[i].GetFullyQualifiedName() < exts[j].GetFullyQualifiedName()
+	})
+	return exts
+}
+
+// defaultJSONName returns the JSON name that protoc computes for a field with
+// the given name.
+func defaultJSONName(name string) string {
+	var sb strings.Builder
+	upper := false
+	for _, r := range name {
+		if r == '_' {
+			upper = true
+			continue
+		}
+		if upper && r >= 'a' && r <= 'z' {
+			r = unicode.ToUpper(r)
+		}
+		upper = false
+		sb.WriteRune(r)
+	}
+	return sb.String()
+}
+
+// camelCase converts a dot-separated, snake-case or camel-case name into a
+// camel-case Go identifier.
+func camelCase(name string, exported bool) string {
+	var sb strings.Builder
+	upper := exported
+	for _, r := range name {
+		if !unicode.IsLetter(r) && !unicode.IsDigit(r) {
+			upper = sb.Len() > 0 || exported
+			continue
+		}
+		if sb.Len() == 0 && unicode.IsDigit(r) {
+			sb.WriteRune('x')
+			if exported {
+				sb.Reset()
+				sb.WriteRune('X')
+			}
+		}
+		if upper {
+			r = unicode.ToUpper(r)
+			upper = false
+		}
+		sb.WriteRune(r)
+	}
+	s := sb.String()
+	if !exported {
+		s = unexport(s)
+	}
+	return s
+}
+
+// unexport lower-cases the leading capital letters of the given name. If there
+// are multiple, such as in an acronym, the last one is left as is when it
+// starts the next word: "HTTPServer" becomes "httpServer".
+func unexport(s string) string {
+	runes := []rune(s)
+	for i, r := range runes {
+		if !unicode.IsUpper(r) {
+			break
+		}
+		if i > 0 && i+1 < len(runes) && unicode.IsLower(runes[i+1]) {
+			break
+		}
+		runes[i] = unicode.ToLower(r)
+	}
+	return string(runes)
+}
+
+func goPackageName(importPath string) string {
+	name := path.Base(importPath)
+	return strings.Map(func(r rune) rune {
+		if unicode.IsLetter(r) || unicode.IsDigit(r) {
+			return r
+		}
+		return '_'
+	}, name)
+}
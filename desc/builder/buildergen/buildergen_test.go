@@ -0,0 +1,214 @@
+package buildergen
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strings"
+	"testing"
+
+	"github.com/jhump/gopoet"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protoregistry"
+	"google.golang.org/protobuf/types/descriptorpb"
+
+	"github.com/jhump/protoreflect/desc"
+	"github.com/jhump/protoreflect/desc/builder"
+	"github.com/jhump/protoreflect/desc/builder/buildergen/internal/testgen"
+	"github.com/jhump/protoreflect/internal/testprotos"
+	"github.com/jhump/protoreflect/internal/testutil"
+)
+
+func testFileNames() []string {
+	var names []string
+	for name := range testgen.Files {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+func TestGenerateFile(t *testing.T) {
+	g := Generator{PackagePath: "github.com/jhump/protoreflect/desc/builder/buildergen/internal/testgen"}
+	for _, name := range testFileNames() {
+		t.Run(name, func(t *testing.T) {
+			fd, err := desc.LoadFileDescriptor(name)
+			testutil.Ok(t, err)
+			f, err := g.GenerateFile(fd)
+			testutil.Ok(t, err)
+			var buf bytes.Buffer
+			testutil.Ok(t, gopoet.WriteGoFile(&buf, f))
+
+			// the generated code in the testgen package must be up to date
+			expected, err := os.ReadFile(filepath.Join("internal/testgen", f.Name))
+			testutil.Ok(t, err)
+			testutil.Eq(t, string(expected), buf.String(), "generated code for %s is stale; run go generate in internal/testgen", name)
+		})
+	}
+}
+
+func TestGeneratedCode(t *testing.T) {
+	for _, name := range testFileNames() {
+		t.Run(name, func(t *testing.T) {
+			fd, err := desc.LoadFileDescriptor(name)
+			testutil.Ok(t, err)
+			fb, err := testgen.Files[name]()
+			testutil.Ok(t, err)
+			rebuilt, err := fb.Build()
+			testutil.Ok(t, err)
+
+			// the generated code should produce the same result as building
+			// a builder that was created from the original descriptor
+			fb, err = builder.FromFile(fd)
+			testutil.Ok(t, err)
+			expected, err := fb.Build()
+			testutil.Ok(t, err)
+			expectedProto := normalize(t, expected.AsFileDescriptorProto())
+			actualProto := normalize(t, rebuilt.AsFileDescriptorProto())
+			testutil.Require(t, proto.Equal(expectedProto, actualProto), "rebuilt file differs from original:\n%v\n%v", expectedProto, actualProto)
+			expectedComments, actualComments := collectComments(fd), collectComments(rebuilt)
+			testutil.Require(t, name != "desc_test_comments.proto" || len(expectedComments) > 0)
+			testutil.Require(t, reflect.DeepEqual(expectedComments, actualComments), "comments differ:\n%v\n%v", expectedComments, actualComments)
+		})
+	}
+}
+
+// normalize returns a copy of fdp in which custom options are always
+// recognized extensions, instead of unknown fields, so that options set from
+// raw bytes can be compared to options set from values. Fields that have no
+// label, which is how the generated code leaves optional fields, are also
+// given an explicit optional label. Finally, since builders always put the
+// messages of group and map fields first, nested messages are sorted by name,
+// which also means that source code info must be left out.
+func normalize(t *testing.T, fdp *descriptorpb.FileDescriptorProto) *descriptorpb.FileDescriptorProto {
+	data, err := proto.MarshalOptions{Deterministic: true}.Marshal(fdp)
+	testutil.Ok(t, err)
+	var result descriptorpb.FileDescriptorProto
+	testutil.Ok(t, proto.UnmarshalOptions{Resolver: protoregistry.GlobalTypes}.Unmarshal(data, &result))
+	result.SourceCodeInfo = nil
+	normalizeLabels(result.Extension)
+	for _, md := range result.MessageType {
+		normalizeMessage(md)
+	}
+	return &result
+}
+
+func normalizeMessage(md *descriptorpb.DescriptorProto) {
+	normalizeLabels(md.Field)
+	normalizeLabels(md.Extension)
+	sort.SliceStable(md.NestedType, func(i, j int) bool {
+		return md.NestedType[i].GetName() < md.NestedType[j].GetName()
+	})
+	for _, nmd := range md.NestedType {
+		normalizeMessage(nmd)
+	}
+}
+
+func normalizeLabels(fields []*descriptorpb.FieldDescriptorProto) {
+	for _, fld := range fields {
+		if fld.Label == nil {
+			fld.Label = descriptorpb.FieldDescriptorProto_LABEL_OPTIONAL.Enum()
+		}
+	}
+}
+
+func collectComments(fd *desc.FileDescriptor) map[string][]string {
+	comments := map[string][]string{}
+	var collect func(d desc.Descriptor)
+	collect = func(d desc.Descriptor) {
+		info := d.GetSourceInfo()
+		if info.GetLeadingComments() != "" || info.GetTrailingComments() != "" || len(info.GetLeadingDetachedComments()) > 0 {
+			comments[d.GetFullyQualifiedName()] = append([]string{info.GetLeadingComments(), info.GetTrailingComments()}, info.GetLeadingDetachedComments()...)
+		}
+		switch d := d.(type) {
+		case *desc.MessageDescriptor:
+			for _, fld := range d.GetFields() {
+				collect(fld)
+			}
+			for _, ood := range d.GetOneOfs() {
+				collect(ood)
+			}
+			for _, nmd := range d.GetNestedMessageTypes() {
+				collect(nmd)
+			}
+			for _, ed := range d.GetNestedEnumTypes() {
+				collect(ed)
+			}
+			for _, exd := range d.GetNestedExtensions() {
+				collect(exd)
+			}
+		case *desc.EnumDescriptor:
+			for _, evd := range d.GetValues() {
+				collect(evd)
+			}
+		case *desc.ServiceDescriptor:
+			for _, mtd := range d.GetMethods() {
+				collect(mtd)
+			}
+		}
+	}
+	for _, md := range fd.GetMessageTypes() {
+		collect(md)
+	}
+	for _, ed := range fd.GetEnumTypes() {
+		collect(ed)
+	}
+	for _, exd := range fd.GetExtensions() {
+		collect(exd)
+	}
+	for _, sd := range fd.GetServices() {
+		collect(sd)
+	}
+	return comments
+}
+
+func TestGenerateFileBuilder(t *testing.T) {
+	md, err := desc.LoadMessageDescriptorForMessage((*testprotos.TestMessage)(nil))
+	testutil.Ok(t, err)
+	en := builder.NewEnum("HTTPStatus").
+		AddValue(builder.NewEnumValue("OK").SetNumber(0))
+	msg := builder.NewMessage("Request").
+		AddField(builder.NewField("status", builder.FieldTypeEnum(en)).SetNumber(1)).
+		AddField(builder.NewField("msg", builder.FieldTypeImportedMessage(md)).SetNumber(2)).
+		AddField(builder.NewField("ratio", builder.FieldTypeFloat()).SetNumber(3).
+			SetOptions(&descriptorpb.FieldOptions{Ctype: descriptorpb.FieldOptions_CORD.Enum()}))
+	fb := builder.NewFile("foo/my-service.proto").
+		SetPackageName("foo").
+		SetProto3(true).
+		AddMessage(msg).
+		AddEnum(en)
+
+	g := Generator{PackagePath: "example.com/my-pkg", FuncName: "MyService"}
+	f, err := g.GenerateFileBuilder(fb)
+	testutil.Ok(t, err)
+	testutil.Eq(t, "my_pkg", f.PackageName)
+	testutil.Eq(t, "my-service.pb.builder.go", f.Name)
+	var buf bytes.Buffer
+	testutil.Ok(t, gopoet.WriteGoFile(&buf, f))
+	code := buf.String()
+	for _, snippet := range []string{
+		"func MyService() (*builder.FileBuilder, error) {",
+		`descTest1File, err := desc.LoadFileDescriptor("desc_test1.proto")`,
+		`httpStatusEnum := builder.NewEnum("HTTPStatus")`,
+		`builder.FieldTypeImportedMessage(descTest1File.FindMessage("testprotos.TestMessage"))`,
+		"Ctype: descriptorpb.FieldOptions_CORD.Enum(),",
+		`fb := builder.NewFile("foo/my-service.proto").`,
+	} {
+		testutil.Require(t, strings.Contains(code, snippet), "generated code is missing %q:\n%s", snippet, code)
+	}
+
+	g = Generator{}
+	_, err = g.GenerateFileBuilder(fb)
+	testutil.Require(t, err != nil && strings.Contains(err.Error(), "package path"))
+}
+
+func TestNames(t *testing.T) {
+	testutil.Eq(t, "DescTest1", camelCase("desc_test1", true))
+	testutil.Eq(t, "fooBarBaz", camelCase("Foo.bar_baz", false))
+	testutil.Eq(t, "httpRequest", camelCase("HTTPRequest", false))
+	testutil.Eq(t, "x2fa", camelCase("2fa", false))
+	testutil.Eq(t, "fooBar", defaultJSONName("foo_bar"))
+	testutil.Eq(t, "Extra", defaultJSONName("_extra"))
+}
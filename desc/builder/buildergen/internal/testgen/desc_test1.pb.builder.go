@@ -0,0 +1,258 @@
+// Code generated by buildergen. DO NOT EDIT.
+// source: desc_test1.proto
+
+package testgen
+
+import "github.com/jhump/protoreflect/desc/builder"
+import "google.golang.org/protobuf/proto"
+import descriptorpb "google.golang.org/protobuf/types/descriptorpb"
+
+// DescTest1Proto returns a builder that reconstructs "desc_test1.proto".
+func DescTest1Proto() (*builder.FileBuilder, error) {
+	testMessageMsg := builder.NewMessage("TestMessage")
+	testMessageNestedMessageMsg := builder.NewMessage("NestedMessage")
+	testMessageNestedMessageAnotherNestedMessageMsg := builder.NewMessage("AnotherNestedMessage")
+	testMessageNestedMessageAnotherNestedMessageYetAnotherNestedMessageMsg := builder.NewMessage("YetAnotherNestedMessage")
+	testMessageNestedMessageAnotherNestedMessageYetAnotherNestedMessageDeeplyNestedEnum := builder.NewEnum("DeeplyNestedEnum")
+	testMessageNestedEnum := builder.NewEnum("NestedEnum")
+	anotherTestMessageMsg := builder.NewMessage("AnotherTestMessage")
+	anotherTestMessageRockNRollMsg := builder.NewMessage("RockNRoll")
+	anotherTestMessageWithOptionsMsg := builder.NewMessage("WithOptions")
+
+	testMessageMsg.
+		SetComments(builder.Comments{
+			LeadingComment: " Comment for TestMessage\n",
+		}).
+		AddField(builder.NewField("nm", builder.FieldTypeMessage(testMessageNestedMessageMsg)).
+			SetNumber(1).
+			SetComments(builder.Comments{
+				LeadingComment: " Comment for nm\n",
+			})).
+		AddField(builder.NewField("anm", builder.FieldTypeMessage(testMessageNestedMessageAnotherNestedMessageMsg)).
+			SetNumber(2).
+			SetComments(builder.Comments{
+				LeadingComment: " Comment for anm\n",
+			})).
+		AddField(builder.NewField("yanm", builder.FieldTypeMessage(testMessageNestedMessageAnotherNestedMessageYetAnotherNestedMessageMsg)).
+			SetNumber(3).
+			SetComments(builder.Comments{
+				LeadingComment: " Comment for yanm\n",
+			})).
+		AddField(builder.NewField("ne", builder.FieldTypeEnum(testMessageNestedEnum)).
+			SetNumber(4).
+			SetRepeated().
+			SetComments(builder.Comments{
+				LeadingComment: " Comment for ne\n",
+			})).
+		AddNestedMessage(testMessageNestedMessageMsg).
+		AddNestedEnum(testMessageNestedEnum)
+
+	testMessageNestedMessageMsg.
+		SetComments(builder.Comments{
+			LeadingComment: " Comment for NestedMessage\n",
+		}).
+		AddField(builder.NewField("anm", builder.FieldTypeMessage(testMessageNestedMessageAnotherNestedMessageMsg)).
+			SetNumber(1).
+			SetComments(builder.Comments{
+				LeadingComment: " Comment for anm\n",
+			})).
+		AddField(builder.NewField("yanm", builder.FieldTypeMessage(testMessageNestedMessageAnotherNestedMessageYetAnotherNestedMessageMsg)).
+			SetNumber(2).
+			SetComments(builder.Comments{
+				LeadingComment: " Comment for yanm\n",
+			})).
+		AddNestedMessage(testMessageNestedMessageAnotherNestedMessageMsg)
+
+	testMessageNestedMessageAnotherNestedMessageMsg.
+		SetComments(builder.Comments{
+			LeadingComment: " Comment for AnotherNestedMessage\n",
+		}).
+		AddField(builder.NewField("yanm", builder.FieldTypeMessage(testMessageNestedMessageAnotherNestedMessageYetAnotherNestedMessageMsg)).
+			SetNumber(1).
+			SetRepeated().
+			SetComments(builder.Comments{
+				LeadingComment: " Comment for yanm\n",
+			})).
+		AddNestedMessage(testMessageNestedMessageAnotherNestedMessageYetAnotherNestedMessageMsg).
+		AddNestedExtension(builder.NewExtension("flags", 200, builder.FieldTypeBool(), anotherTestMessageMsg).
+			SetRepeated().
+			SetComments(builder.Comments{
+				LeadingComment: " Comment for flags\n",
+			}).
+			SetOptions(&descriptorpb.FieldOptions{
+				Packed: proto.Bool(true),
+			}))
+
+	testMessageNestedMessageAnotherNestedMessageYetAnotherNestedMessageMsg.
+		SetComments(builder.Comments{
+			LeadingComment: " Comment for YetAnotherNestedMessage\n",
+		}).
+		AddField(builder.NewField("foo", builder.FieldTypeString()).
+			SetNumber(1).
+			SetComments(builder.Comments{
+				LeadingComment: " Comment for foo\n",
+			})).
+		AddField(builder.NewField("bar", builder.FieldTypeInt32()).
+			SetNumber(2).
+			SetComments(builder.Comments{
+				LeadingComment: " Comment for bar\n",
+			})).
+		AddField(builder.NewField("baz", builder.FieldTypeBytes()).
+			SetNumber(3).
+			SetComments(builder.Comments{
+				LeadingComment: " Comment for baz\n",
+			})).
+		AddField(builder.NewField("dne", builder.FieldTypeEnum(testMessageNestedMessageAnotherNestedMessageYetAnotherNestedMessageDeeplyNestedEnum)).
+			SetNumber(4).
+			SetComments(builder.Comments{
+				LeadingComment: " Comment for dne\n",
+			})).
+		AddField(builder.NewField("anm", builder.FieldTypeMessage(testMessageNestedMessageAnotherNestedMessageMsg)).
+			SetNumber(5).
+			SetComments(builder.Comments{
+				LeadingComment: " Comment for anm\n",
+			})).
+		AddField(builder.NewField("nm", builder.FieldTypeMessage(testMessageNestedMessageMsg)).
+			SetNumber(6).
+			SetComments(builder.Comments{
+				LeadingComment: " Comment for nm\n",
+			})).
+		AddField(builder.NewField("tm", builder.FieldTypeMessage(testMessageMsg)).
+			SetNumber(7).
+			SetComments(builder.Comments{
+				LeadingComment: " Comment for tm\n",
+			})).
+		AddNestedEnum(testMessageNestedMessageAnotherNestedMessageYetAnotherNestedMessageDeeplyNestedEnum)
+
+	testMessageNestedMessageAnotherNestedMessageYetAnotherNestedMessageDeeplyNestedEnum.
+		SetComments(builder.Comments{
+			LeadingComment: " Comment for DeeplyNestedEnum\n",
+		}).
+		AddValue(builder.NewEnumValue("VALUE1").
+			SetNumber(1).
+			SetComments(builder.Comments{
+				LeadingComment: " Comment for VALUE1\n",
+			})).
+		AddValue(builder.NewEnumValue("VALUE2").
+			SetNumber(2).
+			SetComments(builder.Comments{
+				LeadingComment: " Comment for VALUE2\n",
+			}))
+
+	testMessageNestedEnum.
+		SetComments(builder.Comments{
+			LeadingComment: " Comment for NestedEnum\n",
+		}).
+		AddValue(builder.NewEnumValue("VALUE1").
+			SetNumber(1).
+			SetComments(builder.Comments{
+				LeadingComment: " Comment for VALUE1\n",
+			})).
+		AddValue(builder.NewEnumValue("VALUE2").
+			SetNumber(2).
+			SetComments(builder.Comments{
+				LeadingComment: " Comment for VALUE2\n",
+			}))
+
+	anotherTestMessageMsg.
+		SetComments(builder.Comments{
+			LeadingComment: " Comment for AnotherTestMessage\n",
+		}).
+		AddField(builder.NewField("dne", builder.FieldTypeEnum(testMessageNestedMessageAnotherNestedMessageYetAnotherNestedMessageDeeplyNestedEnum)).
+			SetNumber(1).
+			SetComments(builder.Comments{
+				LeadingComment: " Comment for dne\n",
+			})).
+		AddField(builder.NewMapField("map_field1", builder.FieldTypeInt32(), builder.FieldTypeString()).
+			SetNumber(2).
+			SetComments(builder.Comments{
+				LeadingComment: " Comment for map_field1\n",
+			})).
+		AddField(builder.NewMapField("map_field2", builder.FieldTypeInt64(), builder.FieldTypeFloat()).
+			SetNumber(3).
+			SetComments(builder.Comments{
+				LeadingComment: " Comment for map_field2\n",
+			})).
+		AddField(builder.NewMapField("map_field3", builder.FieldTypeUInt32(), builder.FieldTypeBool()).
+			SetNumber(4).
+			SetComments(builder.Comments{
+				LeadingComment: " Comment for map_field3\n",
+			})).
+		AddField(builder.NewMapField("map_field4", builder.FieldTypeString(), builder.FieldTypeMessage(anotherTestMessageMsg)).
+			SetNumber(5).
+			SetComments(builder.Comments{
+				LeadingComment: " Comment for map_field4\n",
+			})).
+		AddField(builder.NewGroupField(anotherTestMessageRockNRollMsg).
+			SetNumber(6)).
+		AddOneOf(builder.NewOneOf("atmoo").
+			SetComments(builder.Comments{
+				LeadingComment: " Comment for atmoo\n",
+			}).
+			AddChoice(builder.NewField("str", builder.FieldTypeString()).
+				SetNumber(7).
+				SetComments(builder.Comments{
+					LeadingComment: " Comment for str\n",
+				})).
+			AddChoice(builder.NewField("int", builder.FieldTypeInt64()).
+				SetNumber(8).
+				SetComments(builder.Comments{
+					LeadingComment: " Comment for int\n",
+				}))).
+		AddField(builder.NewGroupField(anotherTestMessageWithOptionsMsg).
+			SetNumber(9).
+			SetOptions(&descriptorpb.FieldOptions{
+				Deprecated: proto.Bool(true),
+			})).
+		AddExtensionRange(100, 200)
+
+	anotherTestMessageRockNRollMsg.
+		SetComments(builder.Comments{
+			LeadingComment: " Comment for RockNRoll\n",
+		}).
+		AddField(builder.NewField("beatles", builder.FieldTypeString()).
+			SetNumber(1).
+			SetComments(builder.Comments{
+				LeadingComment: " Comment for beatles\n",
+			})).
+		AddField(builder.NewField("stones", builder.FieldTypeString()).
+			SetNumber(2).
+			SetComments(builder.Comments{
+				LeadingComment: " Comment for stones\n",
+			})).
+		AddField(builder.NewField("doors", builder.FieldTypeString()).
+			SetNumber(3).
+			SetComments(builder.Comments{
+				LeadingComment: " Comment for doors\n",
+			}))
+
+	anotherTestMessageWithOptionsMsg.
+		SetComments(builder.Comments{
+			LeadingComment: " Comment for WithOptions\n",
+		})
+
+	fb := builder.NewFile("desc_test1.proto").
+		SetPackageName("testprotos").
+		SetOptions(&descriptorpb.FileOptions{
+			GoPackage: proto.String("github.com/jhump/protoreflect/internal/testprotos"),
+		}).
+		AddMessage(testMessageMsg).
+		AddMessage(anotherTestMessageMsg).
+		AddExtension(builder.NewExtension("xtm", 100, builder.FieldTypeMessage(testMessageMsg), anotherTestMessageMsg).
+			SetComments(builder.Comments{
+				LeadingComment: " Comment for xtm\n",
+			})).
+		AddExtension(builder.NewExtension("xs", 101, builder.FieldTypeString(), anotherTestMessageMsg).
+			SetComments(builder.Comments{
+				LeadingComment: " Comment for xs\n",
+			})).
+		AddExtension(builder.NewExtension("xi", 102, builder.FieldTypeInt32(), anotherTestMessageMsg).
+			SetComments(builder.Comments{
+				LeadingComment: " Comment for xi\n",
+			})).
+		AddExtension(builder.NewExtension("xui", 103, builder.FieldTypeUInt64(), anotherTestMessageMsg).
+			SetComments(builder.Comments{
+				LeadingComment: " Comment for xui\n",
+			}))
+	return fb, nil
+}
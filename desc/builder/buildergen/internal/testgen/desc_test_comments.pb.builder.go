@@ -0,0 +1,220 @@
+// Code generated by buildergen. DO NOT EDIT.
+// source: desc_test_comments.proto
+
+package testgen
+
+import "github.com/jhump/protoreflect/desc"
+import "github.com/jhump/protoreflect/desc/builder"
+import "google.golang.org/protobuf/proto"
+import descriptorpb "google.golang.org/protobuf/types/descriptorpb"
+
+// DescTestCommentsProto returns a builder that reconstructs "desc_test_comments.proto".
+func DescTestCommentsProto() (*builder.FileBuilder, error) {
+	emptyFile, err := desc.LoadFileDescriptor("google/protobuf/empty.proto")
+	if err != nil {
+		return nil, err
+	}
+	descTestOptionsFile, err := desc.LoadFileDescriptor("desc_test_options.proto")
+	if err != nil {
+		return nil, err
+	}
+	requestMsg := builder.NewMessage("Request")
+	requestExtrasMsg := builder.NewMessage("Extras")
+	requestMarioCharactersEnum := builder.NewEnum("MarioCharacters")
+	anEmptyMessageMsg := builder.NewMessage("AnEmptyMessage")
+
+	requestMsg.
+		SetComments(builder.Comments{
+			LeadingDetachedComments: []string{
+				" Multiple white space lines (like above) cannot\n be preserved...\n",
+			},
+			LeadingComment: " We need a request for our RPC service below.\n",
+		}).
+		SetOptions(&descriptorpb.MessageOptions{
+			Deprecated: proto.Bool(true),
+		}).
+		SetOption(descTestOptionsFile.FindExtensionByName("testprotos.mfubar"), true).
+		AddField(builder.NewField("ids", builder.FieldTypeInt32()).
+			SetNumber(1).
+			SetRepeated().
+			SetJsonName("|foo|").
+			SetComments(builder.Comments{
+				LeadingComment:  " A field comment\n",
+				TrailingComment: " field trailer #1...\n",
+			}).
+			SetOptions(&descriptorpb.FieldOptions{
+				Packed: proto.Bool(true),
+			}).
+			SetOption(descTestOptionsFile.FindExtensionByName("testprotos.ffubar"), []string{"abc"}).
+			SetOption(descTestOptionsFile.FindExtensionByName("testprotos.ffubarb"), []byte("xyz"))).
+		AddField(builder.NewField("name", builder.FieldTypeString()).
+			SetNumber(2).
+			SetDefaultValue("fubar").
+			SetComments(builder.Comments{
+				LeadingDetachedComments: []string{
+					" some detached comments\n",
+					" some detached comments with unicode 这个是值\n",
+					" Another field comment\n",
+				},
+				LeadingComment: " label comment ",
+			})).
+		AddField(builder.NewGroupField(requestExtrasMsg).
+			SetNumber(3)).
+		AddOneOf(builder.NewOneOf("abc").
+			SetComments(builder.Comments{
+				LeadingComment:  " can be this or that\n",
+				TrailingComment: " trailer for oneof abc\n",
+			}).
+			AddChoice(builder.NewField("this", builder.FieldTypeString()).
+				SetNumber(4)).
+			AddChoice(builder.NewField("that", builder.FieldTypeInt32()).
+				SetNumber(5))).
+		AddOneOf(builder.NewOneOf("xyz").
+			SetComments(builder.Comments{
+				LeadingComment: " can be these or those\n",
+			}).
+			SetOption(descTestOptionsFile.FindExtensionByName("testprotos.oofubar"), []string{"whoops, this has invalid UTF8! \xbc\xff"}).
+			AddChoice(builder.NewField("these", builder.FieldTypeString()).
+				SetNumber(6)).
+			AddChoice(builder.NewField("those", builder.FieldTypeInt32()).
+				SetNumber(7))).
+		AddField(builder.NewMapField("things", builder.FieldTypeString(), builder.FieldTypeString()).
+			SetNumber(8).
+			SetComments(builder.Comments{
+				LeadingComment: " map field\n",
+			})).
+		AddNestedEnum(requestMarioCharactersEnum).
+		AddExtensionRange(100, 200).
+		AddExtensionRangeWithOptions(201, 250, func() *descriptorpb.ExtensionRangeOptions {
+			opts := &descriptorpb.ExtensionRangeOptions{}
+			// custom options, in binary form
+			opts.ProtoReflect().SetUnknown([]byte{
+				0xaa, 0xf7, 0x04, 0x06, 0x73, 0x70, 0x6c, 0x61, 0x74, 0x21, 0xb2, 0xf7, 0x04, 0x08, 0x00, 0x01,
+				0x02, 0x03, 0x04, 0x05, 0x06, 0x07,
+			})
+			return opts
+		}()).
+		AddReservedRange(10, 20).
+		AddReservedRange(30, 50).
+		AddReservedName("foo").
+		AddReservedName("bar").
+		AddReservedName("baz")
+
+	requestExtrasMsg.
+		SetComments(builder.Comments{
+			LeadingComment:  " Group comment with emoji 😀 😍 👻 ❤ 💯 💥 🐶 🦂 🥑 🍻 🌍 🚕 🪐\n",
+			TrailingComment: " trailer for Extras\n",
+		}).
+		SetOptions(&descriptorpb.MessageOptions{
+			NoStandardDescriptorAccessor: proto.Bool(false),
+		}).
+		SetOption(descTestOptionsFile.FindExtensionByName("testprotos.mfubar"), false).
+		AddField(builder.NewField("dbl", builder.FieldTypeDouble()).
+			SetNumber(1)).
+		AddField(builder.NewField("flt", builder.FieldTypeFloat()).
+			SetNumber(2)).
+		AddField(builder.NewField("str", builder.FieldTypeString()).
+			SetNumber(3).
+			SetComments(builder.Comments{
+				LeadingComment:  " Leading comment...\n",
+				TrailingComment: " Trailing comment...\n",
+			}))
+
+	requestMarioCharactersEnum.
+		SetComments(builder.Comments{
+			TrailingComment: " trailer for enum\n",
+		}).
+		SetOptions(&descriptorpb.EnumOptions{
+			AllowAlias: proto.Bool(true),
+		}).
+		SetOption(descTestOptionsFile.FindExtensionByName("testprotos.efubar"), int32(123)).
+		SetOption(descTestOptionsFile.FindExtensionByName("testprotos.efubars"), int32(-321)).
+		AddValue(builder.NewEnumValue("MARIO").
+			SetNumber(1).
+			SetOption(descTestOptionsFile.FindExtensionByName("testprotos.evfubar"), int64(278)).
+			SetOption(descTestOptionsFile.FindExtensionByName("testprotos.evfubars"), int64(-314))).
+		AddValue(builder.NewEnumValue("LUIGI").
+			SetNumber(2).
+			SetOption(descTestOptionsFile.FindExtensionByName("testprotos.evfubaru"), uint64(200)).
+			SetOption(descTestOptionsFile.FindExtensionByName("testprotos.evfubaruf"), uint64(100))).
+		AddValue(builder.NewEnumValue("PEACH").
+			SetNumber(3)).
+		AddValue(builder.NewEnumValue("BOWSER").
+			SetNumber(4)).
+		AddValue(builder.NewEnumValue("WARIO").
+			SetNumber(5)).
+		AddValue(builder.NewEnumValue("WALUIGI").
+			SetNumber(6)).
+		AddValue(builder.NewEnumValue("SHY_GUY").
+			SetNumber(7).
+			SetOption(descTestOptionsFile.FindExtensionByName("testprotos.evfubarsf"), int64(10101))).
+		AddValue(builder.NewEnumValue("HEY_HO").
+			SetNumber(7)).
+		AddValue(builder.NewEnumValue("MAGIKOOPA").
+			SetNumber(8)).
+		AddValue(builder.NewEnumValue("KAMEK").
+			SetNumber(8)).
+		AddValue(builder.NewEnumValue("SNIFIT").
+			SetNumber(-101))
+
+	fb := builder.NewFile("desc_test_comments.proto").
+		SetPackageName("foo.bar").
+		SetSyntaxComments(builder.Comments{
+			LeadingDetachedComments: []string{
+				" This is the first detached comment for the syntax.\n",
+				"\n This is a second detached comment.\n",
+				" This is a third.\n",
+			},
+			LeadingComment:  " Syntax comment...\n",
+			TrailingComment: " Syntax trailer.\n",
+		}).
+		SetPackageComments(builder.Comments{
+			LeadingComment: " And now the package declaration\n",
+		}).
+		SetOptions(&descriptorpb.FileOptions{
+			GoPackage: proto.String("github.com/jhump/protoreflect/internal/testprotos"),
+		}).
+		AddImportedDependency(emptyFile).
+		AddImportedDependency(descTestOptionsFile).
+		AddMessage(requestMsg).
+		AddMessage(anEmptyMessageMsg).
+		AddExtension(builder.NewExtension("guid1", 123, builder.FieldTypeUInt64(), requestMsg).
+			SetComments(builder.Comments{
+				LeadingComment: " comment for guid1\n",
+			})).
+		AddExtension(builder.NewExtension("guid2", 124, builder.FieldTypeUInt64(), requestMsg).
+			SetComments(builder.Comments{
+				LeadingComment: " ... and a comment for guid2\n",
+			})).
+		AddService(builder.NewService("RpcService").
+			SetComments(builder.Comments{
+				LeadingComment:  " Service comment\n",
+				TrailingComment: " service trailer\n that spans multiple lines\n",
+			}).
+			SetOptions(func() *descriptorpb.ServiceOptions {
+				opts := &descriptorpb.ServiceOptions{
+					Deprecated: proto.Bool(false),
+				}
+				// custom options, in binary form
+				opts.ProtoReflect().SetUnknown([]byte{
+					0xaa, 0xf7, 0x04, 0x07, 0x08, 0x64, 0x12, 0x03, 0x62, 0x6f, 0x62,
+				})
+				return opts
+			}()).
+			SetOption(descTestOptionsFile.FindExtensionByName("testprotos.sfubare"), int32(1)).
+			AddMethod(builder.NewMethod("StreamingRpc", builder.RpcTypeMessage(requestMsg, true), builder.RpcTypeMessage(requestMsg, false)).
+				SetComments(builder.Comments{
+					LeadingComment:  " Method comment\n",
+					TrailingComment: " compact method trailer\n",
+				})).
+			AddMethod(builder.NewMethod("UnaryRpc", builder.RpcTypeMessage(requestMsg, false), builder.RpcTypeImportedMessage(emptyFile.FindMessage("google.protobuf.Empty"), false)).
+				SetComments(builder.Comments{
+					TrailingComment: " trailer for method\n",
+				}).
+				SetOptions(&descriptorpb.MethodOptions{
+					Deprecated: proto.Bool(true),
+				}).
+				SetOption(descTestOptionsFile.FindExtensionByName("testprotos.mtfubar"), []float32{12.34}).
+				SetOption(descTestOptionsFile.FindExtensionByName("testprotos.mtfubard"), float64(123.456))))
+	return fb, nil
+}
@@ -0,0 +1,497 @@
+// Code generated by buildergen. DO NOT EDIT.
+// source: desc_test_complex.proto
+
+package testgen
+
+import "github.com/jhump/protoreflect/desc"
+import "github.com/jhump/protoreflect/desc/builder"
+import "google.golang.org/protobuf/proto"
+import descriptorpb "google.golang.org/protobuf/types/descriptorpb"
+
+// DescTestComplexProto returns a builder that reconstructs "desc_test_complex.proto".
+func DescTestComplexProto() (*builder.FileBuilder, error) {
+	descriptorFile, err := desc.LoadFileDescriptor("google/protobuf/descriptor.proto")
+	if err != nil {
+		return nil, err
+	}
+	simpleMsg := builder.NewMessage("Simple")
+	testMsg := builder.NewMessage("Test")
+	testNestedMsg := builder.NewMessage("Nested")
+	testNestedNestedNestedMsg := builder.NewMessage("_NestedNested")
+	testNestedNestedNestedNestedNestedNestedMsg := builder.NewMessage("NestedNestedNested")
+	testNestedNestedNestedEEEEnum := builder.NewEnum("EEE")
+	messageWithReservationsMsg := builder.NewMessage("MessageWithReservations")
+	messageWithMapMsg := builder.NewMessage("MessageWithMap")
+	anotherMsg := builder.NewMessage("Another")
+	validatorMsg := builder.NewMessage("Validator")
+	validatorPermissionMsg := builder.NewMessage("Permission")
+	validatorActionEnum := builder.NewEnum("Action")
+	ruleMsg := builder.NewMessage("Rule")
+	ruleStringRuleMsg := builder.NewMessage("StringRule")
+	ruleIntRuleMsg := builder.NewMessage("IntRule")
+	ruleRepeatedRuleMsg := builder.NewMessage("RepeatedRule")
+	ruleFloatRuleMsg := builder.NewMessage("FloatRule")
+	isAuthorizedReqMsg := builder.NewMessage("IsAuthorizedReq")
+	keywordCollisionsMsg := builder.NewMessage("KeywordCollisions")
+	keywordCollisionOptionsMsg := builder.NewMessage("KeywordCollisionOptions")
+	enumWithReservationsEnum := builder.NewEnum("EnumWithReservations")
+
+	simpleMsg.
+		AddField(builder.NewField("name", builder.FieldTypeString()).
+			SetNumber(1)).
+		AddField(builder.NewField("id", builder.FieldTypeUInt64()).
+			SetNumber(2)).
+		AddField(builder.NewField("_extra", builder.FieldTypeBytes()).
+			SetNumber(3).
+			SetComments(builder.Comments{
+				TrailingComment: " default JSON name will be capitalized\n",
+			})).
+		AddField(builder.NewField("_", builder.FieldTypeBool()).
+			SetNumber(4).
+			SetRepeated().
+			SetComments(builder.Comments{
+				TrailingComment: " default JSON name will be empty(!)\n",
+			}))
+
+	testMsg.
+		AddField(builder.NewField("foo", builder.FieldTypeString()).
+			SetNumber(1).
+			SetJsonName("|foo|")).
+		AddField(builder.NewField("array", builder.FieldTypeInt32()).
+			SetNumber(2).
+			SetRepeated()).
+		AddField(builder.NewField("s", builder.FieldTypeMessage(simpleMsg)).
+			SetNumber(3)).
+		AddField(builder.NewField("r", builder.FieldTypeMessage(simpleMsg)).
+			SetNumber(4).
+			SetRepeated()).
+		AddField(builder.NewMapField("m", builder.FieldTypeString(), builder.FieldTypeInt32()).
+			SetNumber(5)).
+		AddField(builder.NewField("b", builder.FieldTypeBytes()).
+			SetNumber(6).
+			SetDefaultValue("\\000\\001\\002\\003\\004\\005\\006\\007fubar!")).
+		AddNestedMessage(testNestedMsg).
+		AddExtensionRange(100, 200).
+		AddExtensionRangeWithOptions(249, 249, func() *descriptorpb.ExtensionRangeOptions {
+			opts := &descriptorpb.ExtensionRangeOptions{}
+			// custom options, in binary form
+			opts.ProtoReflect().SetUnknown([]byte{
+				0x82, 0xe2, 0x09, 0x04, 0x6a, 0x61, 0x7a, 0x7a,
+			})
+			return opts
+		}()).
+		AddExtensionRangeWithOptions(300, 350, func() *descriptorpb.ExtensionRangeOptions {
+			opts := &descriptorpb.ExtensionRangeOptions{}
+			// custom options, in binary form
+			opts.ProtoReflect().SetUnknown([]byte{
+				0x82, 0xe2, 0x09, 0x04, 0x6a, 0x61, 0x7a, 0x7a,
+			})
+			return opts
+		}()).
+		AddExtensionRangeWithOptions(500, 550, func() *descriptorpb.ExtensionRangeOptions {
+			opts := &descriptorpb.ExtensionRangeOptions{}
+			// custom options, in binary form
+			opts.ProtoReflect().SetUnknown([]byte{
+				0x82, 0xe2, 0x09, 0x04, 0x6a, 0x61, 0x7a, 0x7a,
+			})
+			return opts
+		}()).
+		AddExtensionRangeWithOptions(20000, 536870911, func() *descriptorpb.ExtensionRangeOptions {
+			opts := &descriptorpb.ExtensionRangeOptions{}
+			// custom options, in binary form
+			opts.ProtoReflect().SetUnknown([]byte{
+				0x82, 0xe2, 0x09, 0x04, 0x6a, 0x61, 0x7a, 0x7a,
+			})
+			return opts
+		}())
+
+	testNestedMsg.
+		AddNestedMessage(testNestedNestedNestedMsg).
+		AddNestedExtension(builder.NewExtensionImported("fooblez", 20003, builder.FieldTypeInt32(), descriptorFile.FindMessage("google.protobuf.MessageOptions")))
+
+	testNestedNestedNestedMsg.
+		SetOptions(func() *descriptorpb.MessageOptions {
+			opts := &descriptorpb.MessageOptions{}
+			// custom options, in binary form
+			opts.ProtoReflect().SetUnknown([]byte{
+				0x92, 0xe2, 0x09, 0x0b, 0xa2, 0x06, 0x03, 0x62, 0x6f, 0x6f, 0x0a, 0x03, 0x67, 0x6f, 0x6f, 0x98,
+				0xe2, 0x09, 0xf5, 0x4e,
+			})
+			return opts
+		}()).
+		AddNestedMessage(testNestedNestedNestedNestedNestedNestedMsg).
+		AddNestedEnum(testNestedNestedNestedEEEEnum).
+		AddNestedExtension(builder.NewExtension("_garblez", 100, builder.FieldTypeString(), testMsg))
+
+	testNestedNestedNestedNestedNestedNestedMsg.
+		SetOptions(func() *descriptorpb.MessageOptions {
+			opts := &descriptorpb.MessageOptions{}
+			// custom options, in binary form
+			opts.ProtoReflect().SetUnknown([]byte{
+				0x92, 0xe2, 0x09, 0x0c, 0xa2, 0x06, 0x04, 0x73, 0x70, 0x6f, 0x6f, 0x0a, 0x03, 0x68, 0x6f, 0x6f,
+			})
+			return opts
+		}()).
+		AddField(builder.NewField("Test", builder.FieldTypeMessage(testMsg)).
+			SetNumber(1))
+
+	testNestedNestedNestedEEEEnum.
+		AddValue(builder.NewEnumValue("OK").
+			SetNumber(0)).
+		AddValue(builder.NewEnumValue("V1").
+			SetNumber(1)).
+		AddValue(builder.NewEnumValue("V2").
+			SetNumber(2)).
+		AddValue(builder.NewEnumValue("V3").
+			SetNumber(3)).
+		AddValue(builder.NewEnumValue("V4").
+			SetNumber(4)).
+		AddValue(builder.NewEnumValue("V5").
+			SetNumber(5)).
+		AddValue(builder.NewEnumValue("V6").
+			SetNumber(6))
+
+	messageWithReservationsMsg.
+		AddReservedRange(5, 10).
+		AddReservedRange(12, 15).
+		AddReservedRange(18, 18).
+		AddReservedRange(1000, 536870911).
+		AddReservedName("A").
+		AddReservedName("B").
+		AddReservedName("C")
+
+	messageWithMapMsg.
+		AddField(builder.NewMapField("vals", builder.FieldTypeString(), builder.FieldTypeMessage(simpleMsg)).
+			SetNumber(1))
+
+	anotherMsg.
+		SetOptions(func() *descriptorpb.MessageOptions {
+			opts := &descriptorpb.MessageOptions{}
+			// custom options, in binary form
+			opts.ProtoReflect().SetUnknown([]byte{
+				0x92, 0xe2, 0x09, 0x23, 0x0a, 0x03, 0x61, 0x62, 0x63, 0x10, 0x01, 0x10, 0x02, 0x10, 0x03, 0x1a,
+				0x07, 0x0a, 0x03, 0x66, 0x6f, 0x6f, 0x10, 0x7b, 0x22, 0x03, 0x0a, 0x01, 0x66, 0x22, 0x03, 0x0a,
+				0x01, 0x73, 0x22, 0x03, 0x10, 0xc8, 0x03, 0x92, 0xe2, 0x09, 0x1f, 0x0a, 0x03, 0x64, 0x65, 0x66,
+				0x10, 0x03, 0x10, 0x02, 0x10, 0x01, 0x1a, 0x08, 0x0a, 0x03, 0x62, 0x61, 0x72, 0x10, 0xc1, 0x02,
+				0x22, 0x03, 0x0a, 0x01, 0x67, 0x22, 0x03, 0x0a, 0x01, 0x73, 0x92, 0xe2, 0x09, 0x05, 0x0a, 0x03,
+				0x64, 0x65, 0x66, 0xd0, 0xe2, 0x09, 0x01, 0xa2, 0xe3, 0x09, 0x35, 0x0a, 0x31, 0xa2, 0x06, 0x06,
+				0x77, 0x68, 0x6f, 0x61, 0x68, 0x21, 0x0a, 0x03, 0x6d, 0x26, 0x6d, 0x10, 0x01, 0x10, 0x02, 0x1a,
+				0x0a, 0x0a, 0x04, 0x79, 0x6f, 0x6c, 0x6f, 0x10, 0xcd, 0x83, 0x06, 0x2a, 0x08, 0x0a, 0x03, 0x62,
+				0x61, 0x72, 0x10, 0xc8, 0x01, 0x2a, 0x07, 0x0a, 0x03, 0x66, 0x6f, 0x6f, 0x10, 0x64, 0x10, 0x00,
+				0xf2, 0xe3, 0x09, 0x1d, 0x0a, 0x04, 0x0a, 0x00, 0x12, 0x00, 0x0a, 0x0c, 0x0a, 0x03, 0x62, 0x61,
+				0x72, 0x12, 0x05, 0x0a, 0x03, 0x62, 0x61, 0x7a, 0x0a, 0x07, 0x0a, 0x03, 0x66, 0x6f, 0x6f, 0x12,
+				0x00,
+			})
+			return opts
+		}()).
+		AddField(builder.NewField("test", builder.FieldTypeMessage(testMsg)).
+			SetNumber(1)).
+		AddField(builder.NewField("fff", builder.FieldTypeEnum(testNestedNestedNestedEEEEnum)).
+			SetNumber(2).
+			SetDefaultValue("V1"))
+
+	validatorMsg.
+		AddField(builder.NewField("authenticated", builder.FieldTypeBool()).
+			SetNumber(1)).
+		AddField(builder.NewField("permission", builder.FieldTypeMessage(validatorPermissionMsg)).
+			SetNumber(2).
+			SetRepeated()).
+		AddNestedMessage(validatorPermissionMsg).
+		AddNestedEnum(validatorActionEnum)
+
+	validatorPermissionMsg.
+		AddField(builder.NewField("action", builder.FieldTypeEnum(validatorActionEnum)).
+			SetNumber(1)).
+		AddField(builder.NewField("entity", builder.FieldTypeString()).
+			SetNumber(2))
+
+	validatorActionEnum.
+		AddValue(builder.NewEnumValue("LOGIN").
+			SetNumber(0)).
+		AddValue(builder.NewEnumValue("READ").
+			SetNumber(1)).
+		AddValue(builder.NewEnumValue("WRITE").
+			SetNumber(2))
+
+	ruleMsg.
+		AddOneOf(builder.NewOneOf("rule").
+			AddChoice(builder.NewField("string", builder.FieldTypeMessage(ruleStringRuleMsg)).
+				SetNumber(1)).
+			AddChoice(builder.NewField("repeated", builder.FieldTypeMessage(ruleRepeatedRuleMsg)).
+				SetNumber(2)).
+			AddChoice(builder.NewField("int", builder.FieldTypeMessage(ruleIntRuleMsg)).
+				SetNumber(3)).
+			AddChoice(builder.NewGroupField(ruleFloatRuleMsg).
+				SetNumber(4))).
+		AddNestedMessage(ruleStringRuleMsg).
+		AddNestedMessage(ruleIntRuleMsg).
+		AddNestedMessage(ruleRepeatedRuleMsg)
+
+	ruleStringRuleMsg.
+		AddField(builder.NewField("pattern", builder.FieldTypeString()).
+			SetNumber(1)).
+		AddField(builder.NewField("allow_empty", builder.FieldTypeBool()).
+			SetNumber(2)).
+		AddField(builder.NewField("min_len", builder.FieldTypeInt32()).
+			SetNumber(3)).
+		AddField(builder.NewField("max_len", builder.FieldTypeInt32()).
+			SetNumber(4))
+
+	ruleIntRuleMsg.
+		AddField(builder.NewField("min_val", builder.FieldTypeInt64()).
+			SetNumber(1)).
+		AddField(builder.NewField("max_val", builder.FieldTypeUInt64()).
+			SetNumber(2))
+
+	ruleRepeatedRuleMsg.
+		AddField(builder.NewField("allow_empty", builder.FieldTypeBool()).
+			SetNumber(1)).
+		AddField(builder.NewField("min_items", builder.FieldTypeInt32()).
+			SetNumber(2)).
+		AddField(builder.NewField("max_items", builder.FieldTypeInt32()).
+			SetNumber(3)).
+		AddField(builder.NewField("items", builder.FieldTypeMessage(ruleMsg)).
+			SetNumber(4))
+
+	ruleFloatRuleMsg.
+		AddField(builder.NewField("min_val", builder.FieldTypeDouble()).
+			SetNumber(1)).
+		AddField(builder.NewField("max_val", builder.FieldTypeDouble()).
+			SetNumber(2))
+
+	isAuthorizedReqMsg.
+		AddField(builder.NewField("subjects", builder.FieldTypeString()).
+			SetNumber(1).
+			SetRepeated().
+			SetOptions(func() *descriptorpb.FieldOptions {
+				opts := &descriptorpb.FieldOptions{}
+				// custom options, in binary form
+				opts.ProtoReflect().SetUnknown([]byte{
+					0x92, 0x4d, 0x3b, 0x12, 0x39, 0x10, 0x01, 0x22, 0x35, 0x0a, 0x33, 0x0a, 0x31, 0x5e, 0x28, 0x3f,
+					0x3a, 0x28, 0x3f, 0x3a, 0x74, 0x65, 0x61, 0x6d, 0x3a, 0x28, 0x3f, 0x3a, 0x6c, 0x6f, 0x63, 0x61,
+					0x6c, 0x7c, 0x6c, 0x64, 0x61, 0x70, 0x29, 0x29, 0x7c, 0x75, 0x73, 0x65, 0x72, 0x29, 0x3a, 0x5b,
+					0x5b, 0x3a, 0x61, 0x6c, 0x6e, 0x75, 0x6d, 0x3a, 0x5d, 0x5f, 0x2d, 0x5d, 0x2b, 0x24,
+				})
+				return opts
+			}()))
+
+	keywordCollisionsMsg.
+		SetComments(builder.Comments{
+			LeadingDetachedComments: []string{
+				" tests cases where field names collide with keywords\n",
+			},
+		}).
+		AddField(builder.NewField("syntax", builder.FieldTypeBool()).
+			SetNumber(1)).
+		AddField(builder.NewField("import", builder.FieldTypeBool()).
+			SetNumber(2)).
+		AddField(builder.NewField("public", builder.FieldTypeBool()).
+			SetNumber(3)).
+		AddField(builder.NewField("weak", builder.FieldTypeBool()).
+			SetNumber(4)).
+		AddField(builder.NewField("package", builder.FieldTypeBool()).
+			SetNumber(5)).
+		AddField(builder.NewField("string", builder.FieldTypeString()).
+			SetNumber(6)).
+		AddField(builder.NewField("bytes", builder.FieldTypeBytes()).
+			SetNumber(7)).
+		AddField(builder.NewField("int32", builder.FieldTypeInt32()).
+			SetNumber(8)).
+		AddField(builder.NewField("int64", builder.FieldTypeInt64()).
+			SetNumber(9)).
+		AddField(builder.NewField("uint32", builder.FieldTypeUInt32()).
+			SetNumber(10)).
+		AddField(builder.NewField("uint64", builder.FieldTypeUInt64()).
+			SetNumber(11)).
+		AddField(builder.NewField("sint32", builder.FieldTypeSInt32()).
+			SetNumber(12)).
+		AddField(builder.NewField("sint64", builder.FieldTypeSInt64()).
+			SetNumber(13)).
+		AddField(builder.NewField("fixed32", builder.FieldTypeFixed32()).
+			SetNumber(14)).
+		AddField(builder.NewField("fixed64", builder.FieldTypeFixed64()).
+			SetNumber(15)).
+		AddField(builder.NewField("sfixed32", builder.FieldTypeSFixed32()).
+			SetNumber(16)).
+		AddField(builder.NewField("sfixed64", builder.FieldTypeSFixed64()).
+			SetNumber(17)).
+		AddField(builder.NewField("bool", builder.FieldTypeBool()).
+			SetNumber(18)).
+		AddField(builder.NewField("float", builder.FieldTypeFloat()).
+			SetNumber(19)).
+		AddField(builder.NewField("double", builder.FieldTypeDouble()).
+			SetNumber(20)).
+		AddField(builder.NewField("optional", builder.FieldTypeBool()).
+			SetNumber(21)).
+		AddField(builder.NewField("repeated", builder.FieldTypeBool()).
+			SetNumber(22)).
+		AddField(builder.NewField("required", builder.FieldTypeBool()).
+			SetNumber(23)).
+		AddField(builder.NewField("message", builder.FieldTypeBool()).
+			SetNumber(24)).
+		AddField(builder.NewField("enum", builder.FieldTypeBool()).
+			SetNumber(25)).
+		AddField(builder.NewField("service", builder.FieldTypeBool()).
+			SetNumber(26)).
+		AddField(builder.NewField("rpc", builder.FieldTypeBool()).
+			SetNumber(27)).
+		AddField(builder.NewField("option", builder.FieldTypeBool()).
+			SetNumber(28)).
+		AddField(builder.NewField("extend", builder.FieldTypeBool()).
+			SetNumber(29)).
+		AddField(builder.NewField("extensions", builder.FieldTypeBool()).
+			SetNumber(30)).
+		AddField(builder.NewField("reserved", builder.FieldTypeBool()).
+			SetNumber(31)).
+		AddField(builder.NewField("to", builder.FieldTypeBool()).
+			SetNumber(32)).
+		AddField(builder.NewField("true", builder.FieldTypeInt32()).
+			SetNumber(33)).
+		AddField(builder.NewField("false", builder.FieldTypeInt32()).
+			SetNumber(34)).
+		AddField(builder.NewField("default", builder.FieldTypeInt32()).
+			SetNumber(35))
+
+	keywordCollisionOptionsMsg.
+		AddField(builder.NewField("id", builder.FieldTypeUInt64()).
+			SetNumber(1).
+			SetOptions(func() *descriptorpb.FieldOptions {
+				opts := &descriptorpb.FieldOptions{}
+				// custom options, in binary form
+				opts.ProtoReflect().SetUnknown([]byte{
+					0x88, 0xe2, 0x09, 0x01, 0x90, 0xe2, 0x09, 0x01, 0x98, 0xe2, 0x09, 0x01, 0xa0, 0xe2, 0x09, 0x01,
+					0xa8, 0xe2, 0x09, 0x01, 0xb2, 0xe2, 0x09, 0x06, 0x73, 0x74, 0x72, 0x69, 0x6e, 0x67, 0xba, 0xe2,
+					0x09, 0x05, 0x62, 0x79, 0x74, 0x65, 0x73, 0xc0, 0xe2, 0x09, 0x20, 0xc8, 0xe2, 0x09, 0x40, 0xd0,
+					0xe2, 0x09, 0x80, 0x19, 0xd8, 0xe2, 0x09, 0x80, 0x32, 0xe0, 0xe2, 0x09, 0x3f, 0xe8, 0xe2, 0x09,
+					0x7f, 0xf5, 0xe2, 0x09, 0xa0, 0x0c, 0x00, 0x00, 0xf9, 0xe2, 0x09, 0x40, 0x19, 0x00, 0x00, 0x00,
+					0x00, 0x00, 0x00, 0x85, 0xe3, 0x09, 0x60, 0xf3, 0xff, 0xff, 0x89, 0xe3, 0x09, 0xc0, 0xe6, 0xff,
+					0xff, 0xff, 0xff, 0xff, 0xff, 0x90, 0xe3, 0x09, 0x01, 0x9d, 0xe3, 0x09, 0xc3, 0xf5, 0x48, 0x40,
+					0xa1, 0xe3, 0x09, 0x6e, 0x86, 0x1b, 0xf0, 0xf9, 0x21, 0x09, 0x40, 0xa8, 0xe3, 0x09, 0x01, 0xb0,
+					0xe3, 0x09, 0x01, 0xb8, 0xe3, 0x09, 0x01, 0xc0, 0xe3, 0x09, 0x01, 0xc8, 0xe3, 0x09, 0x01, 0xd0,
+					0xe3, 0x09, 0x01, 0xd8, 0xe3, 0x09, 0x01, 0xe0, 0xe3, 0x09, 0x01, 0xe8, 0xe3, 0x09, 0x01, 0xf0,
+					0xe3, 0x09, 0x01, 0xf8, 0xe3, 0x09, 0x01, 0x80, 0xe4, 0x09, 0x01, 0x88, 0xe4, 0x09, 0x6f, 0x90,
+					0xe4, 0x09, 0x91, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0x01, 0x98, 0xe4, 0x09, 0xde,
+					0x01,
+				})
+				return opts
+			}())).
+		AddField(builder.NewField("name", builder.FieldTypeString()).
+			SetNumber(2).
+			SetOptions(func() *descriptorpb.FieldOptions {
+				opts := &descriptorpb.FieldOptions{}
+				// custom options, in binary form
+				opts.ProtoReflect().SetUnknown([]byte{
+					0xa2, 0xe4, 0x09, 0x8f, 0x01, 0x08, 0x01, 0x10, 0x01, 0x18, 0x01, 0x20, 0x01, 0x28, 0x01, 0x32,
+					0x06, 0x73, 0x74, 0x72, 0x69, 0x6e, 0x67, 0x3a, 0x05, 0x62, 0x79, 0x74, 0x65, 0x73, 0x40, 0x20,
+					0x48, 0x40, 0x50, 0x80, 0x19, 0x58, 0x80, 0x32, 0x60, 0x3f, 0x68, 0x7f, 0x75, 0xa0, 0x0c, 0x00,
+					0x00, 0x79, 0x40, 0x19, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x85, 0x01, 0x60, 0xf3, 0xff, 0xff,
+					0x89, 0x01, 0xc0, 0xe6, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0x90, 0x01, 0x01, 0x9d, 0x01, 0xc3,
+					0xf5, 0x48, 0x40, 0xa1, 0x01, 0x6e, 0x86, 0x1b, 0xf0, 0xf9, 0x21, 0x09, 0x40, 0xa8, 0x01, 0x01,
+					0xb0, 0x01, 0x01, 0xb8, 0x01, 0x01, 0xc0, 0x01, 0x01, 0xc8, 0x01, 0x01, 0xd0, 0x01, 0x01, 0xd8,
+					0x01, 0x01, 0xe0, 0x01, 0x01, 0xe8, 0x01, 0x01, 0xf0, 0x01, 0x01, 0xf8, 0x01, 0x01, 0x80, 0x02,
+					0x01, 0x88, 0x02, 0x6f, 0x90, 0x02, 0x91, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0x01,
+					0x98, 0x02, 0xde, 0x01,
+				})
+				return opts
+			}()))
+
+	enumWithReservationsEnum.
+		AddValue(builder.NewEnumValue("X").
+			SetNumber(2)).
+		AddValue(builder.NewEnumValue("Y").
+			SetNumber(3)).
+		AddValue(builder.NewEnumValue("Z").
+			SetNumber(4)).
+		AddReservedRange(1000, 2147483647).
+		AddReservedRange(-2, 1).
+		AddReservedRange(5, 10).
+		AddReservedRange(12, 15).
+		AddReservedRange(18, 18).
+		AddReservedRange(-5, -3).
+		AddReservedName("C").
+		AddReservedName("B").
+		AddReservedName("A")
+
+	fb := builder.NewFile("desc_test_complex.proto").
+		SetPackageName("foo.bar").
+		SetOptions(&descriptorpb.FileOptions{
+			GoPackage: proto.String("github.com/jhump/protoreflect/internal/testprotos"),
+		}).
+		AddImportedDependency(descriptorFile).
+		AddMessage(simpleMsg).
+		AddMessage(testMsg).
+		AddMessage(messageWithReservationsMsg).
+		AddMessage(messageWithMapMsg).
+		AddMessage(anotherMsg).
+		AddMessage(validatorMsg).
+		AddMessage(ruleMsg).
+		AddMessage(isAuthorizedReqMsg).
+		AddMessage(keywordCollisionsMsg).
+		AddMessage(keywordCollisionOptionsMsg).
+		AddEnum(enumWithReservationsEnum).
+		AddExtension(builder.NewExtensionImported("label", 20000, builder.FieldTypeString(), descriptorFile.FindMessage("google.protobuf.ExtensionRangeOptions"))).
+		AddExtension(builder.NewExtensionImported("rept", 20002, builder.FieldTypeMessage(testMsg), descriptorFile.FindMessage("google.protobuf.MessageOptions")).
+			SetRepeated()).
+		AddExtension(builder.NewExtensionImported("eee", 20010, builder.FieldTypeEnum(testNestedNestedNestedEEEEnum), descriptorFile.FindMessage("google.protobuf.MessageOptions"))).
+		AddExtension(builder.NewExtensionImported("a", 20020, builder.FieldTypeMessage(anotherMsg), descriptorFile.FindMessage("google.protobuf.MessageOptions"))).
+		AddExtension(builder.NewExtensionImported("map_vals", 20030, builder.FieldTypeMessage(messageWithMapMsg), descriptorFile.FindMessage("google.protobuf.MessageOptions"))).
+		AddExtension(builder.NewExtensionImported("validator", 12345, builder.FieldTypeMessage(validatorMsg), descriptorFile.FindMessage("google.protobuf.MethodOptions"))).
+		AddExtension(builder.NewExtensionImported("rules", 1234, builder.FieldTypeMessage(ruleMsg), descriptorFile.FindMessage("google.protobuf.FieldOptions"))).
+		AddExtension(builder.NewExtensionImported("syntax", 20001, builder.FieldTypeBool(), descriptorFile.FindMessage("google.protobuf.FieldOptions"))).
+		AddExtension(builder.NewExtensionImported("import", 20002, builder.FieldTypeBool(), descriptorFile.FindMessage("google.protobuf.FieldOptions"))).
+		AddExtension(builder.NewExtensionImported("public", 20003, builder.FieldTypeBool(), descriptorFile.FindMessage("google.protobuf.FieldOptions"))).
+		AddExtension(builder.NewExtensionImported("weak", 20004, builder.FieldTypeBool(), descriptorFile.FindMessage("google.protobuf.FieldOptions"))).
+		AddExtension(builder.NewExtensionImported("package", 20005, builder.FieldTypeBool(), descriptorFile.FindMessage("google.protobuf.FieldOptions"))).
+		AddExtension(builder.NewExtensionImported("string", 20006, builder.FieldTypeString(), descriptorFile.FindMessage("google.protobuf.FieldOptions"))).
+		AddExtension(builder.NewExtensionImported("bytes", 20007, builder.FieldTypeBytes(), descriptorFile.FindMessage("google.protobuf.FieldOptions"))).
+		AddExtension(builder.NewExtensionImported("int32", 20008, builder.FieldTypeInt32(), descriptorFile.FindMessage("google.protobuf.FieldOptions"))).
+		AddExtension(builder.NewExtensionImported("int64", 20009, builder.FieldTypeInt64(), descriptorFile.FindMessage("google.protobuf.FieldOptions"))).
+		AddExtension(builder.NewExtensionImported("uint32", 20010, builder.FieldTypeUInt32(), descriptorFile.FindMessage("google.protobuf.FieldOptions"))).
+		AddExtension(builder.NewExtensionImported("uint64", 20011, builder.FieldTypeUInt64(), descriptorFile.FindMessage("google.protobuf.FieldOptions"))).
+		AddExtension(builder.NewExtensionImported("sint32", 20012, builder.FieldTypeSInt32(), descriptorFile.FindMessage("google.protobuf.FieldOptions"))).
+		AddExtension(builder.NewExtensionImported("sint64", 20013, builder.FieldTypeSInt64(), descriptorFile.FindMessage("google.protobuf.FieldOptions"))).
+		AddExtension(builder.NewExtensionImported("fixed32", 20014, builder.FieldTypeFixed32(), descriptorFile.FindMessage("google.protobuf.FieldOptions"))).
+		AddExtension(builder.NewExtensionImported("fixed64", 20015, builder.FieldTypeFixed64(), descriptorFile.FindMessage("google.protobuf.FieldOptions"))).
+		AddExtension(builder.NewExtensionImported("sfixed32", 20016, builder.FieldTypeSFixed32(), descriptorFile.FindMessage("google.protobuf.FieldOptions"))).
+		AddExtension(builder.NewExtensionImported("sfixed64", 20017, builder.FieldTypeSFixed64(), descriptorFile.FindMessage("google.protobuf.FieldOptions"))).
+		AddExtension(builder.NewExtensionImported("bool", 20018, builder.FieldTypeBool(), descriptorFile.FindMessage("google.protobuf.FieldOptions"))).
+		AddExtension(builder.NewExtensionImported("float", 20019, builder.FieldTypeFloat(), descriptorFile.FindMessage("google.protobuf.FieldOptions"))).
+		AddExtension(builder.NewExtensionImported("double", 20020, builder.FieldTypeDouble(), descriptorFile.FindMessage("google.protobuf.FieldOptions"))).
+		AddExtension(builder.NewExtensionImported("optional", 20021, builder.FieldTypeBool(), descriptorFile.FindMessage("google.protobuf.FieldOptions"))).
+		AddExtension(builder.NewExtensionImported("repeated", 20022, builder.FieldTypeBool(), descriptorFile.FindMessage("google.protobuf.FieldOptions"))).
+		AddExtension(builder.NewExtensionImported("required", 20023, builder.FieldTypeBool(), descriptorFile.FindMessage("google.protobuf.FieldOptions"))).
+		AddExtension(builder.NewExtensionImported("message", 20024, builder.FieldTypeBool(), descriptorFile.FindMessage("google.protobuf.FieldOptions"))).
+		AddExtension(builder.NewExtensionImported("enum", 20025, builder.FieldTypeBool(), descriptorFile.FindMessage("google.protobuf.FieldOptions"))).
+		AddExtension(builder.NewExtensionImported("service", 20026, builder.FieldTypeBool(), descriptorFile.FindMessage("google.protobuf.FieldOptions"))).
+		AddExtension(builder.NewExtensionImported("rpc", 20027, builder.FieldTypeBool(), descriptorFile.FindMessage("google.protobuf.FieldOptions"))).
+		AddExtension(builder.NewExtensionImported("option", 20028, builder.FieldTypeBool(), descriptorFile.FindMessage("google.protobuf.FieldOptions"))).
+		AddExtension(builder.NewExtensionImported("extend", 20029, builder.FieldTypeBool(), descriptorFile.FindMessage("google.protobuf.FieldOptions"))).
+		AddExtension(builder.NewExtensionImported("extensions", 20030, builder.FieldTypeBool(), descriptorFile.FindMessage("google.protobuf.FieldOptions"))).
+		AddExtension(builder.NewExtensionImported("reserved", 20031, builder.FieldTypeBool(), descriptorFile.FindMessage("google.protobuf.FieldOptions"))).
+		AddExtension(builder.NewExtensionImported("to", 20032, builder.FieldTypeBool(), descriptorFile.FindMessage("google.protobuf.FieldOptions"))).
+		AddExtension(builder.NewExtensionImported("true", 20033, builder.FieldTypeInt32(), descriptorFile.FindMessage("google.protobuf.FieldOptions"))).
+		AddExtension(builder.NewExtensionImported("false", 20034, builder.FieldTypeInt32(), descriptorFile.FindMessage("google.protobuf.FieldOptions"))).
+		AddExtension(builder.NewExtensionImported("default", 20035, builder.FieldTypeInt32(), descriptorFile.FindMessage("google.protobuf.FieldOptions"))).
+		AddExtension(builder.NewExtensionImported("boom", 20036, builder.FieldTypeMessage(keywordCollisionsMsg), descriptorFile.FindMessage("google.protobuf.FieldOptions"))).
+		AddService(builder.NewService("TestTestService").
+			AddMethod(builder.NewMethod("UserAuth", builder.RpcTypeMessage(testMsg, false), builder.RpcTypeMessage(testMsg, false)).
+				SetOptions(func() *descriptorpb.MethodOptions {
+					opts := &descriptorpb.MethodOptions{}
+					// custom options, in binary form
+					opts.ProtoReflect().SetUnknown([]byte{
+						0xca, 0x83, 0x06, 0x0e, 0x08, 0x01, 0x12, 0x0a, 0x08, 0x00, 0x12, 0x06, 0x63, 0x6c, 0x69, 0x65,
+						0x6e, 0x74,
+					})
+					return opts
+				}())).
+			AddMethod(builder.NewMethod("Get", builder.RpcTypeMessage(testMsg, false), builder.RpcTypeMessage(testMsg, false)).
+				SetOptions(func() *descriptorpb.MethodOptions {
+					opts := &descriptorpb.MethodOptions{}
+					// custom options, in binary form
+					opts.ProtoReflect().SetUnknown([]byte{
+						0xca, 0x83, 0x06, 0x0c, 0x08, 0x01, 0x12, 0x08, 0x08, 0x01, 0x12, 0x04, 0x75, 0x73, 0x65, 0x72,
+					})
+					return opts
+				}())))
+	return fb, nil
+}
@@ -0,0 +1,70 @@
+// Code generated by buildergen. DO NOT EDIT.
+// source: desc_test_options.proto
+
+package testgen
+
+import "github.com/jhump/protoreflect/desc"
+import "github.com/jhump/protoreflect/desc/builder"
+import "google.golang.org/protobuf/proto"
+import descriptorpb "google.golang.org/protobuf/types/descriptorpb"
+
+// DescTestOptionsProto returns a builder that reconstructs "desc_test_options.proto".
+func DescTestOptionsProto() (*builder.FileBuilder, error) {
+	descriptorFile, err := desc.LoadFileDescriptor("google/protobuf/descriptor.proto")
+	if err != nil {
+		return nil, err
+	}
+	reallySimpleMessageMsg := builder.NewMessage("ReallySimpleMessage")
+	reallySimpleEnum := builder.NewEnum("ReallySimpleEnum")
+
+	reallySimpleMessageMsg.
+		SetComments(builder.Comments{
+			LeadingComment: " Test message used by custom options\n",
+		}).
+		AddField(builder.NewField("id", builder.FieldTypeUInt64()).
+			SetNumber(1)).
+		AddField(builder.NewField("name", builder.FieldTypeString()).
+			SetNumber(2))
+
+	reallySimpleEnum.
+		SetComments(builder.Comments{
+			LeadingComment: " Test enum used by custom options\n",
+		}).
+		AddValue(builder.NewEnumValue("VALUE").
+			SetNumber(1))
+
+	fb := builder.NewFile("desc_test_options.proto").
+		SetPackageName("testprotos").
+		SetOptions(&descriptorpb.FileOptions{
+			GoPackage: proto.String("github.com/jhump/protoreflect/internal/testprotos"),
+		}).
+		AddImportedDependency(descriptorFile).
+		AddMessage(reallySimpleMessageMsg).
+		AddEnum(reallySimpleEnum).
+		AddExtension(builder.NewExtensionImported("mfubar", 10101, builder.FieldTypeBool(), descriptorFile.FindMessage("google.protobuf.MessageOptions"))).
+		AddExtension(builder.NewExtensionImported("ffubar", 10101, builder.FieldTypeString(), descriptorFile.FindMessage("google.protobuf.FieldOptions")).
+			SetRepeated()).
+		AddExtension(builder.NewExtensionImported("ffubarb", 10102, builder.FieldTypeBytes(), descriptorFile.FindMessage("google.protobuf.FieldOptions"))).
+		AddExtension(builder.NewExtensionImported("efubar", 10101, builder.FieldTypeInt32(), descriptorFile.FindMessage("google.protobuf.EnumOptions"))).
+		AddExtension(builder.NewExtensionImported("efubars", 10102, builder.FieldTypeSInt32(), descriptorFile.FindMessage("google.protobuf.EnumOptions"))).
+		AddExtension(builder.NewExtensionImported("efubarsf", 10103, builder.FieldTypeSFixed32(), descriptorFile.FindMessage("google.protobuf.EnumOptions"))).
+		AddExtension(builder.NewExtensionImported("efubaru", 10104, builder.FieldTypeUInt32(), descriptorFile.FindMessage("google.protobuf.EnumOptions"))).
+		AddExtension(builder.NewExtensionImported("efubaruf", 10105, builder.FieldTypeFixed32(), descriptorFile.FindMessage("google.protobuf.EnumOptions"))).
+		AddExtension(builder.NewExtensionImported("evfubar", 10101, builder.FieldTypeInt64(), descriptorFile.FindMessage("google.protobuf.EnumValueOptions"))).
+		AddExtension(builder.NewExtensionImported("evfubars", 10102, builder.FieldTypeSInt64(), descriptorFile.FindMessage("google.protobuf.EnumValueOptions"))).
+		AddExtension(builder.NewExtensionImported("evfubarsf", 10103, builder.FieldTypeSFixed64(), descriptorFile.FindMessage("google.protobuf.EnumValueOptions"))).
+		AddExtension(builder.NewExtensionImported("evfubaru", 10104, builder.FieldTypeUInt64(), descriptorFile.FindMessage("google.protobuf.EnumValueOptions"))).
+		AddExtension(builder.NewExtensionImported("evfubaruf", 10105, builder.FieldTypeFixed64(), descriptorFile.FindMessage("google.protobuf.EnumValueOptions"))).
+		AddExtension(builder.NewExtensionImported("sfubar", 10101, builder.FieldTypeMessage(reallySimpleMessageMsg), descriptorFile.FindMessage("google.protobuf.ServiceOptions"))).
+		AddExtension(builder.NewExtensionImported("sfubare", 10102, builder.FieldTypeEnum(reallySimpleEnum), descriptorFile.FindMessage("google.protobuf.ServiceOptions"))).
+		AddExtension(builder.NewExtensionImported("mtfubar", 10101, builder.FieldTypeFloat(), descriptorFile.FindMessage("google.protobuf.MethodOptions")).
+			SetRepeated()).
+		AddExtension(builder.NewExtensionImported("mtfubard", 10102, builder.FieldTypeDouble(), descriptorFile.FindMessage("google.protobuf.MethodOptions"))).
+		AddExtension(builder.NewExtensionImported("exfubar", 10101, builder.FieldTypeString(), descriptorFile.FindMessage("google.protobuf.ExtensionRangeOptions")).
+			SetRepeated()).
+		AddExtension(builder.NewExtensionImported("exfubarb", 10102, builder.FieldTypeBytes(), descriptorFile.FindMessage("google.protobuf.ExtensionRangeOptions"))).
+		AddExtension(builder.NewExtensionImported("oofubar", 10101, builder.FieldTypeString(), descriptorFile.FindMessage("google.protobuf.OneofOptions")).
+			SetRepeated()).
+		AddExtension(builder.NewExtensionImported("oofubarb", 10102, builder.FieldTypeBytes(), descriptorFile.FindMessage("google.protobuf.OneofOptions")))
+	return fb, nil
+}
@@ -0,0 +1,72 @@
+// Code generated by buildergen. DO NOT EDIT.
+// source: desc_test_proto3.proto
+
+package testgen
+
+import "github.com/jhump/protoreflect/desc"
+import "github.com/jhump/protoreflect/desc/builder"
+import "google.golang.org/protobuf/proto"
+import descriptorpb "google.golang.org/protobuf/types/descriptorpb"
+
+// DescTestProto3Proto returns a builder that reconstructs "desc_test_proto3.proto".
+func DescTestProto3Proto() (*builder.FileBuilder, error) {
+	descTest1File, err := desc.LoadFileDescriptor("desc_test1.proto")
+	if err != nil {
+		return nil, err
+	}
+	descTestPkgFile, err := desc.LoadFileDescriptor("pkg/desc_test_pkg.proto")
+	if err != nil {
+		return nil, err
+	}
+	testRequestMsg := builder.NewMessage("TestRequest")
+	testResponseMsg := builder.NewMessage("TestResponse")
+	proto3Enum := builder.NewEnum("Proto3Enum")
+
+	testRequestMsg.
+		AddField(builder.NewField("foo", builder.FieldTypeEnum(proto3Enum)).
+			SetNumber(1).
+			SetRepeated()).
+		AddField(builder.NewField("bar", builder.FieldTypeString()).
+			SetNumber(2)).
+		AddField(builder.NewField("baz", builder.FieldTypeImportedMessage(descTest1File.FindMessage("testprotos.TestMessage"))).
+			SetNumber(3)).
+		AddField(builder.NewField("snafu", builder.FieldTypeImportedMessage(descTest1File.FindMessage("testprotos.TestMessage.NestedMessage.AnotherNestedMessage"))).
+			SetNumber(4)).
+		AddField(builder.NewMapField("flags", builder.FieldTypeString(), builder.FieldTypeBool()).
+			SetNumber(5)).
+		AddField(builder.NewMapField("others", builder.FieldTypeString(), builder.FieldTypeImportedMessage(descTest1File.FindMessage("testprotos.TestMessage"))).
+			SetNumber(6))
+
+	testResponseMsg.
+		AddField(builder.NewField("atm", builder.FieldTypeImportedMessage(descTest1File.FindMessage("testprotos.AnotherTestMessage"))).
+			SetNumber(1)).
+		AddField(builder.NewField("vs", builder.FieldTypeInt32()).
+			SetNumber(2).
+			SetRepeated())
+
+	proto3Enum.
+		AddValue(builder.NewEnumValue("UNKNOWN").
+			SetNumber(0)).
+		AddValue(builder.NewEnumValue("VALUE1").
+			SetNumber(1)).
+		AddValue(builder.NewEnumValue("VALUE2").
+			SetNumber(2))
+
+	fb := builder.NewFile("desc_test_proto3.proto").
+		SetPackageName("testprotos").
+		SetProto3(true).
+		SetOptions(&descriptorpb.FileOptions{
+			GoPackage: proto.String("github.com/jhump/protoreflect/internal/testprotos"),
+		}).
+		AddImportedDependency(descTest1File).
+		AddImportedDependency(descTestPkgFile).
+		AddMessage(testRequestMsg).
+		AddMessage(testResponseMsg).
+		AddEnum(proto3Enum).
+		AddService(builder.NewService("TestService").
+			AddMethod(builder.NewMethod("DoSomething", builder.RpcTypeMessage(testRequestMsg, false), builder.RpcTypeImportedMessage(descTestPkgFile.FindMessage("jhump.protoreflect.desc.Bar"), false))).
+			AddMethod(builder.NewMethod("DoSomethingElse", builder.RpcTypeImportedMessage(descTest1File.FindMessage("testprotos.TestMessage"), true), builder.RpcTypeMessage(testResponseMsg, false))).
+			AddMethod(builder.NewMethod("DoSomethingAgain", builder.RpcTypeImportedMessage(descTestPkgFile.FindMessage("jhump.protoreflect.desc.Bar"), false), builder.RpcTypeImportedMessage(descTest1File.FindMessage("testprotos.AnotherTestMessage"), true))).
+			AddMethod(builder.NewMethod("DoSomethingForever", builder.RpcTypeMessage(testRequestMsg, true), builder.RpcTypeMessage(testResponseMsg, true))))
+	return fb, nil
+}
@@ -0,0 +1,53 @@
+//go:build ignore
+
+// This program generates the Go files in this directory, which are used to
+// test the buildergen package. Run it via "go generate".
+package main
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/jhump/gopoet"
+
+	"github.com/jhump/protoreflect/desc"
+	"github.com/jhump/protoreflect/desc/builder/buildergen"
+	_ "github.com/jhump/protoreflect/internal/testprotos"
+)
+
+var files = []string{
+	"desc_test1.proto",
+	"desc_test_comments.proto",
+	"desc_test_complex.proto",
+	"desc_test_options.proto",
+	"desc_test_proto3.proto",
+}
+
+func main() {
+	g := buildergen.Generator{PackagePath: "github.com/jhump/protoreflect/desc/builder/buildergen/internal/testgen"}
+	for _, name := range files {
+		fd, err := desc.LoadFileDescriptor(name)
+		if err != nil {
+			fail(err)
+		}
+		f, err := g.GenerateFile(fd)
+		if err != nil {
+			fail(err)
+		}
+		out, err := os.Create(f.Name)
+		if err != nil {
+			fail(err)
+		}
+		if err := gopoet.WriteGoFile(out, f); err != nil {
+			fail(err)
+		}
+		if err := out.Close(); err != nil {
+			fail(err)
+		}
+	}
+}
+
+func fail(err error) {
+	fmt.Fprintln(os.Stderr, err)
+	os.Exit(1)
+}
@@ -0,0 +1,17 @@
+// Package testgen contains code generated by the buildergen package, which is
+// used to test that package.
+package testgen
+
+import "github.com/jhump/protoreflect/desc/builder"
+
+//go:generate go run gen.go
+
+// Files maps the names of proto files to the generated functions that
+// reconstruct them.
+var Files = map[string]func() (*builder.FileBuilder, error){
+	"desc_test1.proto":         DescTest1Proto,
+	"desc_test_comments.proto": DescTestCommentsProto,
+	"desc_test_complex.proto":  DescTestComplexProto,
+	"desc_test_options.proto":  DescTestOptionsProto,
+	"desc_test_proto3.proto":   DescTestProto3Proto,
+}
@@ -0,0 +1,449 @@
+package builder
+
+import (
+	"fmt"
+
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/types/descriptorpb"
+
+	"github.com/jhump/protoreflect/desc"
+)
+
+// CloneOptions includes additional options to use when cloning builders.
+type CloneOptions struct {
+	// By default, references from the cloned builders to builders outside of
+	// the cloned tree, such as a field whose type is a message builder in
+	// another file, refer to the original builders. If this option is true,
+	// the root (usually a file builder) of each such referenced builder is
+	// cloned, too, and references refer to those clones instead. This applies
+	// transitively, so the result is a copy of the entire graph of builders
+	// that are reachable from the cloned builder.
+	//
+	// References to builders that are in the same file as, but outside of, the
+	// cloned tree always refer to the original builders, even when this option
+	// is true.
+	CloneReferencedFiles bool
+}
+
+// Clone returns a deep copy of the given builder, including all of its
+// descendants. The returned builder has no parent. References in the copy to
+// other builders in the copied tree refer to their copies; other references
+// are handled according to these options. Using a builder's Clone() method is
+// equivalent to cloning with a zero-value CloneOptions.
+func (opts CloneOptions) Clone(b Builder) Builder {
+	c := newCloner(opts, b)
+	cl := c.copy(b)
+	c.fixReferences()
+	return cl
+}
+
+// Clone returns a deep copy of this file, including all of its contents. See
+// CloneOptions for more details.
+func (fb *FileBuilder) Clone() *FileBuilder {
+	return CloneOptions{}.Clone(fb).(*FileBuilder)
+}
+
+// Clone returns a deep copy of this message, including all of its fields and
+// nested elements. The copy has no parent. See CloneOptions for more details.
+func (mb *MessageBuilder) Clone() *MessageBuilder {
+	return CloneOptions{}.Clone(mb).(*MessageBuilder)
+}
+
+// Clone returns a deep copy of this field. The copy has no parent. See
+// CloneOptions for more details.
+func (flb *FieldBuilder) Clone() *FieldBuilder {
+	return CloneOptions{}.Clone(flb).(*FieldBuilder)
+}
+
+// Clone returns a deep copy of this one-of, including all of its choices. The
+// copy has no parent. See CloneOptions for more details.
+func (oob *OneOfBuilder) Clone() *OneOfBuilder {
+	return CloneOptions{}.Clone(oob).(*OneOfBuilder)
+}
+
+// Clone returns a deep copy of this enum, including all of its values. The
+// copy has no parent. See CloneOptions for more details.
+func (eb *EnumBuilder) Clone() *EnumBuilder {
+	return CloneOptions{}.Clone(eb).(*EnumBuilder)
+}
+
+// Clone returns a copy of this enum value. The copy has no parent.
+func (evb *EnumValueBuilder) Clone() *EnumValueBuilder {
+	return CloneOptions{}.Clone(evb).(*EnumValueBuilder)
+}
+
+// Clone returns a deep copy of this service, including all of its methods.
+// The copy has no parent. See CloneOptions for more details.
+func (sb *ServiceBuilder) Clone() *ServiceBuilder {
+	return CloneOptions{}.Clone(sb).(*ServiceBuilder)
+}
+
+// Clone returns a deep copy of this method. The copy has no parent. See
+// CloneOptions for more details.
+func (mtb *MethodBuilder) Clone() *MethodBuilder {
+	return CloneOptions{}.Clone(mtb).(*MethodBuilder)
+}
+
+// Clone returns a deep copy of this set. Each file in the set is cloned and
+// references between files in the set refer to the clones.
+func (s *FileSet) Clone() *FileSet {
+	roots := make([]Builder, len(s.files))
+	for i, fb := range s.files {
+		roots[i] = fb
+	}
+	c := newCloner(CloneOptions{}, roots...)
+	clone := &FileSet{files: make([]*FileBuilder, len(s.files))}
+	for i, fb := range s.files {
+		clone.files[i] = c.copy(fb).(*FileBuilder)
+	}
+	c.fixReferences()
+	return clone
+}
+
+// cloner copies trees of builders. Trees are copied first and then references
+// in the copies are updated, once all builders that will be copied are known.
+type cloner struct {
+	opts CloneOptions
+	// maps original builders to their copies
+	clones map[Builder]Builder
+	// roots of the trees being cloned; other builders in these roots are never
+	// cloned to satisfy references
+	roots map[Builder]struct{}
+	// copies that may need references updated
+	toFix []Builder
+}
+
+func newCloner(opts CloneOptions, bs ...Builder) *cloner {
+	c := &cloner{
+		opts:   opts,
+		clones: map[Builder]Builder{},
+		roots:  map[Builder]struct{}{},
+	}
+	for _, b := range bs {
+		c.roots[getRoot(b)] = struct{}{}
+	}
+	return c
+}
+
+func copyBase(bb *baseBuilder) baseBuilder {
+	return baseBuilder{
+		name:       bb.name,
+		comments:   copyComments(bb.comments),
+		customOpts: copyCustomOptions(bb.customOpts),
+		lossless:   bb.lossless,
+	}
+}
+
+func copyComments(c Comments) Comments {
+	c.LeadingDetachedComments = append([]string(nil), c.LeadingDetachedComments...)
+	return c
+}
+
+func copyCustomOptions(co customOptions) customOptions {
+	var cl customOptions
+	if co.exts != nil {
+		cl.exts = make(map[string]*desc.FieldDescriptor, len(co.exts))
+		for k, v := range co.exts {
+			cl.exts[k] = v
+		}
+	}
+	if co.pending != nil {
+		cl.pending = make(map[string]interface{}, len(co.pending))
+		for k, v := range co.pending {
+			cl.pending[k] = v
+		}
+	}
+	return cl
+}
+
+// copy copies the given builder and all of its descendants. References to other
+// builders are not yet updated; that is done by fixReferences.
+func (c *cloner) copy(b Builder) Builder {
+	var cl Builder
+	switch b := b.(type) {
+	case *FileBuilder:
+		cl = c.copyFile(b)
+	case *MessageBuilder:
+		cl = c.copyMessage(b)
+	case *FieldBuilder:
+		cl = c.copyField(b)
+	case *OneOfBuilder:
+		cl = c.copyOneOf(b)
+	case *EnumBuilder:
+		cl = c.copyEnum(b)
+	case *EnumValueBuilder:
+		cl = c.copyEnumValue(b)
+	case *ServiceBuilder:
+		cl = c.copyService(b)
+	case *MethodBuilder:
+		cl = c.copyMethod(b)
+	default:
+		panic(fmt.Sprintf("Unrecognized kind of builder: %T", b))
+	}
+	c.clones[b] = cl
+	return cl
+}
+
+func (c *cloner) copyFile(fb *FileBuilder) *FileBuilder {
+	cl := &FileBuilder{
+		name:            fb.name,
+		IsProto3:        fb.IsProto3,
+		Edition:         fb.Edition,
+		Package:         fb.Package,
+		comments:        copyComments(fb.comments),
+		SyntaxComments:  copyComments(fb.SyntaxComments),
+		PackageComments: copyComments(fb.PackageComments),
+		symbols:         make(map[string]Builder, len(fb.symbols)),
+		origExts:        fb.origExts,
+		customOpts:      copyCustomOptions(fb.customOpts),
+		lossless:        fb.lossless,
+	}
+	if fb.Options != nil {
+		cl.Options = proto.Clone(fb.Options).(*descriptorpb.FileOptions)
+	}
+	if fb.explicitImports != nil {
+		cl.explicitImports = make(map[*desc.FileDescriptor]struct{}, len(fb.explicitImports))
+		for fd := range fb.explicitImports {
+			cl.explicitImports[fd] = struct{}{}
+		}
+	}
+	if fb.explicitDeps != nil {
+		// these refer to the original builders until fixReferences
+		cl.explicitDeps = make(map[*FileBuilder]struct{}, len(fb.explicitDeps))
+		for dep := range fb.explicitDeps {
+			cl.explicitDeps[dep] = struct{}{}
+		}
+	}
+	for _, mb := range fb.messages {
+		cl.messages = append(cl.messages, c.copyChild(mb, cl).(*MessageBuilder))
+	}
+	for _, exb := range fb.extensions {
+		cl.extensions = append(cl.extensions, c.copyChild(exb, cl).(*FieldBuilder))
+	}
+	for _, eb := range fb.enums {
+		cl.enums = append(cl.enums, c.copyChild(eb, cl).(*EnumBuilder))
+	}
+	for _, sb := range fb.services {
+		cl.services = append(cl.services, c.copyChild(sb, cl).(*ServiceBuilder))
+	}
+	for name, b := range fb.symbols {
+		cl.symbols[name] = c.clones[b]
+	}
+	c.toFix = append(c.toFix, cl)
+	return cl
+}
+
+func (c *cloner) copyChild(b, parent Builder) Builder {
+	cl := c.copy(b)
+	cl.setParent(parent)
+	return cl
+}
+
+func (c *cloner) copyMessage(mb *MessageBuilder) *MessageBuilder {
+	cl := &MessageBuilder{
+		baseBuilder:         copyBase(&mb.baseBuilder),
+		ReservedNames:       append([]string(nil), mb.ReservedNames...),
+		TagStrategy:         mb.TagStrategy,
+		EnforceReservations: mb.EnforceReservations,
+		fieldTags:           make(map[int32]*FieldBuilder, len(mb.fieldTags)),
+		symbols:             make(map[string]Builder, len(mb.symbols)),
+	}
+	if mb.Options != nil {
+		cl.Options = proto.Clone(mb.Options).(*descriptorpb.MessageOptions)
+	}
+	for _, er := range mb.ExtensionRanges {
+		cl.ExtensionRanges = append(cl.ExtensionRanges, proto.Clone(er).(*descriptorpb.DescriptorProto_ExtensionRange))
+	}
+	for _, rr := range mb.ReservedRanges {
+		cl.ReservedRanges = append(cl.ReservedRanges, proto.Clone(rr).(*descriptorpb.DescriptorProto_ReservedRange))
+	}
+	for _, b := range mb.fieldsAndOneOfs {
+		cl.fieldsAndOneOfs = append(cl.fieldsAndOneOfs, c.copyChild(b, cl))
+	}
+	for _, nmb := range mb.nestedMessages {
+		cl.nestedMessages = append(cl.nestedMessages, c.copyChild(nmb, cl).(*MessageBuilder))
+	}
+	for _, exb := range mb.nestedExtensions {
+		cl.nestedExtensions = append(cl.nestedExtensions, c.copyChild(exb, cl).(*FieldBuilder))
+	}
+	for _, eb := range mb.nestedEnums {
+		cl.nestedEnums = append(cl.nestedEnums, c.copyChild(eb, cl).(*EnumBuilder))
+	}
+	for tag, flb := range mb.fieldTags {
+		cl.fieldTags[tag] = c.clones[flb].(*FieldBuilder)
+	}
+	for name, b := range mb.symbols {
+		cl.symbols[name] = c.clones[b]
+	}
+	return cl
+}
+
+func (c *cloner) copyField(flb *FieldBuilder) *FieldBuilder {
+	cl := &FieldBuilder{
+		baseBuilder:     copyBase(&flb.baseBuilder),
+		number:          flb.number,
+		Label:           flb.Label,
+		Proto3Optional:  flb.Proto3Optional,
+		Default:         flb.Default,
+		JsonName:        flb.JsonName,
+		foreignExtendee: flb.foreignExtendee,
+		localExtendee:   flb.localExtendee,
+	}
+	if flb.Options != nil {
+		cl.Options = proto.Clone(flb.Options).(*descriptorpb.FieldOptions)
+	}
+	if flb.fieldType != nil {
+		ft := *flb.fieldType
+		cl.fieldType = &ft
+	}
+	if flb.msgType != nil {
+		cl.msgType = c.copyChild(flb.msgType, cl).(*MessageBuilder)
+	}
+	c.toFix = append(c.toFix, cl)
+	return cl
+}
+
+func (c *cloner) copyOneOf(oob *OneOfBuilder) *OneOfBuilder {
+	cl := &OneOfBuilder{
+		baseBuilder: copyBase(&oob.baseBuilder),
+		symbols:     make(map[string]*FieldBuilder, len(oob.symbols)),
+	}
+	if oob.Options != nil {
+		cl.Options = proto.Clone(oob.Options).(*descriptorpb.OneofOptions)
+	}
+	for _, flb := range oob.choices {
+		cl.choices = append(cl.choices, c.copyChild(flb, cl).(*FieldBuilder))
+	}
+	for name, flb := range oob.symbols {
+		cl.symbols[name] = c.clones[flb].(*FieldBuilder)
+	}
+	return cl
+}
+
+func (c *cloner) copyEnum(eb *EnumBuilder) *EnumBuilder {
+	cl := &EnumBuilder{
+		baseBuilder:         copyBase(&eb.baseBuilder),
+		ReservedNames:       append([]string(nil), eb.ReservedNames...),
+		EnforceReservations: eb.EnforceReservations,
+		symbols:             make(map[string]*EnumValueBuilder, len(eb.symbols)),
+	}
+	if eb.Options != nil {
+		cl.Options = proto.Clone(eb.Options).(*descriptorpb.EnumOptions)
+	}
+	for _, rr := range eb.ReservedRanges {
+		cl.ReservedRanges = append(cl.ReservedRanges, proto.Clone(rr).(*descriptorpb.EnumDescriptorProto_EnumReservedRange))
+	}
+	for _, evb := range eb.values {
+		cl.values = append(cl.values, c.copyChild(evb, cl).(*EnumValueBuilder))
+	}
+	for name, evb := range eb.symbols {
+		cl.symbols[name] = c.clones[evb].(*EnumValueBuilder)
+	}
+	return cl
+}
+
+func (c *cloner) copyEnumValue(evb *EnumValueBuilder) *EnumValueBuilder {
+	cl := &EnumValueBuilder{
+		baseBuilder: copyBase(&evb.baseBuilder),
+		number:      evb.number,
+		numberSet:   evb.numberSet,
+	}
+	if evb.Options != nil {
+		cl.Options = proto.Clone(evb.Options).(*descriptorpb.EnumValueOptions)
+	}
+	return cl
+}
+
+func (c *cloner) copyService(sb *ServiceBuilder) *ServiceBuilder {
+	cl := &ServiceBuilder{
+		baseBuilder: copyBase(&sb.baseBuilder),
+		symbols:     make(map[string]*MethodBuilder, len(sb.symbols)),
+	}
+	if sb.Options != nil {
+		cl.Options = proto.Clone(sb.Options).(*descriptorpb.ServiceOptions)
+	}
+	for _, mtb := range sb.methods {
+		cl.methods = append(cl.methods, c.copyChild(mtb, cl).(*MethodBuilder))
+	}
+	for name, mtb := range sb.symbols {
+		cl.symbols[name] = c.clones[mtb].(*MethodBuilder)
+	}
+	return cl
+}
+
+func (c *cloner) copyMethod(mtb *MethodBuilder) *MethodBuilder {
+	cl := &MethodBuilder{
+		baseBuilder: copyBase(&mtb.baseBuilder),
+	}
+	if mtb.Options != nil {
+		cl.Options = proto.Clone(mtb.Options).(*descriptorpb.MethodOptions)
+	}
+	if mtb.ReqType != nil {
+		rt := *mtb.ReqType
+		cl.ReqType = &rt
+	}
+	if mtb.RespType != nil {
+		rt := *mtb.RespType
+		cl.RespType = &rt
+	}
+	c.toFix = append(c.toFix, cl)
+	return cl
+}
+
+// fixReferences updates references in all copies so that they refer to other
+// copies where appropriate. This may copy more trees, if the options say that
+// referenced files should be cloned, so it loops until there is nothing left
+// to update.
+func (c *cloner) fixReferences() {
+	for i := 0; i < len(c.toFix); i++ {
+		switch b := c.toFix[i].(type) {
+		case *FileBuilder:
+			if b.explicitDeps == nil {
+				continue
+			}
+			deps := make(map[*FileBuilder]struct{}, len(b.explicitDeps))
+			for dep := range b.explicitDeps {
+				deps[c.ref(dep).(*FileBuilder)] = struct{}{}
+			}
+			b.explicitDeps = deps
+		case *FieldBuilder:
+			if b.localExtendee != nil {
+				b.localExtendee = c.ref(b.localExtendee).(*MessageBuilder)
+			}
+			if b.fieldType != nil {
+				if b.fieldType.localMsgType != nil {
+					b.fieldType.localMsgType = c.ref(b.fieldType.localMsgType).(*MessageBuilder)
+				}
+				if b.fieldType.localEnumType != nil {
+					b.fieldType.localEnumType = c.ref(b.fieldType.localEnumType).(*EnumBuilder)
+				}
+			}
+		case *MethodBuilder:
+			if b.ReqType != nil && b.ReqType.localType != nil {
+				b.ReqType.localType = c.ref(b.ReqType.localType).(*MessageBuilder)
+			}
+			if b.RespType != nil && b.RespType.localType != nil {
+				b.RespType.localType = c.ref(b.RespType.localType).(*MessageBuilder)
+			}
+		}
+	}
+}
+
+// ref returns the builder that a copy should refer to in place of the given
+// original builder.
+func (c *cloner) ref(b Builder) Builder {
+	if cl, ok := c.clones[b]; ok {
+		return cl
+	}
+	if !c.opts.CloneReferencedFiles {
+		return b
+	}
+	root := getRoot(b)
+	if _, ok := c.roots[root]; ok {
+		// in the same tree as a cloned builder, but not itself cloned
+		return b
+	}
+	c.roots[root] = struct{}{}
+	c.copy(root)
+	return c.clones[b]
+}
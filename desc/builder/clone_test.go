@@ -0,0 +1,173 @@
+package builder
+
+import (
+	"testing"
+
+	"github.com/golang/protobuf/proto"
+	"google.golang.org/protobuf/types/descriptorpb"
+
+	"github.com/jhump/protoreflect/desc"
+	"github.com/jhump/protoreflect/internal/testutil"
+)
+
+func TestClone(t *testing.T) {
+	for _, name := range []string{"desc_test1.proto", "desc_test2.proto", "desc_test_complex.proto", "desc_test_options.proto", "desc_test_proto3.proto"} {
+		t.Run(name, func(t *testing.T) {
+			fd, err := desc.LoadFileDescriptor(name)
+			testutil.Ok(t, err)
+			fb, err := FromFile(fd)
+			testutil.Ok(t, err)
+
+			clone := fb.Clone()
+			testutil.Require(t, Equal(fb, clone))
+			testutil.Eq(t, 0, len(Diff(fb, clone)))
+
+			orig, err := fb.Build()
+			testutil.Ok(t, err)
+			cloned, err := clone.Build()
+			testutil.Ok(t, err)
+			testutil.Require(t, proto.Equal(orig.AsFileDescriptorProto(), cloned.AsFileDescriptorProto()))
+		})
+	}
+}
+
+func TestClone_IsIndependent(t *testing.T) {
+	bar := NewMessage("Bar").
+		AddField(NewField("id", FieldTypeInt64()).SetNumber(1))
+	foo := NewMessage("Foo").
+		AddField(NewField("bar", FieldTypeMessage(bar)).SetNumber(1)).
+		AddField(NewMapField("m", FieldTypeString(), FieldTypeMessage(bar)).SetNumber(2)).
+		AddField(NewGroupField(NewMessage("Grp").AddField(NewField("x", FieldTypeInt32()).SetNumber(1))).SetNumber(3)).
+		AddOneOf(NewOneOf("choice").AddChoice(NewField("s", FieldTypeString()).SetNumber(4))).
+		SetOptions(&descriptorpb.MessageOptions{Deprecated: proto.Bool(true)})
+	file := NewFile("foo.proto").SetPackageName("foo").AddMessage(foo).AddMessage(bar)
+
+	clone := file.Clone()
+	cfoo := clone.GetMessage("Foo")
+	cbar := clone.GetMessage("Bar")
+	testutil.Require(t, cfoo != foo)
+	testutil.Eq(t, clone, cfoo.GetParent())
+	// references within the clone refer to the cloned builders
+	testutil.Eq(t, cbar, cfoo.GetField("bar").GetType().localMsgType)
+	testutil.Eq(t, cfoo.GetField("grp").msgType, cfoo.GetField("grp").GetType().localMsgType)
+
+	// changes to the clone are not visible in the original
+	cbar.SetName("Baz")
+	cfoo.GetField("bar").SetNumber(10)
+	cfoo.Options.Deprecated = proto.Bool(false)
+	cfoo.GetOneOf("choice").AddChoice(NewField("t", FieldTypeString()).SetNumber(5))
+	testutil.Eq(t, "foo.Baz", cfoo.GetField("bar").GetType().GetTypeName())
+	testutil.Eq(t, "foo.Bar", foo.GetField("bar").GetType().GetTypeName())
+	testutil.Eq(t, int32(1), foo.GetField("bar").GetNumber())
+	testutil.Require(t, foo.Options.GetDeprecated())
+	testutil.Require(t, foo.GetField("t") == nil)
+	testutil.Require(t, file.GetMessage("Baz") == nil)
+
+	_, err := file.Build()
+	testutil.Ok(t, err)
+	_, err = clone.Build()
+	testutil.Ok(t, err)
+
+	// cloning an element detaches the copy
+	fooClone := foo.Clone()
+	testutil.Eq(t, nil, fooClone.GetParent())
+	testutil.Eq(t, foo, file.GetMessage("Foo"))
+	// a reference outside of the cloned tree refers to the original builder
+	testutil.Eq(t, bar, fooClone.GetField("bar").GetType().localMsgType)
+}
+
+func TestClone_ReferencedFiles(t *testing.T) {
+	bar := NewMessage("Bar")
+	barFile := NewFile("bar.proto").AddMessage(bar)
+	foo := NewMessage("Foo").AddField(NewField("bar", FieldTypeMessage(bar)))
+	fooFile := NewFile("foo.proto").AddMessage(foo).AddDependency(barFile)
+
+	clone := fooFile.Clone()
+	testutil.Eq(t, bar, clone.GetMessage("Foo").GetField("bar").GetType().localMsgType)
+	_, hasDep := clone.explicitDeps[barFile]
+	testutil.Require(t, hasDep)
+
+	clone = CloneOptions{CloneReferencedFiles: true}.Clone(fooFile).(*FileBuilder)
+	cbar := clone.GetMessage("Foo").GetField("bar").GetType().localMsgType
+	testutil.Require(t, cbar != bar)
+	testutil.Require(t, Equal(bar, cbar))
+	cbarFile := cbar.GetFile()
+	testutil.Require(t, cbarFile != barFile)
+	testutil.Eq(t, "bar.proto", cbarFile.GetName())
+	_, hasDep = clone.explicitDeps[cbarFile]
+	testutil.Require(t, hasDep)
+
+	fd, err := clone.Build()
+	testutil.Ok(t, err)
+	testutil.Eq(t, "bar.proto", fd.GetDependencies()[0].GetName())
+}
+
+func TestFileSetClone(t *testing.T) {
+	bar := NewMessage("Bar")
+	barFile := NewFile("bar.proto").SetPackageName("foo").AddMessage(bar)
+	foo := NewMessage("Foo").AddField(NewField("bar", FieldTypeMessage(bar)))
+	fooFile := NewFile("foo.proto").SetPackageName("foo").AddMessage(foo)
+	s, err := NewFileSet(fooFile, barFile)
+	testutil.Ok(t, err)
+
+	clone := s.Clone()
+	files := clone.Files()
+	testutil.Eq(t, 2, len(files))
+	testutil.Require(t, files[0] != fooFile && files[1] != barFile)
+	testutil.Eq(t, files[1].GetMessage("Bar"), files[0].GetMessage("Foo").GetField("bar").GetType().localMsgType)
+
+	// roll back a speculative edit by discarding the clone
+	err = clone.MoveMessage(files[1].GetMessage("Bar"), files[0])
+	testutil.Ok(t, err)
+	testutil.Eq(t, "foo.proto", files[0].GetMessage("Bar").GetFile().GetName())
+	testutil.Eq(t, barFile, bar.GetFile())
+}
+
+func TestDiff(t *testing.T) {
+	en := NewEnum("Kind").
+		AddValue(NewEnumValue("A").SetNumber(0)).
+		AddValue(NewEnumValue("B").SetNumber(1))
+	foo := NewMessage("Foo").
+		AddField(NewField("a", FieldTypeString()).SetNumber(1)).
+		AddField(NewField("b", FieldTypeEnum(en)).SetNumber(2)).
+		AddField(NewField("c", FieldTypeInt32()).SetNumber(3))
+	file := NewFile("foo.proto").SetPackageName("foo").AddMessage(foo).AddEnum(en)
+
+	other := file.Clone()
+	testutil.Eq(t, []Difference(nil), Diff(file, other))
+
+	ofoo := other.GetMessage("Foo")
+	ofoo.GetField("a").SetNumber(4)
+	ofoo.RemoveField("c")
+	ofoo.AddField(NewField("d", FieldTypeBool()).SetNumber(5))
+	other.GetEnum("Kind").RemoveValue("B")
+	other.GetEnum("Kind").SetOptions(&descriptorpb.EnumOptions{AllowAlias: proto.Bool(true)})
+	other.SetPackageName("bar")
+
+	diffs := Diff(file, other)
+	var strs []string
+	for _, d := range diffs {
+		strs = append(strs, d.String())
+	}
+	testutil.Eq(t, []string{
+		"package changed from foo to bar",
+		"Foo.a: number changed from 1 to 4",
+		"Foo.b: type changed from TYPE_ENUM foo.Kind to TYPE_ENUM bar.Kind",
+		"Foo.c: field removed",
+		"Foo.d: field added",
+		"Kind: options changed",
+		"Kind.B: enum value removed",
+	}, strs)
+	testutil.Require(t, !Equal(file, other))
+
+	// order matters, too
+	other = file.Clone()
+	ofoo = other.GetMessage("Foo")
+	a := ofoo.GetField("a")
+	ofoo.RemoveField("a")
+	ofoo.AddField(a)
+	testutil.Eq(t, []Difference{{Element: "Foo", Description: "order of elements changed"}}, Diff(file, other))
+
+	// different kinds of builders
+	testutil.Eq(t, []Difference{{Description: "changed from message to enum"}}, Diff(foo, en))
+}
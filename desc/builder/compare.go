@@ -0,0 +1,291 @@
+package builder
+
+import (
+	"fmt"
+	"reflect"
+	"sort"
+	"strings"
+
+	"google.golang.org/protobuf/proto"
+)
+
+// Difference describes one way in which two builders differ. See Diff.
+type Difference struct {
+	// The name of the element that differs, relative to the builders that
+	// were compared. It is empty if the difference is in the compared
+	// builders themselves. Otherwise, it is a dot-separated path of element
+	// names, such as "Foo.bar" for field "bar" of message "Foo" when two files
+	// are compared.
+	Element string
+	// A description of the difference, such as "field added" or "number
+	// changed from 1 to 2".
+	Description string
+}
+
+// String returns a human-readable description of the difference.
+func (d Difference) String() string {
+	if d.Element == "" {
+		return d.Description
+	}
+	return d.Element + ": " + d.Description
+}
+
+// Diff compares the two given builders, and all of their descendants, and
+// returns the differences between them, describing how to get from a to b. An
+// empty result means that the builders are structurally equal: building them
+// would produce equivalent descriptors.
+//
+// Descendants are matched by name, so renaming an element shows up as one
+// element being removed and another being added. References to other types,
+// such as the type of a field, are compared by the fully-qualified name of
+// the referenced type, so a reference to a builder is equal to a reference to
+// a descriptor with the same name. A file's explicit dependencies are compared
+// by file name.
+func Diff(a, b Builder) []Difference {
+	var d differ
+	d.diff("", a, b)
+	return d.diffs
+}
+
+// Equal returns true if the two given builders are structurally equal. This is
+// the same as checking that Diff returns no differences, but is more efficient
+// since it stops at the first difference.
+func Equal(a, b Builder) bool {
+	d := differ{stopAtFirst: true}
+	d.diff("", a, b)
+	return len(d.diffs) == 0
+}
+
+type differ struct {
+	stopAtFirst bool
+	diffs       []Difference
+}
+
+func (d *differ) done() bool {
+	return d.stopAtFirst && len(d.diffs) > 0
+}
+
+func (d *differ) add(element, format string, args ...interface{}) {
+	if d.done() {
+		return
+	}
+	d.diffs = append(d.diffs, Difference{Element: element, Description: fmt.Sprintf(format, args...)})
+}
+
+func (d *differ) check(element, what string, a, b interface{}) {
+	if !reflect.DeepEqual(a, b) {
+		d.add(element, "%s changed from %v to %v", what, a, b)
+	}
+}
+
+func childElement(element, name string) string {
+	if element == "" {
+		return name
+	}
+	return element + "." + name
+}
+
+func kindOf(b Builder) string {
+	switch b := b.(type) {
+	case *FileBuilder:
+		return "file"
+	case *MessageBuilder:
+		return "message"
+	case *FieldBuilder:
+		if b.IsExtension() {
+			return "extension"
+		}
+		return "field"
+	case *OneOfBuilder:
+		return "one-of"
+	case *EnumBuilder:
+		return "enum"
+	case *EnumValueBuilder:
+		return "enum value"
+	case *ServiceBuilder:
+		return "service"
+	case *MethodBuilder:
+		return "method"
+	default:
+		return fmt.Sprintf("%T", b)
+	}
+}
+
+func (d *differ) diff(element string, a, b Builder) {
+	if d.done() {
+		return
+	}
+	if ka, kb := kindOf(a), kindOf(b); ka != kb {
+		d.add(element, "changed from %s to %s", ka, kb)
+		return
+	}
+	if element == "" {
+		d.check(element, "name", a.GetName(), b.GetName())
+	}
+	d.check(element, "comments", normalizeComments(*a.GetComments()), normalizeComments(*b.GetComments()))
+	if oa, ok := a.(optionsBuilder); ok {
+		ob := b.(optionsBuilder)
+		if !optionsEqual(oa.getOptions(), ob.getOptions()) {
+			d.add(element, "options changed")
+		}
+		pa, pb := oa.getCustomOptions().pending, ob.getCustomOptions().pending
+		if (len(pa) > 0 || len(pb) > 0) && !reflect.DeepEqual(pa, pb) {
+			d.add(element, "unresolved custom options changed")
+		}
+	}
+
+	switch a := a.(type) {
+	case *FileBuilder:
+		d.diffFile(element, a, b.(*FileBuilder))
+	case *MessageBuilder:
+		d.diffMessage(element, a, b.(*MessageBuilder))
+	case *FieldBuilder:
+		d.diffField(element, a, b.(*FieldBuilder))
+	case *EnumBuilder:
+		d.diffEnum(element, a, b.(*EnumBuilder))
+	case *EnumValueBuilder:
+		b := b.(*EnumValueBuilder)
+		d.check(element, "number", a.number, b.number)
+		d.check(element, "whether number is set", a.numberSet, b.numberSet)
+	case *MethodBuilder:
+		b := b.(*MethodBuilder)
+		d.check(element, "request type", rpcTypeString(a.ReqType), rpcTypeString(b.ReqType))
+		d.check(element, "response type", rpcTypeString(a.RespType), rpcTypeString(b.RespType))
+	}
+
+	d.diffChildren(element, a.GetChildren(), b.GetChildren())
+}
+
+func (d *differ) diffFile(element string, a, b *FileBuilder) {
+	d.check(element, "package", a.Package, b.Package)
+	d.check(element, "proto3", a.IsProto3, b.IsProto3)
+	d.check(element, "edition", a.Edition, b.Edition)
+	d.check(element, "syntax comments", normalizeComments(a.SyntaxComments), normalizeComments(b.SyntaxComments))
+	d.check(element, "package comments", normalizeComments(a.PackageComments), normalizeComments(b.PackageComments))
+	d.check(element, "explicit dependencies", explicitDepNames(a), explicitDepNames(b))
+}
+
+func (d *differ) diffMessage(element string, a, b *MessageBuilder) {
+	d.check(element, "tag strategy", a.TagStrategy, b.TagStrategy)
+	d.check(element, "reserved names", a.ReservedNames, b.ReservedNames)
+	if !protoSlicesEqual(a.ReservedRanges, b.ReservedRanges) {
+		d.add(element, "reserved ranges changed")
+	}
+	if !protoSlicesEqual(a.ExtensionRanges, b.ExtensionRanges) {
+		d.add(element, "extension ranges changed")
+	}
+}
+
+func (d *differ) diffField(element string, a, b *FieldBuilder) {
+	d.check(element, "number", a.number, b.number)
+	d.check(element, "label", a.Label, b.Label)
+	d.check(element, "proto3 optional", a.Proto3Optional, b.Proto3Optional)
+	d.check(element, "default", a.Default, b.Default)
+	d.check(element, "JSON name", a.JsonName, b.JsonName)
+	d.check(element, "type", fieldTypeString(a.fieldType), fieldTypeString(b.fieldType))
+	d.check(element, "extendee", a.GetExtendeeTypeName(), b.GetExtendeeTypeName())
+}
+
+func (d *differ) diffEnum(element string, a, b *EnumBuilder) {
+	d.check(element, "reserved names", a.ReservedNames, b.ReservedNames)
+	if !protoSlicesEqual(a.ReservedRanges, b.ReservedRanges) {
+		d.add(element, "reserved ranges changed")
+	}
+}
+
+// diffChildren matches the given children by name and compares them. It also
+// checks that the children that are present in both are in the same order.
+func (d *differ) diffChildren(element string, as, bs []Builder) {
+	byName := make(map[string]Builder, len(bs))
+	for _, b := range bs {
+		byName[b.GetName()] = b
+	}
+	inA := make(map[string]struct{}, len(as))
+	for _, a := range as {
+		inA[a.GetName()] = struct{}{}
+	}
+	var common []string
+	for _, a := range as {
+		child := childElement(element, a.GetName())
+		b, ok := byName[a.GetName()]
+		if !ok {
+			d.add(child, "%s removed", kindOf(a))
+			continue
+		}
+		common = append(common, a.GetName())
+		d.diff(child, a, b)
+	}
+	var commonInB []string
+	for _, b := range bs {
+		if _, ok := inA[b.GetName()]; !ok {
+			d.add(childElement(element, b.GetName()), "%s added", kindOf(b))
+			continue
+		}
+		commonInB = append(commonInB, b.GetName())
+	}
+	if !reflect.DeepEqual(common, commonInB) {
+		d.add(element, "order of elements changed")
+	}
+}
+
+func normalizeComments(c Comments) Comments {
+	if len(c.LeadingDetachedComments) == 0 {
+		c.LeadingDetachedComments = nil
+	}
+	return c
+}
+
+func optionsEqual(a, b proto.Message) bool {
+	if isNilOptions(a) {
+		a = a.ProtoReflect().New().Interface()
+	}
+	if isNilOptions(b) {
+		b = b.ProtoReflect().New().Interface()
+	}
+	return proto.Equal(a, b)
+}
+
+func protoSlicesEqual(a, b interface{}) bool {
+	ra, rb := reflect.ValueOf(a), reflect.ValueOf(b)
+	if ra.Len() != rb.Len() {
+		return false
+	}
+	for i := 0; i < ra.Len(); i++ {
+		if !proto.Equal(ra.Index(i).Interface().(proto.Message), rb.Index(i).Interface().(proto.Message)) {
+			return false
+		}
+	}
+	return true
+}
+
+func fieldTypeString(ft *FieldType) string {
+	if ft == nil {
+		return "<nil>"
+	}
+	if tn := ft.GetTypeName(); tn != "" {
+		return fmt.Sprintf("%v %s", ft.fieldType, tn)
+	}
+	return ft.fieldType.String()
+}
+
+func rpcTypeString(rt *RpcType) string {
+	if rt == nil {
+		return "<nil>"
+	}
+	if rt.IsStream {
+		return "stream " + rt.GetTypeName()
+	}
+	return rt.GetTypeName()
+}
+
+func explicitDepNames(fb *FileBuilder) string {
+	var names []string
+	for fd := range fb.explicitImports {
+		names = append(names, fd.GetName())
+	}
+	for dep := range fb.explicitDeps {
+		names = append(names, dep.GetName())
+	}
+	sort.Strings(names)
+	return "[" + strings.Join(names, ", ") + "]"
+}
@@ -25,6 +25,12 @@
 // nil values for required fields (such as field types, RPC method types, and
 // extendee type for extensions).
 //
+// A file builder created with FromFile, when built, produces a descriptor that
+// is equivalent to the original but may differ in minor ways, such as the order
+// of imports and how much source code info is present. FromFileOptions can be
+// used instead to create builders that retain these details, so that building
+// an unmodified file builder produces a descriptor identical to the original.
+//
 // # Auto-Assigning Tag Numbers and File Names
 //
 // The factory function for fields does not accept a tag number. This is because
@@ -36,7 +42,17 @@
 // one-ofs, fields are assigned in the order their one-of was added to a message
 // builder. It is fine if some fields have tags and some do not. The assigned
 // tags will start at one and proceed from there but will not conflict with tags
-// that were explicitly assigned to fields.
+// that were explicitly assigned to fields, nor will they fall into the message's
+// reserved or extension ranges.
+//
+// The way tags are assigned can be changed by setting a message builder's
+// TagStrategy. For example, TagStrategyInfrequent leaves tags 1-15 (which are
+// encoded in a single byte) for fields that are added later, and
+// TagStrategyHashName derives tags from field names so that they do not depend
+// on the order in which fields were added. Tags can also be allocated eagerly
+// using MessageBuilder.AllocateTag or MessageBuilder.AddFieldWithStrategy. The
+// tags that are still free can be queried with MessageBuilder.IsTagAvailable and
+// MessageBuilder.AvailableTagRanges.
 //
 // Similarly, when constructing a file builder, a name is accepted but can be
 // blank. A blank name means that the file will be given a generated, unique
@@ -123,6 +139,74 @@
 // imports the other). And the same would be true if one or both files were
 // explicitly assigned to a file, but not both to the same file.
 //
+// # Custom Options
+//
+// Custom options can be set directly in a builder's Options field, using
+// generated extensions. But when an option is only known via a descriptor,
+// the SetOption methods can be used instead: they accept the extension's
+// *desc.FieldDescriptor and a value, such as a Go scalar or a
+// *dynamic.Message, that is validated against the extension's type. When the
+// builder is built, the file that defines the extension is added as a
+// dependency so the option is interpreted.
+//
+// Options can also be set by their fully-qualified name, via SetOptionByName.
+// If the extension for a named option cannot be found when it is set, it is
+// looked up again when the builder is built, which includes searching the
+// registry in BuilderOptions.Extensions. The resolved option is set only in
+// the resulting descriptor; the builder is not modified, so the option is
+// looked up anew each time the builder is built.
+//
+// # Messages From Go Types
+//
+// FromGoType and GoTypeMapper create message builders that correspond to Go
+// struct types, mapping each exported struct field to a message field. Struct
+// tags can control the names, numbers, and JSON names of the resulting fields.
+// Values of the struct types can then be converted to and from dynamic
+// messages of the resulting types using dynamic.GoValueMapper.
+//
+// # Generating Code
+//
+// The buildergen sub-package generates Go source code that uses the factory
+// functions and methods in this package to re-create a given file. This can
+// be used to turn a proto source file into a starting point for code that
+// constructs or manipulates descriptors programmatically.
+//
+// # Refactoring Across Files
+//
+// Since builders refer to one another directly, renaming or moving a message
+// or enum builder automatically updates all references to it. However, when
+// builders are created from existing descriptors (via FromFile), references to
+// elements in other files are references to descriptors, not builders. A
+// FileSet links a group of related file builders so that such references are
+// replaced with references to the corresponding builders. Its methods can then
+// move messages and enums between files and parents, and change a file's
+// package, while keeping type references and file dependencies intact.
+//
+// Within a single message, ExtractFields moves a group of fields into a new
+// nested message, replacing them with a single field of the new type.
+//
+// # Cloning and Comparing
+//
+// Every builder has a Clone method that returns a deep copy of it and all of
+// its descendants, so that speculative changes can be made to the copy (or
+// the original kept as a copy to roll back to). By default, references from
+// the copy to builders outside of the copied tree still refer to the original
+// builders; CloneOptions can be used to clone referenced files, too. A FileSet
+// can also be cloned as a whole.
+//
+// Two builders can be compared, without building either of them, using Equal
+// or Diff. The latter describes each difference, such as a field whose number
+// changed or an element that was added or removed.
+//
+// # Patches
+//
+// A Patch is a list of edits, such as adding a field, renaming an enum value,
+// or setting an option, to apply to a file builder. Elements are identified by
+// their fully-qualified names, and new elements are described using descriptor
+// protos, so patches can be stored and exchanged as JSON or in the protobuf
+// text format (see PatchDescriptor). A patch is applied atomically: if any of
+// its edits cannot be applied, the file builder is left unchanged.
+//
 // # Validations and Caveats
 //
 // Descriptors that are attained from a builder do not necessarily represent a
@@ -174,6 +258,15 @@
 //     marked as reserved.
 //  14. Extension ranges and reserved ranges must not overlap.
 //
+// To keep the name and number of a removed field or enum value from being
+// accidentally re-used later, which would break wire compatibility, use one of
+// the removal methods that also reserves them, like
+// MessageBuilder.RemoveFieldAndReserve or EnumBuilder.RemoveValueAndReserve.
+// By default, reserved names and numbers are only checked when the descriptor
+// is built. But if a message or enum builder's EnforceReservations field is
+// set, they are checked as soon as a field or enum value is added, renamed, or
+// renumbered, and as soon as a reservation is added.
+//
 // Validation rules that are *not* enforced by builders, and thus would be
 // allowed and result in illegal constructs, include the following:
 //
@@ -181,4 +274,15 @@
 //     if multiple files are defined in the same package.
 //  2. Multiple extensions for the same message cannot re-use tag numbers, even
 //     across multiple files.
+//
+// # Reporting All Errors
+//
+// By default, building stops at the first problem found. Code generators and
+// other tools that want to report every problem at once can instead set the
+// CollectAllErrors field of BuilderOptions. In that mode, all checks are run
+// across the whole tree of builders, including the trees of other files that
+// it references, and the returned error is a BuildErrors value. Each entry
+// identifies the offending element by its fully-qualified name and classifies
+// the problem with an ErrorCategory, such as CategoryNameConflict or
+// CategoryInvalidTag.
 package builder
@@ -21,6 +21,11 @@ type EnumBuilder struct {
 	ReservedRanges []*descriptorpb.EnumDescriptorProto_EnumReservedRange
 	ReservedNames  []string
 
+	// If true, adding a value, or changing a value's name or number, such
+	// that it uses a reserved name or number is rejected immediately.
+	// Otherwise, such conflicts are only reported when the enum is built.
+	EnforceReservations bool
+
 	values  []*EnumValueBuilder
 	symbols map[string]*EnumValueBuilder
 }
@@ -129,6 +134,9 @@ func (eb *EnumBuilder) renamedChild(b Builder, oldName string) error {
 		return nil
 	}
 
+	if eb.EnforceReservations && eb.isReservedName(b.GetName()) {
+		return fmt.Errorf("enum %s has reserved value name %q", GetFullyQualifiedName(eb), b.GetName())
+	}
 	if err := eb.addSymbol(b.(*EnumValueBuilder)); err != nil {
 		return err
 	}
@@ -151,6 +159,104 @@ func (eb *EnumBuilder) SetOptions(options *descriptorpb.EnumOptions) *EnumBuilde
 	return eb
 }
 
+// SetFeatures sets the feature overrides in the options for this enum and
+// returns the enum, for method chaining.
+func (eb *EnumBuilder) SetFeatures(features *descriptorpb.FeatureSet) *EnumBuilder {
+	var options *descriptorpb.EnumOptions
+	if eb.Options != nil {
+		options = proto.Clone(eb.Options).(*descriptorpb.EnumOptions)
+	} else {
+		options = &descriptorpb.EnumOptions{}
+	}
+	options.Features = features
+	eb.Options = options
+	return eb
+}
+
+// SetOption sets the custom option described by the given extension to the
+// given value and returns the enum, for method chaining. The value may be any
+// value accepted by dynamic.Message.TrySetField for the extension, such as a Go
+// scalar or, for message types, a *dynamic.Message. If the value is not valid,
+// this method panics. The existing options, if any, are copied so the change
+// is not visible to other builders or descriptors that share them. When the
+// enum is built, the file that defines the extension is added as a
+// dependency.
+func (eb *EnumBuilder) SetOption(extd *desc.FieldDescriptor, val interface{}) *EnumBuilder {
+	if err := eb.TrySetOption(extd, val); err != nil {
+		panic(err)
+	}
+	return eb
+}
+
+// TrySetOption sets the custom option described by the given extension to the
+// given value, returning an error if the extension does not extend
+// EnumOptions or if the value is not valid for it.
+func (eb *EnumBuilder) TrySetOption(extd *desc.FieldDescriptor, val interface{}) error {
+	return setOption(eb, extd, val)
+}
+
+// SetOptionByName sets the custom option with the given fully-qualified name
+// to the given value and returns the enum, for method chaining. If an error
+// prevents the option from being set, this method panics.
+//
+// See TrySetOptionByName for how the option's extension is found.
+func (eb *EnumBuilder) SetOptionByName(name string, val interface{}) *EnumBuilder {
+	if err := eb.TrySetOptionByName(name, val); err != nil {
+		panic(err)
+	}
+	return eb
+}
+
+// TrySetOptionByName sets the custom option with the given fully-qualified name
+// to the given value, returning any error that prevents the option from being
+// set. The extension for the option is found among options already set on
+// this enum, the explicit imports of its file, the dependencies of the file
+// from which it was created (if created with FromFile), and extensions linked
+// into the current program. If the extension cannot be found, the value is
+// retained and the option is set when the enum is built, at which point the
+// extension may also be found in BuilderOptions.Extensions or in any other
+// file on which the enum's file depends. An error is reported then if the
+// extension still cannot be found or the value is not valid for it.
+func (eb *EnumBuilder) TrySetOptionByName(name string, val interface{}) error {
+	return setOptionByName(eb, name, val)
+}
+
+// GetOption returns the value of the custom option described by the given
+// extension. If the option is not set, nil is returned. Values for message
+// types are returned as *dynamic.Message.
+func (eb *EnumBuilder) GetOption(extd *desc.FieldDescriptor) (interface{}, error) {
+	return getOption(eb, extd)
+}
+
+// GetOptionByName returns the value of the custom option with the given
+// fully-qualified name. If the option is not set, nil is returned. An error is
+// returned if the option's extension cannot be found.
+func (eb *EnumBuilder) GetOptionByName(name string) (interface{}, error) {
+	return getOptionByName(eb, name)
+}
+
+// ClearOption removes the custom option described by the given extension and
+// returns the enum, for method chaining.
+func (eb *EnumBuilder) ClearOption(extd *desc.FieldDescriptor) *EnumBuilder {
+	clearOption(eb, extd)
+	return eb
+}
+
+// ClearOptionByName removes the custom option with the given fully-qualified
+// name and returns the enum, for method chaining.
+func (eb *EnumBuilder) ClearOptionByName(name string) *EnumBuilder {
+	clearOptionByName(eb, name)
+	return eb
+}
+
+func (eb *EnumBuilder) getOptions() proto.Message {
+	return eb.Options
+}
+
+func (eb *EnumBuilder) setOptions(opts proto.Message) {
+	eb.Options = opts.(*descriptorpb.EnumOptions)
+}
+
 // GetValue returns the enum value with the given name. If no such value exists
 // in the enum, nil is returned.
 func (eb *EnumBuilder) GetValue(name string) *EnumValueBuilder {
@@ -175,6 +281,90 @@ func (eb *EnumBuilder) TryRemoveValue(name string) bool {
 	return false
 }
 
+// RemoveValueAndReserve removes the enum value with the given name and then
+// reserves the value's name and number, so that they cannot accidentally be
+// re-used by another value. If no such value exists in the enum, this is a
+// no-op. This returns the enum builder, for method chaining.
+func (eb *EnumBuilder) RemoveValueAndReserve(name string) *EnumBuilder {
+	eb.TryRemoveValueAndReserve(name)
+	return eb
+}
+
+// TryRemoveValueAndReserve removes the enum value with the given name and
+// returns false if the enum has no such value. Like RemoveValueAndReserve, the
+// removed value's name and number are reserved. The number is added to the
+// enum's reserved ranges, merging it with any adjacent or overlapping range.
+// If the value has no number (because it would be auto-assigned when built),
+// only its name is reserved.
+func (eb *EnumBuilder) TryRemoveValueAndReserve(name string) bool {
+	evb, ok := eb.symbols[name]
+	if !ok {
+		return false
+	}
+	eb.removeChild(evb)
+	if !eb.isReservedName(name) {
+		eb.ReservedNames = append(eb.ReservedNames, name)
+	}
+	if evb.numberSet && !eb.isReservedNumber(evb.number) {
+		eb.ReservedRanges = addReservedEnumNumber(eb.ReservedRanges, evb.number)
+	}
+	return true
+}
+
+func (eb *EnumBuilder) isReservedName(name string) bool {
+	for _, n := range eb.ReservedNames {
+		if n == name {
+			return true
+		}
+	}
+	return false
+}
+
+func (eb *EnumBuilder) isReservedNumber(number int32) bool {
+	for _, rr := range eb.ReservedRanges {
+		if number >= rr.GetStart() && number <= rr.GetEnd() {
+			return true
+		}
+	}
+	return false
+}
+
+// addReservedEnumNumber adds the given number to the given reserved ranges,
+// merging it with any ranges that it overlaps or abuts. Unlike message reserved
+// ranges, the end of an enum reserved range is inclusive.
+func addReservedEnumNumber(ranges []*descriptorpb.EnumDescriptorProto_EnumReservedRange, number int32) []*descriptorpb.EnumDescriptorProto_EnumReservedRange {
+	// use int64 so that abutting ranges can be detected without overflow
+	start, end := int64(number), int64(number)
+	var merged []*descriptorpb.EnumDescriptorProto_EnumReservedRange
+	pos := -1
+	for _, rr := range ranges {
+		if int64(rr.GetEnd())+1 < start || int64(rr.GetStart())-1 > end {
+			merged = append(merged, rr)
+			continue
+		}
+		if pos < 0 {
+			pos = len(merged)
+		}
+		if int64(rr.GetStart()) < start {
+			start = int64(rr.GetStart())
+		}
+		if int64(rr.GetEnd()) > end {
+			end = int64(rr.GetEnd())
+		}
+	}
+	rr := &descriptorpb.EnumDescriptorProto_EnumReservedRange{
+		Start: proto.Int32(int32(start)),
+		End:   proto.Int32(int32(end)),
+	}
+	if pos < 0 {
+		return append(merged, rr)
+	}
+	merged = append(merged, nil)
+	copy(merged[pos+1:], merged[pos:])
+	merged[pos] = rr
+	return merged
+}
+
 // AddValue adds the given enum value to this enum. If an error prevents the
 // value from being added, this method panics. This returns the enum builder,
 // for method chaining.
@@ -189,6 +379,12 @@ func (eb *EnumBuilder) AddValue(evb *EnumValueBuilder) *EnumBuilder {
 // prevents the value from being added (such as a name collision with another
 // value already added to the enum).
 func (eb *EnumBuilder) TryAddValue(evb *EnumValueBuilder) error {
+	if eb.EnforceReservations && eb.isReservedName(evb.GetName()) {
+		return fmt.Errorf("enum %s has reserved value name %q", GetFullyQualifiedName(eb), evb.GetName())
+	}
+	if eb.EnforceReservations && evb.numberSet && eb.isReservedNumber(evb.number) {
+		return fmt.Errorf("enum %s has reserved number %d, so it cannot be used by value %s", GetFullyQualifiedName(eb), evb.number, evb.GetName())
+	}
 	if err := eb.addSymbol(evb); err != nil {
 		return err
 	}
@@ -200,14 +396,34 @@ func (eb *EnumBuilder) TryAddValue(evb *EnumValueBuilder) error {
 
 // AddReservedRange adds the given reserved range to this message. The range is
 // inclusive of both the start and end, just like defining a range in proto IDL
-// source. This returns the message, for method chaining.
+// source. If an error prevents the range from being added (see
+// TryAddReservedRange), this method panics. This returns the message, for
+// method chaining.
 func (eb *EnumBuilder) AddReservedRange(start, end int32) *EnumBuilder {
+	if err := eb.TryAddReservedRange(start, end); err != nil {
+		panic(err)
+	}
+	return eb
+}
+
+// TryAddReservedRange adds the given reserved range to this enum, which is
+// inclusive of both the start and end. If the enum enforces reservations (see
+// EnforceReservations), an error is returned if a value in the enum already
+// uses a number in the range.
+func (eb *EnumBuilder) TryAddReservedRange(start, end int32) error {
+	if eb.EnforceReservations {
+		for _, evb := range eb.values {
+			if evb.numberSet && evb.number >= start && evb.number <= end {
+				return fmt.Errorf("enum %s cannot reserve number %d; it is used by value %s", GetFullyQualifiedName(eb), evb.number, evb.GetName())
+			}
+		}
+	}
 	rr := &descriptorpb.EnumDescriptorProto_EnumReservedRange{
 		Start: proto.Int32(start),
 		End:   proto.Int32(end),
 	}
 	eb.ReservedRanges = append(eb.ReservedRanges, rr)
-	return eb
+	return nil
 }
 
 // SetReservedRanges replaces all of this enum's reserved ranges with the
@@ -218,12 +434,29 @@ func (eb *EnumBuilder) SetReservedRanges(ranges []*descriptorpb.EnumDescriptorPr
 }
 
 // AddReservedName adds the given name to the list of reserved value names for
-// this enum. This returns the enum, for method chaining.
+// this enum. If an error prevents the name from being added (see
+// TryAddReservedName), this method panics. This returns the enum, for method
+// chaining.
 func (eb *EnumBuilder) AddReservedName(name string) *EnumBuilder {
-	eb.ReservedNames = append(eb.ReservedNames, name)
+	if err := eb.TryAddReservedName(name); err != nil {
+		panic(err)
+	}
 	return eb
 }
 
+// TryAddReservedName adds the given name to the list of reserved value names
+// for this enum. If the enum enforces reservations (see EnforceReservations),
+// an error is returned if a value in the enum already uses the name.
+func (eb *EnumBuilder) TryAddReservedName(name string) error {
+	if eb.EnforceReservations {
+		if _, ok := eb.symbols[name]; ok {
+			return fmt.Errorf("enum %s cannot reserve name %q; it is used by a value", GetFullyQualifiedName(eb), name)
+		}
+	}
+	eb.ReservedNames = append(eb.ReservedNames, name)
+	return nil
+}
+
 // SetReservedNames replaces all of this enum's reserved value names with the
 // given slice of names. This returns the enum, for method chaining.
 func (eb *EnumBuilder) SetReservedNames(names []string) *EnumBuilder {
@@ -231,8 +464,8 @@ func (eb *EnumBuilder) SetReservedNames(names []string) *EnumBuilder {
 	return eb
 }
 
-func (eb *EnumBuilder) buildProto(path []int32, sourceInfo *descriptorpb.SourceCodeInfo) (*descriptorpb.EnumDescriptorProto, error) {
-	addCommentsTo(sourceInfo, path, &eb.comments)
+func (eb *EnumBuilder) buildProto(path []int32, sourceInfo *sourceInfoBuilder, rep *errorReporter) (*descriptorpb.EnumDescriptorProto, error) {
+	sourceInfo.addElement(path, &eb.comments, eb.lossless)
 
 	var needNumbersAssigned []*descriptorpb.EnumValueDescriptorProto
 	values := make([]*descriptorpb.EnumValueDescriptorProto, 0, len(eb.values))
@@ -408,6 +641,104 @@ func (evb *EnumValueBuilder) SetOptions(options *descriptorpb.EnumValueOptions)
 	return evb
 }
 
+// SetFeatures sets the feature overrides in the options for this enum value and
+// returns the enum value, for method chaining.
+func (evb *EnumValueBuilder) SetFeatures(features *descriptorpb.FeatureSet) *EnumValueBuilder {
+	var options *descriptorpb.EnumValueOptions
+	if evb.Options != nil {
+		options = proto.Clone(evb.Options).(*descriptorpb.EnumValueOptions)
+	} else {
+		options = &descriptorpb.EnumValueOptions{}
+	}
+	options.Features = features
+	evb.Options = options
+	return evb
+}
+
+// SetOption sets the custom option described by the given extension to the
+// given value and returns the enum value, for method chaining. The value may be any
+// value accepted by dynamic.Message.TrySetField for the extension, such as a Go
+// scalar or, for message types, a *dynamic.Message. If the value is not valid,
+// this method panics. The existing options, if any, are copied so the change
+// is not visible to other builders or descriptors that share them. When the
+// enum value is built, the file that defines the extension is added as a
+// dependency.
+func (evb *EnumValueBuilder) SetOption(extd *desc.FieldDescriptor, val interface{}) *EnumValueBuilder {
+	if err := evb.TrySetOption(extd, val); err != nil {
+		panic(err)
+	}
+	return evb
+}
+
+// TrySetOption sets the custom option described by the given extension to the
+// given value, returning an error if the extension does not extend
+// EnumValueOptions or if the value is not valid for it.
+func (evb *EnumValueBuilder) TrySetOption(extd *desc.FieldDescriptor, val interface{}) error {
+	return setOption(evb, extd, val)
+}
+
+// SetOptionByName sets the custom option with the given fully-qualified name
+// to the given value and returns the enum value, for method chaining. If an error
+// prevents the option from being set, this method panics.
+//
+// See TrySetOptionByName for how the option's extension is found.
+func (evb *EnumValueBuilder) SetOptionByName(name string, val interface{}) *EnumValueBuilder {
+	if err := evb.TrySetOptionByName(name, val); err != nil {
+		panic(err)
+	}
+	return evb
+}
+
+// TrySetOptionByName sets the custom option with the given fully-qualified name
+// to the given value, returning any error that prevents the option from being
+// set. The extension for the option is found among options already set on
+// this enum value, the explicit imports of its file, the dependencies of the file
+// from which it was created (if created with FromFile), and extensions linked
+// into the current program. If the extension cannot be found, the value is
+// retained and the option is set when the enum value is built, at which point the
+// extension may also be found in BuilderOptions.Extensions or in any other
+// file on which the enum value's file depends. An error is reported then if the
+// extension still cannot be found or the value is not valid for it.
+func (evb *EnumValueBuilder) TrySetOptionByName(name string, val interface{}) error {
+	return setOptionByName(evb, name, val)
+}
+
+// GetOption returns the value of the custom option described by the given
+// extension. If the option is not set, nil is returned. Values for message
+// types are returned as *dynamic.Message.
+func (evb *EnumValueBuilder) GetOption(extd *desc.FieldDescriptor) (interface{}, error) {
+	return getOption(evb, extd)
+}
+
+// GetOptionByName returns the value of the custom option with the given
+// fully-qualified name. If the option is not set, nil is returned. An error is
+// returned if the option's extension cannot be found.
+func (evb *EnumValueBuilder) GetOptionByName(name string) (interface{}, error) {
+	return getOptionByName(evb, name)
+}
+
+// ClearOption removes the custom option described by the given extension and
+// returns the enum value, for method chaining.
+func (evb *EnumValueBuilder) ClearOption(extd *desc.FieldDescriptor) *EnumValueBuilder {
+	clearOption(evb, extd)
+	return evb
+}
+
+// ClearOptionByName removes the custom option with the given fully-qualified
+// name and returns the enum value, for method chaining.
+func (evb *EnumValueBuilder) ClearOptionByName(name string) *EnumValueBuilder {
+	clearOptionByName(evb, name)
+	return evb
+}
+
+func (evb *EnumValueBuilder) getOptions() proto.Message {
+	return evb.Options
+}
+
+func (evb *EnumValueBuilder) setOptions(opts proto.Message) {
+	evb.Options = opts.(*descriptorpb.EnumValueOptions)
+}
+
 // GetNumber returns the enum value's numeric value. If the number has not been
 // set this returns zero.
 func (evb *EnumValueBuilder) GetNumber() int32 {
@@ -431,15 +762,28 @@ func (evb *EnumValueBuilder) ClearNumber() *EnumValueBuilder {
 }
 
 // SetNumber changes the numeric value for this enum value and then returns the
-// enum value, for method chaining.
+// enum value, for method chaining. Unlike TrySetNumber, this does not check
+// the number against the enum's reservations.
 func (evb *EnumValueBuilder) SetNumber(number int32) *EnumValueBuilder {
 	evb.number = number
 	evb.numberSet = true
 	return evb
 }
 
-func (evb *EnumValueBuilder) buildProto(path []int32, sourceInfo *descriptorpb.SourceCodeInfo) (*descriptorpb.EnumValueDescriptorProto, error) {
-	addCommentsTo(sourceInfo, path, &evb.comments)
+// TrySetNumber changes the numeric value for this enum value. It will return an
+// error if the enum to which this value belongs enforces reservations (see
+// EnumBuilder.EnforceReservations) and has reserved the given number.
+func (evb *EnumValueBuilder) TrySetNumber(number int32) error {
+	if eb, ok := evb.parent.(*EnumBuilder); ok && eb.EnforceReservations && eb.isReservedNumber(number) {
+		return fmt.Errorf("enum %s has reserved number %d, so it cannot be used by value %s", GetFullyQualifiedName(eb), number, evb.GetName())
+	}
+	evb.number = number
+	evb.numberSet = true
+	return nil
+}
+
+func (evb *EnumValueBuilder) buildProto(path []int32, sourceInfo *sourceInfoBuilder) (*descriptorpb.EnumValueDescriptorProto, error) {
+	sourceInfo.addElement(path, &evb.comments, evb.lossless)
 
 	return &descriptorpb.EnumValueDescriptorProto{
 		Name:    proto.String(evb.name),
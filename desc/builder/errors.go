@@ -0,0 +1,330 @@
+package builder
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"reflect"
+
+	"google.golang.org/protobuf/types/descriptorpb"
+
+	"github.com/jhump/protoreflect/desc"
+)
+
+// ErrorCategory classifies a problem found while building descriptors.
+type ErrorCategory int
+
+const (
+	// CategoryOther is used for problems that do not fit into any of the
+	// other categories, such as errors reported by the final validation of
+	// a built file descriptor.
+	CategoryOther ErrorCategory = iota
+	// CategoryNameConflict indicates that an element's name collides with
+	// another element or with a reserved name.
+	CategoryNameConflict
+	// CategoryInvalidTag indicates that a field tag or enum value number is
+	// out of range, reserved, or already in use.
+	CategoryInvalidTag
+	// CategoryUnresolvedType indicates that a type referenced by an element
+	// could not be resolved, such as when the type's file was omitted in
+	// favor of a conflicting version of the same file.
+	CategoryUnresolvedType
+	// CategoryUninterpretableOption indicates that a custom option could not
+	// be interpreted. This is only reported when
+	// BuilderOptions.RequireInterpretedOptions is true.
+	CategoryUninterpretableOption
+	// CategoryInvalidDefinition indicates that an element is otherwise not
+	// valid, such as a required field in a proto3 file.
+	CategoryInvalidDefinition
+	// CategoryDependency indicates a problem with the files an element
+	// depends on, such as a cycle or conflicting versions of the same file.
+	CategoryDependency
+)
+
+// String returns a short, human-readable name for the category.
+func (c ErrorCategory) String() string {
+	switch c {
+	case CategoryOther:
+		return "other"
+	case CategoryNameConflict:
+		return "name conflict"
+	case CategoryInvalidTag:
+		return "invalid tag"
+	case CategoryUnresolvedType:
+		return "unresolved type"
+	case CategoryUninterpretableOption:
+		return "uninterpretable option"
+	case CategoryInvalidDefinition:
+		return "invalid definition"
+	case CategoryDependency:
+		return "dependency"
+	default:
+		return fmt.Sprintf("ErrorCategory(%d)", int(c))
+	}
+}
+
+// BuildError describes a single problem found while building descriptors
+// with BuilderOptions.CollectAllErrors enabled.
+type BuildError struct {
+	// The fully-qualified name of the element with the problem, as computed
+	// by GetFullyQualifiedName. For file builders, this is the file's
+	// package (which may be empty).
+	Name string
+	// The builder for the element with the problem.
+	Builder Builder
+	// The kind of problem.
+	Category ErrorCategory
+	// The underlying error.
+	Err error
+}
+
+// Error implements the error interface.
+func (e *BuildError) Error() string {
+	name := e.Name
+	if fb, ok := e.Builder.(*FileBuilder); ok {
+		name = fmt.Sprintf("file %q", fb.GetName())
+	}
+	if name == "" {
+		return fmt.Sprintf("%v: %v", e.Category, e.Err)
+	}
+	return fmt.Sprintf("%s: %v: %v", name, e.Category, e.Err)
+}
+
+// Unwrap returns the underlying error.
+func (e *BuildError) Unwrap() error {
+	return e.Err
+}
+
+// BuildErrors is the error returned when building with
+// BuilderOptions.CollectAllErrors enabled and one or more problems are found.
+// It lists every problem found, in the order they were encountered.
+type BuildErrors []*BuildError
+
+// Error implements the error interface.
+func (e BuildErrors) Error() string {
+	if len(e) == 1 {
+		return e[0].Error()
+	}
+	var buf bytes.Buffer
+	_, _ = fmt.Fprintf(&buf, "%d errors building descriptors:", len(e))
+	for _, err := range e {
+		buf.WriteString("\n\t")
+		buf.WriteString(err.Error())
+	}
+	return buf.String()
+}
+
+// errReported is returned internally, in place of an actual error, when the
+// actual error has already been recorded by an errorReporter.
+var errReported = errors.New("errors were reported")
+
+// errorReporter decides what happens to problems found while building. If it
+// is not collecting, the given error is returned as is and the build aborts.
+// Otherwise, the error is recorded and nil is returned so that the build can
+// continue and find other problems.
+type errorReporter struct {
+	collect bool
+	errs    BuildErrors
+}
+
+func (rep *errorReporter) report(b Builder, category ErrorCategory, err error) error {
+	if rep == nil || !rep.collect {
+		return err
+	}
+	rep.errs = append(rep.errs, &BuildError{
+		Name:     GetFullyQualifiedName(b),
+		Builder:  b,
+		Category: category,
+		Err:      err,
+	})
+	return nil
+}
+
+func (rep *errorReporter) count() int {
+	if rep == nil {
+		return 0
+	}
+	return len(rep.errs)
+}
+
+// checkFile performs checks that would otherwise be done when the final file
+// descriptor is created. Doing them up front allows each problem to be
+// attributed to the builder that has it, instead of just the first problem
+// being reported for the whole file.
+func checkFile(fb *FileBuilder, deps []*desc.FileDescriptor, rep *errorReporter) {
+	for _, mb := range fb.messages {
+		checkMessage(mb, deps, rep)
+	}
+	for _, eb := range fb.enums {
+		checkEnum(eb, deps, rep)
+	}
+	for _, exb := range fb.extensions {
+		checkExtension(exb, deps, rep)
+	}
+	for _, sb := range fb.services {
+		checkSymbol(sb, deps, rep)
+		for _, mtb := range sb.methods {
+			if mtb.ReqType.foreignType != nil {
+				checkForeignType(mtb, mtb.ReqType.foreignType, deps, rep)
+			}
+			if mtb.RespType.foreignType != nil {
+				checkForeignType(mtb, mtb.RespType.foreignType, deps, rep)
+			}
+		}
+	}
+}
+
+// checkForeignType verifies that the given type, referenced by b, is present
+// in the given dependencies. It may not be if the type's file was omitted in
+// favor of a different version of the same file.
+func checkForeignType(b Builder, d desc.Descriptor, deps []*desc.FileDescriptor, rep *errorReporter) {
+	fqn := d.GetFullyQualifiedName()
+	for _, dep := range deps {
+		if dep == d.GetFile() {
+			return
+		}
+		if dep.GetName() != d.GetFile().GetName() {
+			continue
+		}
+		if found := dep.FindSymbol(fqn); found != nil && reflect.TypeOf(found) == reflect.TypeOf(d) {
+			return
+		}
+	}
+	_ = rep.report(b, CategoryUnresolvedType, fmt.Errorf("%s refers to type %s, which cannot be resolved in the dependencies of file %q", GetFullyQualifiedName(b), fqn, d.GetFile().GetName()))
+}
+
+func checkFieldType(flb *FieldBuilder, deps []*desc.FileDescriptor, rep *errorReporter) {
+	if md := flb.fieldType.foreignMsgType; md != nil {
+		checkForeignType(flb, md, deps, rep)
+	} else if ed := flb.fieldType.foreignEnumType; ed != nil {
+		checkForeignType(flb, ed, deps, rep)
+	}
+}
+
+func checkSymbol(b Builder, deps []*desc.FileDescriptor, rep *errorReporter) {
+	fqn := GetFullyQualifiedName(b)
+	for _, dep := range deps {
+		if d := dep.FindSymbol(fqn); d != nil {
+			_ = rep.report(b, CategoryNameConflict, fmt.Errorf("symbol %s already defined in file %q", fqn, dep.GetName()))
+			return
+		}
+	}
+}
+
+func checkMessage(mb *MessageBuilder, deps []*desc.FileDescriptor, rep *errorReporter) {
+	checkSymbol(mb, deps, rep)
+	checkField := func(flb *FieldBuilder) {
+		checkFieldType(flb, deps, rep)
+		for _, name := range mb.ReservedNames {
+			if name == flb.GetName() {
+				_ = rep.report(flb, CategoryNameConflict, fmt.Errorf("field %s uses reserved name %q", GetFullyQualifiedName(flb), name))
+				break
+			}
+		}
+		if flb.number == 0 {
+			// will be auto-assigned
+			return
+		}
+		for _, rr := range mb.ReservedRanges {
+			if flb.number >= rr.GetStart() && flb.number < rr.GetEnd() {
+				_ = rep.report(flb, CategoryInvalidTag, fmt.Errorf("field %s uses reserved tag %d", GetFullyQualifiedName(flb), flb.number))
+				break
+			}
+		}
+		for _, er := range mb.ExtensionRanges {
+			if flb.number >= er.GetStart() && flb.number < er.GetEnd() {
+				_ = rep.report(flb, CategoryInvalidTag, fmt.Errorf("field %s uses tag %d, which is in an extension range", GetFullyQualifiedName(flb), flb.number))
+				break
+			}
+		}
+		if flb.msgType != nil {
+			checkMessage(flb.msgType, deps, rep)
+		}
+	}
+	for _, b := range mb.fieldsAndOneOfs {
+		if flb, ok := b.(*FieldBuilder); ok {
+			checkField(flb)
+		} else {
+			for _, flb := range b.(*OneOfBuilder).choices {
+				checkField(flb)
+			}
+		}
+	}
+	for _, nmb := range mb.nestedMessages {
+		checkMessage(nmb, deps, rep)
+	}
+	for _, eb := range mb.nestedEnums {
+		checkEnum(eb, deps, rep)
+	}
+	for _, exb := range mb.nestedExtensions {
+		checkExtension(exb, deps, rep)
+	}
+}
+
+func checkEnum(eb *EnumBuilder, deps []*desc.FileDescriptor, rep *errorReporter) {
+	checkSymbol(eb, deps, rep)
+	if len(eb.values) == 0 {
+		_ = rep.report(eb, CategoryInvalidDefinition, fmt.Errorf("enum %s must contain at least one value", GetFullyQualifiedName(eb)))
+		return
+	}
+	if eb.GetFile().isProto3() && eb.values[0].numberSet && eb.values[0].number != 0 {
+		_ = rep.report(eb.values[0], CategoryInvalidDefinition, fmt.Errorf("enum %s: first value in proto3 enum must be zero", GetFullyQualifiedName(eb)))
+	}
+	allowAlias := eb.Options.GetAllowAlias()
+	numbers := map[int32]*EnumValueBuilder{}
+	for _, evb := range eb.values {
+		for _, name := range eb.ReservedNames {
+			if name == evb.GetName() {
+				_ = rep.report(evb, CategoryNameConflict, fmt.Errorf("enum value %s uses reserved name %q", GetFullyQualifiedName(evb), name))
+				break
+			}
+		}
+		if !evb.numberSet {
+			// will be auto-assigned
+			continue
+		}
+		for _, rr := range eb.ReservedRanges {
+			// enum reserved ranges are inclusive
+			if evb.number >= rr.GetStart() && evb.number <= rr.GetEnd() {
+				_ = rep.report(evb, CategoryInvalidTag, fmt.Errorf("enum value %s uses reserved number %d", GetFullyQualifiedName(evb), evb.number))
+				break
+			}
+		}
+		if ex, ok := numbers[evb.number]; ok && !allowAlias {
+			_ = rep.report(evb, CategoryInvalidTag, fmt.Errorf("enum value %s uses number %d, already used by %s", GetFullyQualifiedName(evb), evb.number, ex.GetName()))
+		} else if !ok {
+			numbers[evb.number] = evb
+		}
+	}
+}
+
+func checkExtension(exb *FieldBuilder, deps []*desc.FileDescriptor, rep *errorReporter) {
+	checkSymbol(exb, deps, rep)
+	checkFieldType(exb, deps, rep)
+	if exb.foreignExtendee != nil {
+		checkForeignType(exb, exb.foreignExtendee, deps, rep)
+	}
+	var inRange bool
+	if exb.foreignExtendee != nil {
+		inRange = exb.foreignExtendee.IsExtension(exb.number)
+	} else if exb.localExtendee != nil {
+		inRange = isInExtensionRange(exb.localExtendee.ExtensionRanges, exb.number)
+	} else {
+		return
+	}
+	if !inRange {
+		_ = rep.report(exb, CategoryInvalidTag, fmt.Errorf("extension %s uses tag %d, which is not in an extension range of %s", GetFullyQualifiedName(exb), exb.number, exb.GetExtendeeTypeName()))
+	}
+	if exb.msgType != nil {
+		checkMessage(exb.msgType, deps, rep)
+	}
+}
+
+func isInExtensionRange(ranges []*descriptorpb.DescriptorProto_ExtensionRange, tag int32) bool {
+	for _, er := range ranges {
+		if tag >= er.GetStart() && tag < er.GetEnd() {
+			return true
+		}
+	}
+	return false
+}
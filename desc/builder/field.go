@@ -186,7 +186,9 @@ func fromField(fld *desc.FieldDescriptor) (*FieldBuilder, error) {
 	ft := fieldTypeFromDescriptor(fld)
 	flb := NewField(fld.GetName(), ft)
 	flb.Options = fld.GetFieldOptions()
-	flb.Label = fld.GetLabel()
+	// use the label from the descriptor proto since, for editions, GetLabel
+	// reports required fields based on features
+	flb.Label = fld.AsFieldDescriptorProto().GetLabel()
 	flb.Proto3Optional = fld.IsProto3Optional()
 	flb.Default = fld.AsFieldDescriptorProto().GetDefaultValue()
 	flb.JsonName = fld.GetJSONName()
@@ -388,6 +390,104 @@ func (flb *FieldBuilder) SetOptions(options *descriptorpb.FieldOptions) *FieldBu
 	return flb
 }
 
+// SetFeatures sets the feature overrides in the options for this field and
+// returns the field, for method chaining.
+func (flb *FieldBuilder) SetFeatures(features *descriptorpb.FeatureSet) *FieldBuilder {
+	var options *descriptorpb.FieldOptions
+	if flb.Options != nil {
+		options = proto.Clone(flb.Options).(*descriptorpb.FieldOptions)
+	} else {
+		options = &descriptorpb.FieldOptions{}
+	}
+	options.Features = features
+	flb.Options = options
+	return flb
+}
+
+// SetOption sets the custom option described by the given extension to the
+// given value and returns the field, for method chaining. The value may be any
+// value accepted by dynamic.Message.TrySetField for the extension, such as a Go
+// scalar or, for message types, a *dynamic.Message. If the value is not valid,
+// this method panics. The existing options, if any, are copied so the change
+// is not visible to other builders or descriptors that share them. When the
+// field is built, the file that defines the extension is added as a
+// dependency.
+func (flb *FieldBuilder) SetOption(extd *desc.FieldDescriptor, val interface{}) *FieldBuilder {
+	if err := flb.TrySetOption(extd, val); err != nil {
+		panic(err)
+	}
+	return flb
+}
+
+// TrySetOption sets the custom option described by the given extension to the
+// given value, returning an error if the extension does not extend
+// FieldOptions or if the value is not valid for it.
+func (flb *FieldBuilder) TrySetOption(extd *desc.FieldDescriptor, val interface{}) error {
+	return setOption(flb, extd, val)
+}
+
+// SetOptionByName sets the custom option with the given fully-qualified name
+// to the given value and returns the field, for method chaining. If an error
+// prevents the option from being set, this method panics.
+//
+// See TrySetOptionByName for how the option's extension is found.
+func (flb *FieldBuilder) SetOptionByName(name string, val interface{}) *FieldBuilder {
+	if err := flb.TrySetOptionByName(name, val); err != nil {
+		panic(err)
+	}
+	return flb
+}
+
+// TrySetOptionByName sets the custom option with the given fully-qualified name
+// to the given value, returning any error that prevents the option from being
+// set. The extension for the option is found among options already set on
+// this field, the explicit imports of its file, the dependencies of the file
+// from which it was created (if created with FromFile), and extensions linked
+// into the current program. If the extension cannot be found, the value is
+// retained and the option is set when the field is built, at which point the
+// extension may also be found in BuilderOptions.Extensions or in any other
+// file on which the field's file depends. An error is reported then if the
+// extension still cannot be found or the value is not valid for it.
+func (flb *FieldBuilder) TrySetOptionByName(name string, val interface{}) error {
+	return setOptionByName(flb, name, val)
+}
+
+// GetOption returns the value of the custom option described by the given
+// extension. If the option is not set, nil is returned. Values for message
+// types are returned as *dynamic.Message.
+func (flb *FieldBuilder) GetOption(extd *desc.FieldDescriptor) (interface{}, error) {
+	return getOption(flb, extd)
+}
+
+// GetOptionByName returns the value of the custom option with the given
+// fully-qualified name. If the option is not set, nil is returned. An error is
+// returned if the option's extension cannot be found.
+func (flb *FieldBuilder) GetOptionByName(name string) (interface{}, error) {
+	return getOptionByName(flb, name)
+}
+
+// ClearOption removes the custom option described by the given extension and
+// returns the field, for method chaining.
+func (flb *FieldBuilder) ClearOption(extd *desc.FieldDescriptor) *FieldBuilder {
+	clearOption(flb, extd)
+	return flb
+}
+
+// ClearOptionByName removes the custom option with the given fully-qualified
+// name and returns the field, for method chaining.
+func (flb *FieldBuilder) ClearOptionByName(name string) *FieldBuilder {
+	clearOptionByName(flb, name)
+	return flb
+}
+
+func (flb *FieldBuilder) getOptions() proto.Message {
+	return flb.Options
+}
+
+func (flb *FieldBuilder) setOptions(opts proto.Message) {
+	flb.Options = opts.(*descriptorpb.FieldOptions)
+}
+
 // SetLabel sets the label for this field, which can be optional, repeated, or
 // required. It returns the field builder, for method chaining.
 func (flb *FieldBuilder) SetLabel(lbl descriptorpb.FieldDescriptorProto_Label) *FieldBuilder {
@@ -492,28 +592,70 @@ func (flb *FieldBuilder) GetExtendeeTypeName() string {
 	}
 }
 
-func (flb *FieldBuilder) buildProto(path []int32, sourceInfo *descriptorpb.SourceCodeInfo, isMessageSet bool) (*descriptorpb.FieldDescriptorProto, error) {
-	addCommentsTo(sourceInfo, path, &flb.comments)
+func (flb *FieldBuilder) buildProto(path []int32, sourceInfo *sourceInfoBuilder, isMessageSet bool, rep *errorReporter) (*descriptorpb.FieldDescriptorProto, error) {
+	sourceInfo.addElement(path, &flb.comments, flb.lossless)
 
-	isProto3 := flb.GetFile().IsProto3
+	isProto3 := flb.GetFile().isProto3()
 	if flb.Proto3Optional {
 		if !isProto3 {
-			return nil, fmt.Errorf("field %s is not in a proto3 syntax file but is marked as a proto3 optional field", GetFullyQualifiedName(flb))
+			if err := rep.report(flb, CategoryInvalidDefinition, fmt.Errorf("field %s is not in a proto3 syntax file but is marked as a proto3 optional field", GetFullyQualifiedName(flb))); err != nil {
+				return nil, err
+			}
 		}
-		if flb.IsExtension() {
-			return nil, fmt.Errorf("field %s: extensions cannot be proto3 optional fields", GetFullyQualifiedName(flb))
+		// NB: protoc marks proto3 extensions declared with the "optional"
+		// keyword as proto3 optional, so we allow it for extensions that were
+		// retained from such a file in lossless mode.
+		if flb.IsExtension() && !sourceInfo.retained(flb.lossless) {
+			if err := rep.report(flb, CategoryInvalidDefinition, fmt.Errorf("field %s: extensions cannot be proto3 optional fields", GetFullyQualifiedName(flb))); err != nil {
+				return nil, err
+			}
 		}
 		if _, ok := flb.GetParent().(*OneOfBuilder); ok {
-			return nil, fmt.Errorf("field %s: proto3 optional fields cannot belong to a oneof", GetFullyQualifiedName(flb))
+			if err := rep.report(flb, CategoryInvalidDefinition, fmt.Errorf("field %s: proto3 optional fields cannot belong to a oneof", GetFullyQualifiedName(flb))); err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	label := flb.Label
+	fieldType := flb.fieldType.fieldType
+	opts := flb.Options
+	if flb.GetFile().isEditions() {
+		// editions has no required label or group type; these are instead
+		// expressed using features
+		var features *descriptorpb.FeatureSet
+		if label == descriptorpb.FieldDescriptorProto_LABEL_REQUIRED {
+			label = descriptorpb.FieldDescriptorProto_LABEL_OPTIONAL
+			features = &descriptorpb.FeatureSet{FieldPresence: descriptorpb.FeatureSet_LEGACY_REQUIRED.Enum()}
+		}
+		if fieldType == descriptorpb.FieldDescriptorProto_TYPE_GROUP {
+			fieldType = descriptorpb.FieldDescriptorProto_TYPE_MESSAGE
+			if features == nil {
+				features = &descriptorpb.FeatureSet{}
+			}
+			features.MessageEncoding = descriptorpb.FeatureSet_DELIMITED.Enum()
+		}
+		if features != nil {
+			if opts != nil {
+				opts = proto.Clone(opts).(*descriptorpb.FieldOptions)
+			} else {
+				opts = &descriptorpb.FieldOptions{}
+			}
+			if opts.Features != nil {
+				proto.Merge(features, opts.Features)
+			}
+			opts.Features = features
 		}
 	}
 
 	var lbl *descriptorpb.FieldDescriptorProto_Label
-	if int32(flb.Label) != 0 {
-		if isProto3 && flb.Label == descriptorpb.FieldDescriptorProto_LABEL_REQUIRED {
-			return nil, fmt.Errorf("field %s: proto3 does not allow required fields", GetFullyQualifiedName(flb))
+	if int32(label) != 0 {
+		if isProto3 && label == descriptorpb.FieldDescriptorProto_LABEL_REQUIRED {
+			if err := rep.report(flb, CategoryInvalidDefinition, fmt.Errorf("field %s: proto3 does not allow required fields", GetFullyQualifiedName(flb))); err != nil {
+				return nil, err
+			}
 		}
-		lbl = flb.Label.Enum()
+		lbl = label.Enum()
 	}
 	var typeName *string
 	tn := flb.fieldType.GetTypeName()
@@ -524,9 +666,11 @@ func (flb *FieldBuilder) buildProto(path []int32, sourceInfo *descriptorpb.Sourc
 	if flb.IsExtension() {
 		extendee = proto.String("." + flb.GetExtendeeTypeName())
 	}
-	jsName := flb.JsonName
-	if jsName == "" {
-		jsName = internal.JsonName(flb.name)
+	var jsName *string
+	if flb.JsonName != "" {
+		jsName = proto.String(flb.JsonName)
+	} else if !sourceInfo.retained(flb.lossless) || !flb.lossless.omitJsonName {
+		jsName = proto.String(internal.JsonName(flb.name))
 	}
 	var def *string
 	if flb.Default != "" {
@@ -539,17 +683,19 @@ func (flb *FieldBuilder) buildProto(path []int32, sourceInfo *descriptorpb.Sourc
 
 	maxTag := internal.GetMaxTag(isMessageSet)
 	if flb.number > maxTag {
-		return nil, fmt.Errorf("tag for field %s cannot be above max %d", GetFullyQualifiedName(flb), maxTag)
+		if err := rep.report(flb, CategoryInvalidTag, fmt.Errorf("tag for field %s cannot be above max %d", GetFullyQualifiedName(flb), maxTag)); err != nil {
+			return nil, err
+		}
 	}
 
 	fd := &descriptorpb.FieldDescriptorProto{
 		Name:           proto.String(flb.name),
 		Number:         proto.Int32(flb.number),
-		Options:        flb.Options,
+		Options:        opts,
 		Label:          lbl,
-		Type:           flb.fieldType.fieldType.Enum(),
+		Type:           fieldType.Enum(),
 		TypeName:       typeName,
-		JsonName:       proto.String(jsName),
+		JsonName:       jsName,
 		DefaultValue:   def,
 		Extendee:       extendee,
 		Proto3Optional: proto3Optional,
@@ -820,12 +966,112 @@ func (oob *OneOfBuilder) SetOptions(options *descriptorpb.OneofOptions) *OneOfBu
 	return oob
 }
 
-func (oob *OneOfBuilder) buildProto(path []int32, sourceInfo *descriptorpb.SourceCodeInfo) (*descriptorpb.OneofDescriptorProto, error) {
-	addCommentsTo(sourceInfo, path, &oob.comments)
+// SetFeatures sets the feature overrides in the options for this one-of and
+// returns the one-of, for method chaining.
+func (oob *OneOfBuilder) SetFeatures(features *descriptorpb.FeatureSet) *OneOfBuilder {
+	var options *descriptorpb.OneofOptions
+	if oob.Options != nil {
+		options = proto.Clone(oob.Options).(*descriptorpb.OneofOptions)
+	} else {
+		options = &descriptorpb.OneofOptions{}
+	}
+	options.Features = features
+	oob.Options = options
+	return oob
+}
+
+// SetOption sets the custom option described by the given extension to the
+// given value and returns the one-of, for method chaining. The value may be any
+// value accepted by dynamic.Message.TrySetField for the extension, such as a Go
+// scalar or, for message types, a *dynamic.Message. If the value is not valid,
+// this method panics. The existing options, if any, are copied so the change
+// is not visible to other builders or descriptors that share them. When the
+// one-of is built, the file that defines the extension is added as a
+// dependency.
+func (oob *OneOfBuilder) SetOption(extd *desc.FieldDescriptor, val interface{}) *OneOfBuilder {
+	if err := oob.TrySetOption(extd, val); err != nil {
+		panic(err)
+	}
+	return oob
+}
+
+// TrySetOption sets the custom option described by the given extension to the
+// given value, returning an error if the extension does not extend
+// OneofOptions or if the value is not valid for it.
+func (oob *OneOfBuilder) TrySetOption(extd *desc.FieldDescriptor, val interface{}) error {
+	return setOption(oob, extd, val)
+}
+
+// SetOptionByName sets the custom option with the given fully-qualified name
+// to the given value and returns the one-of, for method chaining. If an error
+// prevents the option from being set, this method panics.
+//
+// See TrySetOptionByName for how the option's extension is found.
+func (oob *OneOfBuilder) SetOptionByName(name string, val interface{}) *OneOfBuilder {
+	if err := oob.TrySetOptionByName(name, val); err != nil {
+		panic(err)
+	}
+	return oob
+}
+
+// TrySetOptionByName sets the custom option with the given fully-qualified name
+// to the given value, returning any error that prevents the option from being
+// set. The extension for the option is found among options already set on
+// this one-of, the explicit imports of its file, the dependencies of the file
+// from which it was created (if created with FromFile), and extensions linked
+// into the current program. If the extension cannot be found, the value is
+// retained and the option is set when the one-of is built, at which point the
+// extension may also be found in BuilderOptions.Extensions or in any other
+// file on which the one-of's file depends. An error is reported then if the
+// extension still cannot be found or the value is not valid for it.
+func (oob *OneOfBuilder) TrySetOptionByName(name string, val interface{}) error {
+	return setOptionByName(oob, name, val)
+}
+
+// GetOption returns the value of the custom option described by the given
+// extension. If the option is not set, nil is returned. Values for message
+// types are returned as *dynamic.Message.
+func (oob *OneOfBuilder) GetOption(extd *desc.FieldDescriptor) (interface{}, error) {
+	return getOption(oob, extd)
+}
+
+// GetOptionByName returns the value of the custom option with the given
+// fully-qualified name. If the option is not set, nil is returned. An error is
+// returned if the option's extension cannot be found.
+func (oob *OneOfBuilder) GetOptionByName(name string) (interface{}, error) {
+	return getOptionByName(oob, name)
+}
+
+// ClearOption removes the custom option described by the given extension and
+// returns the one-of, for method chaining.
+func (oob *OneOfBuilder) ClearOption(extd *desc.FieldDescriptor) *OneOfBuilder {
+	clearOption(oob, extd)
+	return oob
+}
+
+// ClearOptionByName removes the custom option with the given fully-qualified
+// name and returns the one-of, for method chaining.
+func (oob *OneOfBuilder) ClearOptionByName(name string) *OneOfBuilder {
+	clearOptionByName(oob, name)
+	return oob
+}
+
+func (oob *OneOfBuilder) getOptions() proto.Message {
+	return oob.Options
+}
+
+func (oob *OneOfBuilder) setOptions(opts proto.Message) {
+	oob.Options = opts.(*descriptorpb.OneofOptions)
+}
+
+func (oob *OneOfBuilder) buildProto(path []int32, sourceInfo *sourceInfoBuilder, rep *errorReporter) (*descriptorpb.OneofDescriptorProto, error) {
+	sourceInfo.addElement(path, &oob.comments, oob.lossless)
 
 	for _, flb := range oob.choices {
 		if flb.IsRepeated() || flb.IsRequired() {
-			return nil, fmt.Errorf("fields in a one-of must be optional, %s is %v", GetFullyQualifiedName(flb), flb.Label)
+			if err := rep.report(flb, CategoryInvalidDefinition, fmt.Errorf("fields in a one-of must be optional, %s is %v", GetFullyQualifiedName(flb), flb.Label)); err != nil {
+				return nil, err
+			}
 		}
 	}
 
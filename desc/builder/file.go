@@ -47,8 +47,13 @@ type FileBuilder struct {
 	name string
 
 	IsProto3 bool
-	Package  string
-	Options  *descriptorpb.FileOptions
+	// Edition, if set to EDITION_2023 or later, indicates that the file uses
+	// editions instead of "proto2" or "proto3" syntax, in which case IsProto3
+	// is ignored. Setting it to EDITION_PROTO2 or EDITION_PROTO3 is the same as
+	// leaving it unset with IsProto3 set accordingly.
+	Edition descriptorpb.Edition
+	Package string
+	Options *descriptorpb.FileOptions
 
 	comments        Comments
 	SyntaxComments  Comments
@@ -63,6 +68,8 @@ type FileBuilder struct {
 	origExts        *dynamic.ExtensionRegistry
 	explicitDeps    map[*FileBuilder]struct{}
 	explicitImports map[*desc.FileDescriptor]struct{}
+	customOpts      customOptions
+	lossless        *losslessInfo
 }
 
 // NewFile creates a new FileBuilder for a file with the given name. The
@@ -78,10 +85,19 @@ func NewFile(name string) *FileBuilder {
 // descriptor. Note that builders do not retain full source code info, even if
 // the given descriptor included it. Instead, comments are extracted from the
 // given descriptor's source info (if present) and, when built, the resulting
-// descriptor will have just the comment info (no location information).
+// descriptor will have just the comment info (no location information). Use
+// FromFileOptions to retain full source code info and other details that are
+// otherwise lost.
 func FromFile(fd *desc.FileDescriptor) (*FileBuilder, error) {
+	return FromFileOptions{}.FromFile(fd)
+}
+
+func fromFile(fd *desc.FileDescriptor) (*FileBuilder, error) {
 	fb := NewFile(fd.GetName())
 	fb.IsProto3 = fd.IsProto3()
+	if fd.IsEditions() {
+		fb.Edition = fd.GetEdition()
+	}
 	fb.Package = fd.GetPackage()
 	fb.Options = fd.GetFileOptions()
 	setComments(&fb.comments, fd.GetSourceInfo())
@@ -641,6 +657,108 @@ func (fb *FileBuilder) SetOptions(options *descriptorpb.FileOptions) *FileBuilde
 	return fb
 }
 
+// SetFeatures sets the feature overrides in the options for this file and
+// returns the file, for method chaining.
+func (fb *FileBuilder) SetFeatures(features *descriptorpb.FeatureSet) *FileBuilder {
+	var options *descriptorpb.FileOptions
+	if fb.Options != nil {
+		options = proto.Clone(fb.Options).(*descriptorpb.FileOptions)
+	} else {
+		options = &descriptorpb.FileOptions{}
+	}
+	options.Features = features
+	fb.Options = options
+	return fb
+}
+
+// SetOption sets the custom option described by the given extension to the
+// given value and returns the file, for method chaining. The value may be any
+// value accepted by dynamic.Message.TrySetField for the extension, such as a Go
+// scalar or, for message types, a *dynamic.Message. If the value is not valid,
+// this method panics. The existing options, if any, are copied so the change
+// is not visible to other builders or descriptors that share them. When the
+// file is built, the file that defines the extension is added as a
+// dependency.
+func (fb *FileBuilder) SetOption(extd *desc.FieldDescriptor, val interface{}) *FileBuilder {
+	if err := fb.TrySetOption(extd, val); err != nil {
+		panic(err)
+	}
+	return fb
+}
+
+// TrySetOption sets the custom option described by the given extension to the
+// given value, returning an error if the extension does not extend
+// FileOptions or if the value is not valid for it.
+func (fb *FileBuilder) TrySetOption(extd *desc.FieldDescriptor, val interface{}) error {
+	return setOption(fb, extd, val)
+}
+
+// SetOptionByName sets the custom option with the given fully-qualified name
+// to the given value and returns the file, for method chaining. If an error
+// prevents the option from being set, this method panics.
+//
+// See TrySetOptionByName for how the option's extension is found.
+func (fb *FileBuilder) SetOptionByName(name string, val interface{}) *FileBuilder {
+	if err := fb.TrySetOptionByName(name, val); err != nil {
+		panic(err)
+	}
+	return fb
+}
+
+// TrySetOptionByName sets the custom option with the given fully-qualified name
+// to the given value, returning any error that prevents the option from being
+// set. The extension for the option is found among options already set on
+// this file, the explicit imports of its file, the dependencies of the file
+// from which it was created (if created with FromFile), and extensions linked
+// into the current program. If the extension cannot be found, the value is
+// retained and the option is set when the file is built, at which point the
+// extension may also be found in BuilderOptions.Extensions or in any other
+// file on which the file's file depends. An error is reported then if the
+// extension still cannot be found or the value is not valid for it.
+func (fb *FileBuilder) TrySetOptionByName(name string, val interface{}) error {
+	return setOptionByName(fb, name, val)
+}
+
+// GetOption returns the value of the custom option described by the given
+// extension. If the option is not set, nil is returned. Values for message
+// types are returned as *dynamic.Message.
+func (fb *FileBuilder) GetOption(extd *desc.FieldDescriptor) (interface{}, error) {
+	return getOption(fb, extd)
+}
+
+// GetOptionByName returns the value of the custom option with the given
+// fully-qualified name. If the option is not set, nil is returned. An error is
+// returned if the option's extension cannot be found.
+func (fb *FileBuilder) GetOptionByName(name string) (interface{}, error) {
+	return getOptionByName(fb, name)
+}
+
+// ClearOption removes the custom option described by the given extension and
+// returns the file, for method chaining.
+func (fb *FileBuilder) ClearOption(extd *desc.FieldDescriptor) *FileBuilder {
+	clearOption(fb, extd)
+	return fb
+}
+
+// ClearOptionByName removes the custom option with the given fully-qualified
+// name and returns the file, for method chaining.
+func (fb *FileBuilder) ClearOptionByName(name string) *FileBuilder {
+	clearOptionByName(fb, name)
+	return fb
+}
+
+func (fb *FileBuilder) getCustomOptions() *customOptions {
+	return &fb.customOpts
+}
+
+func (fb *FileBuilder) getOptions() proto.Message {
+	return fb.Options
+}
+
+func (fb *FileBuilder) setOptions(opts proto.Message) {
+	fb.Options = opts.(*descriptorpb.FileOptions)
+}
+
 // SetPackageName sets the name of the package for this file and returns the
 // file, for method chaining.
 func (fb *FileBuilder) SetPackageName(pkg string) *FileBuilder {
@@ -655,13 +773,65 @@ func (fb *FileBuilder) SetProto3(isProto3 bool) *FileBuilder {
 	return fb
 }
 
-func (fb *FileBuilder) buildProto(deps []*desc.FileDescriptor) (*descriptorpb.FileDescriptorProto, error) {
+// SetEdition sets the edition that this file uses and returns the file, for
+// method chaining. Setting an edition of EDITION_2023 or later means the file
+// is declared with an edition instead of a syntax. Setting EDITION_PROTO2 or
+// EDITION_PROTO3 is equivalent to calling SetProto3 with false or true
+// respectively.
+//
+// In files that use editions, fields cannot be required and there are no
+// groups. Instead, the field presence and message encoding features are used.
+// When the file is built, a field builder with a required label is built as
+// an optional field with a field presence feature of LEGACY_REQUIRED, and a
+// group field is built as a message field with a message encoding feature of
+// DELIMITED.
+func (fb *FileBuilder) SetEdition(edition descriptorpb.Edition) *FileBuilder {
+	switch edition {
+	case descriptorpb.Edition_EDITION_PROTO2, descriptorpb.Edition_EDITION_PROTO3:
+		fb.IsProto3 = edition == descriptorpb.Edition_EDITION_PROTO3
+		fb.Edition = descriptorpb.Edition_EDITION_UNKNOWN
+	default:
+		fb.Edition = edition
+	}
+	return fb
+}
+
+// GetEdition returns the edition that this file uses. If the file does not
+// use editions, this returns EDITION_PROTO2 or EDITION_PROTO3, depending on
+// its syntax.
+func (fb *FileBuilder) GetEdition() descriptorpb.Edition {
+	switch {
+	case fb.isEditions():
+		return fb.Edition
+	case fb.isProto3():
+		return descriptorpb.Edition_EDITION_PROTO3
+	default:
+		return descriptorpb.Edition_EDITION_PROTO2
+	}
+}
+
+func (fb *FileBuilder) isEditions() bool {
+	return fb.Edition > descriptorpb.Edition_EDITION_PROTO3
+}
+
+func (fb *FileBuilder) isProto3() bool {
+	if fb.Edition == descriptorpb.Edition_EDITION_PROTO3 {
+		return true
+	}
+	return !fb.isEditions() && fb.Edition != descriptorpb.Edition_EDITION_PROTO2 && fb.IsProto3
+}
+
+func (fb *FileBuilder) buildProto(deps []*desc.FileDescriptor, rep *errorReporter) (*descriptorpb.FileDescriptorProto, error) {
 	name := fb.name
 	if name == "" {
 		name = uniqueFileName()
 	}
 	var syntax *string
-	if fb.IsProto3 {
+	var edition *descriptorpb.Edition
+	if fb.isEditions() {
+		syntax = proto.String("editions")
+		edition = fb.Edition.Enum()
+	} else if fb.isProto3() {
 		syntax = proto.String("proto3")
 	}
 	var pkg *string
@@ -670,21 +840,43 @@ func (fb *FileBuilder) buildProto(deps []*desc.FileDescriptor) (*descriptorpb.Fi
 	}
 
 	path := make([]int32, 0, 10)
-	sourceInfo := descriptorpb.SourceCodeInfo{}
-	addCommentsTo(&sourceInfo, path, &fb.comments)
-	addCommentsTo(&sourceInfo, append(path, internal.File_syntaxTag), &fb.SyntaxComments)
-	addCommentsTo(&sourceInfo, append(path, internal.File_packageTag), &fb.PackageComments)
+	sourceInfo := &sourceInfoBuilder{}
+	if fb.lossless != nil {
+		sourceInfo.file = fb.lossless.file
+		if syntax == nil && sourceInfo.file.syntax == "proto2" {
+			syntax = proto.String("proto2")
+		}
+		if pkg == nil && sourceInfo.file.emptyPackage {
+			pkg = proto.String("")
+		}
+	}
+	if sourceInfo.addRetained(path, &fb.comments, fb.lossless) {
+		sourceInfo.updateComments(append(path, internal.File_syntaxTag), &fb.SyntaxComments)
+		sourceInfo.updateComments(append(path, internal.File_packageTag), &fb.PackageComments)
+	} else {
+		sourceInfo.addComments(path, &fb.comments)
+		sourceInfo.addComments(append(path, internal.File_syntaxTag), &fb.SyntaxComments)
+		sourceInfo.addComments(append(path, internal.File_packageTag), &fb.PackageComments)
+	}
 
-	imports := make([]string, 0, len(deps))
-	for _, dep := range deps {
-		imports = append(imports, dep.GetName())
+	var imports []string
+	var publicImports, weakImports []int32
+	ok := false
+	if sourceInfo.file != nil {
+		imports, publicImports, weakImports, ok = sourceInfo.file.importsFor(deps)
+	}
+	if !ok {
+		imports = make([]string, 0, len(deps))
+		for _, dep := range deps {
+			imports = append(imports, dep.GetName())
+		}
+		sort.Strings(imports)
 	}
-	sort.Strings(imports)
 
 	messages := make([]*descriptorpb.DescriptorProto, 0, len(fb.messages))
 	for _, mb := range fb.messages {
 		path := append(path, internal.File_messagesTag, int32(len(messages)))
-		if md, err := mb.buildProto(path, &sourceInfo); err != nil {
+		if md, err := mb.buildProto(path, sourceInfo, rep); err != nil {
 			return nil, err
 		} else {
 			messages = append(messages, md)
@@ -694,7 +886,7 @@ func (fb *FileBuilder) buildProto(deps []*desc.FileDescriptor) (*descriptorpb.Fi
 	enums := make([]*descriptorpb.EnumDescriptorProto, 0, len(fb.enums))
 	for _, eb := range fb.enums {
 		path := append(path, internal.File_enumsTag, int32(len(enums)))
-		if ed, err := eb.buildProto(path, &sourceInfo); err != nil {
+		if ed, err := eb.buildProto(path, sourceInfo, rep); err != nil {
 			return nil, err
 		} else {
 			enums = append(enums, ed)
@@ -704,7 +896,7 @@ func (fb *FileBuilder) buildProto(deps []*desc.FileDescriptor) (*descriptorpb.Fi
 	extensions := make([]*descriptorpb.FieldDescriptorProto, 0, len(fb.extensions))
 	for _, exb := range fb.extensions {
 		path := append(path, internal.File_extensionsTag, int32(len(extensions)))
-		if exd, err := exb.buildProto(path, &sourceInfo, isExtendeeMessageSet(exb)); err != nil {
+		if exd, err := exb.buildProto(path, sourceInfo, isExtendeeMessageSet(exb), rep); err != nil {
 			return nil, err
 		} else {
 			extensions = append(extensions, exd)
@@ -714,7 +906,7 @@ func (fb *FileBuilder) buildProto(deps []*desc.FileDescriptor) (*descriptorpb.Fi
 	services := make([]*descriptorpb.ServiceDescriptorProto, 0, len(fb.services))
 	for _, sb := range fb.services {
 		path := append(path, internal.File_servicesTag, int32(len(services)))
-		if sd, err := sb.buildProto(path, &sourceInfo); err != nil {
+		if sd, err := sb.buildProto(path, sourceInfo, rep); err != nil {
 			return nil, err
 		} else {
 			services = append(services, sd)
@@ -722,16 +914,19 @@ func (fb *FileBuilder) buildProto(deps []*desc.FileDescriptor) (*descriptorpb.Fi
 	}
 
 	return &descriptorpb.FileDescriptorProto{
-		Name:           proto.String(name),
-		Package:        pkg,
-		Dependency:     imports,
-		Options:        fb.Options,
-		Syntax:         syntax,
-		MessageType:    messages,
-		EnumType:       enums,
-		Extension:      extensions,
-		Service:        services,
-		SourceCodeInfo: &sourceInfo,
+		Name:             proto.String(name),
+		Package:          pkg,
+		Dependency:       imports,
+		PublicDependency: publicImports,
+		WeakDependency:   weakImports,
+		Options:          fb.Options,
+		Syntax:           syntax,
+		Edition:          edition,
+		MessageType:      messages,
+		EnumType:         enums,
+		Extension:        extensions,
+		Service:          services,
+		SourceCodeInfo:   sourceInfo.build(),
 	}, nil
 }
 
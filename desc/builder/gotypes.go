@@ -0,0 +1,383 @@
+package builder
+
+import (
+	"fmt"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/types/known/durationpb"
+	"google.golang.org/protobuf/types/known/timestamppb"
+
+	"github.com/jhump/protoreflect/desc"
+)
+
+// FromGoType returns a MessageBuilder for a message that corresponds to the
+// given Go struct type, using the default options of a GoTypeMapper. The
+// message is added to a new proto3 file, along with messages for any other
+// struct types it refers to.
+func FromGoType(t reflect.Type) (*MessageBuilder, error) {
+	return (&GoTypeMapper{}).MessageFor(t)
+}
+
+// GoTypeMapper creates message builders that correspond to Go struct types.
+// The resulting messages can represent the same data as the structs, so they
+// can be used, for example, to describe Go domain types that are exposed via
+// gRPC. Values can be converted between such structs and dynamic messages
+// using dynamic.GoValueMapper.
+//
+// Each exported field of a struct becomes a field of the message. Fields of
+// embedded structs are treated as if they were fields of the outer struct. Go
+// types map to proto types as follows:
+//   - bool, string, float32, and float64 map to bool, string, float, and
+//     double.
+//   - int, int64, uint, and uint64 map to int64 and uint64. Smaller integer
+//     types map to int32 and uint32.
+//   - []byte (and byte arrays) map to bytes.
+//   - time.Time and time.Duration map to google.protobuf.Timestamp and
+//     google.protobuf.Duration.
+//   - Generated message types map to those messages.
+//   - Other structs map to messages, which are created as needed. A struct
+//     type that is referred to more than once, including by itself, maps to a
+//     single message.
+//   - Pointers map to the type to which they point. In a proto3 file, a
+//     pointer to a scalar type maps to a proto3 optional field, so that its
+//     presence is tracked.
+//   - Slices and arrays map to repeated fields, and maps map to map fields.
+//     Slices of slices and maps of slices or maps are not allowed.
+//
+// A Go field's "proto" struct tag controls the corresponding proto field. It
+// is a comma-separated list whose first element is the field's name. The
+// remaining elements are the field's number and "json=" followed by its JSON
+// name, both optional, like so:
+//
+//	ID   string `proto:"id,1"`
+//	Name string `proto:"full_name,2,json=name"`
+//	Age  int    `proto:",3"`
+//
+// If the name is omitted, the Go field's name converted to snake case (so
+// "UserID" becomes "user_id") is used. If the number is omitted, the field
+// number is assigned when the message is built. If the JSON name is omitted
+// and the Go field has a "json" struct tag, the name in that tag is used as
+// the JSON name. A "proto" tag of "-" means the Go field is ignored.
+type GoTypeMapper struct {
+	// The file to which messages are added. If nil, a new file is created,
+	// with no name and using proto3 syntax, the first time MessageFor is
+	// called. Using the same mapper to create messages for several types adds
+	// them all to the same file.
+	File *FileBuilder
+	// If true, messages for struct types are nested inside the message that
+	// first refers to them, instead of being added to the file as top-level
+	// messages.
+	NestMessages bool
+
+	types map[reflect.Type]*MessageBuilder
+}
+
+var (
+	typeOfGoTime     = reflect.TypeOf(time.Time{})
+	typeOfGoDuration = reflect.TypeOf(time.Duration(0))
+	typeOfGoBytes    = reflect.TypeOf([]byte(nil))
+	typeOfProtoMsg   = reflect.TypeOf((*proto.Message)(nil)).Elem()
+)
+
+// MessageFor returns a message builder that corresponds to the given Go struct
+// type, or pointer to a struct type. If this mapper has already created a
+// message for the type, that same builder is returned. An error is returned if
+// the type is not a struct or if any of its fields has a type that cannot be
+// represented in a proto message.
+func (m *GoTypeMapper) MessageFor(t reflect.Type) (*MessageBuilder, error) {
+	for t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	if t.Kind() != reflect.Struct {
+		return nil, fmt.Errorf("type %v is not a struct", t)
+	}
+	if t.Name() == "" {
+		return nil, fmt.Errorf("type %v has no name", t)
+	}
+	if mb := m.types[t]; mb != nil {
+		return mb, nil
+	}
+	if m.File == nil {
+		m.File = NewFile("").SetProto3(true)
+	}
+	return m.messageFor(t, t.Name(), nil)
+}
+
+// messageFor creates a message for the given struct type. The message is
+// nested in parent if parent is not nil.
+func (m *GoTypeMapper) messageFor(t reflect.Type, name string, parent *MessageBuilder) (*MessageBuilder, error) {
+	if m.types == nil {
+		m.types = map[reflect.Type]*MessageBuilder{}
+	}
+	name = goTypeMessageName(name)
+	mb := NewMessage(name)
+	// in case of a name conflict, pick a different name
+	for i := 2; ; i++ {
+		var err error
+		if parent != nil {
+			err = parent.TryAddNestedMessage(mb)
+		} else {
+			err = m.File.TryAddMessage(mb)
+		}
+		if err == nil {
+			break
+		}
+		mb.SetName(name + strconv.Itoa(i))
+	}
+	// register it first, so recursive references find it
+	m.types[t] = mb
+
+	for _, sf := range reflect.VisibleFields(t) {
+		if !sf.IsExported() {
+			continue
+		}
+		tag, hasTag := sf.Tag.Lookup("proto")
+		if tag == "-" {
+			continue
+		}
+		if sf.Anonymous && !hasTag {
+			ft := sf.Type
+			for ft.Kind() == reflect.Ptr {
+				ft = ft.Elem()
+			}
+			if ft.Kind() == reflect.Struct && !isGoTypeMessage(ft) && ft != typeOfGoTime {
+				// fields of embedded structs are promoted
+				continue
+			}
+		}
+		flb, err := m.fieldFor(mb, sf, tag)
+		if err != nil {
+			Unlink(mb)
+			delete(m.types, t)
+			return nil, fmt.Errorf("%v.%s: %v", t, sf.Name, err)
+		}
+		if err := mb.TryAddField(flb); err != nil {
+			Unlink(mb)
+			delete(m.types, t)
+			return nil, fmt.Errorf("%v.%s: %v", t, sf.Name, err)
+		}
+	}
+	return mb, nil
+}
+
+func (m *GoTypeMapper) fieldFor(mb *MessageBuilder, sf reflect.StructField, tag string) (*FieldBuilder, error) {
+	parts := strings.Split(tag, ",")
+	name := parts[0]
+	if name == "" {
+		name = goFieldNameToProto(sf.Name)
+	}
+	var number int32
+	var jsonName string
+	for _, p := range parts[1:] {
+		switch {
+		case strings.HasPrefix(p, "json="):
+			jsonName = strings.TrimPrefix(p, "json=")
+		case p == "":
+		default:
+			n, err := strconv.ParseInt(p, 10, 32)
+			if err != nil || n <= 0 {
+				return nil, fmt.Errorf("invalid field number %q in struct tag", p)
+			}
+			number = int32(n)
+		}
+	}
+	if jsonName == "" {
+		if jt := strings.Split(sf.Tag.Get("json"), ",")[0]; jt != "" && jt != "-" {
+			jsonName = jt
+		}
+	}
+
+	var flb *FieldBuilder
+	t := sf.Type
+	switch {
+	case t.Kind() == reflect.Map:
+		keyType, err := m.fieldTypeFor(mb, sf.Name, t.Key(), nil)
+		if err != nil {
+			return nil, err
+		}
+		if !isValidMapKeyType(keyType) {
+			return nil, fmt.Errorf("map key type %v cannot be used in a proto map", t.Key())
+		}
+		if isGoRepeated(t.Elem()) || t.Elem().Kind() == reflect.Map {
+			return nil, fmt.Errorf("map value type %v cannot be used in a proto map", t.Elem())
+		}
+		valType, err := m.fieldTypeFor(mb, sf.Name, t.Elem(), nil)
+		if err != nil {
+			return nil, err
+		}
+		if err := checkName(name); err != nil {
+			return nil, err
+		}
+		flb = NewMapField(name, keyType, valType)
+	case isGoRepeated(t):
+		elem := t.Elem()
+		if isGoRepeated(elem) || elem.Kind() == reflect.Map {
+			return nil, fmt.Errorf("type %v cannot be used in a repeated field", elem)
+		}
+		ft, err := m.fieldTypeFor(mb, sf.Name, elem, nil)
+		if err != nil {
+			return nil, err
+		}
+		if err := checkName(name); err != nil {
+			return nil, err
+		}
+		flb = NewField(name, ft).SetRepeated()
+	default:
+		var isPtr bool
+		ft, err := m.fieldTypeFor(mb, sf.Name, t, &isPtr)
+		if err != nil {
+			return nil, err
+		}
+		if err := checkName(name); err != nil {
+			return nil, err
+		}
+		flb = NewField(name, ft)
+		if isPtr && m.File.IsProto3 && ft.localMsgType == nil && ft.foreignMsgType == nil {
+			flb.SetProto3Optional(true)
+		}
+	}
+	if number != 0 {
+		if err := flb.TrySetNumber(number); err != nil {
+			return nil, err
+		}
+	}
+	if jsonName != "" {
+		flb.SetJsonName(jsonName)
+	}
+	return flb, nil
+}
+
+// fieldTypeFor returns the field type for the given Go type. If isPtr is not
+// nil, it is set to true if t is a pointer type.
+func (m *GoTypeMapper) fieldTypeFor(mb *MessageBuilder, fieldName string, t reflect.Type, isPtr *bool) (*FieldType, error) {
+	for t.Kind() == reflect.Ptr {
+		if isPtr != nil {
+			*isPtr = true
+		}
+		t = t.Elem()
+	}
+	switch {
+	case t == typeOfGoTime:
+		return wellKnownFieldType((*timestamppb.Timestamp)(nil))
+	case t == typeOfGoDuration:
+		return wellKnownFieldType((*durationpb.Duration)(nil))
+	case isGoTypeMessage(t):
+		return wellKnownFieldType(reflect.New(t).Interface().(proto.Message))
+	case isGoBytes(t):
+		return FieldTypeBytes(), nil
+	}
+	switch t.Kind() {
+	case reflect.Bool:
+		return FieldTypeBool(), nil
+	case reflect.String:
+		return FieldTypeString(), nil
+	case reflect.Float32:
+		return FieldTypeFloat(), nil
+	case reflect.Float64:
+		return FieldTypeDouble(), nil
+	case reflect.Int, reflect.Int64:
+		return FieldTypeInt64(), nil
+	case reflect.Int8, reflect.Int16, reflect.Int32:
+		return FieldTypeInt32(), nil
+	case reflect.Uint, reflect.Uint64, reflect.Uintptr:
+		return FieldTypeUInt64(), nil
+	case reflect.Uint8, reflect.Uint16, reflect.Uint32:
+		return FieldTypeUInt32(), nil
+	case reflect.Struct:
+		if nmb := m.types[t]; nmb != nil {
+			return FieldTypeMessage(nmb), nil
+		}
+		name := t.Name()
+		if name == "" {
+			// anonymous struct; name it after the field
+			name = fieldName
+		}
+		var parent *MessageBuilder
+		if m.NestMessages {
+			parent = mb
+		}
+		nmb, err := m.messageFor(t, name, parent)
+		if err != nil {
+			return nil, err
+		}
+		return FieldTypeMessage(nmb), nil
+	default:
+		return nil, fmt.Errorf("type %v cannot be represented in a proto message", t)
+	}
+}
+
+func wellKnownFieldType(msg proto.Message) (*FieldType, error) {
+	md, err := desc.WrapMessage(msg.ProtoReflect().Descriptor())
+	if err != nil {
+		return nil, err
+	}
+	return FieldTypeImportedMessage(md), nil
+}
+
+func isGoTypeMessage(t reflect.Type) bool {
+	return t.Kind() == reflect.Struct && reflect.PtrTo(t).Implements(typeOfProtoMsg)
+}
+
+func isGoBytes(t reflect.Type) bool {
+	return t == typeOfGoBytes ||
+		((t.Kind() == reflect.Slice || t.Kind() == reflect.Array) && t.Elem().Kind() == reflect.Uint8)
+}
+
+func isGoRepeated(t reflect.Type) bool {
+	return (t.Kind() == reflect.Slice || t.Kind() == reflect.Array) && !isGoBytes(t)
+}
+
+func isValidMapKeyType(ft *FieldType) bool {
+	switch ft.GetTypeName() {
+	case "":
+		return ft.fieldType != FieldTypeBytes().fieldType &&
+			ft.fieldType != FieldTypeFloat().fieldType &&
+			ft.fieldType != FieldTypeDouble().fieldType
+	default:
+		return false
+	}
+}
+
+// goTypeMessageName returns a valid message name for the given Go type or
+// field name, which starts with a capital letter.
+func goTypeMessageName(name string) string {
+	// generic type names can contain brackets and other punctuation
+	var sb strings.Builder
+	upper := true
+	for _, r := range name {
+		if r != '_' && !unicode.IsLetter(r) && !unicode.IsDigit(r) || r > unicode.MaxASCII {
+			upper = true
+			continue
+		}
+		if upper {
+			r = unicode.ToUpper(r)
+			upper = false
+		}
+		sb.WriteRune(r)
+	}
+	return sb.String()
+}
+
+// goFieldNameToProto converts a Go field name, which is in camel case, to snake
+// case. Runs of capital letters are treated as a single word, so "UserID"
+// becomes "user_id" and "HTTPServer" becomes "http_server".
+func goFieldNameToProto(name string) string {
+	runes := []rune(name)
+	var sb strings.Builder
+	for i, r := range runes {
+		if unicode.IsUpper(r) {
+			if i > 0 && (unicode.IsLower(runes[i-1]) || unicode.IsDigit(runes[i-1]) ||
+				(i+1 < len(runes) && unicode.IsLower(runes[i+1]) && unicode.IsUpper(runes[i-1]))) {
+				sb.WriteRune('_')
+			}
+			r = unicode.ToLower(r)
+		}
+		sb.WriteRune(r)
+	}
+	return sb.String()
+}
@@ -0,0 +1,193 @@
+package builder
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"google.golang.org/protobuf/types/descriptorpb"
+
+	"github.com/jhump/protoreflect/dynamic"
+	"github.com/jhump/protoreflect/internal/testprotos"
+	"github.com/jhump/protoreflect/internal/testutil"
+)
+
+type goTypesAddress struct {
+	Street string
+	Zip    uint16 `proto:"postal_code,10"`
+}
+
+type goTypesAudit struct {
+	CreatedAt time.Time
+	TTL       time.Duration
+}
+
+type goTypesPerson struct {
+	goTypesAudit
+	UserID   int64  `json:"uid"`
+	Name     string `proto:"full_name,1,json=name"`
+	Nickname *string
+	Scores   []float64
+	Avatar   []byte
+	Home     *goTypesAddress
+	Others   []goTypesAddress
+	Labels   map[string]int32
+	Friends  map[uint32]*goTypesPerson
+	Test     *testprotos.TestMessage
+	Ignored  chan int `proto:"-"`
+	internal int
+	Pet      struct {
+		Name string
+	}
+}
+
+func TestFromGoType(t *testing.T) {
+	mb, err := FromGoType(reflect.TypeOf(&goTypesPerson{}))
+	testutil.Ok(t, err)
+	testutil.Eq(t, "GoTypesPerson", mb.GetName())
+	fb := mb.GetFile()
+	testutil.Require(t, fb.IsProto3)
+	// referenced structs are top-level messages in the same file
+	testutil.Eq(t, mb, fb.GetMessage("GoTypesPerson"))
+	testutil.Require(t, fb.GetMessage("GoTypesAddress") != nil)
+	testutil.Require(t, fb.GetMessage("Pet") != nil)
+
+	md, err := mb.Build()
+	testutil.Ok(t, err)
+	var names []string
+	for _, fld := range md.GetFields() {
+		names = append(names, fld.GetName())
+	}
+	testutil.Eq(t, []string{"created_at", "ttl", "user_id", "full_name", "nickname", "scores", "avatar", "home", "others", "labels", "friends", "test", "pet"}, names)
+
+	fld := md.FindFieldByName("created_at")
+	testutil.Eq(t, "google.protobuf.Timestamp", fld.GetMessageType().GetFullyQualifiedName())
+	fld = md.FindFieldByName("ttl")
+	testutil.Eq(t, "google.protobuf.Duration", fld.GetMessageType().GetFullyQualifiedName())
+	fld = md.FindFieldByName("user_id")
+	testutil.Eq(t, descriptorpb.FieldDescriptorProto_TYPE_INT64, fld.GetType())
+	testutil.Eq(t, "uid", fld.GetJSONName())
+	fld = md.FindFieldByName("full_name")
+	testutil.Eq(t, int32(1), fld.GetNumber())
+	testutil.Eq(t, "name", fld.GetJSONName())
+	fld = md.FindFieldByName("nickname")
+	testutil.Require(t, fld.IsProto3Optional())
+	fld = md.FindFieldByName("scores")
+	testutil.Require(t, fld.IsRepeated())
+	testutil.Eq(t, descriptorpb.FieldDescriptorProto_TYPE_DOUBLE, fld.GetType())
+	fld = md.FindFieldByName("avatar")
+	testutil.Eq(t, descriptorpb.FieldDescriptorProto_TYPE_BYTES, fld.GetType())
+	testutil.Require(t, !fld.IsRepeated())
+	fld = md.FindFieldByName("home")
+	testutil.Require(t, !fld.IsProto3Optional())
+	testutil.Eq(t, "GoTypesAddress", fld.GetMessageType().GetFullyQualifiedName())
+	// shared types map to the same message
+	testutil.Eq(t, fld.GetMessageType(), md.FindFieldByName("others").GetMessageType())
+	fld = md.FindFieldByName("labels")
+	testutil.Require(t, fld.IsMap())
+	testutil.Eq(t, descriptorpb.FieldDescriptorProto_TYPE_INT32, fld.GetMapValueType().GetType())
+	// recursive types refer to the message itself
+	fld = md.FindFieldByName("friends")
+	testutil.Eq(t, descriptorpb.FieldDescriptorProto_TYPE_UINT32, fld.GetMapKeyType().GetType())
+	testutil.Eq(t, md, fld.GetMapValueType().GetMessageType())
+	fld = md.FindFieldByName("test")
+	testutil.Eq(t, "testprotos.TestMessage", fld.GetMessageType().GetFullyQualifiedName())
+
+	addr := md.GetFile().FindMessage("GoTypesAddress")
+	testutil.Eq(t, int32(10), addr.FindFieldByName("postal_code").GetNumber())
+	testutil.Eq(t, descriptorpb.FieldDescriptorProto_TYPE_UINT32, addr.FindFieldByName("postal_code").GetType())
+
+	// values round-trip between the struct and the message
+	nick := "Bob"
+	p := goTypesPerson{
+		goTypesAudit: goTypesAudit{CreatedAt: time.Date(2020, 1, 2, 3, 4, 5, 0, time.UTC), TTL: time.Hour},
+		UserID:       123,
+		Name:         "Robert",
+		Nickname:     &nick,
+		Home:         &goTypesAddress{Street: "Main", Zip: 12345},
+		Labels:       map[string]int32{"a": 1},
+		Friends:      map[uint32]*goTypesPerson{1: {Name: "Alice"}},
+	}
+	dm := dynamic.NewMessage(md)
+	testutil.Ok(t, dm.FromStruct(&p))
+	testutil.Eq(t, "Robert", dm.GetFieldByName("full_name"))
+	var p2 goTypesPerson
+	testutil.Ok(t, dm.ToStruct(&p2))
+	testutil.Require(t, reflect.DeepEqual(p, p2), "unexpected struct: %+v", p2)
+}
+
+func TestGoTypeMapper_NestMessages(t *testing.T) {
+	m := GoTypeMapper{File: NewFile("people.proto").SetPackageName("people"), NestMessages: true}
+	mb, err := m.MessageFor(reflect.TypeOf(goTypesPerson{}))
+	testutil.Ok(t, err)
+	testutil.Eq(t, m.File, mb.GetParent())
+	testutil.Require(t, mb.GetNestedMessage("GoTypesAddress") != nil)
+	testutil.Require(t, mb.GetNestedMessage("Pet") != nil)
+
+	// the same mapper returns the same builder, and adds other types to
+	// the same file
+	mb2, err := m.MessageFor(reflect.TypeOf(goTypesPerson{}))
+	testutil.Ok(t, err)
+	testutil.Eq(t, mb, mb2)
+	mb2, err = m.MessageFor(reflect.TypeOf(goTypesAudit{}))
+	testutil.Ok(t, err)
+	testutil.Eq(t, m.File, mb2.GetParent())
+
+	fd, err := m.File.Build()
+	testutil.Ok(t, err)
+	testutil.Require(t, fd.FindMessage("people.GoTypesPerson.GoTypesAddress") != nil)
+	testutil.Require(t, fd.FindMessage("people.GoTypesAudit") != nil)
+}
+
+func TestGoTypeMapper_Errors(t *testing.T) {
+	_, err := FromGoType(reflect.TypeOf(""))
+	testutil.Require(t, err != nil && strings.Contains(err.Error(), "not a struct"))
+
+	type badKind struct {
+		F func()
+	}
+	_, err = FromGoType(reflect.TypeOf(badKind{}))
+	testutil.Require(t, err != nil && strings.Contains(err.Error(), "badKind.F:"), "unexpected error: %v", err)
+
+	type nestedRepeated struct {
+		M [][]string
+	}
+	_, err = FromGoType(reflect.TypeOf(nestedRepeated{}))
+	testutil.Require(t, err != nil && strings.Contains(err.Error(), "repeated"), "unexpected error: %v", err)
+
+	type badMapKey struct {
+		M map[float64]string
+	}
+	_, err = FromGoType(reflect.TypeOf(badMapKey{}))
+	testutil.Require(t, err != nil && strings.Contains(err.Error(), "map key"), "unexpected error: %v", err)
+
+	type badNumber struct {
+		A string `proto:"a,1"`
+		B string `proto:"b,1"`
+	}
+	_, err = FromGoType(reflect.TypeOf(badNumber{}))
+	testutil.Require(t, err != nil && strings.Contains(err.Error(), "badNumber.B:"), "unexpected error: %v", err)
+
+	// a failed message is not left in the file
+	m := GoTypeMapper{}
+	type wrapper struct {
+		Bad badKind
+	}
+	_, err = m.MessageFor(reflect.TypeOf(wrapper{}))
+	testutil.Nok(t, err)
+	testutil.Eq(t, 0, len(m.File.GetChildren()))
+}
+
+func TestGoFieldNameToProto(t *testing.T) {
+	testCases := map[string]string{
+		"Name":       "name",
+		"UserID":     "user_id",
+		"HTTPServer": "http_server",
+		"Field2Name": "field2_name",
+		"ID":         "id",
+	}
+	for in, out := range testCases {
+		testutil.Eq(t, out, goFieldNameToProto(in), "wrong name for %s", in)
+	}
+}
@@ -0,0 +1,369 @@
+package builder
+
+import (
+	"fmt"
+	"sort"
+
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/types/descriptorpb"
+
+	"github.com/jhump/protoreflect/desc"
+	"github.com/jhump/protoreflect/desc/internal"
+)
+
+// FromFileOptions includes additional options to use when creating builders
+// from a file descriptor.
+type FromFileOptions struct {
+	// By default, builders only retain the parts of a descriptor that they
+	// model, so building a file builder created from a descriptor can produce
+	// a slightly different descriptor than the original: source code info has
+	// only comments, with no spans and no locations for anything other than
+	// whole elements; imports are sorted, and public and weak imports become
+	// regular imports; all fields get a JSON name; and the names of synthetic
+	// one-ofs for proto3 optional fields are re-computed.
+	//
+	// If this option is true, the builders instead retain these details, so
+	// that building the file before making any changes produces a descriptor
+	// that is identical to the original. After changes are made, the retained
+	// details are used wherever they still apply: elements keep their original
+	// source code locations, even if their position in the file changes, though
+	// an element's own location always reflects its current comments. New
+	// elements, and elements moved to another file, are built as if this option
+	// were false. The original
+	// order and kinds of imports are kept as long as the file still needs the
+	// same imports.
+	//
+	// Note that retained source code locations are not adjusted to account for
+	// changes, such as new names or new options, so they may no longer match
+	// the contents of the file.
+	Lossless bool
+}
+
+// FromFile returns a FileBuilder that is effectively a copy of the given
+// descriptor, according to these options. Using the FromFile function is
+// equivalent to using a zero-value FromFileOptions.
+func (opts FromFileOptions) FromFile(fd *desc.FileDescriptor) (*FileBuilder, error) {
+	fb, err := fromFile(fd)
+	if err != nil {
+		return nil, err
+	}
+	if opts.Lossless {
+		retainFileDetails(fb, fd)
+	}
+	return fb, nil
+}
+
+// losslessFile records details of a file descriptor that a file builder does
+// not otherwise model. All builders created from elements of the file refer to
+// the same instance, which is how they determine if they are being built as
+// part of the file from which they were created.
+type losslessFile struct {
+	hasSourceInfo bool
+	syntax        string
+	emptyPackage  bool
+	imports       []string
+	publicImports []int32
+	weakImports   []int32
+}
+
+// losslessInfo records details of the descriptor from which a builder was
+// created that builders do not otherwise model. These are only recorded when
+// builders are created using FromFileOptions with Lossless set.
+type losslessInfo struct {
+	file *losslessFile
+	// source code locations for the element and for parts of it that are
+	// not themselves builders; their paths are relative to the element
+	locations []retainedLocation
+
+	// the following are only used for fields
+	omitJsonName   bool
+	syntheticOneOf string
+}
+
+type retainedLocation struct {
+	// index in the original file's source code info
+	index int
+	loc   *descriptorpb.SourceCodeInfo_Location
+}
+
+func retainFileDetails(fb *FileBuilder, fd *desc.FileDescriptor) {
+	fdp := fd.AsFileDescriptorProto()
+	file := &losslessFile{
+		hasSourceInfo: fdp.SourceCodeInfo != nil,
+		syntax:        fdp.GetSyntax(),
+		emptyPackage:  fdp.Package != nil && fdp.GetPackage() == "",
+		imports:       fdp.Dependency,
+		publicImports: fdp.PublicDependency,
+		weakImports:   fdp.WeakDependency,
+	}
+
+	infos := map[string]*losslessInfo{}
+	newInfo := func(path []int32) *losslessInfo {
+		info := &losslessInfo{file: file}
+		infos[pathKey(path)] = info
+		return info
+	}
+
+	var path []int32
+	fb.lossless = newInfo(path)
+	for i, md := range fd.GetMessageTypes() {
+		retainMessageDetails(fb.GetMessage(md.GetName()), md, append(path, internal.File_messagesTag, int32(i)), newInfo)
+	}
+	for i, ed := range fd.GetEnumTypes() {
+		retainEnumDetails(fb.GetEnum(ed.GetName()), ed, append(path, internal.File_enumsTag, int32(i)), newInfo)
+	}
+	for i, exd := range fd.GetExtensions() {
+		retainFieldDetails(fb.GetExtension(exd.GetName()), exd, append(path, internal.File_extensionsTag, int32(i)), newInfo)
+	}
+	for i, sd := range fd.GetServices() {
+		sb := fb.GetService(sd.GetName())
+		sbPath := append(path, internal.File_servicesTag, int32(i))
+		sb.lossless = newInfo(sbPath)
+		for j, mtd := range sd.GetMethods() {
+			sb.GetMethod(mtd.GetName()).lossless = newInfo(append(sbPath, internal.Service_methodsTag, int32(j)))
+		}
+	}
+
+	// Each location belongs to the element with the longest path that is a
+	// prefix of the location's path. Locations for things that are not
+	// elements (like names, options, and reserved ranges) belong to their
+	// enclosing element.
+	for i, loc := range fdp.GetSourceCodeInfo().GetLocation() {
+		for n := len(loc.Path); n >= 0; n-- {
+			info := infos[pathKey(loc.Path[:n])]
+			if info == nil {
+				continue
+			}
+			rel := proto.Clone(loc).(*descriptorpb.SourceCodeInfo_Location)
+			rel.Path = append([]int32(nil), loc.Path[n:]...)
+			info.locations = append(info.locations, retainedLocation{index: i, loc: rel})
+			break
+		}
+	}
+}
+
+func retainMessageDetails(mb *MessageBuilder, md *desc.MessageDescriptor, path []int32, newInfo func([]int32) *losslessInfo) {
+	mb.lossless = newInfo(path)
+	for i, fld := range md.GetFields() {
+		retainFieldDetails(mb.GetField(fld.GetName()), fld, append(path, internal.Message_fieldsTag, int32(i)), newInfo)
+	}
+	for i, ood := range md.GetOneOfs() {
+		if oob := mb.GetOneOf(ood.GetName()); oob != nil {
+			oob.lossless = newInfo(append(path, internal.Message_oneOfsTag, int32(i)))
+		}
+	}
+	for i, nmd := range md.GetNestedMessageTypes() {
+		retainMessageDetails(mb.GetNestedMessage(nmd.GetName()), nmd, append(path, internal.Message_nestedMessagesTag, int32(i)), newInfo)
+	}
+	for i, ed := range md.GetNestedEnumTypes() {
+		retainEnumDetails(mb.GetNestedEnum(ed.GetName()), ed, append(path, internal.Message_enumsTag, int32(i)), newInfo)
+	}
+	for i, exd := range md.GetNestedExtensions() {
+		retainFieldDetails(mb.GetNestedExtension(exd.GetName()), exd, append(path, internal.Message_extensionsTag, int32(i)), newInfo)
+	}
+}
+
+func retainFieldDetails(flb *FieldBuilder, fld *desc.FieldDescriptor, path []int32, newInfo func([]int32) *losslessInfo) {
+	flb.lossless = newInfo(path)
+	if fld.AsFieldDescriptorProto().JsonName == nil {
+		flb.lossless.omitJsonName = true
+		flb.JsonName = ""
+	}
+	if ood := fld.GetOneOf(); ood != nil && ood.IsSynthetic() {
+		flb.lossless.syntheticOneOf = ood.GetName()
+	}
+}
+
+func retainEnumDetails(eb *EnumBuilder, ed *desc.EnumDescriptor, path []int32, newInfo func([]int32) *losslessInfo) {
+	eb.lossless = newInfo(path)
+	for i, evd := range ed.GetValues() {
+		eb.GetValue(evd.GetName()).lossless = newInfo(append(path, internal.Enum_valuesTag, int32(i)))
+	}
+}
+
+func pathKey(path []int32) string {
+	return fmt.Sprint(path)
+}
+
+// sourceInfoBuilder accumulates the source code info for a file as it is
+// built.
+type sourceInfoBuilder struct {
+	info descriptorpb.SourceCodeInfo
+	// if the file being built was created using FromFileOptions with Lossless
+	// set, the details retained for it
+	file *losslessFile
+	// for each location in info, the index of the location in the original
+	// file's source code info, or -1 if it is not a retained location
+	order []int
+}
+
+// retained returns true if the given details were retained from the file
+// being built, in which case they can be used when building it.
+func (sb *sourceInfoBuilder) retained(info *losslessInfo) bool {
+	return info != nil && sb.file != nil && info.file == sb.file
+}
+
+// addElement adds source code info for the element at the given path with the
+// given comments and retained details.
+func (sb *sourceInfoBuilder) addElement(path []int32, c *Comments, info *losslessInfo) {
+	if !sb.addRetained(path, c, info) {
+		sb.addComments(path, c)
+	}
+}
+
+// addRetained adds the given retained locations, with paths relative to the
+// given path, and returns true. The element's own location is updated to have
+// the given comments. If the given details cannot be used, it returns false.
+func (sb *sourceInfoBuilder) addRetained(path []int32, c *Comments, info *losslessInfo) bool {
+	if !sb.retained(info) {
+		return false
+	}
+	hasOwnLocation := false
+	for _, rl := range info.locations {
+		loc := proto.Clone(rl.loc).(*descriptorpb.SourceCodeInfo_Location)
+		loc.Path = append(append([]int32(nil), path...), rl.loc.Path...)
+		if len(rl.loc.Path) == 0 {
+			hasOwnLocation = true
+			setLocationComments(loc, c)
+		}
+		sb.info.Location = append(sb.info.Location, loc)
+		sb.order = append(sb.order, rl.index)
+	}
+	if !hasOwnLocation && !isEmptyComments(c) {
+		sb.addComments(path, c)
+	}
+	return true
+}
+
+// updateComments sets the comments of the most recently added location with
+// the given path. If there is no such location, one is added if the given
+// comments are not empty.
+func (sb *sourceInfoBuilder) updateComments(path []int32, c *Comments) {
+	for i := len(sb.info.Location) - 1; i >= 0; i-- {
+		if loc := sb.info.Location[i]; pathsEqual(loc.Path, path) {
+			setLocationComments(loc, c)
+			return
+		}
+	}
+	if !isEmptyComments(c) {
+		sb.addComments(path, c)
+	}
+}
+
+func (sb *sourceInfoBuilder) addComments(path []int32, c *Comments) {
+	addCommentsTo(&sb.info, path, c)
+	sb.order = append(sb.order, -1)
+}
+
+// build returns the accumulated source code info. If the file being built
+// retained its details, retained locations are put back into their original
+// order, and other locations are kept after the location that was added just
+// before them.
+func (sb *sourceInfoBuilder) build() *descriptorpb.SourceCodeInfo {
+	if sb.file == nil {
+		return &sb.info
+	}
+	if len(sb.info.Location) == 0 && !sb.file.hasSourceInfo {
+		return nil
+	}
+	keys := make([]int, len(sb.order))
+	key := -1
+	for i, index := range sb.order {
+		if index >= 0 {
+			key = index
+		}
+		keys[i] = key
+	}
+	sort.Stable(locationsByKey{locs: sb.info.Location, keys: keys})
+	return &sb.info
+}
+
+type locationsByKey struct {
+	locs []*descriptorpb.SourceCodeInfo_Location
+	keys []int
+}
+
+func (l locationsByKey) Len() int {
+	return len(l.locs)
+}
+
+func (l locationsByKey) Less(i, j int) bool {
+	return l.keys[i] < l.keys[j]
+}
+
+func (l locationsByKey) Swap(i, j int) {
+	l.locs[i], l.locs[j] = l.locs[j], l.locs[i]
+	l.keys[i], l.keys[j] = l.keys[j], l.keys[i]
+}
+
+func setLocationComments(loc *descriptorpb.SourceCodeInfo_Location, c *Comments) {
+	loc.LeadingDetachedComments = nil
+	if len(c.LeadingDetachedComments) > 0 {
+		loc.LeadingDetachedComments = append([]string(nil), c.LeadingDetachedComments...)
+	}
+	loc.LeadingComments = nil
+	if c.LeadingComment != "" {
+		loc.LeadingComments = proto.String(c.LeadingComment)
+	}
+	loc.TrailingComments = nil
+	if c.TrailingComment != "" {
+		loc.TrailingComments = proto.String(c.TrailingComment)
+	}
+}
+
+func isEmptyComments(c *Comments) bool {
+	return len(c.LeadingDetachedComments) == 0 && c.LeadingComment == "" && c.TrailingComment == ""
+}
+
+func pathsEqual(a, b []int32) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
+
+// importsFor returns the retained imports, if the given dependencies can
+// still be imported that way. The retained imports are all needed, and any
+// other dependency must be available via a public import.
+func (lf *losslessFile) importsFor(deps []*desc.FileDescriptor) (imports []string, public, weak []int32, ok bool) {
+	retained := make(map[string]struct{}, len(lf.imports))
+	for _, imp := range lf.imports {
+		retained[imp] = struct{}{}
+	}
+	available := map[string]struct{}{}
+	var addPublic func(fd *desc.FileDescriptor)
+	addPublic = func(fd *desc.FileDescriptor) {
+		for _, dep := range fd.GetPublicDependencies() {
+			if _, ok := available[dep.GetName()]; !ok {
+				available[dep.GetName()] = struct{}{}
+				addPublic(dep)
+			}
+		}
+	}
+	used := 0
+	for _, dep := range deps {
+		if _, ok := retained[dep.GetName()]; ok {
+			used++
+			addPublic(dep)
+		}
+	}
+	if used != len(retained) {
+		return nil, nil, nil, false
+	}
+	for _, dep := range deps {
+		_, isRetained := retained[dep.GetName()]
+		_, isAvailable := available[dep.GetName()]
+		if !isRetained && !isAvailable {
+			return nil, nil, nil, false
+		}
+	}
+	imports = append([]string(nil), lf.imports...)
+	public = append([]int32(nil), lf.publicImports...)
+	weak = append([]int32(nil), lf.weakImports...)
+	return imports, public, weak, true
+}
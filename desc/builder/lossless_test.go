@@ -0,0 +1,286 @@
+package builder
+
+import (
+	"io/ioutil"
+	"strings"
+	"testing"
+
+	"google.golang.org/protobuf/encoding/prototext"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/types/descriptorpb"
+
+	"github.com/jhump/protoreflect/desc"
+	_ "github.com/jhump/protoreflect/internal/testprotos"
+	_ "github.com/jhump/protoreflect/internal/testprotos/grpc"
+	"github.com/jhump/protoreflect/internal/testutil"
+)
+
+func TestFromFileOptions_Lossless(t *testing.T) {
+	files := []string{
+		"desc_test1.proto", "desc_test2.proto", "desc_test_comments.proto", "desc_test_complex.proto",
+		"desc_test_defaults.proto", "desc_test_field_types.proto", "desc_test_oneof.proto",
+		"desc_test_options.proto", "desc_test_proto3.proto", "desc_test_value.proto",
+		"desc_test_wellknowntypes.proto", "nopkg/desc_test_nopkg.proto", "nopkg/desc_test_nopkg_new.proto",
+		"pkg/desc_test_pkg.proto", "grpc/test.proto", "grpc/dummy.proto",
+	}
+	for _, name := range files {
+		t.Run(name, func(t *testing.T) {
+			fd, err := desc.LoadFileDescriptor(name)
+			testutil.Ok(t, err)
+			checkLosslessRoundTrip(t, fd)
+		})
+	}
+
+	protosets := []string{
+		"desc_test1.protoset", "desc_test_comments.protoset", "desc_test_complex.protoset",
+		"desc_test_complex_source_info.protoset", "desc_test_editions.protoset",
+		"proto3_optional/desc_test_proto3_optional.protoset", "descriptor.protoset", "duration.protoset",
+	}
+	for _, name := range protosets {
+		t.Run(name, func(t *testing.T) {
+			fd := loadProtosetWithImports(t, "../../internal/testprotos/"+name)
+			checkLosslessRoundTrip(t, fd)
+		})
+	}
+}
+
+// loadProtosetWithImports loads the last file in the given protoset. Any of
+// its imports that are not in the protoset are loaded from the global registry.
+func loadProtosetWithImports(t *testing.T, path string) *desc.FileDescriptor {
+	data, err := ioutil.ReadFile(path)
+	testutil.Ok(t, err)
+	var fds descriptorpb.FileDescriptorSet
+	testutil.Ok(t, proto.Unmarshal(data, &fds))
+	inSet := map[string]struct{}{}
+	for _, fdp := range fds.File {
+		inSet[fdp.GetName()] = struct{}{}
+	}
+	var deps []*desc.FileDescriptor
+	for _, fdp := range fds.File {
+		for _, dep := range fdp.Dependency {
+			if _, ok := inSet[dep]; !ok {
+				depFd, err := desc.LoadFileDescriptor(dep)
+				testutil.Ok(t, err)
+				deps = append(deps, depFd)
+			}
+		}
+	}
+	var fd *desc.FileDescriptor
+	files := map[string]*desc.FileDescriptor{}
+	for _, dep := range deps {
+		files[dep.GetName()] = dep
+	}
+	for _, fdp := range fds.File {
+		var fileDeps []*desc.FileDescriptor
+		for _, dep := range fdp.Dependency {
+			fileDeps = append(fileDeps, files[dep])
+		}
+		fd, err = desc.CreateFileDescriptor(fdp, fileDeps...)
+		testutil.Ok(t, err)
+		files[fd.GetName()] = fd
+	}
+	return fd
+}
+
+func checkLosslessRoundTrip(t *testing.T, fd *desc.FileDescriptor) {
+	fb, err := FromFileOptions{Lossless: true}.FromFile(fd)
+	testutil.Ok(t, err)
+	rebuilt, err := fb.Build()
+	testutil.Ok(t, err)
+	checkFilesIdentical(t, fd, rebuilt)
+
+	// a clone retains the same details
+	rebuilt, err = fb.Clone().Build()
+	testutil.Ok(t, err)
+	checkFilesIdentical(t, fd, rebuilt)
+}
+
+func checkFilesIdentical(t *testing.T, expected, actual *desc.FileDescriptor) {
+	exp, act := expected.AsFileDescriptorProto(), actual.AsFileDescriptorProto()
+	testutil.Require(t, proto.Equal(exp, act), "File %q failed round trip.\nExpecting: %s\nGot: %s\n",
+		expected.GetName(), prototext.Format(exp), prototext.Format(act))
+}
+
+func TestFromFileOptions_Lossless_Details(t *testing.T) {
+	timestamp, err := desc.LoadFileDescriptor("google/protobuf/timestamp.proto")
+	testutil.Ok(t, err)
+	duration, err := desc.LoadFileDescriptor("google/protobuf/duration.proto")
+	testutil.Ok(t, err)
+	empty, err := desc.LoadFileDescriptor("google/protobuf/empty.proto")
+	testutil.Ok(t, err)
+
+	str := descriptorpb.FieldDescriptorProto_TYPE_STRING.Enum()
+	optional := descriptorpb.FieldDescriptorProto_LABEL_OPTIONAL.Enum()
+	fdp := &descriptorpb.FileDescriptorProto{
+		Name:             proto.String("foo.proto"),
+		Package:          proto.String(""),
+		Syntax:           proto.String("proto3"),
+		Dependency:       []string{"google/protobuf/timestamp.proto", "google/protobuf/empty.proto", "google/protobuf/duration.proto"},
+		PublicDependency: []int32{2},
+		WeakDependency:   []int32{1},
+		MessageType: []*descriptorpb.DescriptorProto{
+			{
+				Name: proto.String("Foo"),
+				Field: []*descriptorpb.FieldDescriptorProto{
+					// no JSON names
+					{Name: proto.String("a_b"), Number: proto.Int32(1), Label: optional, Type: str, OneofIndex: proto.Int32(0)},
+					{Name: proto.String("c_d"), Number: proto.Int32(2), Label: optional, Type: str, OneofIndex: proto.Int32(0)},
+					{Name: proto.String("e_f"), Number: proto.Int32(3), Label: optional, Type: str},
+					// synthetic one-of that does not have the usual name
+					{Name: proto.String("g_h"), Number: proto.Int32(4), Label: optional, Type: str, OneofIndex: proto.Int32(1), Proto3Optional: proto.Bool(true), JsonName: proto.String("gH")},
+				},
+				OneofDecl: []*descriptorpb.OneofDescriptorProto{
+					{Name: proto.String("choice")},
+					{Name: proto.String("gh_presence")},
+				},
+			},
+		},
+		SourceCodeInfo: &descriptorpb.SourceCodeInfo{
+			Location: []*descriptorpb.SourceCodeInfo_Location{
+				{Path: []int32{}, Span: []int32{0, 0, 20, 1}},
+				{Path: []int32{12}, Span: []int32{0, 0, 18}, LeadingComments: proto.String(" syntax\n")},
+				{Path: []int32{4, 0}, Span: []int32{2, 0, 10, 1}, LeadingComments: proto.String(" Foo\n")},
+				{Path: []int32{4, 0, 1}, Span: []int32{2, 8, 11}},
+				{Path: []int32{4, 0, 8, 0}, Span: []int32{3, 2, 6, 3}},
+				{Path: []int32{4, 0, 2, 0}, Span: []int32{4, 4, 18}, TrailingComments: proto.String(" a_b\n")},
+				{Path: []int32{4, 0, 2, 2}, Span: []int32{5, 4, 18}},
+				{Path: []int32{4, 0, 2, 1}, Span: []int32{7, 2, 16}},
+				{Path: []int32{4, 0, 2, 3}, Span: []int32{8, 2, 25}},
+				{Path: []int32{3, 0}, Span: []int32{15, 0, 41}},
+			},
+		},
+	}
+	fd, err := desc.CreateFileDescriptor(fdp, timestamp, empty, duration)
+	testutil.Ok(t, err)
+
+	fb, err := FromFileOptions{Lossless: true}.FromFile(fd)
+	testutil.Ok(t, err)
+	rebuilt, err := fb.Build()
+	testutil.Ok(t, err)
+	checkFilesIdentical(t, fd, rebuilt)
+
+	// without the option, the details are lost
+	fb, err = FromFile(fd)
+	testutil.Ok(t, err)
+	rebuilt, err = fb.Build()
+	testutil.Ok(t, err)
+	actual := rebuilt.AsFileDescriptorProto()
+	testutil.Eq(t, []string{"google/protobuf/duration.proto", "google/protobuf/empty.proto", "google/protobuf/timestamp.proto"}, actual.Dependency)
+	testutil.Eq(t, 0, len(actual.PublicDependency))
+	testutil.Eq(t, 0, len(actual.WeakDependency))
+	md := actual.MessageType[0]
+	testutil.Eq(t, "aB", md.Field[0].GetJsonName())
+	testutil.Eq(t, "_g_h", md.OneofDecl[1].GetName())
+	testutil.Eq(t, []int32{0, 0, 0}, actual.SourceCodeInfo.Location[0].Span)
+}
+
+func TestFromFileOptions_Lossless_Changes(t *testing.T) {
+	fd, err := desc.LoadFileDescriptor("desc_test_comments.proto")
+	testutil.Ok(t, err)
+	fb, err := FromFileOptions{Lossless: true}.FromFile(fd)
+	testutil.Ok(t, err)
+
+	req := fb.GetMessage("Request")
+	req.SetComments(Comments{LeadingComment: " New comment\n"})
+	req.RemoveField("ids")
+	req.AddField(NewField("new_field", FieldTypeBool()).SetNumber(60).
+		SetComments(Comments{TrailingComment: " new field\n"}))
+	fb.AddMessage(NewMessage("NewMessage"))
+
+	rebuilt, err := fb.Build()
+	testutil.Ok(t, err)
+	orig, actual := fd.AsFileDescriptorProto(), rebuilt.AsFileDescriptorProto()
+
+	// imports are unchanged
+	testutil.Eq(t, orig.Dependency, actual.Dependency)
+	testutil.Eq(t, orig.PublicDependency, actual.PublicDependency)
+
+	locs := locationsByPath(orig.SourceCodeInfo)
+	newLocs := locationsByPath(actual.SourceCodeInfo)
+	// the message's own location has the new comments but the original span
+	reqLoc := newLocs["[4 0]"]
+	testutil.Require(t, reqLoc != nil)
+	testutil.Eq(t, " New comment\n", reqLoc.GetLeadingComments())
+	testutil.Eq(t, locs["[4 0]"].Span, reqLoc.Span)
+	// the message's name and options keep their original locations
+	testutil.Require(t, proto.Equal(locs["[4 0 1]"], newLocs["[4 0 1]"]))
+	testutil.Require(t, proto.Equal(locs["[4 0 7 7]"], newLocs["[4 0 7 7]"]))
+	// the removed field's locations are gone, and the next field's locations
+	// have new paths
+	fld := actual.MessageType[0].Field[0]
+	testutil.Eq(t, "name", fld.GetName())
+	testutil.Require(t, proto.Equal(withoutPath(locs["[4 0 2 1]"]), withoutPath(newLocs["[4 0 2 0]"])))
+	testutil.Require(t, proto.Equal(withoutPath(locs["[4 0 2 1 7]"]), withoutPath(newLocs["[4 0 2 0 7]"])))
+	// new elements just have comments
+	last := len(actual.MessageType[0].Field) - 1
+	fld = actual.MessageType[0].Field[last]
+	testutil.Eq(t, "new_field", fld.GetName())
+	testutil.Eq(t, "newField", fld.GetJsonName())
+	newFieldLoc := newLocs[pathKey([]int32{4, 0, 2, int32(last)})]
+	testutil.Eq(t, " new field\n", newFieldLoc.GetTrailingComments())
+	testutil.Eq(t, []int32{0, 0, 0}, newFieldLoc.Span)
+	testutil.Eq(t, "NewMessage", actual.MessageType[len(actual.MessageType)-1].GetName())
+
+	// when different imports are needed, they are re-computed
+	fb.AddMessage(NewMessage("Another").AddField(NewField("ts", FieldTypeImportedMessage(mustLoadMessage(t, "google.protobuf.Timestamp")))))
+	rebuilt, err = fb.Build()
+	testutil.Ok(t, err)
+	testutil.Eq(t, []string{"desc_test_options.proto", "google/protobuf/empty.proto", "google/protobuf/timestamp.proto"}, rebuilt.AsFileDescriptorProto().Dependency)
+	testutil.Eq(t, 0, len(rebuilt.AsFileDescriptorProto().PublicDependency))
+
+	// elements moved to another file lose their retained details
+	other := NewFile("other.proto")
+	fb.RemoveMessage("Request")
+	other.AddMessage(req)
+	rebuilt, err = other.Build()
+	testutil.Ok(t, err)
+	newLocs = locationsByPath(rebuilt.AsFileDescriptorProto().SourceCodeInfo)
+	testutil.Eq(t, []int32{0, 0, 0}, newLocs["[4 0]"].Span)
+	testutil.Require(t, newLocs["[4 0 1]"] == nil)
+}
+
+func locationsByPath(sci *descriptorpb.SourceCodeInfo) map[string]*descriptorpb.SourceCodeInfo_Location {
+	locs := map[string]*descriptorpb.SourceCodeInfo_Location{}
+	for _, loc := range sci.GetLocation() {
+		key := pathKey(loc.Path)
+		if _, ok := locs[key]; !ok {
+			locs[key] = loc
+		}
+	}
+	return locs
+}
+
+func withoutPath(loc *descriptorpb.SourceCodeInfo_Location) *descriptorpb.SourceCodeInfo_Location {
+	loc = proto.Clone(loc).(*descriptorpb.SourceCodeInfo_Location)
+	loc.Path = nil
+	return loc
+}
+
+func mustLoadMessage(t *testing.T, name string) *desc.MessageDescriptor {
+	md, err := desc.LoadMessageDescriptor(name)
+	testutil.Ok(t, err)
+	return md
+}
+
+func TestFromFileOptions_Lossless_Proto3OptionalExtension(t *testing.T) {
+	fd := loadProtosetWithImports(t, "../../internal/testprotos/proto3_optional/desc_test_proto3_optional.protoset")
+	exd := fd.FindExtensionByName("some_custom_options")
+	testutil.Require(t, exd != nil && exd.IsProto3Optional())
+
+	// only allowed for extensions retained in lossless mode
+	fb, err := FromFile(fd)
+	testutil.Ok(t, err)
+	_, err = fb.Build()
+	testutil.Require(t, err != nil && strings.Contains(err.Error(), "extensions cannot be proto3 optional fields"), "unexpected error: %v", err)
+
+	fb, err = FromFileOptions{Lossless: true}.FromFile(fd)
+	testutil.Ok(t, err)
+	rebuilt, err := fb.Build()
+	testutil.Ok(t, err)
+	testutil.Require(t, rebuilt.FindExtensionByName("some_custom_options").IsProto3Optional())
+
+	// an extension added to a lossless file is checked as usual
+	fb.AddExtension(NewExtensionImported("more_options", 44445, FieldTypeString(), exd.GetOwner()).SetProto3Optional(true))
+	_, err = fb.Build()
+	testutil.Require(t, err != nil && strings.Contains(err.Error(), "extensions cannot be proto3 optional fields"), "unexpected error: %v", err)
+}
@@ -2,7 +2,6 @@ package builder
 
 import (
 	"fmt"
-	"sort"
 
 	"google.golang.org/protobuf/proto"
 	"google.golang.org/protobuf/types/descriptorpb"
@@ -27,6 +26,15 @@ type MessageBuilder struct {
 	ReservedRanges  []*descriptorpb.DescriptorProto_ReservedRange
 	ReservedNames   []string
 
+	// The strategy used to assign tags to fields that have none when the
+	// message is built.
+	TagStrategy TagStrategy
+
+	// If true, adding a field, or changing a field's name or tag, such that it
+	// uses a reserved name or tag is rejected immediately. Otherwise, such
+	// conflicts are only reported when the message is built.
+	EnforceReservations bool
+
 	fieldsAndOneOfs  []Builder
 	fieldTags        map[int32]*FieldBuilder
 	nestedMessages   []*MessageBuilder
@@ -237,6 +245,9 @@ func (mb *MessageBuilder) renamedChild(b Builder, oldName string) error {
 		return nil
 	}
 
+	if flb, ok := b.(*FieldBuilder); ok && !flb.IsExtension() && mb.EnforceReservations && mb.isReservedName(flb.GetName()) {
+		return fmt.Errorf("message %s has reserved field name %q", GetFullyQualifiedName(mb), flb.GetName())
+	}
 	if err := mb.addSymbol(b); err != nil {
 		return err
 	}
@@ -256,6 +267,9 @@ func (mb *MessageBuilder) addTag(flb *FieldBuilder) error {
 	if flb.number == 0 {
 		return nil
 	}
+	if mb.EnforceReservations && mb.isReservedTag(flb.GetNumber()) {
+		return fmt.Errorf("message %s has reserved tag %d, so it cannot be used by field %s", GetFullyQualifiedName(mb), flb.GetNumber(), flb.GetName())
+	}
 	if ex, ok := mb.fieldTags[flb.GetNumber()]; ok {
 		return fmt.Errorf("message %s already contains field with tag %d: %s", GetFullyQualifiedName(mb), flb.GetNumber(), ex.GetName())
 	}
@@ -264,6 +278,9 @@ func (mb *MessageBuilder) addTag(flb *FieldBuilder) error {
 }
 
 func (mb *MessageBuilder) registerField(flb *FieldBuilder) error {
+	if mb.EnforceReservations && mb.isReservedName(flb.GetName()) {
+		return fmt.Errorf("message %s has reserved field name %q", GetFullyQualifiedName(mb), flb.GetName())
+	}
 	if err := mb.addSymbol(flb); err != nil {
 		return err
 	}
@@ -315,6 +332,93 @@ func (mb *MessageBuilder) TryRemoveField(name string) bool {
 	return false
 }
 
+// RemoveFieldAndReserve removes the field with the given name and then reserves
+// the field's name and tag, so that they cannot accidentally be re-used by
+// another field. If no such field exists in the message, this is a no-op. This
+// returns the message builder, for method chaining.
+func (mb *MessageBuilder) RemoveFieldAndReserve(name string) *MessageBuilder {
+	mb.TryRemoveFieldAndReserve(name)
+	return mb
+}
+
+// TryRemoveFieldAndReserve removes the field with the given name and returns
+// false if the message has no such field. Like RemoveFieldAndReserve, the
+// removed field's name and tag are reserved. The tag is added to the message's
+// reserved ranges, merging it with any adjacent or overlapping range. If the
+// field has no tag (because it would be auto-assigned when built), only its
+// name is reserved.
+func (mb *MessageBuilder) TryRemoveFieldAndReserve(name string) bool {
+	b := mb.symbols[name]
+	flb, ok := b.(*FieldBuilder)
+	if !ok || flb.IsExtension() {
+		return false
+	}
+	flb.GetParent().removeChild(flb)
+	mb.reserveField(flb)
+	return true
+}
+
+func (mb *MessageBuilder) reserveField(flb *FieldBuilder) {
+	if !mb.isReservedName(flb.GetName()) {
+		mb.ReservedNames = append(mb.ReservedNames, flb.GetName())
+	}
+	if flb.number != 0 && !mb.isReservedTag(flb.number) {
+		mb.ReservedRanges = addReservedTag(mb.ReservedRanges, flb.number)
+	}
+}
+
+func (mb *MessageBuilder) isReservedName(name string) bool {
+	for _, n := range mb.ReservedNames {
+		if n == name {
+			return true
+		}
+	}
+	return false
+}
+
+func (mb *MessageBuilder) isReservedTag(tag int32) bool {
+	for _, rr := range mb.ReservedRanges {
+		if tag >= rr.GetStart() && tag < rr.GetEnd() {
+			return true
+		}
+	}
+	return false
+}
+
+// addReservedTag adds the given tag to the given reserved ranges, merging it
+// with any ranges that it overlaps or abuts.
+func addReservedTag(ranges []*descriptorpb.DescriptorProto_ReservedRange, tag int32) []*descriptorpb.DescriptorProto_ReservedRange {
+	start, end := tag, tag+1
+	var merged []*descriptorpb.DescriptorProto_ReservedRange
+	pos := -1
+	for _, rr := range ranges {
+		if rr.GetEnd() < start || rr.GetStart() > end {
+			merged = append(merged, rr)
+			continue
+		}
+		if pos < 0 {
+			pos = len(merged)
+		}
+		if rr.GetStart() < start {
+			start = rr.GetStart()
+		}
+		if rr.GetEnd() > end {
+			end = rr.GetEnd()
+		}
+	}
+	rr := &descriptorpb.DescriptorProto_ReservedRange{
+		Start: proto.Int32(start),
+		End:   proto.Int32(end),
+	}
+	if pos < 0 {
+		return append(merged, rr)
+	}
+	merged = append(merged, nil)
+	copy(merged[pos+1:], merged[pos:])
+	merged[pos] = rr
+	return merged
+}
+
 // AddField adds the given field to this message. If an error prevents the field
 // from being added, this method panics. If the given field is an extension,
 // this method panics. This returns the message builder, for method chaining.
@@ -383,6 +487,31 @@ func (mb *MessageBuilder) TryRemoveOneOf(name string) bool {
 	return false
 }
 
+// RemoveOneOfAndReserve removes the one-of with the given name and then
+// reserves the names and tags of all of its fields, in the same way as
+// RemoveFieldAndReserve. If no such one-of exists in the message, this is a
+// no-op. This returns the message builder, for method chaining.
+func (mb *MessageBuilder) RemoveOneOfAndReserve(name string) *MessageBuilder {
+	mb.TryRemoveOneOfAndReserve(name)
+	return mb
+}
+
+// TryRemoveOneOfAndReserve removes the one-of with the given name and returns
+// false if the message has no such one-of. Like RemoveOneOfAndReserve, the
+// names and tags of the one-of's fields are reserved.
+func (mb *MessageBuilder) TryRemoveOneOfAndReserve(name string) bool {
+	b := mb.symbols[name]
+	oob, ok := b.(*OneOfBuilder)
+	if !ok {
+		return false
+	}
+	mb.removeChild(oob)
+	for _, flb := range oob.choices {
+		mb.reserveField(flb)
+	}
+	return true
+}
+
 // AddOneOf adds the given one-of to this message. If an error prevents the
 // one-of from being added, this method panics. This returns the message
 // builder, for method chaining.
@@ -420,6 +549,113 @@ func (mb *MessageBuilder) TryAddOneOf(oob *OneOfBuilder) error {
 	return nil
 }
 
+// ExtractFields moves the named fields and one-ofs of this message into a new
+// message with the given name, nested inside this message, and adds a field
+// with the given field name whose type is the new message. If an error prevents
+// the fields from being extracted, this method panics. This returns the new
+// nested message.
+func (mb *MessageBuilder) ExtractFields(msgName, fieldName string, names ...string) *MessageBuilder {
+	nmb, err := mb.TryExtractFields(msgName, fieldName, names...)
+	if err != nil {
+		panic(err)
+	}
+	return nmb
+}
+
+// TryExtractFields moves the named fields and one-ofs of this message into a
+// new message with the given name, nested inside this message, and adds a field
+// with the given field name whose type is the new message. The extracted
+// elements retain their order, tags, options, and comments. The new field has
+// no tag, so one will be auto-assigned when the descriptor is built unless
+// SetNumber is called on it (which can be retrieved via GetField).
+//
+// The names must refer to direct children of this message: fields that belong
+// to a one-of cannot be extracted on their own, but the whole one-of can be.
+// The new message and field names may re-use the names of extracted elements.
+// If an error is returned, this message is unchanged.
+func (mb *MessageBuilder) TryExtractFields(msgName, fieldName string, names ...string) (*MessageBuilder, error) {
+	if err := checkName(msgName); err != nil {
+		return nil, err
+	}
+	if err := checkName(fieldName); err != nil {
+		return nil, err
+	}
+	if msgName == fieldName {
+		return nil, fmt.Errorf("cannot use %q as name of both field and message", msgName)
+	}
+	if len(names) == 0 {
+		return nil, fmt.Errorf("no fields to extract from message %s", GetFullyQualifiedName(mb))
+	}
+	extracted := map[string]struct{}{}
+	for _, name := range names {
+		switch b := mb.symbols[name].(type) {
+		case *FieldBuilder:
+			if b.IsExtension() {
+				return nil, fmt.Errorf("cannot extract extension %s", GetFullyQualifiedName(b))
+			}
+			if oob, ok := b.GetParent().(*OneOfBuilder); ok {
+				return nil, fmt.Errorf("cannot extract field %s without the rest of one-of %s", GetFullyQualifiedName(b), oob.GetName())
+			}
+		case *OneOfBuilder:
+		default:
+			return nil, fmt.Errorf("message %s has no field or one-of named %q", GetFullyQualifiedName(mb), name)
+		}
+		if _, ok := extracted[name]; ok {
+			return nil, fmt.Errorf("field %q named more than once", name)
+		}
+		extracted[name] = struct{}{}
+	}
+	// a name is available if it is unused or will be freed by the extraction
+	isAvailable := func(name string) bool {
+		var owner Builder
+		switch b := mb.symbols[name].(type) {
+		case nil:
+			return true
+		case *MessageBuilder:
+			// could be a map entry or group type of an extracted field
+			owner = b.GetParent()
+		case *FieldBuilder:
+			// could be a choice in an extracted one-of
+			owner = b
+			if oob, ok := b.GetParent().(*OneOfBuilder); ok {
+				owner = oob
+			}
+		case *OneOfBuilder:
+			owner = b
+		}
+		if owner == nil || owner == mb {
+			return false
+		}
+		_, ok := extracted[owner.GetName()]
+		return ok
+	}
+	if mb.isReservedName(fieldName) {
+		return nil, fmt.Errorf("message %s has reserved field name %q", GetFullyQualifiedName(mb), fieldName)
+	}
+	for _, name := range []string{msgName, fieldName} {
+		if !isAvailable(name) {
+			return nil, fmt.Errorf("message %s already contains element (%T) named %q", GetFullyQualifiedName(mb), mb.symbols[name], name)
+		}
+	}
+
+	nmb := NewMessage(msgName)
+	// iterate over a copy since extracting elements modifies the slice
+	for _, b := range append([]Builder(nil), mb.fieldsAndOneOfs...) {
+		if _, ok := extracted[b.GetName()]; !ok {
+			continue
+		}
+		// these cannot fail since all names and tags were unique in mb
+		if flb, ok := b.(*FieldBuilder); ok {
+			nmb.AddField(flb)
+		} else {
+			nmb.AddOneOf(b.(*OneOfBuilder))
+		}
+	}
+	mb.AddNestedMessage(nmb)
+	mb.AddField(NewField(fieldName, FieldTypeMessage(nmb)))
+	return nmb, nil
+}
+
 // GetNestedMessage returns the nested message with the given name. If no such
 // message exists, nil is returned. The named message must be in this message's
 // scope. If the message is nested more deeply, this will return nil. This means
@@ -622,6 +858,104 @@ func (mb *MessageBuilder) SetOptions(options *descriptorpb.MessageOptions) *Mess
 	return mb
 }
 
+// SetFeatures sets the feature overrides in the options for this message and
+// returns the message, for method chaining.
+func (mb *MessageBuilder) SetFeatures(features *descriptorpb.FeatureSet) *MessageBuilder {
+	var options *descriptorpb.MessageOptions
+	if mb.Options != nil {
+		options = proto.Clone(mb.Options).(*descriptorpb.MessageOptions)
+	} else {
+		options = &descriptorpb.MessageOptions{}
+	}
+	options.Features = features
+	mb.Options = options
+	return mb
+}
+
+// SetOption sets the custom option described by the given extension to the
+// given value and returns the message, for method chaining. The value may be any
+// value accepted by dynamic.Message.TrySetField for the extension, such as a Go
+// scalar or, for message types, a *dynamic.Message. If the value is not valid,
+// this method panics. The existing options, if any, are copied so the change
+// is not visible to other builders or descriptors that share them. When the
+// message is built, the file that defines the extension is added as a
+// dependency.
+func (mb *MessageBuilder) SetOption(extd *desc.FieldDescriptor, val interface{}) *MessageBuilder {
+	if err := mb.TrySetOption(extd, val); err != nil {
+		panic(err)
+	}
+	return mb
+}
+
+// TrySetOption sets the custom option described by the given extension to the
+// given value, returning an error if the extension does not extend
+// MessageOptions or if the value is not valid for it.
+func (mb *MessageBuilder) TrySetOption(extd *desc.FieldDescriptor, val interface{}) error {
+	return setOption(mb, extd, val)
+}
+
+// SetOptionByName sets the custom option with the given fully-qualified name
+// to the given value and returns the message, for method chaining. If an error
+// prevents the option from being set, this method panics.
+//
+// See TrySetOptionByName for how the option's extension is found.
+func (mb *MessageBuilder) SetOptionByName(name string, val interface{}) *MessageBuilder {
+	if err := mb.TrySetOptionByName(name, val); err != nil {
+		panic(err)
+	}
+	return mb
+}
+
+// TrySetOptionByName sets the custom option with the given fully-qualified name
+// to the given value, returning any error that prevents the option from being
+// set. The extension for the option is found among options already set on
+// this message, the explicit imports of its file, the dependencies of the file
+// from which it was created (if created with FromFile), and extensions linked
+// into the current program. If the extension cannot be found, the value is
+// retained and the option is set when the message is built, at which point the
+// extension may also be found in BuilderOptions.Extensions or in any other
+// file on which the message's file depends. An error is reported then if the
+// extension still cannot be found or the value is not valid for it.
+func (mb *MessageBuilder) TrySetOptionByName(name string, val interface{}) error {
+	return setOptionByName(mb, name, val)
+}
+
+// GetOption returns the value of the custom option described by the given
+// extension. If the option is not set, nil is returned. Values for message
+// types are returned as *dynamic.Message.
+func (mb *MessageBuilder) GetOption(extd *desc.FieldDescriptor) (interface{}, error) {
+	return getOption(mb, extd)
+}
+
+// GetOptionByName returns the value of the custom option with the given
+// fully-qualified name. If the option is not set, nil is returned. An error is
+// returned if the option's extension cannot be found.
+func (mb *MessageBuilder) GetOptionByName(name string) (interface{}, error) {
+	return getOptionByName(mb, name)
+}
+
+// ClearOption removes the custom option described by the given extension and
+// returns the message, for method chaining.
+func (mb *MessageBuilder) ClearOption(extd *desc.FieldDescriptor) *MessageBuilder {
+	clearOption(mb, extd)
+	return mb
+}
+
+// ClearOptionByName removes the custom option with the given fully-qualified
+// name and returns the message, for method chaining.
+func (mb *MessageBuilder) ClearOptionByName(name string) *MessageBuilder {
+	clearOptionByName(mb, name)
+	return mb
+}
+
+func (mb *MessageBuilder) getOptions() proto.Message {
+	return mb.Options
+}
+
+func (mb *MessageBuilder) setOptions(opts proto.Message) {
+	mb.Options = opts.(*descriptorpb.MessageOptions)
+}
+
 // AddExtensionRange adds the given extension range to this message. The range
 // is inclusive of both the start and end, just like defining a range in proto
 // IDL source. This returns the message, for method chaining.
@@ -654,14 +988,34 @@ func (mb *MessageBuilder) SetExtensionRanges(ranges []*descriptorpb.DescriptorPr
 
 // AddReservedRange adds the given reserved range to this message. The range is
 // inclusive of both the start and end, just like defining a range in proto IDL
-// source. This returns the message, for method chaining.
+// source. If an error prevents the range from being added (see
+// TryAddReservedRange), this method panics. This returns the message, for
+// method chaining.
 func (mb *MessageBuilder) AddReservedRange(start, end int32) *MessageBuilder {
+	if err := mb.TryAddReservedRange(start, end); err != nil {
+		panic(err)
+	}
+	return mb
+}
+
+// TryAddReservedRange adds the given reserved range to this message, which is
+// inclusive of both the start and end. If the message enforces reservations
+// (see EnforceReservations), an error is returned if a field in the message
+// already uses a tag in the range.
+func (mb *MessageBuilder) TryAddReservedRange(start, end int32) error {
+	if mb.EnforceReservations {
+		for tag, flb := range mb.fieldTags {
+			if tag >= start && tag <= end {
+				return fmt.Errorf("message %s cannot reserve tag %d; it is used by field %s", GetFullyQualifiedName(mb), tag, flb.GetName())
+			}
+		}
+	}
 	rr := &descriptorpb.DescriptorProto_ReservedRange{
 		Start: proto.Int32(start),
 		End:   proto.Int32(end + 1),
 	}
 	mb.ReservedRanges = append(mb.ReservedRanges, rr)
-	return mb
+	return nil
 }
 
 // SetReservedRanges replaces all of this message's reserved ranges with the
@@ -676,12 +1030,30 @@ func (mb *MessageBuilder) SetReservedRanges(ranges []*descriptorpb.DescriptorPro
 }
 
 // AddReservedName adds the given name to the list of reserved field names for
-// this message. This returns the message, for method chaining.
+// this message. If an error prevents the name from being added (see
+// TryAddReservedName), this method panics. This returns the message, for
+// method chaining.
 func (mb *MessageBuilder) AddReservedName(name string) *MessageBuilder {
-	mb.ReservedNames = append(mb.ReservedNames, name)
+	if err := mb.TryAddReservedName(name); err != nil {
+		panic(err)
+	}
 	return mb
 }
 
+// TryAddReservedName adds the given name to the list of reserved field names
+// for this message. If the message enforces reservations (see
+// EnforceReservations), an error is returned if a field in the message already
+// uses the name.
+func (mb *MessageBuilder) TryAddReservedName(name string) error {
+	if mb.EnforceReservations {
+		if flb, ok := mb.symbols[name].(*FieldBuilder); ok && !flb.IsExtension() {
+			return fmt.Errorf("message %s cannot reserve name %q; it is used by a field", GetFullyQualifiedName(mb), name)
+		}
+	}
+	mb.ReservedNames = append(mb.ReservedNames, name)
+	return nil
+}
+
 // SetReservedNames replaces all of this message's reserved field names with the
 // given slice of names. This returns the message, for method chaining.
 func (mb *MessageBuilder) SetReservedNames(names []string) *MessageBuilder {
@@ -689,8 +1061,8 @@ func (mb *MessageBuilder) SetReservedNames(names []string) *MessageBuilder {
 	return mb
 }
 
-func (mb *MessageBuilder) buildProto(path []int32, sourceInfo *descriptorpb.SourceCodeInfo) (*descriptorpb.DescriptorProto, error) {
-	addCommentsTo(sourceInfo, path, &mb.comments)
+func (mb *MessageBuilder) buildProto(path []int32, sourceInfo *sourceInfoBuilder, rep *errorReporter) (*descriptorpb.DescriptorProto, error) {
+	sourceInfo.addElement(path, &mb.comments, mb.lossless)
 
 	var needTagsAssigned []*descriptorpb.FieldDescriptorProto
 	nestedMessages := make([]*descriptorpb.DescriptorProto, 0, len(mb.nestedMessages))
@@ -711,7 +1083,7 @@ func (mb *MessageBuilder) buildProto(path []int32, sourceInfo *descriptorpb.Sour
 		}
 		if flb.msgType != nil {
 			nmpath := append(path, internal.Message_nestedMessagesTag, int32(len(nestedMessages)))
-			if entry, err := flb.msgType.buildProto(nmpath, sourceInfo); err != nil {
+			if entry, err := flb.msgType.buildProto(nmpath, sourceInfo, rep); err != nil {
 				return err
 			} else {
 				nestedMessages = append(nestedMessages, entry)
@@ -720,13 +1092,15 @@ func (mb *MessageBuilder) buildProto(path []int32, sourceInfo *descriptorpb.Sour
 		return nil
 	}
 
+	fieldBuilders := map[*descriptorpb.FieldDescriptorProto]*FieldBuilder{}
 	for _, b := range mb.fieldsAndOneOfs {
 		if flb, ok := b.(*FieldBuilder); ok {
 			fldpath := append(path, internal.Message_fieldsTag, int32(len(fields)))
-			fld, err := flb.buildProto(fldpath, sourceInfo, mb.Options.GetMessageSetWireFormat())
+			fld, err := flb.buildProto(fldpath, sourceInfo, mb.Options.GetMessageSetWireFormat(), rep)
 			if err != nil {
 				return nil, err
 			}
+			fieldBuilders[fld] = flb
 			if err := addField(flb, fld); err != nil {
 				return nil, err
 			}
@@ -734,18 +1108,19 @@ func (mb *MessageBuilder) buildProto(path []int32, sourceInfo *descriptorpb.Sour
 			oopath := append(path, internal.Message_oneOfsTag, int32(len(oneOfs)))
 			oob := b.(*OneOfBuilder)
 			oobIndex := len(oneOfs)
-			ood, err := oob.buildProto(oopath, sourceInfo)
+			ood, err := oob.buildProto(oopath, sourceInfo, rep)
 			if err != nil {
 				return nil, err
 			}
 			oneOfs = append(oneOfs, ood)
 			for _, flb := range oob.choices {
 				path := append(path, internal.Message_fieldsTag, int32(len(fields)))
-				fld, err := flb.buildProto(path, sourceInfo, mb.Options.GetMessageSetWireFormat())
+				fld, err := flb.buildProto(path, sourceInfo, mb.Options.GetMessageSetWireFormat(), rep)
 				if err != nil {
 					return nil, err
 				}
 				fld.OneofIndex = proto.Int32(int32(oobIndex))
+				fieldBuilders[fld] = flb
 				if err := addField(flb, fld); err != nil {
 					return nil, err
 				}
@@ -754,31 +1129,22 @@ func (mb *MessageBuilder) buildProto(path []int32, sourceInfo *descriptorpb.Sour
 	}
 
 	if len(needTagsAssigned) > 0 {
-		tags := make([]int, len(fields)-len(needTagsAssigned))
-		tagsIndex := 0
-		for _, fld := range fields {
-			tag := fld.GetNumber()
-			if tag != 0 {
-				tags[tagsIndex] = int(tag)
-				tagsIndex++
-			}
-		}
-		sort.Ints(tags)
-		t := 1
-		for len(needTagsAssigned) > 0 {
-			for len(tags) > 0 && t == tags[0] {
-				t++
-				tags = tags[1:]
+		tags := mb.newTagAllocator()
+		for _, fld := range needTagsAssigned {
+			tag, err := tags.allocate(fld.GetName(), mb.TagStrategy)
+			if err != nil {
+				if err := rep.report(mb, CategoryInvalidTag, err); err != nil {
+					return nil, err
+				}
+				break
 			}
-			needTagsAssigned[0].Number = proto.Int32(int32(t))
-			needTagsAssigned = needTagsAssigned[1:]
-			t++
+			fld.Number = proto.Int32(tag)
 		}
 	}
 
 	for _, nmb := range mb.nestedMessages {
 		path := append(path, internal.Message_nestedMessagesTag, int32(len(nestedMessages)))
-		if nmd, err := nmb.buildProto(path, sourceInfo); err != nil {
+		if nmd, err := nmb.buildProto(path, sourceInfo, rep); err != nil {
 			return nil, err
 		} else {
 			nestedMessages = append(nestedMessages, nmd)
@@ -788,7 +1154,7 @@ func (mb *MessageBuilder) buildProto(path []int32, sourceInfo *descriptorpb.Sour
 	nestedExtensions := make([]*descriptorpb.FieldDescriptorProto, 0, len(mb.nestedExtensions))
 	for _, exb := range mb.nestedExtensions {
 		path := append(path, internal.Message_extensionsTag, int32(len(nestedExtensions)))
-		if exd, err := exb.buildProto(path, sourceInfo, isExtendeeMessageSet(exb)); err != nil {
+		if exd, err := exb.buildProto(path, sourceInfo, isExtendeeMessageSet(exb), rep); err != nil {
 			return nil, err
 		} else {
 			nestedExtensions = append(nestedExtensions, exd)
@@ -798,7 +1164,7 @@ func (mb *MessageBuilder) buildProto(path []int32, sourceInfo *descriptorpb.Sour
 	nestedEnums := make([]*descriptorpb.EnumDescriptorProto, 0, len(mb.nestedEnums))
 	for _, eb := range mb.nestedEnums {
 		path := append(path, internal.Message_enumsTag, int32(len(nestedEnums)))
-		if ed, err := eb.buildProto(path, sourceInfo); err != nil {
+		if ed, err := eb.buildProto(path, sourceInfo, rep); err != nil {
 			return nil, err
 		} else {
 			nestedEnums = append(nestedEnums, ed)
@@ -818,8 +1184,9 @@ func (mb *MessageBuilder) buildProto(path []int32, sourceInfo *descriptorpb.Sour
 		ReservedRange:  mb.ReservedRanges,
 	}
 
-	if mb.GetFile().IsProto3 {
+	if mb.GetFile().isProto3() {
 		internal.ProcessProto3OptionalFields(md, nil)
+		restoreSyntheticOneOfNames(md, fieldBuilders, sourceInfo)
 	}
 
 	return md, nil
@@ -844,3 +1211,39 @@ func (mb *MessageBuilder) Build() (*desc.MessageDescriptor, error) {
 func (mb *MessageBuilder) BuildDescriptor() (desc.Descriptor, error) {
 	return doBuild(mb, BuilderOptions{})
 }
+
+// restoreSyntheticOneOfNames changes the names of synthetic one-ofs back to
+// the names they had in the file from which the fields were created, as long
+// as those names do not conflict with other fields and one-ofs.
+func restoreSyntheticOneOfNames(md *descriptorpb.DescriptorProto, fieldBuilders map[*descriptorpb.FieldDescriptorProto]*FieldBuilder, sourceInfo *sourceInfoBuilder) {
+	if sourceInfo.file == nil {
+		return
+	}
+	var names map[string]struct{}
+	for _, fld := range md.Field {
+		flb := fieldBuilders[fld]
+		if !fld.GetProto3Optional() || !sourceInfo.retained(flb.lossless) {
+			continue
+		}
+		ood := md.OneofDecl[fld.GetOneofIndex()]
+		name := flb.lossless.syntheticOneOf
+		if name == "" || name == ood.GetName() {
+			continue
+		}
+		if names == nil {
+			names = map[string]struct{}{}
+			for _, fld := range md.Field {
+				names[fld.GetName()] = struct{}{}
+			}
+			for _, ood := range md.OneofDecl {
+				names[ood.GetName()] = struct{}{}
+			}
+		}
+		if _, ok := names[name]; ok {
+			continue
+		}
+		delete(names, ood.GetName())
+		names[name] = struct{}{}
+		ood.Name = proto.String(name)
+	}
+}
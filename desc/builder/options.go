@@ -0,0 +1,432 @@
+package builder
+
+import (
+	"fmt"
+	"reflect"
+	"sort"
+	"strings"
+
+	"google.golang.org/protobuf/encoding/protowire"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protoreflect"
+	"google.golang.org/protobuf/reflect/protoregistry"
+	"google.golang.org/protobuf/types/descriptorpb"
+
+	"github.com/jhump/protoreflect/desc"
+	"github.com/jhump/protoreflect/dynamic"
+)
+
+// customOptions tracks custom options that were set on a builder using the
+// SetOption family of methods.
+type customOptions struct {
+	// extensions for options that have been set, keyed by fully-qualified
+	// name; used to add dependencies when the builder is built
+	exts map[string]*desc.FieldDescriptor
+	// options set by name whose extensions could not be found yet; these are
+	// resolved when the builder is built
+	pending map[string]interface{}
+}
+
+// optionsBuilder is implemented by builders whose elements can have options.
+type optionsBuilder interface {
+	Builder
+	getOptions() proto.Message
+	setOptions(proto.Message)
+	getCustomOptions() *customOptions
+}
+
+func (b *baseBuilder) getCustomOptions() *customOptions {
+	return &b.customOpts
+}
+
+func optionsMessageName(b optionsBuilder) string {
+	return string(b.getOptions().ProtoReflect().Descriptor().FullName())
+}
+
+func trimOptionName(name string) string {
+	if strings.HasPrefix(name, "(") && strings.HasSuffix(name, ")") {
+		name = name[1 : len(name)-1]
+	}
+	return strings.TrimPrefix(name, ".")
+}
+
+func isNilOptions(opts proto.Message) bool {
+	rv := reflect.ValueOf(opts)
+	return rv.Kind() == reflect.Ptr && rv.IsNil()
+}
+
+// setOption sets the custom option described by extd to the given value. The
+// value must be valid for the extension, in any form accepted by
+// dynamic.Message.TrySetField.
+func setOption(b optionsBuilder, extd *desc.FieldDescriptor, val interface{}) error {
+	if err := checkOptionExtension(b, extd); err != nil {
+		return err
+	}
+	opts, err := withOption(b.getOptions(), extd, val)
+	if err != nil {
+		return err
+	}
+	b.setOptions(opts)
+
+	co := b.getCustomOptions()
+	if co.exts == nil {
+		co.exts = map[string]*desc.FieldDescriptor{}
+	}
+	co.exts[extd.GetFullyQualifiedName()] = extd
+	delete(co.pending, extd.GetFullyQualifiedName())
+	return nil
+}
+
+// withOption returns a copy of the given options with the custom option
+// described by extd set to the given value. The given options are not
+// modified.
+func withOption(opts proto.Message, extd *desc.FieldDescriptor, val interface{}) (proto.Message, error) {
+	dm := dynamic.NewMessage(extd.GetOwner())
+	if err := dm.TrySetField(extd, val); err != nil {
+		return nil, fmt.Errorf("invalid value for option %s: %v", extd.GetFullyQualifiedName(), err)
+	}
+	data, err := dm.Marshal()
+	if err != nil {
+		return nil, fmt.Errorf("invalid value for option %s: %v", extd.GetFullyQualifiedName(), err)
+	}
+	opts = clearedOptions(opts, extd.GetNumber())
+	// The value is kept as unknown fields. We don't want it interpreted using
+	// extensions linked into the program, which could be a different extension
+	// (from another file) that happens to have the same tag number.
+	uo := proto.UnmarshalOptions{Merge: true, Resolver: &protoregistry.Types{}}
+	if err := uo.Unmarshal(data, opts); err != nil {
+		return nil, fmt.Errorf("invalid value for option %s: %v", extd.GetFullyQualifiedName(), err)
+	}
+	return opts, nil
+}
+
+// setOptionByName sets the custom option with the given name. If the option's
+// extension cannot be found, the value is recorded and the option is set when
+// the builder is built.
+func setOptionByName(b optionsBuilder, name string, val interface{}) error {
+	name = trimOptionName(name)
+	if extd := findOptionExtension(b, name, nil, nil); extd != nil {
+		return setOption(b, extd, val)
+	}
+	co := b.getCustomOptions()
+	if co.pending == nil {
+		co.pending = map[string]interface{}{}
+	}
+	co.pending[name] = val
+	return nil
+}
+
+// getOption returns the value of the custom option described by extd, or nil
+// if the option is not set. Message values are returned as *dynamic.Message.
+func getOption(b optionsBuilder, extd *desc.FieldDescriptor) (interface{}, error) {
+	if err := checkOptionExtension(b, extd); err != nil {
+		return nil, err
+	}
+	opts := b.getOptions()
+	if isNilOptions(opts) {
+		return nil, nil
+	}
+	data, err := proto.Marshal(opts)
+	if err != nil {
+		return nil, err
+	}
+	var er dynamic.ExtensionRegistry
+	if err := er.AddExtension(extd); err != nil {
+		return nil, err
+	}
+	dm := dynamic.NewMessageWithExtensionRegistry(extd.GetOwner(), &er)
+	if err := dm.Unmarshal(data); err != nil {
+		return nil, err
+	}
+	if !dm.HasField(extd) {
+		return nil, nil
+	}
+	return dm.TryGetField(extd)
+}
+
+// getOptionByName returns the value of the custom option with the given name.
+// If the option was set by name but its extension is not yet known, the value
+// given when it was set is returned.
+func getOptionByName(b optionsBuilder, name string) (interface{}, error) {
+	name = trimOptionName(name)
+	if val, ok := b.getCustomOptions().pending[name]; ok {
+		return val, nil
+	}
+	extd := findOptionExtension(b, name, nil, nil)
+	if extd == nil {
+		return nil, fmt.Errorf("unknown custom option %s for %s", name, optionsMessageName(b))
+	}
+	return getOption(b, extd)
+}
+
+// clearOption removes the custom option described by extd.
+func clearOption(b optionsBuilder, extd *desc.FieldDescriptor) {
+	co := b.getCustomOptions()
+	delete(co.exts, extd.GetFullyQualifiedName())
+	delete(co.pending, extd.GetFullyQualifiedName())
+	if !extd.IsExtension() || extd.GetOwner().GetFullyQualifiedName() != optionsMessageName(b) {
+		return
+	}
+	if opts := b.getOptions(); !isNilOptions(opts) {
+		b.setOptions(clearedOptions(opts, extd.GetNumber()))
+	}
+}
+
+// clearOptionByName removes the custom option with the given name. It does
+// nothing if no such option is known.
+func clearOptionByName(b optionsBuilder, name string) {
+	name = trimOptionName(name)
+	delete(b.getCustomOptions().pending, name)
+	if extd := findOptionExtension(b, name, nil, nil); extd != nil {
+		clearOption(b, extd)
+	}
+}
+
+func checkOptionExtension(b optionsBuilder, extd *desc.FieldDescriptor) error {
+	if !extd.IsExtension() {
+		return fmt.Errorf("field %s is not an extension", extd.GetFullyQualifiedName())
+	}
+	if msgName := optionsMessageName(b); extd.GetOwner().GetFullyQualifiedName() != msgName {
+		return fmt.Errorf("extension %s extends %s, not %s", extd.GetFullyQualifiedName(), extd.GetOwner().GetFullyQualifiedName(), msgName)
+	}
+	return nil
+}
+
+// clearedOptions returns a copy of the given options, with any value for the
+// given tag removed. If opts is nil, a new, empty options message is returned.
+func clearedOptions(opts proto.Message, tag int32) proto.Message {
+	if isNilOptions(opts) {
+		return opts.ProtoReflect().New().Interface()
+	}
+	opts = proto.Clone(opts)
+	ref := opts.ProtoReflect()
+	ref.Range(func(fd protoreflect.FieldDescriptor, _ protoreflect.Value) bool {
+		if fd.IsExtension() && int32(fd.Number()) == tag {
+			ref.Clear(fd)
+		}
+		return true
+	})
+	unk := ref.GetUnknown()
+	if len(unk) == 0 {
+		return opts
+	}
+	var kept protoreflect.RawFields
+	for len(unk) > 0 {
+		num, _, n := protowire.ConsumeField(unk)
+		if n < 0 {
+			// malformed; leave the rest as is
+			kept = append(kept, unk...)
+			break
+		}
+		if int32(num) != tag {
+			kept = append(kept, unk[:n]...)
+		}
+		unk = unk[n:]
+	}
+	ref.SetUnknown(kept)
+	return opts
+}
+
+// findOptionExtension looks for the custom option with the given name. It looks
+// at options already set on b, the given registries, the file to which b
+// belongs (its explicitly imported dependencies and, if it was created from a
+// descriptor, the original file's dependencies), and finally extensions that
+// are linked into the current program. It returns nil if none is found.
+func findOptionExtension(b optionsBuilder, name string, exts *dynamic.ExtensionRegistry, deps *protoregistry.Types) *desc.FieldDescriptor {
+	msgName := optionsMessageName(b)
+	isMatch := func(extd *desc.FieldDescriptor) bool {
+		return extd != nil && extd.IsExtension() && extd.GetOwner().GetFullyQualifiedName() == msgName
+	}
+
+	if extd := b.getCustomOptions().exts[name]; isMatch(extd) {
+		return extd
+	}
+	if extd := exts.FindExtensionByName(msgName, name); isMatch(extd) {
+		return extd
+	}
+	if deps != nil {
+		if xt, err := deps.FindExtensionByName(protoreflect.FullName(name)); err == nil {
+			if extd, err := desc.WrapField(xt.TypeDescriptor()); err == nil && isMatch(extd) {
+				return extd
+			}
+		}
+	}
+	if fb, ok := getRoot(b).(*FileBuilder); ok {
+		if extd := fb.origExts.FindExtensionByName(msgName, name); isMatch(extd) {
+			return extd
+		}
+		for fd := range fb.explicitImports {
+			if extd := findExtensionInImport(fd, name); isMatch(extd) {
+				return extd
+			}
+		}
+	}
+	if xt, err := protoregistry.GlobalTypes.FindExtensionByName(protoreflect.FullName(name)); err == nil {
+		if extd, err := desc.WrapField(xt.TypeDescriptor()); err == nil && isMatch(extd) {
+			return extd
+		}
+	}
+	return nil
+}
+
+func findExtensionInImport(fd *desc.FileDescriptor, name string) *desc.FieldDescriptor {
+	if extd, ok := fd.FindSymbol(name).(*desc.FieldDescriptor); ok {
+		return extd
+	}
+	// extensions in public imports are also visible
+	for _, dep := range fd.GetPublicDependencies() {
+		if extd := findExtensionInImport(dep, name); extd != nil {
+			return extd
+		}
+	}
+	return nil
+}
+
+// findRecordedOptionExtension returns the extension, for an option set on b,
+// that extends the given message with the given tag.
+func findRecordedOptionExtension(b Builder, msgName string, tag int32) *desc.FieldDescriptor {
+	ob, ok := b.(optionsBuilder)
+	if !ok {
+		return nil
+	}
+	for _, extd := range ob.getCustomOptions().exts {
+		if extd.GetNumber() == tag && extd.GetOwner().GetFullyQualifiedName() == msgName {
+			return extd
+		}
+	}
+	return nil
+}
+
+// resolvePendingOptions resolves the options, in b and all of its descendants,
+// that were set by name but whose extensions were not known at the time. The
+// builders are not modified: the resulting options are recorded in the
+// resolver and are only used in the protos that it builds.
+func (r *dependencyResolver) resolvePendingOptions(deps *dependencies, b Builder) error {
+	if ob, ok := b.(optionsBuilder); ok && len(ob.getCustomOptions().pending) > 0 {
+		co := ob.getCustomOptions()
+		opts := ob.getOptions()
+		for _, name := range sortedKeys(co.pending) {
+			val := co.pending[name]
+			extd := findOptionExtension(ob, name, r.opts.Extensions, &deps.res)
+			var err error
+			if extd == nil {
+				err = fmt.Errorf("unknown custom option %s for %s", name, optionsMessageName(ob))
+			} else if err = checkOptionExtension(ob, extd); err == nil {
+				var newOpts proto.Message
+				if newOpts, err = withOption(opts, extd, val); err == nil {
+					opts = newOpts
+					r.resolvedExts[b] = append(r.resolvedExts[b], extd)
+				}
+			}
+			if err != nil {
+				if err := r.rep.report(b, CategoryUninterpretableOption, err); err != nil {
+					return err
+				}
+			}
+		}
+		if len(r.resolvedExts[b]) > 0 {
+			r.resolvedOpts[b] = opts
+		}
+	}
+	for _, ch := range b.GetChildren() {
+		if err := r.resolvePendingOptions(deps, ch); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// optionsFor returns the options to use for b in place of the given options:
+// if opts is b's options message and b has options that were resolved during
+// this build, the resolved options are returned.
+func (r *dependencyResolver) optionsFor(b Builder, opts proto.Message) proto.Message {
+	ob, ok := b.(optionsBuilder)
+	if !ok || opts == nil || opts.ProtoReflect().Descriptor() != ob.getOptions().ProtoReflect().Descriptor() {
+		return opts
+	}
+	if resolved, ok := r.resolvedOpts[b]; ok {
+		return resolved
+	}
+	return opts
+}
+
+// findResolvedOptionExtension returns the extension, for an option resolved on
+// b during this build, that extends the given message with the given tag.
+func (r *dependencyResolver) findResolvedOptionExtension(b Builder, msgName string, tag int32) *desc.FieldDescriptor {
+	for _, extd := range r.resolvedExts[b] {
+		if extd.GetNumber() == tag && extd.GetOwner().GetFullyQualifiedName() == msgName {
+			return extd
+		}
+	}
+	return nil
+}
+
+// setResolvedOptions replaces the options in the given file proto, which was
+// built from fb, with the options that were resolved during this build.
+func (r *dependencyResolver) setResolvedOptions(fb *FileBuilder, fp *descriptorpb.FileDescriptorProto) {
+	if len(r.resolvedOpts) == 0 {
+		return
+	}
+	elements := map[string]protoreflect.Message{}
+	indexElements(fp.GetPackage(), fp.MessageType, fp.EnumType, fp.Extension, elements)
+	for _, sd := range fp.Service {
+		svcName := qualifiedName(fp.GetPackage(), sd.GetName())
+		elements[svcName] = sd.ProtoReflect()
+		for _, mtd := range sd.Method {
+			elements[qualifiedName(svcName, mtd.GetName())] = mtd.ProtoReflect()
+		}
+	}
+	walkBuilders(fb, func(b Builder) {
+		opts, ok := r.resolvedOpts[b]
+		if !ok {
+			return
+		}
+		var elem protoreflect.Message
+		if b == fb {
+			elem = fp.ProtoReflect()
+		} else if elem, ok = elements[GetFullyQualifiedName(b)]; !ok {
+			return
+		}
+		elem.Set(elem.Descriptor().Fields().ByName("options"), protoreflect.ValueOfMessage(opts.ProtoReflect()))
+	})
+}
+
+func indexElements(scope string, msgs []*descriptorpb.DescriptorProto, enums []*descriptorpb.EnumDescriptorProto, exts []*descriptorpb.FieldDescriptorProto, elements map[string]protoreflect.Message) {
+	for _, md := range msgs {
+		msgName := qualifiedName(scope, md.GetName())
+		elements[msgName] = md.ProtoReflect()
+		for _, fld := range md.Field {
+			elements[qualifiedName(msgName, fld.GetName())] = fld.ProtoReflect()
+		}
+		for _, ood := range md.OneofDecl {
+			elements[qualifiedName(msgName, ood.GetName())] = ood.ProtoReflect()
+		}
+		indexElements(msgName, md.NestedType, md.EnumType, md.Extension, elements)
+	}
+	for _, ed := range enums {
+		enumName := qualifiedName(scope, ed.GetName())
+		elements[enumName] = ed.ProtoReflect()
+		for _, evd := range ed.Value {
+			elements[qualifiedName(enumName, evd.GetName())] = evd.ProtoReflect()
+		}
+	}
+	for _, exd := range exts {
+		elements[qualifiedName(scope, exd.GetName())] = exd.ProtoReflect()
+	}
+}
+
+func qualifiedName(scope, name string) string {
+	if scope == "" {
+		return name
+	}
+	return scope + "." + name
+}
+
+func sortedKeys(m map[string]interface{}) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
@@ -0,0 +1,240 @@
+package builder
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/golang/protobuf/proto"
+	"google.golang.org/protobuf/types/descriptorpb"
+
+	"github.com/jhump/protoreflect/desc"
+	"github.com/jhump/protoreflect/dynamic"
+	"github.com/jhump/protoreflect/internal/testprotos"
+	"github.com/jhump/protoreflect/internal/testutil"
+)
+
+// buildOptionsFile builds a file that defines custom options which are not
+// linked into the program, so they can only be found via descriptors.
+func buildOptionsFile(t *testing.T) *desc.FileDescriptor {
+	msgOpts, err := desc.LoadMessageDescriptorForMessage((*descriptorpb.MessageOptions)(nil))
+	testutil.Ok(t, err)
+	fieldOpts, err := desc.LoadMessageDescriptorForMessage((*descriptorpb.FieldOptions)(nil))
+	testutil.Ok(t, err)
+	info := NewMessage("Info").
+		AddField(NewField("id", FieldTypeInt64())).
+		AddField(NewField("tags", FieldTypeString()).SetRepeated())
+	fd, err := NewFile("custom_opts.proto").
+		SetPackageName("foo.opts").
+		AddMessage(info).
+		AddExtension(NewExtensionImported("level", 20001, FieldTypeInt32(), msgOpts)).
+		AddExtension(NewExtensionImported("info", 20002, FieldTypeMessage(info), msgOpts)).
+		AddExtension(NewExtensionImported("labels", 20001, FieldTypeString(), fieldOpts).SetRepeated()).
+		Build()
+	testutil.Ok(t, err)
+	return fd
+}
+
+func hasDependency(fd *desc.FileDescriptor, name string) bool {
+	for _, dep := range fd.GetDependencies() {
+		if dep.GetName() == name {
+			return true
+		}
+	}
+	return false
+}
+
+func TestSetOption(t *testing.T) {
+	optsFile := buildOptionsFile(t)
+	level := optsFile.FindExtensionByName("foo.opts.level")
+	info := optsFile.FindExtensionByName("foo.opts.info")
+	labels := optsFile.FindExtensionByName("foo.opts.labels")
+
+	shared := &descriptorpb.MessageOptions{Deprecated: proto.Bool(true)}
+	infoVal := dynamic.NewMessage(optsFile.FindMessage("foo.opts.Info"))
+	infoVal.SetFieldByName("id", int64(42))
+	infoVal.SetFieldByName("tags", []string{"a", "b"})
+
+	fld := NewField("name", FieldTypeString()).
+		SetOption(labels, []string{"x", "y"})
+	msg := NewMessage("Foo").
+		SetOptions(shared).
+		SetOption(level, int32(3)).
+		SetOption(info, infoVal).
+		AddField(fld)
+	file := NewFile("foo.proto").SetPackageName("foo").AddMessage(msg)
+
+	// shared options are copied, not modified
+	testutil.Eq(t, 0, len(shared.ProtoReflect().GetUnknown()))
+	testutil.Require(t, msg.Options.GetDeprecated())
+
+	val, err := msg.GetOption(level)
+	testutil.Ok(t, err)
+	testutil.Eq(t, int32(3), val)
+	val, err = msg.GetOptionByName("foo.opts.info")
+	testutil.Ok(t, err)
+	testutil.Require(t, dynamic.MessagesEqual(infoVal, val.(*dynamic.Message)))
+	val, err = fld.GetOptionByName("(foo.opts.labels)")
+	testutil.Ok(t, err)
+	testutil.Eq(t, []interface{}{"x", "y"}, val)
+
+	// file that defines the options is added as a dependency
+	fd, err := file.Build()
+	testutil.Ok(t, err)
+	testutil.Require(t, hasDependency(fd, "custom_opts.proto"))
+	built, err := FromMessage(fd.FindMessage("foo.Foo"))
+	testutil.Ok(t, err)
+	val, err = built.GetOption(level)
+	testutil.Ok(t, err)
+	testutil.Eq(t, int32(3), val)
+
+	// replacing and clearing
+	msg.SetOption(level, int32(5))
+	val, err = msg.GetOption(level)
+	testutil.Ok(t, err)
+	testutil.Eq(t, int32(5), val)
+	msg.ClearOption(info).ClearOption(level)
+	val, err = msg.GetOption(level)
+	testutil.Ok(t, err)
+	testutil.Eq(t, nil, val)
+	fld.ClearOptionByName("foo.opts.labels")
+	fd, err = file.Build()
+	testutil.Ok(t, err)
+	testutil.Require(t, !hasDependency(fd, "custom_opts.proto"))
+	testutil.Require(t, fd.FindMessage("foo.Foo").GetMessageOptions().GetDeprecated())
+}
+
+func TestSetOption_Invalid(t *testing.T) {
+	optsFile := buildOptionsFile(t)
+	level := optsFile.FindExtensionByName("foo.opts.level")
+	labels := optsFile.FindExtensionByName("foo.opts.labels")
+
+	msg := NewMessage("Foo")
+	err := msg.TrySetOption(level, "abc")
+	testutil.Require(t, err != nil && strings.Contains(err.Error(), "invalid value for option foo.opts.level"), "unexpected error: %v", err)
+	// values must have the exact Go type for the option's type
+	err = msg.TrySetOption(level, 3)
+	testutil.Require(t, err != nil && strings.Contains(err.Error(), "invalid value for option foo.opts.level"), "unexpected error: %v", err)
+	err = msg.TrySetOption(labels, []string{"abc"})
+	testutil.Require(t, err != nil && strings.Contains(err.Error(), "extends google.protobuf.FieldOptions, not google.protobuf.MessageOptions"), "unexpected error: %v", err)
+	err = msg.TrySetOption(optsFile.FindMessage("foo.opts.Info").FindFieldByName("id"), 1)
+	testutil.Require(t, err != nil && strings.Contains(err.Error(), "is not an extension"), "unexpected error: %v", err)
+	testutil.Eq(t, (*descriptorpb.MessageOptions)(nil), msg.Options)
+
+	_, err = msg.GetOptionByName("foo.opts.unknown")
+	testutil.Require(t, err != nil && strings.Contains(err.Error(), "unknown custom option foo.opts.unknown"), "unexpected error: %v", err)
+}
+
+func TestSetOptionByName_LinkedExtension(t *testing.T) {
+	msg := NewMessage("Foo").SetOptionByName("testprotos.mfubar", true)
+	// known extensions are resolved and validated right away
+	err := msg.TrySetOptionByName("testprotos.mfubar", "abc")
+	testutil.Nok(t, err)
+	val, err := msg.GetOptionByName("testprotos.mfubar")
+	testutil.Ok(t, err)
+	testutil.Eq(t, true, val)
+
+	svc := NewService("FooService")
+	rsmd, err := desc.LoadMessageDescriptorForMessage((*testprotos.ReallySimpleMessage)(nil))
+	testutil.Ok(t, err)
+	rsm := dynamic.NewMessage(rsmd)
+	rsm.SetFieldByName("name", "foo")
+	svc.SetOptionByName("testprotos.sfubar", rsm)
+
+	fd, err := NewFile("foo.proto").AddMessage(msg).AddService(svc).Build()
+	testutil.Ok(t, err)
+	testutil.Require(t, hasDependency(fd, "desc_test_options.proto"))
+	sd := fd.FindService("FooService")
+	ext, err := proto.GetExtension(sd.GetServiceOptions(), testprotos.E_Sfubar)
+	testutil.Ok(t, err)
+	testutil.Eq(t, "foo", ext.(*testprotos.ReallySimpleMessage).GetName())
+}
+
+func TestSetOptionByName_ResolvedWhenBuilt(t *testing.T) {
+	optsFile := buildOptionsFile(t)
+
+	msg := NewMessage("Foo").SetOptionByName("foo.opts.level", int32(7))
+	file := NewFile("foo.proto").SetPackageName("foo").AddMessage(msg)
+	// not yet known, so the value is kept as given
+	val, err := msg.GetOptionByName("foo.opts.level")
+	testutil.Ok(t, err)
+	testutil.Eq(t, int32(7), val)
+
+	_, err = file.Build()
+	testutil.Require(t, err != nil && strings.Contains(err.Error(), "unknown custom option foo.opts.level"), "unexpected error: %v", err)
+
+	// found in the registry given in the build options
+	var reg dynamic.ExtensionRegistry
+	reg.AddExtensionsFromFile(optsFile)
+	d, err := BuilderOptions{Extensions: &reg}.Build(file)
+	testutil.Ok(t, err)
+	fd := d.(*desc.FileDescriptor)
+	testutil.Require(t, hasDependency(fd, "custom_opts.proto"))
+	built, err := FromMessage(fd.FindMessage("foo.Foo"))
+	testutil.Ok(t, err)
+	val, err = built.GetOption(optsFile.FindExtensionByName("foo.opts.level"))
+	testutil.Ok(t, err)
+	testutil.Eq(t, int32(7), val)
+	// but the builder is unchanged, so the option is still pending and
+	// building without the registry still fails
+	testutil.Eq(t, 1, len(msg.customOpts.pending))
+	testutil.Require(t, msg.Options == nil)
+	_, err = file.Build()
+	testutil.Require(t, err != nil && strings.Contains(err.Error(), "unknown custom option foo.opts.level"), "unexpected error: %v", err)
+
+	// found in an explicit import
+	msg = NewMessage("Foo").SetOptionByName("foo.opts.level", "bad")
+	file = NewFile("foo.proto").SetPackageName("foo").AddMessage(msg)
+	_, err = BuilderOptions{Extensions: &reg}.Build(file)
+	testutil.Require(t, err != nil && strings.Contains(err.Error(), "invalid value for option foo.opts.level"), "unexpected error: %v", err)
+	msg.SetOptionByName("foo.opts.level", int32(8))
+	file.AddImportedDependency(optsFile)
+	val, err = msg.GetOptionByName("foo.opts.level")
+	testutil.Ok(t, err)
+	testutil.Eq(t, int32(8), val)
+	fd, err = file.Build()
+	testutil.Ok(t, err)
+	val, err = msg.GetOptionByName("foo.opts.level")
+	testutil.Ok(t, err)
+	testutil.Eq(t, int32(8), val)
+
+	// pending options can be cleared
+	msg.SetOptionByName("foo.opts.other", int32(1)).ClearOptionByName("foo.opts.other")
+	_, err = file.Build()
+	testutil.Ok(t, err)
+}
+
+func TestSetOptionByName_BuildDoesNotModifyBuilders(t *testing.T) {
+	optsFile := buildOptionsFile(t)
+	var reg dynamic.ExtensionRegistry
+	reg.AddExtensionsFromFile(optsFile)
+
+	fld := NewField("name", FieldTypeString()).SetOptionByName("foo.opts.labels", []string{"a", "b"})
+	nested := NewMessage("Nested").
+		AddOneOf(NewOneOf("choice").AddChoice(fld)).
+		SetOptionByName("foo.opts.level", int32(3))
+	msg := NewMessage("Foo").AddNestedMessage(nested)
+	file := NewFile("foo.proto").SetPackageName("foo").AddMessage(msg)
+
+	d, err := BuilderOptions{Extensions: &reg}.Build(file)
+	testutil.Ok(t, err)
+	fd := d.(*desc.FileDescriptor)
+	built, err := FromMessage(fd.FindMessage("foo.Foo.Nested"))
+	testutil.Ok(t, err)
+	val, err := built.GetOption(optsFile.FindExtensionByName("foo.opts.level"))
+	testutil.Ok(t, err)
+	testutil.Eq(t, int32(3), val)
+	val, err = built.GetField("name").GetOption(optsFile.FindExtensionByName("foo.opts.labels"))
+	testutil.Ok(t, err)
+	testutil.Eq(t, []interface{}{"a", "b"}, val)
+	testutil.Require(t, nested.Options == nil)
+	testutil.Require(t, fld.Options == nil)
+
+	// a failed build leaves no options partially applied
+	msg.SetOptionByName("foo.opts.level", "bad")
+	_, err = BuilderOptions{Extensions: &reg}.Build(file)
+	testutil.Require(t, err != nil && strings.Contains(err.Error(), "invalid value for option foo.opts.level"), "unexpected error: %v", err)
+	testutil.Require(t, msg.Options == nil)
+	testutil.Require(t, nested.Options == nil)
+	testutil.Eq(t, 1, len(nested.customOpts.pending))
+	testutil.Eq(t, 1, len(fld.customOpts.pending))
+}
@@ -0,0 +1,1435 @@
+package builder
+
+import (
+	"errors"
+	"fmt"
+	"reflect"
+	"sort"
+	"strings"
+	"sync"
+
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/types/descriptorpb"
+
+	"github.com/jhump/protoreflect/desc"
+	"github.com/jhump/protoreflect/dynamic"
+)
+
+// Patch is a list of edits to make to a file builder, such as adding a field
+// to a message, renaming an enum value, or setting an option. A patch can be
+// constructed in code, or it can be decoded from JSON or the protobuf text
+// format, using the message schema returned by PatchDescriptor.
+//
+// Patches are applied with FileBuilder.ApplyPatch or PatchOptions.Apply. The
+// edits are applied in order and applying a patch is atomic: either all edits
+// succeed or the file is left unchanged. Since the edits are only validated
+// against, and applied to, the file being patched, applying the same patch to
+// the same file always has the same result. This allows a log of patches to be
+// replayed.
+//
+// Edits refer to existing elements by their fully-qualified names (as returned
+// by GetFullyQualifiedName, and with an optional leading dot). The names of
+// enum values are qualified by the name of their enum, and the names of
+// methods by the name of their service. An empty name refers to the file
+// itself. Types referred to by new elements, such as a field's type_name or a
+// method's input_type, must also be fully-qualified. They can refer to
+// elements in the file (including elements added by earlier edits), to
+// elements in files the file already imports or otherwise refers to, or to
+// elements in the files given in PatchOptions.Dependencies.
+type Patch struct {
+	Edits []*Edit `proto:"edits,1"`
+}
+
+// Edit is a single change in a Patch. Exactly one of its fields must be set.
+type Edit struct {
+	AddMessage   *AddMessageEdit   `proto:"add_message,1"`
+	AddEnum      *AddEnumEdit      `proto:"add_enum,2"`
+	AddService   *AddServiceEdit   `proto:"add_service,3"`
+	AddField     *AddFieldEdit     `proto:"add_field,4"`
+	AddEnumValue *AddEnumValueEdit `proto:"add_enum_value,5"`
+	AddMethod    *AddMethodEdit    `proto:"add_method,6"`
+	Rename       *RenameEdit       `proto:"rename,7"`
+	Remove       *RemoveEdit       `proto:"remove,8"`
+	SetOption    *SetOptionEdit    `proto:"set_option,9"`
+	ClearOption  *ClearOptionEdit  `proto:"clear_option,10"`
+	SetComments  *SetCommentsEdit  `proto:"set_comments,11"`
+}
+
+// AddMessageEdit adds a message to a file or, as a nested message, to another
+// message. The message's fields, one-ofs, nested messages and enums, and
+// extensions are added, too. Nested messages that are map entries or group
+// types become map and group fields, respectively.
+type AddMessageEdit struct {
+	// The name of the file or message to which the message is added.
+	Parent  string                        `proto:"parent,1"`
+	Message *descriptorpb.DescriptorProto `proto:"message,2"`
+}
+
+// AddEnumEdit adds an enum, with its values, to a file or, as a nested enum,
+// to a message.
+type AddEnumEdit struct {
+	// The name of the file or message to which the enum is added.
+	Parent string                            `proto:"parent,1"`
+	Enum   *descriptorpb.EnumDescriptorProto `proto:"enum,2"`
+}
+
+// AddServiceEdit adds a service, with its methods, to the file.
+type AddServiceEdit struct {
+	Service *descriptorpb.ServiceDescriptorProto `proto:"service,1"`
+}
+
+// AddFieldEdit adds a field to a message. If the field has an extendee, it is
+// an extension, which can be added to the file or, as a nested extension, to
+// a message. If the field's number is zero, it is assigned when the message
+// is built.
+//
+// Group fields cannot be added this way, since their message is defined along
+// with the field; they can only be added as part of a new message. Map fields
+// are added by setting MapKey and MapValue.
+type AddFieldEdit struct {
+	// The name of the message (or, for extensions, of the file or message) to
+	// which the field is added.
+	Parent string                             `proto:"parent,1"`
+	Field  *descriptorpb.FieldDescriptorProto `proto:"field,2"`
+	// The name of the one-of to which the field is added. If the message has
+	// no one-of with this name, one is created.
+	OneOf string `proto:"one_of,3"`
+	// If set, the field is a map field, and these describe the types of the
+	// map's keys and values. Only their type and type_name are used. The
+	// type, type_name, and label of Field are ignored.
+	MapKey   *descriptorpb.FieldDescriptorProto `proto:"map_key,4"`
+	MapValue *descriptorpb.FieldDescriptorProto `proto:"map_value,5"`
+}
+
+// AddEnumValueEdit adds a value to an enum.
+type AddEnumValueEdit struct {
+	// The name of the enum to which the value is added.
+	Enum  string                                 `proto:"enum,1"`
+	Value *descriptorpb.EnumValueDescriptorProto `proto:"value,2"`
+}
+
+// AddMethodEdit adds a method to a service.
+type AddMethodEdit struct {
+	// The name of the service to which the method is added.
+	Service string                              `proto:"service,1"`
+	Method  *descriptorpb.MethodDescriptorProto `proto:"method,2"`
+}
+
+// RenameEdit changes the name of an element. Since builders refer to one
+// another directly, references to the element in the file are updated, too.
+type RenameEdit struct {
+	Element string `proto:"element,1"`
+	NewName string `proto:"new_name,2"`
+}
+
+// RemoveEdit removes an element. An element cannot be removed while other
+// elements in the file, that are not also removed, refer to it.
+type RemoveEdit struct {
+	Element string `proto:"element,1"`
+	// If true, the name and number of the removed element are reserved, so
+	// they cannot accidentally be re-used. This is only allowed for fields,
+	// one-ofs, and enum values.
+	Reserve bool `proto:"reserve,2"`
+}
+
+// SetOptionEdit sets an option on an element.
+type SetOptionEdit struct {
+	Element string `proto:"element,1"`
+	// The name of the option. For standard options, this is the name of a
+	// field of the element's options message, like "deprecated". For custom
+	// options, it is the fully-qualified name of the extension in
+	// parentheses, like "(foo.bar.baz)". The extension must be defined in a
+	// file other than the one being patched.
+	Option string `proto:"option,2"`
+	// The value of the option, in the protobuf text format. For example, this
+	// may be "true", "123", "ENUM_VALUE", "\"a string\"", "[1, 2, 3]" (for
+	// repeated options), or "{name: \"abc\" id: 1}" (for message options).
+	Value string `proto:"value,3"`
+}
+
+// ClearOptionEdit removes an option from an element.
+type ClearOptionEdit struct {
+	Element string `proto:"element,1"`
+	// The name of the option, in the same form as in SetOptionEdit.
+	Option string `proto:"option,2"`
+}
+
+// SetCommentsEdit replaces the comments of an element.
+type SetCommentsEdit struct {
+	Element                 string   `proto:"element,1"`
+	LeadingDetachedComments []string `proto:"leading_detached_comments,2"`
+	LeadingComment          string   `proto:"leading_comment,3"`
+	TrailingComment         string   `proto:"trailing_comment,4"`
+}
+
+var patchSchema struct {
+	once sync.Once
+	md   *desc.MessageDescriptor
+	err  error
+}
+
+// PatchDescriptor returns the descriptor for the message that represents a
+// Patch. It is derived from the Patch type using a GoTypeMapper. Patches can
+// be decoded from JSON or the protobuf text format using this message, but
+// the MarshalJSON, UnmarshalJSON, MarshalText, and UnmarshalText methods of
+// Patch are simpler to use.
+func PatchDescriptor() (*desc.MessageDescriptor, error) {
+	patchSchema.once.Do(func() {
+		m := GoTypeMapper{
+			File: NewFile("github.com/jhump/protoreflect/desc/builder/patch.proto").
+				SetProto3(true).
+				SetPackageName("protoreflect.builder"),
+		}
+		mb, err := m.MessageFor(reflect.TypeOf(Patch{}))
+		if err != nil {
+			patchSchema.err = err
+			return
+		}
+		patchSchema.md, patchSchema.err = mb.Build()
+	})
+	return patchSchema.md, patchSchema.err
+}
+
+func (p *Patch) toMessage() (*dynamic.Message, error) {
+	md, err := PatchDescriptor()
+	if err != nil {
+		return nil, err
+	}
+	dm := dynamic.NewMessage(md)
+	if err := dm.FromStruct(p); err != nil {
+		return nil, err
+	}
+	return dm, nil
+}
+
+func (p *Patch) fromMessage(unmarshal func(*dynamic.Message) error) error {
+	md, err := PatchDescriptor()
+	if err != nil {
+		return err
+	}
+	dm := dynamic.NewMessage(md)
+	if err := unmarshal(dm); err != nil {
+		return err
+	}
+	var result Patch
+	if err := dm.ToStruct(&result); err != nil {
+		return err
+	}
+	*p = result
+	return nil
+}
+
+// MarshalJSON serializes this patch to JSON, using the message returned by
+// PatchDescriptor.
+func (p *Patch) MarshalJSON() ([]byte, error) {
+	dm, err := p.toMessage()
+	if err != nil {
+		return nil, err
+	}
+	return dm.MarshalJSON()
+}
+
+// UnmarshalJSON de-serializes the patch from JSON, using the message returned
+// by PatchDescriptor. Any edits already in this patch are discarded.
+func (p *Patch) UnmarshalJSON(js []byte) error {
+	return p.fromMessage(func(dm *dynamic.Message) error {
+		return dm.UnmarshalJSON(js)
+	})
+}
+
+// MarshalText serializes this patch to the protobuf text format, using the
+// message returned by PatchDescriptor.
+func (p *Patch) MarshalText() ([]byte, error) {
+	dm, err := p.toMessage()
+	if err != nil {
+		return nil, err
+	}
+	return dm.MarshalTextIndent()
+}
+
+// UnmarshalText de-serializes the patch from the protobuf text format, using
+// the message returned by PatchDescriptor. Any edits already in this patch
+// are discarded.
+func (p *Patch) UnmarshalText(text []byte) error {
+	return p.fromMessage(func(dm *dynamic.Message) error {
+		return dm.UnmarshalText(text)
+	})
+}
+
+// PatchError is the type of error returned when a patch cannot be applied. It
+// indicates which edit failed.
+type PatchError struct {
+	// The index of the edit that failed, in the patch's Edits.
+	Index int
+	// The underlying error.
+	Err error
+}
+
+// Error implements the error interface.
+func (e *PatchError) Error() string {
+	return fmt.Sprintf("edit #%d: %v", e.Index, e.Err)
+}
+
+// Unwrap returns the underlying error.
+func (e *PatchError) Unwrap() error {
+	return e.Err
+}
+
+// PatchOptions includes additional options to use when applying patches.
+type PatchOptions struct {
+	// Files that may define types and custom options used by the patch. Files
+	// that are already imported by the file being patched, or that define
+	// elements to which it already refers, need not be included.
+	Dependencies []*desc.FileDescriptor
+	// Other files whose elements may refer to elements of the file being
+	// patched. The patch fails if it removes an element that is still used by
+	// one of these files. Uses in files not included here are not checked, so
+	// such files may no longer build after the patch is applied.
+	Dependents []*FileBuilder
+}
+
+// ApplyPatch applies the given patch to this file, using default
+// PatchOptions. See PatchOptions.Apply for more details.
+func (fb *FileBuilder) ApplyPatch(p *Patch) error {
+	return PatchOptions{}.Apply(fb, p)
+}
+
+// Apply applies the given patch to the given file. If any edit in the patch
+// cannot be applied, a *PatchError is returned and the file is unchanged.
+//
+// The edits are applied to a clone of the file and, only if they all succeed,
+// the result is swapped into the given file. Builders in the file that the
+// patch does not remove keep their identity, so references to them from other
+// files remain valid.
+func (opts PatchOptions) Apply(fb *FileBuilder, p *Patch) error {
+	c, err := opts.applyToClone(fb, p)
+	if err != nil {
+		return err
+	}
+	c.swapIn(fb)
+	return nil
+}
+
+// Validate checks that the given patch can be applied to the given file,
+// without changing the file. It returns the same error that Apply would.
+func (opts PatchOptions) Validate(fb *FileBuilder, p *Patch) error {
+	_, err := opts.applyToClone(fb, p)
+	return err
+}
+
+func (opts PatchOptions) applyToClone(fb *FileBuilder, p *Patch) (*cloner, error) {
+	c := newCloner(CloneOptions{}, fb)
+	cl := c.copy(fb).(*FileBuilder)
+	c.fixReferences()
+	pa := &patcher{opts: opts, file: cl, clones: c.clones}
+	for i, e := range p.Edits {
+		if err := pa.applyEdit(e); err != nil {
+			return nil, &PatchError{Index: i, Err: err}
+		}
+	}
+	return c, nil
+}
+
+// swapIn gives each builder that c cloned the state of its copy, once the
+// copies have been patched. References to copies are replaced with references
+// to the corresponding originals, so the original tree rooted at root ends up
+// just like the patched copy. Builders created by the patch are linked into
+// the original tree as they are.
+func (c *cloner) swapIn(root Builder) {
+	origs := make(map[Builder]Builder, len(c.clones))
+	bs := make([]Builder, 0, len(c.clones))
+	for orig, cl := range c.clones {
+		origs[cl] = orig
+		bs = append(bs, cl)
+	}
+	walkBuilders(c.clones[root], func(b Builder) {
+		if _, ok := origs[b]; !ok {
+			bs = append(bs, b)
+		}
+	})
+	ref := func(b Builder) Builder {
+		if orig, ok := origs[b]; ok {
+			return orig
+		}
+		return b
+	}
+	for _, b := range bs {
+		target := ref(b)
+		switch b := b.(type) {
+		case *FileBuilder:
+			t := target.(*FileBuilder)
+			*t = *b
+			for i, mb := range t.messages {
+				t.messages[i] = ref(mb).(*MessageBuilder)
+			}
+			for i, exb := range t.extensions {
+				t.extensions[i] = ref(exb).(*FieldBuilder)
+			}
+			for i, eb := range t.enums {
+				t.enums[i] = ref(eb).(*EnumBuilder)
+			}
+			for i, sb := range t.services {
+				t.services[i] = ref(sb).(*ServiceBuilder)
+			}
+			for name, sym := range t.symbols {
+				t.symbols[name] = ref(sym)
+			}
+		case *MessageBuilder:
+			t := target.(*MessageBuilder)
+			*t = *b
+			for i, ch := range t.fieldsAndOneOfs {
+				t.fieldsAndOneOfs[i] = ref(ch)
+			}
+			for i, nmb := range t.nestedMessages {
+				t.nestedMessages[i] = ref(nmb).(*MessageBuilder)
+			}
+			for i, exb := range t.nestedExtensions {
+				t.nestedExtensions[i] = ref(exb).(*FieldBuilder)
+			}
+			for i, eb := range t.nestedEnums {
+				t.nestedEnums[i] = ref(eb).(*EnumBuilder)
+			}
+			for tag, flb := range t.fieldTags {
+				t.fieldTags[tag] = ref(flb).(*FieldBuilder)
+			}
+			for name, sym := range t.symbols {
+				t.symbols[name] = ref(sym)
+			}
+		case *FieldBuilder:
+			t := target.(*FieldBuilder)
+			*t = *b
+			if t.msgType != nil {
+				t.msgType = ref(t.msgType).(*MessageBuilder)
+			}
+			if t.localExtendee != nil {
+				t.localExtendee = ref(t.localExtendee).(*MessageBuilder)
+			}
+			if t.fieldType != nil {
+				if t.fieldType.localMsgType != nil {
+					t.fieldType.localMsgType = ref(t.fieldType.localMsgType).(*MessageBuilder)
+				}
+				if t.fieldType.localEnumType != nil {
+					t.fieldType.localEnumType = ref(t.fieldType.localEnumType).(*EnumBuilder)
+				}
+			}
+		case *OneOfBuilder:
+			t := target.(*OneOfBuilder)
+			*t = *b
+			for i, flb := range t.choices {
+				t.choices[i] = ref(flb).(*FieldBuilder)
+			}
+			for name, flb := range t.symbols {
+				t.symbols[name] = ref(flb).(*FieldBuilder)
+			}
+		case *EnumBuilder:
+			t := target.(*EnumBuilder)
+			*t = *b
+			for i, evb := range t.values {
+				t.values[i] = ref(evb).(*EnumValueBuilder)
+			}
+			for name, evb := range t.symbols {
+				t.symbols[name] = ref(evb).(*EnumValueBuilder)
+			}
+		case *EnumValueBuilder:
+			*target.(*EnumValueBuilder) = *b
+		case *ServiceBuilder:
+			t := target.(*ServiceBuilder)
+			*t = *b
+			for i, mtb := range t.methods {
+				t.methods[i] = ref(mtb).(*MethodBuilder)
+			}
+			for name, mtb := range t.symbols {
+				t.symbols[name] = ref(mtb).(*MethodBuilder)
+			}
+		case *MethodBuilder:
+			t := target.(*MethodBuilder)
+			*t = *b
+			if t.ReqType != nil && t.ReqType.localType != nil {
+				t.ReqType.localType = ref(t.ReqType.localType).(*MessageBuilder)
+			}
+			if t.RespType != nil && t.RespType.localType != nil {
+				t.RespType.localType = ref(t.RespType.localType).(*MessageBuilder)
+			}
+		}
+		if p := target.GetParent(); p != nil {
+			target.setParent(ref(p))
+		}
+	}
+}
+
+type patcher struct {
+	opts PatchOptions
+	// the clone of the file being patched, to which edits are applied
+	file *FileBuilder
+	// maps builders in the original file to their clones
+	clones map[Builder]Builder
+	// imported files, in which types may be found; computed lazily
+	imports []*desc.FileDescriptor
+	// messages and enums being added by the current edit, keyed by
+	// fully-qualified name, which may not yet be linked into the file
+	local map[string]Builder
+}
+
+func (pa *patcher) applyEdit(e *Edit) error {
+	var set []string
+	if e != nil {
+		rv := reflect.ValueOf(e).Elem()
+		for i := 0; i < rv.NumField(); i++ {
+			if !rv.Field(i).IsNil() {
+				set = append(set, rv.Type().Field(i).Name)
+			}
+		}
+	}
+	switch len(set) {
+	case 0:
+		return errors.New("edit is empty")
+	case 1:
+	default:
+		return fmt.Errorf("edit must have exactly one kind but has %s", strings.Join(set, ", "))
+	}
+
+	pa.local = map[string]Builder{}
+	switch {
+	case e.AddMessage != nil:
+		return pa.addMessage(e.AddMessage)
+	case e.AddEnum != nil:
+		return pa.addEnum(e.AddEnum)
+	case e.AddService != nil:
+		return pa.addService(e.AddService)
+	case e.AddField != nil:
+		return pa.addField(e.AddField)
+	case e.AddEnumValue != nil:
+		return pa.addEnumValue(e.AddEnumValue)
+	case e.AddMethod != nil:
+		return pa.addMethod(e.AddMethod)
+	case e.Rename != nil:
+		return pa.rename(e.Rename)
+	case e.Remove != nil:
+		return pa.remove(e.Remove)
+	case e.SetOption != nil:
+		return pa.setOption(e.SetOption)
+	case e.ClearOption != nil:
+		return pa.clearOption(e.ClearOption)
+	default:
+		return pa.setComments(e.SetComments)
+	}
+}
+
+// find returns the element in the file with the given name.
+func (pa *patcher) find(name string) (Builder, error) {
+	name = strings.TrimPrefix(name, ".")
+	if name == "" {
+		return pa.file, nil
+	}
+	if b := pa.file.findFullyQualifiedElement(name); b != nil {
+		return b, nil
+	}
+	return nil, fmt.Errorf("file %q has no element named %s", pa.file.GetName(), name)
+}
+
+// findContainer returns the file or message with the given name.
+func (pa *patcher) findContainer(name string) (Builder, error) {
+	b, err := pa.find(name)
+	if err != nil {
+		return nil, err
+	}
+	switch b.(type) {
+	case *FileBuilder, *MessageBuilder:
+		return b, nil
+	default:
+		return nil, fmt.Errorf("%s is not a file or message", name)
+	}
+}
+
+// resolve returns the message or enum with the given name, which is either a
+// builder or a descriptor.
+func (pa *patcher) resolve(name string) (interface{}, error) {
+	name = strings.TrimPrefix(name, ".")
+	if b := pa.local[name]; b != nil {
+		return b, nil
+	}
+	if b := pa.file.findFullyQualifiedElement(name); b != nil {
+		return b, nil
+	}
+	deps := make([]*FileBuilder, 0, len(pa.file.explicitDeps))
+	for dep := range pa.file.explicitDeps {
+		deps = append(deps, dep)
+	}
+	sort.Slice(deps, func(i, j int) bool {
+		return deps[i].GetName() < deps[j].GetName()
+	})
+	for _, dep := range deps {
+		if b := dep.findFullyQualifiedElement(name); b != nil {
+			return b, nil
+		}
+	}
+	for _, fd := range pa.importedFiles() {
+		if d := fd.FindSymbol(name); d != nil {
+			return d, nil
+		}
+	}
+	return nil, fmt.Errorf("unknown type %s", name)
+}
+
+// importedFiles returns the files that the file being patched imports or
+// refers to, the files given in the options, and all of their dependencies.
+func (pa *patcher) importedFiles() []*desc.FileDescriptor {
+	if pa.imports != nil {
+		return pa.imports
+	}
+	seen := map[*desc.FileDescriptor]struct{}{}
+	var add func(fd *desc.FileDescriptor)
+	add = func(fd *desc.FileDescriptor) {
+		if _, ok := seen[fd]; ok {
+			return
+		}
+		seen[fd] = struct{}{}
+		pa.imports = append(pa.imports, fd)
+		for _, dep := range fd.GetDependencies() {
+			add(dep)
+		}
+	}
+	var explicit []*desc.FileDescriptor
+	for fd := range pa.file.explicitImports {
+		explicit = append(explicit, fd)
+	}
+	sort.Slice(explicit, func(i, j int) bool {
+		return explicit[i].GetName() < explicit[j].GetName()
+	})
+	for _, fd := range explicit {
+		add(fd)
+	}
+	walkBuilders(pa.file, func(b Builder) {
+		switch b := b.(type) {
+		case *FieldBuilder:
+			if b.fieldType.foreignMsgType != nil {
+				add(b.fieldType.foreignMsgType.GetFile())
+			}
+			if b.fieldType.foreignEnumType != nil {
+				add(b.fieldType.foreignEnumType.GetFile())
+			}
+			if b.foreignExtendee != nil {
+				add(b.foreignExtendee.GetFile())
+			}
+		case *MethodBuilder:
+			if b.ReqType.foreignType != nil {
+				add(b.ReqType.foreignType.GetFile())
+			}
+			if b.RespType.foreignType != nil {
+				add(b.RespType.foreignType.GetFile())
+			}
+		}
+	})
+	for _, fd := range pa.opts.Dependencies {
+		add(fd)
+	}
+	if pa.imports == nil {
+		pa.imports = []*desc.FileDescriptor{}
+	}
+	return pa.imports
+}
+
+// walkBuilders calls fn for b and all of its descendants.
+func walkBuilders(b Builder, fn func(Builder)) {
+	fn(b)
+	for _, ch := range b.GetChildren() {
+		walkBuilders(ch, fn)
+	}
+}
+
+func (pa *patcher) addMessage(ed *AddMessageEdit) error {
+	if ed.Message == nil {
+		return errors.New("no message given")
+	}
+	parent, err := pa.findContainer(ed.Parent)
+	if err != nil {
+		return err
+	}
+	mb, err := pa.declareMessage(ed.Message, qualify(parent, ed.Message.GetName()))
+	if err != nil {
+		return err
+	}
+	switch parent := parent.(type) {
+	case *FileBuilder:
+		err = parent.TryAddMessage(mb)
+	case *MessageBuilder:
+		err = parent.TryAddNestedMessage(mb)
+	}
+	if err != nil {
+		return err
+	}
+	return pa.defineMessage(mb, ed.Message, qualify(parent, ed.Message.GetName()))
+}
+
+func qualify(parent Builder, name string) string {
+	if fqn := GetFullyQualifiedName(parent); fqn != "" {
+		return fqn + "." + name
+	}
+	return name
+}
+
+// declareMessage creates a builder for the given message, along with its
+// nested messages and enums, but without any fields. This way, the message's
+// fields can refer to any of them.
+func (pa *patcher) declareMessage(md *descriptorpb.DescriptorProto, fqn string) (*MessageBuilder, error) {
+	if err := checkName(md.GetName()); err != nil {
+		return nil, err
+	}
+	mb := NewMessage(md.GetName())
+	pa.local[fqn] = mb
+	for _, nmd := range md.GetNestedType() {
+		nmb, err := pa.declareMessage(nmd, fqn+"."+nmd.GetName())
+		if err != nil {
+			return nil, err
+		}
+		// map entries and groups are linked in when their field is added
+		if nmd.GetOptions().GetMapEntry() || isGroupType(md, fqn+"."+nmd.GetName()) {
+			continue
+		}
+		if err := mb.TryAddNestedMessage(nmb); err != nil {
+			return nil, err
+		}
+	}
+	for _, ed := range md.GetEnumType() {
+		eb, err := pa.newEnum(ed)
+		if err != nil {
+			return nil, err
+		}
+		pa.local[fqn+"."+ed.GetName()] = eb
+		if err := mb.TryAddNestedEnum(eb); err != nil {
+			return nil, err
+		}
+	}
+	return mb, nil
+}
+
+func isGroupType(md *descriptorpb.DescriptorProto, fqn string) bool {
+	for _, fld := range md.GetField() {
+		if fld.GetType() == descriptorpb.FieldDescriptorProto_TYPE_GROUP && strings.TrimPrefix(fld.GetTypeName(), ".") == fqn {
+			return true
+		}
+	}
+	return false
+}
+
+// defineMessage adds the fields and other contents of the given message to a
+// builder created by declareMessage.
+func (pa *patcher) defineMessage(mb *MessageBuilder, md *descriptorpb.DescriptorProto, fqn string) error {
+	mb.Options = md.GetOptions()
+	mb.ExtensionRanges = md.GetExtensionRange()
+	mb.ReservedRanges = md.GetReservedRange()
+	mb.ReservedNames = md.GetReservedName()
+
+	oneOfs := make([]*OneOfBuilder, len(md.GetOneofDecl()))
+	for _, fld := range md.GetField() {
+		flb, err := pa.newMessageField(fld, md, fqn)
+		if err != nil {
+			return err
+		}
+		if fld.OneofIndex == nil || fld.GetProto3Optional() {
+			if err := mb.TryAddField(flb); err != nil {
+				return err
+			}
+			continue
+		}
+		idx := int(fld.GetOneofIndex())
+		if idx < 0 || idx >= len(oneOfs) {
+			return fmt.Errorf("field %s.%s has invalid one-of index %d", fqn, fld.GetName(), idx)
+		}
+		// add one-ofs in the order of their first constituent field
+		oob := oneOfs[idx]
+		if oob == nil {
+			ood := md.GetOneofDecl()[idx]
+			if err := checkName(ood.GetName()); err != nil {
+				return err
+			}
+			oob = NewOneOf(ood.GetName())
+			oob.Options = ood.GetOptions()
+			if err := mb.TryAddOneOf(oob); err != nil {
+				return err
+			}
+			oneOfs[idx] = oob
+		}
+		if err := oob.TryAddChoice(flb); err != nil {
+			return err
+		}
+	}
+
+	for _, nmd := range md.GetNestedType() {
+		nfqn := fqn + "." + nmd.GetName()
+		if nmd.GetOptions().GetMapEntry() {
+			continue
+		}
+		if err := pa.defineMessage(pa.local[nfqn].(*MessageBuilder), nmd, nfqn); err != nil {
+			return err
+		}
+	}
+	for _, exd := range md.GetExtension() {
+		exb, err := pa.newField(exd)
+		if err != nil {
+			return err
+		}
+		if err := mb.TryAddNestedExtension(exb); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// newMessageField creates a field of a message that is being added, which may
+// be a map or group field whose message is nested in the same message.
+func (pa *patcher) newMessageField(fld *descriptorpb.FieldDescriptorProto, md *descriptorpb.DescriptorProto, fqn string) (*FieldBuilder, error) {
+	typeName := strings.TrimPrefix(fld.GetTypeName(), ".")
+	for _, nmd := range md.GetNestedType() {
+		if fqn+"."+nmd.GetName() != typeName {
+			continue
+		}
+		if fld.GetType() == descriptorpb.FieldDescriptorProto_TYPE_GROUP {
+			flb := NewGroupField(pa.local[typeName].(*MessageBuilder))
+			if flb.GetName() != fld.GetName() {
+				return nil, fmt.Errorf("group field %s.%s must be named %q", fqn, fld.GetName(), flb.GetName())
+			}
+			if err := pa.setFieldAttributes(flb, fld); err != nil {
+				return nil, err
+			}
+			return flb, nil
+		}
+		if nmd.GetOptions().GetMapEntry() {
+			key := findFieldByNumber(nmd, 1)
+			val := findFieldByNumber(nmd, 2)
+			if key == nil || val == nil {
+				return nil, fmt.Errorf("map entry %s must have key and value fields", typeName)
+			}
+			return pa.newMapField(fld, key, val)
+		}
+	}
+	return pa.newField(fld)
+}
+
+func findFieldByNumber(md *descriptorpb.DescriptorProto, num int32) *descriptorpb.FieldDescriptorProto {
+	for _, fld := range md.GetField() {
+		if fld.GetNumber() == num {
+			return fld
+		}
+	}
+	return nil
+}
+
+func (pa *patcher) newMapField(fld, key, val *descriptorpb.FieldDescriptorProto) (*FieldBuilder, error) {
+	if err := checkName(fld.GetName()); err != nil {
+		return nil, err
+	}
+	keyType, err := pa.fieldType(key.Type, key.GetTypeName())
+	if err != nil {
+		return nil, err
+	}
+	if !isValidMapKeyType(keyType) {
+		return nil, fmt.Errorf("map field %s has invalid key type %v", fld.GetName(), keyType.fieldType)
+	}
+	valType, err := pa.fieldType(val.Type, val.GetTypeName())
+	if err != nil {
+		return nil, err
+	}
+	if valType.fieldType == descriptorpb.FieldDescriptorProto_TYPE_GROUP {
+		return nil, fmt.Errorf("map field %s cannot have a group value", fld.GetName())
+	}
+	flb := NewMapField(fld.GetName(), keyType, valType)
+	flb.Options = fld.GetOptions()
+	flb.JsonName = fld.GetJsonName()
+	if fld.GetNumber() != 0 {
+		if err := flb.TrySetNumber(fld.GetNumber()); err != nil {
+			return nil, err
+		}
+	}
+	return flb, nil
+}
+
+// newField creates a field, which is an extension if it has an extendee.
+func (pa *patcher) newField(fld *descriptorpb.FieldDescriptorProto) (*FieldBuilder, error) {
+	if err := checkName(fld.GetName()); err != nil {
+		return nil, err
+	}
+	if fld.GetType() == descriptorpb.FieldDescriptorProto_TYPE_GROUP {
+		return nil, fmt.Errorf("group field %s can only be added along with its message", fld.GetName())
+	}
+	ft, err := pa.fieldType(fld.Type, fld.GetTypeName())
+	if err != nil {
+		return nil, err
+	}
+	flb := NewField(fld.GetName(), ft)
+	if err := pa.setFieldAttributes(flb, fld); err != nil {
+		return nil, err
+	}
+	if fld.Extendee == nil {
+		return flb, nil
+	}
+	if fld.GetNumber() == 0 {
+		return nil, fmt.Errorf("extension %s must have a number", fld.GetName())
+	}
+	extendee, err := pa.resolve(fld.GetExtendee())
+	if err != nil {
+		return nil, err
+	}
+	switch extendee := extendee.(type) {
+	case *MessageBuilder:
+		flb.localExtendee = extendee
+	case *desc.MessageDescriptor:
+		flb.foreignExtendee = extendee
+	default:
+		return nil, fmt.Errorf("extendee %s of extension %s is not a message", fld.GetExtendee(), fld.GetName())
+	}
+	return flb, nil
+}
+
+func (pa *patcher) setFieldAttributes(flb *FieldBuilder, fld *descriptorpb.FieldDescriptorProto) error {
+	flb.Options = fld.GetOptions()
+	if fld.Label != nil {
+		flb.Label = fld.GetLabel()
+	}
+	flb.Proto3Optional = fld.GetProto3Optional()
+	flb.Default = fld.GetDefaultValue()
+	flb.JsonName = fld.GetJsonName()
+	if fld.GetNumber() != 0 {
+		return flb.TrySetNumber(fld.GetNumber())
+	}
+	return nil
+}
+
+// fieldType returns the type for a field with the given type and type name.
+// If the type is nil, it is inferred from the type name.
+func (pa *patcher) fieldType(typ *descriptorpb.FieldDescriptorProto_Type, typeName string) (*FieldType, error) {
+	if typeName == "" {
+		if typ == nil {
+			return nil, errors.New("field has no type")
+		}
+		t := *typ
+		switch t {
+		case descriptorpb.FieldDescriptorProto_TYPE_MESSAGE,
+			descriptorpb.FieldDescriptorProto_TYPE_GROUP,
+			descriptorpb.FieldDescriptorProto_TYPE_ENUM:
+			return nil, fmt.Errorf("field of type %v has no type name", t)
+		}
+		if _, ok := descriptorpb.FieldDescriptorProto_Type_name[int32(t)]; !ok {
+			return nil, fmt.Errorf("invalid field type %v", t)
+		}
+		return FieldTypeScalar(t), nil
+	}
+	el, err := pa.resolve(typeName)
+	if err != nil {
+		return nil, err
+	}
+	var ft *FieldType
+	isEnum := false
+	switch el := el.(type) {
+	case *MessageBuilder:
+		ft = FieldTypeMessage(el)
+	case *desc.MessageDescriptor:
+		ft = FieldTypeImportedMessage(el)
+	case *EnumBuilder:
+		ft, isEnum = FieldTypeEnum(el), true
+	case *desc.EnumDescriptor:
+		ft, isEnum = FieldTypeImportedEnum(el), true
+	default:
+		return nil, fmt.Errorf("%s is not a message or enum", typeName)
+	}
+	if typ == nil {
+		return ft, nil
+	}
+	switch t := *typ; t {
+	case descriptorpb.FieldDescriptorProto_TYPE_ENUM:
+		if !isEnum {
+			return nil, fmt.Errorf("%s is not an enum", typeName)
+		}
+	case descriptorpb.FieldDescriptorProto_TYPE_MESSAGE, descriptorpb.FieldDescriptorProto_TYPE_GROUP:
+		if isEnum {
+			return nil, fmt.Errorf("%s is not a message", typeName)
+		}
+		ft.fieldType = t
+	default:
+		return nil, fmt.Errorf("field of type %v cannot have a type name", t)
+	}
+	return ft, nil
+}
+
+func (pa *patcher) addField(ed *AddFieldEdit) error {
+	if ed.Field == nil {
+		return errors.New("no field given")
+	}
+	parent, err := pa.findContainer(ed.Parent)
+	if err != nil {
+		return err
+	}
+	var flb *FieldBuilder
+	if ed.MapKey != nil || ed.MapValue != nil {
+		if ed.MapKey == nil || ed.MapValue == nil {
+			return errors.New("map fields must have both a key and a value")
+		}
+		flb, err = pa.newMapField(ed.Field, ed.MapKey, ed.MapValue)
+	} else {
+		flb, err = pa.newField(ed.Field)
+	}
+	if err != nil {
+		return err
+	}
+
+	if flb.IsExtension() {
+		if ed.OneOf != "" || flb.IsMap() {
+			return fmt.Errorf("extension %s cannot be in a one-of or be a map", flb.GetName())
+		}
+		switch parent := parent.(type) {
+		case *FileBuilder:
+			return parent.TryAddExtension(flb)
+		case *MessageBuilder:
+			return parent.TryAddNestedExtension(flb)
+		}
+	}
+	mb, ok := parent.(*MessageBuilder)
+	if !ok {
+		return fmt.Errorf("field %s must be added to a message", flb.GetName())
+	}
+	if err := checkReserved(mb, flb.GetName(), flb.GetNumber(), flb.GetNumber() != 0); err != nil {
+		return err
+	}
+	if ed.OneOf == "" {
+		return mb.TryAddField(flb)
+	}
+	if oob := mb.GetOneOf(ed.OneOf); oob != nil {
+		return oob.TryAddChoice(flb)
+	}
+	if err := checkName(ed.OneOf); err != nil {
+		return err
+	}
+	oob := NewOneOf(ed.OneOf)
+	if err := mb.TryAddOneOf(oob); err != nil {
+		return err
+	}
+	return oob.TryAddChoice(flb)
+}
+
+func (pa *patcher) addEnum(ed *AddEnumEdit) error {
+	if ed.Enum == nil {
+		return errors.New("no enum given")
+	}
+	parent, err := pa.findContainer(ed.Parent)
+	if err != nil {
+		return err
+	}
+	eb, err := pa.newEnum(ed.Enum)
+	if err != nil {
+		return err
+	}
+	switch parent := parent.(type) {
+	case *FileBuilder:
+		return parent.TryAddEnum(eb)
+	default:
+		return parent.(*MessageBuilder).TryAddNestedEnum(eb)
+	}
+}
+
+func (pa *patcher) newEnum(ed *descriptorpb.EnumDescriptorProto) (*EnumBuilder, error) {
+	if err := checkName(ed.GetName()); err != nil {
+		return nil, err
+	}
+	eb := NewEnum(ed.GetName())
+	eb.Options = ed.GetOptions()
+	eb.ReservedRanges = ed.GetReservedRange()
+	eb.ReservedNames = ed.GetReservedName()
+	for _, evd := range ed.GetValue() {
+		evb, err := pa.newEnumValue(evd)
+		if err != nil {
+			return nil, err
+		}
+		if err := eb.TryAddValue(evb); err != nil {
+			return nil, err
+		}
+	}
+	return eb, nil
+}
+
+func (pa *patcher) newEnumValue(evd *descriptorpb.EnumValueDescriptorProto) (*EnumValueBuilder, error) {
+	if err := checkName(evd.GetName()); err != nil {
+		return nil, err
+	}
+	evb := NewEnumValue(evd.GetName())
+	evb.Options = evd.GetOptions()
+	if err := evb.TrySetNumber(evd.GetNumber()); err != nil {
+		return nil, err
+	}
+	return evb, nil
+}
+
+func (pa *patcher) addEnumValue(ed *AddEnumValueEdit) error {
+	if ed.Value == nil {
+		return errors.New("no enum value given")
+	}
+	b, err := pa.find(ed.Enum)
+	if err != nil {
+		return err
+	}
+	eb, ok := b.(*EnumBuilder)
+	if !ok {
+		return fmt.Errorf("%s is not an enum", ed.Enum)
+	}
+	evb, err := pa.newEnumValue(ed.Value)
+	if err != nil {
+		return err
+	}
+	if err := checkReserved(eb, evb.GetName(), evb.GetNumber(), true); err != nil {
+		return err
+	}
+	return eb.TryAddValue(evb)
+}
+
+// checkReserved returns an error if the given name or number of a field or
+// enum value is reserved by the given message or enum. Patches always check
+// reservations, whether or not the builder enforces them.
+func checkReserved(container Builder, name string, number int32, hasNumber bool) error {
+	switch c := container.(type) {
+	case *MessageBuilder:
+		if c.isReservedName(name) {
+			return fmt.Errorf("message %s has reserved field name %q", GetFullyQualifiedName(c), name)
+		}
+		if hasNumber && c.isReservedTag(number) {
+			return fmt.Errorf("message %s has reserved tag %d, so it cannot be used by field %s", GetFullyQualifiedName(c), number, name)
+		}
+	case *EnumBuilder:
+		if c.isReservedName(name) {
+			return fmt.Errorf("enum %s has reserved value name %q", GetFullyQualifiedName(c), name)
+		}
+		if hasNumber && c.isReservedNumber(number) {
+			return fmt.Errorf("enum %s has reserved number %d, so it cannot be used by value %s", GetFullyQualifiedName(c), number, name)
+		}
+	}
+	return nil
+}
+
+func (pa *patcher) addService(ed *AddServiceEdit) error {
+	if ed.Service == nil {
+		return errors.New("no service given")
+	}
+	if err := checkName(ed.Service.GetName()); err != nil {
+		return err
+	}
+	sb := NewService(ed.Service.GetName())
+	sb.Options = ed.Service.GetOptions()
+	for _, mtd := range ed.Service.GetMethod() {
+		mtb, err := pa.newMethod(mtd)
+		if err != nil {
+			return err
+		}
+		if err := sb.TryAddMethod(mtb); err != nil {
+			return err
+		}
+	}
+	return pa.file.TryAddService(sb)
+}
+
+func (pa *patcher) newMethod(mtd *descriptorpb.MethodDescriptorProto) (*MethodBuilder, error) {
+	if err := checkName(mtd.GetName()); err != nil {
+		return nil, err
+	}
+	req, err := pa.rpcType(mtd.GetInputType(), mtd.GetClientStreaming())
+	if err != nil {
+		return nil, err
+	}
+	resp, err := pa.rpcType(mtd.GetOutputType(), mtd.GetServerStreaming())
+	if err != nil {
+		return nil, err
+	}
+	mtb := NewMethod(mtd.GetName(), req, resp)
+	mtb.Options = mtd.GetOptions()
+	return mtb, nil
+}
+
+func (pa *patcher) rpcType(typeName string, stream bool) (*RpcType, error) {
+	if typeName == "" {
+		return nil, errors.New("method has no request or response type")
+	}
+	typ, err := pa.resolve(typeName)
+	if err != nil {
+		return nil, err
+	}
+	switch typ := typ.(type) {
+	case *MessageBuilder:
+		return RpcTypeMessage(typ, stream), nil
+	case *desc.MessageDescriptor:
+		return RpcTypeImportedMessage(typ, stream), nil
+	default:
+		return nil, fmt.Errorf("%s is not a message", typeName)
+	}
+}
+
+func (pa *patcher) addMethod(ed *AddMethodEdit) error {
+	if ed.Method == nil {
+		return errors.New("no method given")
+	}
+	b, err := pa.find(ed.Service)
+	if err != nil {
+		return err
+	}
+	sb, ok := b.(*ServiceBuilder)
+	if !ok {
+		return fmt.Errorf("%s is not a service", ed.Service)
+	}
+	mtb, err := pa.newMethod(ed.Method)
+	if err != nil {
+		return err
+	}
+	return sb.TryAddMethod(mtb)
+}
+
+func (pa *patcher) rename(ed *RenameEdit) error {
+	b, err := pa.find(ed.Element)
+	if err != nil {
+		return err
+	}
+	if b == pa.file {
+		return errors.New("cannot rename the file")
+	}
+	switch b := b.(type) {
+	case *FieldBuilder:
+		owner := b.GetParent()
+		if oob, ok := owner.(*OneOfBuilder); ok {
+			owner = oob.GetParent()
+		}
+		if !b.IsExtension() {
+			if err := checkReserved(owner, ed.NewName, 0, false); err != nil {
+				return err
+			}
+		}
+	case *EnumValueBuilder:
+		if err := checkReserved(b.GetParent(), ed.NewName, 0, false); err != nil {
+			return err
+		}
+	}
+	return b.TrySetName(ed.NewName)
+}
+
+func (pa *patcher) remove(ed *RemoveEdit) error {
+	b, err := pa.find(ed.Element)
+	if err != nil {
+		return err
+	}
+	if b == pa.file {
+		return errors.New("cannot remove the file")
+	}
+	if _, ok := b.GetParent().(*FieldBuilder); ok {
+		return fmt.Errorf("%s is a map entry or group type, which can only be removed along with its field", ed.Element)
+	}
+	if err := pa.checkUnreferenced(b); err != nil {
+		return err
+	}
+	if !ed.Reserve {
+		Unlink(b)
+		return nil
+	}
+	switch b := b.(type) {
+	case *FieldBuilder:
+		if mb, ok := getMessage(b); ok && !b.IsExtension() {
+			mb.TryRemoveFieldAndReserve(b.GetName())
+			return nil
+		}
+	case *OneOfBuilder:
+		b.GetParent().(*MessageBuilder).TryRemoveOneOfAndReserve(b.GetName())
+		return nil
+	case *EnumValueBuilder:
+		b.GetParent().(*EnumBuilder).TryRemoveValueAndReserve(b.GetName())
+		return nil
+	}
+	return fmt.Errorf("%s cannot be reserved; only fields, one-ofs, and enum values can be", ed.Element)
+}
+
+// getMessage returns the message that contains the given field.
+func getMessage(flb *FieldBuilder) (*MessageBuilder, bool) {
+	p := flb.GetParent()
+	if oob, ok := p.(*OneOfBuilder); ok {
+		p = oob.GetParent()
+	}
+	mb, ok := p.(*MessageBuilder)
+	return mb, ok
+}
+
+// checkUnreferenced returns an error if any element in the file, or in one of
+// the dependents given in the options, that is not b or one of its
+// descendants, refers to b or one of its descendants.
+func (pa *patcher) checkUnreferenced(b Builder) error {
+	removed := map[Builder]struct{}{}
+	walkBuilders(b, func(ch Builder) {
+		removed[ch] = struct{}{}
+	})
+	// dependents refer to the original builders, not to the clones in the
+	// file being patched
+	cloneOf := func(b Builder) Builder {
+		if cl, ok := pa.clones[b]; ok {
+			return cl
+		}
+		return b
+	}
+	isRemoved := func(ref Builder) bool {
+		if isNilBuilder(ref) {
+			return false
+		}
+		_, ok := removed[cloneOf(ref)]
+		return ok
+	}
+	var err error
+	checkRefs := func(ch Builder) {
+		if err != nil || isRemoved(ch) {
+			return
+		}
+		var refs []Builder
+		switch ch := ch.(type) {
+		case *FieldBuilder:
+			if ch.msgType == nil {
+				refs = append(refs, ch.fieldType.localMsgType)
+			}
+			refs = append(refs, ch.fieldType.localEnumType, ch.localExtendee)
+		case *MethodBuilder:
+			refs = append(refs, ch.ReqType.localType, ch.RespType.localType)
+		}
+		for _, ref := range refs {
+			if isRemoved(ref) {
+				err = fmt.Errorf("%s is still used by %s", GetFullyQualifiedName(ref), GetFullyQualifiedName(ch))
+				return
+			}
+		}
+	}
+	walkBuilders(pa.file, checkRefs)
+	for _, fb := range pa.opts.Dependents {
+		if cloneOf(fb) == Builder(pa.file) {
+			// the file being patched was already checked
+			continue
+		}
+		walkBuilders(fb, checkRefs)
+	}
+	return err
+}
+
+func isNilBuilder(b Builder) bool {
+	if b == nil {
+		return true
+	}
+	rv := reflect.ValueOf(b)
+	return rv.Kind() == reflect.Ptr && rv.IsNil()
+}
+
+func (pa *patcher) findOptionsBuilder(name string) (optionsBuilder, error) {
+	b, err := pa.find(name)
+	if err != nil {
+		return nil, err
+	}
+	ob, ok := b.(optionsBuilder)
+	if !ok {
+		return nil, fmt.Errorf("%s cannot have options", name)
+	}
+	return ob, nil
+}
+
+// findOption returns the extension for the custom option with the given
+// name, if the name is in parentheses. Otherwise, it returns the field of
+// the options message for the standard option with the given name.
+func (pa *patcher) findOption(ob optionsBuilder, name string) (*desc.FieldDescriptor, error) {
+	if strings.HasPrefix(name, "(") && strings.HasSuffix(name, ")") {
+		extName := trimOptionName(name)
+		if extd := findOptionExtension(ob, extName, nil, nil); extd != nil {
+			return extd, nil
+		}
+		for _, fd := range pa.importedFiles() {
+			if extd, ok := fd.FindSymbol(extName).(*desc.FieldDescriptor); ok && extd.IsExtension() {
+				if err := checkOptionExtension(ob, extd); err != nil {
+					return nil, err
+				}
+				return extd, nil
+			}
+		}
+		return nil, fmt.Errorf("unknown custom option %s for %s", extName, optionsMessageName(ob))
+	}
+	md, err := desc.WrapMessage(ob.getOptions().ProtoReflect().Descriptor())
+	if err != nil {
+		return nil, err
+	}
+	fld := md.FindFieldByName(name)
+	if fld == nil {
+		return nil, fmt.Errorf("unknown option %s for %s", name, optionsMessageName(ob))
+	}
+	return fld, nil
+}
+
+func (pa *patcher) setOption(ed *SetOptionEdit) error {
+	ob, err := pa.findOptionsBuilder(ed.Element)
+	if err != nil {
+		return err
+	}
+	fld, err := pa.findOption(ob, ed.Option)
+	if err != nil {
+		return err
+	}
+	var er dynamic.ExtensionRegistry
+	name := fld.GetName()
+	if fld.IsExtension() {
+		if err := er.AddExtension(fld); err != nil {
+			return err
+		}
+		name = "[" + fld.GetFullyQualifiedName() + "]"
+	}
+	dm := dynamic.NewMessageWithExtensionRegistry(fld.GetOwner(), &er)
+	if err := dm.UnmarshalText([]byte(name + ": " + ed.Value)); err != nil {
+		return fmt.Errorf("invalid value for option %s: %v", ed.Option, err)
+	}
+	if fld.IsExtension() {
+		return setOption(ob, fld, dm.GetField(fld))
+	}
+	data, err := dm.Marshal()
+	if err != nil {
+		return fmt.Errorf("invalid value for option %s: %v", ed.Option, err)
+	}
+	opts := clearedStandardOption(ob.getOptions(), fld)
+	if err := (proto.UnmarshalOptions{Merge: true}).Unmarshal(data, opts); err != nil {
+		return fmt.Errorf("invalid value for option %s: %v", ed.Option, err)
+	}
+	ob.setOptions(opts)
+	return nil
+}
+
+// clearedStandardOption returns a copy of the given options, with the given
+// standard option cleared. If opts is nil, a new, empty options message is
+// returned.
+func clearedStandardOption(opts proto.Message, fld *desc.FieldDescriptor) proto.Message {
+	if isNilOptions(opts) {
+		return opts.ProtoReflect().New().Interface()
+	}
+	opts = proto.Clone(opts)
+	ref := opts.ProtoReflect()
+	ref.Clear(ref.Descriptor().Fields().ByNumber(fld.UnwrapField().Number()))
+	return opts
+}
+
+func (pa *patcher) clearOption(ed *ClearOptionEdit) error {
+	ob, err := pa.findOptionsBuilder(ed.Element)
+	if err != nil {
+		return err
+	}
+	fld, err := pa.findOption(ob, ed.Option)
+	if err != nil {
+		return err
+	}
+	if fld.IsExtension() {
+		clearOption(ob, fld)
+	} else if opts := ob.getOptions(); !isNilOptions(opts) {
+		ob.setOptions(clearedStandardOption(opts, fld))
+	}
+	return nil
+}
+
+func (pa *patcher) setComments(ed *SetCommentsEdit) error {
+	b, err := pa.find(ed.Element)
+	if err != nil {
+		return err
+	}
+	*b.GetComments() = Comments{
+		LeadingDetachedComments: ed.LeadingDetachedComments,
+		LeadingComment:          ed.LeadingComment,
+		TrailingComment:         ed.TrailingComment,
+	}
+	return nil
+}
@@ -0,0 +1,371 @@
+package builder
+
+import (
+	"errors"
+	"strings"
+	"testing"
+
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/types/descriptorpb"
+
+	"github.com/jhump/protoreflect/desc"
+	"github.com/jhump/protoreflect/internal/testprotos"
+	"github.com/jhump/protoreflect/internal/testutil"
+)
+
+const testPatch = `
+edits {
+  add_message {
+    message {
+      name: "Request"
+      field { name: "id" number: 1 type: TYPE_STRING }
+      field { name: "tags" number: 2 label: LABEL_REPEATED type: TYPE_MESSAGE type_name: ".foo.bar.Request.TagsEntry" }
+      field { name: "status" number: 3 type_name: "foo.bar.Request.Status" }
+      nested_type {
+        name: "TagsEntry"
+        field { name: "key" number: 1 type: TYPE_STRING }
+        field { name: "value" number: 2 type: TYPE_INT32 }
+        options { map_entry: true }
+      }
+      enum_type {
+        name: "Status"
+        value { name: "UNKNOWN" number: 0 }
+        value { name: "OK" number: 1 }
+      }
+    }
+  }
+}
+edits {
+  add_field {
+    parent: "foo.bar.Request"
+    field { name: "msg" number: 4 type_name: ".testprotos.TestMessage" }
+  }
+}
+edits {
+  add_field {
+    parent: "foo.bar.Request"
+    one_of: "choice"
+    field { name: "a" number: 5 type: TYPE_INT32 }
+  }
+}
+edits {
+  add_field {
+    parent: "foo.bar.Request"
+    field { name: "counts" number: 6 }
+    map_key { type: TYPE_STRING }
+    map_value { type: TYPE_UINT64 }
+  }
+}
+edits { rename { element: "foo.bar.Request.Status.OK" new_name: "SUCCESS" } }
+edits { set_option { element: "foo.bar.Request.id" option: "deprecated" value: "true" } }
+edits { set_option { element: "foo.bar.Request" option: "(testprotos.mfubar)" value: "true" } }
+edits {
+  add_service {
+    service {
+      name: "Service"
+      method { name: "Get" input_type: ".foo.bar.Request" output_type: ".foo.bar.Request" }
+    }
+  }
+}
+edits {
+  add_method {
+    service: "foo.bar.Service"
+    method { name: "Watch" input_type: "foo.bar.Request" output_type: "foo.bar.Request" server_streaming: true }
+  }
+}
+edits { set_comments { element: "foo.bar.Request" leading_comment: " A request.\n" } }
+`
+
+func testPatchOptions(t *testing.T) PatchOptions {
+	md, err := desc.LoadMessageDescriptorForMessage((*testprotos.TestMessage)(nil))
+	testutil.Ok(t, err)
+	opts, err := desc.LoadFileDescriptor("desc_test_options.proto")
+	testutil.Ok(t, err)
+	return PatchOptions{Dependencies: []*desc.FileDescriptor{md.GetFile(), opts}}
+}
+
+func TestApplyPatch(t *testing.T) {
+	var p Patch
+	testutil.Ok(t, p.UnmarshalText([]byte(testPatch)))
+	testutil.Eq(t, 10, len(p.Edits))
+
+	fb := NewFile("foo.proto").SetPackageName("foo.bar").SetProto3(true)
+	testutil.Ok(t, testPatchOptions(t).Apply(fb, &p))
+
+	fd, err := fb.Build()
+	testutil.Ok(t, err)
+	md := fd.FindMessage("foo.bar.Request")
+	testutil.Require(t, md != nil)
+	testutil.Eq(t, " A request.\n", md.GetSourceInfo().GetLeadingComments())
+	testutil.Eq(t, []byte{0xa8, 0xf7, 0x04, 0x01}, []byte(md.GetMessageOptions().ProtoReflect().GetUnknown()))
+
+	fld := md.FindFieldByName("id")
+	testutil.Require(t, fld.GetFieldOptions().GetDeprecated())
+	fld = md.FindFieldByName("tags")
+	testutil.Require(t, fld.IsMap())
+	testutil.Eq(t, descriptorpb.FieldDescriptorProto_TYPE_INT32, fld.GetMapValueType().GetType())
+	fld = md.FindFieldByName("status")
+	testutil.Eq(t, "foo.bar.Request.Status", fld.GetEnumType().GetFullyQualifiedName())
+	testutil.Require(t, fld.GetEnumType().FindValueByName("SUCCESS") != nil)
+	fld = md.FindFieldByName("msg")
+	testutil.Eq(t, "testprotos.TestMessage", fld.GetMessageType().GetFullyQualifiedName())
+	fld = md.FindFieldByName("a")
+	testutil.Eq(t, "choice", fld.GetOneOf().GetName())
+	fld = md.FindFieldByName("counts")
+	testutil.Require(t, fld.IsMap())
+	testutil.Eq(t, descriptorpb.FieldDescriptorProto_TYPE_UINT64, fld.GetMapValueType().GetType())
+
+	sd := fd.FindService("foo.bar.Service")
+	testutil.Require(t, sd != nil)
+	testutil.Eq(t, md, sd.FindMethodByName("Get").GetInputType())
+	testutil.Require(t, sd.FindMethodByName("Watch").IsServerStreaming())
+
+	var deps []string
+	for _, dep := range fd.GetDependencies() {
+		deps = append(deps, dep.GetName())
+	}
+	testutil.Eq(t, []string{"desc_test1.proto", "desc_test_options.proto"}, deps)
+}
+
+func TestApplyPatch_Replay(t *testing.T) {
+	var p Patch
+	testutil.Ok(t, p.UnmarshalText([]byte(testPatch)))
+
+	// the patch survives a round-trip through JSON
+	js, err := p.MarshalJSON()
+	testutil.Ok(t, err)
+	var p2 Patch
+	testutil.Ok(t, p2.UnmarshalJSON(js))
+	testutil.Eq(t, len(p.Edits), len(p2.Edits))
+	testutil.Require(t, proto.Equal(p.Edits[0].AddMessage.Message, p2.Edits[0].AddMessage.Message))
+	text, err := p2.MarshalText()
+	testutil.Ok(t, err)
+	var p3 Patch
+	testutil.Ok(t, p3.UnmarshalText(text))
+	js2, err := p3.MarshalJSON()
+	testutil.Ok(t, err)
+	testutil.Eq(t, string(js), string(js2))
+
+	// and applying it again produces the same result
+	opts := testPatchOptions(t)
+	fb1 := NewFile("foo.proto").SetPackageName("foo.bar").SetProto3(true)
+	testutil.Ok(t, opts.Apply(fb1, &p))
+	fb2 := NewFile("foo.proto").SetPackageName("foo.bar").SetProto3(true)
+	testutil.Ok(t, opts.Apply(fb2, &p3))
+	testutil.Require(t, Equal(fb1, fb2), "%v", Diff(fb1, fb2))
+	fd1, err := fb1.Build()
+	testutil.Ok(t, err)
+	fd2, err := fb2.Build()
+	testutil.Ok(t, err)
+	testutil.Require(t, proto.Equal(fd1.AsFileDescriptorProto(), fd2.AsFileDescriptorProto()))
+}
+
+func TestApplyPatch_IsAtomic(t *testing.T) {
+	fd, err := desc.LoadFileDescriptor("desc_test1.proto")
+	testutil.Ok(t, err)
+	fb, err := FromFile(fd)
+	testutil.Ok(t, err)
+	before := fb.Clone()
+
+	p := &Patch{Edits: []*Edit{
+		{Rename: &RenameEdit{Element: "testprotos.TestMessage", NewName: "Renamed"}},
+		{AddField: &AddFieldEdit{
+			Parent: "testprotos.Renamed",
+			Field:  &descriptorpb.FieldDescriptorProto{Name: proto.String("x"), Number: proto.Int32(100), Type: descriptorpb.FieldDescriptorProto_TYPE_STRING.Enum()},
+		}},
+		{Remove: &RemoveEdit{Element: "testprotos.Renamed.NestedMessage"}},
+	}}
+	err = fb.ApplyPatch(p)
+	var patchErr *PatchError
+	testutil.Require(t, errors.As(err, &patchErr), "unexpected error: %v", err)
+	testutil.Eq(t, 2, patchErr.Index)
+	testutil.Require(t, strings.Contains(err.Error(), "still used by"), "unexpected error: %v", err)
+	testutil.Require(t, Equal(before, fb), "%v", Diff(before, fb))
+
+	// without the bad edit, it all works
+	p.Edits = p.Edits[:2]
+	testutil.Ok(t, PatchOptions{}.Validate(fb, p))
+	testutil.Require(t, Equal(before, fb), "%v", Diff(before, fb))
+	mb := fb.GetMessage("TestMessage")
+	nmb := mb.GetNestedMessage("NestedMessage")
+	testutil.Ok(t, fb.ApplyPatch(p))
+	testutil.Require(t, fb.GetMessage("TestMessage") == nil)
+	testutil.Require(t, fb.GetMessage("Renamed").GetField("x") != nil)
+	// existing builders were updated in place
+	testutil.Require(t, fb.GetMessage("Renamed") == mb)
+	testutil.Require(t, mb.GetNestedMessage("NestedMessage") == nmb)
+	testutil.Eq(t, Builder(mb), nmb.GetParent())
+	testutil.Eq(t, Builder(fb), mb.GetParent())
+	testutil.Eq(t, Builder(mb), mb.GetField("x").GetParent())
+	// references were updated, too
+	testutil.Eq(t, fb.GetMessage("Renamed"), fb.GetExtension("xtm").GetType().localMsgType)
+	_, err = fb.Build()
+	testutil.Ok(t, err)
+}
+
+func TestApplyPatch_Remove(t *testing.T) {
+	fb := NewFile("foo.proto").SetPackageName("foo")
+	p := &Patch{Edits: []*Edit{
+		{AddEnum: &AddEnumEdit{Enum: &descriptorpb.EnumDescriptorProto{
+			Name: proto.String("Color"),
+			Value: []*descriptorpb.EnumValueDescriptorProto{
+				{Name: proto.String("RED"), Number: proto.Int32(0)},
+				{Name: proto.String("GREEN"), Number: proto.Int32(1)},
+			},
+		}}},
+		{AddMessage: &AddMessageEdit{Message: &descriptorpb.DescriptorProto{
+			Name: proto.String("Foo"),
+			Field: []*descriptorpb.FieldDescriptorProto{
+				{Name: proto.String("a"), Number: proto.Int32(1), Type: descriptorpb.FieldDescriptorProto_TYPE_STRING.Enum()},
+				{Name: proto.String("b"), Number: proto.Int32(2), Type: descriptorpb.FieldDescriptorProto_TYPE_STRING.Enum()},
+			},
+		}}},
+		{Remove: &RemoveEdit{Element: "foo.Foo.a", Reserve: true}},
+		{Remove: &RemoveEdit{Element: "foo.Foo.b"}},
+		{Remove: &RemoveEdit{Element: "foo.Color.GREEN", Reserve: true}},
+	}}
+	testutil.Ok(t, fb.ApplyPatch(p))
+	mb := fb.GetMessage("Foo")
+	testutil.Eq(t, 0, len(mb.GetChildren()))
+	testutil.Eq(t, []string{"a"}, mb.ReservedNames)
+	testutil.Eq(t, 1, len(mb.ReservedRanges))
+	eb := fb.GetEnum("Color")
+	testutil.Eq(t, []string{"GREEN"}, eb.ReservedNames)
+
+	// reserved names cannot be re-used
+	err := fb.ApplyPatch(&Patch{Edits: []*Edit{
+		{AddField: &AddFieldEdit{Parent: "foo.Foo", Field: &descriptorpb.FieldDescriptorProto{Name: proto.String("a"), Number: proto.Int32(3), Type: descriptorpb.FieldDescriptorProto_TYPE_STRING.Enum()}}},
+	}})
+	testutil.Nok(t, err)
+}
+
+func TestApplyPatch_RemoveUsedByDependent(t *testing.T) {
+	fbA := NewFile("a.proto").SetPackageName("foo")
+	foo := NewMessage("Foo")
+	fbA.AddMessage(foo)
+	fbB := NewFile("b.proto").SetPackageName("foo")
+	fbB.AddMessage(NewMessage("Bar").AddField(NewField("f", FieldTypeMessage(foo))))
+
+	p := &Patch{Edits: []*Edit{{Remove: &RemoveEdit{Element: "foo.Foo"}}}}
+	err := PatchOptions{Dependents: []*FileBuilder{fbA, fbB}}.Apply(fbA, p)
+	testutil.Require(t, err != nil && strings.Contains(err.Error(), "foo.Foo is still used by foo.Bar.f"), "unexpected error: %v", err)
+	testutil.Eq(t, foo, fbA.GetMessage("Foo"))
+
+	// uses in files that aren't given are not checked
+	testutil.Ok(t, fbA.ApplyPatch(p))
+	testutil.Require(t, fbA.GetMessage("Foo") == nil)
+}
+
+func TestApplyPatch_Options(t *testing.T) {
+	fb := NewFile("foo.proto").SetPackageName("foo")
+	opts := testPatchOptions(t)
+	p := &Patch{Edits: []*Edit{
+		{AddMessage: &AddMessageEdit{Message: &descriptorpb.DescriptorProto{Name: proto.String("Foo")}}},
+		{SetOption: &SetOptionEdit{Option: "java_package", Value: `"com.foo"`}},
+		{SetOption: &SetOptionEdit{Option: "go_package", Value: `"foo/bar"`}},
+		{SetOption: &SetOptionEdit{Element: "foo.Foo", Option: "deprecated", Value: "true"}},
+		{SetOption: &SetOptionEdit{Element: "foo.Foo", Option: "(testprotos.mfubar)", Value: "true"}},
+		{ClearOption: &ClearOptionEdit{Option: "go_package"}},
+		{ClearOption: &ClearOptionEdit{Element: "foo.Foo", Option: "(testprotos.mfubar)"}},
+	}}
+	testutil.Ok(t, opts.Apply(fb, p))
+	testutil.Eq(t, "com.foo", fb.Options.GetJavaPackage())
+	testutil.Require(t, fb.Options.GoPackage == nil)
+	mb := fb.GetMessage("Foo")
+	testutil.Require(t, mb.Options.GetDeprecated())
+	testutil.Eq(t, 0, len(mb.Options.ProtoReflect().GetUnknown()))
+}
+
+func TestApplyPatch_Errors(t *testing.T) {
+	fb := NewFile("foo.proto").SetPackageName("foo").
+		AddMessage(NewMessage("Foo").
+			AddField(NewField("id", FieldTypeInt64()).SetNumber(1)))
+	str := descriptorpb.FieldDescriptorProto_TYPE_STRING.Enum()
+	testCases := []struct {
+		name string
+		edit *Edit
+		err  string
+	}{
+		{
+			name: "empty edit",
+			edit: &Edit{},
+			err:  "edit is empty",
+		},
+		{
+			name: "two kinds",
+			edit: &Edit{
+				Rename: &RenameEdit{Element: "foo.Foo", NewName: "Bar"},
+				Remove: &RemoveEdit{Element: "foo.Foo"},
+			},
+			err: "exactly one kind",
+		},
+		{
+			name: "unknown element",
+			edit: &Edit{Rename: &RenameEdit{Element: "foo.Bar", NewName: "Baz"}},
+			err:  "no element named foo.Bar",
+		},
+		{
+			name: "invalid name",
+			edit: &Edit{Rename: &RenameEdit{Element: "foo.Foo", NewName: "1abc"}},
+			err:  "invalid",
+		},
+		{
+			name: "unknown type",
+			edit: &Edit{AddField: &AddFieldEdit{Parent: "foo.Foo", Field: &descriptorpb.FieldDescriptorProto{Name: proto.String("x"), TypeName: proto.String("foo.Unknown")}}},
+			err:  "unknown type foo.Unknown",
+		},
+		{
+			name: "conflicting tag",
+			edit: &Edit{AddField: &AddFieldEdit{Parent: "foo.Foo", Field: &descriptorpb.FieldDescriptorProto{Name: proto.String("x"), Number: proto.Int32(1), Type: str}}},
+			err:  "already contains field with tag 1",
+		},
+		{
+			name: "field in file",
+			edit: &Edit{AddField: &AddFieldEdit{Field: &descriptorpb.FieldDescriptorProto{Name: proto.String("x"), Type: str}}},
+			err:  "must be added to a message",
+		},
+		{
+			name: "reserve message",
+			edit: &Edit{Remove: &RemoveEdit{Element: "foo.Foo", Reserve: true}},
+			err:  "cannot be reserved",
+		},
+		{
+			name: "unknown option",
+			edit: &Edit{SetOption: &SetOptionEdit{Element: "foo.Foo", Option: "fubar", Value: "true"}},
+			err:  "unknown option fubar",
+		},
+		{
+			name: "unknown custom option",
+			edit: &Edit{SetOption: &SetOptionEdit{Element: "foo.Foo", Option: "(foo.fubar)", Value: "true"}},
+			err:  "unknown custom option foo.fubar",
+		},
+		{
+			name: "invalid option value",
+			edit: &Edit{SetOption: &SetOptionEdit{Element: "foo.Foo", Option: "deprecated", Value: "123"}},
+			err:  "invalid value for option deprecated",
+		},
+		{
+			name: "group field",
+			edit: &Edit{AddField: &AddFieldEdit{Parent: "foo.Foo", Field: &descriptorpb.FieldDescriptorProto{Name: proto.String("foo"), Type: descriptorpb.FieldDescriptorProto_TYPE_GROUP.Enum(), TypeName: proto.String("foo.Foo")}}},
+			err:  "can only be added along with its message",
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			err := fb.ApplyPatch(&Patch{Edits: []*Edit{tc.edit}})
+			var patchErr *PatchError
+			testutil.Require(t, errors.As(err, &patchErr), "unexpected error: %v", err)
+			testutil.Eq(t, 0, patchErr.Index)
+			testutil.Require(t, strings.Contains(err.Error(), tc.err), "unexpected error: %v", err)
+		})
+	}
+}
+
+func TestPatchDescriptor(t *testing.T) {
+	md, err := PatchDescriptor()
+	testutil.Ok(t, err)
+	testutil.Eq(t, "protoreflect.builder.Patch", md.GetFullyQualifiedName())
+	edit := md.FindFieldByName("edits").GetMessageType()
+	testutil.Eq(t, "protoreflect.builder.Edit", edit.GetFullyQualifiedName())
+	testutil.Eq(t, "google.protobuf.DescriptorProto", edit.FindFieldByName("add_message").GetMessageType().FindFieldByName("message").GetMessageType().GetFullyQualifiedName())
+}
@@ -0,0 +1,658 @@
+package builder
+
+import (
+	"fmt"
+	"sort"
+
+	"google.golang.org/protobuf/encoding/protowire"
+	"google.golang.org/protobuf/reflect/protoreflect"
+
+	"github.com/jhump/protoreflect/desc"
+)
+
+// FileSet is a group of related file builders, such as a set of files that
+// import one another. It supports refactorings that span files, like moving a
+// message from one file to another, while keeping all references between the
+// files intact.
+//
+// Builders refer to other builders directly, so a reference to a message or
+// enum builder remains correct when that builder is renamed or moved. But file
+// builders created with FromFile refer to elements in other files via
+// descriptors, and those references are not updated when the corresponding
+// builders are changed. So when a FileSet is created, all such references to
+// elements in other files in the set are replaced with references to the
+// elements' builders. Similarly, explicit imports of other files in the set are
+// replaced with explicit dependencies on their builders.
+type FileSet struct {
+	files []*FileBuilder
+}
+
+// NewFileSet creates a new set that contains the given files. All references
+// in the given files to elements in other files in the set are re-linked so
+// that they refer to builders instead of descriptors.
+//
+// An error is returned if two files have the same name or if a file refers to
+// an element that cannot be found in the builder for the file that should
+// contain it.
+func NewFileSet(files ...*FileBuilder) (*FileSet, error) {
+	s := &FileSet{}
+	if err := s.Add(files...); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+// FileSetFromFiles converts each of the given descriptors to a builder, using
+// FromFile, and then returns a set that contains them all.
+func FileSetFromFiles(fds ...*desc.FileDescriptor) (*FileSet, error) {
+	files := make([]*FileBuilder, len(fds))
+	for i, fd := range fds {
+		fb, err := FromFile(fd)
+		if err != nil {
+			return nil, err
+		}
+		files[i] = fb
+	}
+	return NewFileSet(files...)
+}
+
+// Files returns the files in this set, in the order they were added.
+func (s *FileSet) Files() []*FileBuilder {
+	return append([]*FileBuilder(nil), s.files...)
+}
+
+// Add adds the given files to this set. References between all files in the
+// set, including those already present, are re-linked so that they refer to
+// builders instead of descriptors. If an error is returned, the set and the
+// files are unchanged.
+func (s *FileSet) Add(files ...*FileBuilder) error {
+	byName := map[string]*FileBuilder{}
+	var all []*FileBuilder
+	for _, fb := range append(append([]*FileBuilder(nil), s.files...), files...) {
+		if ex, ok := byName[fb.GetName()]; ok {
+			if ex == fb {
+				continue
+			}
+			return fmt.Errorf("file set already contains a file named %q", fb.GetName())
+		}
+		byName[fb.GetName()] = fb
+		all = append(all, fb)
+	}
+	// verify everything can be linked before changing anything
+	for _, fb := range all {
+		if err := linkFile(fb, byName, false); err != nil {
+			return err
+		}
+	}
+	for _, fb := range all {
+		_ = linkFile(fb, byName, true)
+	}
+	s.files = all
+	return nil
+}
+
+// FindSymbol returns the builder for the element with the given
+// fully-qualified name, searching all files in the set. It returns nil if no
+// file in the set contains such an element.
+func (s *FileSet) FindSymbol(fqn string) Builder {
+	for _, fb := range s.files {
+		if b := fb.findFullyQualifiedElement(fqn); b != nil {
+			return b
+		}
+	}
+	return nil
+}
+
+// MoveMessage moves the given message so that it becomes a child of the given
+// parent, which must be a *FileBuilder or a *MessageBuilder. References to the
+// message, which are references to its builder, need no changes. But file
+// dependencies are updated: explicit dependencies on the message's old file
+// (by files in this set) and on files that only the moved message used (by
+// its old file) are removed if they are no longer needed. Explicit
+// dependencies of the old file that define custom options used by the moved
+// message (or its descendants) are copied to the new file.
+//
+// An error is returned if the move would create a name conflict, either in the
+// new parent or with an element in another file in the set, if a dependency
+// that defines custom options used by the message cannot be copied to the new
+// file because it depends on the new file (which would create a cycle), or if
+// the message is a map entry or group type, which cannot be moved
+// independently of its field. When an error is returned, nothing is changed.
+func (s *FileSet) MoveMessage(mb *MessageBuilder, newParent Builder) error {
+	if _, ok := mb.GetParent().(*FieldBuilder); ok {
+		return fmt.Errorf("cannot move message %s; it is the type of field %s", GetFullyQualifiedName(mb), GetFullyQualifiedName(mb.GetParent()))
+	}
+	return s.move(mb, newParent, func() error {
+		switch p := newParent.(type) {
+		case *FileBuilder:
+			return p.TryAddMessage(mb)
+		case *MessageBuilder:
+			return p.TryAddNestedMessage(mb)
+		default:
+			return fmt.Errorf("cannot move message %s to %T; parent must be a file or message", GetFullyQualifiedName(mb), newParent)
+		}
+	})
+}
+
+// MoveEnum moves the given enum so that it becomes a child of the given
+// parent, which must be a *FileBuilder or a *MessageBuilder. File
+// dependencies are updated in the same way as by MoveMessage.
+//
+// An error is returned if the move would create a name conflict, either in the
+// new parent or with an element in another file in the set.
+func (s *FileSet) MoveEnum(eb *EnumBuilder, newParent Builder) error {
+	return s.move(eb, newParent, func() error {
+		switch p := newParent.(type) {
+		case *FileBuilder:
+			return p.TryAddEnum(eb)
+		case *MessageBuilder:
+			return p.TryAddNestedEnum(eb)
+		default:
+			return fmt.Errorf("cannot move enum %s to %T; parent must be a file or message", GetFullyQualifiedName(eb), newParent)
+		}
+	})
+}
+
+func (s *FileSet) move(b, newParent Builder, add func() error) error {
+	if b.GetParent() == newParent {
+		// nothing to do
+		return nil
+	}
+	for p := newParent; p != nil; p = p.GetParent() {
+		if p == b {
+			return fmt.Errorf("cannot move %s into itself", GetFullyQualifiedName(b))
+		}
+	}
+	if newParent != nil {
+		newName := GetFullyQualifiedName(newParent)
+		if newName == "" {
+			newName = b.GetName()
+		} else {
+			newName += "." + b.GetName()
+		}
+		if err := s.checkConflict(newName, newParent.GetFile(), b); err != nil {
+			return err
+		}
+	}
+
+	oldFile := b.GetFile()
+	var newFile *FileBuilder
+	if newParent != nil {
+		newFile = newParent.GetFile()
+	}
+	optionDeps, err := optionDependencies(b, oldFile, newFile)
+	if err != nil {
+		return err
+	}
+	if err := add(); err != nil {
+		return err
+	}
+	s.updateDependencies(b, oldFile, b.GetFile(), optionDeps)
+	return nil
+}
+
+// optionDependencies returns the explicit dependencies of oldFile that define
+// custom options used by the given element, which must be added to newFile
+// when the element moves there. An error is returned if such a dependency
+// cannot be added because it depends on newFile (counting references to the
+// moved element as references to newFile), since that would create a cycle.
+func optionDependencies(moved Builder, oldFile, newFile *FileBuilder) ([]*FileBuilder, error) {
+	if oldFile == newFile || oldFile == nil || newFile == nil {
+		return nil, nil
+	}
+	used := newUsedOptions(moved)
+	var deps []*FileBuilder
+	for dep := range oldFile.explicitDeps {
+		if dep == newFile || !used.providedByBuilder(dep) {
+			continue
+		}
+		if _, ok := newFile.explicitDeps[dep]; ok {
+			continue
+		}
+		deps = append(deps, dep)
+	}
+	sort.Slice(deps, func(i, j int) bool {
+		return deps[i].GetName() < deps[j].GetName()
+	})
+	fileOf := func(b Builder) *FileBuilder {
+		for p := b; p != nil; p = p.GetParent() {
+			if p == moved {
+				return newFile
+			}
+		}
+		return b.GetFile()
+	}
+	for _, dep := range deps {
+		if dependsOn(dep, newFile, fileOf, map[*FileBuilder]struct{}{}) {
+			return nil, fmt.Errorf("cannot move %s to file %q: it uses custom options defined in file %q, which depends on file %q", GetFullyQualifiedName(moved), newFile.GetName(), dep.GetName(), newFile.GetName())
+		}
+	}
+	return deps, nil
+}
+
+// SetPackageName changes the package of the given file. References to elements
+// in the file, which are references to their builders, need no changes. An
+// error is returned if any element in the file would then conflict with an
+// element in another file in the set.
+func (s *FileSet) SetPackageName(fb *FileBuilder, pkg string) error {
+	if fb.Package == pkg {
+		return nil
+	}
+	for name := range fb.symbols {
+		fqn := name
+		if pkg != "" {
+			fqn = pkg + "." + name
+		}
+		if err := s.checkConflict(fqn, fb, nil); err != nil {
+			return err
+		}
+	}
+	fb.SetPackageName(pkg)
+	return nil
+}
+
+// checkConflict returns an error if an element with the given name exists in a
+// file other than exclude. If the existing element is self, which is the case
+// when an element moves to another file without changing its name, it is not a
+// conflict.
+func (s *FileSet) checkConflict(fqn string, exclude *FileBuilder, self Builder) error {
+	for _, fb := range s.files {
+		if fb == exclude {
+			// conflicts within this file are checked when adding symbols
+			continue
+		}
+		if ex := fb.findFullyQualifiedElement(fqn); ex != nil && ex != self {
+			return fmt.Errorf("file %q already contains element (%T) named %s", fb.GetName(), ex, fqn)
+		}
+	}
+	return nil
+}
+
+// updateDependencies fixes up the explicit dependencies of files in the set
+// after the given element moves from oldFile to newFile. The given option
+// dependencies, computed by optionDependencies before the move, are added to
+// newFile.
+func (s *FileSet) updateDependencies(moved Builder, oldFile, newFile *FileBuilder, optionDeps []*FileBuilder) {
+	if oldFile == newFile || oldFile == nil {
+		return
+	}
+	movedRefs := newFileRefs(moved)
+	oldRefs := newFileRefs(oldFile)
+
+	if newFile != nil {
+		// the moved element may have custom options that were interpretable
+		// thanks to the old file's dependencies; so make sure they are still
+		// interpretable in the new file
+		used := newUsedOptions(moved)
+		for fd := range oldFile.explicitImports {
+			if used.providedByDescriptor(fd) {
+				newFile.addExtensionsFromImport(fd)
+			}
+		}
+		for _, dep := range optionDeps {
+			newFile.AddDependency(dep)
+		}
+	}
+
+	// drop the old file's dependencies that only the moved element needed
+	for dep := range movedRefs.builders {
+		if _, ok := oldFile.explicitDeps[dep]; ok && !oldRefs.hasBuilder(dep) && !hasExtensions(dep) {
+			delete(oldFile.explicitDeps, dep)
+		}
+	}
+	for fd := range movedRefs.descs {
+		if _, ok := oldFile.explicitImports[fd]; ok && !oldRefs.hasDescriptor(fd) && !descHasExtensions(fd) {
+			delete(oldFile.explicitImports, fd)
+		}
+	}
+
+	// and drop dependencies on the old file that are no longer needed
+	if hasExtensions(oldFile) {
+		return
+	}
+	for _, fb := range s.files {
+		if _, ok := fb.explicitDeps[oldFile]; !ok || fb == oldFile {
+			continue
+		}
+		if !newFileRefs(fb).hasBuilder(oldFile) {
+			delete(fb.explicitDeps, oldFile)
+		}
+	}
+}
+
+// linkFile replaces references in the given file to descriptors with
+// references to builders, for descriptors that are defined in the given files.
+// If apply is false, the file is not changed, and the returned error indicates
+// if linking is possible.
+func linkFile(fb *FileBuilder, files map[string]*FileBuilder, apply bool) error {
+	findMessage := func(md *desc.MessageDescriptor) (*MessageBuilder, error) {
+		other, ok := files[md.GetFile().GetName()]
+		if !ok {
+			return nil, nil
+		}
+		mb, ok := other.findFullyQualifiedElement(md.GetFullyQualifiedName()).(*MessageBuilder)
+		if !ok {
+			return nil, fmt.Errorf("file %q refers to message %s, but it is not defined in file %q", fb.GetName(), md.GetFullyQualifiedName(), other.GetName())
+		}
+		return mb, nil
+	}
+	findEnum := func(ed *desc.EnumDescriptor) (*EnumBuilder, error) {
+		other, ok := files[ed.GetFile().GetName()]
+		if !ok {
+			return nil, nil
+		}
+		eb, ok := other.findFullyQualifiedElement(ed.GetFullyQualifiedName()).(*EnumBuilder)
+		if !ok {
+			return nil, fmt.Errorf("file %q refers to enum %s, but it is not defined in file %q", fb.GetName(), ed.GetFullyQualifiedName(), other.GetName())
+		}
+		return eb, nil
+	}
+
+	var err error
+	forEachFieldInFile(fb, func(flb *FieldBuilder) {
+		if err != nil {
+			return
+		}
+		if md := flb.fieldType.foreignMsgType; md != nil {
+			var mb *MessageBuilder
+			if mb, err = findMessage(md); mb != nil && apply {
+				flb.fieldType.foreignMsgType = nil
+				flb.fieldType.localMsgType = mb
+			}
+		}
+		if ed := flb.fieldType.foreignEnumType; ed != nil && err == nil {
+			var eb *EnumBuilder
+			if eb, err = findEnum(ed); eb != nil && apply {
+				flb.fieldType.foreignEnumType = nil
+				flb.fieldType.localEnumType = eb
+			}
+		}
+		if md := flb.foreignExtendee; md != nil && err == nil {
+			var mb *MessageBuilder
+			if mb, err = findMessage(md); mb != nil && apply {
+				flb.foreignExtendee = nil
+				flb.localExtendee = mb
+			}
+		}
+	})
+	if err != nil {
+		return err
+	}
+	for _, sb := range fb.services {
+		for _, mtb := range sb.methods {
+			for _, rt := range []*RpcType{mtb.ReqType, mtb.RespType} {
+				if rt.foreignType == nil {
+					continue
+				}
+				mb, err := findMessage(rt.foreignType)
+				if err != nil {
+					return err
+				}
+				if mb != nil && apply {
+					rt.foreignType = nil
+					rt.localType = mb
+				}
+			}
+		}
+	}
+
+	if apply {
+		for fd := range fb.explicitImports {
+			if other, ok := files[fd.GetName()]; ok {
+				delete(fb.explicitImports, fd)
+				if other != fb {
+					fb.AddDependency(other)
+				}
+			}
+		}
+	}
+	return nil
+}
+
+// fileRefs records the files that define the types referenced by a builder.
+type fileRefs struct {
+	builders map[*FileBuilder]struct{}
+	descs    map[*desc.FileDescriptor]struct{}
+}
+
+func newFileRefs(b Builder) *fileRefs {
+	return collectFileRefs(b, Builder.GetFile)
+}
+
+func collectFileRefs(b Builder, fileOf func(Builder) *FileBuilder) *fileRefs {
+	refs := &fileRefs{
+		builders: map[*FileBuilder]struct{}{},
+		descs:    map[*desc.FileDescriptor]struct{}{},
+	}
+	addMsg := func(md *desc.MessageDescriptor, mb *MessageBuilder) {
+		if md != nil {
+			refs.descs[md.GetFile()] = struct{}{}
+		} else if mb != nil {
+			if fb := fileOf(mb); fb != nil {
+				refs.builders[fb] = struct{}{}
+			}
+		}
+	}
+	visitField := func(flb *FieldBuilder) {
+		addMsg(flb.fieldType.foreignMsgType, flb.fieldType.localMsgType)
+		addMsg(flb.foreignExtendee, flb.localExtendee)
+		if ed := flb.fieldType.foreignEnumType; ed != nil {
+			refs.descs[ed.GetFile()] = struct{}{}
+		} else if eb := flb.fieldType.localEnumType; eb != nil {
+			if fb := fileOf(eb); fb != nil {
+				refs.builders[fb] = struct{}{}
+			}
+		}
+	}
+	switch b := b.(type) {
+	case *FileBuilder:
+		forEachFieldInFile(b, visitField)
+		for _, sb := range b.services {
+			for _, mtb := range sb.methods {
+				addMsg(mtb.ReqType.foreignType, mtb.ReqType.localType)
+				addMsg(mtb.RespType.foreignType, mtb.RespType.localType)
+			}
+		}
+	case *MessageBuilder:
+		forEachFieldInMessage(b, visitField)
+	}
+	return refs
+}
+
+func (r *fileRefs) hasBuilder(fb *FileBuilder) bool {
+	_, ok := r.builders[fb]
+	return ok
+}
+
+func (r *fileRefs) hasDescriptor(fd *desc.FileDescriptor) bool {
+	_, ok := r.descs[fd]
+	return ok
+}
+
+func forEachFieldInFile(fb *FileBuilder, fn func(*FieldBuilder)) {
+	for _, mb := range fb.messages {
+		forEachFieldInMessage(mb, fn)
+	}
+	for _, exb := range fb.extensions {
+		forEachField(exb, fn)
+	}
+}
+
+func forEachFieldInMessage(mb *MessageBuilder, fn func(*FieldBuilder)) {
+	for _, b := range mb.fieldsAndOneOfs {
+		if flb, ok := b.(*FieldBuilder); ok {
+			forEachField(flb, fn)
+		} else {
+			for _, flb := range b.(*OneOfBuilder).choices {
+				forEachField(flb, fn)
+			}
+		}
+	}
+	for _, nmb := range mb.nestedMessages {
+		forEachFieldInMessage(nmb, fn)
+	}
+	for _, exb := range mb.nestedExtensions {
+		forEachField(exb, fn)
+	}
+}
+
+func forEachField(flb *FieldBuilder, fn func(*FieldBuilder)) {
+	fn(flb)
+	if flb.msgType != nil {
+		forEachFieldInMessage(flb.msgType, fn)
+	}
+}
+
+// hasExtensions returns true if the given file defines any extensions. Such a
+// file may be needed as a dependency in order to interpret custom options.
+func hasExtensions(fb *FileBuilder) bool {
+	found := len(fb.extensions) > 0
+	forEachFieldInFile(fb, func(flb *FieldBuilder) {
+		found = found || flb.IsExtension()
+	})
+	return found
+}
+
+func descHasExtensions(fd *desc.FileDescriptor) bool {
+	if len(fd.GetExtensions()) > 0 {
+		return true
+	}
+	var msgHasExtensions func([]*desc.MessageDescriptor) bool
+	msgHasExtensions = func(mds []*desc.MessageDescriptor) bool {
+		for _, md := range mds {
+			if len(md.GetNestedExtensions()) > 0 || msgHasExtensions(md.GetNestedMessageTypes()) {
+				return true
+			}
+		}
+		return false
+	}
+	return msgHasExtensions(fd.GetMessageTypes())
+}
+
+// dependsOn returns true if fb depends on target, directly or transitively,
+// either via an explicit dependency or via a reference to one of its types. The
+// given function returns the file that contains a referenced type.
+func dependsOn(fb, target *FileBuilder, fileOf func(Builder) *FileBuilder, seen map[*FileBuilder]struct{}) bool {
+	if fb == target {
+		return true
+	}
+	if _, ok := seen[fb]; ok {
+		return false
+	}
+	seen[fb] = struct{}{}
+	for dep := range fb.explicitDeps {
+		if dependsOn(dep, target, fileOf, seen) {
+			return true
+		}
+	}
+	for dep := range collectFileRefs(fb, fileOf).builders {
+		if dependsOn(dep, target, fileOf, seen) {
+			return true
+		}
+	}
+	return false
+}
+
+// optionTag identifies a custom option by the options message it extends and
+// its tag number.
+type optionTag struct {
+	msgName string
+	tag     int32
+}
+
+// usedOptions records the custom options that are set on a builder and its
+// descendants.
+type usedOptions struct {
+	tags  map[optionTag]struct{}
+	names map[string]struct{}
+}
+
+func newUsedOptions(b Builder) *usedOptions {
+	used := &usedOptions{
+		tags:  map[optionTag]struct{}{},
+		names: map[string]struct{}{},
+	}
+	walkBuilders(b, func(b Builder) {
+		ob, ok := b.(optionsBuilder)
+		if !ok {
+			return
+		}
+		co := ob.getCustomOptions()
+		for name := range co.exts {
+			used.names[name] = struct{}{}
+		}
+		for name := range co.pending {
+			used.names[name] = struct{}{}
+		}
+		opts := ob.getOptions()
+		if isNilOptions(opts) {
+			return
+		}
+		msgName := optionsMessageName(ob)
+		ref := opts.ProtoReflect()
+		ref.Range(func(fd protoreflect.FieldDescriptor, _ protoreflect.Value) bool {
+			if fd.IsExtension() {
+				used.tags[optionTag{msgName: msgName, tag: int32(fd.Number())}] = struct{}{}
+			}
+			return true
+		})
+		for unk := ref.GetUnknown(); len(unk) > 0; {
+			num, _, n := protowire.ConsumeField(unk)
+			if n < 0 {
+				break
+			}
+			used.tags[optionTag{msgName: msgName, tag: int32(num)}] = struct{}{}
+			unk = unk[n:]
+		}
+	})
+	return used
+}
+
+func (u *usedOptions) isUsed(name, extendee string, tag int32) bool {
+	if _, ok := u.names[name]; ok {
+		return true
+	}
+	_, ok := u.tags[optionTag{msgName: extendee, tag: tag}]
+	return ok
+}
+
+// providedByBuilder returns true if the given file defines any of the used
+// custom options.
+func (u *usedOptions) providedByBuilder(fb *FileBuilder) bool {
+	found := false
+	forEachFieldInFile(fb, func(flb *FieldBuilder) {
+		found = found || (flb.IsExtension() && u.isUsed(GetFullyQualifiedName(flb), flb.GetExtendeeTypeName(), flb.GetNumber()))
+	})
+	return found
+}
+
+// providedByDescriptor returns true if the given file, or any of its public
+// imports, defines any of the used custom options.
+func (u *usedOptions) providedByDescriptor(fd *desc.FileDescriptor) bool {
+	isUsed := func(exts []*desc.FieldDescriptor) bool {
+		for _, extd := range exts {
+			if u.isUsed(extd.GetFullyQualifiedName(), extd.GetOwner().GetFullyQualifiedName(), extd.GetNumber()) {
+				return true
+			}
+		}
+		return false
+	}
+	var msgsUse func([]*desc.MessageDescriptor) bool
+	msgsUse = func(mds []*desc.MessageDescriptor) bool {
+		for _, md := range mds {
+			if isUsed(md.GetNestedExtensions()) || msgsUse(md.GetNestedMessageTypes()) {
+				return true
+			}
+		}
+		return false
+	}
+	if isUsed(fd.GetExtensions()) || msgsUse(fd.GetMessageTypes()) {
+		return true
+	}
+	for _, dep := range fd.GetPublicDependencies() {
+		if u.providedByDescriptor(dep) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,276 @@
+package builder
+
+import (
+	"strings"
+	"testing"
+
+	"google.golang.org/protobuf/types/descriptorpb"
+
+	"github.com/jhump/protoreflect/desc"
+	"github.com/jhump/protoreflect/internal/testutil"
+)
+
+func refactorTestFiles(t *testing.T) (a, b *desc.FileDescriptor) {
+	msg := NewMessage("Foo").
+		AddField(NewField("id", FieldTypeInt64()))
+	en := NewEnum("Kind").
+		AddValue(NewEnumValue("UNKNOWN")).
+		AddValue(NewEnumValue("OTHER"))
+	fa := NewFile("a.proto").SetPackageName("pkg.a").SetProto3(true).
+		AddMessage(msg).
+		AddEnum(en)
+	fb := NewFile("b.proto").SetPackageName("pkg.b").SetProto3(true).
+		AddMessage(NewMessage("Bar").
+			AddField(NewField("foo", FieldTypeMessage(msg))).
+			AddField(NewField("kind", FieldTypeEnum(en)))).
+		AddService(NewService("Svc").
+			AddMethod(NewMethod("Get", RpcTypeMessage(msg, false), RpcTypeMessage(msg, true))))
+	var err error
+	a, err = fa.Build()
+	testutil.Ok(t, err)
+	b, err = fb.Build()
+	testutil.Ok(t, err)
+	return a, b
+}
+
+func TestFileSet_LinksFiles(t *testing.T) {
+	a, b := refactorTestFiles(t)
+	s, err := FileSetFromFiles(a, b)
+	testutil.Ok(t, err)
+	files := s.Files()
+	testutil.Eq(t, 2, len(files))
+	fbA, fbB := files[0], files[1]
+
+	bar := fbB.GetMessage("Bar")
+	testutil.Require(t, bar.GetField("foo").GetType().localMsgType == fbA.GetMessage("Foo"))
+	testutil.Require(t, bar.GetField("kind").GetType().localEnumType == fbA.GetEnum("Kind"))
+	testutil.Require(t, fbB.GetService("Svc").GetMethod("Get").ReqType.localType == fbA.GetMessage("Foo"))
+	testutil.Eq(t, 0, len(fbB.explicitImports))
+	_, ok := fbB.explicitDeps[fbA]
+	testutil.Require(t, ok)
+
+	// a rename is now visible to the other file
+	fbA.GetMessage("Foo").SetName("Foo2")
+	fd, err := fbB.Build()
+	testutil.Ok(t, err)
+	testutil.Eq(t, ".pkg.a.Foo2", fd.FindMessage("pkg.b.Bar").FindFieldByName("foo").AsFieldDescriptorProto().GetTypeName())
+	testutil.Eq(t, "pkg.a.Foo2", fd.FindService("pkg.b.Svc").FindMethodByName("Get").GetOutputType().GetFullyQualifiedName())
+
+	// the set can find elements in any file
+	testutil.Require(t, s.FindSymbol("pkg.a.Foo2") == fbA.GetMessage("Foo2"))
+	testutil.Require(t, s.FindSymbol("pkg.b.Bar.kind") == bar.GetField("kind"))
+	testutil.Require(t, s.FindSymbol("pkg.a.Foo") == nil)
+
+	// duplicate file names are not allowed
+	err = s.Add(NewFile("a.proto"))
+	testutil.Require(t, err != nil && strings.Contains(err.Error(), `already contains a file named "a.proto"`), "unexpected error: %v", err)
+}
+
+func TestFileSet_LinkMissingElement(t *testing.T) {
+	a, b := refactorTestFiles(t)
+	fbA, err := FromFile(a)
+	testutil.Ok(t, err)
+	fbB, err := FromFile(b)
+	testutil.Ok(t, err)
+	fbA.RemoveMessage("Foo")
+	_, err = NewFileSet(fbA, fbB)
+	testutil.Require(t, err != nil && strings.Contains(err.Error(), `refers to message pkg.a.Foo, but it is not defined in file "a.proto"`), "unexpected error: %v", err)
+	// nothing was changed
+	testutil.Require(t, fbB.GetMessage("Bar").GetField("kind").GetType().foreignEnumType != nil)
+}
+
+func TestFileSet_MoveBetweenFiles(t *testing.T) {
+	a, b := refactorTestFiles(t)
+	s, err := FileSetFromFiles(a, b)
+	testutil.Ok(t, err)
+	fbA, fbB := s.Files()[0], s.Files()[1]
+	fbC := NewFile("c.proto").SetPackageName("pkg.c").SetProto3(true)
+	testutil.Ok(t, s.Add(fbC))
+
+	testutil.Ok(t, s.MoveMessage(fbA.GetMessage("Foo"), fbC))
+	fd, err := fbB.Build()
+	testutil.Ok(t, err)
+	testutil.Eq(t, ".pkg.c.Foo", fd.FindMessage("pkg.b.Bar").FindFieldByName("foo").AsFieldDescriptorProto().GetTypeName())
+	// still needs a.proto, for the enum
+	testutil.Eq(t, []string{"a.proto", "c.proto"}, fd.AsFileDescriptorProto().GetDependency())
+
+	testutil.Ok(t, s.MoveEnum(fbA.GetEnum("Kind"), fbC.GetMessage("Foo")))
+	fd, err = fbB.Build()
+	testutil.Ok(t, err)
+	testutil.Eq(t, ".pkg.c.Foo.Kind", fd.FindMessage("pkg.b.Bar").FindFieldByName("kind").AsFieldDescriptorProto().GetTypeName())
+	testutil.Eq(t, []string{"c.proto"}, fd.AsFileDescriptorProto().GetDependency())
+	_, ok := fbB.explicitDeps[fbA]
+	testutil.Require(t, !ok)
+
+	// moving to the same parent is a no-op
+	testutil.Ok(t, s.MoveMessage(fbC.GetMessage("Foo"), fbC))
+	// can't move into itself
+	foo := fbC.GetMessage("Foo")
+	err = s.MoveEnum(foo.GetNestedEnum("Kind"), foo.GetNestedEnum("Kind"))
+	testutil.Require(t, err != nil && strings.Contains(err.Error(), "into itself"), "unexpected error: %v", err)
+	nested := NewMessage("Nested")
+	foo.AddNestedMessage(nested)
+	err = s.MoveMessage(foo, nested)
+	testutil.Require(t, err != nil && strings.Contains(err.Error(), "into itself"), "unexpected error: %v", err)
+}
+
+func TestFileSet_MoveNesting(t *testing.T) {
+	a, b := refactorTestFiles(t)
+	s, err := FileSetFromFiles(a, b)
+	testutil.Ok(t, err)
+	fbA, fbB := s.Files()[0], s.Files()[1]
+
+	// into another message, in a different file
+	testutil.Ok(t, s.MoveMessage(fbA.GetMessage("Foo"), fbB.GetMessage("Bar")))
+	fd, err := fbB.Build()
+	testutil.Ok(t, err)
+	testutil.Eq(t, ".pkg.b.Bar.Foo", fd.FindMessage("pkg.b.Bar").FindFieldByName("foo").AsFieldDescriptorProto().GetTypeName())
+	testutil.Eq(t, "pkg.b.Bar.Foo", fd.FindService("pkg.b.Svc").FindMethodByName("Get").GetInputType().GetFullyQualifiedName())
+
+	// and back out to the top-level
+	testutil.Ok(t, s.MoveMessage(fbB.GetMessage("Bar").GetNestedMessage("Foo"), fbB))
+	fd, err = fbB.Build()
+	testutil.Ok(t, err)
+	testutil.Eq(t, ".pkg.b.Foo", fd.FindMessage("pkg.b.Bar").FindFieldByName("foo").AsFieldDescriptorProto().GetTypeName())
+
+	// map entries can't be moved on their own
+	bar := fbB.GetMessage("Bar")
+	bar.AddField(NewMapField("m", FieldTypeString(), FieldTypeString()))
+	err = s.MoveMessage(bar.GetField("m").GetType().localMsgType, fbB)
+	testutil.Require(t, err != nil && strings.Contains(err.Error(), "it is the type of field pkg.b.Bar.m"), "unexpected error: %v", err)
+}
+
+func TestFileSet_MoveCopiesOptionDependencies(t *testing.T) {
+	msgOpts, err := desc.LoadMessageDescriptorForMessage((*descriptorpb.MessageOptions)(nil))
+	testutil.Ok(t, err)
+	fbC := NewFile("c.proto").SetPackageName("pkg.c")
+	fbB := NewFile("b.proto").SetPackageName("pkg.b").
+		AddExtension(NewExtensionImported("opt", 20000, FieldTypeString(), msgOpts))
+	fbB.AddDependency(fbC)
+	fbA := NewFile("a.proto").SetPackageName("pkg.a").
+		AddMessage(NewMessage("Plain")).
+		AddMessage(NewMessage("Opted").SetOptionByName("pkg.b.opt", "abc"))
+	fbA.AddDependency(fbB)
+	fbD := NewFile("d.proto").SetPackageName("pkg.d")
+	s, err := NewFileSet(fbA, fbB, fbC, fbD)
+	testutil.Ok(t, err)
+
+	// the moved message uses no options from b.proto, so the dependency is
+	// not copied (which would also create a cycle, since b.proto imports
+	// c.proto)
+	testutil.Ok(t, s.MoveMessage(fbA.GetMessage("Plain"), fbC))
+	fd, err := fbC.Build()
+	testutil.Ok(t, err)
+	testutil.Eq(t, 0, len(fd.GetDependencies()))
+	_, err = fbB.Build()
+	testutil.Ok(t, err)
+
+	// but this one does use an option from b.proto
+	testutil.Ok(t, s.MoveMessage(fbA.GetMessage("Opted"), fbD))
+	fd, err = fbD.Build()
+	testutil.Ok(t, err)
+	testutil.Eq(t, []string{"b.proto"}, fd.AsFileDescriptorProto().GetDependency())
+
+	// when the file with the option depends on the new file, it can't be
+	// copied without creating a cycle; so the move fails
+	err = s.MoveMessage(fbD.GetMessage("Opted"), fbC)
+	testutil.Require(t, err != nil && strings.Contains(err.Error(), `uses custom options defined in file "b.proto", which depends on file "c.proto"`), "unexpected error: %v", err)
+	testutil.Require(t, fbD.GetMessage("Opted") != nil)
+	testutil.Require(t, fbC.GetMessage("Opted") == nil)
+	_, ok := fbC.explicitDeps[fbB]
+	testutil.Require(t, !ok)
+	_, err = fbB.Build()
+	testutil.Ok(t, err)
+}
+
+func TestFileSet_Conflicts(t *testing.T) {
+	a, b := refactorTestFiles(t)
+	s, err := FileSetFromFiles(a, b)
+	testutil.Ok(t, err)
+	fbA, fbB := s.Files()[0], s.Files()[1]
+	fbC := NewFile("c.proto").SetPackageName("pkg.b").AddMessage(NewMessage("Foo"))
+	testutil.Ok(t, s.Add(fbC))
+
+	// pkg.b.Foo already exists in c.proto
+	err = s.MoveMessage(fbA.GetMessage("Foo"), fbB)
+	testutil.Require(t, err != nil && strings.Contains(err.Error(), `file "c.proto" already contains element (*builder.MessageBuilder) named pkg.b.Foo`), "unexpected error: %v", err)
+	testutil.Require(t, fbA.GetMessage("Foo") != nil)
+
+	// conflicts within the same parent are reported, too
+	err = s.MoveMessage(fbA.GetMessage("Foo"), fbC)
+	testutil.Require(t, err != nil && strings.Contains(err.Error(), `file "c.proto" already contains element`), "unexpected error: %v", err)
+	testutil.Require(t, fbA.GetMessage("Foo") != nil)
+
+	// changing package name would also conflict
+	err = s.SetPackageName(fbA, "pkg.b")
+	testutil.Require(t, err != nil && strings.Contains(err.Error(), "named pkg.b.Foo"), "unexpected error: %v", err)
+	testutil.Eq(t, "pkg.a", fbA.Package)
+
+	testutil.Ok(t, s.SetPackageName(fbA, "pkg.z"))
+
+	// an element is not in conflict with itself when moved to another file
+	// in the same package
+	fbD := NewFile("d.proto").SetPackageName("pkg.z")
+	testutil.Ok(t, s.Add(fbD))
+	testutil.Ok(t, s.MoveMessage(fbA.GetMessage("Foo"), fbD))
+	testutil.Ok(t, s.MoveMessage(fbD.GetMessage("Foo"), fbA))
+
+	fd, err := fbB.Build()
+	testutil.Ok(t, err)
+	testutil.Eq(t, ".pkg.z.Foo", fd.FindMessage("pkg.b.Bar").FindFieldByName("foo").AsFieldDescriptorProto().GetTypeName())
+	testutil.Eq(t, ".pkg.z.Kind", fd.FindMessage("pkg.b.Bar").FindFieldByName("kind").AsFieldDescriptorProto().GetTypeName())
+}
+
+func TestExtractFields(t *testing.T) {
+	msg := NewMessage("Person").
+		AddField(NewField("name", FieldTypeString()).SetNumber(1)).
+		AddField(NewField("street", FieldTypeString()).SetNumber(2).SetComments(Comments{LeadingComment: " street"})).
+		AddField(NewField("city", FieldTypeString()).SetNumber(3)).
+		AddField(NewMapField("tags", FieldTypeString(), FieldTypeString()).SetNumber(4)).
+		AddOneOf(NewOneOf("contact").
+			AddChoice(NewField("email", FieldTypeString()).SetNumber(5)).
+			AddChoice(NewField("phone", FieldTypeString()).SetNumber(6)))
+	file := NewFile("foo.proto").SetPackageName("foo").SetProto3(true).AddMessage(msg)
+
+	_, err := msg.TryExtractFields("Address", "address", "street", "email")
+	testutil.Require(t, err != nil && strings.Contains(err.Error(), "without the rest of one-of contact"), "unexpected error: %v", err)
+	_, err = msg.TryExtractFields("Address", "address", "street", "zip")
+	testutil.Require(t, err != nil && strings.Contains(err.Error(), `has no field or one-of named "zip"`), "unexpected error: %v", err)
+	_, err = msg.TryExtractFields("Address", "name", "street")
+	testutil.Require(t, err != nil && strings.Contains(err.Error(), `already contains element (*builder.FieldBuilder) named "name"`), "unexpected error: %v", err)
+	_, err = msg.TryExtractFields("Address", "address", "street", "street")
+	testutil.Require(t, err != nil && strings.Contains(err.Error(), "named more than once"), "unexpected error: %v", err)
+	testutil.Eq(t, 5, len(msg.GetChildren()))
+
+	// the new field may re-use the name of an extracted field
+	address := msg.ExtractFields("Address", "street", "street", "city", "tags", "contact")
+	msg.GetField("street").SetNumber(10)
+	testutil.Require(t, msg.GetField("city") == nil)
+	testutil.Require(t, msg.GetOneOf("contact") == nil)
+	testutil.Require(t, address.GetOneOf("contact") != nil)
+
+	fd, err := file.Build()
+	testutil.Ok(t, err)
+	md := fd.FindMessage("foo.Person")
+	var names []string
+	for _, fld := range md.GetFields() {
+		names = append(names, fld.GetName())
+	}
+	testutil.Eq(t, []string{"name", "street"}, names)
+	testutil.Eq(t, int32(10), md.FindFieldByName("street").GetNumber())
+	testutil.Eq(t, "foo.Person.Address", md.FindFieldByName("street").GetMessageType().GetFullyQualifiedName())
+
+	amd := md.FindFieldByName("street").GetMessageType()
+	names = nil
+	var tags []int32
+	for _, fld := range amd.GetFields() {
+		names = append(names, fld.GetName())
+		tags = append(tags, fld.GetNumber())
+	}
+	testutil.Eq(t, []string{"street", "city", "tags", "email", "phone"}, names)
+	testutil.Eq(t, []int32{2, 3, 4, 5, 6}, tags)
+	testutil.Eq(t, " street", amd.FindFieldByName("street").GetSourceInfo().GetLeadingComments())
+	testutil.Require(t, amd.FindFieldByName("tags").IsMap())
+	testutil.Eq(t, "contact", amd.FindFieldByName("phone").GetOneOf().GetName())
+	testutil.Eq(t, descriptorpb.FieldDescriptorProto_TYPE_STRING, amd.FindFieldByName("tags").GetMapValueType().GetType())
+}
@@ -43,15 +43,25 @@ func (d *dependencies) add(fd *desc.FileDescriptor) {
 // file descriptor (or an error).
 type dependencyResolver struct {
 	resolvedRoots map[Builder]*desc.FileDescriptor
+	failedRoots   map[Builder]struct{}
 	seen          map[Builder]struct{}
 	opts          BuilderOptions
+	rep           *errorReporter
+	// options set by name that were resolved during this build, along with
+	// their extensions; the builders themselves are not modified
+	resolvedOpts map[Builder]proto.Message
+	resolvedExts map[Builder][]*desc.FieldDescriptor
 }
 
 func newResolver(opts BuilderOptions) *dependencyResolver {
 	return &dependencyResolver{
 		resolvedRoots: map[Builder]*desc.FileDescriptor{},
+		failedRoots:   map[Builder]struct{}{},
 		seen:          map[Builder]struct{}{},
 		opts:          opts,
+		rep:           &errorReporter{collect: opts.CollectAllErrors},
+		resolvedOpts:  map[Builder]proto.Message{},
+		resolvedExts:  map[Builder][]*desc.FieldDescriptor{},
 	}
 }
 
@@ -61,6 +71,10 @@ func (r *dependencyResolver) resolveElement(b Builder, seen []Builder) (*desc.Fi
 	if fd, ok := r.resolvedRoots[b]; ok {
 		return fd, nil
 	}
+	if _, ok := r.failedRoots[b]; ok {
+		// problems with this root were already reported
+		return nil, errReported
+	}
 
 	for _, s := range seen {
 		if s == b {
@@ -69,7 +83,11 @@ func (r *dependencyResolver) resolveElement(b Builder, seen []Builder) (*desc.Fi
 				names[i] = s.GetName()
 			}
 			names[len(seen)] = b.GetName()
-			return nil, fmt.Errorf("descriptors have cyclic dependency: %s", strings.Join(names, " ->  "))
+			err := fmt.Errorf("descriptors have cyclic dependency: %s", strings.Join(names, " ->  "))
+			if err := r.rep.report(b, CategoryDependency, err); err != nil {
+				return nil, err
+			}
+			return nil, errReported
 		}
 	}
 	seen = append(seen, b)
@@ -83,6 +101,9 @@ func (r *dependencyResolver) resolveElement(b Builder, seen []Builder) (*desc.Fi
 		fd, err = r.resolveSyntheticFile(b, seen)
 	}
 	if err != nil {
+		if err == errReported {
+			r.failedRoots[b] = struct{}{}
+		}
 		return nil, err
 	}
 	r.resolvedRoots[b] = fd
@@ -90,6 +111,10 @@ func (r *dependencyResolver) resolveElement(b Builder, seen []Builder) (*desc.Fi
 }
 
 func (r *dependencyResolver) resolveFile(fb *FileBuilder, root Builder, seen []Builder) (*desc.FileDescriptor, error) {
+	// if collecting errors, this tracks whether any were found while
+	// resolving this file
+	numErrs := r.rep.count()
+
 	deps := newDependencies()
 	// add explicit imports first
 	for fd := range fb.explicitImports {
@@ -101,7 +126,9 @@ func (r *dependencyResolver) resolveFile(fb *FileBuilder, root Builder, seen []B
 			continue
 		}
 		fd, err := r.resolveElement(dep, seen)
-		if err != nil {
+		if err == errReported {
+			continue
+		} else if err != nil {
 			return nil, err
 		}
 		deps.add(fd)
@@ -125,6 +152,9 @@ func (r *dependencyResolver) resolveFile(fb *FileBuilder, root Builder, seen []B
 
 	// finally, resolve custom options (which may refer to deps already
 	// computed above)
+	if err := r.resolvePendingOptions(deps, fb); err != nil {
+		return nil, err
+	}
 	if err := r.resolveTypesInFileOptions(root, deps, fb); err != nil {
 		return nil, err
 	}
@@ -134,17 +164,26 @@ func (r *dependencyResolver) resolveFile(fb *FileBuilder, root Builder, seen []B
 	for dep := range deps.descs {
 		isDuplicate, err := isDuplicateDependency(dep, depMap)
 		if err != nil {
-			return nil, err
+			if err := r.rep.report(root, CategoryDependency, err); err != nil {
+				return nil, err
+			}
 		}
 		if !isDuplicate {
 			depSlice = append(depSlice, dep)
 		}
 	}
 
-	fp, err := fb.buildProto(depSlice)
+	fp, err := fb.buildProto(depSlice, r.rep)
 	if err != nil {
 		return nil, err
 	}
+	r.setResolvedOptions(fb, fp)
+	if r.rep.collect {
+		checkFile(fb, depSlice, r.rep)
+		if r.rep.count() > numErrs {
+			return nil, errReported
+		}
+	}
 
 	// make sure this file name doesn't collide with any of its dependencies
 	fileNames := map[string]struct{}{}
@@ -157,7 +196,14 @@ func (r *dependencyResolver) resolveFile(fb *FileBuilder, root Builder, seen []B
 		fp.Name = proto.String(unique)
 	}
 
-	return desc.CreateFileDescriptor(fp, depSlice...)
+	fd, err := desc.CreateFileDescriptor(fp, depSlice...)
+	if err != nil {
+		if err := r.rep.report(root, CategoryOther, err); err != nil {
+			return nil, err
+		}
+		return nil, errReported
+	}
+	return fd, nil
 }
 
 // isDuplicateDependency checks for duplicate descriptors
@@ -325,7 +371,11 @@ func (r *dependencyResolver) resolveType(root Builder, seen []Builder, typeBuild
 		return nil
 	}
 	fd, err := r.resolveElement(otherRoot, seen)
-	if err != nil {
+	if err == errReported {
+		// keep going to find other problems; the error has been recorded,
+		// so the referring file will not be built
+		return nil
+	} else if err != nil {
 		return err
 	}
 	deps.add(fd)
@@ -344,43 +394,43 @@ func (r *dependencyResolver) resolveTypesInFileOptions(root Builder, deps *depen
 		}
 	}
 	for _, exb := range fb.extensions {
-		if err := r.resolveTypesInOptions(root, fb.origExts, deps, exb.Options); err != nil {
+		if err := r.resolveTypesInOptions(root, fb.origExts, deps, exb, exb.Options); err != nil {
 			return err
 		}
 	}
 	for _, sb := range fb.services {
 		for _, mtb := range sb.methods {
-			if err := r.resolveTypesInOptions(root, fb.origExts, deps, mtb.Options); err != nil {
+			if err := r.resolveTypesInOptions(root, fb.origExts, deps, mtb, mtb.Options); err != nil {
 				return err
 			}
 		}
-		if err := r.resolveTypesInOptions(root, fb.origExts, deps, sb.Options); err != nil {
+		if err := r.resolveTypesInOptions(root, fb.origExts, deps, sb, sb.Options); err != nil {
 			return err
 		}
 	}
-	return r.resolveTypesInOptions(root, fb.origExts, deps, fb.Options)
+	return r.resolveTypesInOptions(root, fb.origExts, deps, fb, fb.Options)
 }
 
 func (r *dependencyResolver) resolveTypesInMessageOptions(root Builder, fileExts *dynamic.ExtensionRegistry, deps *dependencies, mb *MessageBuilder) error {
 	for _, b := range mb.fieldsAndOneOfs {
 		if flb, ok := b.(*FieldBuilder); ok {
-			if err := r.resolveTypesInOptions(root, fileExts, deps, flb.Options); err != nil {
+			if err := r.resolveTypesInOptions(root, fileExts, deps, flb, flb.Options); err != nil {
 				return err
 			}
 		} else {
 			oob := b.(*OneOfBuilder)
 			for _, flb := range oob.choices {
-				if err := r.resolveTypesInOptions(root, fileExts, deps, flb.Options); err != nil {
+				if err := r.resolveTypesInOptions(root, fileExts, deps, flb, flb.Options); err != nil {
 					return err
 				}
 			}
-			if err := r.resolveTypesInOptions(root, fileExts, deps, oob.Options); err != nil {
+			if err := r.resolveTypesInOptions(root, fileExts, deps, oob, oob.Options); err != nil {
 				return err
 			}
 		}
 	}
 	for _, extr := range mb.ExtensionRanges {
-		if err := r.resolveTypesInOptions(root, fileExts, deps, extr.Options); err != nil {
+		if err := r.resolveTypesInOptions(root, fileExts, deps, mb, extr.Options); err != nil {
 			return err
 		}
 	}
@@ -395,11 +445,11 @@ func (r *dependencyResolver) resolveTypesInMessageOptions(root Builder, fileExts
 		}
 	}
 	for _, exb := range mb.nestedExtensions {
-		if err := r.resolveTypesInOptions(root, fileExts, deps, exb.Options); err != nil {
+		if err := r.resolveTypesInOptions(root, fileExts, deps, exb, exb.Options); err != nil {
 			return err
 		}
 	}
-	if err := r.resolveTypesInOptions(root, fileExts, deps, mb.Options); err != nil {
+	if err := r.resolveTypesInOptions(root, fileExts, deps, mb, mb.Options); err != nil {
 		return err
 	}
 	return nil
@@ -407,17 +457,18 @@ func (r *dependencyResolver) resolveTypesInMessageOptions(root Builder, fileExts
 
 func (r *dependencyResolver) resolveTypesInEnumOptions(root Builder, fileExts *dynamic.ExtensionRegistry, deps *dependencies, eb *EnumBuilder) error {
 	for _, evb := range eb.values {
-		if err := r.resolveTypesInOptions(root, fileExts, deps, evb.Options); err != nil {
+		if err := r.resolveTypesInOptions(root, fileExts, deps, evb, evb.Options); err != nil {
 			return err
 		}
 	}
-	if err := r.resolveTypesInOptions(root, fileExts, deps, eb.Options); err != nil {
+	if err := r.resolveTypesInOptions(root, fileExts, deps, eb, eb.Options); err != nil {
 		return err
 	}
 	return nil
 }
 
-func (r *dependencyResolver) resolveTypesInOptions(root Builder, fileExts *dynamic.ExtensionRegistry, deps *dependencies, opts proto.Message) error {
+func (r *dependencyResolver) resolveTypesInOptions(root Builder, fileExts *dynamic.ExtensionRegistry, deps *dependencies, b Builder, opts proto.Message) error {
+	opts = r.optionsFor(b, opts)
 	// nothing to see if opts is nil
 	if opts == nil {
 		return nil
@@ -475,6 +526,15 @@ func (r *dependencyResolver) resolveTypesInOptions(root Builder, fileExts *dynam
 			// yep! nothing else to do
 			continue
 		}
+		// see if this option was set using an extension descriptor
+		if extd := findRecordedOptionExtension(b, msgName, tag); extd != nil {
+			deps.add(extd.GetFile())
+			continue
+		}
+		if extd := r.findResolvedOptionExtension(b, msgName, tag); extd != nil {
+			deps.add(extd.GetFile())
+			continue
+		}
 		// see if this extension is defined in *this* builder
 		if findExtension(root, msgName, tag) {
 			// yep!
@@ -500,7 +560,10 @@ func (r *dependencyResolver) resolveTypesInOptions(root Builder, fileExts *dynam
 			// known extension? add its file to builder's deps
 			fd, err := desc.WrapFile(xt.TypeDescriptor().ParentFile())
 			if err != nil {
-				return err
+				if err := r.rep.report(b, CategoryOther, err); err != nil {
+					return err
+				}
+				continue
 			}
 			deps.add(fd)
 			continue
@@ -508,7 +571,10 @@ func (r *dependencyResolver) resolveTypesInOptions(root Builder, fileExts *dynam
 
 		if r.opts.RequireInterpretedOptions {
 			// we require options to be interpreted but are not able to!
-			return fmt.Errorf("could not interpret custom option for %s, tag %d", msgName, tag)
+			err := fmt.Errorf("could not interpret custom option for %s, tag %d", msgName, tag)
+			if err := r.rep.report(b, CategoryUninterpretableOption, err); err != nil {
+				return err
+			}
 		}
 	}
 	return nil
@@ -188,8 +188,106 @@ func (sb *ServiceBuilder) SetOptions(options *descriptorpb.ServiceOptions) *Serv
 	return sb
 }
 
-func (sb *ServiceBuilder) buildProto(path []int32, sourceInfo *descriptorpb.SourceCodeInfo) (*descriptorpb.ServiceDescriptorProto, error) {
-	addCommentsTo(sourceInfo, path, &sb.comments)
+// SetFeatures sets the feature overrides in the options for this service and
+// returns the service, for method chaining.
+func (sb *ServiceBuilder) SetFeatures(features *descriptorpb.FeatureSet) *ServiceBuilder {
+	var options *descriptorpb.ServiceOptions
+	if sb.Options != nil {
+		options = proto.Clone(sb.Options).(*descriptorpb.ServiceOptions)
+	} else {
+		options = &descriptorpb.ServiceOptions{}
+	}
+	options.Features = features
+	sb.Options = options
+	return sb
+}
+
+// SetOption sets the custom option described by the given extension to the
+// given value and returns the service, for method chaining. The value may be any
+// value accepted by dynamic.Message.TrySetField for the extension, such as a Go
+// scalar or, for message types, a *dynamic.Message. If the value is not valid,
+// this method panics. The existing options, if any, are copied so the change
+// is not visible to other builders or descriptors that share them. When the
+// service is built, the file that defines the extension is added as a
+// dependency.
+func (sb *ServiceBuilder) SetOption(extd *desc.FieldDescriptor, val interface{}) *ServiceBuilder {
+	if err := sb.TrySetOption(extd, val); err != nil {
+		panic(err)
+	}
+	return sb
+}
+
+// TrySetOption sets the custom option described by the given extension to the
+// given value, returning an error if the extension does not extend
+// ServiceOptions or if the value is not valid for it.
+func (sb *ServiceBuilder) TrySetOption(extd *desc.FieldDescriptor, val interface{}) error {
+	return setOption(sb, extd, val)
+}
+
+// SetOptionByName sets the custom option with the given fully-qualified name
+// to the given value and returns the service, for method chaining. If an error
+// prevents the option from being set, this method panics.
+//
+// See TrySetOptionByName for how the option's extension is found.
+func (sb *ServiceBuilder) SetOptionByName(name string, val interface{}) *ServiceBuilder {
+	if err := sb.TrySetOptionByName(name, val); err != nil {
+		panic(err)
+	}
+	return sb
+}
+
+// TrySetOptionByName sets the custom option with the given fully-qualified name
+// to the given value, returning any error that prevents the option from being
+// set. The extension for the option is found among options already set on
+// this service, the explicit imports of its file, the dependencies of the file
+// from which it was created (if created with FromFile), and extensions linked
+// into the current program. If the extension cannot be found, the value is
+// retained and the option is set when the service is built, at which point the
+// extension may also be found in BuilderOptions.Extensions or in any other
+// file on which the service's file depends. An error is reported then if the
+// extension still cannot be found or the value is not valid for it.
+func (sb *ServiceBuilder) TrySetOptionByName(name string, val interface{}) error {
+	return setOptionByName(sb, name, val)
+}
+
+// GetOption returns the value of the custom option described by the given
+// extension. If the option is not set, nil is returned. Values for message
+// types are returned as *dynamic.Message.
+func (sb *ServiceBuilder) GetOption(extd *desc.FieldDescriptor) (interface{}, error) {
+	return getOption(sb, extd)
+}
+
+// GetOptionByName returns the value of the custom option with the given
+// fully-qualified name. If the option is not set, nil is returned. An error is
+// returned if the option's extension cannot be found.
+func (sb *ServiceBuilder) GetOptionByName(name string) (interface{}, error) {
+	return getOptionByName(sb, name)
+}
+
+// ClearOption removes the custom option described by the given extension and
+// returns the service, for method chaining.
+func (sb *ServiceBuilder) ClearOption(extd *desc.FieldDescriptor) *ServiceBuilder {
+	clearOption(sb, extd)
+	return sb
+}
+
+// ClearOptionByName removes the custom option with the given fully-qualified
+// name and returns the service, for method chaining.
+func (sb *ServiceBuilder) ClearOptionByName(name string) *ServiceBuilder {
+	clearOptionByName(sb, name)
+	return sb
+}
+
+func (sb *ServiceBuilder) getOptions() proto.Message {
+	return sb.Options
+}
+
+func (sb *ServiceBuilder) setOptions(opts proto.Message) {
+	sb.Options = opts.(*descriptorpb.ServiceOptions)
+}
+
+func (sb *ServiceBuilder) buildProto(path []int32, sourceInfo *sourceInfoBuilder, rep *errorReporter) (*descriptorpb.ServiceDescriptorProto, error) {
+	sourceInfo.addElement(path, &sb.comments, sb.lossless)
 
 	methods := make([]*descriptorpb.MethodDescriptorProto, 0, len(sb.methods))
 	for _, mtb := range sb.methods {
@@ -334,6 +432,104 @@ func (mtb *MethodBuilder) SetOptions(options *descriptorpb.MethodOptions) *Metho
 	return mtb
 }
 
+// SetFeatures sets the feature overrides in the options for this method and
+// returns the method, for method chaining.
+func (mtb *MethodBuilder) SetFeatures(features *descriptorpb.FeatureSet) *MethodBuilder {
+	var options *descriptorpb.MethodOptions
+	if mtb.Options != nil {
+		options = proto.Clone(mtb.Options).(*descriptorpb.MethodOptions)
+	} else {
+		options = &descriptorpb.MethodOptions{}
+	}
+	options.Features = features
+	mtb.Options = options
+	return mtb
+}
+
+// SetOption sets the custom option described by the given extension to the
+// given value and returns the method, for method chaining. The value may be any
+// value accepted by dynamic.Message.TrySetField for the extension, such as a Go
+// scalar or, for message types, a *dynamic.Message. If the value is not valid,
+// this method panics. The existing options, if any, are copied so the change
+// is not visible to other builders or descriptors that share them. When the
+// method is built, the file that defines the extension is added as a
+// dependency.
+func (mtb *MethodBuilder) SetOption(extd *desc.FieldDescriptor, val interface{}) *MethodBuilder {
+	if err := mtb.TrySetOption(extd, val); err != nil {
+		panic(err)
+	}
+	return mtb
+}
+
+// TrySetOption sets the custom option described by the given extension to the
+// given value, returning an error if the extension does not extend
+// MethodOptions or if the value is not valid for it.
+func (mtb *MethodBuilder) TrySetOption(extd *desc.FieldDescriptor, val interface{}) error {
+	return setOption(mtb, extd, val)
+}
+
+// SetOptionByName sets the custom option with the given fully-qualified name
+// to the given value and returns the method, for method chaining. If an error
+// prevents the option from being set, this method panics.
+//
+// See TrySetOptionByName for how the option's extension is found.
+func (mtb *MethodBuilder) SetOptionByName(name string, val interface{}) *MethodBuilder {
+	if err := mtb.TrySetOptionByName(name, val); err != nil {
+		panic(err)
+	}
+	return mtb
+}
+
+// TrySetOptionByName sets the custom option with the given fully-qualified name
+// to the given value, returning any error that prevents the option from being
+// set. The extension for the option is found among options already set on
+// this method, the explicit imports of its file, the dependencies of the file
+// from which it was created (if created with FromFile), and extensions linked
+// into the current program. If the extension cannot be found, the value is
+// retained and the option is set when the method is built, at which point the
+// extension may also be found in BuilderOptions.Extensions or in any other
+// file on which the method's file depends. An error is reported then if the
+// extension still cannot be found or the value is not valid for it.
+func (mtb *MethodBuilder) TrySetOptionByName(name string, val interface{}) error {
+	return setOptionByName(mtb, name, val)
+}
+
+// GetOption returns the value of the custom option described by the given
+// extension. If the option is not set, nil is returned. Values for message
+// types are returned as *dynamic.Message.
+func (mtb *MethodBuilder) GetOption(extd *desc.FieldDescriptor) (interface{}, error) {
+	return getOption(mtb, extd)
+}
+
+// GetOptionByName returns the value of the custom option with the given
+// fully-qualified name. If the option is not set, nil is returned. An error is
+// returned if the option's extension cannot be found.
+func (mtb *MethodBuilder) GetOptionByName(name string) (interface{}, error) {
+	return getOptionByName(mtb, name)
+}
+
+// ClearOption removes the custom option described by the given extension and
+// returns the method, for method chaining.
+func (mtb *MethodBuilder) ClearOption(extd *desc.FieldDescriptor) *MethodBuilder {
+	clearOption(mtb, extd)
+	return mtb
+}
+
+// ClearOptionByName removes the custom option with the given fully-qualified
+// name and returns the method, for method chaining.
+func (mtb *MethodBuilder) ClearOptionByName(name string) *MethodBuilder {
+	clearOptionByName(mtb, name)
+	return mtb
+}
+
+func (mtb *MethodBuilder) getOptions() proto.Message {
+	return mtb.Options
+}
+
+func (mtb *MethodBuilder) setOptions(opts proto.Message) {
+	mtb.Options = opts.(*descriptorpb.MethodOptions)
+}
+
 // SetRequestType changes the request type for the method and then returns the
 // method builder, for method chaining.
 func (mtb *MethodBuilder) SetRequestType(t *RpcType) *MethodBuilder {
@@ -348,8 +544,8 @@ func (mtb *MethodBuilder) SetResponseType(t *RpcType) *MethodBuilder {
 	return mtb
 }
 
-func (mtb *MethodBuilder) buildProto(path []int32, sourceInfo *descriptorpb.SourceCodeInfo) (*descriptorpb.MethodDescriptorProto, error) {
-	addCommentsTo(sourceInfo, path, &mtb.comments)
+func (mtb *MethodBuilder) buildProto(path []int32, sourceInfo *sourceInfoBuilder) (*descriptorpb.MethodDescriptorProto, error) {
+	sourceInfo.addElement(path, &mtb.comments, mtb.lossless)
 
 	mtd := &descriptorpb.MethodDescriptorProto{
 		Name:       proto.String(mtb.name),
@@ -0,0 +1,286 @@
+package builder
+
+import (
+	"fmt"
+	"hash/fnv"
+	"sort"
+
+	"github.com/jhump/protoreflect/desc/internal"
+)
+
+// TagStrategy determines how tag numbers are chosen for fields that do not
+// have one. A strategy can be used explicitly, via MessageBuilder.AllocateTag
+// and MessageBuilder.AddFieldWithStrategy, or it can be set as a message's
+// TagStrategy, in which case it is used to assign tags to any fields that
+// still have none when the message is built.
+//
+// No matter the strategy, the chosen tag is never one that is already used by
+// another field, in one of the message's reserved or extension ranges, or in
+// the special reserved range 19000-19999.
+type TagStrategy int
+
+const (
+	// TagStrategyNextAvailable chooses the smallest available tag. This is
+	// the default strategy.
+	TagStrategyNextAvailable TagStrategy = iota
+	// TagStrategyFrequent chooses the smallest available tag in the range
+	// 1-15, falling back to the smallest available tag overall. Tags in this
+	// range are encoded in a single byte, so they are best used for fields
+	// that are frequently present.
+	TagStrategyFrequent
+	// TagStrategyInfrequent chooses the smallest available tag that is 16 or
+	// greater, leaving the range 1-15 for fields that are frequently present.
+	TagStrategyInfrequent
+	// TagStrategyHashName chooses a tag derived from a hash of the field's
+	// name. This results in stable tags, regardless of the order in which
+	// fields are added, which is useful when generating messages from other
+	// schemas. Derived tags are in the range 16-2047, so they are encoded in
+	// two bytes (like those chosen by TagStrategyInfrequent) and leave the
+	// range 1-15 for fields that are frequently present. If the derived tag is
+	// not available, the next available tag after it in that range is chosen,
+	// wrapping around to the start of the range; so it is only stable as long
+	// as no other field collides with it. Only if the whole range is in use is
+	// a tag outside of it chosen.
+	TagStrategyHashName
+)
+
+// String returns a short, human-readable name for the strategy.
+func (s TagStrategy) String() string {
+	switch s {
+	case TagStrategyNextAvailable:
+		return "next available"
+	case TagStrategyFrequent:
+		return "frequent"
+	case TagStrategyInfrequent:
+		return "infrequent"
+	case TagStrategyHashName:
+		return "hash name"
+	default:
+		return fmt.Sprintf("TagStrategy(%d)", int(s))
+	}
+}
+
+// TagRange is a range of tag numbers. The range is inclusive of both the start
+// and end.
+type TagRange struct {
+	Start, End int32
+}
+
+// SetTagStrategy sets the strategy used to assign tags to fields that have none
+// when this message is built. This returns the message, for method chaining.
+func (mb *MessageBuilder) SetTagStrategy(strategy TagStrategy) *MessageBuilder {
+	mb.TagStrategy = strategy
+	return mb
+}
+
+// IsTagAvailable returns true if the given tag could be used by a new field in
+// this message. A tag is unavailable if it is already used by another field,
+// if it is in one of the message's reserved or extension ranges, or if it is
+// otherwise invalid (such as being in the special reserved range 19000-19999).
+func (mb *MessageBuilder) IsTagAvailable(tag int32) bool {
+	return mb.newTagAllocator().isAvailable(tag)
+}
+
+// UsedTags returns the tags used by this message's fields, in increasing order.
+// Fields that do not yet have a tag are not included.
+func (mb *MessageBuilder) UsedTags() []int32 {
+	tags := make([]int32, 0, len(mb.fieldTags))
+	for tag := range mb.fieldTags {
+		tags = append(tags, tag)
+	}
+	sort.Slice(tags, func(i, j int) bool {
+		return tags[i] < tags[j]
+	})
+	return tags
+}
+
+// AvailableTagRanges returns the ranges of tags that could be used by new
+// fields in this message, in increasing order.
+func (mb *MessageBuilder) AvailableTagRanges() []TagRange {
+	// collect all unavailable ranges (inclusive) and then return the gaps
+	// between them
+	type span struct{ start, end int64 }
+	blocked := []span{{internal.SpecialReservedStart, internal.SpecialReservedEnd}}
+	for _, rr := range mb.ReservedRanges {
+		blocked = append(blocked, span{int64(rr.GetStart()), int64(rr.GetEnd()) - 1})
+	}
+	for _, er := range mb.ExtensionRanges {
+		blocked = append(blocked, span{int64(er.GetStart()), int64(er.GetEnd()) - 1})
+	}
+	for tag := range mb.fieldTags {
+		blocked = append(blocked, span{int64(tag), int64(tag)})
+	}
+	sort.Slice(blocked, func(i, j int) bool {
+		return blocked[i].start < blocked[j].start
+	})
+
+	max := int64(internal.GetMaxTag(mb.Options.GetMessageSetWireFormat()))
+	var ranges []TagRange
+	next := int64(1)
+	for _, b := range blocked {
+		if b.start > next && next <= max {
+			end := b.start - 1
+			if end > max {
+				end = max
+			}
+			ranges = append(ranges, TagRange{Start: int32(next), End: int32(end)})
+		}
+		if b.end+1 > next {
+			next = b.end + 1
+		}
+	}
+	if next <= max {
+		ranges = append(ranges, TagRange{Start: int32(next), End: int32(max)})
+	}
+	return ranges
+}
+
+// AllocateTag returns a tag, chosen using the given strategy, for a new field
+// with the given name. The tag is not reserved, so calling this method again
+// returns the same tag unless a field that uses it is added first. An error is
+// returned if no tags are available.
+func (mb *MessageBuilder) AllocateTag(fieldName string, strategy TagStrategy) (int32, error) {
+	return mb.newTagAllocator().allocate(fieldName, strategy)
+}
+
+// AddFieldWithStrategy sets the tag of the given field, using the given
+// strategy, and then adds it to this message. If an error prevents the field
+// from being added, this method panics. This returns the message builder, for
+// method chaining.
+func (mb *MessageBuilder) AddFieldWithStrategy(flb *FieldBuilder, strategy TagStrategy) *MessageBuilder {
+	if err := mb.TryAddFieldWithStrategy(flb, strategy); err != nil {
+		panic(err)
+	}
+	return mb
+}
+
+// TryAddFieldWithStrategy sets the tag of the given field, using the given
+// strategy, and then adds it to this message, returning any error that prevents
+// the field from being added. If an error is returned, the field's tag is left
+// unchanged.
+func (mb *MessageBuilder) TryAddFieldWithStrategy(flb *FieldBuilder, strategy TagStrategy) error {
+	if flb.IsExtension() {
+		return fmt.Errorf("field %s is an extension, not a regular field", flb.GetName())
+	}
+	tag, err := mb.AllocateTag(flb.GetName(), strategy)
+	if err != nil {
+		return err
+	}
+	oldTag := flb.number
+	if err := flb.TrySetNumber(tag); err != nil {
+		return err
+	}
+	if err := mb.TryAddField(flb); err != nil {
+		// restore the old tag (which also updates the field's current parent)
+		_ = flb.TrySetNumber(oldTag)
+		return err
+	}
+	return nil
+}
+
+// tagAllocator chooses tags for fields in a message.
+type tagAllocator struct {
+	mb   *MessageBuilder
+	used map[int32]struct{}
+	max  int32
+}
+
+func (mb *MessageBuilder) newTagAllocator() *tagAllocator {
+	used := make(map[int32]struct{}, len(mb.fieldTags))
+	for tag := range mb.fieldTags {
+		used[tag] = struct{}{}
+	}
+	return &tagAllocator{
+		mb:   mb,
+		used: used,
+		max:  internal.GetMaxTag(mb.Options.GetMessageSetWireFormat()),
+	}
+}
+
+func (a *tagAllocator) isAvailable(tag int32) bool {
+	if tag < 1 || tag > a.max {
+		return false
+	}
+	_, ok := a.skip(tag)
+	return !ok
+}
+
+// skip returns true if the given tag is not available. In that case, it also
+// returns the next tag that might be available.
+func (a *tagAllocator) skip(tag int32) (int32, bool) {
+	if tag >= internal.SpecialReservedStart && tag <= internal.SpecialReservedEnd {
+		return internal.SpecialReservedEnd + 1, true
+	}
+	for _, rr := range a.mb.ReservedRanges {
+		if tag >= rr.GetStart() && tag < rr.GetEnd() {
+			return rr.GetEnd(), true
+		}
+	}
+	for _, er := range a.mb.ExtensionRanges {
+		if tag >= er.GetStart() && tag < er.GetEnd() {
+			return er.GetEnd(), true
+		}
+	}
+	if _, ok := a.used[tag]; ok {
+		return tag + 1, true
+	}
+	return 0, false
+}
+
+// The range of tags derived by TagStrategyHashName. Tags in this range are
+// encoded in two bytes.
+const (
+	hashTagStart = 16
+	hashTagEnd   = 2047
+)
+
+// next returns the first available tag that is greater than or equal to the
+// given tag and less than or equal to the given limit.
+func (a *tagAllocator) next(tag, limit int32) (int32, bool) {
+	if limit > a.max {
+		limit = a.max
+	}
+	for tag > 0 && tag <= limit {
+		next, ok := a.skip(tag)
+		if !ok {
+			return tag, true
+		}
+		tag = next
+	}
+	return 0, false
+}
+
+func (a *tagAllocator) allocate(name string, strategy TagStrategy) (int32, error) {
+	var tag int32
+	var ok bool
+	switch strategy {
+	case TagStrategyNextAvailable:
+		tag, ok = a.next(1, a.max)
+	case TagStrategyFrequent:
+		if tag, ok = a.next(1, 15); !ok {
+			tag, ok = a.next(16, a.max)
+		}
+	case TagStrategyInfrequent:
+		tag, ok = a.next(16, a.max)
+	case TagStrategyHashName:
+		h := fnv.New32a()
+		_, _ = h.Write([]byte(name))
+		start := hashTagStart + int32(h.Sum32()%uint32(hashTagEnd-hashTagStart+1))
+		if tag, ok = a.next(start, hashTagEnd); !ok {
+			// wrap around
+			if tag, ok = a.next(hashTagStart, start-1); !ok {
+				// range is full; fall back to any available tag
+				if tag, ok = a.next(hashTagEnd+1, a.max); !ok {
+					tag, ok = a.next(1, hashTagStart-1)
+				}
+			}
+		}
+	default:
+		return 0, fmt.Errorf("unknown tag strategy: %v", strategy)
+	}
+	if !ok {
+		return 0, fmt.Errorf("message %s has no available tags for field %s", GetFullyQualifiedName(a.mb), name)
+	}
+	a.used[tag] = struct{}{}
+	return tag, nil
+}
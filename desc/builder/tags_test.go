@@ -0,0 +1,134 @@
+package builder
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/jhump/protoreflect/desc/internal"
+	"github.com/jhump/protoreflect/internal/testutil"
+)
+
+func TestTagQueries(t *testing.T) {
+	msg := NewMessage("Foo").
+		AddField(NewField("a", FieldTypeString()).SetNumber(1)).
+		AddField(NewField("b", FieldTypeString()).SetNumber(2)).
+		AddField(NewField("c", FieldTypeString())).
+		AddOneOf(NewOneOf("o").AddChoice(NewField("d", FieldTypeString()).SetNumber(5))).
+		AddReservedRange(10, 20).
+		AddExtensionRange(100, 199)
+
+	testutil.Eq(t, []int32{1, 2, 5}, msg.UsedTags())
+	for _, tag := range []int32{0, -1, 1, 5, 10, 20, 150, 19000, 19999, internal.MaxNormalTag + 1} {
+		testutil.Require(t, !msg.IsTagAvailable(tag), "tag %d should not be available", tag)
+	}
+	for _, tag := range []int32{3, 4, 6, 9, 21, 99, 200, 18999, 20000, internal.MaxNormalTag} {
+		testutil.Require(t, msg.IsTagAvailable(tag), "tag %d should be available", tag)
+	}
+	testutil.Eq(t, []TagRange{
+		{3, 4}, {6, 9}, {21, 99}, {200, 18999}, {20000, internal.MaxNormalTag},
+	}, msg.AvailableTagRanges())
+}
+
+func TestAllocateTag(t *testing.T) {
+	msg := NewMessage("Foo").
+		AddField(NewField("a", FieldTypeString()).SetNumber(1)).
+		AddField(NewField("b", FieldTypeString()).SetNumber(16)).
+		AddReservedRange(2, 4).
+		AddReservedRange(17, 20)
+
+	testCases := []struct {
+		strategy TagStrategy
+		expected int32
+	}{
+		{TagStrategyNextAvailable, 5},
+		{TagStrategyFrequent, 5},
+		{TagStrategyInfrequent, 21},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.strategy.String(), func(t *testing.T) {
+			tag, err := msg.AllocateTag("x", tc.strategy)
+			testutil.Ok(t, err)
+			testutil.Eq(t, tc.expected, tag)
+		})
+	}
+
+	// once 1-15 are used, frequent falls back to the next available
+	for i := int32(5); i <= 15; i++ {
+		msg.AddFieldWithStrategy(NewField(fmt.Sprintf("f%d", i), FieldTypeString()), TagStrategyFrequent)
+		testutil.Eq(t, i, msg.GetField(fmt.Sprintf("f%d", i)).GetNumber())
+	}
+	tag, err := msg.AllocateTag("x", TagStrategyFrequent)
+	testutil.Ok(t, err)
+	testutil.Eq(t, int32(21), tag)
+
+	_, err = msg.AllocateTag("x", TagStrategy(99))
+	testutil.Require(t, err != nil && strings.Contains(err.Error(), "unknown tag strategy"))
+
+	// a field that cannot be added keeps its old tag
+	flb := NewField("a", FieldTypeString()).SetNumber(3000)
+	err = msg.TryAddFieldWithStrategy(flb, TagStrategyNextAvailable)
+	testutil.Require(t, err != nil && strings.Contains(err.Error(), "already contains element"))
+	testutil.Eq(t, int32(3000), flb.GetNumber())
+}
+
+func TestAllocateTag_HashName(t *testing.T) {
+	names := []string{"alpha", "beta", "gamma", "delta"}
+	msg1 := NewMessage("Foo")
+	for _, name := range names {
+		msg1.AddFieldWithStrategy(NewField(name, FieldTypeString()), TagStrategyHashName)
+	}
+	msg2 := NewMessage("Foo")
+	for i := len(names) - 1; i >= 0; i-- {
+		msg2.AddFieldWithStrategy(NewField(names[i], FieldTypeString()), TagStrategyHashName)
+	}
+	for _, name := range names {
+		tag := msg1.GetField(name).GetNumber()
+		testutil.Eq(t, tag, msg2.GetField(name).GetNumber(), "tag for %s should not depend on order", name)
+		testutil.Require(t, tag >= 16 && tag <= 2047, "tag for %s should be in hashed range: %d", name, tag)
+	}
+
+	// a collision picks the next available tag
+	msg3 := NewMessage("Foo")
+	tag, err := msg3.AllocateTag("alpha", TagStrategyHashName)
+	testutil.Ok(t, err)
+	testutil.Eq(t, msg1.GetField("alpha").GetNumber(), tag)
+	msg3.AddField(NewField("other", FieldTypeString()).SetNumber(tag))
+	tag2, err := msg3.AllocateTag("alpha", TagStrategyHashName)
+	testutil.Ok(t, err)
+	testutil.Require(t, tag2 != tag)
+	testutil.Require(t, msg3.IsTagAvailable(tag2))
+	testutil.Require(t, tag2 >= 16 && tag2 <= 2047)
+
+	// once the whole range is used, tags outside of it are chosen
+	msg4 := NewMessage("Foo").AddReservedRange(16, 2047)
+	tag, err = msg4.AllocateTag("alpha", TagStrategyHashName)
+	testutil.Ok(t, err)
+	testutil.Eq(t, int32(2048), tag)
+}
+
+func TestTagStrategyUsedWhenBuilding(t *testing.T) {
+	msg := NewMessage("Foo").
+		AddField(NewField("a", FieldTypeString())).
+		AddField(NewField("b", FieldTypeString())).
+		AddField(NewField("c", FieldTypeString()).SetNumber(2)).
+		AddReservedRange(1, 1).
+		AddExtensionRange(3, 4)
+	file := NewFile("foo.proto").AddMessage(msg)
+
+	// auto-assigned tags avoid reserved and extension ranges
+	fd, err := file.Build()
+	testutil.Ok(t, err)
+	md := fd.FindMessage("Foo")
+	testutil.Eq(t, int32(5), md.FindFieldByName("a").GetNumber())
+	testutil.Eq(t, int32(6), md.FindFieldByName("b").GetNumber())
+
+	msg.SetTagStrategy(TagStrategyInfrequent)
+	fd, err = file.Build()
+	testutil.Ok(t, err)
+	md = fd.FindMessage("Foo")
+	testutil.Eq(t, int32(16), md.FindFieldByName("a").GetNumber())
+	testutil.Eq(t, int32(17), md.FindFieldByName("b").GetNumber())
+	// the builder itself is unchanged
+	testutil.Eq(t, int32(0), msg.GetField("a").GetNumber())
+}
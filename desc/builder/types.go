@@ -185,7 +185,9 @@ func FieldTypeImportedEnum(ed *desc.EnumDescriptor) *FieldType {
 }
 
 func fieldTypeFromDescriptor(fld *desc.FieldDescriptor) *FieldType {
-	switch fld.GetType() {
+	// use the type from the descriptor proto since, for editions, GetType
+	// reports delimited message fields as groups
+	switch fld.AsFieldDescriptorProto().GetType() {
 	case descriptorpb.FieldDescriptorProto_TYPE_GROUP:
 		return &FieldType{fieldType: descriptorpb.FieldDescriptorProto_TYPE_GROUP, foreignMsgType: fld.GetMessageType()}
 	case descriptorpb.FieldDescriptorProto_TYPE_MESSAGE:
@@ -193,7 +195,7 @@ func fieldTypeFromDescriptor(fld *desc.FieldDescriptor) *FieldType {
 	case descriptorpb.FieldDescriptorProto_TYPE_ENUM:
 		return FieldTypeImportedEnum(fld.GetEnumType())
 	default:
-		return FieldTypeScalar(fld.GetType())
+		return FieldTypeScalar(fld.AsFieldDescriptorProto().GetType())
 	}
 }
 
@@ -1053,14 +1053,32 @@ func (fd *FieldDescriptor) GetOneOf() *OneOfDescriptor {
 // GetType returns the type of this field. If the type indicates an enum, the
 // enum type can be queried via GetEnumType. If the type indicates a message, the
 // message type can be queried via GetMessageType.
+//
+// For files that use editions, a message field whose resolved message encoding
+// feature is DELIMITED returns TYPE_GROUP since such fields use the group
+// encoding. To see the type as it appears in the descriptor proto, use
+// AsFieldDescriptorProto().GetType().
 func (fd *FieldDescriptor) GetType() descriptorpb.FieldDescriptorProto_Type {
-	return fd.proto.GetType()
+	if !fd.file.IsEditions() {
+		return fd.proto.GetType()
+	}
+	if fd.IsDelimited() {
+		return descriptorpb.FieldDescriptorProto_TYPE_GROUP
+	}
+	return descriptorpb.FieldDescriptorProto_Type(fd.wrapped.Kind())
 }
 
 // GetLabel returns the label for this field. The label can be required (proto2-only),
 // optional (default for proto3), or required.
+//
+// For files that use editions, a field whose resolved field presence feature
+// is LEGACY_REQUIRED returns LABEL_REQUIRED. To see the label as it appears in
+// the descriptor proto, use AsFieldDescriptorProto().GetLabel().
 func (fd *FieldDescriptor) GetLabel() descriptorpb.FieldDescriptorProto_Label {
-	return fd.proto.GetLabel()
+	if !fd.file.IsEditions() {
+		return fd.proto.GetLabel()
+	}
+	return descriptorpb.FieldDescriptorProto_Label(fd.wrapped.Cardinality())
 }
 
 // IsRequired returns true if this field has the "required" label.
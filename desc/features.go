@@ -0,0 +1,259 @@
+package desc
+
+import (
+	"github.com/golang/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protoreflect"
+	"google.golang.org/protobuf/types/descriptorpb"
+)
+
+// featureDefaults returns the default values of all features for the given
+// edition. Editions newer than the most recent one known to this package
+// use the defaults of the most recent known edition.
+func featureDefaults(edition descriptorpb.Edition) *descriptorpb.FeatureSet {
+	switch {
+	case edition <= descriptorpb.Edition_EDITION_PROTO2:
+		return &descriptorpb.FeatureSet{
+			FieldPresence:         descriptorpb.FeatureSet_EXPLICIT.Enum(),
+			EnumType:              descriptorpb.FeatureSet_CLOSED.Enum(),
+			RepeatedFieldEncoding: descriptorpb.FeatureSet_EXPANDED.Enum(),
+			Utf8Validation:        descriptorpb.FeatureSet_NONE.Enum(),
+			MessageEncoding:       descriptorpb.FeatureSet_LENGTH_PREFIXED.Enum(),
+			JsonFormat:            descriptorpb.FeatureSet_LEGACY_BEST_EFFORT.Enum(),
+		}
+	case edition == descriptorpb.Edition_EDITION_PROTO3:
+		return &descriptorpb.FeatureSet{
+			FieldPresence:         descriptorpb.FeatureSet_IMPLICIT.Enum(),
+			EnumType:              descriptorpb.FeatureSet_OPEN.Enum(),
+			RepeatedFieldEncoding: descriptorpb.FeatureSet_PACKED.Enum(),
+			Utf8Validation:        descriptorpb.FeatureSet_VERIFY.Enum(),
+			MessageEncoding:       descriptorpb.FeatureSet_LENGTH_PREFIXED.Enum(),
+			JsonFormat:            descriptorpb.FeatureSet_ALLOW.Enum(),
+		}
+	default:
+		return &descriptorpb.FeatureSet{
+			FieldPresence:         descriptorpb.FeatureSet_EXPLICIT.Enum(),
+			EnumType:              descriptorpb.FeatureSet_OPEN.Enum(),
+			RepeatedFieldEncoding: descriptorpb.FeatureSet_PACKED.Enum(),
+			Utf8Validation:        descriptorpb.FeatureSet_VERIFY.Enum(),
+			MessageEncoding:       descriptorpb.FeatureSet_LENGTH_PREFIXED.Enum(),
+			JsonFormat:            descriptorpb.FeatureSet_ALLOW.Enum(),
+		}
+	}
+}
+
+// mergeFeatures returns the result of overlaying the given overrides onto
+// the given resolved features. The given resolved features are not modified.
+func mergeFeatures(resolved, overrides *descriptorpb.FeatureSet) *descriptorpb.FeatureSet {
+	ret := proto.Clone(resolved).(*descriptorpb.FeatureSet)
+	if overrides != nil {
+		proto.Merge(ret, overrides)
+	}
+	return ret
+}
+
+// GetEdition returns the edition of the file. Files that declare a syntax of
+// "proto2" or "proto3" (or that declare no syntax, which implies "proto2")
+// return EDITION_PROTO2 and EDITION_PROTO3 respectively.
+func (fd *FileDescriptor) GetEdition() descriptorpb.Edition {
+	switch fd.wrapped.Syntax() {
+	case protoreflect.Proto3:
+		return descriptorpb.Edition_EDITION_PROTO3
+	case protoreflect.Editions:
+		return fd.proto.GetEdition()
+	default:
+		return descriptorpb.Edition_EDITION_PROTO2
+	}
+}
+
+// IsEditions returns true if the file declares an edition (e.g. "2023")
+// instead of a syntax of "proto2" or "proto3".
+func (fd *FileDescriptor) IsEditions() bool {
+	return fd.wrapped.Syntax() == protoreflect.Editions
+}
+
+// GetResolvedFeatures returns the features that apply to the file. This is
+// the defaults for the file's edition with any feature overrides in the
+// file's options applied. Files that use "proto2" or "proto3" syntax have
+// the features of the equivalent edition.
+//
+// The returned message is a new value and may be freely modified by the
+// caller.
+func (fd *FileDescriptor) GetResolvedFeatures() *descriptorpb.FeatureSet {
+	return mergeFeatures(featureDefaults(fd.GetEdition()), fd.proto.GetOptions().GetFeatures())
+}
+
+// GetResolvedFeatures returns the features that apply to the message. This
+// is the resolved features of the enclosing element with any feature
+// overrides in the message's options applied.
+//
+// The returned message is a new value and may be freely modified by the
+// caller.
+func (md *MessageDescriptor) GetResolvedFeatures() *descriptorpb.FeatureSet {
+	return mergeFeatures(resolvedFeatures(md.parent), md.proto.GetOptions().GetFeatures())
+}
+
+// GetResolvedFeatures returns the features that apply to the field. This is
+// the resolved features of the enclosing element (the oneof, if the field is
+// part of one, or else the message or, for extensions, the scope in which the
+// extension is declared) with any feature overrides in the field's options
+// applied.
+//
+// For files that use "proto2" or "proto3" syntax, the returned features also
+// reflect the field's label, type, and options. For example, a required field
+// in a "proto2" file will indicate a field presence of LEGACY_REQUIRED; a
+// group field will indicate a message encoding of DELIMITED; and a repeated
+// field with a "packed" option will indicate the corresponding repeated field
+// encoding.
+//
+// The returned message is a new value and may be freely modified by the
+// caller.
+func (fd *FieldDescriptor) GetResolvedFeatures() *descriptorpb.FeatureSet {
+	var parent Descriptor = fd.parent
+	if fd.oneOf != nil {
+		parent = fd.oneOf
+	}
+	features := mergeFeatures(resolvedFeatures(parent), fd.proto.GetOptions().GetFeatures())
+	if fd.file.IsEditions() {
+		return features
+	}
+
+	// translate legacy syntax into equivalent features
+	switch {
+	case fd.IsRequired():
+		features.FieldPresence = descriptorpb.FeatureSet_LEGACY_REQUIRED.Enum()
+	case !fd.IsRepeated() && fd.HasPresence():
+		features.FieldPresence = descriptorpb.FeatureSet_EXPLICIT.Enum()
+	}
+	if fd.proto.GetType() == descriptorpb.FieldDescriptorProto_TYPE_GROUP {
+		features.MessageEncoding = descriptorpb.FeatureSet_DELIMITED.Enum()
+	}
+	if fd.IsRepeated() && fd.proto.GetOptions().Packed != nil {
+		if fd.proto.GetOptions().GetPacked() {
+			features.RepeatedFieldEncoding = descriptorpb.FeatureSet_PACKED.Enum()
+		} else {
+			features.RepeatedFieldEncoding = descriptorpb.FeatureSet_EXPANDED.Enum()
+		}
+	}
+	return features
+}
+
+// GetResolvedFeatures returns the features that apply to the one-of. This is
+// the resolved features of the enclosing message with any feature overrides
+// in the one-of's options applied.
+//
+// The returned message is a new value and may be freely modified by the
+// caller.
+func (od *OneOfDescriptor) GetResolvedFeatures() *descriptorpb.FeatureSet {
+	return mergeFeatures(od.parent.GetResolvedFeatures(), od.proto.GetOptions().GetFeatures())
+}
+
+// GetResolvedFeatures returns the features that apply to the enum. This is
+// the resolved features of the enclosing element with any feature overrides
+// in the enum's options applied.
+//
+// The returned message is a new value and may be freely modified by the
+// caller.
+func (ed *EnumDescriptor) GetResolvedFeatures() *descriptorpb.FeatureSet {
+	return mergeFeatures(resolvedFeatures(ed.parent), ed.proto.GetOptions().GetFeatures())
+}
+
+// GetResolvedFeatures returns the features that apply to the enum value. This
+// is the resolved features of the enclosing enum with any feature overrides in
+// the value's options applied.
+//
+// The returned message is a new value and may be freely modified by the
+// caller.
+func (vd *EnumValueDescriptor) GetResolvedFeatures() *descriptorpb.FeatureSet {
+	return mergeFeatures(vd.parent.GetResolvedFeatures(), vd.proto.GetOptions().GetFeatures())
+}
+
+// GetResolvedFeatures returns the features that apply to the service. This
+// is the resolved features of the file with any feature overrides in the
+// service's options applied.
+//
+// The returned message is a new value and may be freely modified by the
+// caller.
+func (sd *ServiceDescriptor) GetResolvedFeatures() *descriptorpb.FeatureSet {
+	return mergeFeatures(sd.file.GetResolvedFeatures(), sd.proto.GetOptions().GetFeatures())
+}
+
+// GetResolvedFeatures returns the features that apply to the method. This is
+// the resolved features of the enclosing service with any feature overrides
+// in the method's options applied.
+//
+// The returned message is a new value and may be freely modified by the
+// caller.
+func (md *MethodDescriptor) GetResolvedFeatures() *descriptorpb.FeatureSet {
+	return mergeFeatures(md.parent.GetResolvedFeatures(), md.proto.GetOptions().GetFeatures())
+}
+
+func resolvedFeatures(d Descriptor) *descriptorpb.FeatureSet {
+	switch d := d.(type) {
+	case *FileDescriptor:
+		return d.GetResolvedFeatures()
+	case *MessageDescriptor:
+		return d.GetResolvedFeatures()
+	case *FieldDescriptor:
+		return d.GetResolvedFeatures()
+	case *OneOfDescriptor:
+		return d.GetResolvedFeatures()
+	case *EnumDescriptor:
+		return d.GetResolvedFeatures()
+	case *EnumValueDescriptor:
+		return d.GetResolvedFeatures()
+	case *ServiceDescriptor:
+		return d.GetResolvedFeatures()
+	case *MethodDescriptor:
+		return d.GetResolvedFeatures()
+	default:
+		return nil
+	}
+}
+
+// IsPacked returns true if this field is a repeated field that uses the packed
+// encoding. This is the case when the field is a repeated numeric field (a
+// scalar other than string or bytes or an enum) and either it has a "packed"
+// option set to true or the resolved repeated field encoding feature is PACKED
+// (which is the default for "proto3" syntax and for editions).
+func (fd *FieldDescriptor) IsPacked() bool {
+	return fd.wrapped.IsPacked()
+}
+
+// IsDelimited returns true if this field is a message field that uses the
+// delimited (aka group) encoding. This is the case for group fields in "proto2"
+// syntax files as well as message fields whose resolved message encoding
+// feature is DELIMITED.
+func (fd *FieldDescriptor) IsDelimited() bool {
+	switch fd.wrapped.Kind() {
+	case protoreflect.GroupKind:
+		return true
+	case protoreflect.MessageKind:
+		// The protobuf runtime does not report delimited extensions as groups,
+		// so we must examine the features ourselves.
+		return fd.IsExtension() && fd.file.IsEditions() &&
+			fd.GetResolvedFeatures().GetMessageEncoding() == descriptorpb.FeatureSet_DELIMITED
+	default:
+		return false
+	}
+}
+
+// IsUTF8Validated returns true if this is a string field whose contents must
+// be valid UTF-8. This is the case for string fields in "proto3" syntax files
+// as well as string fields whose resolved UTF-8 validation feature is VERIFY.
+// For map fields, this applies to the map's key and value types.
+func (fd *FieldDescriptor) IsUTF8Validated() bool {
+	isString := fd.wrapped.Kind() == protoreflect.StringKind
+	if fd.IsMap() {
+		isString = fd.wrapped.MapKey().Kind() == protoreflect.StringKind ||
+			fd.wrapped.MapValue().Kind() == protoreflect.StringKind
+	}
+	return isString && fd.GetResolvedFeatures().GetUtf8Validation() == descriptorpb.FeatureSet_VERIFY
+}
+
+// IsClosed returns true if this is a closed enum. A closed enum only allows
+// the numeric values defined in the enum; unrecognized values encountered
+// when de-serializing are stored as unknown fields. Enums in "proto2" syntax
+// files are closed, as are enums whose resolved enum type feature is CLOSED.
+func (ed *EnumDescriptor) IsClosed() bool {
+	return ed.wrapped.IsClosed()
+}
@@ -0,0 +1,105 @@
+package desc
+
+import (
+	"testing"
+
+	"google.golang.org/protobuf/types/descriptorpb"
+
+	"github.com/jhump/protoreflect/internal/testutil"
+)
+
+func TestEditionsFeatures(t *testing.T) {
+	fd, err := loadProtoset("../internal/testprotos/desc_test_editions.protoset")
+	testutil.Ok(t, err)
+	testutil.Require(t, fd.IsEditions())
+	testutil.Require(t, !fd.IsProto3())
+	testutil.Eq(t, descriptorpb.Edition_EDITION_2023, fd.GetEdition())
+
+	fileFeatures := fd.GetResolvedFeatures()
+	testutil.Eq(t, descriptorpb.FeatureSet_IMPLICIT, fileFeatures.GetFieldPresence())
+	testutil.Eq(t, descriptorpb.FeatureSet_CLOSED, fileFeatures.GetEnumType())
+	testutil.Eq(t, descriptorpb.FeatureSet_PACKED, fileFeatures.GetRepeatedFieldEncoding())
+	testutil.Eq(t, descriptorpb.FeatureSet_VERIFY, fileFeatures.GetUtf8Validation())
+	testutil.Eq(t, descriptorpb.FeatureSet_LENGTH_PREFIXED, fileFeatures.GetMessageEncoding())
+	testutil.Eq(t, descriptorpb.FeatureSet_ALLOW, fileFeatures.GetJsonFormat())
+
+	md := fd.FindMessage("testprotos.editions.Foo")
+	testutil.Eq(t, descriptorpb.FeatureSet_LEGACY_BEST_EFFORT, md.GetResolvedFeatures().GetJsonFormat())
+	testutil.Eq(t, descriptorpb.FeatureSet_IMPLICIT, md.GetResolvedFeatures().GetFieldPresence())
+
+	name := md.FindFieldByName("name")
+	testutil.Require(t, !name.HasPresence())
+	testutil.Require(t, name.IsUTF8Validated())
+	testutil.Eq(t, descriptorpb.FeatureSet_LEGACY_BEST_EFFORT, name.GetResolvedFeatures().GetJsonFormat())
+
+	id := md.FindFieldByName("id")
+	testutil.Require(t, id.HasPresence())
+	testutil.Eq(t, descriptorpb.FeatureSet_EXPLICIT, id.GetResolvedFeatures().GetFieldPresence())
+
+	key := md.FindFieldByName("key")
+	testutil.Require(t, key.IsRequired())
+	testutil.Eq(t, descriptorpb.FieldDescriptorProto_LABEL_REQUIRED, key.GetLabel())
+	testutil.Eq(t, descriptorpb.FieldDescriptorProto_LABEL_OPTIONAL, key.AsFieldDescriptorProto().GetLabel())
+
+	values := md.FindFieldByName("values")
+	testutil.Require(t, values.IsPacked())
+	others := md.FindFieldByName("others")
+	testutil.Require(t, !others.IsPacked())
+
+	bar := md.FindFieldByName("bar")
+	testutil.Require(t, bar.IsDelimited())
+	testutil.Eq(t, descriptorpb.FieldDescriptorProto_TYPE_GROUP, bar.GetType())
+	testutil.Eq(t, descriptorpb.FieldDescriptorProto_TYPE_MESSAGE, bar.AsFieldDescriptorProto().GetType())
+	testutil.Require(t, !md.FindFieldByName("bars").IsDelimited())
+
+	baz := bar.GetMessageType().FindFieldByName("baz")
+	testutil.Require(t, !baz.IsUTF8Validated())
+	testutil.Eq(t, descriptorpb.FeatureSet_NONE, baz.GetResolvedFeatures().GetUtf8Validation())
+
+	status := md.FindFieldByName("status")
+	testutil.Require(t, status.GetEnumType().IsClosed())
+	testutil.Eq(t, int32(0), status.GetDefaultValue())
+	openStatus := md.FindFieldByName("open_status")
+	testutil.Require(t, !openStatus.GetEnumType().IsClosed())
+	testutil.Eq(t, descriptorpb.FeatureSet_OPEN, openStatus.GetEnumType().GetValues()[0].GetResolvedFeatures().GetEnumType())
+
+	extraBar := fd.FindExtensionByName("testprotos.editions.extra_bar")
+	testutil.Require(t, extraBar.IsDelimited())
+	flags := fd.FindExtensionByName("testprotos.editions.flags")
+	testutil.Require(t, flags.IsPacked())
+
+	mtd := fd.FindService("testprotos.editions.FooService").FindMethodByName("GetFoo")
+	testutil.Eq(t, descriptorpb.FeatureSet_IMPLICIT, mtd.GetResolvedFeatures().GetFieldPresence())
+}
+
+func TestLegacySyntaxFeatures(t *testing.T) {
+	fd, err := LoadFileDescriptor("desc_test_field_types.proto")
+	testutil.Ok(t, err)
+	testutil.Require(t, !fd.IsEditions())
+	testutil.Eq(t, descriptorpb.Edition_EDITION_PROTO2, fd.GetEdition())
+	testutil.Eq(t, descriptorpb.FeatureSet_CLOSED, fd.GetResolvedFeatures().GetEnumType())
+	testutil.Eq(t, descriptorpb.FeatureSet_EXPANDED, fd.GetResolvedFeatures().GetRepeatedFieldEncoding())
+
+	md := fd.FindMessage("testprotos.UnaryFields")
+	for _, fld := range md.GetFields() {
+		features := fld.GetResolvedFeatures()
+		switch {
+		case fld.IsRequired():
+			testutil.Eq(t, descriptorpb.FeatureSet_LEGACY_REQUIRED, features.GetFieldPresence(), "%s", fld.GetName())
+		default:
+			testutil.Eq(t, descriptorpb.FeatureSet_EXPLICIT, features.GetFieldPresence(), "%s", fld.GetName())
+		}
+		if fld.GetType() == descriptorpb.FieldDescriptorProto_TYPE_GROUP {
+			testutil.Require(t, fld.IsDelimited())
+			testutil.Eq(t, descriptorpb.FeatureSet_DELIMITED, features.GetMessageEncoding(), "%s", fld.GetName())
+		}
+	}
+
+	fd, err = LoadFileDescriptor("desc_test_proto3.proto")
+	testutil.Ok(t, err)
+	testutil.Eq(t, descriptorpb.Edition_EDITION_PROTO3, fd.GetEdition())
+	features := fd.GetResolvedFeatures()
+	testutil.Eq(t, descriptorpb.FeatureSet_IMPLICIT, features.GetFieldPresence())
+	testutil.Eq(t, descriptorpb.FeatureSet_OPEN, features.GetEnumType())
+	testutil.Eq(t, descriptorpb.FeatureSet_PACKED, features.GetRepeatedFieldEncoding())
+}
@@ -0,0 +1,17 @@
+// Package jsonschema provides a mechanism to generate JSON Schema documents
+// from message descriptors.
+//
+// The generated schemas describe the JSON format of messages, as produced by
+// the MarshalJSON methods of dynamic.Message. So, for example, 64-bit integers
+// are described as strings, enums as their value names (or their numbers if so
+// configured), and well-known types like google.protobuf.Timestamp and
+// google.protobuf.Struct are described using their special JSON formats.
+//
+// This can be useful for validating JSON payloads in environments that have
+// no protobuf tooling, such as browsers or API gateways.
+//
+// The reverse direction is also supported: an Importer converts JSON Schemas
+// into message and enum definitions, using the desc/builder package. This can
+// be used to bootstrap proto definitions for APIs that were previously
+// described only by JSON Schema.
+package jsonschema
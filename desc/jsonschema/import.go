@@ -0,0 +1,1191 @@
+package jsonschema
+
+import (
+	"fmt"
+	"math"
+	"sort"
+	"strings"
+	"unicode"
+
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/types/descriptorpb"
+	// Make sure the well-known types are registered, so they can be loaded
+	// by name when referenced by imported schemas.
+	_ "google.golang.org/protobuf/types/known/anypb"
+	_ "google.golang.org/protobuf/types/known/durationpb"
+	_ "google.golang.org/protobuf/types/known/emptypb"
+	_ "google.golang.org/protobuf/types/known/fieldmaskpb"
+	"google.golang.org/protobuf/types/known/structpb"
+	_ "google.golang.org/protobuf/types/known/timestamppb"
+	_ "google.golang.org/protobuf/types/known/wrapperspb"
+
+	"github.com/jhump/protoreflect/desc"
+	"github.com/jhump/protoreflect/desc/builder"
+)
+
+// Importer converts JSON Schemas into proto3 message and enum definitions.
+// This is the reverse of Generator and can be used to bootstrap a proto
+// schema for an API that was previously described only by JSON Schema.
+//
+// Since JSON Schema is far more expressive than protobuf, the conversion is
+// lossy. Validation keywords, like "pattern" and "minLength", are dropped and
+// some constructs must be approximated. The importer reports a Warning for
+// every such lossy mapping.
+//
+// Schemas are mapped to proto types as follows:
+//   - Objects with properties become messages. Each property becomes a field,
+//     with numbers assigned in order of property name.
+//   - Objects with no properties but with a schema for "additionalProperties"
+//     become maps with string keys. Other objects become google.protobuf.Struct.
+//   - Arrays become repeated fields. Arrays of arrays (or of maps) need a
+//     message that wraps the inner value.
+//   - String enums become enums.
+//   - "oneOf" and "anyOf" become oneofs. A schema that allows a value or null
+//     is treated as the non-null schema, but scalar values use wrapper types
+//     (like google.protobuf.StringValue) so that null can be distinguished.
+//   - Strings in "date-time" and "duration" format become
+//     google.protobuf.Timestamp and google.protobuf.Duration; base64-encoded
+//     strings become bytes.
+//   - Schemas that allow anything become google.protobuf.Value.
+//
+// The output of Generator is also recognized. For example, the patterns it
+// uses for 64-bit integers map back to int64 and uint64 fields, and the
+// schemas it generates for oneofs map back to oneofs.
+//
+// The "nullable" keyword from OpenAPI 3.0 is also supported.
+type Importer struct {
+	// The name of the generated file. If empty, "schema.proto" is used.
+	FileName string
+
+	// The package of the generated file. Definitions whose names start with
+	// this package are named relative to it. Furthermore, if such a name
+	// contains dots, and the part before the last dot is the name of another
+	// definition, the type is nested inside the type for that other
+	// definition. This way, the definitions produced by Generator map back to
+	// the same type hierarchy.
+	Package string
+}
+
+// Warning describes a lossy mapping from a JSON Schema construct to proto.
+type Warning struct {
+	// A JSON pointer to the schema that could not be faithfully represented,
+	// such as "#/$defs/Book/properties/title".
+	Path string
+	// A description of what was lost.
+	Message string
+}
+
+func (w Warning) String() string {
+	return w.Path + ": " + w.Message
+}
+
+// Import converts the given schema, including all of its definitions (in
+// "$defs" and "definitions"), into messages and enums in a new file. If the
+// root schema is not simply a reference to one of its definitions, it becomes
+// a message too, named after its title or, if it has no title, "Root". If the
+// root schema describes something other than an object, such as an array or
+// a string, that message has a single field named "value" that holds it.
+//
+// Since a Schema stores properties in a map, the order in which they appear
+// in the source JSON is not known. So fields are numbered in order of
+// property name, and adding a property to the schema can change the numbers
+// of existing fields.
+//
+// An error is returned if a reference cannot be resolved or if the resulting
+// file is not valid.
+func (imp *Importer) Import(root *Schema) (*builder.FileBuilder, []Warning, error) {
+	st := imp.newState()
+	st.addDefinitions(root.Defs, "#/$defs/")
+	st.addDefinitions(root.Definitions, "#/definitions/")
+	st.declare()
+	if root.Ref == "" && root.Bool == nil {
+		name := "Root"
+		if root.Title != "" {
+			name = camelCase(root.Title)
+		}
+		mb := builder.NewMessage(st.uniqueName(st.file, name, "#"))
+		st.file.AddMessage(mb)
+		if s, _ := unwrapNullable(root); isValueSchema(s) {
+			st.addProperty(mb, nil, "value", root, "#")
+			st.warn("#", "root schema is not an object; represented as message %s with field value", mb.GetName())
+		} else {
+			st.fillMessage(mb, root, "#")
+		}
+	} else if root.Ref != "" {
+		// make sure the reference is valid
+		st.resolveRef(root.Ref, "#")
+	}
+	return st.finish()
+}
+
+// ImportDefinitions converts the given definitions into messages and enums in
+// a new file. References to definitions must be the given prefix followed by
+// the definition's key. For example, definitions from the components of an
+// OpenAPI document would use a prefix of "#/components/schemas/".
+//
+// An error is returned if a reference cannot be resolved or if the resulting
+// file is not valid.
+func (imp *Importer) ImportDefinitions(defs map[string]*Schema, refPrefix string) (*builder.FileBuilder, []Warning, error) {
+	st := imp.newState()
+	st.addDefinitions(defs, refPrefix)
+	st.declare()
+	return st.finish()
+}
+
+type importState struct {
+	imp  *Importer
+	file *builder.FileBuilder
+	// definitions, keyed by the reference used to refer to them
+	defs  map[string]*definition
+	order []*definition
+	// names in use in each scope, which is a file or message builder
+	names map[builder.Builder]map[string]struct{}
+	// the next field number for each message
+	numbers  map[*builder.MessageBuilder]int32
+	warnings []Warning
+	err      error
+}
+
+type definition struct {
+	key, ref string
+	schema   *Schema
+	// exactly one of the following is set after declaration, unless the
+	// definition is an alias for another type, which is resolved when used
+	msg       *builder.MessageBuilder
+	enum      *builder.EnumBuilder
+	wkt       *builder.FieldType
+	resolving bool
+}
+
+func (imp *Importer) newState() *importState {
+	fileName := imp.FileName
+	if fileName == "" {
+		fileName = "schema.proto"
+	}
+	fb := builder.NewFile(fileName).SetProto3(true).SetPackageName(imp.Package)
+	return &importState{
+		imp:     imp,
+		file:    fb,
+		defs:    map[string]*definition{},
+		names:   map[builder.Builder]map[string]struct{}{},
+		numbers: map[*builder.MessageBuilder]int32{},
+	}
+}
+
+func (st *importState) warn(path, format string, args ...interface{}) {
+	st.warnings = append(st.warnings, Warning{Path: path, Message: fmt.Sprintf(format, args...)})
+}
+
+func (st *importState) fail(path, format string, args ...interface{}) {
+	if st.err == nil {
+		st.err = fmt.Errorf("%s: %s", path, fmt.Sprintf(format, args...))
+	}
+}
+
+func (st *importState) finish() (*builder.FileBuilder, []Warning, error) {
+	if st.err != nil {
+		return nil, nil, st.err
+	}
+	if _, err := st.file.Build(); err != nil {
+		return nil, nil, err
+	}
+	return st.file, st.warnings, nil
+}
+
+func (st *importState) addDefinitions(defs map[string]*Schema, refPrefix string) {
+	keys := make([]string, 0, len(defs))
+	for k := range defs {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	for _, k := range keys {
+		ref := refPrefix + escapePointer(k)
+		d := &definition{key: k, ref: ref, schema: defs[k]}
+		st.defs[ref] = d
+		st.order = append(st.order, d)
+	}
+}
+
+// declare creates the message and enum builders for all definitions, so that
+// they can be referenced, and then populates the messages.
+func (st *importState) declare() {
+	for _, d := range st.order {
+		if ft := wellKnownType(d.key); ft != nil {
+			d.wkt = ft
+			continue
+		}
+		s, _ := unwrapNullable(d.schema)
+		scope, name := st.definitionScope(d)
+		switch {
+		case enumValues(s) != nil:
+			d.enum = st.newEnum(scope, name, s, d.ref)
+		case isMessageSchema(s):
+			d.msg = builder.NewMessage(st.uniqueName(scope, name, d.ref))
+			if mb, ok := scope.(*builder.MessageBuilder); ok {
+				mb.AddNestedMessage(d.msg)
+			} else {
+				st.file.AddMessage(d.msg)
+			}
+		}
+	}
+	for _, d := range st.order {
+		if d.msg == nil {
+			continue
+		}
+		s, _ := unwrapNullable(d.schema)
+		if unionAlternatives(s) != nil && len(s.Properties) == 0 {
+			// the message is just a oneof of the alternatives
+			st.describe(d.msg, s)
+			t := st.resolveUnion(d.msg, "value", s, d.ref)
+			st.addUnion(d.msg, "value", t, d.ref)
+			st.warn(d.ref, "union represented as message %s with oneof value; the JSON has a property per alternative", d.msg.GetName())
+			continue
+		}
+		st.fillMessage(d.msg, s, d.ref)
+	}
+}
+
+// definitionScope returns the scope in which the type for the given
+// definition is declared and the type's name.
+func (st *importState) definitionScope(d *definition) (builder.Builder, string) {
+	key := d.key
+	if st.imp.Package != "" && strings.HasPrefix(key, st.imp.Package+".") {
+		key = key[len(st.imp.Package)+1:]
+		if pos := strings.LastIndexByte(key, '.'); pos >= 0 {
+			parentKey := d.key[:len(d.key)-len(key)+pos]
+			parentRef := d.ref[:len(d.ref)-len(escapePointer(d.key))] + escapePointer(parentKey)
+			if parent := st.defs[parentRef]; parent != nil && parent.msg != nil {
+				return parent.msg, camelCase(key[pos+1:])
+			}
+		}
+	}
+	return st.file, camelCase(key)
+}
+
+func (st *importState) uniqueName(scope builder.Builder, name, path string) string {
+	names := st.names[scope]
+	if names == nil {
+		names = map[string]struct{}{}
+		st.names[scope] = names
+	}
+	unique := name
+	for i := 2; ; i++ {
+		if _, ok := names[unique]; !ok {
+			break
+		}
+		unique = fmt.Sprintf("%s%d", name, i)
+	}
+	if unique != name {
+		st.warn(path, "name %s is already used; renamed to %s", name, unique)
+	}
+	names[unique] = struct{}{}
+	return unique
+}
+
+func (st *importState) nextNumber(mb *builder.MessageBuilder) int32 {
+	st.numbers[mb]++
+	return st.numbers[mb]
+}
+
+func (st *importState) describe(b builder.Builder, s *Schema) {
+	if s.Description != "" {
+		c := commentsFor(s.Description)
+		switch b := b.(type) {
+		case *builder.MessageBuilder:
+			b.SetComments(c)
+		case *builder.EnumBuilder:
+			b.SetComments(c)
+		case *builder.FieldBuilder:
+			b.SetComments(c)
+		case *builder.OneOfBuilder:
+			b.SetComments(c)
+		}
+	}
+	if s.Deprecated {
+		switch b := b.(type) {
+		case *builder.MessageBuilder:
+			b.SetOptions(&descriptorpb.MessageOptions{Deprecated: proto.Bool(true)})
+		case *builder.EnumBuilder:
+			b.SetOptions(&descriptorpb.EnumOptions{Deprecated: proto.Bool(true)})
+		case *builder.FieldBuilder:
+			b.SetOptions(&descriptorpb.FieldOptions{Deprecated: proto.Bool(true)})
+		}
+	}
+}
+
+func commentsFor(description string) builder.Comments {
+	var sb strings.Builder
+	for _, line := range strings.Split(description, "\n") {
+		if line != "" {
+			sb.WriteByte(' ')
+		}
+		sb.WriteString(line)
+		sb.WriteByte('\n')
+	}
+	return builder.Comments{LeadingComment: sb.String()}
+}
+
+// fillMessage adds fields to the given message for the properties of the
+// given object schema.
+func (st *importState) fillMessage(mb *builder.MessageBuilder, s *Schema, path string) {
+	st.describe(mb, s)
+	st.warnDropped(s, path)
+
+	props := map[string]*Schema{}
+	propPaths := map[string]string{}
+	for name, ps := range s.Properties {
+		props[name] = ps
+		propPaths[name] = path + "/properties/" + escapePointer(name)
+	}
+	required := map[string]struct{}{}
+	for _, name := range s.Required {
+		required[name] = struct{}{}
+	}
+
+	var groups [][]string
+	if group := oneOfGroup(s.OneOf); group != nil {
+		groups = append(groups, group)
+	} else if len(s.OneOf) > 0 {
+		st.warn(path+"/oneOf", "alternatives of an object are not represented")
+	}
+	if len(s.AnyOf) > 0 {
+		st.warn(path+"/anyOf", "alternatives of an object are not represented")
+	}
+	for i, sub := range s.AllOf {
+		subPath := fmt.Sprintf("%s/allOf/%d", path, i)
+		if group := oneOfGroup(sub.OneOf); group != nil && len(sub.Properties) == 0 {
+			groups = append(groups, group)
+			continue
+		}
+		resolved := sub
+		if sub.Ref != "" {
+			if d := st.resolveRef(sub.Ref, subPath); d != nil {
+				resolved = d.schema
+				subPath = d.ref
+			}
+		}
+		if len(resolved.Properties) == 0 {
+			st.warn(subPath, "subschema of allOf is not represented")
+			continue
+		}
+		st.warn(subPath, "properties of allOf subschema are merged into message %s", mb.GetName())
+		for name, ps := range resolved.Properties {
+			if _, ok := props[name]; !ok {
+				props[name] = ps
+				propPaths[name] = subPath + "/properties/" + escapePointer(name)
+			}
+		}
+		for _, name := range resolved.Required {
+			required[name] = struct{}{}
+		}
+	}
+
+	if s.AdditionalProperties != nil && len(props) > 0 {
+		if s.AdditionalProperties.Bool == nil || *s.AdditionalProperties.Bool {
+			st.warn(path+"/additionalProperties", "additional properties are not represented")
+		}
+	}
+	if len(s.PatternProperties) > 0 {
+		st.warn(path+"/patternProperties", "pattern properties are not represented")
+	}
+
+	names := make([]string, 0, len(props))
+	for name := range props {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	oneOfs := map[string]*builder.OneOfBuilder{}
+	for _, group := range groups {
+		var oob *builder.OneOfBuilder
+		for _, name := range group {
+			if _, ok := props[name]; !ok {
+				continue
+			}
+			if oob == nil {
+				oobName := st.uniqueName(mb, "choice", path)
+				st.warn(path, "JSON Schema does not name oneofs; oneof for properties %s named %s", strings.Join(group, ", "), oobName)
+				oob = builder.NewOneOf(oobName)
+				mb.AddOneOf(oob)
+			}
+			oneOfs[name] = oob
+		}
+	}
+
+	var unenforced []string
+	for _, name := range names {
+		st.addProperty(mb, oneOfs[name], name, props[name], propPaths[name])
+		if _, ok := required[name]; ok && oneOfs[name] == nil {
+			unenforced = append(unenforced, name)
+		}
+	}
+	if len(unenforced) > 0 {
+		st.warn(path+"/required", "required properties are not enforced in proto3: %s", strings.Join(unenforced, ", "))
+	}
+}
+
+// oneOfGroup returns the property names in the given alternatives if they
+// describe a oneof, in the form produced by Generator: each alternative
+// requires a single property, except for an optional last alternative that
+// matches none of the others.
+func oneOfGroup(alts []*Schema) []string {
+	if len(alts) == 0 {
+		return nil
+	}
+	var names []string
+	for i, alt := range alts {
+		if i == len(alts)-1 && alt.Not != nil {
+			break
+		}
+		if len(alt.Required) != 1 || len(alt.Properties) > 0 || alt.Type != nil || alt.Ref != "" {
+			return nil
+		}
+		names = append(names, alt.Required[0])
+	}
+	if len(names) == 0 {
+		return nil
+	}
+	return names
+}
+
+func (st *importState) addProperty(mb *builder.MessageBuilder, oob *builder.OneOfBuilder, prop string, s *Schema, path string) {
+	t := st.resolveType(mb, prop, s, path)
+	fieldName := st.uniqueName(mb, snakeCase(prop), path)
+	if t.alts != nil {
+		if oob == nil {
+			st.addUnion(mb, fieldName, t, path)
+			st.warn(path, "union represented as oneof %s; each alternative is a separate property in JSON", fieldName)
+			return
+		}
+		st.warn(path, "union inside a oneof is represented as google.protobuf.Value")
+		t = valueType()
+	}
+	if oob != nil && (t.elem != nil || t.key != nil) {
+		st.warn(path, "repeated and map fields cannot be in a oneof; field %s is not in oneof %s", fieldName, oob.GetName())
+		oob = nil
+	}
+	flb := st.newField(mb, fieldName, prop, t, path)
+	if jsonName(fieldName) != prop {
+		flb.SetJsonName(prop)
+	}
+	st.describe(flb, s)
+	if oob != nil {
+		oob.AddChoice(flb)
+	} else {
+		mb.AddField(flb)
+	}
+}
+
+func (st *importState) addUnion(mb *builder.MessageBuilder, name string, t *protoType, path string) {
+	oob := builder.NewOneOf(name)
+	mb.AddOneOf(oob)
+	for i, alt := range t.alts {
+		altName := st.uniqueName(mb, name+"_"+t.altNames[i], path)
+		oob.AddChoice(st.newField(mb, altName, altName, alt, path))
+	}
+}
+
+// newField creates a field of the given type, wrapping the type in a message
+// if necessary (since proto doesn't allow repeated repeated fields, maps with
+// repeated values, etc).
+func (st *importState) newField(mb *builder.MessageBuilder, name, hint string, t *protoType, path string) *builder.FieldBuilder {
+	var flb *builder.FieldBuilder
+	switch {
+	case t.elem != nil:
+		elem := st.wrapIfNeeded(mb, hint, t.elem, path)
+		flb = builder.NewField(name, elem.ft).SetRepeated()
+	case t.key != nil:
+		val := st.wrapIfNeeded(mb, hint, t.val, path)
+		flb = builder.NewMapField(name, t.key, val.ft)
+	case t.alts != nil:
+		flb = builder.NewField(name, st.wrapIfNeeded(mb, hint, t, path).ft)
+	default:
+		flb = builder.NewField(name, t.ft)
+		if t.optional {
+			flb.SetProto3Optional(true)
+		}
+	}
+	return flb.SetNumber(st.nextNumber(mb))
+}
+
+func (st *importState) wrapIfNeeded(mb *builder.MessageBuilder, hint string, t *protoType, path string) *protoType {
+	if t.ft != nil {
+		return t
+	}
+	wrapper := builder.NewMessage(st.uniqueName(mb, camelCase(hint)+"Value", path))
+	mb.AddNestedMessage(wrapper)
+	if t.alts != nil {
+		st.addUnion(wrapper, "value", t, path)
+	} else {
+		wrapper.AddField(st.newField(wrapper, "value", hint, t, path))
+	}
+	st.warn(path, "nested array, map, or union is wrapped in message %s, which changes the JSON shape", wrapper.GetName())
+	return &protoType{ft: builder.FieldTypeMessage(wrapper)}
+}
+
+// protoType is the proto representation of a schema.
+type protoType struct {
+	// set for scalar, enum, and message types
+	ft *builder.FieldType
+	// for enums that allow null
+	optional bool
+	// set for arrays
+	elem *protoType
+	// set for maps
+	key *builder.FieldType
+	val *protoType
+	// set for unions
+	alts     []*protoType
+	altNames []string
+}
+
+func valueType() *protoType {
+	return &protoType{ft: wellKnownType("google.protobuf.Value")}
+}
+
+func (st *importState) resolveRef(ref, path string) *definition {
+	d := st.defs[ref]
+	if d == nil {
+		st.fail(path, "unresolvable reference %q", ref)
+	}
+	return d
+}
+
+// resolveType computes the proto type for the given schema. If the schema
+// requires a new enum or message type, it is declared in the given scope,
+// and its name is derived from the given hint.
+func (st *importState) resolveType(scope *builder.MessageBuilder, hint string, s *Schema, path string) *protoType {
+	if s == nil {
+		return valueType()
+	}
+	if s.Bool != nil {
+		if !*s.Bool {
+			st.warn(path, "schema that matches nothing is represented as google.protobuf.Value")
+		}
+		return valueType()
+	}
+	s, nullable := unwrapNullable(s)
+	t := st.resolveNonNull(scope, hint, s, path)
+	if !nullable {
+		return t
+	}
+	switch {
+	case t.ft == nil:
+		if t.alts == nil {
+			st.warn(path, "null is not distinguished from an empty array or map")
+		}
+	case t.ft.GetType() == descriptorpb.FieldDescriptorProto_TYPE_ENUM:
+		t = &protoType{ft: t.ft, optional: true}
+	case t.ft.GetType() != descriptorpb.FieldDescriptorProto_TYPE_MESSAGE:
+		t = &protoType{ft: wrapperType(t.ft.GetType())}
+	}
+	return t
+}
+
+func (st *importState) resolveNonNull(scope *builder.MessageBuilder, hint string, s *Schema, path string) *protoType {
+	if s.Ref != "" {
+		d := st.resolveRef(s.Ref, path)
+		switch {
+		case d == nil:
+			return valueType()
+		case d.wkt != nil:
+			return &protoType{ft: d.wkt}
+		case d.msg != nil:
+			return &protoType{ft: builder.FieldTypeMessage(d.msg)}
+		case d.enum != nil:
+			return &protoType{ft: builder.FieldTypeEnum(d.enum)}
+		case d.resolving:
+			st.warn(path, "recursive reference to %s is represented as google.protobuf.Value", d.ref)
+			return valueType()
+		default:
+			// an alias for another type
+			d.resolving = true
+			defer func() { d.resolving = false }()
+			return st.resolveType(scope, hint, d.schema, d.ref)
+		}
+	}
+
+	st.warnDropped(s, path)
+
+	if len(s.AllOf) == 1 && len(s.Properties) == 0 && s.Type == nil {
+		return st.resolveType(scope, hint, s.AllOf[0], path+"/allOf/0")
+	}
+	if values := enumValues(s); values != nil {
+		return &protoType{ft: builder.FieldTypeEnum(st.newEnum(scope, camelCase(hint), s, path))}
+	}
+	if len(s.Enum) > 0 || s.Const != nil {
+		st.warn(path, "non-string enum or const constraint is not represented")
+	}
+	if format, ok := floatFormat(s); ok {
+		if format == "float" {
+			return &protoType{ft: builder.FieldTypeFloat()}
+		}
+		return &protoType{ft: builder.FieldTypeDouble()}
+	}
+	if unionAlternatives(s) != nil && len(s.Properties) == 0 {
+		return st.resolveUnion(scope, hint, s, path)
+	}
+	if isMessageSchema(s) {
+		mb := builder.NewMessage(st.uniqueName(scope, camelCase(hint), path))
+		scope.AddNestedMessage(mb)
+		st.fillMessage(mb, s, path)
+		return &protoType{ft: builder.FieldTypeMessage(mb)}
+	}
+
+	var types []string
+	for _, typ := range s.Type {
+		if typ != TypeNull {
+			types = append(types, typ)
+		}
+	}
+	var typ string
+	switch len(types) {
+	case 0:
+		switch {
+		case s.Items != nil:
+			typ = TypeArray
+		case s.AdditionalProperties != nil:
+			typ = TypeObject
+		case s.Type.Has(TypeNull):
+			typ = TypeNull
+		default:
+			return valueType()
+		}
+	case 1:
+		typ = types[0]
+	default:
+		st.warn(path, "value that may be any of %s is represented as google.protobuf.Value", strings.Join(types, ", "))
+		return valueType()
+	}
+
+	switch typ {
+	case TypeObject:
+		if s.AdditionalProperties != nil && s.AdditionalProperties.Bool == nil {
+			key := builder.FieldTypeString()
+			if s.PropertyNames != nil {
+				switch {
+				case s.PropertyNames.Pattern == signedIntPattern:
+					key = builder.FieldTypeInt64()
+				case s.PropertyNames.Pattern == unsignedIntPattern:
+					key = builder.FieldTypeUInt64()
+				case len(s.PropertyNames.Enum) == 2 && s.PropertyNames.Enum[0] == "true" && s.PropertyNames.Enum[1] == "false":
+					key = builder.FieldTypeBool()
+				default:
+					st.warn(path+"/propertyNames", "constraint on property names is not represented")
+				}
+			}
+			return &protoType{key: key, val: st.resolveType(scope, hint, s.AdditionalProperties, path+"/additionalProperties")}
+		}
+		return &protoType{ft: wellKnownType("google.protobuf.Struct")}
+	case TypeArray:
+		if s.Items == nil {
+			return &protoType{elem: valueType()}
+		}
+		items, nullable := unwrapNullable(s.Items)
+		if items.Bool != nil {
+			return &protoType{elem: st.resolveType(scope, hint, items, path+"/items")}
+		}
+		if nullable {
+			st.warn(path+"/items", "null elements are not represented")
+		}
+		return &protoType{elem: st.resolveNonNull(scope, hint, items, path+"/items")}
+	case TypeString:
+		switch {
+		case s.Format == "date-time":
+			return &protoType{ft: wellKnownType("google.protobuf.Timestamp")}
+		case s.Format == "duration":
+			return &protoType{ft: wellKnownType("google.protobuf.Duration")}
+		case s.ContentEncoding == "base64" || s.Format == "byte":
+			return &protoType{ft: builder.FieldTypeBytes()}
+		case s.Format == "int64" || s.Pattern == signedIntPattern:
+			return &protoType{ft: builder.FieldTypeInt64()}
+		case s.Format == "uint64" || s.Pattern == unsignedIntPattern:
+			return &protoType{ft: builder.FieldTypeUInt64()}
+		}
+		return &protoType{ft: builder.FieldTypeString()}
+	case TypeInteger:
+		return &protoType{ft: st.integerType(s, path)}
+	case TypeNumber:
+		if s.Format == "float" {
+			return &protoType{ft: builder.FieldTypeFloat()}
+		}
+		return &protoType{ft: builder.FieldTypeDouble()}
+	case TypeBoolean:
+		return &protoType{ft: builder.FieldTypeBool()}
+	case TypeNull:
+		ed, err := desc.LoadEnumDescriptorForEnum(structpb.NullValue(0))
+		if err != nil {
+			return valueType()
+		}
+		return &protoType{ft: builder.FieldTypeImportedEnum(ed)}
+	default:
+		st.warn(path, "unknown type %q is represented as google.protobuf.Value", typ)
+		return valueType()
+	}
+}
+
+func (st *importState) integerType(s *Schema, path string) *builder.FieldType {
+	switch s.Format {
+	case "int32":
+		return builder.FieldTypeInt32()
+	case "uint32":
+		return builder.FieldTypeUInt32()
+	}
+	min, max := math.Inf(-1), math.Inf(1)
+	if s.Minimum != nil {
+		min = *s.Minimum
+	}
+	if s.Maximum != nil {
+		max = *s.Maximum
+	}
+	switch {
+	case min >= math.MinInt32 && max <= math.MaxInt32:
+		return builder.FieldTypeInt32()
+	case min >= 0 && max <= math.MaxUint32:
+		return builder.FieldTypeUInt32()
+	case min >= 0 && s.Format != "int64":
+		st.warn(path, "64-bit integers are represented as strings in JSON")
+		return builder.FieldTypeUInt64()
+	default:
+		st.warn(path, "64-bit integers are represented as strings in JSON")
+		return builder.FieldTypeInt64()
+	}
+}
+
+func (st *importState) resolveUnion(scope *builder.MessageBuilder, hint string, s *Schema, path string) *protoType {
+	t := &protoType{}
+	alts, keyword := unionAlternativesWithKeyword(s)
+	names := map[string]struct{}{}
+	for i, alt := range alts {
+		altPath := fmt.Sprintf("%s/%s/%d", path, keyword, i)
+		altType := st.resolveType(scope, fmt.Sprintf("%s_option_%d", hint, i+1), alt, altPath)
+		if altType.alts != nil {
+			// flatten nested unions
+			t.alts = append(t.alts, altType.alts...)
+			t.altNames = append(t.altNames, altType.altNames...)
+			continue
+		}
+		name := unionAlternativeName(alt, altType, i)
+		if _, ok := names[name]; ok {
+			name = fmt.Sprintf("%s_%d", name, i+1)
+		}
+		names[name] = struct{}{}
+		t.alts = append(t.alts, altType)
+		t.altNames = append(t.altNames, name)
+	}
+	return t
+}
+
+func unionAlternativeName(alt *Schema, t *protoType, index int) string {
+	if alt.Ref != "" {
+		name := alt.Ref[strings.LastIndexByte(alt.Ref, '/')+1:]
+		name = name[strings.LastIndexByte(name, '.')+1:]
+		return snakeCase(name)
+	}
+	switch {
+	case t.elem != nil:
+		return "list"
+	case t.key != nil:
+		return "map"
+	case t.ft.GetType() == descriptorpb.FieldDescriptorProto_TYPE_MESSAGE,
+		t.ft.GetType() == descriptorpb.FieldDescriptorProto_TYPE_ENUM:
+		name := t.ft.GetTypeName()
+		return snakeCase(name[strings.LastIndexByte(name, '.')+1:])
+	case t.ft.GetType() != 0:
+		return strings.ToLower(strings.TrimPrefix(t.ft.GetType().String(), "TYPE_"))
+	default:
+		return fmt.Sprintf("option_%d", index+1)
+	}
+}
+
+// newEnum declares an enum for the given schema, whose values must be strings.
+func (st *importState) newEnum(scope builder.Builder, name string, s *Schema, path string) *builder.EnumBuilder {
+	eb := builder.NewEnum(st.uniqueName(scope, name, path))
+	st.describe(eb, s)
+	values := enumValues(s)
+	// enum values are in the same scope as the enum
+	prefix := upperSnakeCase(eb.GetName()) + "_"
+	addValue := func(name string, number int32) {
+		valueName := name
+		if !isIdentifier(valueName) {
+			valueName = upperSnakeCase(name)
+			st.warn(path, "enum value %q is renamed to %s, which is its name in JSON", name, valueName)
+		}
+		if _, ok := st.names[scope][valueName]; ok {
+			st.warn(path, "enum value %s conflicts with another name; renamed to %s", valueName, prefix+valueName)
+			valueName = prefix + valueName
+		}
+		eb.AddValue(builder.NewEnumValue(st.uniqueName(scope, valueName, path)).SetNumber(number))
+	}
+	var number int32
+	if first := values[0]; !strings.HasSuffix(first, "_UNSPECIFIED") && first != "UNSPECIFIED" && first != "UNKNOWN" {
+		// proto3 enums must have a zero value, which is the default
+		zero := prefix + "UNSPECIFIED"
+		st.warn(path, "added value %s, since the first value of a proto3 enum must be zero", zero)
+		addValue(zero, 0)
+		number = 1
+	}
+	for _, v := range values {
+		addValue(v, number)
+		number++
+	}
+	if mb, ok := scope.(*builder.MessageBuilder); ok {
+		mb.AddNestedEnum(eb)
+	} else {
+		st.file.AddEnum(eb)
+	}
+	return eb
+}
+
+// warnDropped adds warnings for validation keywords that cannot be represented
+// in proto. Keywords whose values match what Generator produces are not
+// reported since they are implied by the proto type.
+func (st *importState) warnDropped(s *Schema, path string) {
+	var dropped []string
+	if s.Pattern != "" && s.Pattern != signedIntPattern && s.Pattern != unsignedIntPattern && s.Pattern != durationPattern {
+		dropped = append(dropped, "pattern")
+	}
+	if s.MinLength != nil {
+		dropped = append(dropped, "minLength")
+	}
+	if s.MaxLength != nil {
+		dropped = append(dropped, "maxLength")
+	}
+	if s.MinItems != nil {
+		dropped = append(dropped, "minItems")
+	}
+	if s.MaxItems != nil {
+		dropped = append(dropped, "maxItems")
+	}
+	if !isImpliedRange(s) {
+		if s.Minimum != nil {
+			dropped = append(dropped, "minimum")
+		}
+		if s.Maximum != nil {
+			dropped = append(dropped, "maximum")
+		}
+	}
+	if s.Not != nil {
+		dropped = append(dropped, "not")
+	}
+	switch s.Format {
+	case "", "date-time", "duration", "byte", "int32", "uint32", "int64", "uint64", "float", "double":
+	default:
+		dropped = append(dropped, fmt.Sprintf("format %q", s.Format))
+	}
+	if len(dropped) > 0 {
+		st.warn(path, "constraints are not represented: %s", strings.Join(dropped, ", "))
+	}
+}
+
+func isImpliedRange(s *Schema) bool {
+	if s.Minimum == nil || s.Maximum == nil {
+		return false
+	}
+	min, max := *s.Minimum, *s.Maximum
+	return (min == math.MinInt32 && max == math.MaxInt32) || (min == 0 && max == math.MaxUint32)
+}
+
+// unwrapNullable returns the non-null schema if the given schema allows
+// either null or a value of another schema.
+func unwrapNullable(s *Schema) (*Schema, bool) {
+	if s.Bool != nil {
+		return s, false
+	}
+	if nullable, ok := s.Extra["nullable"].(bool); ok && nullable {
+		// OpenAPI 3.0
+		return s, true
+	}
+	if len(s.Type) == 2 && s.Type.Has(TypeNull) {
+		clone := *s
+		if s.Type[0] == TypeNull {
+			clone.Type = Types{s.Type[1]}
+		} else {
+			clone.Type = Types{s.Type[0]}
+		}
+		return &clone, true
+	}
+	for _, alts := range [][]*Schema{s.AnyOf, s.OneOf} {
+		if len(alts) != 2 {
+			continue
+		}
+		for i, alt := range alts {
+			if isNullSchema(alt) {
+				other := alts[1-i]
+				if other.Description == "" && s.Description != "" {
+					clone := *other
+					clone.Description = s.Description
+					other = &clone
+				}
+				return other, true
+			}
+		}
+	}
+	return s, false
+}
+
+func isNullSchema(s *Schema) bool {
+	return len(s.Type) == 1 && s.Type[0] == TypeNull && s.Ref == "" && len(s.Properties) == 0
+}
+
+// unionAlternatives returns the alternatives of the given schema if it is a
+// union of two or more alternatives. This does not include a union of a value
+// and null, or the form Generator uses for floating point values.
+func unionAlternatives(s *Schema) []*Schema {
+	alts, _ := unionAlternativesWithKeyword(s)
+	return alts
+}
+
+// unionAlternativesWithKeyword is like unionAlternatives but also returns the
+// keyword that contains the alternatives, "oneOf" or "anyOf". Alternatives
+// that are null are omitted.
+func unionAlternativesWithKeyword(s *Schema) ([]*Schema, string) {
+	alts, keyword := s.OneOf, "oneOf"
+	if len(alts) == 0 {
+		alts, keyword = s.AnyOf, "anyOf"
+	}
+	if len(alts) < 2 || oneOfGroup(alts) != nil {
+		return nil, ""
+	}
+	if _, ok := floatFormat(s); ok {
+		return nil, ""
+	}
+	var nonNull []*Schema
+	for _, alt := range alts {
+		if !isNullSchema(alt) {
+			nonNull = append(nonNull, alt)
+		}
+	}
+	if len(nonNull) < 2 {
+		return nil, ""
+	}
+	return nonNull, keyword
+}
+
+// floatFormat returns the format of a floating point value if the given schema
+// is the form Generator uses for floating point values: a number or a string
+// for NaN or infinity.
+func floatFormat(s *Schema) (string, bool) {
+	if len(s.AnyOf) != 2 {
+		return "", false
+	}
+	num, str := s.AnyOf[0], s.AnyOf[1]
+	if len(num.Type) != 1 || num.Type[0] != TypeNumber || len(str.Type) != 1 || str.Type[0] != TypeString || len(str.Enum) == 0 {
+		return "", false
+	}
+	for _, v := range str.Enum {
+		if v != "NaN" && v != "Infinity" && v != "-Infinity" {
+			return "", false
+		}
+	}
+	return num.Format, true
+}
+
+// enumValues returns the names of the values of the given schema if it
+// describes an enum: the values must all be strings. This also recognizes the
+// form Generator uses for open enums, which also allows integer values.
+func enumValues(s *Schema) []string {
+	if len(s.Enum) == 0 && len(s.AnyOf) == 2 && len(s.AnyOf[1].Type) == 1 && s.AnyOf[1].Type[0] == TypeInteger {
+		s = s.AnyOf[0]
+	}
+	if len(s.Enum) == 0 || (len(s.Type) > 0 && !s.Type.Has(TypeString)) {
+		return nil
+	}
+	values := make([]string, 0, len(s.Enum))
+	for _, v := range s.Enum {
+		str, ok := v.(string)
+		if !ok {
+			return nil
+		}
+		values = append(values, str)
+	}
+	return values
+}
+
+// isMessageSchema returns true if the given schema needs a message type.
+func isMessageSchema(s *Schema) bool {
+	if s.Bool != nil {
+		return false
+	}
+	if len(s.Properties) > 0 {
+		return true
+	}
+	if unionAlternatives(s) != nil || (len(s.AllOf) > 1 && len(s.Type) == 0) {
+		return true
+	}
+	if s.Type.Has(TypeObject) && len(s.Type) == 1 {
+		// an object with no properties that does not allow other properties
+		// is an empty message
+		return s.AdditionalProperties != nil && s.AdditionalProperties.Bool != nil && !*s.AdditionalProperties.Bool
+	}
+	return false
+}
+
+// isValueSchema returns true if the given schema describes a type of value,
+// other than an object with properties. Such a schema does not map to a
+// message by itself.
+func isValueSchema(s *Schema) bool {
+	if isMessageSchema(s) {
+		return false
+	}
+	return len(s.Type) > 0 || enumValues(s) != nil || s.Items != nil || s.AdditionalProperties != nil
+}
+
+var wellKnownTypeNames = map[string]struct{}{
+	"google.protobuf.Any":         {},
+	"google.protobuf.Duration":    {},
+	"google.protobuf.Empty":       {},
+	"google.protobuf.FieldMask":   {},
+	"google.protobuf.ListValue":   {},
+	"google.protobuf.Struct":      {},
+	"google.protobuf.Timestamp":   {},
+	"google.protobuf.Value":       {},
+	"google.protobuf.BoolValue":   {},
+	"google.protobuf.BytesValue":  {},
+	"google.protobuf.DoubleValue": {},
+	"google.protobuf.FloatValue":  {},
+	"google.protobuf.Int32Value":  {},
+	"google.protobuf.Int64Value":  {},
+	"google.protobuf.StringValue": {},
+	"google.protobuf.UInt32Value": {},
+	"google.protobuf.UInt64Value": {},
+}
+
+// wellKnownType returns the type for the given well-known type name or nil if
+// the name does not refer to a well-known type.
+func wellKnownType(name string) *builder.FieldType {
+	if _, ok := wellKnownTypeNames[name]; !ok {
+		return nil
+	}
+	md, err := desc.LoadMessageDescriptor(name)
+	if err != nil || md == nil {
+		return nil
+	}
+	return builder.FieldTypeImportedMessage(md)
+}
+
+func wrapperType(t descriptorpb.FieldDescriptorProto_Type) *builder.FieldType {
+	var name string
+	switch t {
+	case descriptorpb.FieldDescriptorProto_TYPE_BOOL:
+		name = "google.protobuf.BoolValue"
+	case descriptorpb.FieldDescriptorProto_TYPE_BYTES:
+		name = "google.protobuf.BytesValue"
+	case descriptorpb.FieldDescriptorProto_TYPE_DOUBLE:
+		name = "google.protobuf.DoubleValue"
+	case descriptorpb.FieldDescriptorProto_TYPE_FLOAT:
+		name = "google.protobuf.FloatValue"
+	case descriptorpb.FieldDescriptorProto_TYPE_INT32:
+		name = "google.protobuf.Int32Value"
+	case descriptorpb.FieldDescriptorProto_TYPE_INT64:
+		name = "google.protobuf.Int64Value"
+	case descriptorpb.FieldDescriptorProto_TYPE_UINT32:
+		name = "google.protobuf.UInt32Value"
+	case descriptorpb.FieldDescriptorProto_TYPE_UINT64:
+		name = "google.protobuf.UInt64Value"
+	default:
+		name = "google.protobuf.StringValue"
+	}
+	return wellKnownType(name)
+}
+
+// escapePointer escapes the given string for use in a JSON pointer.
+func escapePointer(s string) string {
+	return strings.ReplaceAll(strings.ReplaceAll(s, "~", "~0"), "/", "~1")
+}
+
+func isIdentifier(s string) bool {
+	for i, r := range s {
+		if r == '_' || (r < unicode.MaxASCII && unicode.IsLetter(r)) || (i > 0 && r < unicode.MaxASCII && unicode.IsDigit(r)) {
+			continue
+		}
+		return false
+	}
+	return s != ""
+}
+
+// words splits the given string into words, at non-alphanumeric characters
+// and at transitions from lower-case to upper-case.
+func words(s string) []string {
+	var result []string
+	var cur []rune
+	var prev rune
+	for _, r := range s {
+		if r >= unicode.MaxASCII || !(unicode.IsLetter(r) || unicode.IsDigit(r)) {
+			if len(cur) > 0 {
+				result = append(result, string(cur))
+				cur = nil
+			}
+			prev = 0
+			continue
+		}
+		if unicode.IsUpper(r) && (unicode.IsLower(prev) || unicode.IsDigit(prev)) && len(cur) > 0 {
+			result = append(result, string(cur))
+			cur = nil
+		}
+		cur = append(cur, r)
+		prev = r
+	}
+	if len(cur) > 0 {
+		result = append(result, string(cur))
+	}
+	return result
+}
+
+// camelCase converts the given string to an UpperCamelCase identifier.
+func camelCase(s string) string {
+	var sb strings.Builder
+	for _, w := range words(s) {
+		sb.WriteString(strings.ToUpper(w[:1]))
+		sb.WriteString(w[1:])
+	}
+	return identifier(sb.String(), "X")
+}
+
+// snakeCase converts the given string to a lower_snake_case identifier.
+func snakeCase(s string) string {
+	ws := words(s)
+	for i := range ws {
+		ws[i] = strings.ToLower(ws[i])
+	}
+	return identifier(strings.Join(ws, "_"), "field")
+}
+
+// upperSnakeCase converts the given string to an UPPER_SNAKE_CASE identifier.
+func upperSnakeCase(s string) string {
+	ws := words(s)
+	for i := range ws {
+		ws[i] = strings.ToUpper(ws[i])
+	}
+	return identifier(strings.Join(ws, "_"), "VALUE")
+}
+
+func identifier(s, fallback string) string {
+	switch {
+	case s == "":
+		return fallback
+	case unicode.IsDigit(rune(s[0])):
+		return "_" + s
+	default:
+		return s
+	}
+}
+
+// jsonName computes the default JSON name for a field with the given name,
+// the same way that protoc does.
+func jsonName(name string) string {
+	var sb strings.Builder
+	upper := false
+	for _, r := range name {
+		if r == '_' {
+			upper = true
+			continue
+		}
+		if upper {
+			r = unicode.ToUpper(r)
+			upper = false
+		}
+		sb.WriteRune(r)
+	}
+	return sb.String()
+}
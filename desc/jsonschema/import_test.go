@@ -0,0 +1,382 @@
+package jsonschema
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/types/descriptorpb"
+
+	"github.com/jhump/protoreflect/desc"
+	"github.com/jhump/protoreflect/dynamic"
+	"github.com/jhump/protoreflect/internal/testprotos"
+	"github.com/jhump/protoreflect/internal/testutil"
+)
+
+func TestImportGeneratedSchema(t *testing.T) {
+	md, err := desc.LoadMessageDescriptorForMessage((*testprotos.UnaryFields)(nil))
+	testutil.Ok(t, err)
+	schema := (&Generator{}).Generate(md)
+
+	fb, warnings, err := (&Importer{Package: "testprotos"}).Import(schema)
+	testutil.Ok(t, err)
+	fd, err := fb.Build()
+	testutil.Ok(t, err)
+	testutil.Eq(t, "schema.proto", fd.GetName())
+	testutil.Eq(t, "testprotos", fd.GetPackage())
+	testutil.Require(t, fd.IsProto3())
+
+	imported := fd.FindMessage("testprotos.UnaryFields")
+	testutil.Require(t, imported != nil)
+	types := map[string]string{}
+	for _, fld := range imported.GetFields() {
+		typ := fld.GetType().String()
+		if fld.GetMessageType() != nil {
+			typ = fld.GetMessageType().GetFullyQualifiedName()
+		} else if fld.GetEnumType() != nil {
+			typ = fld.GetEnumType().GetFullyQualifiedName()
+		}
+		types[fld.GetName()] = typ
+	}
+	testutil.Eq(t, map[string]string{
+		"i":      "TYPE_INT32",
+		"j":      "TYPE_INT64",
+		"k":      "TYPE_INT32",
+		"l":      "TYPE_INT64",
+		"m":      "TYPE_UINT32",
+		"n":      "TYPE_UINT64",
+		"o":      "TYPE_UINT32",
+		"p":      "TYPE_UINT64",
+		"q":      "TYPE_INT32",
+		"r":      "TYPE_INT64",
+		"s":      "TYPE_FLOAT",
+		"t":      "TYPE_DOUBLE",
+		"u":      "TYPE_BYTES",
+		"v":      "TYPE_STRING",
+		"w":      "TYPE_BOOL",
+		"x":      "testprotos.RepeatedFields",
+		"groupy": "testprotos.UnaryFields.GroupY",
+		"z":      "testprotos.TestEnum",
+	}, types)
+
+	// field numbers are assigned in order of property name
+	testutil.Eq(t, int32(1), imported.FindFieldByName("groupy").GetNumber())
+	testutil.Eq(t, int32(2), imported.FindFieldByName("i").GetNumber())
+
+	// nested type is nested again
+	testutil.Eq(t, "testprotos.UnaryFields", imported.FindFieldByName("groupy").GetMessageType().GetParent().GetFullyQualifiedName())
+
+	enum := fd.FindEnum("testprotos.TestEnum")
+	var values []string
+	for _, vd := range enum.GetValues() {
+		values = append(values, vd.GetName())
+	}
+	testutil.Eq(t, []string{"TEST_ENUM_UNSPECIFIED", "INVALID", "FIRST", "SECOND", "THIRD"}, values)
+	testutil.Require(t, hasWarning(warnings, "#/$defs/testprotos.TestEnum", "added value TEST_ENUM_UNSPECIFIED"))
+
+	// repeated fields
+	repeated := fd.FindMessage("testprotos.RepeatedFields")
+	testutil.Require(t, repeated.FindFieldByName("j").IsRepeated())
+	testutil.Eq(t, descriptorpb.FieldDescriptorProto_TYPE_INT64, repeated.FindFieldByName("j").GetType())
+}
+
+func TestImportGeneratedSchema_MapsOneOfsAndWellKnownTypes(t *testing.T) {
+	for _, name := range []string{"testprotos.AnotherTestMessage", "testprotos.TestWellKnownTypes"} {
+		md, err := desc.LoadMessageDescriptor(name)
+		testutil.Ok(t, err)
+		schema := (&Generator{}).Generate(md)
+		fb, _, err := (&Importer{Package: "testprotos"}).Import(schema)
+		testutil.Ok(t, err)
+		fd, err := fb.Build()
+		testutil.Ok(t, err)
+		imported := fd.FindMessage(md.GetFullyQualifiedName())
+		testutil.Require(t, imported != nil)
+
+		// JSON produced for the original message can be parsed using the
+		// imported message, since property names match
+		for _, fld := range md.GetFields() {
+			importedFld := imported.FindFieldByJSONName(fld.GetJSONName())
+			testutil.Require(t, importedFld != nil, "field %s not found", fld.GetName())
+			testutil.Eq(t, fld.IsMap(), importedFld.IsMap(), "field %s", fld.GetName())
+			testutil.Eq(t, fld.IsRepeated(), importedFld.IsRepeated(), "field %s", fld.GetName())
+			if fld.GetMessageType() != nil && !fld.IsMap() {
+				testutil.Eq(t, fld.GetMessageType().GetFullyQualifiedName(), importedFld.GetMessageType().GetFullyQualifiedName())
+			}
+			if fld.GetOneOf() != nil {
+				testutil.Require(t, importedFld.GetOneOf() != nil, "field %s should be in a oneof", fld.GetName())
+			}
+		}
+	}
+}
+
+func TestImport(t *testing.T) {
+	const schemaJSON = `{
+		"$schema": "https://json-schema.org/draft/2020-12/schema",
+		"title": "order",
+		"description": "An order.",
+		"type": "object",
+		"required": ["id", "items"],
+		"properties": {
+			"id": {"type": "string", "format": "uuid"},
+			"items": {"type": "array", "items": {"$ref": "#/$defs/LineItem"}},
+			"status": {"type": "string", "enum": ["pending", "shipped", "in-transit"]},
+			"placedAt": {"type": "string", "format": "date-time"},
+			"note": {"type": ["string", "null"], "description": "Optional note."},
+			"attributes": {"type": "object", "additionalProperties": {"type": "integer", "minimum": 0, "maximum": 100}},
+			"metadata": {"type": "object"},
+			"anything": {},
+			"matrix": {"type": "array", "items": {"type": "array", "items": {"type": "number"}}},
+			"payment": {"oneOf": [{"$ref": "#/$defs/Card"}, {"$ref": "#/$defs/BankAccount"}]},
+			"total": {"type": "integer"},
+			"shipTo": {
+				"type": "object",
+				"properties": {
+					"street": {"type": "string", "maxLength": 100},
+					"zip": {"type": "string", "pattern": "^[0-9]{5}$"}
+				}
+			},
+			"parent": {"$ref": "#/$defs/Order"}
+		},
+		"$defs": {
+			"LineItem": {
+				"type": "object",
+				"properties": {
+					"sku": {"type": "string"},
+					"quantity": {"type": "integer", "minimum": 1, "maximum": 1000},
+					"children": {"type": "array", "items": {"$ref": "#/$defs/LineItem"}}
+				},
+				"deprecated": true
+			},
+			"Card": {"type": "object", "properties": {"number": {"type": "string"}}},
+			"BankAccount": {"type": "object", "properties": {"iban": {"type": "string"}}},
+			"Order": {"type": "object", "properties": {"id": {"type": "string"}}}
+		}
+	}`
+	var schema Schema
+	err := json.Unmarshal([]byte(schemaJSON), &schema)
+	testutil.Ok(t, err)
+
+	fb, warnings, err := (&Importer{FileName: "order.proto", Package: "shop"}).Import(&schema)
+	testutil.Ok(t, err)
+	fd, err := fb.Build()
+	testutil.Ok(t, err)
+
+	order := fd.FindMessage("shop.Order2")
+	testutil.Require(t, order != nil)
+	testutil.Eq(t, " An order.\n", order.GetSourceInfo().GetLeadingComments())
+
+	fieldTypes := map[string]string{}
+	for _, fld := range order.GetFields() {
+		typ := strings.ToLower(strings.TrimPrefix(fld.GetType().String(), "TYPE_"))
+		switch {
+		case fld.IsMap():
+			typ = "map<" + fieldTypeName(fld.GetMapKeyType()) + ", " + fieldTypeName(fld.GetMapValueType()) + ">"
+		case fld.GetMessageType() != nil || fld.GetEnumType() != nil:
+			typ = fieldTypeName(fld)
+		}
+		if fld.IsRepeated() && !fld.IsMap() {
+			typ = "repeated " + typ
+		}
+		if fld.GetOneOf() != nil {
+			typ = fld.GetOneOf().GetName() + ":" + typ
+		}
+		fieldTypes[fld.GetName()] = typ
+	}
+	testutil.Eq(t, map[string]string{
+		"anything":             "google.protobuf.Value",
+		"attributes":           "map<string, int32>",
+		"id":                   "string",
+		"items":                "repeated shop.LineItem",
+		"matrix":               "repeated shop.Order2.MatrixValue",
+		"metadata":             "google.protobuf.Struct",
+		"note":                 "google.protobuf.StringValue",
+		"parent":               "shop.Order",
+		"payment_card":         "payment:shop.Card",
+		"payment_bank_account": "payment:shop.BankAccount",
+		"placed_at":            "google.protobuf.Timestamp",
+		"ship_to":              "shop.Order2.ShipTo",
+		"status":               "shop.Order2.Status",
+		"total":                "int64",
+	}, fieldTypes)
+
+	testutil.Eq(t, "placedAt", order.FindFieldByName("placed_at").GetJSONName())
+	testutil.Eq(t, " Optional note.\n", order.FindFieldByName("note").GetSourceInfo().GetLeadingComments())
+
+	status := order.GetNestedEnumTypes()[0]
+	var values []string
+	for _, vd := range status.GetValues() {
+		values = append(values, vd.GetName())
+	}
+	testutil.Eq(t, []string{"STATUS_UNSPECIFIED", "pending", "shipped", "IN_TRANSIT"}, values)
+
+	lineItem := fd.FindMessage("shop.LineItem")
+	testutil.Require(t, lineItem.GetMessageOptions().GetDeprecated())
+	testutil.Eq(t, lineItem, lineItem.FindFieldByName("children").GetMessageType())
+	testutil.Eq(t, descriptorpb.FieldDescriptorProto_TYPE_INT32, lineItem.FindFieldByName("quantity").GetType())
+
+	matrix := order.FindFieldByName("matrix").GetMessageType()
+	testutil.Require(t, matrix.FindFieldByName("value").IsRepeated())
+	testutil.Eq(t, descriptorpb.FieldDescriptorProto_TYPE_DOUBLE, matrix.FindFieldByName("value").GetType())
+
+	for _, w := range []struct{ path, msg string }{
+		{"#", "name Order is already used; renamed to Order2"},
+		{"#/required", "required properties are not enforced in proto3: id, items"},
+		{"#/properties/id", `constraints are not represented: format "uuid"`},
+		{"#/properties/status", `enum value "in-transit" is renamed to IN_TRANSIT`},
+		{"#/properties/status", "added value STATUS_UNSPECIFIED"},
+		{"#/properties/total", "64-bit integers are represented as strings in JSON"},
+		{"#/properties/matrix", "wrapped in message MatrixValue"},
+		{"#/properties/payment", "union represented as oneof payment"},
+		{"#/properties/shipTo/properties/street", "constraints are not represented: maxLength"},
+		{"#/properties/shipTo/properties/zip", "constraints are not represented: pattern"},
+		{"#/properties/attributes/additionalProperties", "constraints are not represented: minimum, maximum"},
+		{"#/$defs/LineItem/properties/quantity", "constraints are not represented: minimum, maximum"},
+	} {
+		testutil.Require(t, hasWarning(warnings, w.path, w.msg), "missing warning %s: %s\nwarnings: %v", w.path, w.msg, warnings)
+	}
+
+	// output is deterministic
+	for i := 0; i < 5; i++ {
+		fb2, warnings2, err := (&Importer{FileName: "order.proto", Package: "shop"}).Import(&schema)
+		testutil.Ok(t, err)
+		fd2, err := fb2.Build()
+		testutil.Ok(t, err)
+		testutil.Require(t, proto.Equal(fd.AsFileDescriptorProto(), fd2.AsFileDescriptorProto()))
+		testutil.Eq(t, len(warnings), len(warnings2))
+		for j := range warnings {
+			testutil.Eq(t, warnings[j], warnings2[j])
+		}
+	}
+
+	// JSON that matches the schema can be parsed with the imported message
+	msg := dynamic.NewMessage(order)
+	err = msg.UnmarshalJSON([]byte(`{
+		"id": "abc", "items": [{"sku": "x", "quantity": 2}], "status": "shipped", "note": null,
+		"placedAt": "2020-01-01T00:00:00Z", "attributes": {"a": 1}, "metadata": {"k": [1, 2]},
+		"anything": "foo", "shipTo": {"zip": "12345"}
+	}`))
+	testutil.Ok(t, err)
+	testutil.Eq(t, "abc", msg.GetFieldByName("id"))
+}
+
+func TestImportOpenAPINullableAndUnion(t *testing.T) {
+	const defsJSON = `{
+		"Pet": {
+			"oneOf": [{"$ref": "#/components/schemas/Cat"}, {"$ref": "#/components/schemas/Dog"}],
+			"description": "A pet."
+		},
+		"Cat": {"type": "object", "properties": {"lives": {"type": "integer", "format": "int32", "nullable": true}}},
+		"Dog": {"type": "object", "properties": {"breed": {"type": "string", "enum": ["LAB", "POODLE"], "nullable": true}}},
+		"Tags": {"type": "array", "items": {"type": "string"}},
+		"Owner": {"type": "object", "properties": {"pets": {"type": "array", "items": {"$ref": "#/components/schemas/Pet"}}, "tags": {"$ref": "#/components/schemas/Tags"}}}
+	}`
+	var defs map[string]*Schema
+	err := json.Unmarshal([]byte(defsJSON), &defs)
+	testutil.Ok(t, err)
+	fb, _, err := (&Importer{}).ImportDefinitions(defs, "#/components/schemas/")
+	testutil.Ok(t, err)
+	fd, err := fb.Build()
+	testutil.Ok(t, err)
+
+	pet := fd.FindMessage("Pet")
+	testutil.Eq(t, " A pet.\n", pet.GetSourceInfo().GetLeadingComments())
+	testutil.Eq(t, 1, len(pet.GetOneOfs()))
+	testutil.Eq(t, "value", pet.GetOneOfs()[0].GetName())
+	testutil.Eq(t, "Cat", pet.FindFieldByName("value_cat").GetMessageType().GetName())
+	testutil.Eq(t, "Dog", pet.FindFieldByName("value_dog").GetMessageType().GetName())
+
+	testutil.Eq(t, "google.protobuf.Int32Value", fd.FindMessage("Cat").FindFieldByName("lives").GetMessageType().GetFullyQualifiedName())
+	breed := fd.FindMessage("Dog").FindFieldByName("breed")
+	testutil.Require(t, breed.IsProto3Optional())
+	testutil.Eq(t, "Dog.Breed", breed.GetEnumType().GetFullyQualifiedName())
+
+	owner := fd.FindMessage("Owner")
+	testutil.Eq(t, "Pet", owner.FindFieldByName("pets").GetMessageType().GetName())
+	tags := owner.FindFieldByName("tags")
+	testutil.Require(t, tags.IsRepeated())
+	testutil.Eq(t, descriptorpb.FieldDescriptorProto_TYPE_STRING, tags.GetType())
+	// aliases don't create types
+	testutil.Require(t, fd.FindSymbol("Tags") == nil)
+}
+
+func TestImportNonObjectRoot(t *testing.T) {
+	var schema Schema
+	err := json.Unmarshal([]byte(`{"type": "array", "items": {"type": "string"}}`), &schema)
+	testutil.Ok(t, err)
+	fb, warnings, err := (&Importer{}).Import(&schema)
+	testutil.Ok(t, err)
+	fd, err := fb.Build()
+	testutil.Ok(t, err)
+	root := fd.FindMessage("Root")
+	testutil.Eq(t, 1, len(root.GetFields()))
+	value := root.GetFields()[0]
+	testutil.Eq(t, "value", value.GetName())
+	testutil.Require(t, value.IsRepeated())
+	testutil.Eq(t, descriptorpb.FieldDescriptorProto_TYPE_STRING, value.GetType())
+	testutil.Eq(t, []Warning{{Path: "#", Message: "root schema is not an object; represented as message Root with field value"}}, warnings)
+
+	schema = Schema{}
+	err = json.Unmarshal([]byte(`{"title": "color", "type": "string", "enum": ["red", "green"]}`), &schema)
+	testutil.Ok(t, err)
+	fb, _, err = (&Importer{}).Import(&schema)
+	testutil.Ok(t, err)
+	fd, err = fb.Build()
+	testutil.Ok(t, err)
+	value = fd.FindMessage("Color").FindFieldByName("value")
+	testutil.Eq(t, descriptorpb.FieldDescriptorProto_TYPE_ENUM, value.GetType())
+
+	// a root with just definitions is still an empty message
+	schema = Schema{}
+	err = json.Unmarshal([]byte(`{"$defs": {"Foo": {"type": "object", "properties": {"a": {"type": "string"}}}}}`), &schema)
+	testutil.Ok(t, err)
+	fb, warnings, err = (&Importer{}).Import(&schema)
+	testutil.Ok(t, err)
+	testutil.Eq(t, 0, len(warnings))
+	testutil.Eq(t, 0, len(fb.GetMessage("Root").GetChildren()))
+	testutil.Require(t, fb.GetMessage("Foo") != nil)
+}
+
+func TestImportErrors(t *testing.T) {
+	_, _, err := (&Importer{}).Import(&Schema{
+		Type:       Types{TypeObject},
+		Properties: map[string]*Schema{"foo": {Ref: "#/$defs/Foo"}},
+	})
+	testutil.Nok(t, err)
+	testutil.Eq(t, `#/properties/foo: unresolvable reference "#/$defs/Foo"`, err.Error())
+
+	_, _, err = (&Importer{}).Import(&Schema{Ref: "#/definitions/Foo"})
+	testutil.Nok(t, err)
+	testutil.Eq(t, `#: unresolvable reference "#/definitions/Foo"`, err.Error())
+}
+
+func TestNames(t *testing.T) {
+	testutil.Eq(t, "map_field1", snakeCase("mapField1"))
+	testutil.Eq(t, "placed_at", snakeCase("placed-at"))
+	testutil.Eq(t, "_1st", snakeCase("1st"))
+	testutil.Eq(t, "field", snakeCase("$$"))
+	testutil.Eq(t, "LineItem", camelCase("line_item"))
+	testutil.Eq(t, "FooBar", camelCase("foo.bar"))
+	testutil.Eq(t, "IN_TRANSIT", upperSnakeCase("in-transit"))
+	testutil.Eq(t, "mapField1", jsonName("map_field1"))
+}
+
+func hasWarning(warnings []Warning, path, msg string) bool {
+	for _, w := range warnings {
+		if w.Path == path && strings.Contains(w.Message, msg) {
+			return true
+		}
+	}
+	return false
+}
+
+func fieldTypeName(fld *desc.FieldDescriptor) string {
+	switch {
+	case fld.GetMessageType() != nil:
+		return fld.GetMessageType().GetFullyQualifiedName()
+	case fld.GetEnumType() != nil:
+		return fld.GetEnumType().GetFullyQualifiedName()
+	default:
+		return strings.ToLower(strings.TrimPrefix(fld.GetType().String(), "TYPE_"))
+	}
+}
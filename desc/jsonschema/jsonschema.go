@@ -0,0 +1,480 @@
+package jsonschema
+
+import (
+	"fmt"
+	"math"
+	"strings"
+
+	"google.golang.org/protobuf/types/descriptorpb"
+
+	"github.com/jhump/protoreflect/desc"
+)
+
+// Draft identifies a version of the JSON Schema specification.
+type Draft int
+
+const (
+	// Draft2020_12 is the 2020-12 version of JSON Schema. This is the default.
+	Draft2020_12 Draft = iota
+	// Draft07 is draft 7 of JSON Schema. This version is still widely used
+	// by validation libraries. Schemas for this draft put definitions in a
+	// "definitions" keyword instead of "$defs" and do not use the
+	// "deprecated" keyword.
+	Draft07
+)
+
+// URI returns the URI that identifies the draft, for use as the value of the
+// "$schema" keyword.
+func (d Draft) URI() string {
+	switch d {
+	case Draft07:
+		return "http://json-schema.org/draft-07/schema#"
+	default:
+		return "https://json-schema.org/draft/2020-12/schema"
+	}
+}
+
+func (d Draft) String() string {
+	switch d {
+	case Draft2020_12:
+		return "2020-12"
+	case Draft07:
+		return "draft-07"
+	default:
+		return fmt.Sprintf("Draft(%d)", int(d))
+	}
+}
+
+// Generator produces JSON Schemas from message descriptors. Its fields
+// control the format of the schema. Several of these correspond to fields of
+// the same name on jsonpb.Marshaler, which is what is used to configure the
+// JSON format produced by dynamic.Message. A generator's configuration should
+// match that of the marshaler that produces the JSON that will be validated.
+//
+// The zero value is a valid generator that describes the JSON format produced
+// by dynamic.Message.MarshalJSON, using JSON Schema 2020-12.
+type Generator struct {
+	// The version of JSON Schema to generate.
+	Draft Draft
+
+	// If true, properties are named using the original field names in the
+	// proto source instead of the lowerCamelCase JSON names.
+	OrigName bool
+
+	// If true, enum values are described as their numeric values instead of
+	// their names.
+	EnumsAsInts bool
+
+	// If true, all fields (other than those in a oneof) are required, since
+	// the JSON will include all fields, even those that are not present.
+	// Absent message fields are rendered as null, so message fields allow a
+	// null value.
+	EmitDefaults bool
+
+	// If true, objects that describe messages allow properties other than
+	// those that correspond to known fields. By default, unknown properties
+	// are not allowed, except for extensions (whose names are enclosed in
+	// brackets) in messages that have extension ranges.
+	AllowUnknownFields bool
+
+	// If true, descriptions are not generated from comments in the source
+	// info of descriptors.
+	OmitDescriptions bool
+}
+
+// Generate returns a JSON Schema that describes the JSON format of the given
+// message. The returned schema references a definition for the given message
+// and includes definitions for all message and enum types that it references,
+// transitively. Definitions are keyed by the fully-qualified name of the type.
+//
+// Recursive types are described using references to the definitions, so the
+// resulting schema is always finite.
+func (g *Generator) Generate(md *desc.MessageDescriptor) *Schema {
+	defs := g.NewDefinitions(g.defsPointer())
+	ref := defs.Ref(md)
+	ref.Schema = g.Draft.URI()
+	if g.Draft == Draft07 {
+		ref.Definitions = defs.Schemas
+	} else {
+		ref.Defs = defs.Schemas
+	}
+	return ref
+}
+
+func (g *Generator) defsPointer() string {
+	if g.Draft == Draft07 {
+		return "#/definitions/"
+	}
+	return "#/$defs/"
+}
+
+// Definitions is a collection of schemas for message and enum types. This is
+// used to generate schemas for several messages that share definitions, like
+// in the components of an OpenAPI document. Generator.Generate is simpler to
+// use when a schema is needed for just one message.
+type Definitions struct {
+	gen    *Generator
+	prefix string
+	// Schemas are the definitions, keyed by the fully-qualified name of the
+	// message or enum type that they describe.
+	Schemas map[string]*Schema
+}
+
+// NewDefinitions creates a new, empty collection of definitions. References
+// to definitions will be the given prefix followed by the fully-qualified
+// name of the type, so the prefix should be a URI that indicates where the
+// definitions will be stored, such as "#/$defs/".
+func (g *Generator) NewDefinitions(refPrefix string) *Definitions {
+	return &Definitions{gen: g, prefix: refPrefix, Schemas: map[string]*Schema{}}
+}
+
+// Ref returns a schema that references the definition for the given message,
+// adding the definition (and the definitions of all types it references) to
+// the collection if not already present.
+func (d *Definitions) Ref(md *desc.MessageDescriptor) *Schema {
+	name := md.GetFullyQualifiedName()
+	if _, ok := d.Schemas[name]; !ok {
+		// add a placeholder first, in case the message is recursive
+		d.Schemas[name] = nil
+		d.Schemas[name] = d.messageSchema(md)
+	}
+	return &Schema{Ref: d.prefix + name}
+}
+
+// Field returns a schema that describes the value of the given field. Any
+// message and enum types referenced by the field are added to the collection.
+func (d *Definitions) Field(fd *desc.FieldDescriptor) *Schema {
+	var s *Schema
+	switch {
+	case fd.IsMap():
+		s = d.mapSchema(fd)
+	case fd.IsRepeated():
+		s = &Schema{Type: Types{TypeArray}, Items: d.valueSchema(fd)}
+	default:
+		s = d.valueSchema(fd)
+	}
+	if d.gen.EmitDefaults && (fd.IsRepeated() || (fd.HasPresence() && !isWellKnownValue(fd.GetMessageType()))) {
+		// absent lists, maps, messages, and fields with presence may be
+		// rendered as null
+		s = nullable(s)
+	}
+	d.describe(s, fd)
+	if fd.GetFieldOptions().GetDeprecated() && d.gen.Draft != Draft07 {
+		s.Deprecated = true
+	}
+	return s
+}
+
+// PropertyName returns the name of the property for the given field in the
+// JSON format.
+func (g *Generator) PropertyName(fd *desc.FieldDescriptor) string {
+	name := fd.GetName()
+	if !g.OrigName {
+		name = fd.GetJSONName()
+	}
+	if fd.IsExtension() {
+		var scope string
+		switch parent := fd.GetParent().(type) {
+		case *desc.FileDescriptor:
+			scope = parent.GetPackage()
+		default:
+			scope = parent.GetFullyQualifiedName()
+		}
+		if scope == "" {
+			return fmt.Sprintf("[%s]", name)
+		}
+		return fmt.Sprintf("[%s.%s]", scope, name)
+	}
+	return name
+}
+
+func (d *Definitions) messageSchema(md *desc.MessageDescriptor) *Schema {
+	if s := d.wellKnownTypeSchema(md); s != nil {
+		d.describe(s, md)
+		return s
+	}
+
+	s := &Schema{
+		Type:       Types{TypeObject},
+		Title:      md.GetName(),
+		Properties: map[string]*Schema{},
+	}
+	d.describe(s, md)
+	if md.GetMessageOptions().GetDeprecated() && d.gen.Draft != Draft07 {
+		s.Deprecated = true
+	}
+	for _, fd := range md.GetFields() {
+		name := d.gen.PropertyName(fd)
+		s.Properties[name] = d.Field(fd)
+		if fd.IsRequired() || (d.gen.EmitDefaults && fd.GetOneOf() == nil) {
+			s.Required = append(s.Required, name)
+		}
+	}
+	if !d.gen.AllowUnknownFields {
+		s.AdditionalProperties = False()
+		if len(md.GetExtensionRanges()) > 0 {
+			s.PatternProperties = map[string]*Schema{`^\[.+\]$`: True()}
+		}
+	}
+
+	// at most one field of each oneof may be present
+	var oneOfs []*Schema
+	for _, ood := range md.GetOneOfs() {
+		if ood.IsSynthetic() {
+			continue
+		}
+		var choices []*Schema
+		for _, fd := range ood.GetChoices() {
+			choices = append(choices, &Schema{Required: []string{d.gen.PropertyName(fd)}})
+		}
+		oneOf := &Schema{
+			// exactly one of the choices, or none of them
+			OneOf: append(choices, &Schema{Not: &Schema{AnyOf: choices}}),
+		}
+		d.describe(oneOf, ood)
+		oneOfs = append(oneOfs, oneOf)
+	}
+	if len(oneOfs) == 1 {
+		s.OneOf = oneOfs[0].OneOf
+	} else if len(oneOfs) > 1 {
+		s.AllOf = oneOfs
+	}
+	return s
+}
+
+func (d *Definitions) enumRef(ed *desc.EnumDescriptor) *Schema {
+	if ed.GetFullyQualifiedName() == "google.protobuf.NullValue" {
+		return &Schema{Type: Types{TypeNull}}
+	}
+	name := ed.GetFullyQualifiedName()
+	if _, ok := d.Schemas[name]; !ok {
+		d.Schemas[name] = d.enumSchema(ed)
+	}
+	return &Schema{Ref: d.prefix + name}
+}
+
+func (d *Definitions) enumSchema(ed *desc.EnumDescriptor) *Schema {
+	s := &Schema{Title: ed.GetName()}
+	d.describe(s, ed)
+	if d.gen.EnumsAsInts {
+		s.Type = Types{TypeInteger}
+		seen := map[int32]struct{}{}
+		for _, vd := range ed.GetValues() {
+			if _, ok := seen[vd.GetNumber()]; ok {
+				// aliases
+				continue
+			}
+			seen[vd.GetNumber()] = struct{}{}
+			s.Enum = append(s.Enum, vd.GetNumber())
+		}
+		if !ed.IsClosed() {
+			// open enums can have any value
+			s.Enum = nil
+			s.Minimum, s.Maximum = float64Ptr(math.MinInt32), float64Ptr(math.MaxInt32)
+		}
+		return s
+	}
+	var names []interface{}
+	for _, vd := range ed.GetValues() {
+		names = append(names, vd.GetName())
+	}
+	if ed.IsClosed() {
+		s.Type = Types{TypeString}
+		s.Enum = names
+		return s
+	}
+	// unrecognized values of open enums are rendered as numbers
+	s.AnyOf = []*Schema{
+		{Type: Types{TypeString}, Enum: names},
+		int32Schema(),
+	}
+	return s
+}
+
+func (d *Definitions) mapSchema(fd *desc.FieldDescriptor) *Schema {
+	s := &Schema{
+		Type:                 Types{TypeObject},
+		AdditionalProperties: d.valueSchema(fd.GetMapValueType()),
+	}
+	switch fd.GetMapKeyType().GetType() {
+	case descriptorpb.FieldDescriptorProto_TYPE_BOOL:
+		s.PropertyNames = &Schema{Enum: []interface{}{"true", "false"}}
+	case descriptorpb.FieldDescriptorProto_TYPE_INT32,
+		descriptorpb.FieldDescriptorProto_TYPE_INT64,
+		descriptorpb.FieldDescriptorProto_TYPE_SINT32,
+		descriptorpb.FieldDescriptorProto_TYPE_SINT64,
+		descriptorpb.FieldDescriptorProto_TYPE_SFIXED32,
+		descriptorpb.FieldDescriptorProto_TYPE_SFIXED64:
+		s.PropertyNames = &Schema{Pattern: signedIntPattern}
+	case descriptorpb.FieldDescriptorProto_TYPE_UINT32,
+		descriptorpb.FieldDescriptorProto_TYPE_UINT64,
+		descriptorpb.FieldDescriptorProto_TYPE_FIXED32,
+		descriptorpb.FieldDescriptorProto_TYPE_FIXED64:
+		s.PropertyNames = &Schema{Pattern: unsignedIntPattern}
+	}
+	return s
+}
+
+const (
+	signedIntPattern   = `^-?[0-9]+$`
+	unsignedIntPattern = `^[0-9]+$`
+	durationPattern    = `^-?[0-9]+(\.[0-9]+)?s$`
+)
+
+// valueSchema returns the schema for a single value of the given field. For
+// repeated fields, this is the schema of an element.
+func (d *Definitions) valueSchema(fd *desc.FieldDescriptor) *Schema {
+	switch fd.GetType() {
+	case descriptorpb.FieldDescriptorProto_TYPE_INT32,
+		descriptorpb.FieldDescriptorProto_TYPE_SINT32,
+		descriptorpb.FieldDescriptorProto_TYPE_SFIXED32:
+		return int32Schema()
+	case descriptorpb.FieldDescriptorProto_TYPE_UINT32,
+		descriptorpb.FieldDescriptorProto_TYPE_FIXED32:
+		return uint32Schema()
+	case descriptorpb.FieldDescriptorProto_TYPE_INT64,
+		descriptorpb.FieldDescriptorProto_TYPE_SINT64,
+		descriptorpb.FieldDescriptorProto_TYPE_SFIXED64:
+		return int64Schema()
+	case descriptorpb.FieldDescriptorProto_TYPE_UINT64,
+		descriptorpb.FieldDescriptorProto_TYPE_FIXED64:
+		return uint64Schema()
+	case descriptorpb.FieldDescriptorProto_TYPE_FLOAT:
+		return floatSchema("float")
+	case descriptorpb.FieldDescriptorProto_TYPE_DOUBLE:
+		return floatSchema("double")
+	case descriptorpb.FieldDescriptorProto_TYPE_BOOL:
+		return &Schema{Type: Types{TypeBoolean}}
+	case descriptorpb.FieldDescriptorProto_TYPE_STRING:
+		return &Schema{Type: Types{TypeString}}
+	case descriptorpb.FieldDescriptorProto_TYPE_BYTES:
+		return bytesSchema()
+	case descriptorpb.FieldDescriptorProto_TYPE_ENUM:
+		return d.enumRef(fd.GetEnumType())
+	default:
+		return d.Ref(fd.GetMessageType())
+	}
+}
+
+func int32Schema() *Schema {
+	return &Schema{
+		Type:    Types{TypeInteger},
+		Format:  "int32",
+		Minimum: float64Ptr(math.MinInt32),
+		Maximum: float64Ptr(math.MaxInt32),
+	}
+}
+
+func uint32Schema() *Schema {
+	return &Schema{
+		Type:    Types{TypeInteger},
+		Format:  "uint32",
+		Minimum: float64Ptr(0),
+		Maximum: float64Ptr(math.MaxUint32),
+	}
+}
+
+func int64Schema() *Schema {
+	return &Schema{Type: Types{TypeString}, Format: "int64", Pattern: signedIntPattern}
+}
+
+func uint64Schema() *Schema {
+	return &Schema{Type: Types{TypeString}, Format: "uint64", Pattern: unsignedIntPattern}
+}
+
+func floatSchema(format string) *Schema {
+	return &Schema{
+		AnyOf: []*Schema{
+			{Type: Types{TypeNumber}, Format: format},
+			{Type: Types{TypeString}, Enum: []interface{}{"NaN", "Infinity", "-Infinity"}},
+		},
+	}
+}
+
+func bytesSchema() *Schema {
+	return &Schema{Type: Types{TypeString}, ContentEncoding: "base64"}
+}
+
+// wellKnownTypeSchema returns the schema for the given message if it is a
+// well-known type with a special JSON format. Otherwise, it returns nil. The
+// set of types here is the same as those with special handling in the dynamic
+// package.
+func (d *Definitions) wellKnownTypeSchema(md *desc.MessageDescriptor) *Schema {
+	switch md.GetFullyQualifiedName() {
+	case "google.protobuf.Any":
+		return &Schema{
+			Type:       Types{TypeObject},
+			Properties: map[string]*Schema{"@type": {Type: Types{TypeString}}},
+			Required:   []string{"@type"},
+		}
+	case "google.protobuf.Empty":
+		return &Schema{Type: Types{TypeObject}, AdditionalProperties: False()}
+	case "google.protobuf.Duration":
+		return &Schema{Type: Types{TypeString}, Format: "duration", Pattern: durationPattern}
+	case "google.protobuf.Timestamp":
+		return &Schema{Type: Types{TypeString}, Format: "date-time"}
+	case "google.protobuf.Struct":
+		return &Schema{Type: Types{TypeObject}}
+	case "google.protobuf.Value":
+		return True()
+	case "google.protobuf.ListValue":
+		return &Schema{Type: Types{TypeArray}}
+	case "google.protobuf.DoubleValue":
+		return floatSchema("double")
+	case "google.protobuf.FloatValue":
+		return floatSchema("float")
+	case "google.protobuf.Int64Value":
+		return int64Schema()
+	case "google.protobuf.UInt64Value":
+		return uint64Schema()
+	case "google.protobuf.Int32Value":
+		return int32Schema()
+	case "google.protobuf.UInt32Value":
+		return uint32Schema()
+	case "google.protobuf.BoolValue":
+		return &Schema{Type: Types{TypeBoolean}}
+	case "google.protobuf.StringValue":
+		return &Schema{Type: Types{TypeString}}
+	case "google.protobuf.BytesValue":
+		return bytesSchema()
+	default:
+		return nil
+	}
+}
+
+// isWellKnownValue returns true if the given message is google.protobuf.Value,
+// which already allows null.
+func isWellKnownValue(md *desc.MessageDescriptor) bool {
+	return md != nil && md.GetFullyQualifiedName() == "google.protobuf.Value"
+}
+
+func nullable(s *Schema) *Schema {
+	return &Schema{AnyOf: []*Schema{s, {Type: Types{TypeNull}}}}
+}
+
+func (d *Definitions) describe(s *Schema, dsc desc.Descriptor) {
+	if d.gen.OmitDescriptions || s.Bool != nil {
+		return
+	}
+	s.Description = Description(dsc)
+}
+
+// Description returns a description of the given element, computed from the
+// leading comments in its source info. If the element has no source info or
+// no leading comments, this returns the empty string.
+func Description(dsc desc.Descriptor) string {
+	comment := dsc.GetSourceInfo().GetLeadingComments()
+	if comment == "" {
+		return ""
+	}
+	lines := strings.Split(strings.TrimRight(comment, "\n"), "\n")
+	// remove the common leading space left from "// comment" style comments
+	for i, line := range lines {
+		lines[i] = strings.TrimPrefix(line, " ")
+	}
+	return strings.TrimSpace(strings.Join(lines, "\n"))
+}
+
+func float64Ptr(f float64) *float64 {
+	return &f
+}
@@ -0,0 +1,377 @@
+package jsonschema
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"regexp"
+	"strings"
+	"testing"
+
+	"github.com/golang/protobuf/jsonpb"
+	"github.com/golang/protobuf/proto"
+	"google.golang.org/protobuf/types/known/anypb"
+	"google.golang.org/protobuf/types/known/durationpb"
+	"google.golang.org/protobuf/types/known/structpb"
+	"google.golang.org/protobuf/types/known/timestamppb"
+	"google.golang.org/protobuf/types/known/wrapperspb"
+
+	"github.com/jhump/protoreflect/desc"
+	"github.com/jhump/protoreflect/dynamic"
+	"github.com/jhump/protoreflect/internal/testprotos"
+	"github.com/jhump/protoreflect/internal/testutil"
+)
+
+func TestGenerateValidatesMarshaledJSON(t *testing.T) {
+	anyVal, err := anypb.New(&testprotos.TestRequest{Bar: "abc"})
+	testutil.Ok(t, err)
+	msgs := []proto.Message{
+		&testprotos.UnaryFields{
+			I: proto.Int32(-123), J: proto.Int64(math.MinInt64), K: proto.Int32(-3), L: proto.Int64(-4),
+			M: proto.Uint32(math.MaxUint32), N: proto.Uint64(math.MaxUint64), O: proto.Uint32(7), P: proto.Uint64(8),
+			Q: proto.Int32(9), R: proto.Int64(10), S: proto.Float32(float32(math.Inf(1))), T: proto.Float64(math.NaN()),
+			U: []byte{1, 2, 3}, V: proto.String("foo"), W: proto.Bool(true),
+			X:      &testprotos.RepeatedFields{I: []int32{1, 2, 3}, J: []int64{4, 5}},
+			Groupy: &testprotos.UnaryFields_GroupY{Ya: proto.String("ya"), Yb: proto.Int32(1)},
+			Z:      testprotos.TestEnum_SECOND.Enum(),
+		},
+		&testprotos.AnotherTestMessage{
+			Dne:       testprotos.TestMessage_NestedMessage_AnotherNestedMessage_YetAnotherNestedMessage_VALUE2.Enum(),
+			MapField1: map[int32]string{-1: "a", 2: "b"},
+			MapField2: map[int64]float32{3: 1.5},
+			MapField3: map[uint32]bool{4: true},
+			MapField4: map[string]*testprotos.AnotherTestMessage{"x": {Atmoo: &testprotos.AnotherTestMessage_Int{Int: 42}}},
+			Atmoo:     &testprotos.AnotherTestMessage_Str{Str: "str"},
+		},
+		&testprotos.TestMessage{
+			Nm: &testprotos.TestMessage_NestedMessage{
+				Yanm: &testprotos.TestMessage_NestedMessage_AnotherNestedMessage_YetAnotherNestedMessage{
+					Tm: &testprotos.TestMessage{Ne: []testprotos.TestMessage_NestedEnum{testprotos.TestMessage_VALUE1}},
+				},
+			},
+		},
+		&testprotos.TestWellKnownTypes{
+			StartTime: timestamppb.Now(),
+			Elapsed:   durationpb.New(1500000000),
+			Dbl:       wrapperspb.Double(1.5),
+			Flt:       wrapperspb.Float(2.5),
+			Bl:        wrapperspb.Bool(true),
+			I32:       wrapperspb.Int32(-32),
+			I64:       wrapperspb.Int64(-64),
+			U32:       wrapperspb.UInt32(32),
+			U64:       wrapperspb.UInt64(64),
+			Str:       wrapperspb.String("str"),
+			Byt:       wrapperspb.Bytes([]byte("bytes")),
+			Json:      []*structpb.Value{structpb.NewNullValue(), structpb.NewStringValue("abc"), structpb.NewNumberValue(1)},
+			Extras:    []*anypb.Any{anyVal},
+		},
+		&testprotos.OneOfMessage{Value: &testprotos.OneOfMessage_MsgValue{
+			MsgValue: &testprotos.OneOfMessage{Value: &testprotos.OneOfMessage_Int64Value{Int64Value: 123}},
+		}},
+		&testprotos.OneOfMessage{},
+	}
+
+	generators := map[string]*Generator{
+		"default":        {},
+		"draft-07":       {Draft: Draft07},
+		"orig-name":      {OrigName: true},
+		"enums-as-ints":  {EnumsAsInts: true},
+		"emit-defaults":  {EmitDefaults: true},
+		"all-the-things": {Draft: Draft07, OrigName: true, EnumsAsInts: true, EmitDefaults: true},
+	}
+	for name, gen := range generators {
+		marshaler := &jsonpb.Marshaler{OrigName: gen.OrigName, EnumsAsInts: gen.EnumsAsInts, EmitDefaults: gen.EmitDefaults}
+		for _, msg := range msgs {
+			// round-trip through binary format so that nested messages are
+			// also dynamic messages
+			md, err := desc.LoadMessageDescriptorForMessage(msg)
+			testutil.Ok(t, err)
+			dm := dynamic.NewMessage(md)
+			b, err := proto.Marshal(msg)
+			testutil.Ok(t, err)
+			err = dm.Unmarshal(b)
+			testutil.Ok(t, err)
+			schema := gen.Generate(dm.GetMessageDescriptor())
+			js, err := dm.MarshalJSONPB(marshaler)
+			testutil.Ok(t, err)
+			var val interface{}
+			err = json.Unmarshal(js, &val)
+			testutil.Ok(t, err)
+			err = validate(schema, schema, val)
+			testutil.Ok(t, err, "%s: %s: JSON %s does not match schema", name, dm.GetMessageDescriptor().GetFullyQualifiedName(), js)
+
+			// make sure schema survives a round-trip through JSON
+			schemaJS, err := json.Marshal(schema)
+			testutil.Ok(t, err)
+			var roundTripped Schema
+			err = json.Unmarshal(schemaJS, &roundTripped)
+			testutil.Ok(t, err)
+			schemaJS2, err := json.Marshal(&roundTripped)
+			testutil.Ok(t, err)
+			testutil.Eq(t, string(schemaJS), string(schemaJS2))
+		}
+	}
+}
+
+func TestGenerateRejectsInvalidJSON(t *testing.T) {
+	testCases := []struct {
+		name string
+		msg  proto.Message
+		js   string
+	}{
+		{name: "int64 as number", msg: &testprotos.UnaryFields{}, js: `{"j": 123}`},
+		{name: "int32 out of range", msg: &testprotos.UnaryFields{}, js: `{"i": 3000000000}`},
+		{name: "uint32 negative", msg: &testprotos.UnaryFields{}, js: `{"m": -1}`},
+		{name: "unknown field", msg: &testprotos.UnaryFields{}, js: `{"foo": 123}`},
+		{name: "unknown enum", msg: &testprotos.UnaryFields{}, js: `{"z": "FOURTH"}`},
+		{name: "bad float string", msg: &testprotos.UnaryFields{}, js: `{"s": "abc"}`},
+		{name: "two oneof fields", msg: &testprotos.OneOfMessage{}, js: `{"stringValue": "abc", "intValue": 1}`},
+		{name: "bad map key", msg: &testprotos.AnotherTestMessage{}, js: `{"mapField1": {"abc": "def"}}`},
+		{name: "bad duration", msg: &testprotos.TestWellKnownTypes{}, js: `{"elapsed": "10m"}`},
+		{name: "any without type", msg: &testprotos.TestWellKnownTypes{}, js: `{"extras": [{"foo": "bar"}]}`},
+		{name: "nested bad value", msg: &testprotos.TestMessage{}, js: `{"nm": {"yanm": {"tm": {"ne": ["VALUE3"]}}}}`},
+	}
+	for _, tc := range testCases {
+		md, err := desc.LoadMessageDescriptorForMessage(tc.msg)
+		testutil.Ok(t, err)
+		schema := (&Generator{}).Generate(md)
+		var val interface{}
+		err = json.Unmarshal([]byte(tc.js), &val)
+		testutil.Ok(t, err)
+		err = validate(schema, schema, val)
+		testutil.Nok(t, err, "%s: expecting JSON %s to not match schema", tc.name, tc.js)
+	}
+}
+
+func TestGenerateSchemaShape(t *testing.T) {
+	md, err := desc.LoadMessageDescriptorForMessage((*testprotos.AnotherTestMessage)(nil))
+	testutil.Ok(t, err)
+	schema := (&Generator{}).Generate(md)
+	testutil.Eq(t, "https://json-schema.org/draft/2020-12/schema", schema.Schema)
+	testutil.Eq(t, "#/$defs/testprotos.AnotherTestMessage", schema.Ref)
+
+	def := schema.Defs["testprotos.AnotherTestMessage"]
+	testutil.Require(t, def != nil)
+	testutil.Eq(t, Types{TypeObject}, def.Type)
+	testutil.Eq(t, []string{"dne", "int", "mapField1", "mapField2", "mapField3", "mapField4", "rocknroll", "str", "withoptions"}, sortedKeys(def.Properties))
+	testutil.Eq(t, "#/$defs/testprotos.AnotherTestMessage", def.Properties["mapField4"].AdditionalProperties.Ref)
+	testutil.Require(t, def.Properties["withoptions"].Deprecated)
+	// oneof
+	testutil.Eq(t, 3, len(def.OneOf))
+	// extensions allowed
+	testutil.Require(t, def.PatternProperties != nil)
+	// recursive types use references
+	testutil.Eq(t, []string{
+		"testprotos.AnotherTestMessage",
+		"testprotos.AnotherTestMessage.RockNRoll",
+		"testprotos.AnotherTestMessage.WithOptions",
+		"testprotos.TestMessage.NestedMessage.AnotherNestedMessage.YetAnotherNestedMessage.DeeplyNestedEnum",
+	}, sortedKeys(schema.Defs))
+
+	enumDef := schema.Defs["testprotos.TestMessage.NestedMessage.AnotherNestedMessage.YetAnotherNestedMessage.DeeplyNestedEnum"]
+	testutil.Eq(t, []interface{}{"VALUE1", "VALUE2"}, enumDef.Enum)
+
+	schema = (&Generator{Draft: Draft07, OrigName: true}).Generate(md)
+	testutil.Eq(t, "#/definitions/testprotos.AnotherTestMessage", schema.Ref)
+	testutil.Require(t, schema.Defs == nil)
+	def = schema.Definitions["testprotos.AnotherTestMessage"]
+	testutil.Require(t, def.Properties["map_field1"] != nil)
+	testutil.Require(t, !def.Properties["withoptions"].Deprecated)
+}
+
+func TestGenerateDescriptions(t *testing.T) {
+	fd, err := desc.LoadFileDescriptor("desc_test_comments.proto")
+	testutil.Ok(t, err)
+	md := fd.GetMessageTypes()[0]
+	schema := (&Generator{}).Generate(md)
+	def := schema.Defs[md.GetFullyQualifiedName()]
+	testutil.Eq(t, Description(md), def.Description)
+	testutil.Require(t, def.Description != "")
+	testutil.Require(t, !strings.HasPrefix(def.Description, " "))
+
+	schema = (&Generator{OmitDescriptions: true}).Generate(md)
+	testutil.Eq(t, "", schema.Defs[md.GetFullyQualifiedName()].Description)
+}
+
+func TestSchemaExtraKeywords(t *testing.T) {
+	js := `{"type":"string","x-foo":{"bar":1}}`
+	var s Schema
+	err := json.Unmarshal([]byte(js), &s)
+	testutil.Ok(t, err)
+	testutil.Eq(t, Types{TypeString}, s.Type)
+	testutil.Eq(t, 1, len(s.Extra))
+	testutil.Eq(t, map[string]interface{}{"bar": float64(1)}, s.Extra["x-foo"])
+	b, err := json.Marshal(&s)
+	testutil.Ok(t, err)
+	testutil.Eq(t, js, string(b))
+}
+
+func sortedKeys(m map[string]*Schema) []string {
+	var keys []string
+	for k := range m {
+		keys = append(keys, k)
+	}
+	// use a simple insertion sort to avoid importing sort for one use
+	for i := 1; i < len(keys); i++ {
+		for j := i; j > 0 && keys[j] < keys[j-1]; j-- {
+			keys[j], keys[j-1] = keys[j-1], keys[j]
+		}
+	}
+	return keys
+}
+
+// validate is a minimal JSON Schema validator that supports the subset of
+// keywords produced by Generator.
+func validate(root, s *Schema, val interface{}) error {
+	if s == nil {
+		return fmt.Errorf("nil schema")
+	}
+	if s.Bool != nil {
+		if *s.Bool {
+			return nil
+		}
+		return fmt.Errorf("false schema does not allow %v", val)
+	}
+	if s.Ref != "" {
+		var defs map[string]*Schema
+		var name string
+		switch {
+		case strings.HasPrefix(s.Ref, "#/$defs/"):
+			defs, name = root.Defs, strings.TrimPrefix(s.Ref, "#/$defs/")
+		case strings.HasPrefix(s.Ref, "#/definitions/"):
+			defs, name = root.Definitions, strings.TrimPrefix(s.Ref, "#/definitions/")
+		default:
+			return fmt.Errorf("unsupported ref %q", s.Ref)
+		}
+		def := defs[name]
+		if def == nil {
+			return fmt.Errorf("unresolvable ref %q", s.Ref)
+		}
+		if err := validate(root, def, val); err != nil {
+			return err
+		}
+	}
+	if len(s.Type) > 0 && !s.Type.Has(jsonType(val)) && !(s.Type.Has(TypeNumber) && jsonType(val) == TypeInteger) {
+		return fmt.Errorf("expecting %v, got %v", s.Type, val)
+	}
+	if len(s.Enum) > 0 {
+		found := false
+		for _, e := range s.Enum {
+			if fmt.Sprint(e) == fmt.Sprint(val) {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return fmt.Errorf("%v is not one of %v", val, s.Enum)
+		}
+	}
+	if str, ok := val.(string); ok && s.Pattern != "" {
+		if !regexp.MustCompile(s.Pattern).MatchString(str) {
+			return fmt.Errorf("%q does not match %s", str, s.Pattern)
+		}
+	}
+	if num, ok := val.(float64); ok {
+		if s.Minimum != nil && num < *s.Minimum {
+			return fmt.Errorf("%v is less than %v", num, *s.Minimum)
+		}
+		if s.Maximum != nil && num > *s.Maximum {
+			return fmt.Errorf("%v is greater than %v", num, *s.Maximum)
+		}
+	}
+	if arr, ok := val.([]interface{}); ok && s.Items != nil {
+		for i, elem := range arr {
+			if err := validate(root, s.Items, elem); err != nil {
+				return fmt.Errorf("[%d]: %w", i, err)
+			}
+		}
+	}
+	if obj, ok := val.(map[string]interface{}); ok {
+		for _, req := range s.Required {
+			if _, ok := obj[req]; !ok {
+				return fmt.Errorf("missing required property %q", req)
+			}
+		}
+		for k, v := range obj {
+			if s.PropertyNames != nil {
+				if err := validate(root, s.PropertyNames, k); err != nil {
+					return fmt.Errorf("property name %q: %w", k, err)
+				}
+			}
+			matched := false
+			if ps, ok := s.Properties[k]; ok {
+				matched = true
+				if err := validate(root, ps, v); err != nil {
+					return fmt.Errorf("%s: %w", k, err)
+				}
+			}
+			for pattern, ps := range s.PatternProperties {
+				if regexp.MustCompile(pattern).MatchString(k) {
+					matched = true
+					if err := validate(root, ps, v); err != nil {
+						return fmt.Errorf("%s: %w", k, err)
+					}
+				}
+			}
+			if !matched && s.AdditionalProperties != nil {
+				if err := validate(root, s.AdditionalProperties, v); err != nil {
+					return fmt.Errorf("%s: %w", k, err)
+				}
+			}
+		}
+	}
+	for _, sub := range s.AllOf {
+		if err := validate(root, sub, val); err != nil {
+			return err
+		}
+	}
+	if len(s.AnyOf) > 0 {
+		var errs []string
+		for _, sub := range s.AnyOf {
+			err := validate(root, sub, val)
+			if err == nil {
+				errs = nil
+				break
+			}
+			errs = append(errs, err.Error())
+		}
+		if len(errs) > 0 {
+			return fmt.Errorf("%v matches none of anyOf: %s", val, strings.Join(errs, "; "))
+		}
+	}
+	if len(s.OneOf) > 0 {
+		count := 0
+		for _, sub := range s.OneOf {
+			if validate(root, sub, val) == nil {
+				count++
+			}
+		}
+		if count != 1 {
+			return fmt.Errorf("%v matches %d of oneOf", val, count)
+		}
+	}
+	if s.Not != nil && validate(root, s.Not, val) == nil {
+		return fmt.Errorf("%v matches not", val)
+	}
+	return nil
+}
+
+func jsonType(val interface{}) string {
+	switch val := val.(type) {
+	case nil:
+		return TypeNull
+	case bool:
+		return TypeBoolean
+	case string:
+		return TypeString
+	case float64:
+		if val == math.Trunc(val) {
+			return TypeInteger
+		}
+		return TypeNumber
+	case []interface{}:
+		return TypeArray
+	default:
+		return TypeObject
+	}
+}
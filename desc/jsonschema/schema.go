@@ -0,0 +1,199 @@
+package jsonschema
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+)
+
+// Schema is a JSON Schema. This models the subset of JSON Schema vocabulary
+// that is needed to describe the JSON format of protobuf messages. It can be
+// marshaled to and from JSON using the encoding/json package.
+//
+// A schema can also be a boolean: the schema "true" accepts any value, and
+// the schema "false" accepts none. Boolean schemas are created via True and
+// False and are indicated by a non-nil Bool field.
+type Schema struct {
+	// If non-nil, this schema is a boolean schema and all other fields are
+	// ignored.
+	Bool *bool `json:"-"`
+
+	Schema      string             `json:"$schema,omitempty"`
+	ID          string             `json:"$id,omitempty"`
+	Ref         string             `json:"$ref,omitempty"`
+	Defs        map[string]*Schema `json:"$defs,omitempty"`
+	Definitions map[string]*Schema `json:"definitions,omitempty"`
+
+	Title       string        `json:"title,omitempty"`
+	Description string        `json:"description,omitempty"`
+	Deprecated  bool          `json:"deprecated,omitempty"`
+	Default     interface{}   `json:"default,omitempty"`
+	Examples    []interface{} `json:"examples,omitempty"`
+
+	Type            Types         `json:"type,omitempty"`
+	Format          string        `json:"format,omitempty"`
+	Enum            []interface{} `json:"enum,omitempty"`
+	Const           interface{}   `json:"const,omitempty"`
+	Pattern         string        `json:"pattern,omitempty"`
+	ContentEncoding string        `json:"contentEncoding,omitempty"`
+	Minimum         *float64      `json:"minimum,omitempty"`
+	Maximum         *float64      `json:"maximum,omitempty"`
+	MinLength       *int          `json:"minLength,omitempty"`
+	MaxLength       *int          `json:"maxLength,omitempty"`
+
+	Items    *Schema `json:"items,omitempty"`
+	MinItems *int    `json:"minItems,omitempty"`
+	MaxItems *int    `json:"maxItems,omitempty"`
+
+	Properties           map[string]*Schema `json:"properties,omitempty"`
+	PatternProperties    map[string]*Schema `json:"patternProperties,omitempty"`
+	AdditionalProperties *Schema            `json:"additionalProperties,omitempty"`
+	PropertyNames        *Schema            `json:"propertyNames,omitempty"`
+	Required             []string           `json:"required,omitempty"`
+
+	AllOf []*Schema `json:"allOf,omitempty"`
+	AnyOf []*Schema `json:"anyOf,omitempty"`
+	OneOf []*Schema `json:"oneOf,omitempty"`
+	Not   *Schema   `json:"not,omitempty"`
+
+	// Extra holds any other keywords, such as vendor extensions. When
+	// marshaled, these are included alongside the other keywords.
+	Extra map[string]interface{} `json:"-"`
+}
+
+// True returns a boolean schema that accepts any value.
+func True() *Schema {
+	b := true
+	return &Schema{Bool: &b}
+}
+
+// False returns a boolean schema that accepts no values.
+func False() *Schema {
+	b := false
+	return &Schema{Bool: &b}
+}
+
+// schemaFields is used to marshal and unmarshal a schema without recursing
+// back into its MarshalJSON and UnmarshalJSON methods.
+type schemaFields Schema
+
+// MarshalJSON implements json.Marshaler.
+func (s *Schema) MarshalJSON() ([]byte, error) {
+	if s.Bool != nil {
+		return json.Marshal(*s.Bool)
+	}
+	b, err := json.Marshal((*schemaFields)(s))
+	if err != nil || len(s.Extra) == 0 {
+		return b, err
+	}
+	extra, err := json.Marshal(s.Extra)
+	if err != nil {
+		return nil, err
+	}
+	if len(b) == 2 {
+		// no other keywords
+		return extra, nil
+	}
+	// splice extra keywords into the end of the object
+	var buf bytes.Buffer
+	buf.Write(b[:len(b)-1])
+	buf.WriteByte(',')
+	buf.Write(extra[1:])
+	return buf.Bytes(), nil
+}
+
+// UnmarshalJSON implements json.Unmarshaler. Keywords that are not modeled by
+// Schema are stored in Extra.
+func (s *Schema) UnmarshalJSON(data []byte) error {
+	data = bytes.TrimSpace(data)
+	switch string(data) {
+	case "true":
+		*s = *True()
+		return nil
+	case "false":
+		*s = *False()
+		return nil
+	}
+	var fields schemaFields
+	if err := json.Unmarshal(data, &fields); err != nil {
+		return err
+	}
+	var all map[string]json.RawMessage
+	if err := json.Unmarshal(data, &all); err != nil {
+		return err
+	}
+	for k, v := range all {
+		if _, ok := knownKeywords[k]; ok {
+			continue
+		}
+		if fields.Extra == nil {
+			fields.Extra = map[string]interface{}{}
+		}
+		var val interface{}
+		if err := json.Unmarshal(v, &val); err != nil {
+			return err
+		}
+		fields.Extra[k] = val
+	}
+	*s = Schema(fields)
+	return nil
+}
+
+// knownKeywords are the keywords that correspond to fields of Schema.
+var knownKeywords = map[string]struct{}{
+	"$schema": {}, "$id": {}, "$ref": {}, "$defs": {}, "definitions": {},
+	"title": {}, "description": {}, "deprecated": {}, "default": {}, "examples": {},
+	"type": {}, "format": {}, "enum": {}, "const": {}, "pattern": {}, "contentEncoding": {},
+	"minimum": {}, "maximum": {}, "minLength": {}, "maxLength": {},
+	"items": {}, "minItems": {}, "maxItems": {},
+	"properties": {}, "patternProperties": {}, "additionalProperties": {}, "propertyNames": {}, "required": {},
+	"allOf": {}, "anyOf": {}, "oneOf": {}, "not": {},
+}
+
+// Types is the set of JSON types allowed by a schema. When marshaled, a
+// single type is represented as a string; otherwise it is an array.
+type Types []string
+
+// Names of JSON types, for use with Types.
+const (
+	TypeNull    = "null"
+	TypeBoolean = "boolean"
+	TypeObject  = "object"
+	TypeArray   = "array"
+	TypeNumber  = "number"
+	TypeString  = "string"
+	TypeInteger = "integer"
+)
+
+// MarshalJSON implements json.Marshaler.
+func (t Types) MarshalJSON() ([]byte, error) {
+	if len(t) == 1 {
+		return json.Marshal(t[0])
+	}
+	return json.Marshal([]string(t))
+}
+
+// UnmarshalJSON implements json.Unmarshaler.
+func (t *Types) UnmarshalJSON(data []byte) error {
+	var single string
+	if err := json.Unmarshal(data, &single); err == nil {
+		*t = Types{single}
+		return nil
+	}
+	var multiple []string
+	if err := json.Unmarshal(data, &multiple); err != nil {
+		return fmt.Errorf("type must be a string or array of strings: %w", err)
+	}
+	*t = multiple
+	return nil
+}
+
+// Has returns true if the given type is in the set.
+func (t Types) Has(typ string) bool {
+	for _, tt := range t {
+		if tt == typ {
+			return true
+		}
+	}
+	return false
+}
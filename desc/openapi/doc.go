@@ -0,0 +1,20 @@
+// Package openapi provides a mechanism to generate OpenAPI documents from
+// service descriptors.
+//
+// Methods are mapped to HTTP operations using google.api.http annotations, as
+// described in google/api/http.proto and as implemented by transcoding proxies
+// such as grpc-gateway and Envoy. Methods that have no such annotation get a
+// default mapping, which can be configured. Request and response messages are
+// described using JSON Schema, generated by the jsonschema package, and the
+// comments in the source info of services, methods, messages, and fields are
+// used as descriptions.
+//
+// Since this works with descriptors, it can document services that are only
+// known at runtime, such as those discovered with the grpcreflect package.
+//
+// The Import function goes in the other direction, converting the schemas in
+// an OpenAPI document into message and enum definitions.
+//
+// Generated documents use version 3.1 of the OpenAPI specification, whose
+// schema objects are a superset of JSON Schema 2020-12.
+package openapi
@@ -0,0 +1,133 @@
+package openapi
+
+import (
+	"github.com/jhump/protoreflect/desc/jsonschema"
+)
+
+// Version is the version of the OpenAPI specification used by generated
+// documents.
+const Version = "3.1.0"
+
+// Document is an OpenAPI document. This models the subset of the OpenAPI
+// specification that is needed to describe services. It can be marshaled to
+// JSON using the encoding/json package.
+type Document struct {
+	OpenAPI    string               `json:"openapi"`
+	Info       Info                 `json:"info"`
+	Servers    []*Server            `json:"servers,omitempty"`
+	Tags       []*Tag               `json:"tags,omitempty"`
+	Paths      map[string]*PathItem `json:"paths"`
+	Components *Components          `json:"components,omitempty"`
+}
+
+// Info provides metadata about the API.
+type Info struct {
+	Title       string `json:"title"`
+	Description string `json:"description,omitempty"`
+	Version     string `json:"version"`
+}
+
+// Server describes a server that hosts the API.
+type Server struct {
+	URL         string `json:"url"`
+	Description string `json:"description,omitempty"`
+}
+
+// Tag is used to group operations. Generated documents have a tag for each
+// service, and each operation is tagged with the service that defines it.
+type Tag struct {
+	Name        string `json:"name"`
+	Description string `json:"description,omitempty"`
+}
+
+// PathItem describes the operations available on a single path.
+type PathItem struct {
+	Get     *Operation `json:"get,omitempty"`
+	Put     *Operation `json:"put,omitempty"`
+	Post    *Operation `json:"post,omitempty"`
+	Delete  *Operation `json:"delete,omitempty"`
+	Options *Operation `json:"options,omitempty"`
+	Head    *Operation `json:"head,omitempty"`
+	Patch   *Operation `json:"patch,omitempty"`
+	Trace   *Operation `json:"trace,omitempty"`
+}
+
+// operation returns a pointer to the field of the path item that holds the
+// operation for the given HTTP method, which must be lower-case. It returns
+// nil if the method is not supported by OpenAPI.
+func (p *PathItem) operation(method string) **Operation {
+	switch method {
+	case "get":
+		return &p.Get
+	case "put":
+		return &p.Put
+	case "post":
+		return &p.Post
+	case "delete":
+		return &p.Delete
+	case "options":
+		return &p.Options
+	case "head":
+		return &p.Head
+	case "patch":
+		return &p.Patch
+	case "trace":
+		return &p.Trace
+	default:
+		return nil
+	}
+}
+
+// Operation describes a single API operation on a path. Each operation
+// corresponds to an RPC method.
+type Operation struct {
+	Tags        []string             `json:"tags,omitempty"`
+	Summary     string               `json:"summary,omitempty"`
+	Description string               `json:"description,omitempty"`
+	OperationID string               `json:"operationId,omitempty"`
+	Parameters  []*Parameter         `json:"parameters,omitempty"`
+	RequestBody *RequestBody         `json:"requestBody,omitempty"`
+	Responses   map[string]*Response `json:"responses"`
+	Deprecated  bool                 `json:"deprecated,omitempty"`
+}
+
+// Locations of parameters, for use with Parameter.In.
+const (
+	InPath  = "path"
+	InQuery = "query"
+)
+
+// Parameter describes a single operation parameter.
+type Parameter struct {
+	Name        string             `json:"name"`
+	In          string             `json:"in"`
+	Description string             `json:"description,omitempty"`
+	Required    bool               `json:"required,omitempty"`
+	Deprecated  bool               `json:"deprecated,omitempty"`
+	Schema      *jsonschema.Schema `json:"schema,omitempty"`
+}
+
+// RequestBody describes the body of a request.
+type RequestBody struct {
+	Description string                `json:"description,omitempty"`
+	Content     map[string]*MediaType `json:"content"`
+	Required    bool                  `json:"required,omitempty"`
+}
+
+// Response describes a single response from an operation.
+type Response struct {
+	Description string                `json:"description"`
+	Content     map[string]*MediaType `json:"content,omitempty"`
+}
+
+// MediaType describes the content of a request or response body for a
+// particular media type.
+type MediaType struct {
+	Schema *jsonschema.Schema `json:"schema,omitempty"`
+}
+
+// Components holds reusable objects. Generated documents store the schemas for
+// all referenced message and enum types here, keyed by fully-qualified name.
+type Components struct {
+	Schemas map[string]*jsonschema.Schema `json:"schemas,omitempty"`
+}
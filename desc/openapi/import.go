@@ -0,0 +1,21 @@
+package openapi
+
+import (
+	"github.com/jhump/protoreflect/desc/builder"
+	"github.com/jhump/protoreflect/desc/jsonschema"
+)
+
+// Import converts the schemas in the components section of the given document
+// into messages and enums in a new file, using the given importer. This can
+// be used with documents that use either OpenAPI 3.1 or 3.0, since the
+// "nullable" keyword from 3.0 is understood by the importer.
+//
+// Operations in the document are not converted. The returned warnings
+// describe lossy mappings; see jsonschema.Importer for more details.
+func Import(doc *Document, imp *jsonschema.Importer) (*builder.FileBuilder, []jsonschema.Warning, error) {
+	var schemas map[string]*jsonschema.Schema
+	if doc.Components != nil {
+		schemas = doc.Components.Schemas
+	}
+	return imp.ImportDefinitions(schemas, "#/components/schemas/")
+}
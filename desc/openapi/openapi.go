@@ -0,0 +1,415 @@
+package openapi
+
+import (
+	"fmt"
+	"strings"
+
+	"google.golang.org/genproto/googleapis/api/annotations"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protoregistry"
+	"google.golang.org/protobuf/types/descriptorpb"
+
+	"github.com/jhump/protoreflect/desc"
+	"github.com/jhump/protoreflect/desc/jsonschema"
+)
+
+// Generator produces OpenAPI documents from service descriptors.
+//
+// The zero value is a valid generator. It maps each unary method that has no
+// google.api.http annotation to a POST request, using the same path as gRPC
+// (see PostMapping).
+type Generator struct {
+	// Metadata about the API. If the title is empty, the names of the
+	// services are used. If the version is empty, "0.0.0" is used. If the
+	// description is empty and there is just one service, the service's
+	// comments are used.
+	Info Info
+
+	// The servers that host the API.
+	Servers []*Server
+
+	// Returns the HTTP rule used for methods that have no google.api.http
+	// annotation. If it returns nil, the method is omitted from the document.
+	// If this field is nil, PostMapping is used.
+	DefaultMapping func(*desc.MethodDescriptor) *annotations.HttpRule
+
+	// If non-nil, every operation has a default response whose body is this
+	// type of message. Transcoding proxies typically respond to failed RPCs
+	// with a google.rpc.Status message.
+	ErrorType *desc.MessageDescriptor
+
+	// Controls the schemas generated for messages. Since OpenAPI 3.1 uses
+	// JSON Schema 2020-12, the Draft field is ignored. The OmitDescriptions
+	// field also controls descriptions of services and methods.
+	Schema jsonschema.Generator
+}
+
+// PostMapping is the default mapping for methods that have no HTTP rule. It
+// maps the method to a POST request whose body is the entire request message.
+// The path is the same as the path used in gRPC requests:
+// "/<service fully-qualified name>/<method name>".
+func PostMapping(mtd *desc.MethodDescriptor) *annotations.HttpRule {
+	return &annotations.HttpRule{
+		Pattern: &annotations.HttpRule_Post{
+			Post: "/" + mtd.GetService().GetFullyQualifiedName() + "/" + mtd.GetName(),
+		},
+		Body: "*",
+	}
+}
+
+// NoMapping can be used as the default mapping to omit methods that have no
+// HTTP rule from generated documents.
+func NoMapping(*desc.MethodDescriptor) *annotations.HttpRule {
+	return nil
+}
+
+// HTTPRule returns the google.api.http annotation for the given method, or
+// nil if it has none.
+//
+// This also recognizes the annotation if it is present in the method options
+// as an unrecognized field, which is the case when the options were parsed
+// before the google.api.http extension was registered.
+func HTTPRule(mtd *desc.MethodDescriptor) (*annotations.HttpRule, error) {
+	opts := mtd.GetMethodOptions()
+	if opts == nil {
+		return nil, nil
+	}
+	if !proto.HasExtension(opts, annotations.E_Http) {
+		unk := opts.ProtoReflect().GetUnknown()
+		if len(unk) == 0 {
+			return nil, nil
+		}
+		var reparsed descriptorpb.MethodOptions
+		if err := (proto.UnmarshalOptions{Resolver: protoregistry.GlobalTypes}).Unmarshal(unk, &reparsed); err != nil {
+			return nil, err
+		}
+		if !proto.HasExtension(&reparsed, annotations.E_Http) {
+			return nil, nil
+		}
+		opts = &reparsed
+	}
+	return proto.GetExtension(opts, annotations.E_Http).(*annotations.HttpRule), nil
+}
+
+// Generate returns an OpenAPI document that describes the given services.
+//
+// Streaming methods are omitted since they cannot be described as a single
+// HTTP request and response. An error is returned if an HTTP rule is invalid,
+// such as if its path template is malformed or refers to fields that do not
+// exist, or if two methods map to the same path and HTTP method.
+func (g *Generator) Generate(sds ...*desc.ServiceDescriptor) (*Document, error) {
+	schemaGen := g.Schema
+	schemaGen.Draft = jsonschema.Draft2020_12
+	st := &state{
+		gen:          g,
+		defs:         schemaGen.NewDefinitions("#/components/schemas/"),
+		paths:        map[string]*PathItem{},
+		operationIDs: map[string]struct{}{},
+	}
+
+	doc := &Document{
+		OpenAPI: Version,
+		Info:    g.Info,
+		Servers: g.Servers,
+		Paths:   st.paths,
+	}
+	var names []string
+	for _, sd := range sds {
+		names = append(names, sd.GetFullyQualifiedName())
+		doc.Tags = append(doc.Tags, &Tag{Name: sd.GetName(), Description: st.description(sd)})
+		for _, mtd := range sd.GetMethods() {
+			if err := st.addMethod(mtd); err != nil {
+				return nil, err
+			}
+		}
+	}
+	if doc.Info.Title == "" {
+		doc.Info.Title = strings.Join(names, ", ")
+	}
+	if doc.Info.Version == "" {
+		doc.Info.Version = "0.0.0"
+	}
+	if doc.Info.Description == "" && len(sds) == 1 {
+		doc.Info.Description = st.description(sds[0])
+	}
+	if len(st.defs.Schemas) > 0 {
+		doc.Components = &Components{Schemas: st.defs.Schemas}
+	}
+	return doc, nil
+}
+
+type state struct {
+	gen          *Generator
+	defs         *jsonschema.Definitions
+	paths        map[string]*PathItem
+	operationIDs map[string]struct{}
+}
+
+func (st *state) description(dsc desc.Descriptor) string {
+	if st.gen.Schema.OmitDescriptions {
+		return ""
+	}
+	return jsonschema.Description(dsc)
+}
+
+func (st *state) addMethod(mtd *desc.MethodDescriptor) error {
+	if mtd.IsClientStreaming() || mtd.IsServerStreaming() {
+		return nil
+	}
+	rule, err := HTTPRule(mtd)
+	if err != nil {
+		return fmt.Errorf("method %s: failed to parse google.api.http option: %w", mtd.GetFullyQualifiedName(), err)
+	}
+	if rule == nil {
+		mapping := st.gen.DefaultMapping
+		if mapping == nil {
+			mapping = PostMapping
+		}
+		rule = mapping(mtd)
+		if rule == nil {
+			return nil
+		}
+	}
+	if err := st.addOperation(mtd, rule); err != nil {
+		return err
+	}
+	for _, binding := range rule.GetAdditionalBindings() {
+		if len(binding.GetAdditionalBindings()) > 0 {
+			return fmt.Errorf("method %s: additional bindings must not themselves have additional bindings", mtd.GetFullyQualifiedName())
+		}
+		if err := st.addOperation(mtd, binding); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (st *state) addOperation(mtd *desc.MethodDescriptor, rule *annotations.HttpRule) error {
+	method, tmpl, err := methodAndPath(rule)
+	if err == nil {
+		err = st.doAddOperation(mtd, rule, method, tmpl)
+	}
+	if err != nil {
+		return fmt.Errorf("method %s: %w", mtd.GetFullyQualifiedName(), err)
+	}
+	return nil
+}
+
+func (st *state) doAddOperation(mtd *desc.MethodDescriptor, rule *annotations.HttpRule, method, tmpl string) error {
+	pt, err := parsePathTemplate(tmpl)
+	if err != nil {
+		return err
+	}
+	item := st.paths[pt.path]
+	if item == nil {
+		item = &PathItem{}
+		st.paths[pt.path] = item
+	}
+	slot := item.operation(method)
+	if slot == nil {
+		return fmt.Errorf("HTTP method %q is not supported by OpenAPI", method)
+	}
+	if *slot != nil {
+		return fmt.Errorf("%s %s is already used by operation %s", strings.ToUpper(method), tmpl, (*slot).OperationID)
+	}
+
+	input := mtd.GetInputType()
+	op := &Operation{
+		Tags:        []string{mtd.GetService().GetName()},
+		Description: st.description(mtd),
+		OperationID: st.operationID(mtd),
+		Deprecated:  mtd.GetMethodOptions().GetDeprecated(),
+		Responses:   map[string]*Response{},
+	}
+
+	// fields bound to the path or body are excluded from query parameters
+	exclude := map[string]struct{}{}
+	for _, v := range pt.vars {
+		fd, err := findField(input, v.fieldPath)
+		if err != nil {
+			return fmt.Errorf("path template %q: %w", tmpl, err)
+		}
+		if fd.IsRepeated() || fd.GetMessageType() != nil {
+			return fmt.Errorf("path template %q: field %s must be a singular scalar or enum", tmpl, v.fieldPath)
+		}
+		exclude[v.fieldPath] = struct{}{}
+		param := &Parameter{
+			Name:        v.fieldPath,
+			In:          InPath,
+			Description: st.description(fd),
+			Required:    true,
+			Deprecated:  fd.GetFieldOptions().GetDeprecated(),
+		}
+		if v.pattern != "" {
+			param.Schema = &jsonschema.Schema{Type: jsonschema.Types{jsonschema.TypeString}, Pattern: v.pattern}
+		} else {
+			param.Schema = st.defs.Field(fd)
+			param.Schema.Description = ""
+		}
+		op.Parameters = append(op.Parameters, param)
+	}
+
+	switch body := rule.GetBody(); body {
+	case "":
+		op.Parameters = append(op.Parameters, st.queryParams(input, "", "", exclude, map[string]struct{}{})...)
+	case "*":
+		op.RequestBody = &RequestBody{
+			Description: st.description(input),
+			Content:     jsonContent(st.defs.Ref(input)),
+			Required:    true,
+		}
+	default:
+		fd := input.FindFieldByName(body)
+		if fd == nil {
+			return fmt.Errorf("body field %q does not exist in %s", body, input.GetFullyQualifiedName())
+		}
+		exclude[body] = struct{}{}
+		op.RequestBody = &RequestBody{
+			Description: st.description(fd),
+			Content:     jsonContent(st.defs.Field(fd)),
+			Required:    true,
+		}
+		op.Parameters = append(op.Parameters, st.queryParams(input, "", "", exclude, map[string]struct{}{})...)
+	}
+
+	output := mtd.GetOutputType()
+	resp := &Response{Description: st.description(output)}
+	if respBody := rule.GetResponseBody(); respBody != "" {
+		fd := output.FindFieldByName(respBody)
+		if fd == nil {
+			return fmt.Errorf("response body field %q does not exist in %s", respBody, output.GetFullyQualifiedName())
+		}
+		resp.Description = st.description(fd)
+		resp.Content = jsonContent(st.defs.Field(fd))
+	} else {
+		resp.Content = jsonContent(st.defs.Ref(output))
+	}
+	if resp.Description == "" {
+		// description is required in responses
+		resp.Description = "A successful response."
+	}
+	op.Responses["200"] = resp
+	if st.gen.ErrorType != nil {
+		op.Responses["default"] = &Response{
+			Description: "An unexpected error response.",
+			Content:     jsonContent(st.defs.Ref(st.gen.ErrorType)),
+		}
+	}
+
+	*slot = op
+	return nil
+}
+
+func methodAndPath(rule *annotations.HttpRule) (method, path string, err error) {
+	switch pattern := rule.GetPattern().(type) {
+	case *annotations.HttpRule_Get:
+		return "get", pattern.Get, nil
+	case *annotations.HttpRule_Put:
+		return "put", pattern.Put, nil
+	case *annotations.HttpRule_Post:
+		return "post", pattern.Post, nil
+	case *annotations.HttpRule_Delete:
+		return "delete", pattern.Delete, nil
+	case *annotations.HttpRule_Patch:
+		return "patch", pattern.Patch, nil
+	case *annotations.HttpRule_Custom:
+		return strings.ToLower(pattern.Custom.GetKind()), pattern.Custom.GetPath(), nil
+	default:
+		return "", "", fmt.Errorf("HTTP rule has no pattern")
+	}
+}
+
+// operationID returns a unique ID for an operation for the given method. The
+// first operation for a method is named "<service>_<method>". Subsequent ones,
+// from additional bindings, have a numeric suffix.
+func (st *state) operationID(mtd *desc.MethodDescriptor) string {
+	base := mtd.GetService().GetName() + "_" + mtd.GetName()
+	id := base
+	for i := 2; ; i++ {
+		if _, ok := st.operationIDs[id]; !ok {
+			break
+		}
+		id = fmt.Sprintf("%s%d", base, i)
+	}
+	st.operationIDs[id] = struct{}{}
+	return id
+}
+
+// queryParams returns query parameters for the fields of the given message.
+// Fields of nested messages are also query parameters, whose names are dotted
+// paths. Fields whose proto field paths are in exclude are skipped, as are
+// maps, repeated messages, and recursive references, none of which can be
+// represented in a query string.
+func (st *state) queryParams(md *desc.MessageDescriptor, namePrefix, pathPrefix string, exclude map[string]struct{}, visiting map[string]struct{}) []*Parameter {
+	visiting[md.GetFullyQualifiedName()] = struct{}{}
+	defer delete(visiting, md.GetFullyQualifiedName())
+
+	var params []*Parameter
+	for _, fd := range md.GetFields() {
+		fieldPath := pathPrefix + fd.GetName()
+		if _, ok := exclude[fieldPath]; ok || fd.IsMap() {
+			continue
+		}
+		name := namePrefix + st.gen.Schema.PropertyName(fd)
+		if msg := fd.GetMessageType(); msg != nil && !isScalarMessage(msg) {
+			if fd.IsRepeated() {
+				continue
+			}
+			if _, ok := visiting[msg.GetFullyQualifiedName()]; ok {
+				continue
+			}
+			params = append(params, st.queryParams(msg, name+".", fieldPath+".", exclude, visiting)...)
+			continue
+		}
+		schema := st.defs.Field(fd)
+		schema.Description = ""
+		params = append(params, &Parameter{
+			Name:        name,
+			In:          InQuery,
+			Description: st.description(fd),
+			Deprecated:  fd.GetFieldOptions().GetDeprecated(),
+			Schema:      schema,
+		})
+	}
+	return params
+}
+
+// isScalarMessage returns true if the given message is a well-known type
+// whose JSON format is a scalar, which can be used in a query parameter. This
+// agrees with the schemas for well-known types in the jsonschema package.
+func isScalarMessage(md *desc.MessageDescriptor) bool {
+	switch md.GetFullyQualifiedName() {
+	case "google.protobuf.Timestamp", "google.protobuf.Duration",
+		"google.protobuf.DoubleValue", "google.protobuf.FloatValue",
+		"google.protobuf.Int64Value", "google.protobuf.UInt64Value",
+		"google.protobuf.Int32Value", "google.protobuf.UInt32Value",
+		"google.protobuf.BoolValue", "google.protobuf.StringValue", "google.protobuf.BytesValue":
+		return true
+	default:
+		return false
+	}
+}
+
+// findField resolves a dotted path of field names, starting at the given
+// message. All but the last field in the path must be singular message fields.
+func findField(md *desc.MessageDescriptor, fieldPath string) (*desc.FieldDescriptor, error) {
+	names := strings.Split(fieldPath, ".")
+	var fd *desc.FieldDescriptor
+	for i, name := range names {
+		if i > 0 {
+			md = fd.GetMessageType()
+			if md == nil || fd.IsRepeated() {
+				return nil, fmt.Errorf("field %s is not a singular message field", strings.Join(names[:i], "."))
+			}
+		}
+		fd = md.FindFieldByName(name)
+		if fd == nil {
+			return nil, fmt.Errorf("field %s does not exist in %s", strings.Join(names[:i+1], "."), md.GetFullyQualifiedName())
+		}
+	}
+	return fd, nil
+}
+
+func jsonContent(schema *jsonschema.Schema) map[string]*MediaType {
+	return map[string]*MediaType{"application/json": {Schema: schema}}
+}
@@ -0,0 +1,397 @@
+package openapi
+
+import (
+	"encoding/json"
+	"sort"
+	"testing"
+
+	"google.golang.org/genproto/googleapis/api/annotations"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protoregistry"
+	"google.golang.org/protobuf/types/descriptorpb"
+	"google.golang.org/protobuf/types/known/fieldmaskpb"
+	"google.golang.org/protobuf/types/known/timestamppb"
+
+	"github.com/jhump/protoreflect/desc"
+	"github.com/jhump/protoreflect/desc/builder"
+	"github.com/jhump/protoreflect/desc/jsonschema"
+	"github.com/jhump/protoreflect/internal/testutil"
+)
+
+func TestGenerate(t *testing.T) {
+	sd := buildLibraryService(t)
+	doc, err := (&Generator{}).Generate(sd)
+	testutil.Ok(t, err)
+
+	testutil.Eq(t, "3.1.0", doc.OpenAPI)
+	testutil.Eq(t, "test.library.Library", doc.Info.Title)
+	testutil.Eq(t, "0.0.0", doc.Info.Version)
+	testutil.Eq(t, "Library manages books.", doc.Info.Description)
+	testutil.Eq(t, 1, len(doc.Tags))
+	testutil.Eq(t, Tag{Name: "Library", Description: "Library manages books."}, *doc.Tags[0])
+	testutil.Eq(t, []string{
+		"/test.library.Library/Ping",
+		"/v1/{book.name}",
+		"/v1/{name}",
+		"/v1/{name}:archive",
+		"/v1/{parent}/books",
+	}, pathNames(doc))
+
+	// path parameter with a pattern, plus query parameters
+	op := doc.Paths["/v1/{name}"].Get
+	testutil.Require(t, op != nil)
+	testutil.Eq(t, "Library_GetBook", op.OperationID)
+	testutil.Eq(t, []string{"Library"}, op.Tags)
+	testutil.Eq(t, "Gets a book.", op.Description)
+	testutil.Eq(t, 2, len(op.Parameters))
+	param := op.Parameters[0]
+	testutil.Eq(t, "name", param.Name)
+	testutil.Eq(t, InPath, param.In)
+	testutil.Eq(t, "The name of the book.", param.Description)
+	testutil.Require(t, param.Required)
+	testutil.Eq(t, jsonschema.Types{jsonschema.TypeString}, param.Schema.Type)
+	testutil.Eq(t, "^shelves/[^/]+/books/[^/]+$", param.Schema.Pattern)
+	testutil.Eq(t, "includeAuthor", op.Parameters[1].Name)
+	testutil.Eq(t, InQuery, op.Parameters[1].In)
+	testutil.Eq(t, jsonschema.Types{jsonschema.TypeBoolean}, op.Parameters[1].Schema.Type)
+	testutil.Require(t, op.RequestBody == nil)
+	testutil.Eq(t, "#/components/schemas/test.library.Book", op.Responses["200"].Content["application/json"].Schema.Ref)
+	testutil.Eq(t, "A book.", op.Responses["200"].Description)
+	testutil.Require(t, op.Responses["default"] == nil)
+
+	// additional binding, with a response body
+	op = doc.Paths["/v1/{name}"].Delete
+	testutil.Require(t, op != nil)
+	testutil.Eq(t, "Library_GetBook2", op.OperationID)
+	testutil.Eq(t, "^authors/[^/]+/books/.+$", op.Parameters[0].Schema.Pattern)
+	testutil.Eq(t, jsonschema.Types{jsonschema.TypeString}, op.Responses["200"].Content["application/json"].Schema.Type)
+	testutil.Eq(t, "The title of the book.", op.Responses["200"].Description)
+
+	// nested query parameters, maps and recursive fields skipped
+	op = doc.Paths["/v1/{parent}/books"].Get
+	testutil.Require(t, op != nil)
+	var names []string
+	for _, p := range op.Parameters {
+		names = append(names, p.In+":"+p.Name)
+	}
+	testutil.Eq(t, []string{"path:parent", "query:pageSize", "query:pageToken", "query:filter.author", "query:filter.published"}, names)
+	testutil.Eq(t, "#/components/schemas/google.protobuf.Timestamp", op.Parameters[4].Schema.Ref)
+	testutil.Require(t, op.Parameters[2].Deprecated)
+
+	// body is a field; path parameter is a nested field
+	op = doc.Paths["/v1/{book.name}"].Patch
+	testutil.Require(t, op != nil)
+	names = nil
+	for _, p := range op.Parameters {
+		names = append(names, p.In+":"+p.Name)
+	}
+	// field masks are messages in JSON, like in the jsonschema package, so
+	// their fields are separate parameters
+	testutil.Eq(t, []string{"path:book.name", "query:updateMask.paths"}, names)
+	testutil.Eq(t, "#/components/schemas/test.library.Book", op.RequestBody.Content["application/json"].Schema.Ref)
+	testutil.Eq(t, "The book to update.", op.RequestBody.Description)
+
+	// body is the whole request
+	op = doc.Paths["/v1/{name}:archive"].Post
+	testutil.Require(t, op != nil)
+	testutil.Eq(t, 1, len(op.Parameters))
+	testutil.Eq(t, "#/components/schemas/test.library.ArchiveBookRequest", op.RequestBody.Content["application/json"].Schema.Ref)
+	testutil.Require(t, op.Deprecated)
+
+	// default mapping
+	op = doc.Paths["/test.library.Library/Ping"].Post
+	testutil.Require(t, op != nil)
+	testutil.Eq(t, 0, len(op.Parameters))
+	testutil.Eq(t, "#/components/schemas/test.library.PingRequest", op.RequestBody.Content["application/json"].Schema.Ref)
+
+	// schemas for all referenced types
+	var schemaNames []string
+	for n := range doc.Components.Schemas {
+		schemaNames = append(schemaNames, n)
+	}
+	sort.Strings(schemaNames)
+	testutil.Eq(t, []string{
+		"google.protobuf.Timestamp",
+		"test.library.ArchiveBookRequest",
+		"test.library.Book",
+		"test.library.ListBooksResponse",
+		"test.library.PingRequest",
+		"test.library.PingResponse",
+	}, schemaNames)
+	testutil.Eq(t, "A book.", doc.Components.Schemas["test.library.Book"].Description)
+
+	js, err := json.Marshal(doc)
+	testutil.Ok(t, err)
+	var generic map[string]interface{}
+	err = json.Unmarshal(js, &generic)
+	testutil.Ok(t, err)
+	testutil.Eq(t, "3.1.0", generic["openapi"])
+}
+
+func TestGenerateOptions(t *testing.T) {
+	sd := buildLibraryService(t)
+	errMd, err := desc.LoadMessageDescriptorForMessage((*fieldmaskpb.FieldMask)(nil))
+	testutil.Ok(t, err)
+	gen := &Generator{
+		Info:           Info{Title: "Library API", Version: "1.2.3"},
+		Servers:        []*Server{{URL: "https://library.example.com"}},
+		DefaultMapping: NoMapping,
+		ErrorType:      errMd,
+		Schema:         jsonschema.Generator{OrigName: true, OmitDescriptions: true},
+	}
+	doc, err := gen.Generate(sd)
+	testutil.Ok(t, err)
+	testutil.Eq(t, Info{Title: "Library API", Version: "1.2.3"}, doc.Info)
+	testutil.Eq(t, "https://library.example.com", doc.Servers[0].URL)
+	testutil.Require(t, doc.Paths["/test.library.Library/Ping"] == nil)
+
+	op := doc.Paths["/v1/{name}"].Get
+	testutil.Eq(t, "", op.Description)
+	testutil.Eq(t, "include_author", op.Parameters[1].Name)
+	testutil.Eq(t, "", op.Parameters[0].Description)
+	testutil.Eq(t, "#/components/schemas/google.protobuf.FieldMask", op.Responses["default"].Content["application/json"].Schema.Ref)
+	testutil.Eq(t, "A successful response.", op.Responses["200"].Description)
+}
+
+func TestHTTPRuleUnrecognized(t *testing.T) {
+	sd := buildLibraryService(t)
+	mtd := sd.FindMethodByName("GetBook")
+	rule, err := HTTPRule(mtd)
+	testutil.Ok(t, err)
+	testutil.Eq(t, "/v1/{name=shelves/*/books/*}", rule.GetGet())
+
+	// simulate options parsed without knowledge of the google.api.http extension
+	b, err := proto.Marshal(mtd.GetMethodOptions())
+	testutil.Ok(t, err)
+	var opts descriptorpb.MethodOptions
+	err = proto.UnmarshalOptions{Resolver: new(protoregistry.Types)}.Unmarshal(b, &opts)
+	testutil.Ok(t, err)
+	testutil.Require(t, !proto.HasExtension(&opts, annotations.E_Http))
+	mtdProto := mtd.AsMethodDescriptorProto()
+	mtdProto.Options = &opts
+	fdProto := sd.GetFile().AsFileDescriptorProto()
+	fdProto.Service[0].Method[0] = mtdProto
+	fd, err := desc.CreateFileDescriptor(fdProto, sd.GetFile().GetDependencies()...)
+	testutil.Ok(t, err)
+
+	rule, err = HTTPRule(fd.GetServices()[0].FindMethodByName("GetBook"))
+	testutil.Ok(t, err)
+	testutil.Eq(t, "/v1/{name=shelves/*/books/*}", rule.GetGet())
+
+	rule, err = HTTPRule(sd.FindMethodByName("Ping"))
+	testutil.Ok(t, err)
+	testutil.Require(t, rule == nil)
+}
+
+func TestGenerateErrors(t *testing.T) {
+	testCases := []struct {
+		rule   *annotations.HttpRule
+		errMsg string
+	}{
+		{
+			rule:   &annotations.HttpRule{Pattern: &annotations.HttpRule_Get{Get: "/v1/{foo}"}},
+			errMsg: `method test.library.Library.Ping: path template "/v1/{foo}": field foo does not exist in test.library.PingRequest`,
+		},
+		{
+			rule:   &annotations.HttpRule{Pattern: &annotations.HttpRule_Get{Get: "v1"}},
+			errMsg: `method test.library.Library.Ping: path template "v1" must start with '/'`,
+		},
+		{
+			rule:   &annotations.HttpRule{Pattern: &annotations.HttpRule_Post{Post: "/v1"}, Body: "foo"},
+			errMsg: `method test.library.Library.Ping: body field "foo" does not exist in test.library.PingRequest`,
+		},
+		{
+			rule:   &annotations.HttpRule{Pattern: &annotations.HttpRule_Custom{Custom: &annotations.CustomHttpPattern{Kind: "FETCH", Path: "/v1"}}},
+			errMsg: `method test.library.Library.Ping: HTTP method "fetch" is not supported by OpenAPI`,
+		},
+		{
+			rule:   &annotations.HttpRule{Pattern: &annotations.HttpRule_Delete{Delete: "/v1/{name}"}},
+			errMsg: `method test.library.Library.Ping: DELETE /v1/{name} is already used by operation Library_GetBook2`,
+		},
+		{
+			rule:   &annotations.HttpRule{},
+			errMsg: `method test.library.Library.Ping: HTTP rule has no pattern`,
+		},
+	}
+	for _, tc := range testCases {
+		sd := buildLibraryService(t)
+		gen := &Generator{DefaultMapping: func(*desc.MethodDescriptor) *annotations.HttpRule {
+			return tc.rule
+		}}
+		_, err := gen.Generate(sd)
+		testutil.Nok(t, err)
+		testutil.Eq(t, tc.errMsg, err.Error())
+	}
+}
+
+func TestParsePathTemplate(t *testing.T) {
+	testCases := []struct {
+		tmpl   string
+		path   string
+		vars   []pathVariable
+		errMsg string
+	}{
+		{tmpl: "/", path: "/"},
+		{tmpl: "/v1/foo", path: "/v1/foo"},
+		{tmpl: "/v1/{name}", path: "/v1/{name}", vars: []pathVariable{{fieldPath: "name"}}},
+		{tmpl: "/v1/{name=*}:verb", path: "/v1/{name}:verb", vars: []pathVariable{{fieldPath: "name"}}},
+		{
+			tmpl: "/v1/{a.b=foo/*/bar/**}/{c}",
+			path: "/v1/{a.b}/{c}",
+			vars: []pathVariable{{fieldPath: "a.b", pattern: "^foo/[^/]+/bar/.+$"}, {fieldPath: "c"}},
+		},
+		{tmpl: "/v1/{name", errMsg: `path template "/v1/{name" has unterminated variable`},
+		{tmpl: "/v1/{name}x", errMsg: `path template "/v1/{name}x": variable must be followed by '/'`},
+		{tmpl: "/v1/*", errMsg: `path template "/v1/*": wildcard segment "*" must be inside a variable`},
+		{tmpl: "/v1//foo", errMsg: `path template "/v1//foo": empty path segment`},
+		{tmpl: "/v1/{1abc}", errMsg: `path template "/v1/{1abc}": variable has invalid field path "1abc"`},
+		{tmpl: "/v1/{name=}", errMsg: `path template "/v1/{name=}": variable "name" has empty pattern`},
+		{tmpl: "/v1:", errMsg: `path template "/v1:" has empty verb`},
+	}
+	for _, tc := range testCases {
+		pt, err := parsePathTemplate(tc.tmpl)
+		if tc.errMsg != "" {
+			testutil.Nok(t, err, "%s: expecting error", tc.tmpl)
+			testutil.Eq(t, tc.errMsg, err.Error())
+			continue
+		}
+		testutil.Ok(t, err, "%s: unexpected error", tc.tmpl)
+		testutil.Eq(t, tc.path, pt.path)
+		testutil.Eq(t, tc.vars, pt.vars)
+	}
+}
+
+func pathNames(doc *Document) []string {
+	var names []string
+	for p := range doc.Paths {
+		names = append(names, p)
+	}
+	sort.Strings(names)
+	return names
+}
+
+func buildLibraryService(t *testing.T) *desc.ServiceDescriptor {
+	tsMd, err := desc.LoadMessageDescriptorForMessage((*timestamppb.Timestamp)(nil))
+	testutil.Ok(t, err)
+	fmMd, err := desc.LoadMessageDescriptorForMessage((*fieldmaskpb.FieldMask)(nil))
+	testutil.Ok(t, err)
+	str := builder.FieldTypeString()
+
+	book := builder.NewMessage("Book").
+		SetComments(builder.Comments{LeadingComment: " A book.\n"}).
+		AddField(builder.NewField("name", str).
+			SetComments(builder.Comments{LeadingComment: " The resource name of the book.\n"})).
+		AddField(builder.NewField("title", str).
+			SetComments(builder.Comments{LeadingComment: " The title of the book.\n"})).
+		AddField(builder.NewField("published", builder.FieldTypeImportedMessage(tsMd)))
+	book.AddField(builder.NewField("sequel", builder.FieldTypeMessage(book)))
+
+	getReq := builder.NewMessage("GetBookRequest").
+		AddField(builder.NewField("name", str).
+			SetComments(builder.Comments{LeadingComment: " The name of the book.\n"})).
+		AddField(builder.NewField("include_author", builder.FieldTypeBool()))
+	filter := builder.NewMessage("Filter").
+		AddField(builder.NewField("author", str)).
+		AddField(builder.NewField("published", builder.FieldTypeImportedMessage(tsMd)))
+	listReq := builder.NewMessage("ListBooksRequest").
+		AddField(builder.NewField("parent", str)).
+		AddField(builder.NewField("page_size", builder.FieldTypeInt32())).
+		AddField(builder.NewField("page_token", str).
+			SetOptions(&descriptorpb.FieldOptions{Deprecated: proto.Bool(true)})).
+		AddField(builder.NewField("filter", builder.FieldTypeMessage(filter))).
+		AddField(builder.NewMapField("labels", str, str)).
+		AddField(builder.NewField("books", builder.FieldTypeMessage(book)).SetRepeated()).
+		AddNestedMessage(filter)
+	listResp := builder.NewMessage("ListBooksResponse").
+		AddField(builder.NewField("books", builder.FieldTypeMessage(book)).SetRepeated()).
+		AddField(builder.NewField("next_page_token", str))
+	updateReq := builder.NewMessage("UpdateBookRequest").
+		AddField(builder.NewField("book", builder.FieldTypeMessage(book)).
+			SetComments(builder.Comments{LeadingComment: " The book to update.\n"})).
+		AddField(builder.NewField("update_mask", builder.FieldTypeImportedMessage(fmMd)))
+	archiveReq := builder.NewMessage("ArchiveBookRequest").
+		AddField(builder.NewField("name", str))
+	pingReq := builder.NewMessage("PingRequest")
+	pingResp := builder.NewMessage("PingResponse")
+
+	httpOpts := func(rule *annotations.HttpRule, deprecated bool) *descriptorpb.MethodOptions {
+		opts := &descriptorpb.MethodOptions{}
+		if deprecated {
+			opts.Deprecated = proto.Bool(true)
+		}
+		proto.SetExtension(opts, annotations.E_Http, rule)
+		return opts
+	}
+
+	svc := builder.NewService("Library").
+		SetComments(builder.Comments{LeadingComment: " Library manages books.\n"}).
+		AddMethod(builder.NewMethod("GetBook", builder.RpcTypeMessage(getReq, false), builder.RpcTypeMessage(book, false)).
+			SetComments(builder.Comments{LeadingComment: " Gets a book.\n"}).
+			SetOptions(httpOpts(&annotations.HttpRule{
+				Pattern: &annotations.HttpRule_Get{Get: "/v1/{name=shelves/*/books/*}"},
+				AdditionalBindings: []*annotations.HttpRule{{
+					// not really a sensible mapping, but exercises response_body
+					Pattern:      &annotations.HttpRule_Delete{Delete: "/v1/{name=authors/*/books/**}"},
+					ResponseBody: "title",
+				}},
+			}, false))).
+		AddMethod(builder.NewMethod("ListBooks", builder.RpcTypeMessage(listReq, false), builder.RpcTypeMessage(listResp, false)).
+			SetOptions(httpOpts(&annotations.HttpRule{
+				Pattern: &annotations.HttpRule_Get{Get: "/v1/{parent=shelves/*}/books"},
+			}, false))).
+		AddMethod(builder.NewMethod("UpdateBook", builder.RpcTypeMessage(updateReq, false), builder.RpcTypeMessage(book, false)).
+			SetOptions(httpOpts(&annotations.HttpRule{
+				Pattern: &annotations.HttpRule_Patch{Patch: "/v1/{book.name=shelves/*/books/*}"},
+				Body:    "book",
+			}, false))).
+		AddMethod(builder.NewMethod("ArchiveBook", builder.RpcTypeMessage(archiveReq, false), builder.RpcTypeMessage(book, false)).
+			SetOptions(httpOpts(&annotations.HttpRule{
+				Pattern: &annotations.HttpRule_Custom{Custom: &annotations.CustomHttpPattern{Kind: "POST", Path: "/v1/{name=shelves/*/books/*}:archive"}},
+				Body:    "*",
+			}, true))).
+		AddMethod(builder.NewMethod("Ping", builder.RpcTypeMessage(pingReq, false), builder.RpcTypeMessage(pingResp, false))).
+		AddMethod(builder.NewMethod("WatchBooks", builder.RpcTypeMessage(listReq, false), builder.RpcTypeMessage(book, true)).
+			SetOptions(httpOpts(&annotations.HttpRule{
+				Pattern: &annotations.HttpRule_Get{Get: "/v1/{parent=shelves/*}/books:watch"},
+			}, false)))
+
+	fd, err := builder.NewFile("test/library.proto").
+		SetPackageName("test.library").
+		AddMessage(book).
+		AddMessage(getReq).
+		AddMessage(listReq).
+		AddMessage(listResp).
+		AddMessage(updateReq).
+		AddMessage(archiveReq).
+		AddMessage(pingReq).
+		AddMessage(pingResp).
+		AddService(svc).
+		Build()
+	testutil.Ok(t, err)
+	return fd.GetServices()[0]
+}
+
+func TestImport(t *testing.T) {
+	sd := buildLibraryService(t)
+	doc, err := (&Generator{}).Generate(sd)
+	testutil.Ok(t, err)
+
+	// round-trip through JSON, like a document loaded from disk
+	js, err := json.Marshal(doc)
+	testutil.Ok(t, err)
+	var loaded Document
+	err = json.Unmarshal(js, &loaded)
+	testutil.Ok(t, err)
+
+	fb, _, err := Import(&loaded, &jsonschema.Importer{FileName: "library.proto", Package: "test.library"})
+	testutil.Ok(t, err)
+	fd, err := fb.Build()
+	testutil.Ok(t, err)
+
+	book := fd.FindMessage("test.library.Book")
+	testutil.Require(t, book != nil)
+	testutil.Eq(t, " A book.\n", book.GetSourceInfo().GetLeadingComments())
+	testutil.Eq(t, "google.protobuf.Timestamp", book.FindFieldByName("published").GetMessageType().GetFullyQualifiedName())
+	testutil.Eq(t, book, book.FindFieldByName("sequel").GetMessageType())
+	testutil.Require(t, fd.FindMessage("test.library.ListBooksResponse").FindFieldByName("books").IsRepeated())
+}
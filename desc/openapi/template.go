@@ -0,0 +1,142 @@
+package openapi
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+// pathTemplate is a parsed HTTP path template, as used in google.api.http
+// annotations. The syntax is described in google/api/http.proto:
+//
+//	Template = "/" Segments [ Verb ] ;
+//	Segments = Segment { "/" Segment } ;
+//	Segment  = "*" | "**" | LITERAL | Variable ;
+//	Variable = "{" FieldPath [ "=" Segments ] "}" ;
+//	FieldPath = IDENT { "." IDENT } ;
+//	Verb     = ":" LITERAL ;
+type pathTemplate struct {
+	// The path in the form used by OpenAPI, where each variable is replaced
+	// with its field path in braces.
+	path string
+	vars []pathVariable
+}
+
+type pathVariable struct {
+	fieldPath string
+	// If the variable matches more than a single path segment, this is a
+	// regular expression for the values it matches. Otherwise it is empty.
+	pattern string
+}
+
+func parsePathTemplate(tmpl string) (*pathTemplate, error) {
+	if !strings.HasPrefix(tmpl, "/") {
+		return nil, fmt.Errorf("path template %q must start with '/'", tmpl)
+	}
+	var verb string
+	// the verb follows the last colon, as long as it is not inside a variable
+	if pos := strings.LastIndexByte(tmpl, ':'); pos >= 0 && !strings.ContainsAny(tmpl[pos:], "{}/") {
+		tmpl, verb = tmpl[:pos], tmpl[pos:]
+		if len(verb) == 1 {
+			return nil, fmt.Errorf("path template %q has empty verb", tmpl+verb)
+		}
+	}
+	var sb strings.Builder
+	var vars []pathVariable
+	rest := tmpl[1:]
+	if rest == "" {
+		return &pathTemplate{path: "/" + verb}, nil
+	}
+	for {
+		sb.WriteByte('/')
+		var seg string
+		if strings.HasPrefix(rest, "{") {
+			end := strings.IndexByte(rest, '}')
+			if end < 0 {
+				return nil, fmt.Errorf("path template %q has unterminated variable", tmpl)
+			}
+			v, err := parseVariable(rest[1:end])
+			if err != nil {
+				return nil, fmt.Errorf("path template %q: %w", tmpl, err)
+			}
+			vars = append(vars, *v)
+			sb.WriteString("{" + v.fieldPath + "}")
+			rest = rest[end+1:]
+			if rest != "" && !strings.HasPrefix(rest, "/") {
+				return nil, fmt.Errorf("path template %q: variable must be followed by '/'", tmpl)
+			}
+		} else {
+			if end := strings.IndexByte(rest, '/'); end >= 0 {
+				seg, rest = rest[:end], rest[end:]
+			} else {
+				seg, rest = rest, ""
+			}
+			if err := checkLiteral(seg); err != nil {
+				return nil, fmt.Errorf("path template %q: %w", tmpl, err)
+			}
+			sb.WriteString(seg)
+		}
+		if rest == "" {
+			break
+		}
+		rest = rest[1:]
+	}
+	sb.WriteString(verb)
+	return &pathTemplate{path: sb.String(), vars: vars}, nil
+}
+
+var identRegex = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*$`)
+
+func parseVariable(s string) (*pathVariable, error) {
+	fieldPath, segments := s, ""
+	if pos := strings.IndexByte(s, '='); pos >= 0 {
+		fieldPath, segments = s[:pos], s[pos+1:]
+		if segments == "" {
+			return nil, fmt.Errorf("variable %q has empty pattern", fieldPath)
+		}
+	}
+	for _, ident := range strings.Split(fieldPath, ".") {
+		if !identRegex.MatchString(ident) {
+			return nil, fmt.Errorf("variable has invalid field path %q", fieldPath)
+		}
+	}
+	v := &pathVariable{fieldPath: fieldPath}
+	if segments == "" || segments == "*" {
+		// matches a single segment, which needs no pattern
+		return v, nil
+	}
+	var pattern strings.Builder
+	pattern.WriteByte('^')
+	for i, seg := range strings.Split(segments, "/") {
+		if i > 0 {
+			pattern.WriteByte('/')
+		}
+		switch seg {
+		case "*":
+			pattern.WriteString("[^/]+")
+		case "**":
+			pattern.WriteString(".+")
+		default:
+			if err := checkLiteral(seg); err != nil {
+				return nil, fmt.Errorf("variable %q: %w", fieldPath, err)
+			}
+			pattern.WriteString(regexp.QuoteMeta(seg))
+		}
+	}
+	pattern.WriteByte('$')
+	v.pattern = pattern.String()
+	return v, nil
+}
+
+func checkLiteral(seg string) error {
+	switch {
+	case seg == "":
+		return fmt.Errorf("empty path segment")
+	case seg == "*" || seg == "**":
+		// OpenAPI has no way to describe an unnamed wildcard
+		return fmt.Errorf("wildcard segment %q must be inside a variable", seg)
+	case strings.ContainsAny(seg, "{}=:"):
+		return fmt.Errorf("invalid path segment %q", seg)
+	}
+	return nil
+}
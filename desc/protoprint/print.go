@@ -2,6 +2,7 @@ package protoprint
 
 import (
 	"bytes"
+	"errors"
 	"fmt"
 	"io"
 	"math"
@@ -9,6 +10,7 @@ import (
 	"path/filepath"
 	"reflect"
 	"sort"
+	"strconv"
 	"strings"
 	"unicode"
 	"unicode/utf8"
@@ -194,6 +196,31 @@ type Printer struct {
 	//
 	// If unset (e.g. if zero), a default threshold of 50 is used.
 	MessageLiteralExpansionThresholdLength int
+
+	// The maximum width, in columns, of printed lines. When a line would
+	// exceed this width, the printer tries to wrap it:
+	//  1. Short options expressions (on fields, enum values, and extension
+	//     ranges) are expanded to multiple lines, one option per line.
+	//  2. Message literals in option values are expanded to multiple lines.
+	//  3. Long string and bytes literals that are the values of options are
+	//     split into multiple adjacent literals (which are concatenated by the
+	//     compiler), one per line. String and bytes literals that are field
+	//     values inside message literals are not split.
+	//  4. The "returns" clause of an RPC signature is moved to the next line.
+	//  5. Comments are wrapped at word boundaries. Trailing comments that
+	//     would not fit on the same line as the element are moved to the next
+	//     line.
+	//
+	// Some lines may still exceed this width, such as those with very long
+	// identifiers, comments that contain very long words, string literals
+	// inside message literals, or long reserved and extension range
+	// declarations. If so, the output is still printed in full, but a
+	// *LineWidthError that identifies those lines is returned. When computing
+	// the width of a line, tab characters in the indentation advance to the
+	// next multiple of 8 columns.
+	//
+	// If unset (e.g. if zero), there is no limit on the width of lines.
+	MaxLineWidth int
 }
 
 // CommentType is a kind of comments in a proto source file. This can be used
@@ -233,10 +260,34 @@ const (
 	CommentsAll = -1
 )
 
+// LineWidthError is returned when printing with a MaxLineWidth produces lines
+// that could not be wrapped to fit in that width. The output is still printed
+// in full when this error is returned.
+type LineWidthError struct {
+	// The maximum width that was exceeded.
+	MaxLineWidth int
+	// The line numbers, starting at 1, of lines that are too wide.
+	Lines []int
+}
+
+// Error implements the error interface.
+func (e *LineWidthError) Error() string {
+	lines := make([]string, len(e.Lines))
+	for i, l := range e.Lines {
+		lines[i] = strconv.Itoa(l)
+	}
+	return fmt.Sprintf("%d line(s) exceed max width of %d columns: %s", len(e.Lines), e.MaxLineWidth, strings.Join(lines, ", "))
+}
+
 // PrintProtoFiles prints all of the given file descriptors. The given open
 // function is given a file name and is responsible for creating the outputs and
 // returning the corresponding writer.
+//
+// If a file has lines that are too wide, the remaining files are still
+// printed, and the error for the first such file is returned. It wraps a
+// *LineWidthError.
 func (p *Printer) PrintProtoFiles(fds []*desc.FileDescriptor, open func(name string) (io.WriteCloser, error)) error {
+	var widthErr error
 	for _, fd := range fds {
 		w, err := open(fd.GetName())
 		if err != nil {
@@ -246,11 +297,18 @@ func (p *Printer) PrintProtoFiles(fds []*desc.FileDescriptor, open func(name str
 			defer w.Close()
 			return p.PrintProtoFile(fd, w)
 		}()
+		var lwErr *LineWidthError
+		if errors.As(err, &lwErr) {
+			if widthErr == nil {
+				widthErr = fmt.Errorf("%s: %w", fd.GetName(), err)
+			}
+			continue
+		}
 		if err != nil {
 			return fmt.Errorf("failed to write %s: %v", fd.GetName(), err)
 		}
 	}
-	return nil
+	return widthErr
 }
 
 // PrintProtosToFileSystem prints all of the given file descriptors to files in
@@ -288,6 +346,10 @@ type messageVal struct {
 type option struct {
 	name string
 	val  interface{}
+	// if non-zero, the last element of the path used to find source info
+	// for the option (instead of the option's index); used for options that
+	// set a single field of a message, like features
+	sourceIndex int32
 }
 
 // reservedRange represents a reserved range from a message or enum
@@ -305,15 +367,27 @@ func (p *Printer) PrintProtoFile(fd *desc.FileDescriptor, out io.Writer) error {
 // the proto "source form" for any kind of descriptor, which can be a more
 // user-friendly way to present descriptors that are intended for human
 // consumption.
+//
+// If the result has lines that are too wide, it is returned along with a
+// *LineWidthError.
 func (p *Printer) PrintProtoToString(dsc desc.Descriptor) (string, error) {
 	var buf bytes.Buffer
 	if err := p.PrintProto(dsc, &buf); err != nil {
+		var lwErr *LineWidthError
+		if errors.As(err, &lwErr) {
+			return buf.String(), err
+		}
 		return "", err
 	}
 	return buf.String(), nil
 }
 
 func (p *Printer) PrintProto(dsc desc.Descriptor, out io.Writer) error {
+	var lw *lineWidthWriter
+	if p.MaxLineWidth > 0 {
+		lw = &lineWidthWriter{Writer: out, max: p.MaxLineWidth}
+		out = lw
+	}
 	w := newWriter(out)
 
 	if p.Indent == "" {
@@ -385,7 +459,13 @@ func (p *Printer) PrintProto(dsc desc.Descriptor, out io.Writer) error {
 		p.printMethod(d, &reg, w, sourceInfo, path, 0)
 	}
 
-	return w.err
+	if w.err != nil {
+		return w.err
+	}
+	if lw != nil {
+		return lw.check()
+	}
+	return nil
 }
 
 func findElement(dsc desc.Descriptor) []int32 {
@@ -550,15 +630,23 @@ func (p *Printer) printFile(fd *desc.FileDescriptor, reg *protoregistry.Types, w
 	path[0] = internal.File_packageTag
 	sourceInfo.PutIfAbsent(append(path, 0), sourceInfo.Get(path))
 
-	path[0] = internal.File_syntaxTag
-	si := sourceInfo.Get(path)
-	p.printElement(false, si, w, 0, func(w *writer) {
-		syn := fdp.GetSyntax()
-		if syn == "" {
-			syn = "proto2"
-		}
-		_, _ = fmt.Fprintf(w, "syntax = %q;", syn)
-	})
+	if fd.IsEditions() {
+		path[0] = internal.File_editionTag
+		si := sourceInfo.Get(path)
+		p.printElement(false, si, w, 0, func(w *writer) {
+			_, _ = fmt.Fprintf(w, "edition = %q;", editionString(fd.GetEdition()))
+		})
+	} else {
+		path[0] = internal.File_syntaxTag
+		si := sourceInfo.Get(path)
+		p.printElement(false, si, w, 0, func(w *writer) {
+			syn := fdp.GetSyntax()
+			if syn == "" {
+				syn = "proto2"
+			}
+			_, _ = fmt.Fprintf(w, "syntax = %q;", syn)
+		})
+	}
 	p.newLine(w, CompactTopLevelDeclarations)
 
 	skip := map[interface{}]bool{}
@@ -582,7 +670,7 @@ func (p *Printer) printFile(fd *desc.FileDescriptor, reg *protoregistry.Types, w
 	}
 	exts := p.computeExtensions(sourceInfo, fd.GetExtensions(), []int32{internal.File_extensionsTag})
 	for i, extd := range fd.GetExtensions() {
-		if extd.GetType() == descriptorpb.FieldDescriptorProto_TYPE_GROUP {
+		if isGroup(extd) {
 			// we don't emit nested messages for groups since
 			// they get special treatment
 			skip[extd.GetMessageType()] = true
@@ -819,7 +907,9 @@ func (p *Printer) typeString(fld *desc.FieldDescriptor, scope string) string {
 	if fld.IsMap() {
 		return fmt.Sprintf("map<%s, %s>", p.typeString(fld.GetMapKeyType(), scope), p.typeString(fld.GetMapValueType(), scope))
 	}
-	switch fld.GetType() {
+	// use the type from the descriptor proto since, for editions, GetType
+	// reports delimited message fields as groups
+	switch fld.AsFieldDescriptorProto().GetType() {
 	case descriptorpb.FieldDescriptorProto_TYPE_INT32:
 		return "int32"
 	case descriptorpb.FieldDescriptorProto_TYPE_INT64:
@@ -857,7 +947,7 @@ func (p *Printer) typeString(fld *desc.FieldDescriptor, scope string) string {
 	case descriptorpb.FieldDescriptorProto_TYPE_GROUP:
 		return fld.GetMessageType().GetName()
 	}
-	panic(fmt.Sprintf("invalid type: %v", fld.GetType()))
+	panic(fmt.Sprintf("invalid type: %v", fld.AsFieldDescriptorProto().GetType()))
 }
 
 func (p *Printer) printMessage(md *desc.MessageDescriptor, reg *protoregistry.Types, w *writer, sourceInfo internal.SourceInfoMap, path []int32, indent int) {
@@ -901,7 +991,7 @@ func (p *Printer) printMessageBody(md *desc.MessageDescriptor, reg *protoregistr
 		elements.addrs = append(elements.addrs, elementAddr{elementType: internal.Message_extensionRangeTag, elementIndex: i})
 	}
 	for i, fld := range md.GetFields() {
-		if fld.IsMap() || fld.GetType() == descriptorpb.FieldDescriptorProto_TYPE_GROUP {
+		if fld.IsMap() || isGroup(fld) {
 			// we don't emit nested messages for map types or groups since
 			// they get special treatment
 			skip[fld.GetMessageType()] = true
@@ -916,7 +1006,7 @@ func (p *Printer) printMessageBody(md *desc.MessageDescriptor, reg *protoregistr
 	}
 	exts := p.computeExtensions(sourceInfo, md.GetNestedExtensions(), append(path, internal.Message_extensionsTag))
 	for i, extd := range md.GetNestedExtensions() {
-		if extd.GetType() == descriptorpb.FieldDescriptorProto_TYPE_GROUP {
+		if isGroup(extd) {
 			// we don't emit nested messages for groups since
 			// they get special treatment
 			skip[extd.GetMessageType()] = true
@@ -1059,7 +1149,7 @@ func (p *Printer) printMessageBody(md *desc.MessageDescriptor, reg *protoregistr
 				addrs = append(addrs, elnext)
 				skip[rn] = true
 			}
-			p.printReservedNames(names, addrs, w, sourceInfo, path, indent)
+			p.printReservedNames(names, md.GetFile().IsEditions(), addrs, w, sourceInfo, path, indent)
 		}
 	}
 }
@@ -1187,48 +1277,8 @@ type segment struct {
 func (p *Printer) printAdjacentFieldsAligned(fields []*desc.FieldDescriptor, reg *protoregistry.Types, w *writer, sourceInfo internal.SourceInfoMap, paths [][]int32, scope string, indent int) {
 	lines := make([][]segment, 0, len(fields))
 	lineBuf := new(bytes.Buffer)
-	var segments []segment
 	for i, fld := range fields {
-		segments = []segment{}
-		lineBuf.Reset()
-		p.printField(fld, reg, newWriter(lineBuf), sourceInfo, paths[i], scope, indent, "\f%s\f ")
-		lineBytes := lineBuf.Bytes()
-
-		// within the line string, each column is bounded by form feeds.
-		// split the columns and preserve spaces between columns so we can
-		// splice them back in between the resized columns later.
-		var currentSegment segment
-		currentSegment.kind = segmentContext
-		// each time a form feed is read, toggle the segment kind
-		for _, b := range lineBytes {
-			if b == '\f' {
-				segments = append(segments, currentSegment)
-				nextKind := currentSegment.kind ^ 1
-				currentSegment = segment{
-					kind: nextKind,
-				}
-			} else {
-				currentSegment.bytes = append(currentSegment.bytes, b)
-			}
-		}
-		segments = append(segments, currentSegment)
-
-		// special case: "optional", "required", and "repeated" are considered to be
-		// part of the type column for purposes of alignment.
-		for i, sg := range segments {
-			if sg.kind == segmentColumn && i < 3 && (bytes.Equal(sg.bytes, []byte("optional")) || bytes.Equal(sg.bytes, []byte("required")) || bytes.Equal(sg.bytes, []byte("repeated"))) {
-				if i+2 < len(segments) && segments[i+1].kind == segmentContext && segments[i+2].kind == segmentColumn {
-					mergedColumn := segment{
-						kind:  segmentColumn,
-						bytes: append(append(sg.bytes, segments[i+1].bytes...), segments[i+2].bytes...),
-					}
-					segments = append(segments[:i], append([]segment{mergedColumn}, segments[i+3:]...)...)
-					break
-				}
-			}
-		}
-
-		lines = append(lines, segments)
+		lines = append(lines, p.printFieldSegments(fld, reg, lineBuf, 0, sourceInfo, paths[i], scope, indent))
 	}
 
 	// find the longest string in each column
@@ -1245,6 +1295,25 @@ func (p *Printer) printAdjacentFieldsAligned(fields []*desc.FieldDescriptor, reg
 		}
 	}
 
+	if p.MaxLineWidth > 0 {
+		// padding the columns makes lines wider, which may change how the
+		// rest of the line should be wrapped, so re-render any padded lines
+		// with the padding taken into account
+		for i, segments := range lines {
+			padding := 0
+			colIdx := 0
+			for _, sg := range segments {
+				if sg.kind == segmentColumn {
+					padding += colWidths[colIdx] - len(sg.bytes)
+					colIdx++
+				}
+			}
+			if padding > 0 {
+				lines[i] = p.printFieldSegments(fields[i], reg, lineBuf, padding, sourceInfo, paths[i], scope, indent)
+			}
+		}
+	}
+
 	// print with padding
 	for _, segments := range lines {
 		colIdx := 0
@@ -1259,7 +1328,61 @@ func (p *Printer) printAdjacentFieldsAligned(fields []*desc.FieldDescriptor, reg
 	}
 }
 
+// printFieldSegments prints the given field into the given buffer and then
+// splits the result into segments, so that its columns can be aligned with
+// those of adjacent fields. The given padding is the number of columns that
+// will be added when the columns are aligned.
+func (p *Printer) printFieldSegments(fld *desc.FieldDescriptor, reg *protoregistry.Types, lineBuf *bytes.Buffer, padding int, sourceInfo internal.SourceInfoMap, path []int32, scope string, indent int) []segment {
+	segments := []segment{}
+	lineBuf.Reset()
+	lineW := newWriter(lineBuf)
+	lineW.pad = padding
+	p.printField(fld, reg, lineW, sourceInfo, path, scope, indent, "\f%s\f ")
+	lineBytes := lineBuf.Bytes()
+
+	// within the line string, each column is bounded by form feeds.
+	// split the columns and preserve spaces between columns so we can
+	// splice them back in between the resized columns later.
+	var currentSegment segment
+	currentSegment.kind = segmentContext
+	// each time a form feed is read, toggle the segment kind
+	for _, b := range lineBytes {
+		if b == '\f' {
+			segments = append(segments, currentSegment)
+			nextKind := currentSegment.kind ^ 1
+			currentSegment = segment{
+				kind: nextKind,
+			}
+		} else {
+			currentSegment.bytes = append(currentSegment.bytes, b)
+		}
+	}
+	segments = append(segments, currentSegment)
+
+	// special case: "optional", "required", and "repeated" are considered to be
+	// part of the type column for purposes of alignment.
+	for i, sg := range segments {
+		if sg.kind == segmentColumn && i < 3 && (bytes.Equal(sg.bytes, []byte("optional")) || bytes.Equal(sg.bytes, []byte("required")) || bytes.Equal(sg.bytes, []byte("repeated"))) {
+			if i+2 < len(segments) && segments[i+1].kind == segmentContext && segments[i+2].kind == segmentColumn {
+				mergedColumn := segment{
+					kind:  segmentColumn,
+					bytes: append(append(sg.bytes, segments[i+1].bytes...), segments[i+2].bytes...),
+				}
+				segments = append(segments[:i], append([]segment{mergedColumn}, segments[i+3:]...)...)
+				break
+			}
+		}
+	}
+
+	return segments
+}
+
 func shouldEmitLabel(fld *desc.FieldDescriptor) bool {
+	if fld.GetFile().IsEditions() {
+		// editions only allows the repeated label; field presence
+		// is instead controlled by features
+		return !fld.IsMap() && fld.IsRepeated()
+	}
 	return fld.IsProto3Optional() ||
 		(!fld.IsMap() && fld.GetOneOf() == nil &&
 			(fld.GetLabel() != descriptorpb.FieldDescriptorProto_LABEL_OPTIONAL || !fld.GetFile().IsProto3()))
@@ -1278,7 +1401,15 @@ func labelString(lbl descriptorpb.FieldDescriptorProto_Label) string {
 }
 
 func isGroup(fld *desc.FieldDescriptor) bool {
-	return fld.GetType() == descriptorpb.FieldDescriptorProto_TYPE_GROUP
+	// use the type from the descriptor proto since editions have no group
+	// syntax, even though GetType reports delimited message fields as groups
+	return fld.AsFieldDescriptorProto().GetType() == descriptorpb.FieldDescriptorProto_TYPE_GROUP
+}
+
+// editionString returns the string used to declare the given edition in a
+// source file, e.g. "2023" for EDITION_2023.
+func editionString(edition descriptorpb.Edition) string {
+	return strings.TrimPrefix(edition.String(), "EDITION_")
 }
 
 func (p *Printer) printOneOf(ood *desc.OneOfDescriptor, parentElements elementAddrs, startFieldIndex int, reg *protoregistry.Types, w *writer, sourceInfo internal.SourceInfoMap, parentPath []int32, indent int, ooIndex int32) {
@@ -1441,7 +1572,7 @@ func (p *Printer) printReservedRanges(ranges []reservedRange, maxVal int32, addr
 	_, _ = fmt.Fprintln(w, ";")
 }
 
-func (p *Printer) printReservedNames(names []string, addrs []elementAddr, w *writer, sourceInfo internal.SourceInfoMap, parentPath []int32, indent int) {
+func (p *Printer) printReservedNames(names []string, isEditions bool, addrs []elementAddr, w *writer, sourceInfo internal.SourceInfoMap, parentPath []int32, indent int) {
 	p.indent(w, indent)
 	_, _ = fmt.Fprint(w, "reserved ")
 
@@ -1454,7 +1585,12 @@ func (p *Printer) printReservedNames(names []string, addrs []elementAddr, w *wri
 		}
 		el := addrs[i]
 		si := sourceInfo.Get(append(parentPath, el.elementType, int32(el.elementIndex)))
-		p.printfElementString(si, w, indent, "%s ", quotedString(name))
+		if isEditions {
+			// editions uses identifiers instead of string literals
+			p.printfElementString(si, w, indent, "%s ", name)
+		} else {
+			p.printfElementString(si, w, indent, "%s ", quotedString(name))
+		}
 	}
 
 	_, _ = fmt.Fprintln(w, ";")
@@ -1546,7 +1682,7 @@ func (p *Printer) printEnum(ed *desc.EnumDescriptor, reg *protoregistry.Types, w
 					addrs = append(addrs, elnext)
 					skip[rn] = true
 				}
-				p.printReservedNames(names, addrs, w, sourceInfo, path, indent)
+				p.printReservedNames(names, ed.GetFile().IsEditions(), addrs, w, sourceInfo, path, indent)
 			}
 		}
 
@@ -1639,13 +1775,22 @@ func (p *Printer) printMethod(mtd *desc.MethodDescriptor, reg *protoregistry.Typ
 		}
 		p.printElementString(inSi, w, indent, inName)
 
-		_, _ = fmt.Fprint(w, ") returns (")
-
 		outSi := sourceInfo.Get(append(path, internal.Method_outputTag))
 		outName := p.qualifyName(pkg, pkg, mtd.GetOutputType().GetFullyQualifiedName())
 		if mtd.IsServerStreaming() {
 			outName = "stream " + outName
 		}
+
+		// we add 3 to the width to leave room for the trailing ") {"
+		if p.exceedsWidth(w.column() + len(") returns (") + len(outName) + 3) {
+			// too long for one line: wrap the returns clause
+			_, _ = fmt.Fprintln(w, ")")
+			p.indent(w, indent+2)
+			_, _ = fmt.Fprint(w, "returns (")
+		} else {
+			_, _ = fmt.Fprint(w, ") returns (")
+		}
+
 		p.printElementString(outSi, w, indent, outName)
 		_, _ = fmt.Fprint(w, ") ")
 
@@ -1743,8 +1888,9 @@ func (p *Printer) printOptionsShort(dsc interface{}, opts map[int32][]option, op
 		if threshold <= 0 {
 			threshold = 50
 		}
-		// we subtract 3 so we don't consider the leading " [" and trailing "]"
-		if tmp.Len()-3 > threshold {
+		// we subtract 3 so we don't consider the leading " [" and trailing "]";
+		// we add 2 to the width to leave room for the trailing ";" or " {"
+		if tmp.Len()-3 > threshold || p.exceedsWidth(textWidth(w.col+w.pad, tmp.String())+2) {
 			p.printOptionElementsShort(elements, reg, w, sourceInfo, path, indent, true)
 		} else {
 			// not too long: commit what we rendered
@@ -1815,7 +1961,11 @@ func (p *Printer) printOptions(opts []option, w *writer, indent int, siFetch fun
 		if !more {
 			more = i < len(opts)-1
 		}
-		si := siFetch(int32(i))
+		idx := int32(i)
+		if opt.sourceIndex != 0 {
+			idx = opt.sourceIndex
+		}
+		si := siFetch(idx)
 		p.printElement(false, si, w, indent, func(w *writer) {
 			fn(w, indent, opt, more)
 		})
@@ -1869,9 +2019,9 @@ func (p *Printer) printOption(reg *protoregistry.Types, name string, optVal inte
 	case float32, float64:
 		_, _ = fmt.Fprintf(w, "%f", optVal)
 	case string:
-		_, _ = fmt.Fprintf(w, "%s", quotedString(optVal))
+		p.printStringLiteral(optVal, quotedString, w, indent)
 	case []byte:
-		_, _ = fmt.Fprintf(w, "%s", quotedBytes(string(optVal)))
+		p.printStringLiteral(string(optVal), quotedBytes, w, indent)
 	case bool:
 		_, _ = fmt.Fprintf(w, "%v", optVal)
 	case ident:
@@ -1881,6 +2031,12 @@ func (p *Printer) printOption(reg *protoregistry.Types, name string, optVal inte
 		if threshold == 0 {
 			threshold = 50
 		}
+		if p.MaxLineWidth > 0 && indent >= 0 {
+			// leave room for the trailing ";" or ","
+			if avail := p.MaxLineWidth - w.column() - 1; avail < threshold {
+				threshold = avail
+			}
+		}
 		var buf bytes.Buffer
 		p.printMessageLiteralToBufferMaybeCompact(&buf, optVal.msg.ProtoReflect(), reg, optVal.pkg, optVal.scope, threshold, indent)
 		_, _ = w.Write(buf.Bytes())
@@ -1890,6 +2046,88 @@ func (p *Printer) printOption(reg *protoregistry.Types, name string, optVal inte
 	}
 }
 
+// minStringLiteralChunk is the minimum number of columns that must remain on
+// the current line in order to start a split string literal there instead of
+// on the next line.
+const minStringLiteralChunk = 16
+
+// printStringLiteral prints the given string value using the given function
+// to quote it. If the quoted string would exceed the printer's MaxLineWidth,
+// it is split into multiple adjacent string literals, one per line.
+func (p *Printer) printStringLiteral(s string, quote func(string) string, w *writer, indent int) {
+	quoted := quote(s)
+	// we add 1 to leave room for the trailing ";" or ","
+	if indent < 0 || !p.exceedsWidth(w.column()+len(quoted)+1) {
+		_, _ = fmt.Fprint(w, quoted)
+		return
+	}
+
+	contIndent := indent + 1
+	contAvail := p.MaxLineWidth - p.indentWidth(contIndent) - 1
+	avail := p.MaxLineWidth - w.column() - 1
+	if avail < minStringLiteralChunk || len(quoted) <= contAvail {
+		// not enough room left on this line, or the whole string fits
+		// on the next line; so start on the next one
+		p.continueLine(w, contIndent)
+		avail = contAvail
+	}
+	for i, chunk := range splitStringLiteral(s, quote, avail, contAvail) {
+		if i > 0 {
+			p.continueLine(w, contIndent)
+		}
+		_, _ = fmt.Fprint(w, quote(chunk))
+	}
+}
+
+// continueLine ends the current line, without any trailing space, and then
+// indents the next line.
+func (p *Printer) continueLine(w *writer, indent int) {
+	w.space = false
+	_, _ = fmt.Fprintln(w)
+	p.indent(w, indent)
+}
+
+// splitStringLiteral splits the given string into chunks, each of which fits
+// in the given width when quoted. The first chunk uses the first width and
+// subsequent chunks use the rest width. Chunks are preferably split after
+// a space or, failing that, after punctuation. Each chunk contains at least
+// one character, even if it does not fit in the available width.
+func splitStringLiteral(s string, quote func(string) string, first, rest int) []string {
+	var chunks []string
+	avail := first
+	for len(s) > 0 {
+		// account for the enclosing quotes
+		width := 2
+		end, lastSpace, lastPunct := 0, -1, -1
+		for end < len(s) {
+			_, sz := utf8.DecodeRuneInString(s[end:])
+			runeWidth := len(quote(s[end:end+sz])) - 2
+			if width+runeWidth > avail && end > 0 {
+				break
+			}
+			width += runeWidth
+			end += sz
+			switch s[end-1] {
+			case ' ':
+				lastSpace = end
+			case '/', '.', ',', ';', ':', '-', '_':
+				lastPunct = end
+			}
+		}
+		if end < len(s) {
+			if lastSpace > 0 {
+				end = lastSpace
+			} else if lastPunct > 0 {
+				end = lastPunct
+			}
+		}
+		chunks = append(chunks, s[:end])
+		s = s[end:]
+		avail = rest
+	}
+	return chunks
+}
+
 type edgeKind int
 
 const (
@@ -2026,7 +2264,12 @@ func (p *Printer) extractOptions(dsc desc.Descriptor, opts proto.Message) (map[i
 		} else {
 			name = string(fld.Name())
 		}
-		opts := valueToOptions(fld, name, val.Interface())
+		var opts []option
+		if isFeaturesOption(fld) {
+			opts = p.featuresToOptions(name, val.Message(), pkg, scope)
+		} else {
+			opts = valueToOptions(fld, name, val.Interface())
+		}
 		if len(opts) > 0 {
 			for i := range opts {
 				if msg, ok := opts[i].val.(proto.Message); ok {
@@ -2040,6 +2283,51 @@ func (p *Printer) extractOptions(dsc desc.Descriptor, opts proto.Message) (map[i
 	return options, nil
 }
 
+// isFeaturesOption returns true if the given field is the "features" field
+// of an options message.
+func isFeaturesOption(fld protoreflect.FieldDescriptor) bool {
+	return !fld.IsExtension() && fld.Name() == "features" &&
+		fld.Message() != nil && fld.Message().FullName() == featureSetName
+}
+
+var featureSetName = (*descriptorpb.FeatureSet)(nil).ProtoReflect().Descriptor().FullName()
+
+// featuresToOptions converts the given feature set into options, one per
+// feature, so that they are printed the way they are conventionally written
+// (e.g. "features.field_presence = IMPLICIT") instead of as a single message
+// literal.
+func (p *Printer) featuresToOptions(name string, features protoreflect.Message, pkg, scope string) []option {
+	type featureVal struct {
+		fld protoreflect.FieldDescriptor
+		val protoreflect.Value
+	}
+	var vals []featureVal
+	features.Range(func(fld protoreflect.FieldDescriptor, val protoreflect.Value) bool {
+		vals = append(vals, featureVal{fld: fld, val: val})
+		return true
+	})
+	sort.Slice(vals, func(i, j int) bool {
+		return vals[i].fld.Number() < vals[j].fld.Number()
+	})
+	var opts []option
+	for _, fv := range vals {
+		var featureName string
+		if fv.fld.IsExtension() {
+			featureName = fmt.Sprintf("%s.(%s)", name, p.qualifyName(pkg, scope, string(fv.fld.FullName())))
+		} else {
+			featureName = fmt.Sprintf("%s.%s", name, fv.fld.Name())
+		}
+		for _, opt := range valueToOptions(fv.fld, featureName, fv.val.Interface()) {
+			if msg, ok := opt.val.(proto.Message); ok {
+				opt.val = messageVal{pkg: pkg, scope: scope, msg: msg}
+			}
+			opt.sourceIndex = int32(fv.fld.Number())
+			opts = append(opts, opt)
+		}
+	}
+	return opts
+}
+
 func valueToOptions(fld protoreflect.FieldDescriptor, name string, val interface{}) []option {
 	switch val := val.(type) {
 	case protoreflect.List:
@@ -2745,7 +3033,7 @@ func (p *Printer) printComment(comments string, w *writer, indent int, forceNext
 		// last element did not have trailing newline, so we
 		// either need to tack on newline or, if comment is
 		// just one line, inline it on the end
-		if forceNextLine || len(lines) > 1 {
+		if forceNextLine || len(lines) > 1 || p.exceedsWidth(textWidth(w.column()+1, "// "+lines[0])) {
 			_, _ = fmt.Fprintln(w)
 		} else {
 			if !w.space {
@@ -2755,6 +3043,16 @@ func (p *Printer) printComment(comments string, w *writer, indent int, forceNext
 		}
 	}
 
+	if p.MaxLineWidth > 0 && indent >= 0 {
+		// we subtract 2 for the leading "//" or " *"
+		avail := p.MaxLineWidth - p.indentWidth(indent) - 2
+		if multiLine && len(lines) == 1 {
+			// and 2 more for the trailing "*/"
+			avail -= 2
+		}
+		lines = wrapCommentLines(lines, avail)
+	}
+
 	if len(lines) == 1 && multiLine {
 		p.indent(w, indent)
 		line := lines[0]
@@ -2810,6 +3108,87 @@ func (p *Printer) printComment(comments string, w *writer, indent int, forceNext
 	return !multiLine || indent >= 0
 }
 
+// wrapCommentLines wraps the given comment lines at word boundaries so that
+// they fit in the given width. Wrapped lines retain the leading whitespace of
+// the line from which they were split. The remainder of a wrapped line is
+// reflowed into the following line if that line continues the same paragraph
+// (i.e. it is not blank, is not indented, and is not the start of a list item).
+func wrapCommentLines(lines []string, width int) []string {
+	var wrapped []string
+	var carry []string
+	for _, l := range lines {
+		if l != "" && !strings.HasPrefix(l, " ") {
+			// a space will be added when printed
+			l = " " + l
+		}
+		lead := l[:len(l)-len(strings.TrimLeft(l, " \t"))]
+		words := strings.Fields(l)
+		if len(carry) > 0 {
+			if len(words) > 0 && lead == " " && !isListItem(words[0]) {
+				words = append(carry, words...)
+				l = lead + strings.Join(words, " ")
+			} else {
+				wrapped = append(wrapped, fillCommentLine(" ", carry, width)...)
+			}
+			carry = nil
+		}
+		if len(words) == 0 || textWidth(0, l) <= width {
+			wrapped = append(wrapped, l)
+			continue
+		}
+		filled := fillCommentLine(lead, words, width)
+		if lead != " " {
+			// indented lines are likely pre-formatted, so don't reflow them
+			wrapped = append(wrapped, filled...)
+			continue
+		}
+		wrapped = append(wrapped, filled[:len(filled)-1]...)
+		carry = strings.Fields(filled[len(filled)-1])
+	}
+	if len(carry) > 0 {
+		wrapped = append(wrapped, fillCommentLine(" ", carry, width)...)
+	}
+	return wrapped
+}
+
+// fillCommentLine arranges the given words into as few lines as possible,
+// each starting with the given leading whitespace and fitting in the given
+// width. Words that are too long to fit are put on a line by themselves.
+func fillCommentLine(lead string, words []string, width int) []string {
+	var lines []string
+	var cur string
+	for _, word := range words {
+		if cur != "" && textWidth(0, cur+" "+word) > width {
+			lines = append(lines, cur)
+			cur = ""
+		}
+		if cur == "" {
+			cur = lead + word
+		} else {
+			cur += " " + word
+		}
+	}
+	return append(lines, cur)
+}
+
+// isListItem returns true if the given word looks like a list item marker,
+// such as "-", "*", or "1.".
+func isListItem(word string) bool {
+	switch word {
+	case "-", "*", "+":
+		return true
+	}
+	if len(word) < 2 || (word[len(word)-1] != '.' && word[len(word)-1] != ')') {
+		return false
+	}
+	for _, r := range word[:len(word)-1] {
+		if r < '0' || r > '9' {
+			return false
+		}
+	}
+	return true
+}
+
 func (p *Printer) indent(w io.Writer, indent int) {
 	for i := 0; i < indent; i++ {
 		_, _ = fmt.Fprint(w, p.Indent)
@@ -2829,6 +3208,10 @@ type writer struct {
 	err     error
 	space   bool
 	newline bool
+	// the column of the next character written, for enforcing MaxLineWidth
+	col int
+	// extra columns that will be added to the line when aligning fields
+	pad int
 }
 
 func newWriter(w io.Writer) *writer {
@@ -2851,6 +3234,7 @@ func (w *writer) Write(p []byte) (int, error) {
 				w.err = err
 				return 0, err
 			}
+			w.col++
 		}
 		w.space = false
 	}
@@ -2864,6 +3248,7 @@ func (w *writer) Write(p []byte) (int, error) {
 	}
 
 	num, err := w.Writer.Write(p)
+	w.col = advanceColumn(w.col, p[:num])
 	if err != nil {
 		w.err = err
 	} else if w.space {
@@ -2872,3 +3257,113 @@ func (w *writer) Write(p []byte) (int, error) {
 	}
 	return num, err
 }
+
+// lineWidthWriter keeps track of lines written through it that are wider than
+// a printer's MaxLineWidth.
+type lineWidthWriter struct {
+	io.Writer
+	max       int
+	line, col int
+	tooWide   []int
+}
+
+func (w *lineWidthWriter) Write(p []byte) (int, error) {
+	num, err := w.Writer.Write(p)
+	for _, b := range bytes.SplitAfter(p[:num], []byte{'\n'}) {
+		w.col = advanceColumn(w.col, bytes.TrimSuffix(b, []byte{'\n'}))
+		if len(b) > 0 && b[len(b)-1] == '\n' {
+			w.endLine()
+		}
+	}
+	return num, err
+}
+
+func (w *lineWidthWriter) endLine() {
+	w.line++
+	if w.col > w.max {
+		w.tooWide = append(w.tooWide, w.line)
+	}
+	w.col = 0
+}
+
+// check returns a *LineWidthError if any lines written were too wide.
+func (w *lineWidthWriter) check() error {
+	if w.col > 0 {
+		// last line has no trailing newline
+		w.endLine()
+	}
+	if len(w.tooWide) == 0 {
+		return nil
+	}
+	return &LineWidthError{MaxLineWidth: w.max, Lines: w.tooWide}
+}
+
+// column returns the column at which the next non-space character would be
+// written, accounting for any pending space.
+func (w *writer) column() int {
+	if w.space {
+		return w.col + w.pad + 1
+	}
+	return w.col + w.pad
+}
+
+// tabWidth is the number of columns to which tab stops are aligned when
+// computing line widths.
+const tabWidth = 8
+
+// advanceColumn returns the column that results from writing the given
+// bytes, starting at the given column. Form feeds, which are used as column
+// markers when aligning fields, do not occupy any width.
+func advanceColumn(col int, b []byte) int {
+	for len(b) > 0 {
+		r, sz := utf8.DecodeRune(b)
+		b = b[sz:]
+		switch r {
+		case '\n':
+			col = 0
+		case '\t':
+			col = (col/tabWidth + 1) * tabWidth
+		case '\f':
+		default:
+			col++
+		}
+	}
+	return col
+}
+
+// textWidth returns the number of columns occupied by the given string when
+// it is written starting at the given column. If the string spans multiple
+// lines, the width of the longest line is returned.
+func textWidth(col int, s string) int {
+	max := 0
+	for {
+		nl := strings.IndexByte(s, '\n')
+		line := s
+		if nl >= 0 {
+			line = s[:nl]
+		}
+		if end := advanceColumn(col, []byte(line)); end > max {
+			max = end
+		}
+		if nl < 0 {
+			return max
+		}
+		s = s[nl+1:]
+		col = 0
+	}
+}
+
+// exceedsWidth returns true if a MaxLineWidth is configured and the given
+// column is past it.
+func (p *Printer) exceedsWidth(col int) bool {
+	return p.MaxLineWidth > 0 && col > p.MaxLineWidth
+}
+
+// indentWidth returns the number of columns occupied by the given level of
+// indentation.
+func (p *Printer) indentWidth(indent int) int {
+	if indent < 0 {
+		indent = -indent
+	}
+	return advanceColumn(0, []byte(strings.Repeat(p.Indent, indent)))
+}
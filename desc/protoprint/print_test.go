@@ -2,11 +2,13 @@ package protoprint
 
 import (
 	"bytes"
+	"errors"
 	"fmt"
 	"io"
 	"io/ioutil"
 	"os"
 	"path/filepath"
+	"strings"
 	"testing"
 
 	"google.golang.org/protobuf/proto"
@@ -79,6 +81,7 @@ func TestPrinter(t *testing.T) {
 		"../../internal/testprotos/descriptor.protoset",
 		"../../internal/testprotos/desc_test1.protoset",
 		"../../internal/testprotos/proto3_optional/desc_test_proto3_optional.protoset",
+		"../../internal/testprotos/desc_test_editions.protoset",
 	}
 	fds := make([]*desc.FileDescriptor, len(files)+1)
 	for i, file := range files {
@@ -109,6 +112,74 @@ func TestPrinter(t *testing.T) {
 	}
 }
 
+func TestPrinterMaxLineWidth(t *testing.T) {
+	prs := map[string]*Printer{
+		"max-width-60":         {MaxLineWidth: 60},
+		"max-width-40-compact": {MaxLineWidth: 40, Indent: "\t", PreferMultiLineStyleComments: true, Compact: CompactAll},
+	}
+
+	files := []string{
+		"../../internal/testprotos/desc_test_comments.protoset",
+		"../../internal/testprotos/desc_test_complex_source_info.protoset",
+	}
+	for _, file := range files {
+		fd, err := loadProtoset(file)
+		testutil.Ok(t, err)
+		for name, pr := range prs {
+			baseName := filepath.Base(fd.GetName())
+			ext := filepath.Ext(baseName)
+			baseName = baseName[:len(baseName)-len(ext)]
+			goldenFile := fmt.Sprintf("%s-%s.proto", baseName, name)
+
+			var buf bytes.Buffer
+			err := pr.PrintProtoFile(fd, &buf)
+			// lines that can't be wrapped are reported
+			if tooWide := linesWiderThan(buf.String(), pr.MaxLineWidth); len(tooWide) == 0 {
+				testutil.Ok(t, err)
+			} else {
+				var lwErr *LineWidthError
+				testutil.Require(t, errors.As(err, &lwErr), "unexpected error: %v", err)
+				testutil.Eq(t, pr.MaxLineWidth, lwErr.MaxLineWidth)
+				testutil.Eq(t, tooWide, lwErr.Lines, "wrong lines reported for %s", goldenFile)
+			}
+
+			checkContents(t, buf.String(), goldenFile)
+		}
+	}
+
+	// the error is not returned if all lines fit
+	fd, err := desc.LoadFileDescriptor("desc_test1.proto")
+	testutil.Ok(t, err)
+	str, err := (&Printer{MaxLineWidth: 200}).PrintProtoToString(fd)
+	testutil.Ok(t, err)
+	testutil.Require(t, str != "")
+	// the output is still returned along with the error
+	str, err = (&Printer{MaxLineWidth: 10}).PrintProtoToString(fd)
+	var lwErr *LineWidthError
+	testutil.Require(t, errors.As(err, &lwErr), "unexpected error: %v", err)
+	testutil.Eq(t, linesWiderThan(str, 10), lwErr.Lines)
+}
+
+// linesWiderThan returns the numbers of the lines in s that are wider than the
+// given width, with tabs advancing to the next multiple of 8 columns.
+func linesWiderThan(s string, width int) []int {
+	var lines []int
+	for i, line := range strings.Split(strings.TrimSuffix(s, "\n"), "\n") {
+		col := 0
+		for _, r := range line {
+			if r == '\t' {
+				col = (col/8 + 1) * 8
+			} else {
+				col++
+			}
+		}
+		if col > width {
+			lines = append(lines, i+1)
+		}
+	}
+	return lines
+}
+
 func loadProtoset(path string) (*desc.FileDescriptor, error) {
 	var fds descriptorpb.FileDescriptorSet
 	f, err := os.Open(path)
@@ -208,3 +279,36 @@ func TestQuoteString(t *testing.T) {
 	s = quotedString("\U0010FFFF")
 	testutil.Eq(t, "\"\\U0010FFFF\"", s)
 }
+
+func TestSplitStringLiteral(t *testing.T) {
+	chunks := splitStringLiteral("the quick brown fox jumps over the lazy dog", quotedString, 20, 14)
+	testutil.Eq(t, []string{"the quick brown ", "fox jumps ", "over the ", "lazy dog"}, chunks)
+
+	// no spaces, so split after punctuation
+	chunks = splitStringLiteral("github.com/foo/bar/baz", quotedString, 16, 16)
+	testutil.Eq(t, []string{"github.com/", "foo/bar/baz"}, chunks)
+
+	// escapes are never split
+	chunks = splitStringLiteral("\x00\x01\x02", quotedBytes, 10, 10)
+	testutil.Eq(t, []string{"\x00\x01", "\x02"}, chunks)
+}
+
+func TestWrapCommentLines(t *testing.T) {
+	lines := wrapCommentLines([]string{
+		" This is a long comment that needs to be",
+		" wrapped and then reflowed.",
+		"",
+		"   indented lines are not reflowed",
+		" - nor are list items",
+	}, 24)
+	testutil.Eq(t, []string{
+		" This is a long comment",
+		" that needs to be",
+		" wrapped and then",
+		" reflowed.",
+		"",
+		"   indented lines are",
+		"   not reflowed",
+		" - nor are list items",
+	}, lines)
+}
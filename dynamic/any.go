@@ -0,0 +1,401 @@
+package dynamic
+
+// Expansion of google.protobuf.Any messages when marshalling and unmarshalling
+// dynamic messages to/from JSON and text formats
+
+import (
+	"encoding/json"
+	"fmt"
+
+	"github.com/golang/protobuf/jsonpb"
+)
+
+// DefaultAnyMaxDepth is the maximum nesting depth of expanded Any messages
+// used when AnyOptions.MaxDepth is zero.
+const DefaultAnyMaxDepth = 16
+
+// AnyOptions controls the expansion of google.protobuf.Any messages when
+// marshalling dynamic messages to JSON or text formats and when unmarshalling
+// them. When marshalling, the message embedded in an Any is resolved and
+// written in "expanded" form, using its fields, instead of as opaque bytes.
+// This is done recursively, so Any messages inside of the embedded message
+// are also expanded.
+//
+// If an Any's type cannot be resolved, if its value cannot be decoded, or if
+// the maximum depth has been reached, it is written in a raw form instead. In
+// the text format, the raw form is the Any's type_url and value fields. In
+// JSON, the raw form is an object with the type URL in an "@type" property,
+// like the expanded form, and the value as a base64-encoded string in a
+// "@value" property.
+//
+// When unmarshalling, both the expanded and the raw forms are accepted.
+type AnyOptions struct {
+	// The resolver used to resolve type URLs to message types. To resolve
+	// types via a TypeFetcher, this can be a *msgregistry.MessageRegistry that
+	// is configured with the fetcher.
+	//
+	// Types known to the descriptor of the message being processed (i.e.
+	// defined in its file or any of that file's transitive dependencies) and
+	// types linked into the program are resolved even if they are not known
+	// to this resolver. If nil, only such types can be resolved. For JSON, a
+	// nil resolver means that the AnyResolver configured in the jsonpb
+	// options is used.
+	Resolver jsonpb.AnyResolver
+	// The maximum number of nested Any messages that will be expanded. When
+	// marshalling, Any messages nested more deeply are written in raw form.
+	// When unmarshalling, expanded Any messages nested more deeply result in
+	// an error. If zero, DefaultAnyMaxDepth is used.
+	MaxDepth int
+}
+
+// anyExpansion tracks the state of Any expansion during a single marshal or
+// unmarshal operation.
+type anyExpansion struct {
+	resolver jsonpb.AnyResolver
+	maxDepth int
+	depth    int
+}
+
+func newAnyExpansion(opts *AnyOptions) *anyExpansion {
+	if opts == nil {
+		return nil
+	}
+	maxDepth := opts.MaxDepth
+	if maxDepth == 0 {
+		maxDepth = DefaultAnyMaxDepth
+	}
+	return &anyExpansion{resolver: opts.Resolver, maxDepth: maxDepth}
+}
+
+func isAny(m *Message) bool {
+	return m.md.GetFullyQualifiedName() == "google.protobuf.Any"
+}
+
+// resolve returns an empty dynamic message for the given type URL, resolved
+// using the given resolver.
+func (ax *anyExpansion) resolve(m *Message, r jsonpb.AnyResolver, typeUrl string) (*Message, error) {
+	if ax.depth >= ax.maxDepth {
+		return nil, fmt.Errorf("exceeded maximum depth of %d nested Any messages", ax.maxDepth)
+	}
+	pm, err := r.Resolve(typeUrl)
+	if err != nil {
+		return nil, err
+	}
+	return AsDynamicMessageWithMessageFactory(pm, m.mf)
+}
+
+// expand returns the type URL of the given Any message and its embedded
+// message. It returns nil if the Any should be written in raw form instead.
+func (ax *anyExpansion) expand(m *Message, r jsonpb.AnyResolver) (string, *Message) {
+	typeUrl, _ := m.GetFieldByNumber(1).(string)
+	if typeUrl == "" {
+		return "", nil
+	}
+	dm, err := ax.resolve(m, r, typeUrl)
+	if err != nil {
+		return "", nil
+	}
+	value, _ := m.GetFieldByNumber(2).([]byte)
+	if err := dm.Unmarshal(value); err != nil {
+		return "", nil
+	}
+	return typeUrl, dm
+}
+
+// JSONMarshaler marshals dynamic messages to JSON, with control over how Any
+// messages are expanded.
+type JSONMarshaler struct {
+	// Options for the JSON format.
+	JSONPB jsonpb.Marshaler
+	// Options for expanding Any messages. If nil, Any messages are handled
+	// as they are by Message.MarshalJSONPB.
+	Any *AnyOptions
+}
+
+// Marshal serializes the given message to bytes in JSON format.
+func (jm *JSONMarshaler) Marshal(m *Message) ([]byte, error) {
+	opts := jm.JSONPB
+	if jm.Any != nil && jm.Any.Resolver != nil {
+		opts.AnyResolver = jm.Any.Resolver
+	}
+	var b indentBuffer
+	b.indent = opts.Indent
+	if len(opts.Indent) == 0 {
+		b.indentCount = -1
+	}
+	b.comma = true
+	b.anyx = newAnyExpansion(jm.Any)
+	if err := m.marshalJSON(&b, &opts); err != nil {
+		return nil, err
+	}
+	return b.Bytes(), nil
+}
+
+// JSONUnmarshaler unmarshals dynamic messages from JSON, with control over how
+// Any messages are expanded.
+type JSONUnmarshaler struct {
+	// Options for the JSON format.
+	JSONPB jsonpb.Unmarshaler
+	// Options for expanding Any messages. If nil, Any messages are handled
+	// as they are by Message.UnmarshalJSONPB.
+	Any *AnyOptions
+}
+
+// Unmarshal de-serializes the message that is present, in JSON format, in the
+// given bytes into the given message. It first resets the message.
+func (ju *JSONUnmarshaler) Unmarshal(js []byte, m *Message) error {
+	m.Reset()
+	if err := ju.UnmarshalMerge(js, m); err != nil {
+		return err
+	}
+	return m.Validate()
+}
+
+// UnmarshalMerge de-serializes the message that is present, in JSON format, in
+// the given bytes into the given message, merging the data into any existing
+// data in the message.
+func (ju *JSONUnmarshaler) UnmarshalMerge(js []byte, m *Message) error {
+	opts := ju.JSONPB
+	if ju.Any != nil && ju.Any.Resolver != nil {
+		opts.AnyResolver = ju.Any.Resolver
+	}
+	r := newJsReader(js)
+	r.anyx = newAnyExpansion(ju.Any)
+	return m.unmarshalJSONMerge(r, &opts)
+}
+
+// TextMarshaler marshals dynamic messages to the standard text format, with
+// control over layout and how Any messages are expanded.
+type TextMarshaler struct {
+	// If true, each field is on its own line and nested messages are indented.
+	// Otherwise, a compact form is used: no newlines, and spaces between field
+	// identifiers and values are elided.
+	Multiline bool
+	// The string used for each level of indentation. If non-empty, the
+	// multi-line form is used even if Multiline is false. If empty and
+	// Multiline is true, two spaces are used.
+	Indent string
+	// Options for expanding Any messages. If nil, Any messages are written
+	// using their type_url and value fields.
+	Any *AnyOptions
+}
+
+// Marshal serializes the given message to bytes in the standard text format.
+func (tm *TextMarshaler) Marshal(m *Message) ([]byte, error) {
+	var b indentBuffer
+	b.indent = tm.Indent
+	if len(b.indent) == 0 {
+		if tm.Multiline {
+			b.indent = "  "
+		} else {
+			b.indentCount = -1 // no indentation
+		}
+	}
+	b.anyx = newAnyExpansion(tm.Any)
+	if err := m.marshalText(&b); err != nil {
+		return nil, err
+	}
+	return b.Bytes(), nil
+}
+
+// TextUnmarshaler unmarshals dynamic messages from the standard text format,
+// with control over how Any messages are expanded.
+type TextUnmarshaler struct {
+	// Options for expanding Any messages. If nil, only types known to the
+	// message's descriptor or linked into the program can be used in expanded
+	// Any messages, and their depth is not limited.
+	Any *AnyOptions
+}
+
+// Unmarshal de-serializes the message that is present, in text format, in the
+// given bytes into the given message. It first resets the message.
+func (tu *TextUnmarshaler) Unmarshal(text []byte, m *Message) error {
+	m.Reset()
+	if err := tu.UnmarshalMerge(text, m); err != nil {
+		return err
+	}
+	return m.Validate()
+}
+
+// UnmarshalMerge de-serializes the message that is present, in text format, in
+// the given bytes into the given message, merging the data into any existing
+// data in the message.
+func (tu *TextUnmarshaler) UnmarshalMerge(text []byte, m *Message) error {
+	tr := newReader(text)
+	tr.anyx = newAnyExpansion(tu.Any)
+	return m.unmarshalText(tr, tokenEOF)
+}
+
+func marshalAnyJSON(m *Message, b *indentBuffer, opts *jsonpb.Marshaler) error {
+	typeUrl, dm := b.anyx.expand(m, opts.AnyResolver)
+	if typeUrl == "" {
+		typeUrl, _ = m.GetFieldByNumber(1).(string)
+		value, _ := m.GetFieldByNumber(2).([]byte)
+		if typeUrl == "" && len(value) == 0 {
+			// empty Any
+			_, err := b.WriteString("{}")
+			return err
+		}
+	}
+
+	err := b.WriteByte('{')
+	if err != nil {
+		return err
+	}
+	err = b.start()
+	if err != nil {
+		return err
+	}
+	err = writeJsonString(b, "@type")
+	if err != nil {
+		return err
+	}
+	err = b.sep()
+	if err != nil {
+		return err
+	}
+	err = writeJsonString(b, typeUrl)
+	if err != nil {
+		return err
+	}
+
+	if dm == nil {
+		// raw form
+		err = b.next()
+		if err != nil {
+			return err
+		}
+		err = writeJsonString(b, "@value")
+		if err != nil {
+			return err
+		}
+		err = b.sep()
+		if err != nil {
+			return err
+		}
+		value, _ := m.GetFieldByNumber(2).([]byte)
+		data, err := json.Marshal(value)
+		if err != nil {
+			return err
+		}
+		_, err = b.Write(data)
+		if err != nil {
+			return err
+		}
+	} else {
+		b.anyx.depth++
+		defer func() {
+			b.anyx.depth--
+		}()
+		if _, ok := wellKnownTypeNames[dm.md.GetFullyQualifiedName()]; ok {
+			// well-known types with special JSON formats go in a "value" property
+			err = b.next()
+			if err != nil {
+				return err
+			}
+			err = writeJsonString(b, "value")
+			if err != nil {
+				return err
+			}
+			err = b.sep()
+			if err != nil {
+				return err
+			}
+			err = dm.marshalJSON(b, opts)
+		} else {
+			first := false
+			err = dm.marshalJSONFields(b, opts, &first)
+		}
+		if err != nil {
+			return err
+		}
+	}
+
+	err = b.end()
+	if err != nil {
+		return err
+	}
+	return b.WriteByte('}')
+}
+
+func (m *Message) unmarshalAnyJSON(r *jsReader, opts *jsonpb.Unmarshaler) error {
+	t, err := r.peek()
+	if err != nil {
+		return err
+	}
+	if t == nil {
+		// if json is simply "null" we do nothing
+		r.poll()
+		return nil
+	}
+
+	var js json.RawMessage
+	if err := json.NewDecoder(r.unread()).Decode(&js); err != nil {
+		return err
+	}
+	if err := r.skip(); err != nil {
+		return err
+	}
+	var obj map[string]json.RawMessage
+	if err := json.Unmarshal(js, &obj); err != nil {
+		return fmt.Errorf("google.protobuf.Any must be a JSON object: %v", err)
+	}
+	if len(obj) == 0 {
+		// empty Any
+		return nil
+	}
+	rawType, ok := obj["@type"]
+	if !ok {
+		return fmt.Errorf("google.protobuf.Any is missing \"@type\" property")
+	}
+	var typeUrl string
+	if err := json.Unmarshal(rawType, &typeUrl); err != nil {
+		return fmt.Errorf("google.protobuf.Any has invalid \"@type\" property: %v", err)
+	}
+	if err := m.TrySetFieldByNumber(1, typeUrl); err != nil {
+		return err
+	}
+
+	if rawValue, ok := obj["@value"]; ok {
+		// raw form
+		if len(obj) != 2 {
+			return fmt.Errorf("google.protobuf.Any with \"@value\" property may have no other properties besides \"@type\"")
+		}
+		var value []byte
+		if err := json.Unmarshal(rawValue, &value); err != nil {
+			return fmt.Errorf("google.protobuf.Any has invalid \"@value\" property: %v", err)
+		}
+		return m.TrySetFieldByNumber(2, value)
+	}
+
+	dm, err := r.anyx.resolve(m, opts.AnyResolver, typeUrl)
+	if err != nil {
+		return fmt.Errorf("could not resolve type of google.protobuf.Any %q: %v", typeUrl, err)
+	}
+	var inner []byte
+	if _, ok := wellKnownTypeNames[dm.md.GetFullyQualifiedName()]; ok {
+		inner, ok = obj["value"]
+		if !ok || len(obj) != 2 {
+			return fmt.Errorf("google.protobuf.Any with well-known type %q must have exactly one other property, \"value\"", typeUrl)
+		}
+	} else {
+		delete(obj, "@type")
+		if inner, err = json.Marshal(obj); err != nil {
+			return err
+		}
+	}
+	ir := newJsReader(inner)
+	ir.anyx = r.anyx
+	r.anyx.depth++
+	defer func() {
+		r.anyx.depth--
+	}()
+	if err := dm.unmarshalJson(ir, opts); err != nil {
+		return err
+	}
+	value, err := dm.Marshal()
+	if err != nil {
+		return err
+	}
+	return m.TrySetFieldByNumber(2, value)
+}
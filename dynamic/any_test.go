@@ -0,0 +1,245 @@
+package dynamic
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/golang/protobuf/jsonpb"
+	"github.com/golang/protobuf/proto"
+	"google.golang.org/protobuf/types/descriptorpb"
+	"google.golang.org/protobuf/types/known/anypb"
+	"google.golang.org/protobuf/types/known/durationpb"
+
+	"github.com/jhump/protoreflect/desc"
+	"github.com/jhump/protoreflect/internal/testprotos"
+	"github.com/jhump/protoreflect/internal/testutil"
+)
+
+func newAny(t *testing.T, msg proto.Message) *anypb.Any {
+	a, err := anypb.New(proto.MessageV2(msg))
+	testutil.Ok(t, err)
+	return a
+}
+
+// nestedAnyMessage returns a message with an Any that embeds another Any.
+func nestedAnyMessage(t *testing.T) *Message {
+	inner := &testprotos.TestWellKnownTypes{
+		Extras: []*anypb.Any{newAny(t, &testprotos.TestRequest{Bar: "abc"})},
+	}
+	msg := &testprotos.TestWellKnownTypes{
+		Extras: []*anypb.Any{newAny(t, inner), newAny(t, durationpb.New(time.Second))},
+	}
+	dm, err := AsDynamicMessage(msg)
+	testutil.Ok(t, err)
+	return dm
+}
+
+func TestJSONMarshaler_ExpandAny(t *testing.T) {
+	dm := nestedAnyMessage(t)
+	jm := JSONMarshaler{Any: &AnyOptions{}}
+	js, err := jm.Marshal(dm)
+	testutil.Ok(t, err)
+	testutil.Eq(t, `{"extras":[`+
+		`{"@type":"type.googleapis.com/testprotos.TestWellKnownTypes","extras":[{"@type":"type.googleapis.com/testprotos.TestRequest","bar":"abc"}]},`+
+		`{"@type":"type.googleapis.com/google.protobuf.Duration","value":"1s"}]}`, string(js))
+
+	// same as the output of jsonpb for generated messages
+	var generated testprotos.TestWellKnownTypes
+	testutil.Ok(t, dm.ConvertTo(&generated))
+	expected, err := (&jsonpb.Marshaler{}).MarshalToString(&generated)
+	testutil.Ok(t, err)
+	testutil.Eq(t, expected, string(js))
+
+	ju := JSONUnmarshaler{Any: &AnyOptions{}}
+	dm2 := NewMessage(dm.GetMessageDescriptor())
+	testutil.Ok(t, ju.Unmarshal(js, dm2))
+	testutil.Require(t, MessagesEqual(dm, dm2), "%v != %v", dm, dm2)
+
+	// indentation
+	jm.JSONPB.Indent = "  "
+	js, err = jm.Marshal(dm)
+	testutil.Ok(t, err)
+	testutil.Require(t, strings.Contains(string(js), "\n    {\n      \"@type\": \"type.googleapis.com/testprotos.TestWellKnownTypes\",\n      \"extras\": ["), "unexpected output: %s", js)
+	dm2.Reset()
+	testutil.Ok(t, ju.Unmarshal(js, dm2))
+	testutil.Require(t, MessagesEqual(dm, dm2), "%v != %v", dm, dm2)
+}
+
+func TestJSONMarshaler_RawAny(t *testing.T) {
+	msg := &testprotos.TestWellKnownTypes{
+		Extras: []*anypb.Any{
+			{TypeUrl: "type.example.com/foo.Unknown", Value: []byte{1, 2}},
+			// valid type, but invalid value
+			{TypeUrl: "type.googleapis.com/testprotos.TestRequest", Value: []byte{0xff}},
+			{},
+		},
+	}
+	dm, err := AsDynamicMessage(msg)
+	testutil.Ok(t, err)
+	js, err := (&JSONMarshaler{Any: &AnyOptions{}}).Marshal(dm)
+	testutil.Ok(t, err)
+	testutil.Eq(t, `{"extras":[`+
+		`{"@type":"type.example.com/foo.Unknown","@value":"AQI="},`+
+		`{"@type":"type.googleapis.com/testprotos.TestRequest","@value":"/w=="},`+
+		`{}]}`, string(js))
+
+	dm2 := NewMessage(dm.GetMessageDescriptor())
+	testutil.Ok(t, (&JSONUnmarshaler{Any: &AnyOptions{}}).Unmarshal(js, dm2))
+	testutil.Require(t, MessagesEqual(dm, dm2), "%v != %v", dm, dm2)
+
+	for name, js := range map[string]string{
+		"unknown type":      `{"extras":[{"@type":"type.example.com/foo.Unknown","a":1}]}`,
+		"missing type":      `{"extras":[{"bar":"abc"}]}`,
+		"raw with fields":   `{"extras":[{"@type":"type.example.com/foo.Unknown","@value":"AQI=","a":1}]}`,
+		"bad raw value":     `{"extras":[{"@type":"type.example.com/foo.Unknown","@value":123}]}`,
+		"wkt without value": `{"extras":[{"@type":"type.googleapis.com/google.protobuf.Duration","seconds":1}]}`,
+	} {
+		err := (&JSONUnmarshaler{Any: &AnyOptions{}}).Unmarshal([]byte(js), dm2)
+		testutil.Nok(t, err, "%s: expected error", name)
+	}
+}
+
+func TestJSONMarshaler_AnyMaxDepth(t *testing.T) {
+	dm := nestedAnyMessage(t)
+	js, err := (&JSONMarshaler{Any: &AnyOptions{MaxDepth: 1}}).Marshal(dm)
+	testutil.Ok(t, err)
+	testutil.Eq(t, `{"extras":[`+
+		`{"@type":"type.googleapis.com/testprotos.TestWellKnownTypes","extras":[{"@type":"type.googleapis.com/testprotos.TestRequest","@value":"EgNhYmM="}]},`+
+		`{"@type":"type.googleapis.com/google.protobuf.Duration","value":"1s"}]}`, string(js))
+	dm2 := NewMessage(dm.GetMessageDescriptor())
+	testutil.Ok(t, (&JSONUnmarshaler{Any: &AnyOptions{MaxDepth: 1}}).Unmarshal(js, dm2))
+	testutil.Require(t, MessagesEqual(dm, dm2), "%v != %v", dm, dm2)
+
+	// fully expanded input is too deep
+	js, err = (&JSONMarshaler{Any: &AnyOptions{}}).Marshal(dm)
+	testutil.Ok(t, err)
+	err = (&JSONUnmarshaler{Any: &AnyOptions{MaxDepth: 1}}).Unmarshal(js, dm2)
+	testutil.Require(t, err != nil && strings.Contains(err.Error(), "maximum depth"), "unexpected error: %v", err)
+}
+
+// unlinkedFile returns a file with a message type that is not linked into the
+// program, so it can only be resolved by a resolver that knows about it.
+func unlinkedFile(t *testing.T) *desc.FileDescriptor {
+	anyFile, err := desc.LoadFileDescriptor("google/protobuf/any.proto")
+	testutil.Ok(t, err)
+	fd, err := desc.CreateFileDescriptor(&descriptorpb.FileDescriptorProto{
+		Name:       proto.String("unlinked.proto"),
+		Package:    proto.String("unlinked"),
+		Dependency: []string{"google/protobuf/any.proto"},
+		MessageType: []*descriptorpb.DescriptorProto{{
+			Name: proto.String("Thing"),
+			Field: []*descriptorpb.FieldDescriptorProto{
+				{
+					Name:     proto.String("name"),
+					JsonName: proto.String("name"),
+					Number:   proto.Int32(1),
+					Label:    descriptorpb.FieldDescriptorProto_LABEL_OPTIONAL.Enum(),
+					Type:     descriptorpb.FieldDescriptorProto_TYPE_STRING.Enum(),
+				},
+			},
+		}},
+	}, anyFile)
+	testutil.Ok(t, err)
+	return fd
+}
+
+func TestAnyOptions_Resolver(t *testing.T) {
+	fd := unlinkedFile(t)
+	thing := NewMessage(fd.FindMessage("unlinked.Thing"))
+	thing.SetFieldByName("name", "widget")
+	data, err := thing.Marshal()
+	testutil.Ok(t, err)
+	dm, err := AsDynamicMessage(&testprotos.TestWellKnownTypes{
+		Extras: []*anypb.Any{{TypeUrl: "type.example.com/unlinked.Thing", Value: data}},
+	})
+	testutil.Ok(t, err)
+
+	// without a resolver, the type is unknown
+	js, err := (&JSONMarshaler{Any: &AnyOptions{}}).Marshal(dm)
+	testutil.Ok(t, err)
+	testutil.Eq(t, `{"extras":[{"@type":"type.example.com/unlinked.Thing","@value":"CgZ3aWRnZXQ="}]}`, string(js))
+	txt, err := (&TextMarshaler{Any: &AnyOptions{}}).Marshal(dm)
+	testutil.Ok(t, err)
+	testutil.Eq(t, `extras:<type_url:"type.example.com/unlinked.Thing" value:"\n\006widget">`, string(txt))
+
+	anyOpts := &AnyOptions{Resolver: AnyResolver(nil, fd)}
+	js, err = (&JSONMarshaler{Any: anyOpts}).Marshal(dm)
+	testutil.Ok(t, err)
+	testutil.Eq(t, `{"extras":[{"@type":"type.example.com/unlinked.Thing","name":"widget"}]}`, string(js))
+	dm2 := NewMessage(dm.GetMessageDescriptor())
+	testutil.Ok(t, (&JSONUnmarshaler{Any: anyOpts}).Unmarshal(js, dm2))
+	testutil.Require(t, MessagesEqual(dm, dm2), "%v != %v", dm, dm2)
+
+	txt, err = (&TextMarshaler{Any: anyOpts}).Marshal(dm)
+	testutil.Ok(t, err)
+	testutil.Eq(t, `extras:<[type.example.com/unlinked.Thing]:<name:"widget">>`, string(txt))
+	dm2.Reset()
+	testutil.Ok(t, (&TextUnmarshaler{Any: anyOpts}).Unmarshal(txt, dm2))
+	testutil.Require(t, MessagesEqual(dm, dm2), "%v != %v", dm, dm2)
+	// the default unmarshaler can't resolve the type
+	testutil.Nok(t, dm2.UnmarshalText(txt))
+}
+
+func TestTextMarshaler_ExpandAny(t *testing.T) {
+	dm := nestedAnyMessage(t)
+	tm := TextMarshaler{Any: &AnyOptions{}}
+	txt, err := tm.Marshal(dm)
+	testutil.Ok(t, err)
+	testutil.Eq(t, `extras:<[type.googleapis.com/testprotos.TestWellKnownTypes]:<extras:<[type.googleapis.com/testprotos.TestRequest]:<bar:"abc">>>> `+
+		`extras:<[type.googleapis.com/google.protobuf.Duration]:<seconds:1>>`, string(txt))
+
+	tu := TextUnmarshaler{Any: &AnyOptions{}}
+	dm2 := NewMessage(dm.GetMessageDescriptor())
+	testutil.Ok(t, tu.Unmarshal(txt, dm2))
+	testutil.Require(t, MessagesEqual(dm, dm2), "%v != %v", dm, dm2)
+	// default unmarshaler can also parse it, since all types are linked in
+	dm2.Reset()
+	testutil.Ok(t, dm2.UnmarshalText(txt))
+	testutil.Require(t, MessagesEqual(dm, dm2), "%v != %v", dm, dm2)
+	// braces, colons, and comments are also allowed
+	dm2.Reset()
+	testutil.Ok(t, tu.Unmarshal([]byte(`
+extras {
+  [type.googleapis.com/testprotos.TestWellKnownTypes]: {
+    # nested Any
+    extras { [type.googleapis.com/testprotos.TestRequest] { bar: "abc" } }
+  }
+}
+extras { [type.googleapis.com/google.protobuf.Duration] { seconds: 0x1 } }`), dm2))
+	testutil.Require(t, MessagesEqual(dm, dm2), "%v != %v", dm, dm2)
+
+	tm.Indent = "  "
+	txt, err = tm.Marshal(dm)
+	testutil.Ok(t, err)
+	testutil.Eq(t, `extras: <
+  [type.googleapis.com/testprotos.TestWellKnownTypes]: <
+    extras: <
+      [type.googleapis.com/testprotos.TestRequest]: <
+        bar: "abc"
+      >
+    >
+  >
+>
+extras: <
+  [type.googleapis.com/google.protobuf.Duration]: <
+    seconds: 1
+  >
+>`, string(txt))
+	dm2.Reset()
+	testutil.Ok(t, tu.Unmarshal(txt, dm2))
+	testutil.Require(t, MessagesEqual(dm, dm2), "%v != %v", dm, dm2)
+
+	// depth limit
+	txt, err = (&TextMarshaler{Any: &AnyOptions{MaxDepth: 1}}).Marshal(dm)
+	testutil.Ok(t, err)
+	testutil.Eq(t, `extras:<[type.googleapis.com/testprotos.TestWellKnownTypes]:<extras:<type_url:"type.googleapis.com/testprotos.TestRequest" value:"\022\003abc">>> `+
+		`extras:<[type.googleapis.com/google.protobuf.Duration]:<seconds:1>>`, string(txt))
+	dm2.Reset()
+	testutil.Ok(t, (&TextUnmarshaler{Any: &AnyOptions{MaxDepth: 1}}).Unmarshal(txt, dm2))
+	testutil.Require(t, MessagesEqual(dm, dm2), "%v != %v", dm, dm2)
+	txt, err = (&TextMarshaler{Any: &AnyOptions{}}).Marshal(dm)
+	testutil.Ok(t, err)
+	err = (&TextUnmarshaler{Any: &AnyOptions{MaxDepth: 1}}).Unmarshal(txt, dm2)
+	testutil.Require(t, err != nil && strings.Contains(err.Error(), "maximum depth"), "unexpected error: %v", err)
+}
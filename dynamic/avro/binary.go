@@ -0,0 +1,328 @@
+package avro
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+
+	"github.com/jhump/protoreflect/dynamic"
+)
+
+// MarshalBinary encodes the given message using the Avro binary encoding. The
+// data is encoded using the schema returned by SchemaForMessage for the
+// message's descriptor. Like other Avro data, the result does not include the
+// schema, so readers need to acquire it separately.
+func MarshalBinary(m *dynamic.Message) ([]byte, error) {
+	s := SchemaForMessage(m.GetMessageDescriptor())
+	rec, err := messageToDatum(s, m)
+	if err != nil {
+		return nil, err
+	}
+	var buf []byte
+	if err := appendBinary(&buf, s, rec); err != nil {
+		return nil, err
+	}
+	return buf, nil
+}
+
+// UnmarshalBinary decodes the given data, in the Avro binary encoding, into the
+// given message. The data must have been encoded using the schema returned by
+// SchemaForMessage for the message's descriptor. The message is reset before
+// decoding, and it is an error if any data remains after the record is read.
+func UnmarshalBinary(data []byte, m *dynamic.Message) error {
+	s := SchemaForMessage(m.GetMessageDescriptor())
+	r := binaryReader{data: data}
+	d, err := r.read(s)
+	if err != nil {
+		return err
+	}
+	if len(r.data) > 0 {
+		return fmt.Errorf("%d bytes of unexpected data after record", len(r.data))
+	}
+	m.Reset()
+	return datumToMessage(s, d.([]interface{}), m)
+}
+
+func appendBinary(buf *[]byte, s *Schema, d interface{}) error {
+	switch s.Type {
+	case TypeNull:
+	case TypeBoolean:
+		if d.(bool) {
+			*buf = append(*buf, 1)
+		} else {
+			*buf = append(*buf, 0)
+		}
+	case TypeInt:
+		*buf = appendLong(*buf, int64(d.(int32)))
+	case TypeLong:
+		*buf = appendLong(*buf, d.(int64))
+	case TypeFloat:
+		var b [4]byte
+		binary.LittleEndian.PutUint32(b[:], math.Float32bits(d.(float32)))
+		*buf = append(*buf, b[:]...)
+	case TypeDouble:
+		var b [8]byte
+		binary.LittleEndian.PutUint64(b[:], math.Float64bits(d.(float64)))
+		*buf = append(*buf, b[:]...)
+	case TypeBytes:
+		b := d.([]byte)
+		*buf = appendLong(*buf, int64(len(b)))
+		*buf = append(*buf, b...)
+	case TypeString:
+		str := d.(string)
+		*buf = appendLong(*buf, int64(len(str)))
+		*buf = append(*buf, str...)
+	case TypeFixed:
+		b := d.([]byte)
+		if len(b) != s.Size {
+			return fmt.Errorf("fixed %s needs %d bytes, got %d", s.FullName(), s.Size, len(b))
+		}
+		*buf = append(*buf, b...)
+	case TypeEnum:
+		*buf = appendLong(*buf, int64(d.(int)))
+	case TypeRecord:
+		for i, f := range s.Fields {
+			if err := appendBinary(buf, f.Type, d.([]interface{})[i]); err != nil {
+				return err
+			}
+		}
+	case TypeArray:
+		items := d.([]interface{})
+		// all items are written in a single block
+		if len(items) > 0 {
+			*buf = appendLong(*buf, int64(len(items)))
+			for _, item := range items {
+				if err := appendBinary(buf, s.Items, item); err != nil {
+					return err
+				}
+			}
+		}
+		*buf = append(*buf, 0)
+	case TypeMap:
+		vals := d.(map[string]interface{})
+		if len(vals) > 0 {
+			*buf = appendLong(*buf, int64(len(vals)))
+			for _, k := range sortedKeys(vals) {
+				*buf = appendLong(*buf, int64(len(k)))
+				*buf = append(*buf, k...)
+				if err := appendBinary(buf, s.Values, vals[k]); err != nil {
+					return err
+				}
+			}
+		}
+		*buf = append(*buf, 0)
+	case TypeUnion:
+		u := d.(unionValue)
+		*buf = appendLong(*buf, int64(u.index))
+		return appendBinary(buf, s.Branches[u.index], u.value)
+	default:
+		return fmt.Errorf("unknown schema type %q", s.Type)
+	}
+	return nil
+}
+
+// appendLong appends v in the zig-zag varint form used by Avro for both "int"
+// and "long" values.
+func appendLong(buf []byte, v int64) []byte {
+	var b [binary.MaxVarintLen64]byte
+	n := binary.PutVarint(b[:], v)
+	return append(buf, b[:n]...)
+}
+
+type binaryReader struct {
+	data []byte
+}
+
+func (r *binaryReader) read(s *Schema) (interface{}, error) {
+	switch s.Type {
+	case TypeNull:
+		return nil, nil
+	case TypeBoolean:
+		b, err := r.next(1)
+		if err != nil {
+			return nil, err
+		}
+		return b[0] != 0, nil
+	case TypeInt:
+		v, err := r.long()
+		if err != nil {
+			return nil, err
+		}
+		if v < math.MinInt32 || v > math.MaxInt32 {
+			return nil, fmt.Errorf("value %d is out of range for int", v)
+		}
+		return int32(v), nil
+	case TypeLong:
+		return r.long()
+	case TypeFloat:
+		b, err := r.next(4)
+		if err != nil {
+			return nil, err
+		}
+		return math.Float32frombits(binary.LittleEndian.Uint32(b)), nil
+	case TypeDouble:
+		b, err := r.next(8)
+		if err != nil {
+			return nil, err
+		}
+		return math.Float64frombits(binary.LittleEndian.Uint64(b)), nil
+	case TypeBytes:
+		b, err := r.bytes()
+		if err != nil {
+			return nil, err
+		}
+		return append([]byte{}, b...), nil
+	case TypeString:
+		b, err := r.bytes()
+		if err != nil {
+			return nil, err
+		}
+		return string(b), nil
+	case TypeFixed:
+		b, err := r.next(s.Size)
+		if err != nil {
+			return nil, err
+		}
+		return append([]byte{}, b...), nil
+	case TypeEnum:
+		idx, err := r.index(len(s.Symbols), "enum symbol")
+		if err != nil {
+			return nil, fmt.Errorf("enum %s: %w", s.FullName(), err)
+		}
+		return idx, nil
+	case TypeRecord:
+		rec := make([]interface{}, len(s.Fields))
+		for i, f := range s.Fields {
+			var err error
+			if rec[i], err = r.read(f.Type); err != nil {
+				return nil, fmt.Errorf("%s.%s: %w", s.FullName(), f.Name, err)
+			}
+		}
+		return rec, nil
+	case TypeArray:
+		items := []interface{}{}
+		err := r.blocks(isEmpty(s.Items), func() error {
+			item, err := r.read(s.Items)
+			if err != nil {
+				return err
+			}
+			items = append(items, item)
+			return nil
+		})
+		if err != nil {
+			return nil, err
+		}
+		return items, nil
+	case TypeMap:
+		vals := map[string]interface{}{}
+		err := r.blocks(false, func() error {
+			k, err := r.bytes()
+			if err != nil {
+				return err
+			}
+			v, err := r.read(s.Values)
+			if err != nil {
+				return err
+			}
+			vals[string(k)] = v
+			return nil
+		})
+		if err != nil {
+			return nil, err
+		}
+		return vals, nil
+	case TypeUnion:
+		idx, err := r.index(len(s.Branches), "union member")
+		if err != nil {
+			return nil, err
+		}
+		v, err := r.read(s.Branches[idx])
+		if err != nil {
+			return nil, err
+		}
+		return unionValue{index: idx, value: v}, nil
+	default:
+		return nil, fmt.Errorf("unknown schema type %q", s.Type)
+	}
+}
+
+func (r *binaryReader) next(n int) ([]byte, error) {
+	if n < 0 || len(r.data) < n {
+		return nil, io.ErrUnexpectedEOF
+	}
+	b := r.data[:n]
+	r.data = r.data[n:]
+	return b, nil
+}
+
+func (r *binaryReader) long() (int64, error) {
+	v, n := binary.Varint(r.data)
+	if n <= 0 {
+		if n == 0 {
+			return 0, io.ErrUnexpectedEOF
+		}
+		return 0, errors.New("varint overflows a 64-bit integer")
+	}
+	r.data = r.data[n:]
+	return v, nil
+}
+
+func (r *binaryReader) bytes() ([]byte, error) {
+	l, err := r.long()
+	if err != nil {
+		return nil, err
+	}
+	if l < 0 || l > int64(len(r.data)) {
+		return nil, io.ErrUnexpectedEOF
+	}
+	return r.next(int(l))
+}
+
+func (r *binaryReader) index(limit int, what string) (int, error) {
+	v, err := r.long()
+	if err != nil {
+		return 0, err
+	}
+	if v < 0 || v >= int64(limit) {
+		return 0, fmt.Errorf("%s index %d is out of range", what, v)
+	}
+	return int(v), nil
+}
+
+// blocks reads the blocks of an array or map, calling fn for each item. If
+// emptyItems is true, items can be encoded with zero bytes, like a record
+// with no fields.
+func (r *binaryReader) blocks(emptyItems bool, fn func() error) error {
+	for {
+		count, err := r.long()
+		if err != nil {
+			return err
+		}
+		if count == 0 {
+			return nil
+		}
+		if count < 0 {
+			// a negative count is followed by the size of the block in
+			// bytes, which is only useful for skipping it
+			count = -count
+			if _, err := r.long(); err != nil {
+				return err
+			}
+		}
+		if count > int64(len(r.data)) && !emptyItems {
+			// sanity check, since each item needs at least one byte
+			return io.ErrUnexpectedEOF
+		}
+		for i := int64(0); i < count; i++ {
+			if err := fn(); err != nil {
+				return err
+			}
+		}
+	}
+}
+
+func isEmpty(s *Schema) bool {
+	return s.Type == TypeNull || (s.Type == TypeRecord && len(s.Fields) == 0)
+}
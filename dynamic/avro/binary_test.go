@@ -0,0 +1,171 @@
+package avro
+
+import (
+	"math"
+	"testing"
+	"time"
+
+	"github.com/golang/protobuf/proto"
+	"google.golang.org/protobuf/types/known/anypb"
+	"google.golang.org/protobuf/types/known/durationpb"
+	"google.golang.org/protobuf/types/known/structpb"
+	"google.golang.org/protobuf/types/known/timestamppb"
+	"google.golang.org/protobuf/types/known/wrapperspb"
+
+	"github.com/jhump/protoreflect/desc"
+	"github.com/jhump/protoreflect/dynamic"
+	"github.com/jhump/protoreflect/internal/testprotos"
+	"github.com/jhump/protoreflect/internal/testutil"
+)
+
+func testMessages(t *testing.T) []proto.Message {
+	anyVal, err := anypb.New(&testprotos.TestRequest{Bar: "abc"})
+	testutil.Ok(t, err)
+	return []proto.Message{
+		&testprotos.UnaryFields{
+			I: proto.Int32(-123), J: proto.Int64(math.MinInt64), K: proto.Int32(-3), L: proto.Int64(-4),
+			M: proto.Uint32(math.MaxUint32), N: proto.Uint64(math.MaxUint64), O: proto.Uint32(7), P: proto.Uint64(8),
+			Q: proto.Int32(9), R: proto.Int64(10), S: proto.Float32(float32(math.Inf(1))), T: proto.Float64(-1.5),
+			U: []byte{0, 1, 0xfe, 0xff}, V: proto.String("foo ☃"), W: proto.Bool(true),
+			X:      &testprotos.RepeatedFields{I: []int32{1, 2, 3}, J: []int64{4, 5}},
+			Groupy: &testprotos.UnaryFields_GroupY{Ya: proto.String("ya"), Yb: proto.Int32(1)},
+			Z:      testprotos.TestEnum_SECOND.Enum(),
+		},
+		&testprotos.UnaryFields{},
+		&testprotos.RepeatedFields{
+			I: []int32{-1, 0, 1}, N: []uint64{math.MaxUint64}, S: []float32{1.5, -2.5}, U: [][]byte{{1}, {}},
+			V: []string{"a", "b"}, W: []bool{true, false},
+			X:      []*testprotos.UnaryFields{{I: proto.Int32(1)}, {}},
+			Groupy: []*testprotos.RepeatedFields_GroupY{{Ya: proto.String("y")}},
+			Z:      []testprotos.TestEnum{testprotos.TestEnum_FIRST, testprotos.TestEnum_THIRD},
+		},
+		&testprotos.MapKeyFields{
+			I: map[int32]string{-1: "a", 1: "b"}, J: map[int64]string{math.MaxInt64: "c"}, M: map[uint32]string{math.MaxUint32: "d"},
+			N: map[uint64]string{math.MaxUint64: "e"}, S: map[string]string{"": "f", "g": "h"}, T: map[bool]string{true: "i", false: "j"},
+		},
+		&testprotos.MapValFields{
+			I: map[string]int32{"a": 1}, U: map[string][]byte{"b": {2}}, W: map[string]bool{"c": true},
+			X: map[string]*testprotos.UnaryFields{"d": {V: proto.String("e")}},
+			Y: map[string]testprotos.TestEnum{"f": testprotos.TestEnum_SECOND},
+		},
+		&testprotos.AnotherTestMessage{
+			Dne:       testprotos.TestMessage_NestedMessage_AnotherNestedMessage_YetAnotherNestedMessage_VALUE2.Enum(),
+			MapField1: map[int32]string{-1: "a", 2: "b"},
+			MapField4: map[string]*testprotos.AnotherTestMessage{"x": {Atmoo: &testprotos.AnotherTestMessage_Int{Int: 42}}},
+			Rocknroll: &testprotos.AnotherTestMessage_RockNRoll{Beatles: proto.String("abbey road")},
+			Atmoo:     &testprotos.AnotherTestMessage_Str{Str: "str"},
+		},
+		&testprotos.OneOfMessage{
+			Value: &testprotos.OneOfMessage_MsgValue{MsgValue: &testprotos.OneOfMessage{
+				Value: &testprotos.OneOfMessage_BinaryValue{BinaryValue: []byte("abc")},
+			}},
+		},
+		&testprotos.OneOfMessage{Value: &testprotos.OneOfMessage_StringValue{}},
+		&testprotos.TestRequest{
+			Foo:    []testprotos.Proto3Enum{testprotos.Proto3Enum_VALUE1},
+			Bar:    "bar",
+			Baz:    &testprotos.TestMessage{Ne: []testprotos.TestMessage_NestedEnum{testprotos.TestMessage_VALUE1}},
+			Flags:  map[string]bool{"x": true},
+			Others: map[string]*testprotos.TestMessage{"y": {}},
+		},
+		&testprotos.TestWellKnownTypes{
+			StartTime: timestamppb.New(time.Date(1969, 7, 20, 20, 17, 40, 123456000, time.UTC)),
+			Elapsed:   durationpb.New(49*time.Hour + 1500*time.Millisecond),
+			Dbl:       wrapperspb.Double(1.5),
+			Flt:       wrapperspb.Float(2.5),
+			Bl:        wrapperspb.Bool(false),
+			I32:       wrapperspb.Int32(-32),
+			I64:       wrapperspb.Int64(-64),
+			U32:       wrapperspb.UInt32(32),
+			U64:       wrapperspb.UInt64(64),
+			Str:       wrapperspb.String(""),
+			Byt:       wrapperspb.Bytes([]byte{1, 2, 3}),
+			Json: []*structpb.Value{
+				structpb.NewStringValue("abc"),
+				structpb.NewListValue(&structpb.ListValue{Values: []*structpb.Value{structpb.NewNumberValue(1), structpb.NewBoolValue(true)}}),
+			},
+			Extras: []*anypb.Any{anyVal},
+		},
+	}
+}
+
+func TestBinaryRoundTrip(t *testing.T) {
+	for _, msg := range testMessages(t) {
+		md, err := desc.LoadMessageDescriptorForMessage(msg)
+		testutil.Ok(t, err)
+		t.Run(md.GetName(), func(t *testing.T) {
+			dm := dynamic.NewMessage(md)
+			testutil.Ok(t, dm.ConvertFrom(msg))
+			data, err := MarshalBinary(dm)
+			testutil.Ok(t, err)
+
+			decoded := dynamic.NewMessage(md)
+			testutil.Ok(t, UnmarshalBinary(data, decoded))
+			testutil.Require(t, dynamic.MessagesEqual(dm, decoded), "%v != %v", dm, decoded)
+
+			// encoding is deterministic
+			again, err := MarshalBinary(decoded)
+			testutil.Ok(t, err)
+			testutil.Eq(t, data, again)
+		})
+	}
+}
+
+func TestMarshalBinary(t *testing.T) {
+	md, err := desc.LoadMessageDescriptorForMessage((*testprotos.TestResponse)(nil))
+	testutil.Ok(t, err)
+	dm := dynamic.NewMessage(md)
+	dm.SetFieldByName("vs", []int32{1, -2})
+	data, err := MarshalBinary(dm)
+	testutil.Ok(t, err)
+	testutil.Eq(t, []byte{
+		0,       // atm: union index 0 (null)
+		4, 2, 3, // vs: block of two items, 1 and -2 as zig-zag varints
+		0, // end of vs
+	}, data)
+}
+
+func TestBinaryLossyWellKnownTypes(t *testing.T) {
+	md, err := desc.LoadMessageDescriptorForMessage((*testprotos.TestWellKnownTypes)(nil))
+	testutil.Ok(t, err)
+	dm := dynamic.NewMessage(md)
+	testutil.Ok(t, dm.ConvertFrom(&testprotos.TestWellKnownTypes{
+		StartTime: &timestamppb.Timestamp{Seconds: -1, Nanos: 999999999},
+		Elapsed:   &durationpb.Duration{Seconds: 1, Nanos: 999999},
+	}))
+	data, err := MarshalBinary(dm)
+	testutil.Ok(t, err)
+	decoded := dynamic.NewMessage(md)
+	testutil.Ok(t, UnmarshalBinary(data, decoded))
+	var res testprotos.TestWellKnownTypes
+	testutil.Ok(t, decoded.ConvertTo(&res))
+	// truncated to microseconds and milliseconds, respectively
+	testutil.Eq(t, int64(-1), res.StartTime.Seconds)
+	testutil.Eq(t, int32(999999000), res.StartTime.Nanos)
+	testutil.Eq(t, int64(1), res.Elapsed.Seconds)
+	testutil.Eq(t, int32(0), res.Elapsed.Nanos)
+
+	testutil.Ok(t, dm.ConvertFrom(&testprotos.TestWellKnownTypes{Elapsed: durationpb.New(-time.Second)}))
+	_, err = MarshalBinary(dm)
+	testutil.Nok(t, err)
+}
+
+func TestUnmarshalBinaryErrors(t *testing.T) {
+	md, err := desc.LoadMessageDescriptorForMessage((*testprotos.TestResponse)(nil))
+	testutil.Ok(t, err)
+	testCases := map[string][]byte{
+		"empty":             {},
+		"bad union index":   {4},
+		"truncated array":   {0, 4, 2},
+		"trailing data":     {0, 0, 0},
+		"huge block count":  {0, 0xfe, 0xff, 0xff, 0xff, 0x0f},
+		"int out of range":  {0, 2, 0xfe, 0xff, 0xff, 0xff, 0x1f, 0},
+		"unterminated list": {0, 2, 2},
+	}
+	for name, data := range testCases {
+		t.Run(name, func(t *testing.T) {
+			err := UnmarshalBinary(data, dynamic.NewMessage(md))
+			testutil.Nok(t, err)
+		})
+	}
+}
@@ -0,0 +1,266 @@
+package avro
+
+import (
+	"encoding/json"
+	"math"
+	"strings"
+
+	"google.golang.org/protobuf/types/descriptorpb"
+
+	"github.com/jhump/protoreflect/desc"
+)
+
+const (
+	timestampName = "google.protobuf.Timestamp"
+	durationName  = "google.protobuf.Duration"
+)
+
+// the JSON form of these is stored in a string
+var jsonValueTypes = map[string]bool{
+	"google.protobuf.Struct":    true,
+	"google.protobuf.Value":     true,
+	"google.protobuf.ListValue": true,
+}
+
+var wrapperTypes = map[string]bool{
+	"google.protobuf.DoubleValue": true,
+	"google.protobuf.FloatValue":  true,
+	"google.protobuf.Int64Value":  true,
+	"google.protobuf.UInt64Value": true,
+	"google.protobuf.Int32Value":  true,
+	"google.protobuf.UInt32Value": true,
+	"google.protobuf.BoolValue":   true,
+	"google.protobuf.StringValue": true,
+	"google.protobuf.BytesValue":  true,
+}
+
+// SchemaForMessage returns the Avro record schema for the given message. See
+// the package doc for details on how messages are mapped to Avro schemas.
+//
+// Each call returns a new graph of schemas, which the caller may modify.
+func SchemaForMessage(md *desc.MessageDescriptor) *Schema {
+	g := schemaGenerator{named: map[string]*Schema{}}
+	return g.record(md)
+}
+
+// SchemaForEnum returns the Avro enum schema for the given enum. The symbols
+// are the names of the enum's values, in the order they are declared.
+func SchemaForEnum(ed *desc.EnumDescriptor) *Schema {
+	g := schemaGenerator{named: map[string]*Schema{}}
+	return g.enum(ed)
+}
+
+type schemaGenerator struct {
+	named map[string]*Schema
+}
+
+func (g *schemaGenerator) record(md *desc.MessageDescriptor) *Schema {
+	if s := g.named[md.GetFullyQualifiedName()]; s != nil {
+		return s
+	}
+	s := &Schema{
+		Type:      TypeRecord,
+		Name:      md.GetName(),
+		Namespace: namespace(md),
+		Doc:       description(md),
+	}
+	// register before generating fields, in case the message is recursive
+	g.named[md.GetFullyQualifiedName()] = s
+	unions := map[*desc.OneOfDescriptor]bool{}
+	for _, fd := range md.GetFields() {
+		if ood := fd.GetOneOf(); ood != nil && !ood.IsSynthetic() {
+			isUnion, seen := unions[ood]
+			if !seen {
+				isUnion = g.oneOfIsUnion(ood)
+				unions[ood] = isUnion
+				if isUnion {
+					s.Fields = append(s.Fields, g.oneOfField(ood))
+				}
+			}
+			if isUnion {
+				continue
+			}
+		}
+		s.Fields = append(s.Fields, g.field(fd))
+	}
+	return s
+}
+
+// oneOfIsUnion returns true if the given oneof can be represented by a single
+// union field. That is only possible when no two of its members have the same
+// Avro type.
+func (g *schemaGenerator) oneOfIsUnion(ood *desc.OneOfDescriptor) bool {
+	names := map[string]bool{}
+	for _, fd := range ood.GetChoices() {
+		name := g.value(fd).FullName()
+		if names[name] {
+			return false
+		}
+		names[name] = true
+	}
+	return true
+}
+
+func (g *schemaGenerator) oneOfField(ood *desc.OneOfDescriptor) *Field {
+	u := &Schema{Type: TypeUnion, Branches: []*Schema{{Type: TypeNull}}}
+	for _, fd := range ood.GetChoices() {
+		u.Branches = append(u.Branches, g.value(fd))
+	}
+	return &Field{
+		Name:    ood.GetName(),
+		Doc:     description(ood),
+		Type:    u,
+		Default: json.RawMessage("null"),
+	}
+}
+
+func (g *schemaGenerator) field(fd *desc.FieldDescriptor) *Field {
+	f := &Field{Name: fd.GetName(), Doc: description(fd)}
+	switch {
+	case fd.IsMap():
+		f.Type = &Schema{Type: TypeMap, Values: g.value(fd.GetMapValueType())}
+		f.Default = json.RawMessage("{}")
+	case fd.IsRepeated():
+		f.Type = &Schema{Type: TypeArray, Items: g.value(fd)}
+		f.Default = json.RawMessage("[]")
+	case fd.HasPresence():
+		f.Type = &Schema{Type: TypeUnion, Branches: []*Schema{{Type: TypeNull}, g.value(fd)}}
+		f.Default = json.RawMessage("null")
+	default:
+		f.Type = g.value(fd)
+		f.Default = defaultValue(fd)
+	}
+	return f
+}
+
+// value returns the schema for a single value of the given field.
+func (g *schemaGenerator) value(fd *desc.FieldDescriptor) *Schema {
+	switch fd.GetType() {
+	case descriptorpb.FieldDescriptorProto_TYPE_INT32,
+		descriptorpb.FieldDescriptorProto_TYPE_SINT32,
+		descriptorpb.FieldDescriptorProto_TYPE_SFIXED32:
+		return &Schema{Type: TypeInt}
+	case descriptorpb.FieldDescriptorProto_TYPE_INT64,
+		descriptorpb.FieldDescriptorProto_TYPE_SINT64,
+		descriptorpb.FieldDescriptorProto_TYPE_SFIXED64,
+		descriptorpb.FieldDescriptorProto_TYPE_UINT64,
+		descriptorpb.FieldDescriptorProto_TYPE_FIXED64,
+		descriptorpb.FieldDescriptorProto_TYPE_UINT32,
+		descriptorpb.FieldDescriptorProto_TYPE_FIXED32:
+		return &Schema{Type: TypeLong}
+	case descriptorpb.FieldDescriptorProto_TYPE_FLOAT:
+		return &Schema{Type: TypeFloat}
+	case descriptorpb.FieldDescriptorProto_TYPE_DOUBLE:
+		return &Schema{Type: TypeDouble}
+	case descriptorpb.FieldDescriptorProto_TYPE_BOOL:
+		return &Schema{Type: TypeBoolean}
+	case descriptorpb.FieldDescriptorProto_TYPE_STRING:
+		return &Schema{Type: TypeString}
+	case descriptorpb.FieldDescriptorProto_TYPE_BYTES:
+		return &Schema{Type: TypeBytes}
+	case descriptorpb.FieldDescriptorProto_TYPE_ENUM:
+		return g.enum(fd.GetEnumType())
+	default:
+		return g.message(fd.GetMessageType())
+	}
+}
+
+func (g *schemaGenerator) message(md *desc.MessageDescriptor) *Schema {
+	name := md.GetFullyQualifiedName()
+	switch {
+	case name == timestampName:
+		return &Schema{Type: TypeLong, LogicalType: LogicalTimestampMicros}
+	case name == durationName:
+		if s := g.named[name]; s != nil {
+			return s
+		}
+		s := &Schema{Type: TypeFixed, Name: "Duration", Namespace: "google.protobuf", Size: 12, LogicalType: LogicalDuration}
+		g.named[name] = s
+		return s
+	case wrapperTypes[name]:
+		return g.value(md.FindFieldByNumber(1))
+	case jsonValueTypes[name]:
+		return &Schema{Type: TypeString}
+	default:
+		return g.record(md)
+	}
+}
+
+func (g *schemaGenerator) enum(ed *desc.EnumDescriptor) *Schema {
+	if s := g.named[ed.GetFullyQualifiedName()]; s != nil {
+		return s
+	}
+	s := &Schema{
+		Type:      TypeEnum,
+		Name:      ed.GetName(),
+		Namespace: namespace(ed),
+		Doc:       description(ed),
+	}
+	for _, vd := range ed.GetValues() {
+		s.Symbols = append(s.Symbols, vd.GetName())
+	}
+	// allows readers to handle symbols added in newer versions of the enum
+	s.Default = s.Symbols[0]
+	g.named[ed.GetFullyQualifiedName()] = s
+	return s
+}
+
+// defaultValue returns the JSON form of the default value for a field that
+// has no presence.
+func defaultValue(fd *desc.FieldDescriptor) json.RawMessage {
+	var v interface{}
+	switch dv := fd.GetDefaultValue().(type) {
+	case uint64:
+		v = int64(dv)
+	case float32:
+		if math.IsInf(float64(dv), 0) || math.IsNaN(float64(dv)) {
+			return nil
+		}
+		v = dv
+	case float64:
+		if math.IsInf(dv, 0) || math.IsNaN(dv) {
+			return nil
+		}
+		v = dv
+	case []byte:
+		v = bytesToJSON(dv)
+	case int32:
+		if ed := fd.GetEnumType(); ed != nil {
+			if vd := ed.FindValueByNumber(dv); vd != nil {
+				v = vd.GetName()
+			} else {
+				v = ed.GetValues()[0].GetName()
+			}
+		} else {
+			v = dv
+		}
+	default:
+		v = dv
+	}
+	b, err := json.Marshal(v)
+	if err != nil {
+		return nil
+	}
+	return b
+}
+
+func namespace(d desc.Descriptor) string {
+	switch p := d.GetParent().(type) {
+	case *desc.FileDescriptor:
+		return p.GetPackage()
+	default:
+		return p.GetFullyQualifiedName()
+	}
+}
+
+func description(d desc.Descriptor) string {
+	comment := d.GetSourceInfo().GetLeadingComments()
+	if comment == "" {
+		return ""
+	}
+	lines := strings.Split(strings.TrimRight(comment, "\n"), "\n")
+	for i, line := range lines {
+		lines[i] = strings.TrimPrefix(line, " ")
+	}
+	return strings.TrimSpace(strings.Join(lines, "\n"))
+}
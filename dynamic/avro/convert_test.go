@@ -0,0 +1,265 @@
+package avro
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/golang/protobuf/proto"
+	"google.golang.org/protobuf/types/descriptorpb"
+
+	"github.com/jhump/protoreflect/desc"
+	"github.com/jhump/protoreflect/desc/builder"
+	"github.com/jhump/protoreflect/internal/testprotos"
+	"github.com/jhump/protoreflect/internal/testutil"
+)
+
+func TestSchemaForMessage(t *testing.T) {
+	md, err := desc.LoadMessageDescriptorForMessage((*testprotos.AnotherTestMessage)(nil))
+	testutil.Ok(t, err)
+	s := SchemaForMessage(md)
+	testutil.Eq(t, TypeRecord, s.Type)
+	testutil.Eq(t, "testprotos.AnotherTestMessage", s.FullName())
+	testutil.Eq(t, "Comment for AnotherTestMessage", s.Doc)
+
+	fields := map[string]*Field{}
+	var names []string
+	for _, f := range s.Fields {
+		fields[f.Name] = f
+		names = append(names, f.Name)
+	}
+	// the oneof is a single field, in place of its members
+	testutil.Eq(t, []string{"dne", "map_field1", "map_field2", "map_field3", "map_field4", "rocknroll", "atmoo", "withoptions"}, names)
+
+	dne := fields["dne"]
+	testutil.Eq(t, "Comment for dne", dne.Doc)
+	testutil.Eq(t, TypeUnion, dne.Type.Type)
+	testutil.Eq(t, TypeNull, dne.Type.Branches[0].Type)
+	testutil.Eq(t, "testprotos.TestMessage.NestedMessage.AnotherNestedMessage.YetAnotherNestedMessage.DeeplyNestedEnum", dne.Type.Branches[1].FullName())
+	testutil.Eq(t, []string{"VALUE1", "VALUE2"}, dne.Type.Branches[1].Symbols)
+	testutil.Eq(t, "null", string(dne.Default))
+
+	mapField2 := fields["map_field2"]
+	testutil.Eq(t, TypeMap, mapField2.Type.Type)
+	testutil.Eq(t, TypeFloat, mapField2.Type.Values.Type)
+	testutil.Eq(t, "{}", string(mapField2.Default))
+
+	// recursive reference
+	mapField4 := fields["map_field4"]
+	testutil.Require(t, mapField4.Type.Values == s)
+
+	group := fields["rocknroll"].Type.Branches[1]
+	testutil.Eq(t, "testprotos.AnotherTestMessage.RockNRoll", group.FullName())
+
+	atmoo := fields["atmoo"]
+	testutil.Eq(t, "Comment for atmoo", atmoo.Doc)
+	var branches []string
+	for _, b := range atmoo.Type.Branches {
+		branches = append(branches, b.FullName())
+	}
+	testutil.Eq(t, []string{"null", "string", "long"}, branches)
+
+	// empty records are fine
+	withOptions := fields["withoptions"].Type.Branches[1]
+	testutil.Eq(t, TypeRecord, withOptions.Type)
+	testutil.Eq(t, 0, len(withOptions.Fields))
+}
+
+func TestSchemaForMessage_ScalarsAndDefaults(t *testing.T) {
+	md, err := desc.LoadMessageDescriptorForMessage((*testprotos.PrimitiveDefaults)(nil))
+	testutil.Ok(t, err)
+	s := SchemaForMessage(md)
+	types := map[string]string{}
+	for _, f := range s.Fields {
+		testutil.Eq(t, TypeUnion, f.Type.Type, "field %s", f.Name)
+		testutil.Eq(t, "null", string(f.Default), "field %s", f.Name)
+		types[f.Name] = f.Type.Branches[1].Type
+	}
+	testutil.Eq(t, TypeFloat, types["fl32"])
+	testutil.Eq(t, TypeDouble, types["fl64"])
+
+	// fields without presence use the zero value as their default
+	fb := builder.NewFile("test.proto").SetProto3(true).SetPackageName("foo.bar")
+	mb := builder.NewMessage("Scalars").
+		AddField(builder.NewField("i", builder.FieldTypeInt32())).
+		AddField(builder.NewField("u", builder.FieldTypeUInt32())).
+		AddField(builder.NewField("u64", builder.FieldTypeFixed64())).
+		AddField(builder.NewField("b", builder.FieldTypeBytes())).
+		AddField(builder.NewField("opt", builder.FieldTypeString()).SetProto3Optional(true))
+	fb.AddMessage(mb)
+	fd, err := fb.Build()
+	testutil.Ok(t, err)
+	s = SchemaForMessage(fd.FindMessage("foo.bar.Scalars"))
+	testutil.Eq(t, "foo.bar", s.Namespace)
+	expected := []struct{ typ, def string }{
+		{TypeInt, "0"},
+		{TypeLong, "0"},
+		{TypeLong, "0"},
+		{TypeBytes, `""`},
+		{TypeUnion, "null"},
+	}
+	for i, exp := range expected {
+		testutil.Eq(t, exp.typ, s.Fields[i].Type.Type, "field %s", s.Fields[i].Name)
+		testutil.Eq(t, exp.def, string(s.Fields[i].Default), "field %s", s.Fields[i].Name)
+	}
+}
+
+func TestSchemaForMessage_OneOfWithDuplicateTypes(t *testing.T) {
+	mb := builder.NewMessage("Choice").
+		AddOneOf(builder.NewOneOf("value").
+			AddChoice(builder.NewField("a", builder.FieldTypeString())).
+			AddChoice(builder.NewField("b", builder.FieldTypeString())))
+	md, err := mb.Build()
+	testutil.Ok(t, err)
+	s := SchemaForMessage(md)
+	// the members can't be distinguished in a union, so each is its own field
+	testutil.Eq(t, 2, len(s.Fields))
+	for i, name := range []string{"a", "b"} {
+		testutil.Eq(t, name, s.Fields[i].Name)
+		testutil.Eq(t, TypeUnion, s.Fields[i].Type.Type)
+		testutil.Eq(t, TypeString, s.Fields[i].Type.Branches[1].Type)
+	}
+}
+
+func TestSchemaForMessage_WellKnownTypes(t *testing.T) {
+	md, err := desc.LoadMessageDescriptorForMessage((*testprotos.TestWellKnownTypes)(nil))
+	testutil.Ok(t, err)
+	s := SchemaForMessage(md)
+	fields := map[string]*Schema{}
+	for _, f := range s.Fields {
+		fields[f.Name] = f.Type
+	}
+	startTime := fields["start_time"].Branches[1]
+	testutil.Eq(t, TypeLong, startTime.Type)
+	testutil.Eq(t, LogicalTimestampMicros, startTime.LogicalType)
+	elapsed := fields["elapsed"].Branches[1]
+	testutil.Eq(t, TypeFixed, elapsed.Type)
+	testutil.Eq(t, 12, elapsed.Size)
+	testutil.Eq(t, LogicalDuration, elapsed.LogicalType)
+	testutil.Eq(t, TypeDouble, fields["dbl"].Branches[1].Type)
+	testutil.Eq(t, TypeLong, fields["u32"].Branches[1].Type)
+	testutil.Eq(t, TypeBytes, fields["byt"].Branches[1].Type)
+	testutil.Eq(t, TypeString, fields["json"].Items.Type)
+	testutil.Eq(t, "google.protobuf.Any", fields["extras"].Items.FullName())
+
+	// the result is a valid schema
+	b, err := json.Marshal(s)
+	testutil.Ok(t, err)
+	_, err = ParseSchema(b)
+	testutil.Ok(t, err)
+}
+
+func TestImportSchema(t *testing.T) {
+	s, err := ParseSchema([]byte(linkedListSchema))
+	testutil.Ok(t, err)
+	fb, err := ImportSchema(s, "")
+	testutil.Ok(t, err)
+	testutil.Eq(t, "LinkedList.proto", fb.GetName())
+	fd, err := fb.Build()
+	testutil.Ok(t, err)
+	testutil.Eq(t, "example.lists", fd.GetPackage())
+
+	md := fd.FindMessage("example.lists.LinkedList")
+	testutil.Require(t, md != nil)
+	testutil.Eq(t, "A list of names.", description(md))
+
+	kind := fd.FindEnum("example.lists.Kind")
+	testutil.Require(t, kind != nil)
+	testutil.Eq(t, int32(0), kind.FindValueByName("PERSON").GetNumber())
+	testutil.Eq(t, int32(1), kind.FindValueByName("PLACE").GetNumber())
+	// the fixed type is in another namespace, but it's not a named proto type
+	expected := []struct {
+		name     string
+		typ      descriptorpb.FieldDescriptorProto_Type
+		typeName string
+	}{
+		{"name", descriptorpb.FieldDescriptorProto_TYPE_STRING, ""},
+		{"kind", descriptorpb.FieldDescriptorProto_TYPE_ENUM, "example.lists.Kind"},
+		{"also", descriptorpb.FieldDescriptorProto_TYPE_ENUM, "example.lists.Kind"},
+		{"created", descriptorpb.FieldDescriptorProto_TYPE_MESSAGE, "google.protobuf.Timestamp"},
+		{"hash", descriptorpb.FieldDescriptorProto_TYPE_BYTES, ""},
+		{"counts", descriptorpb.FieldDescriptorProto_TYPE_MESSAGE, "example.lists.LinkedList.CountsEntry"},
+		{"next", descriptorpb.FieldDescriptorProto_TYPE_MESSAGE, "example.lists.LinkedList"},
+	}
+	testutil.Eq(t, len(expected), len(md.GetFields()))
+	for i, exp := range expected {
+		fld := md.GetFields()[i]
+		testutil.Eq(t, exp.name, fld.GetName())
+		testutil.Eq(t, int32(i+1), fld.GetNumber())
+		testutil.Eq(t, exp.typ, fld.GetType(), "field %s", exp.name)
+		var typeName string
+		if fld.GetMessageType() != nil {
+			typeName = fld.GetMessageType().GetFullyQualifiedName()
+		} else if fld.GetEnumType() != nil {
+			typeName = fld.GetEnumType().GetFullyQualifiedName()
+		}
+		testutil.Eq(t, exp.typeName, typeName, "field %s", exp.name)
+	}
+}
+
+func TestImportSchema_Unions(t *testing.T) {
+	s, err := ParseSchema([]byte(`{
+		"type": "record", "name": "Event", "fields": [
+			{"name": "count", "type": ["null", "int"]},
+			{"name": "payload", "type": ["null", "string", "bytes", {"type": "record", "name": "Point", "fields": [{"name": "x", "type": "double"}]}]},
+			{"name": "ids", "type": {"type": "array", "items": ["null", "long"]}}
+		]
+	}`))
+	testutil.Ok(t, err)
+	md, err := MessageForSchema(s)
+	testutil.Ok(t, err)
+	testutil.Eq(t, "Event", md.GetFullyQualifiedName())
+
+	count := md.FindFieldByName("count")
+	testutil.Require(t, count.IsProto3Optional())
+	testutil.Eq(t, descriptorpb.FieldDescriptorProto_TYPE_INT32, count.GetType())
+
+	ood := findOneOf(md, "payload")
+	testutil.Eq(t, "payload", ood.GetName())
+	var choices []string
+	for _, fld := range ood.GetChoices() {
+		choices = append(choices, fld.GetName())
+	}
+	testutil.Eq(t, []string{"payload_string", "payload_bytes", "payload_point"}, choices)
+
+	ids := md.FindFieldByName("ids")
+	testutil.Require(t, ids.IsRepeated())
+	testutil.Eq(t, descriptorpb.FieldDescriptorProto_TYPE_INT64, ids.GetType())
+	testutil.Eq(t, int32(5), ids.GetNumber())
+}
+
+func TestImportSchema_RoundTrip(t *testing.T) {
+	msgs := []proto.Message{
+		(*testprotos.TestRequest)(nil),
+		(*testprotos.OneOfMessage)(nil),
+		(*testprotos.TestWellKnownTypes)(nil),
+	}
+	for _, msg := range msgs {
+		md, err := desc.LoadMessageDescriptorForMessage(msg)
+		testutil.Ok(t, err)
+		t.Run(md.GetName(), func(t *testing.T) {
+			s := SchemaForMessage(md)
+			imported, err := MessageForSchema(s)
+			testutil.Ok(t, err)
+			testutil.Eq(t, md.GetFullyQualifiedName(), imported.GetFullyQualifiedName())
+			// the imported message has the same schema
+			testutil.Eq(t, s.String(), SchemaForMessage(imported).String())
+		})
+	}
+}
+
+func TestImportSchema_Errors(t *testing.T) {
+	testCases := map[string]string{
+		"not a record":   `"string"`,
+		"null field":     `{"type": "record", "name": "R", "fields": [{"name": "f", "type": "null"}]}`,
+		"nested arrays":  `{"type": "record", "name": "R", "fields": [{"name": "f", "type": {"type": "array", "items": {"type": "array", "items": "int"}}}]}`,
+		"union of nulls": `{"type": "record", "name": "R", "fields": [{"name": "f", "type": ["null"]}]}`,
+	}
+	for name, data := range testCases {
+		t.Run(name, func(t *testing.T) {
+			s, err := ParseSchema([]byte(data))
+			testutil.Ok(t, err)
+			_, err = ImportSchema(s, "")
+			testutil.Nok(t, err)
+		})
+	}
+}
@@ -0,0 +1,403 @@
+package avro
+
+import (
+	"encoding/binary"
+	"fmt"
+	"math"
+	"sort"
+	"strconv"
+
+	"github.com/golang/protobuf/proto"
+	"google.golang.org/protobuf/types/descriptorpb"
+
+	"github.com/jhump/protoreflect/desc"
+	"github.com/jhump/protoreflect/dynamic"
+)
+
+// Both encodings work by converting a message to and from a datum, which is
+// a generic representation of Avro data that is interpreted using its schema:
+//
+//	null            nil
+//	boolean         bool
+//	int, long       int32, int64
+//	float, double   float32, float64
+//	bytes, fixed    []byte
+//	string          string
+//	enum            int (the index of the symbol)
+//	array           []interface{}
+//	map             map[string]interface{}
+//	record          []interface{} (a value for each field, in order)
+//	union           unionValue
+
+type unionValue struct {
+	index int
+	value interface{}
+}
+
+func messageToDatum(s *Schema, m *dynamic.Message) ([]interface{}, error) {
+	md := m.GetMessageDescriptor()
+	rec := make([]interface{}, len(s.Fields))
+	for i, f := range s.Fields {
+		var err error
+		if fd := md.FindFieldByName(f.Name); fd != nil {
+			rec[i], err = fieldToDatum(f.Type, fd, m)
+		} else if ood := findOneOf(md, f.Name); ood != nil {
+			rec[i], err = oneOfToDatum(f.Type, ood, m)
+		} else {
+			err = fmt.Errorf("schema does not match message: no field named %q", f.Name)
+		}
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", md.GetFullyQualifiedName(), err)
+		}
+	}
+	return rec, nil
+}
+
+func findOneOf(md *desc.MessageDescriptor, name string) *desc.OneOfDescriptor {
+	for _, ood := range md.GetOneOfs() {
+		if ood.GetName() == name {
+			return ood
+		}
+	}
+	return nil
+}
+
+func oneOfToDatum(s *Schema, ood *desc.OneOfDescriptor, m *dynamic.Message) (interface{}, error) {
+	fd, v := m.GetOneOfField(ood)
+	if fd == nil {
+		return unionValue{index: 0}, nil
+	}
+	for i, choice := range ood.GetChoices() {
+		if choice == fd {
+			d, err := valueToDatum(s.Branches[i+1], fd, v)
+			if err != nil {
+				return nil, fmt.Errorf("field %s: %w", fd.GetName(), err)
+			}
+			return unionValue{index: i + 1, value: d}, nil
+		}
+	}
+	return nil, fmt.Errorf("field %s is not in oneof %s", fd.GetName(), ood.GetName())
+}
+
+func fieldToDatum(s *Schema, fd *desc.FieldDescriptor, m *dynamic.Message) (interface{}, error) {
+	d, err := doFieldToDatum(s, fd, m)
+	if err != nil {
+		return nil, fmt.Errorf("field %s: %w", fd.GetName(), err)
+	}
+	return d, nil
+}
+
+func doFieldToDatum(s *Schema, fd *desc.FieldDescriptor, m *dynamic.Message) (interface{}, error) {
+	switch {
+	case fd.IsMap():
+		valFd := fd.GetMapValueType()
+		res := map[string]interface{}{}
+		for k, v := range m.GetField(fd).(map[interface{}]interface{}) {
+			d, err := valueToDatum(s.Values, valFd, v)
+			if err != nil {
+				return nil, err
+			}
+			res[formatKey(k)] = d
+		}
+		return res, nil
+	case fd.IsRepeated():
+		vals := m.GetField(fd).([]interface{})
+		res := make([]interface{}, len(vals))
+		for i, v := range vals {
+			var err error
+			if res[i], err = valueToDatum(s.Items, fd, v); err != nil {
+				return nil, err
+			}
+		}
+		return res, nil
+	case s.Type == TypeUnion:
+		if !m.HasField(fd) {
+			return unionValue{index: 0}, nil
+		}
+		d, err := valueToDatum(s.Branches[1], fd, m.GetField(fd))
+		if err != nil {
+			return nil, err
+		}
+		return unionValue{index: 1, value: d}, nil
+	default:
+		return valueToDatum(s, fd, m.GetField(fd))
+	}
+}
+
+func valueToDatum(s *Schema, fd *desc.FieldDescriptor, v interface{}) (interface{}, error) {
+	switch fd.GetType() {
+	case descriptorpb.FieldDescriptorProto_TYPE_ENUM:
+		num := v.(int32)
+		vd := fd.GetEnumType().FindValueByNumber(num)
+		if vd != nil {
+			for i, sym := range s.Symbols {
+				if sym == vd.GetName() {
+					return i, nil
+				}
+			}
+		}
+		return nil, fmt.Errorf("enum %s has no symbol for value %d", fd.GetEnumType().GetFullyQualifiedName(), num)
+	case descriptorpb.FieldDescriptorProto_TYPE_MESSAGE, descriptorpb.FieldDescriptorProto_TYPE_GROUP:
+		dm, err := asDynamicMessage(v.(proto.Message), fd.GetMessageType())
+		if err != nil {
+			return nil, err
+		}
+		return messageValueToDatum(s, dm)
+	}
+	switch v := v.(type) {
+	case uint32:
+		return int64(v), nil
+	case uint64:
+		return int64(v), nil
+	case []byte:
+		if v == nil {
+			return []byte{}, nil
+		}
+		return v, nil
+	default:
+		// remaining types are the same as the datum
+		return v, nil
+	}
+}
+
+func messageValueToDatum(s *Schema, dm *dynamic.Message) (interface{}, error) {
+	md := dm.GetMessageDescriptor()
+	name := md.GetFullyQualifiedName()
+	switch {
+	case name == timestampName:
+		secs, nanos := wktSecondsAndNanos(dm)
+		return secs*1e6 + int64(nanos)/1e3, nil
+	case name == durationName:
+		secs, nanos := wktSecondsAndNanos(dm)
+		if secs < 0 || nanos < 0 {
+			return nil, fmt.Errorf("negative duration cannot be represented")
+		}
+		millis := secs*1e3 + int64(nanos)/1e6
+		b := make([]byte, 12)
+		binary.LittleEndian.PutUint32(b[4:], uint32(millis/(86400*1e3)))
+		binary.LittleEndian.PutUint32(b[8:], uint32(millis%(86400*1e3)))
+		return b, nil
+	case wrapperTypes[name]:
+		valFd := md.FindFieldByNumber(1)
+		return valueToDatum(s, valFd, dm.GetField(valFd))
+	case jsonValueTypes[name]:
+		b, err := dm.MarshalJSON()
+		if err != nil {
+			return nil, err
+		}
+		return string(b), nil
+	default:
+		return messageToDatum(s, dm)
+	}
+}
+
+func wktSecondsAndNanos(dm *dynamic.Message) (int64, int32) {
+	return dm.GetFieldByNumber(1).(int64), dm.GetFieldByNumber(2).(int32)
+}
+
+func asDynamicMessage(msg proto.Message, md *desc.MessageDescriptor) (*dynamic.Message, error) {
+	if dm, ok := msg.(*dynamic.Message); ok {
+		return dm, nil
+	}
+	dm := dynamic.NewMessage(md)
+	if err := dm.ConvertFrom(msg); err != nil {
+		return nil, err
+	}
+	return dm, nil
+}
+
+// formatKey formats a map key the same way as the JSON format for protobuf.
+func formatKey(k interface{}) string {
+	switch k := k.(type) {
+	case string:
+		return k
+	case bool:
+		return strconv.FormatBool(k)
+	case int32:
+		return strconv.FormatInt(int64(k), 10)
+	case int64:
+		return strconv.FormatInt(k, 10)
+	case uint32:
+		return strconv.FormatUint(uint64(k), 10)
+	case uint64:
+		return strconv.FormatUint(k, 10)
+	default:
+		return fmt.Sprint(k)
+	}
+}
+
+func parseKey(fd *desc.FieldDescriptor, k string) (interface{}, error) {
+	switch fd.GetType() {
+	case descriptorpb.FieldDescriptorProto_TYPE_STRING:
+		return k, nil
+	case descriptorpb.FieldDescriptorProto_TYPE_BOOL:
+		return strconv.ParseBool(k)
+	case descriptorpb.FieldDescriptorProto_TYPE_INT32,
+		descriptorpb.FieldDescriptorProto_TYPE_SINT32,
+		descriptorpb.FieldDescriptorProto_TYPE_SFIXED32:
+		v, err := strconv.ParseInt(k, 10, 32)
+		return int32(v), err
+	case descriptorpb.FieldDescriptorProto_TYPE_INT64,
+		descriptorpb.FieldDescriptorProto_TYPE_SINT64,
+		descriptorpb.FieldDescriptorProto_TYPE_SFIXED64:
+		return strconv.ParseInt(k, 10, 64)
+	case descriptorpb.FieldDescriptorProto_TYPE_UINT32,
+		descriptorpb.FieldDescriptorProto_TYPE_FIXED32:
+		v, err := strconv.ParseUint(k, 10, 32)
+		return uint32(v), err
+	default:
+		return strconv.ParseUint(k, 10, 64)
+	}
+}
+
+// sortedKeys returns the keys of a map datum in order, so that the encoding
+// of a message is deterministic.
+func sortedKeys(m map[string]interface{}) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+func datumToMessage(s *Schema, rec []interface{}, m *dynamic.Message) error {
+	md := m.GetMessageDescriptor()
+	if len(rec) != len(s.Fields) {
+		return fmt.Errorf("%s: record has %d fields, expecting %d", md.GetFullyQualifiedName(), len(rec), len(s.Fields))
+	}
+	for i, f := range s.Fields {
+		var err error
+		if fd := md.FindFieldByName(f.Name); fd != nil {
+			err = datumToField(f.Type, fd, rec[i], m)
+		} else if ood := findOneOf(md, f.Name); ood != nil {
+			u := rec[i].(unionValue)
+			if u.index > 0 {
+				err = datumToField(f.Type.Branches[u.index], ood.GetChoices()[u.index-1], u.value, m)
+			}
+		} else {
+			err = fmt.Errorf("schema does not match message: no field named %q", f.Name)
+		}
+		if err != nil {
+			return fmt.Errorf("%s: %w", md.GetFullyQualifiedName(), err)
+		}
+	}
+	return nil
+}
+
+func datumToField(s *Schema, fd *desc.FieldDescriptor, d interface{}, m *dynamic.Message) error {
+	if err := doDatumToField(s, fd, d, m); err != nil {
+		return fmt.Errorf("field %s: %w", fd.GetName(), err)
+	}
+	return nil
+}
+
+func doDatumToField(s *Schema, fd *desc.FieldDescriptor, d interface{}, m *dynamic.Message) error {
+	switch {
+	case fd.IsMap():
+		keyFd, valFd := fd.GetMapKeyType(), fd.GetMapValueType()
+		for k, vd := range d.(map[string]interface{}) {
+			key, err := parseKey(keyFd, k)
+			if err != nil {
+				return fmt.Errorf("invalid map key %q: %w", k, err)
+			}
+			val, err := datumToValue(s.Values, valFd, vd)
+			if err != nil {
+				return err
+			}
+			if err := m.TryPutMapField(fd, key, val); err != nil {
+				return err
+			}
+		}
+		return nil
+	case fd.IsRepeated():
+		for _, vd := range d.([]interface{}) {
+			val, err := datumToValue(s.Items, fd, vd)
+			if err != nil {
+				return err
+			}
+			if err := m.TryAddRepeatedField(fd, val); err != nil {
+				return err
+			}
+		}
+		return nil
+	case s.Type == TypeUnion:
+		u := d.(unionValue)
+		if u.index == 0 {
+			return nil
+		}
+		s, d = s.Branches[u.index], u.value
+	}
+	val, err := datumToValue(s, fd, d)
+	if err != nil {
+		return err
+	}
+	return m.TrySetField(fd, val)
+}
+
+func datumToValue(s *Schema, fd *desc.FieldDescriptor, d interface{}) (interface{}, error) {
+	switch fd.GetType() {
+	case descriptorpb.FieldDescriptorProto_TYPE_ENUM:
+		sym := s.Symbols[d.(int)]
+		vd := fd.GetEnumType().FindValueByName(sym)
+		if vd == nil {
+			return nil, fmt.Errorf("enum %s has no value named %q", fd.GetEnumType().GetFullyQualifiedName(), sym)
+		}
+		return vd.GetNumber(), nil
+	case descriptorpb.FieldDescriptorProto_TYPE_MESSAGE, descriptorpb.FieldDescriptorProto_TYPE_GROUP:
+		dm := dynamic.NewMessage(fd.GetMessageType())
+		if err := datumToMessageValue(s, d, dm); err != nil {
+			return nil, err
+		}
+		return dm, nil
+	case descriptorpb.FieldDescriptorProto_TYPE_UINT32,
+		descriptorpb.FieldDescriptorProto_TYPE_FIXED32:
+		v := d.(int64)
+		if v < 0 || v > math.MaxUint32 {
+			return nil, fmt.Errorf("value %d is out of range for %v", v, fd.GetType())
+		}
+		return uint32(v), nil
+	case descriptorpb.FieldDescriptorProto_TYPE_UINT64,
+		descriptorpb.FieldDescriptorProto_TYPE_FIXED64:
+		return uint64(d.(int64)), nil
+	default:
+		return d, nil
+	}
+}
+
+func datumToMessageValue(s *Schema, d interface{}, dm *dynamic.Message) error {
+	md := dm.GetMessageDescriptor()
+	name := md.GetFullyQualifiedName()
+	switch {
+	case name == timestampName:
+		micros := d.(int64)
+		secs, rem := micros/1e6, micros%1e6
+		if rem < 0 {
+			secs, rem = secs-1, rem+1e6
+		}
+		dm.SetFieldByNumber(1, secs)
+		dm.SetFieldByNumber(2, int32(rem*1e3))
+		return nil
+	case name == durationName:
+		b := d.([]byte)
+		if months := binary.LittleEndian.Uint32(b); months != 0 {
+			return fmt.Errorf("duration with months cannot be represented")
+		}
+		days := int64(binary.LittleEndian.Uint32(b[4:]))
+		millis := int64(binary.LittleEndian.Uint32(b[8:]))
+		dm.SetFieldByNumber(1, days*86400+millis/1e3)
+		dm.SetFieldByNumber(2, int32(millis%1e3*1e6))
+		return nil
+	case wrapperTypes[name]:
+		valFd := md.FindFieldByNumber(1)
+		v, err := datumToValue(s, valFd, d)
+		if err != nil {
+			return err
+		}
+		return dm.TrySetField(valFd, v)
+	case jsonValueTypes[name]:
+		return dm.UnmarshalJSON([]byte(d.(string)))
+	default:
+		return datumToMessage(s, d.([]interface{}), dm)
+	}
+}
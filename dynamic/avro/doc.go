@@ -0,0 +1,50 @@
+// Package avro provides interoperability between protocol buffers and Apache
+// Avro. It can convert message descriptors into Avro record schemas (and
+// back), and it can marshal and unmarshal dynamic messages using the Avro
+// binary and JSON encodings.
+//
+// # Schema Mapping
+//
+// A message becomes an Avro record whose namespace is the fully-qualified name
+// of the element that encloses it: the package for top-level messages, or the
+// enclosing message for nested ones. Enums become Avro enums in the same way.
+// Fields of a record appear in the same order as the fields of the message.
+//
+// Scalar types map to the Avro primitive that can hold all of their values, so
+// 32-bit signed integers become "int", and 64-bit integers and unsigned 32-bit
+// integers become "long". Unsigned 64-bit integers also become "long", with
+// values larger than math.MaxInt64 stored as their two's complement.
+//
+// Repeated fields become arrays and map fields become maps. Since Avro maps
+// only support string keys, keys of other types are formatted as strings in
+// the same way as in the JSON format for protocol buffers.
+//
+// Fields that have presence, such as message fields and fields marked
+// "optional", become a union of "null" and the field's type. The members of a
+// oneof become a single field, named after the oneof, whose type is a union of
+// "null" and the types of all of the members. But Avro does not allow a union
+// to contain more than one schema of the same type, so if any two members of
+// a oneof have the same Avro type, each member is instead mapped to its own
+// optional field.
+//
+// A few well-known types have special handling:
+//   - google.protobuf.Timestamp is a "long" with the "timestamp-micros" logical
+//     type. Precision below a microsecond is lost.
+//   - google.protobuf.Duration is a 12-byte fixed with the "duration" logical
+//     type. Avro durations cannot be negative, and precision below a
+//     millisecond is lost.
+//   - Wrapper types, like google.protobuf.StringValue, are an optional value of
+//     the wrapped type.
+//   - google.protobuf.Struct, Value, and ListValue are a "string" that holds
+//     their JSON representation, since Avro has no dynamically typed values.
+//
+// Extensions and unknown fields are not represented.
+//
+// # Encoding
+//
+// The Marshal* and Unmarshal* functions encode a dynamic message using the
+// schema returned by SchemaForMessage for its descriptor. Avro data does not
+// describe itself, so data can only be decoded using the same schema that was
+// used to encode it. Resolving differences between a writer's schema and a
+// reader's schema is not supported.
+package avro
@@ -0,0 +1,367 @@
+package avro
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/golang/protobuf/proto"
+	"google.golang.org/protobuf/types/descriptorpb"
+	"google.golang.org/protobuf/types/known/durationpb"
+	"google.golang.org/protobuf/types/known/timestamppb"
+
+	"github.com/jhump/protoreflect/desc"
+	"github.com/jhump/protoreflect/desc/builder"
+)
+
+// ImportSchema converts the given Avro record schema into a "proto3" file that
+// defines a message for each record and an enum for each enum that is
+// reachable from it. The file's package is the namespace of the given record.
+// Named types whose namespace is the full name of another record become
+// nested types of the corresponding message, so importing a schema returned by
+// SchemaForMessage restores the original structure. If fileName is empty,
+// the name of the record, with a ".proto" suffix, is used.
+//
+// Fields are numbered sequentially, in the order they appear in the record.
+// Avro types map to protobuf types as follows:
+//   - Primitives map to the corresponding scalar type, with "int" and "long"
+//     becoming int32 and int64. The "null" type is not supported except as a
+//     member of a union.
+//   - A "long" with the "timestamp-micros" logical type becomes
+//     google.protobuf.Timestamp, and a 12-byte fixed with the "duration"
+//     logical type becomes google.protobuf.Duration. Other fixed types become
+//     bytes, and other logical types are ignored.
+//   - Arrays become repeated fields and maps become map<string, V> fields. The
+//     items of an array and the values of a map may not themselves be arrays
+//     or maps. Nulls in them cannot be represented and are ignored.
+//   - A union of "null" and one other type becomes an optional field of that
+//     type. Any other union becomes a oneof, named after the field, with a
+//     field for each non-null member of the union.
+//   - Enum symbols are numbered by their position, so the first symbol has the
+//     value zero.
+//   - Records in the "google.protobuf" namespace that have the same name as a
+//     well-known type, like google.protobuf.Any, refer to that type.
+//
+// Data encoded with the record schema can be decoded into messages of the
+// corresponding message type, as long as no field's type is a union that
+// includes "null" in any position other than the first.
+func ImportSchema(s *Schema, fileName string) (*builder.FileBuilder, error) {
+	if s.Type != TypeRecord {
+		return nil, fmt.Errorf("schema must be a record, not %s", s.Type)
+	}
+	if fileName == "" {
+		fileName = s.Name + ".proto"
+	}
+	imp := importer{
+		pkg:       s.Namespace,
+		fb:        builder.NewFile(fileName).SetProto3(true).SetPackageName(s.Namespace),
+		messages:  map[*Schema]*builder.MessageBuilder{},
+		enums:     map[*Schema]*builder.EnumBuilder{},
+		wellKnown: map[*Schema]*builder.FieldType{},
+	}
+	if err := imp.collect(s, map[*Schema]bool{}); err != nil {
+		return nil, err
+	}
+	if err := imp.place(); err != nil {
+		return nil, err
+	}
+	for _, rec := range imp.records {
+		if err := imp.populate(rec); err != nil {
+			return nil, fmt.Errorf("record %s: %w", rec.FullName(), err)
+		}
+	}
+	return imp.fb, nil
+}
+
+// MessageForSchema converts the given Avro record schema into a message
+// descriptor. It is a convenience that builds the file returned by
+// ImportSchema and returns the message that corresponds to s.
+func MessageForSchema(s *Schema) (*desc.MessageDescriptor, error) {
+	fb, err := ImportSchema(s, "")
+	if err != nil {
+		return nil, err
+	}
+	fd, err := fb.Build()
+	if err != nil {
+		return nil, err
+	}
+	name := s.Name
+	if fd.GetPackage() != "" {
+		name = fd.GetPackage() + "." + name
+	}
+	return fd.FindMessage(name), nil
+}
+
+type importer struct {
+	pkg      string
+	fb       *builder.FileBuilder
+	records  []*Schema
+	enums    map[*Schema]*builder.EnumBuilder
+	messages map[*Schema]*builder.MessageBuilder
+	// records that correspond to well-known types
+	wellKnown map[*Schema]*builder.FieldType
+	// named types in the order they were found
+	named []*Schema
+}
+
+// collect finds all named types reachable from s.
+func (imp *importer) collect(s *Schema, seen map[*Schema]bool) error {
+	if seen[s] {
+		return nil
+	}
+	seen[s] = true
+	if s.Type == TypeRecord && s.Namespace == "google.protobuf" {
+		// use the well-known type, if there is one with this name
+		if md, err := desc.LoadMessageDescriptor(s.FullName()); err == nil && md != nil {
+			imp.wellKnown[s] = builder.FieldTypeImportedMessage(md)
+			return nil
+		}
+	}
+	switch s.Type {
+	case TypeRecord:
+		imp.named = append(imp.named, s)
+		imp.records = append(imp.records, s)
+		imp.messages[s] = builder.NewMessage(s.Name)
+		for _, f := range s.Fields {
+			if f.Type == nil {
+				return fmt.Errorf("field %s.%s has no type", s.FullName(), f.Name)
+			}
+			if err := imp.collect(f.Type, seen); err != nil {
+				return err
+			}
+		}
+	case TypeEnum:
+		if len(s.Symbols) == 0 {
+			return fmt.Errorf("enum %s has no symbols", s.FullName())
+		}
+		imp.named = append(imp.named, s)
+		eb := builder.NewEnum(s.Name)
+		for i, sym := range s.Symbols {
+			eb.AddValue(builder.NewEnumValue(sym).SetNumber(int32(i)))
+		}
+		eb.SetComments(comments(s.Doc))
+		imp.enums[s] = eb
+	case TypeArray:
+		if s.Items == nil {
+			return fmt.Errorf("array schema has no items")
+		}
+		return imp.collect(s.Items, seen)
+	case TypeMap:
+		if s.Values == nil {
+			return fmt.Errorf("map schema has no values")
+		}
+		return imp.collect(s.Values, seen)
+	case TypeUnion:
+		for _, b := range s.Branches {
+			if err := imp.collect(b, seen); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// place adds each message and enum to the file, or to the message that
+// encloses it.
+func (imp *importer) place() error {
+	byName := map[string]*builder.MessageBuilder{}
+	for _, rec := range imp.records {
+		byName[rec.FullName()] = imp.messages[rec]
+	}
+	topLevel := map[string]bool{}
+	for _, s := range imp.named {
+		var b builder.Builder
+		if mb := imp.messages[s]; mb != nil {
+			mb.SetComments(comments(s.Doc))
+			b = mb
+		} else {
+			b = imp.enums[s]
+		}
+		parent := byName[s.Namespace]
+		if parent == nil {
+			if s.Namespace != imp.pkg || topLevel[s.Name] {
+				// names from another namespace might conflict
+				name := s.Name
+				for i := 2; topLevel[name]; i++ {
+					name = s.Name + strconv.Itoa(i)
+				}
+				if err := b.TrySetName(name); err != nil {
+					return err
+				}
+			}
+			topLevel[b.GetName()] = true
+			var err error
+			if mb, ok := b.(*builder.MessageBuilder); ok {
+				err = imp.fb.TryAddMessage(mb)
+			} else {
+				err = imp.fb.TryAddEnum(b.(*builder.EnumBuilder))
+			}
+			if err != nil {
+				return err
+			}
+			continue
+		}
+		var err error
+		if mb, ok := b.(*builder.MessageBuilder); ok {
+			err = parent.TryAddNestedMessage(mb)
+		} else {
+			err = parent.TryAddNestedEnum(b.(*builder.EnumBuilder))
+		}
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (imp *importer) populate(rec *Schema) error {
+	mb := imp.messages[rec]
+	var num int32
+	next := func() int32 {
+		num++
+		return num
+	}
+	for _, f := range rec.Fields {
+		t := f.Type
+		nullable := false
+		if t.Type == TypeUnion {
+			var nonNull []*Schema
+			for _, b := range t.Branches {
+				if b.Type != TypeNull {
+					nonNull = append(nonNull, b)
+				}
+			}
+			if len(nonNull) == 0 {
+				return fmt.Errorf("field %q: union has no types other than null", f.Name)
+			}
+			if len(nonNull) > 1 {
+				oob := builder.NewOneOf(f.Name)
+				oob.SetComments(comments(f.Doc))
+				for _, b := range nonNull {
+					ft, err := imp.valueType(b)
+					if err != nil {
+						return fmt.Errorf("field %q: %w", f.Name, err)
+					}
+					name := f.Name + "_" + snakeCase(b.FullName()[strings.LastIndexByte(b.FullName(), '.')+1:])
+					if err := oob.TryAddChoice(builder.NewField(name, ft).SetNumber(next())); err != nil {
+						return err
+					}
+				}
+				if err := mb.TryAddOneOf(oob); err != nil {
+					return err
+				}
+				continue
+			}
+			t, nullable = nonNull[0], true
+		}
+		var flb *builder.FieldBuilder
+		switch t.Type {
+		case TypeArray:
+			ft, err := imp.valueType(stripNull(t.Items))
+			if err != nil {
+				return fmt.Errorf("field %q: %w", f.Name, err)
+			}
+			flb = builder.NewField(f.Name, ft).SetRepeated()
+		case TypeMap:
+			ft, err := imp.valueType(stripNull(t.Values))
+			if err != nil {
+				return fmt.Errorf("field %q: %w", f.Name, err)
+			}
+			flb = builder.NewMapField(f.Name, builder.FieldTypeString(), ft)
+		default:
+			ft, err := imp.valueType(t)
+			if err != nil {
+				return fmt.Errorf("field %q: %w", f.Name, err)
+			}
+			flb = builder.NewField(f.Name, ft)
+			if nullable && ft.GetType() != descriptorpb.FieldDescriptorProto_TYPE_MESSAGE {
+				flb.SetProto3Optional(true)
+			}
+		}
+		flb.SetComments(comments(f.Doc))
+		if err := mb.TryAddField(flb.SetNumber(next())); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// stripNull returns the non-null member of a union of null and one other
+// type. Otherwise, it returns s.
+func stripNull(s *Schema) *Schema {
+	if s.Type == TypeUnion && len(s.Branches) == 2 && s.nullIndex() >= 0 {
+		return s.Branches[1-s.nullIndex()]
+	}
+	return s
+}
+
+func (imp *importer) valueType(s *Schema) (*builder.FieldType, error) {
+	if ft := imp.wellKnown[s]; ft != nil {
+		return ft, nil
+	}
+	switch s.Type {
+	case TypeBoolean:
+		return builder.FieldTypeBool(), nil
+	case TypeInt:
+		return builder.FieldTypeInt32(), nil
+	case TypeLong:
+		if s.LogicalType == LogicalTimestampMicros {
+			return wellKnownType(&timestamppb.Timestamp{})
+		}
+		return builder.FieldTypeInt64(), nil
+	case TypeFloat:
+		return builder.FieldTypeFloat(), nil
+	case TypeDouble:
+		return builder.FieldTypeDouble(), nil
+	case TypeBytes:
+		return builder.FieldTypeBytes(), nil
+	case TypeString:
+		return builder.FieldTypeString(), nil
+	case TypeFixed:
+		if s.LogicalType == LogicalDuration && s.Size == 12 {
+			return wellKnownType(&durationpb.Duration{})
+		}
+		return builder.FieldTypeBytes(), nil
+	case TypeEnum:
+		return builder.FieldTypeEnum(imp.enums[s]), nil
+	case TypeRecord:
+		return builder.FieldTypeMessage(imp.messages[s]), nil
+	case TypeNull:
+		return nil, fmt.Errorf("null type is only supported in a union")
+	default:
+		return nil, fmt.Errorf("%s type is not supported here", s.Type)
+	}
+}
+
+func wellKnownType(msg proto.Message) (*builder.FieldType, error) {
+	md, err := desc.LoadMessageDescriptorForMessage(msg)
+	if err != nil {
+		return nil, err
+	}
+	return builder.FieldTypeImportedMessage(md), nil
+}
+
+func comments(doc string) builder.Comments {
+	if doc == "" {
+		return builder.Comments{}
+	}
+	lines := strings.Split(doc, "\n")
+	for i := range lines {
+		lines[i] = " " + lines[i]
+	}
+	return builder.Comments{LeadingComment: strings.Join(lines, "\n") + "\n"}
+}
+
+func snakeCase(s string) string {
+	var sb strings.Builder
+	for i, r := range s {
+		if r >= 'A' && r <= 'Z' {
+			if i > 0 && s[i-1] != '_' {
+				sb.WriteByte('_')
+			}
+			r += 'a' - 'A'
+		}
+		sb.WriteRune(r)
+	}
+	return sb.String()
+}
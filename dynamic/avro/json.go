@@ -0,0 +1,360 @@
+package avro
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"math"
+	"strconv"
+	"unicode/utf8"
+
+	"github.com/jhump/protoreflect/dynamic"
+)
+
+// MarshalJSON encodes the given message using the Avro JSON encoding, with
+// the schema returned by SchemaForMessage for the message's descriptor.
+//
+// This is not the same as the JSON format for protocol buffers. Most notably,
+// non-null values of unions are wrapped in an object whose only key is the
+// name of the union member's type, and bytes are encoded as strings whose code
+// points are the values of each byte. Non-finite floating point values, which
+// have no representation in JSON, are encoded as the strings "NaN",
+// "Infinity", and "-Infinity".
+func MarshalJSON(m *dynamic.Message) ([]byte, error) {
+	s := SchemaForMessage(m.GetMessageDescriptor())
+	rec, err := messageToDatum(s, m)
+	if err != nil {
+		return nil, err
+	}
+	var buf bytes.Buffer
+	if err := writeJSON(&buf, s, rec); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// UnmarshalJSON decodes the given data, in the Avro JSON encoding, into the
+// given message. The data must have been encoded using the schema returned by
+// SchemaForMessage for the message's descriptor. Fields that are absent in the
+// data get their default value from the schema. The message is reset before
+// decoding.
+func UnmarshalJSON(data []byte, m *dynamic.Message) error {
+	s := SchemaForMessage(m.GetMessageDescriptor())
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.UseNumber()
+	var v interface{}
+	if err := dec.Decode(&v); err != nil {
+		return err
+	}
+	if dec.More() {
+		return fmt.Errorf("unexpected data after record")
+	}
+	d, err := jsonToDatum(s, v)
+	if err != nil {
+		return err
+	}
+	m.Reset()
+	return datumToMessage(s, d.([]interface{}), m)
+}
+
+func writeJSON(buf *bytes.Buffer, s *Schema, d interface{}) error {
+	switch s.Type {
+	case TypeNull:
+		buf.WriteString("null")
+	case TypeBoolean:
+		buf.WriteString(strconv.FormatBool(d.(bool)))
+	case TypeInt:
+		buf.WriteString(strconv.FormatInt(int64(d.(int32)), 10))
+	case TypeLong:
+		buf.WriteString(strconv.FormatInt(d.(int64), 10))
+	case TypeFloat:
+		writeFloat(buf, float64(d.(float32)), 32)
+	case TypeDouble:
+		writeFloat(buf, d.(float64), 64)
+	case TypeBytes, TypeFixed:
+		writeString(buf, bytesToJSON(d.([]byte)))
+	case TypeString:
+		writeString(buf, d.(string))
+	case TypeEnum:
+		writeString(buf, s.Symbols[d.(int)])
+	case TypeRecord:
+		obj := objectWriter{buf: buf}
+		for i, f := range s.Fields {
+			obj.key(f.Name)
+			if err := writeJSON(buf, f.Type, d.([]interface{})[i]); err != nil {
+				return err
+			}
+		}
+		obj.end()
+	case TypeArray:
+		buf.WriteByte('[')
+		for i, item := range d.([]interface{}) {
+			if i > 0 {
+				buf.WriteByte(',')
+			}
+			if err := writeJSON(buf, s.Items, item); err != nil {
+				return err
+			}
+		}
+		buf.WriteByte(']')
+	case TypeMap:
+		vals := d.(map[string]interface{})
+		obj := objectWriter{buf: buf}
+		for _, k := range sortedKeys(vals) {
+			obj.key(k)
+			if err := writeJSON(buf, s.Values, vals[k]); err != nil {
+				return err
+			}
+		}
+		obj.end()
+	case TypeUnion:
+		u := d.(unionValue)
+		branch := s.Branches[u.index]
+		if branch.Type == TypeNull {
+			buf.WriteString("null")
+			return nil
+		}
+		obj := objectWriter{buf: buf}
+		obj.key(branch.FullName())
+		if err := writeJSON(buf, branch, u.value); err != nil {
+			return err
+		}
+		obj.end()
+	default:
+		return fmt.Errorf("unknown schema type %q", s.Type)
+	}
+	return nil
+}
+
+func writeFloat(buf *bytes.Buffer, f float64, bitSize int) {
+	switch {
+	case math.IsNaN(f):
+		buf.WriteString(`"NaN"`)
+	case math.IsInf(f, 1):
+		buf.WriteString(`"Infinity"`)
+	case math.IsInf(f, -1):
+		buf.WriteString(`"-Infinity"`)
+	default:
+		buf.WriteString(strconv.FormatFloat(f, 'g', -1, bitSize))
+	}
+}
+
+// bytesToJSON returns a string whose code points are the given bytes, which
+// is how the Avro JSON encoding represents bytes.
+func bytesToJSON(b []byte) string {
+	runes := make([]rune, len(b))
+	for i, c := range b {
+		runes[i] = rune(c)
+	}
+	return string(runes)
+}
+
+func jsonToBytes(s string) ([]byte, error) {
+	b := make([]byte, 0, len(s))
+	for _, r := range s {
+		if r > 0xff || r == utf8.RuneError {
+			return nil, fmt.Errorf("bytes value contains invalid character %q", r)
+		}
+		b = append(b, byte(r))
+	}
+	return b, nil
+}
+
+func jsonToDatum(s *Schema, v interface{}) (interface{}, error) {
+	switch s.Type {
+	case TypeNull:
+		if v != nil {
+			return nil, jsonTypeError(s, v)
+		}
+		return nil, nil
+	case TypeBoolean:
+		b, ok := v.(bool)
+		if !ok {
+			return nil, jsonTypeError(s, v)
+		}
+		return b, nil
+	case TypeInt, TypeLong:
+		n, ok := v.(json.Number)
+		if !ok {
+			return nil, jsonTypeError(s, v)
+		}
+		bitSize := 64
+		if s.Type == TypeInt {
+			bitSize = 32
+		}
+		i, err := strconv.ParseInt(string(n), 10, bitSize)
+		if err != nil {
+			return nil, fmt.Errorf("invalid %s value %s", s.Type, n)
+		}
+		if s.Type == TypeInt {
+			return int32(i), nil
+		}
+		return i, nil
+	case TypeFloat, TypeDouble:
+		var f float64
+		switch v := v.(type) {
+		case json.Number:
+			var err error
+			if f, err = strconv.ParseFloat(string(v), 64); err != nil {
+				return nil, fmt.Errorf("invalid %s value %s", s.Type, v)
+			}
+		case string:
+			switch v {
+			case "NaN":
+				f = math.NaN()
+			case "Infinity":
+				f = math.Inf(1)
+			case "-Infinity":
+				f = math.Inf(-1)
+			default:
+				return nil, fmt.Errorf("invalid %s value %q", s.Type, v)
+			}
+		default:
+			return nil, jsonTypeError(s, v)
+		}
+		if s.Type == TypeFloat {
+			return float32(f), nil
+		}
+		return f, nil
+	case TypeBytes, TypeFixed:
+		str, ok := v.(string)
+		if !ok {
+			return nil, jsonTypeError(s, v)
+		}
+		b, err := jsonToBytes(str)
+		if err != nil {
+			return nil, err
+		}
+		if s.Type == TypeFixed && len(b) != s.Size {
+			return nil, fmt.Errorf("fixed %s needs %d bytes, got %d", s.FullName(), s.Size, len(b))
+		}
+		return b, nil
+	case TypeString:
+		str, ok := v.(string)
+		if !ok {
+			return nil, jsonTypeError(s, v)
+		}
+		return str, nil
+	case TypeEnum:
+		str, ok := v.(string)
+		if !ok {
+			return nil, jsonTypeError(s, v)
+		}
+		for i, sym := range s.Symbols {
+			if sym == str {
+				return i, nil
+			}
+		}
+		return nil, fmt.Errorf("enum %s has no symbol %q", s.FullName(), str)
+	case TypeRecord:
+		obj, ok := v.(map[string]interface{})
+		if !ok {
+			return nil, jsonTypeError(s, v)
+		}
+		rec := make([]interface{}, len(s.Fields))
+		for i, f := range s.Fields {
+			fv, ok := obj[f.Name]
+			var err error
+			if ok {
+				rec[i], err = jsonToDatum(f.Type, fv)
+			} else if f.Default != nil {
+				rec[i], err = defaultToDatum(f.Type, f.Default)
+			} else {
+				err = fmt.Errorf("value is missing")
+			}
+			if err != nil {
+				return nil, fmt.Errorf("%s.%s: %w", s.FullName(), f.Name, err)
+			}
+		}
+		return rec, nil
+	case TypeArray:
+		arr, ok := v.([]interface{})
+		if !ok {
+			return nil, jsonTypeError(s, v)
+		}
+		items := make([]interface{}, len(arr))
+		for i, item := range arr {
+			var err error
+			if items[i], err = jsonToDatum(s.Items, item); err != nil {
+				return nil, err
+			}
+		}
+		return items, nil
+	case TypeMap:
+		obj, ok := v.(map[string]interface{})
+		if !ok {
+			return nil, jsonTypeError(s, v)
+		}
+		vals := make(map[string]interface{}, len(obj))
+		for k, val := range obj {
+			var err error
+			if vals[k], err = jsonToDatum(s.Values, val); err != nil {
+				return nil, err
+			}
+		}
+		return vals, nil
+	case TypeUnion:
+		if v == nil {
+			if idx := s.nullIndex(); idx >= 0 {
+				return unionValue{index: idx}, nil
+			}
+			return nil, fmt.Errorf("union does not include null")
+		}
+		obj, ok := v.(map[string]interface{})
+		if !ok || len(obj) != 1 {
+			return nil, fmt.Errorf("union value must be null or an object with a single key")
+		}
+		for name, val := range obj {
+			for i, b := range s.Branches {
+				if b.FullName() == name {
+					d, err := jsonToDatum(b, val)
+					if err != nil {
+						return nil, err
+					}
+					return unionValue{index: i, value: d}, nil
+				}
+			}
+			return nil, fmt.Errorf("union has no member named %q", name)
+		}
+	}
+	return nil, fmt.Errorf("unknown schema type %q", s.Type)
+}
+
+// defaultToDatum converts the default value of a field. Default values are
+// not encoded like other values: the default value of a union is a value for
+// the union's first member.
+func defaultToDatum(s *Schema, def json.RawMessage) (interface{}, error) {
+	dec := json.NewDecoder(bytes.NewReader(def))
+	dec.UseNumber()
+	var v interface{}
+	if err := dec.Decode(&v); err != nil {
+		return nil, err
+	}
+	if s.Type == TypeUnion {
+		d, err := jsonToDatum(s.Branches[0], v)
+		if err != nil {
+			return nil, err
+		}
+		return unionValue{index: 0, value: d}, nil
+	}
+	return jsonToDatum(s, v)
+}
+
+func jsonTypeError(s *Schema, v interface{}) error {
+	var kind string
+	switch v.(type) {
+	case nil:
+		kind = "null"
+	case bool:
+		kind = "boolean"
+	case json.Number:
+		kind = "number"
+	case string:
+		kind = "string"
+	case []interface{}:
+		kind = "array"
+	default:
+		kind = "object"
+	}
+	return fmt.Errorf("%s value cannot be a JSON %s", s.Type, kind)
+}
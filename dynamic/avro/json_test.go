@@ -0,0 +1,89 @@
+package avro
+
+import (
+	"math"
+	"testing"
+
+	"github.com/golang/protobuf/proto"
+
+	"github.com/jhump/protoreflect/desc"
+	"github.com/jhump/protoreflect/dynamic"
+	"github.com/jhump/protoreflect/internal/testprotos"
+	"github.com/jhump/protoreflect/internal/testutil"
+)
+
+func TestJSONRoundTrip(t *testing.T) {
+	for _, msg := range testMessages(t) {
+		md, err := desc.LoadMessageDescriptorForMessage(msg)
+		testutil.Ok(t, err)
+		t.Run(md.GetName(), func(t *testing.T) {
+			dm := dynamic.NewMessage(md)
+			testutil.Ok(t, dm.ConvertFrom(msg))
+			data, err := MarshalJSON(dm)
+			testutil.Ok(t, err)
+
+			decoded := dynamic.NewMessage(md)
+			testutil.Ok(t, UnmarshalJSON(data, decoded))
+			testutil.Require(t, dynamic.MessagesEqual(dm, decoded), "%v != %v", dm, decoded)
+		})
+	}
+}
+
+func TestMarshalJSON(t *testing.T) {
+	md, err := desc.LoadMessageDescriptorForMessage((*testprotos.AnotherTestMessage)(nil))
+	testutil.Ok(t, err)
+	dm := dynamic.NewMessage(md)
+	testutil.Ok(t, dm.ConvertFrom(&testprotos.AnotherTestMessage{
+		MapField1: map[int32]string{2: "b", -1: "a"},
+		MapField2: map[int64]float32{3: float32(math.NaN())},
+		Atmoo:     &testprotos.AnotherTestMessage_Int{Int: 42},
+	}))
+	data, err := MarshalJSON(dm)
+	testutil.Ok(t, err)
+	testutil.Eq(t, `{"dne":null,"map_field1":{"-1":"a","2":"b"},"map_field2":{"3":"NaN"},"map_field3":{},"map_field4":{},`+
+		`"rocknroll":null,"atmoo":{"long":42},"withoptions":null}`, string(data))
+
+	md, err = desc.LoadMessageDescriptorForMessage((*testprotos.UnaryFields)(nil))
+	testutil.Ok(t, err)
+	dm = dynamic.NewMessage(md)
+	testutil.Ok(t, dm.ConvertFrom(&testprotos.UnaryFields{
+		U: []byte{0, 'a', 0xff},
+		Z: testprotos.TestEnum_SECOND.Enum(),
+	}))
+	data, err = MarshalJSON(dm)
+	testutil.Ok(t, err)
+	testutil.Eq(t, `{"i":null,"j":null,"k":null,"l":null,"m":null,"n":null,"o":null,"p":null,"q":null,"r":null,"s":null,"t":null,`+
+		`"u":{"bytes":"\u0000aÿ"},"v":null,"w":null,"x":null,"groupy":null,"z":{"testprotos.TestEnum":"SECOND"}}`, string(data))
+}
+
+func TestUnmarshalJSON_Defaults(t *testing.T) {
+	md, err := desc.LoadMessageDescriptorForMessage((*testprotos.TestRequest)(nil))
+	testutil.Ok(t, err)
+	dm := dynamic.NewMessage(md)
+	// absent fields get the defaults from the schema
+	testutil.Ok(t, UnmarshalJSON([]byte(`{"bar": "abc", "flags": {"x": true}}`), dm))
+	var res testprotos.TestRequest
+	testutil.Ok(t, dm.ConvertTo(&res))
+	testutil.Require(t, proto.Equal(&testprotos.TestRequest{Bar: "abc", Flags: map[string]bool{"x": true}}, &res), "unexpected result: %v", &res)
+}
+
+func TestUnmarshalJSONErrors(t *testing.T) {
+	md, err := desc.LoadMessageDescriptorForMessage((*testprotos.AnotherTestMessage)(nil))
+	testutil.Ok(t, err)
+	testCases := map[string]string{
+		"not an object":       `[]`,
+		"wrong type":          `{"map_field1": []}`,
+		"bad map key":         `{"map_field1": {"abc": "def"}}`,
+		"unwrapped union":     `{"atmoo": 42}`,
+		"unknown union type":  `{"atmoo": {"int": 42}}`,
+		"unknown enum symbol": `{"dne": {"testprotos.TestMessage.NestedMessage.AnotherNestedMessage.YetAnotherNestedMessage.DeeplyNestedEnum": "VALUE3"}}`,
+		"bad float":           `{"map_field2": {"1": "Inf"}}`,
+		"trailing data":       `{} {}`,
+	}
+	for name, data := range testCases {
+		t.Run(name, func(t *testing.T) {
+			err := UnmarshalJSON([]byte(data), dynamic.NewMessage(md))
+			testutil.Nok(t, err)
+		})
+	}
+}
@@ -0,0 +1,567 @@
+package avro
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"strings"
+)
+
+// Types of Avro schemas. The first eight are primitive types; the others are
+// complex types.
+const (
+	TypeNull    = "null"
+	TypeBoolean = "boolean"
+	TypeInt     = "int"
+	TypeLong    = "long"
+	TypeFloat   = "float"
+	TypeDouble  = "double"
+	TypeBytes   = "bytes"
+	TypeString  = "string"
+	TypeRecord  = "record"
+	TypeEnum    = "enum"
+	TypeArray   = "array"
+	TypeMap     = "map"
+	TypeFixed   = "fixed"
+	// TypeUnion is used for schemas that are a union of other schemas. In an
+	// Avro schema document, unions are written as a JSON array.
+	TypeUnion = "union"
+)
+
+// Logical types that are used when mapping well-known types.
+const (
+	LogicalTimestampMillis = "timestamp-millis"
+	LogicalTimestampMicros = "timestamp-micros"
+	LogicalTimestampNanos  = "timestamp-nanos"
+	LogicalDuration        = "duration"
+)
+
+// Schema is an Avro schema. Named schemas (records, enums, and fixed) may be
+// referenced more than once in a graph of schemas. In the JSON form of a
+// schema, the first occurrence of a named schema is its definition and the
+// others are references to it by name. Recursive types are represented by a
+// record that refers to itself.
+type Schema struct {
+	// One of the Type* constants.
+	Type string
+	// The name and namespace of a record, enum, or fixed.
+	Name      string
+	Namespace string
+	Doc       string
+	Aliases   []string
+	// LogicalType annotates the type with a more specific interpretation,
+	// such as "timestamp-micros" for a "long".
+	LogicalType string
+	// The precision and scale of a "decimal" logical type.
+	Precision int
+	Scale     int
+
+	// The fields of a record.
+	Fields []*Field
+	// The symbols of an enum and, optionally, the symbol to use when reading
+	// a symbol that is not known.
+	Symbols []string
+	Default string
+	// The element type of an array.
+	Items *Schema
+	// The value type of a map. Keys are always strings.
+	Values *Schema
+	// The size, in bytes, of a fixed.
+	Size int
+	// The members of a union.
+	Branches []*Schema
+}
+
+// Field is a field in an Avro record.
+type Field struct {
+	Name    string
+	Doc     string
+	Type    *Schema
+	Aliases []string
+	// The JSON form of the field's default value, or nil if it has none.
+	Default json.RawMessage
+}
+
+// FullName returns the fully-qualified name of a named schema. For other
+// schemas, it returns the type name, which is also the name used for the
+// schema as a member of a union in the JSON encoding.
+func (s *Schema) FullName() string {
+	switch s.Type {
+	case TypeRecord, TypeEnum, TypeFixed:
+		if s.Namespace == "" {
+			return s.Name
+		}
+		return s.Namespace + "." + s.Name
+	default:
+		return s.Type
+	}
+}
+
+// IsNullable returns true if the schema is a union that includes "null".
+func (s *Schema) IsNullable() bool {
+	return s.nullIndex() >= 0
+}
+
+func (s *Schema) nullIndex() int {
+	if s.Type != TypeUnion {
+		return -1
+	}
+	for i, b := range s.Branches {
+		if b.Type == TypeNull {
+			return i
+		}
+	}
+	return -1
+}
+
+// String returns the schema in JSON form.
+func (s *Schema) String() string {
+	b, err := s.MarshalJSON()
+	if err != nil {
+		return fmt.Sprintf("<%v>", err)
+	}
+	return string(b)
+}
+
+// MarshalJSON returns the JSON form of the schema, as described by the Avro
+// specification.
+func (s *Schema) MarshalJSON() ([]byte, error) {
+	var buf bytes.Buffer
+	if err := s.writeJSON(&buf, map[*Schema]bool{}); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+func (s *Schema) writeJSON(buf *bytes.Buffer, defined map[*Schema]bool) error {
+	switch s.Type {
+	case TypeUnion:
+		buf.WriteByte('[')
+		for i, b := range s.Branches {
+			if i > 0 {
+				buf.WriteByte(',')
+			}
+			if err := b.writeJSON(buf, defined); err != nil {
+				return err
+			}
+		}
+		buf.WriteByte(']')
+		return nil
+	case TypeNull, TypeBoolean, TypeInt, TypeLong, TypeFloat, TypeDouble, TypeBytes, TypeString:
+		if s.LogicalType == "" {
+			writeString(buf, s.Type)
+			return nil
+		}
+	case TypeRecord, TypeEnum, TypeFixed:
+		if s.Name == "" {
+			return fmt.Errorf("%s schema has no name", s.Type)
+		}
+		if defined[s] {
+			writeString(buf, s.FullName())
+			return nil
+		}
+		defined[s] = true
+	case TypeArray:
+		if s.Items == nil {
+			return fmt.Errorf("array schema has no items")
+		}
+	case TypeMap:
+		if s.Values == nil {
+			return fmt.Errorf("map schema has no values")
+		}
+	default:
+		return fmt.Errorf("unknown schema type %q", s.Type)
+	}
+
+	obj := objectWriter{buf: buf}
+	obj.str("type", s.Type)
+	if s.Name != "" {
+		obj.str("name", s.Name)
+		if s.Namespace != "" {
+			obj.str("namespace", s.Namespace)
+		}
+	}
+	if s.Doc != "" {
+		obj.str("doc", s.Doc)
+	}
+	if len(s.Aliases) > 0 {
+		obj.value("aliases", s.Aliases)
+	}
+	if s.LogicalType != "" {
+		obj.str("logicalType", s.LogicalType)
+		if s.Precision != 0 {
+			obj.value("precision", s.Precision)
+		}
+		if s.Scale != 0 {
+			obj.value("scale", s.Scale)
+		}
+	}
+	switch s.Type {
+	case TypeRecord:
+		obj.key("fields")
+		buf.WriteByte('[')
+		for i, f := range s.Fields {
+			if i > 0 {
+				buf.WriteByte(',')
+			}
+			if f.Type == nil {
+				return fmt.Errorf("field %s.%s has no type", s.FullName(), f.Name)
+			}
+			fobj := objectWriter{buf: buf}
+			fobj.str("name", f.Name)
+			if f.Doc != "" {
+				fobj.str("doc", f.Doc)
+			}
+			fobj.key("type")
+			if err := f.Type.writeJSON(buf, defined); err != nil {
+				return err
+			}
+			if len(f.Aliases) > 0 {
+				fobj.value("aliases", f.Aliases)
+			}
+			if f.Default != nil {
+				fobj.key("default")
+				buf.Write(f.Default)
+			}
+			fobj.end()
+		}
+		buf.WriteByte(']')
+	case TypeEnum:
+		obj.value("symbols", s.Symbols)
+		if s.Default != "" {
+			obj.str("default", s.Default)
+		}
+	case TypeFixed:
+		obj.value("size", s.Size)
+	case TypeArray:
+		obj.key("items")
+		if err := s.Items.writeJSON(buf, defined); err != nil {
+			return err
+		}
+	case TypeMap:
+		obj.key("values")
+		if err := s.Values.writeJSON(buf, defined); err != nil {
+			return err
+		}
+	}
+	obj.end()
+	return nil
+}
+
+// objectWriter writes a JSON object whose keys are in the order they are
+// added, so that schemas read naturally, with "type" and "name" first.
+type objectWriter struct {
+	buf     *bytes.Buffer
+	started bool
+}
+
+func (w *objectWriter) key(k string) {
+	if w.started {
+		w.buf.WriteByte(',')
+	} else {
+		w.buf.WriteByte('{')
+		w.started = true
+	}
+	writeString(w.buf, k)
+	w.buf.WriteByte(':')
+}
+
+func (w *objectWriter) str(k, v string) {
+	w.key(k)
+	writeString(w.buf, v)
+}
+
+func (w *objectWriter) value(k string, v interface{}) {
+	w.key(k)
+	b, _ := json.Marshal(v)
+	w.buf.Write(b)
+}
+
+func (w *objectWriter) end() {
+	if !w.started {
+		w.buf.WriteByte('{')
+	}
+	w.buf.WriteByte('}')
+}
+
+func writeString(buf *bytes.Buffer, s string) {
+	b, _ := json.Marshal(s)
+	buf.Write(b)
+}
+
+// UnmarshalJSON parses the JSON form of a schema into s.
+func (s *Schema) UnmarshalJSON(data []byte) error {
+	parsed, err := ParseSchema(data)
+	if err != nil {
+		return err
+	}
+	*s = *parsed
+	// recursive references need to point to s instead of parsed
+	s.replace(parsed, s, map[*Schema]bool{})
+	return nil
+}
+
+func (s *Schema) replace(old, new *Schema, seen map[*Schema]bool) {
+	if seen[s] {
+		return
+	}
+	seen[s] = true
+	fix := func(p **Schema) {
+		if *p == old {
+			*p = new
+		}
+		if *p != nil {
+			(*p).replace(old, new, seen)
+		}
+	}
+	for _, f := range s.Fields {
+		fix(&f.Type)
+	}
+	fix(&s.Items)
+	fix(&s.Values)
+	for i := range s.Branches {
+		fix(&s.Branches[i])
+	}
+}
+
+// ParseSchema parses the given JSON form of an Avro schema. References to
+// named schemas are resolved, so every reference to a named schema in the
+// returned graph points to the same *Schema. A reference to a name that is
+// not defined earlier in the document, or by an enclosing record, is an error.
+func ParseSchema(data []byte) (*Schema, error) {
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.UseNumber()
+	var v interface{}
+	if err := dec.Decode(&v); err != nil {
+		return nil, err
+	}
+	p := schemaParser{named: map[string]*Schema{}}
+	return p.parse(v, "")
+}
+
+type schemaParser struct {
+	named map[string]*Schema
+}
+
+func (p *schemaParser) parse(v interface{}, namespace string) (*Schema, error) {
+	switch v := v.(type) {
+	case string:
+		if isPrimitive(v) {
+			return &Schema{Type: v}, nil
+		}
+		return p.resolve(v, namespace)
+	case []interface{}:
+		u := &Schema{Type: TypeUnion}
+		for _, b := range v {
+			s, err := p.parse(b, namespace)
+			if err != nil {
+				return nil, err
+			}
+			if s.Type == TypeUnion {
+				return nil, fmt.Errorf("union may not immediately contain another union")
+			}
+			u.Branches = append(u.Branches, s)
+		}
+		return u, nil
+	case map[string]interface{}:
+		return p.parseObject(v, namespace)
+	default:
+		return nil, fmt.Errorf("invalid schema: %v", v)
+	}
+}
+
+func (p *schemaParser) resolve(name, namespace string) (*Schema, error) {
+	if !strings.Contains(name, ".") && namespace != "" {
+		if s := p.named[namespace+"."+name]; s != nil {
+			return s, nil
+		}
+	}
+	if s := p.named[name]; s != nil {
+		return s, nil
+	}
+	return nil, fmt.Errorf("unknown type %q", name)
+}
+
+func (p *schemaParser) parseObject(obj map[string]interface{}, namespace string) (*Schema, error) {
+	var s *Schema
+	switch t := obj["type"].(type) {
+	case string:
+		s = &Schema{Type: t}
+	case nil:
+		return nil, fmt.Errorf("schema object has no type")
+	default:
+		// the type is itself a schema; any other attributes, such as a
+		// logical type, annotate it
+		inner, err := p.parse(t, namespace)
+		if err != nil {
+			return nil, err
+		}
+		if inner.Type == TypeUnion || inner.Name != "" {
+			return inner, nil
+		}
+		copied := *inner
+		s = &copied
+	}
+	var err error
+	str := func(key string) string {
+		v, ok := obj[key]
+		if !ok {
+			return ""
+		}
+		sv, ok := v.(string)
+		if !ok && err == nil {
+			err = fmt.Errorf("%q of %s schema must be a string", key, s.Type)
+		}
+		return sv
+	}
+	num := func(key string) int {
+		v, ok := obj[key]
+		if !ok {
+			return 0
+		}
+		n, ok := v.(json.Number)
+		i, e := n.Int64()
+		if (!ok || e != nil) && err == nil {
+			err = fmt.Errorf("%q of %s schema must be an integer", key, s.Type)
+		}
+		return int(i)
+	}
+	strs := func(key string) []string {
+		v, ok := obj[key]
+		if !ok {
+			return nil
+		}
+		arr, ok := v.([]interface{})
+		if !ok {
+			if err == nil {
+				err = fmt.Errorf("%q of %s schema must be an array", key, s.Type)
+			}
+			return nil
+		}
+		res := make([]string, len(arr))
+		for i, e := range arr {
+			if res[i], ok = e.(string); !ok && err == nil {
+				err = fmt.Errorf("%q of %s schema must be an array of strings", key, s.Type)
+			}
+		}
+		return res
+	}
+
+	s.Doc = str("doc")
+	if lt := str("logicalType"); lt != "" {
+		s.LogicalType = lt
+		s.Precision = num("precision")
+		s.Scale = num("scale")
+	}
+	switch s.Type {
+	case TypeNull, TypeBoolean, TypeInt, TypeLong, TypeFloat, TypeDouble, TypeBytes, TypeString:
+	case TypeRecord, "error", TypeEnum, TypeFixed:
+		if s.Type == "error" {
+			s.Type = TypeRecord
+		}
+		s.Name = str("name")
+		s.Namespace = str("namespace")
+		s.Aliases = strs("aliases")
+		if err != nil {
+			return nil, err
+		}
+		if s.Name == "" {
+			return nil, fmt.Errorf("%s schema has no name", s.Type)
+		}
+		if pos := strings.LastIndexByte(s.Name, '.'); pos >= 0 {
+			s.Namespace, s.Name = s.Name[:pos], s.Name[pos+1:]
+		} else if _, ok := obj["namespace"]; !ok {
+			s.Namespace = namespace
+		}
+		fullName := s.FullName()
+		if p.named[fullName] != nil {
+			return nil, fmt.Errorf("type %q is defined more than once", fullName)
+		}
+		// register the name before parsing fields, so that a record can
+		// refer to itself
+		p.named[fullName] = s
+		switch s.Type {
+		case TypeRecord:
+			fields, ok := obj["fields"].([]interface{})
+			if !ok {
+				return nil, fmt.Errorf("record %q must have an array of fields", fullName)
+			}
+			for _, f := range fields {
+				fld, err := p.parseField(f, s.Namespace)
+				if err != nil {
+					return nil, fmt.Errorf("record %q: %w", fullName, err)
+				}
+				s.Fields = append(s.Fields, fld)
+			}
+		case TypeEnum:
+			s.Symbols = strs("symbols")
+			s.Default = str("default")
+		case TypeFixed:
+			s.Size = num("size")
+		}
+	case TypeArray:
+		items, ok := obj["items"]
+		if !ok {
+			return nil, fmt.Errorf("array schema has no items")
+		}
+		if s.Items, err = p.parse(items, namespace); err != nil {
+			return nil, err
+		}
+	case TypeMap:
+		values, ok := obj["values"]
+		if !ok {
+			return nil, fmt.Errorf("map schema has no values")
+		}
+		if s.Values, err = p.parse(values, namespace); err != nil {
+			return nil, err
+		}
+	default:
+		// a reference to a named type, with extra attributes
+		return p.resolve(s.Type, namespace)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+func (p *schemaParser) parseField(v interface{}, namespace string) (*Field, error) {
+	obj, ok := v.(map[string]interface{})
+	if !ok {
+		return nil, fmt.Errorf("field must be an object")
+	}
+	f := &Field{}
+	if f.Name, ok = obj["name"].(string); !ok || f.Name == "" {
+		return nil, fmt.Errorf("field has no name")
+	}
+	f.Doc, _ = obj["doc"].(string)
+	if aliases, ok := obj["aliases"].([]interface{}); ok {
+		for _, a := range aliases {
+			if s, ok := a.(string); ok {
+				f.Aliases = append(f.Aliases, s)
+			}
+		}
+	}
+	t, ok := obj["type"]
+	if !ok {
+		return nil, fmt.Errorf("field %q has no type", f.Name)
+	}
+	var err error
+	if f.Type, err = p.parse(t, namespace); err != nil {
+		return nil, fmt.Errorf("field %q: %w", f.Name, err)
+	}
+	if d, ok := obj["default"]; ok {
+		if f.Default, err = json.Marshal(d); err != nil {
+			return nil, err
+		}
+	}
+	return f, nil
+}
+
+func isPrimitive(t string) bool {
+	switch t {
+	case TypeNull, TypeBoolean, TypeInt, TypeLong, TypeFloat, TypeDouble, TypeBytes, TypeString:
+		return true
+	}
+	return false
+}
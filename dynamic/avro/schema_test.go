@@ -0,0 +1,100 @@
+package avro
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/jhump/protoreflect/internal/testutil"
+)
+
+const linkedListSchema = `{
+	"type": "record",
+	"name": "LinkedList",
+	"namespace": "example.lists",
+	"doc": "A list of names.",
+	"fields": [
+		{"name": "name", "type": "string", "default": ""},
+		{"name": "kind", "type": {"type": "enum", "name": "Kind", "symbols": ["PERSON", "PLACE"]}},
+		{"name": "also", "type": "Kind"},
+		{"name": "created", "type": {"type": "long", "logicalType": "timestamp-micros"}},
+		{"name": "hash", "type": {"type": "fixed", "name": "Hash", "namespace": "example.hashes", "size": 16}},
+		{"name": "counts", "type": {"type": "map", "values": "long"}},
+		{"name": "next", "type": ["null", "LinkedList"], "default": null}
+	]
+}`
+
+func TestParseSchema(t *testing.T) {
+	s, err := ParseSchema([]byte(linkedListSchema))
+	testutil.Ok(t, err)
+	testutil.Eq(t, TypeRecord, s.Type)
+	testutil.Eq(t, "example.lists.LinkedList", s.FullName())
+	testutil.Eq(t, "A list of names.", s.Doc)
+	testutil.Eq(t, 7, len(s.Fields))
+
+	testutil.Eq(t, TypeString, s.Fields[0].Type.Type)
+	testutil.Eq(t, `""`, string(s.Fields[0].Default))
+
+	kind := s.Fields[1].Type
+	testutil.Eq(t, "example.lists.Kind", kind.FullName())
+	testutil.Eq(t, []string{"PERSON", "PLACE"}, kind.Symbols)
+	// references resolve to the same schema
+	testutil.Require(t, s.Fields[2].Type == kind)
+
+	testutil.Eq(t, TypeLong, s.Fields[3].Type.Type)
+	testutil.Eq(t, LogicalTimestampMicros, s.Fields[3].Type.LogicalType)
+
+	hash := s.Fields[4].Type
+	testutil.Eq(t, "example.hashes.Hash", hash.FullName())
+	testutil.Eq(t, 16, hash.Size)
+
+	counts := s.Fields[5].Type
+	testutil.Eq(t, TypeMap, counts.Type)
+	testutil.Eq(t, TypeLong, counts.Values.Type)
+
+	next := s.Fields[6].Type
+	testutil.Eq(t, TypeUnion, next.Type)
+	testutil.Require(t, next.IsNullable())
+	testutil.Require(t, next.Branches[1] == s)
+	testutil.Eq(t, "null", string(s.Fields[6].Default))
+}
+
+func TestSchemaMarshalJSON(t *testing.T) {
+	s, err := ParseSchema([]byte(linkedListSchema))
+	testutil.Ok(t, err)
+	b, err := json.Marshal(s)
+	testutil.Ok(t, err)
+
+	// named types are only defined once; later uses are references
+	var generic map[string]interface{}
+	testutil.Ok(t, json.Unmarshal(b, &generic))
+	fields := generic["fields"].([]interface{})
+	testutil.Eq(t, "example.lists.Kind", fields[2].(map[string]interface{})["type"])
+	next := fields[6].(map[string]interface{})["type"].([]interface{})
+	testutil.Eq(t, "example.lists.LinkedList", next[1])
+
+	// and the result parses to an equivalent schema
+	var again Schema
+	testutil.Ok(t, json.Unmarshal(b, &again))
+	b2, err := json.Marshal(&again)
+	testutil.Ok(t, err)
+	testutil.Eq(t, string(b), string(b2))
+}
+
+func TestParseSchemaErrors(t *testing.T) {
+	testCases := map[string]string{
+		"unknown type":        `{"type": "record", "name": "R", "fields": [{"name": "f", "type": "Other"}]}`,
+		"no name":             `{"type": "enum", "symbols": ["A"]}`,
+		"duplicate name":      `["null", {"type": "fixed", "name": "F", "size": 1}, {"type": "fixed", "name": "F", "size": 2}]`,
+		"nested union":        `["null", ["int", "long"]]`,
+		"array without items": `{"type": "array"}`,
+		"field without type":  `{"type": "record", "name": "R", "fields": [{"name": "f"}]}`,
+		"bad size":            `{"type": "fixed", "name": "F", "size": "16"}`,
+		"not json":            `{"type": `,
+	}
+	for name, data := range testCases {
+		t.Run(name, func(t *testing.T) {
+			_, err := ParseSchema([]byte(data))
+			testutil.Nok(t, err)
+		})
+	}
+}
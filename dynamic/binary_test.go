@@ -1,10 +1,15 @@
 package dynamic
 
 import (
+	"bytes"
+	"io/ioutil"
 	"reflect"
 	"testing"
 
 	"github.com/golang/protobuf/proto"
+	protov2 "google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/types/descriptorpb"
+	"google.golang.org/protobuf/types/dynamicpb"
 
 	"github.com/jhump/protoreflect/codec"
 	"github.com/jhump/protoreflect/desc"
@@ -192,3 +197,58 @@ func assertByteSlicesBackedBySameData(t *testing.T, a, b []byte) {
 	resultPtr := reflect.ValueOf(b).Pointer()
 	testutil.Eq(t, origPtr, resultPtr)
 }
+
+func TestBinaryEditions(t *testing.T) {
+	md := loadEditionsTestMessage(t)
+	dm := NewMessage(md)
+	// implicit presence: zero values are not retained
+	dm.SetFieldByName("name", "")
+	testutil.Require(t, !dm.HasFieldName("name"))
+	dm.SetFieldByName("name", "foo")
+	testutil.Require(t, dm.HasFieldName("name"))
+	// explicit presence: zero values are retained
+	dm.SetFieldByName("id", int32(0))
+	testutil.Require(t, dm.HasFieldName("id"))
+	// required via features
+	testutil.Nok(t, dm.Validate())
+	dm.SetFieldByName("key", uint64(123))
+	testutil.Ok(t, dm.Validate())
+
+	dm.SetFieldByName("values", []int32{1, 2, 3})
+	dm.SetFieldByName("others", []int64{-1, -2, -3})
+	bar := NewMessage(md.FindFieldByName("bar").GetMessageType())
+	bar.SetFieldByName("baz", "abc")
+	dm.SetFieldByName("bar", bar)
+	dm.SetFieldByName("not_a_group", bar)
+
+	// verify that encoding matches the protobuf runtime
+	b, err := dm.MarshalDeterministic()
+	testutil.Ok(t, err)
+	other := dynamicpb.NewMessage(md.UnwrapMessage())
+	err = protov2.Unmarshal(b, other)
+	testutil.Ok(t, err)
+	expected, err := protov2.MarshalOptions{Deterministic: true}.Marshal(other)
+	testutil.Ok(t, err)
+	testutil.Eq(t, expected, b)
+	testutil.Eq(t, 0, len(other.GetUnknown()))
+
+	// delimited fields use the group wire type
+	fieldTag := (int32(6) << 3) | int32(proto.WireStartGroup)
+	testutil.Require(t, bytes.Contains(b, []byte{byte(fieldTag)}))
+
+	dm2 := NewMessage(md)
+	err = dm2.Unmarshal(b)
+	testutil.Ok(t, err)
+	testutil.Require(t, Equal(dm, dm2))
+}
+
+func loadEditionsTestMessage(t *testing.T) *desc.MessageDescriptor {
+	data, err := ioutil.ReadFile("../internal/testprotos/desc_test_editions.protoset")
+	testutil.Ok(t, err)
+	var fds descriptorpb.FileDescriptorSet
+	err = protov2.Unmarshal(data, &fds)
+	testutil.Ok(t, err)
+	fd, err := desc.CreateFileDescriptorFromSet(&fds)
+	testutil.Ok(t, err)
+	return fd.FindMessage("testprotos.editions.Foo")
+}
@@ -117,6 +117,25 @@
 // messages can safely be used with the jsonpb package for JSON serialization
 // and de-serialization.
 //
+// The JSONMarshaler, JSONUnmarshaler, TextMarshaler, and TextUnmarshaler types
+// can be configured with AnyOptions to control how google.protobuf.Any messages
+// are formatted: when the embedded type can be resolved, its fields are written
+// inline (including nested Any messages, up to a maximum depth). Otherwise, the
+// raw type URL and bytes are written, so that the message still round-trips.
+//
+// Dynamic messages can also be serialized to and from YAML, using the same
+// mapping as the proto3 JSON format. Fields are written in the order in which
+// they are declared in the message descriptor, and errors encountered when
+// reading YAML indicate the line and column of the problem.
+//
+// A GoValueMapper converts dynamic messages to and from plain Go values, like
+// map[string]interface{}, following the same mapping, and to and from Go
+// structs whose fields correspond to the message's fields.
+//
+// A Migration converts a dynamic message into a message of a different type,
+// such as a newer version of the same schema, using declarative rules for
+// renamed, moved, and re-typed fields, and reports any data that was dropped.
+//
 // In addition to implementing the proto.Message interface and numerous related
 // methods, it also provides inter-op with generated messages via conversion.
 // The ConvertTo, ConvertFrom, MergeInto, and MergeFrom methods copy message
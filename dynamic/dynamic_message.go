@@ -711,9 +711,10 @@ func (m *Message) internalSetField(fd *desc.FieldDescriptor, val interface{}) {
 			}
 			return
 		}
-	} else if m.md.IsProto3() && fd.GetOneOf() == nil {
-		// proto3 considers fields that are set to their zero value as unset
-		// (we already handled repeated fields above)
+	} else if fd.GetOneOf() == nil && (m.md.IsProto3() || !fd.HasPresence()) {
+		// proto3 (and editions, with implicit field presence) considers fields
+		// that are set to their zero value as unset (we already handled
+		// repeated fields above)
 		var equal bool
 		if b, ok := val.([]byte); ok {
 			// can't compare slices, so we have to special-case []byte values
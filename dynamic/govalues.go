@@ -0,0 +1,1191 @@
+package dynamic
+
+// Conversion of dynamic messages to/from plain Go values and structs
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/golang/protobuf/jsonpb"
+	"github.com/golang/protobuf/proto"
+	"google.golang.org/protobuf/types/descriptorpb"
+
+	"github.com/jhump/protoreflect/desc"
+)
+
+// ToMap converts this message into a map of plain Go values, using the
+// default options of a GoValueMapper.
+func (m *Message) ToMap() (map[string]interface{}, error) {
+	return (&GoValueMapper{}).ToMap(m)
+}
+
+// FromMap resets this message and then populates it from the given map of
+// plain Go values, using the default (strict) options of a GoValueMapper.
+func (m *Message) FromMap(vals map[string]interface{}) error {
+	return (&GoValueMapper{}).FromMap(vals, m)
+}
+
+// ToStruct populates the given Go struct, which must be supplied as a non-nil
+// pointer, from this message, using the default (strict) options of a
+// GoValueMapper.
+func (m *Message) ToStruct(dest interface{}) error {
+	return (&GoValueMapper{}).ToStruct(m, dest)
+}
+
+// FromStruct resets this message and then populates it from the given Go
+// struct (or pointer to a struct), using the default (strict) options of a
+// GoValueMapper.
+func (m *Message) FromStruct(src interface{}) error {
+	return (&GoValueMapper{}).FromStruct(src, m)
+}
+
+// GoValueMapper converts dynamic messages to and from plain Go values (maps,
+// slices, and scalars, such as those used by template engines and expression
+// evaluators) and to and from Go structs.
+//
+// Plain Go values follow the proto3 JSON mapping. A message is represented as a
+// map[string]interface{}, keyed by field JSON names (or original names if
+// OrigName is set). Extensions are keyed by their fully-qualified name in
+// brackets. Repeated fields are []interface{}, and map fields are
+// map[string]interface{} whose keys are the string forms of the map field's
+// keys. Scalar values use the same Go types as Message.GetField, except that
+// enum values are represented by name unless EnumsAsInts is set. Wrapper types
+// are represented by their wrapped value, and other well-known types use their
+// JSON representation, decoded as if by encoding/json (so a
+// google.protobuf.Timestamp is an RFC 3339 string, for example).
+//
+// Go structs are mapped to messages by matching each exported field of the
+// struct to a field of the message. A Go field's "proto" struct tag names the
+// proto field, using either its name or its JSON name. Anything in the tag
+// after a comma is ignored, so the tags used by builder.GoTypeMapper work, too.
+// A tag of "-" means the Go field is ignored. If a Go field has no tag (or the
+// tag's name is empty), its name is matched, ignoring case (and underscores in
+// proto field names), against the names and JSON names of the message's
+// fields. Fields of embedded structs are treated as if they were fields of the
+// outer struct. Message fields may be mapped to nested structs, to maps, or to generated
+// message types, and google.protobuf.Timestamp and google.protobuf.Duration
+// fields may be mapped to time.Time and time.Duration, respectively. A Go
+// field of type interface{} receives the plain Go value for the field.
+//
+// By default, conversion is strict: values must have a Go type that can
+// represent the proto field's value without loss, and all keys and struct
+// fields must correspond to proto fields. In lenient mode, unknown keys and
+// struct fields are ignored, and values are converted between kinds when no
+// information is lost: strings may be parsed as numbers or booleans, floating
+// point values with integral values may be used for integer fields, numbers
+// and booleans may be formatted for string fields, and bytes fields may be
+// supplied as base64-encoded strings.
+//
+// Conversion errors are of type *GoValueError, which indicates the path to the
+// value that could not be converted.
+type GoValueMapper struct {
+	// If true, map keys use the fields' original names instead of their JSON
+	// names.
+	OrigName bool
+	// If true, enum values are represented as int32 values instead of names.
+	EnumsAsInts bool
+	// If true, fields that are not set are included in maps, with their
+	// default values.
+	EmitDefaults bool
+	// If true, conversions are lenient, as described above.
+	Lenient bool
+}
+
+// GoValueError is the type of error returned by a GoValueMapper when a value
+// cannot be converted.
+type GoValueError struct {
+	// The path to the value, relative to the message being converted. Message
+	// fields are separated by dots, and elements of repeated and map fields are
+	// indicated with brackets, like `foo.bar[3].baz["abc"]`.
+	Path string
+	// The proto field being converted, or nil if the value does not correspond
+	// to a known field.
+	Field *desc.FieldDescriptor
+	// The Go type of the value being converted. When converting from a message,
+	// this is the type of the destination. Otherwise, it is the type of the
+	// source value.
+	GoType reflect.Type
+	// The underlying cause.
+	Err error
+}
+
+// Error implements the error interface.
+func (e *GoValueError) Error() string {
+	if e.Path == "" {
+		return e.Err.Error()
+	}
+	return fmt.Sprintf("%s: %v", e.Path, e.Err)
+}
+
+// Unwrap returns the underlying cause of the error.
+func (e *GoValueError) Unwrap() error {
+	return e.Err
+}
+
+func goValueError(path string, fd *desc.FieldDescriptor, t reflect.Type, err error) error {
+	var gve *GoValueError
+	if errors.As(err, &gve) {
+		return err
+	}
+	return &GoValueError{Path: path, Field: fd, GoType: t, Err: err}
+}
+
+func goFieldPath(path, name string) string {
+	if path == "" {
+		return name
+	}
+	return path + "." + name
+}
+
+func goIndexPath(path string, i int) string {
+	return fmt.Sprintf("%s[%d]", path, i)
+}
+
+func goKeyPath(path string, k interface{}) string {
+	if s, ok := k.(string); ok {
+		return fmt.Sprintf("%s[%q]", path, s)
+	}
+	return fmt.Sprintf("%s[%v]", path, k)
+}
+
+var (
+	typeOfTime      = reflect.TypeOf(time.Time{})
+	typeOfDuration  = reflect.TypeOf(time.Duration(0))
+	typeOfInterface = reflect.TypeOf((*interface{})(nil)).Elem()
+)
+
+func isWrapperType(md *desc.MessageDescriptor) bool {
+	switch md.GetFullyQualifiedName() {
+	case "google.protobuf.DoubleValue", "google.protobuf.FloatValue",
+		"google.protobuf.Int64Value", "google.protobuf.UInt64Value",
+		"google.protobuf.Int32Value", "google.protobuf.UInt32Value",
+		"google.protobuf.BoolValue", "google.protobuf.StringValue",
+		"google.protobuf.BytesValue":
+		return true
+	}
+	return false
+}
+
+// asDynamicMessage returns the given message, which must be of the given
+// type, as a dynamic message.
+func (m *Message) asDynamicMessage(md *desc.MessageDescriptor, v interface{}) (*Message, error) {
+	if dm, ok := v.(*Message); ok {
+		return dm, nil
+	}
+	dm := m.mf.NewDynamicMessage(md)
+	if err := dm.MergeFrom(v.(proto.Message)); err != nil {
+		return nil, err
+	}
+	return dm, nil
+}
+
+// ToMap converts the given message into a map of plain Go values.
+func (gm *GoValueMapper) ToMap(m *Message) (map[string]interface{}, error) {
+	return gm.toMap(m, "")
+}
+
+func (gm *GoValueMapper) toMap(m *Message, path string) (map[string]interface{}, error) {
+	var tags []int
+	if gm.EmitDefaults {
+		tags = m.allKnownFieldTags()
+	} else {
+		tags = m.knownFieldTags()
+	}
+	result := make(map[string]interface{}, len(tags))
+	for _, tag := range tags {
+		fd := m.FindFieldDescriptor(int32(tag))
+		v, ok := m.values[int32(tag)]
+		if !ok {
+			if fd.GetOneOf() != nil {
+				continue
+			}
+			v = fd.GetDefaultValue()
+		}
+		name := gm.keyName(fd)
+		gv, err := gm.fieldToGo(m, fd, v, goFieldPath(path, name))
+		if err != nil {
+			return nil, err
+		}
+		result[name] = gv
+	}
+	return result, nil
+}
+
+func (gm *GoValueMapper) keyName(fd *desc.FieldDescriptor) string {
+	switch {
+	case fd.IsExtension():
+		return "[" + fd.GetFullyQualifiedName() + "]"
+	case gm.OrigName:
+		return fd.GetName()
+	default:
+		return fd.GetJSONName()
+	}
+}
+
+// fieldToGo converts the given value of the given field into a plain Go value.
+func (gm *GoValueMapper) fieldToGo(m *Message, fd *desc.FieldDescriptor, v interface{}, path string) (interface{}, error) {
+	switch {
+	case fd.IsMap():
+		entries, _ := v.(map[interface{}]interface{})
+		result := make(map[string]interface{}, len(entries))
+		for k, val := range entries {
+			gv, err := gm.elementToGo(m, fd.GetMapValueType(), val, goKeyPath(path, k))
+			if err != nil {
+				return nil, err
+			}
+			result[fmt.Sprint(k)] = gv
+		}
+		return result, nil
+	case fd.IsRepeated():
+		items, _ := v.([]interface{})
+		result := make([]interface{}, len(items))
+		for i, item := range items {
+			gv, err := gm.elementToGo(m, fd, item, goIndexPath(path, i))
+			if err != nil {
+				return nil, err
+			}
+			result[i] = gv
+		}
+		return result, nil
+	default:
+		return gm.elementToGo(m, fd, v, path)
+	}
+}
+
+func (gm *GoValueMapper) elementToGo(m *Message, fd *desc.FieldDescriptor, v interface{}, path string) (interface{}, error) {
+	switch fd.GetType() {
+	case descriptorpb.FieldDescriptorProto_TYPE_ENUM:
+		num := v.(int32)
+		if !gm.EnumsAsInts {
+			if ev := fd.GetEnumType().FindValueByNumber(num); ev != nil {
+				return ev.GetName(), nil
+			}
+		}
+		return num, nil
+	case descriptorpb.FieldDescriptorProto_TYPE_BYTES:
+		return append([]byte(nil), v.([]byte)...), nil
+	case descriptorpb.FieldDescriptorProto_TYPE_MESSAGE,
+		descriptorpb.FieldDescriptorProto_TYPE_GROUP:
+		if v == nil || reflect.ValueOf(v).IsNil() {
+			return nil, nil
+		}
+		md := fd.GetMessageType()
+		dm, err := m.asDynamicMessage(md, v)
+		if err != nil {
+			return nil, goValueError(path, fd, nil, err)
+		}
+		if isWrapperType(md) {
+			return gm.elementToGo(dm, md.FindFieldByNumber(1), dm.GetFieldByNumber(1), path)
+		}
+		if _, ok := wellKnownTypeNames[md.GetFullyQualifiedName()]; ok {
+			js, err := dm.MarshalJSONPB(&jsonpb.Marshaler{OrigName: gm.OrigName, EnumsAsInts: gm.EnumsAsInts})
+			if err != nil {
+				return nil, goValueError(path, fd, nil, err)
+			}
+			var gv interface{}
+			if err := json.Unmarshal(js, &gv); err != nil {
+				return nil, goValueError(path, fd, nil, err)
+			}
+			return gv, nil
+		}
+		return gm.toMap(dm, path)
+	default:
+		return v, nil
+	}
+}
+
+// FromMap resets the given message and then populates it from the given map of
+// plain Go values.
+func (gm *GoValueMapper) FromMap(vals map[string]interface{}, m *Message) error {
+	m.Reset()
+	if err := gm.MergeFromMap(vals, m); err != nil {
+		return err
+	}
+	return m.Validate()
+}
+
+// MergeFromMap populates the given message from the given map of plain Go
+// values, merging them into any existing data in the message.
+func (gm *GoValueMapper) MergeFromMap(vals map[string]interface{}, m *Message) error {
+	return gm.mergeFromMap(reflect.ValueOf(vals), m, "")
+}
+
+func (gm *GoValueMapper) mergeFromMap(rv reflect.Value, m *Message, path string) error {
+	if rv.Type().Key().Kind() != reflect.String {
+		return goValueError(path, nil, rv.Type(), fmt.Errorf("map for message %s must have string keys", m.md.GetFullyQualifiedName()))
+	}
+	// sort keys so that errors are deterministic
+	keys := rv.MapKeys()
+	sort.Slice(keys, func(i, j int) bool {
+		return keys[i].String() < keys[j].String()
+	})
+	for _, k := range keys {
+		name := k.String()
+		fd := m.FindFieldDescriptorByJSONName(name)
+		if fd == nil {
+			if gm.Lenient {
+				continue
+			}
+			return goValueError(goFieldPath(path, name), nil, nil, fmt.Errorf("message type %s has no known field named %s", m.md.GetFullyQualifiedName(), name))
+		}
+		if err := gm.setFieldFromGo(m, fd, rv.MapIndex(k), goFieldPath(path, name)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// setFieldFromGo sets the given field of the given message from the given Go
+// value. Repeated and map values are merged into any existing values.
+func (gm *GoValueMapper) setFieldFromGo(m *Message, fd *desc.FieldDescriptor, rv reflect.Value, path string) error {
+	rv = goElem(rv)
+	if !rv.IsValid() {
+		// nil means absent, except for google.protobuf.Value
+		if fd.IsRepeated() || fd.GetMessageType() == nil || fd.GetMessageType().GetFullyQualifiedName() != "google.protobuf.Value" {
+			return nil
+		}
+	}
+	switch {
+	case fd.IsMap():
+		if rv.Kind() != reflect.Map {
+			return goValueError(path, fd, rv.Type(), fmt.Errorf("map field %s requires a map", fd.GetFullyQualifiedName()))
+		}
+		keys := rv.MapKeys()
+		sort.Slice(keys, func(i, j int) bool {
+			return fmt.Sprint(keys[i].Interface()) < fmt.Sprint(keys[j].Interface())
+		})
+		for _, k := range keys {
+			kpath := goKeyPath(path, k.Interface())
+			key, err := gm.elementFromGo(m, fd.GetMapKeyType(), goElem(k), kpath)
+			if err != nil {
+				return err
+			}
+			val, err := gm.elementFromGo(m, fd.GetMapValueType(), goElem(rv.MapIndex(k)), kpath)
+			if err != nil {
+				return err
+			}
+			if err := m.TryPutMapField(fd, key, val); err != nil {
+				return goValueError(kpath, fd, rv.Type(), err)
+			}
+		}
+		return nil
+	case fd.IsRepeated():
+		if (rv.Kind() != reflect.Slice && rv.Kind() != reflect.Array) || rv.Type() == typeOfBytes {
+			return goValueError(path, fd, rv.Type(), fmt.Errorf("repeated field %s requires a slice", fd.GetFullyQualifiedName()))
+		}
+		for i := 0; i < rv.Len(); i++ {
+			ipath := goIndexPath(path, i)
+			val, err := gm.elementFromGo(m, fd, goElem(rv.Index(i)), ipath)
+			if err != nil {
+				return err
+			}
+			if err := m.TryAddRepeatedField(fd, val); err != nil {
+				return goValueError(ipath, fd, rv.Type(), err)
+			}
+		}
+		return nil
+	default:
+		val, err := gm.elementFromGo(m, fd, rv, path)
+		if err != nil {
+			return err
+		}
+		if err := mergeField(m, fd, val); err != nil {
+			return goValueError(path, fd, rv.Type(), err)
+		}
+		return nil
+	}
+}
+
+// goElem unwraps interfaces and pointers. It returns an invalid value if the
+// given value is nil.
+func goElem(rv reflect.Value) reflect.Value {
+	for rv.IsValid() && (rv.Kind() == reflect.Interface || rv.Kind() == reflect.Ptr) {
+		if rv.IsNil() {
+			return reflect.Value{}
+		}
+		if rv.Kind() == reflect.Ptr && rv.Type().Implements(typeOfProtoMessage) {
+			return rv
+		}
+		rv = rv.Elem()
+	}
+	return rv
+}
+
+// elementFromGo converts the given Go value into a value for the given field,
+// which is a single element for repeated fields.
+func (gm *GoValueMapper) elementFromGo(m *Message, fd *desc.FieldDescriptor, rv reflect.Value, path string) (interface{}, error) {
+	var t reflect.Type
+	if rv.IsValid() {
+		t = rv.Type()
+	}
+	fail := func(format string, args ...interface{}) (interface{}, error) {
+		return nil, goValueError(path, fd, t, fmt.Errorf(format, args...))
+	}
+	if !rv.IsValid() && fd.GetMessageType() == nil {
+		return fail("field %s cannot be nil", fd.GetFullyQualifiedName())
+	}
+
+	switch fd.GetType() {
+	case descriptorpb.FieldDescriptorProto_TYPE_INT32,
+		descriptorpb.FieldDescriptorProto_TYPE_SINT32,
+		descriptorpb.FieldDescriptorProto_TYPE_SFIXED32:
+		i, err := gm.intFromGo(rv, 32)
+		if err != nil {
+			return fail("%v", err)
+		}
+		return int32(i), nil
+	case descriptorpb.FieldDescriptorProto_TYPE_INT64,
+		descriptorpb.FieldDescriptorProto_TYPE_SINT64,
+		descriptorpb.FieldDescriptorProto_TYPE_SFIXED64:
+		i, err := gm.intFromGo(rv, 64)
+		if err != nil {
+			return fail("%v", err)
+		}
+		return i, nil
+	case descriptorpb.FieldDescriptorProto_TYPE_UINT32,
+		descriptorpb.FieldDescriptorProto_TYPE_FIXED32:
+		u, err := gm.uintFromGo(rv, 32)
+		if err != nil {
+			return fail("%v", err)
+		}
+		return uint32(u), nil
+	case descriptorpb.FieldDescriptorProto_TYPE_UINT64,
+		descriptorpb.FieldDescriptorProto_TYPE_FIXED64:
+		u, err := gm.uintFromGo(rv, 64)
+		if err != nil {
+			return fail("%v", err)
+		}
+		return u, nil
+	case descriptorpb.FieldDescriptorProto_TYPE_FLOAT:
+		f, err := gm.floatFromGo(rv, 32)
+		if err != nil {
+			return fail("%v", err)
+		}
+		return float32(f), nil
+	case descriptorpb.FieldDescriptorProto_TYPE_DOUBLE:
+		f, err := gm.floatFromGo(rv, 64)
+		if err != nil {
+			return fail("%v", err)
+		}
+		return f, nil
+	case descriptorpb.FieldDescriptorProto_TYPE_BOOL:
+		if rv.Kind() == reflect.Bool {
+			return rv.Bool(), nil
+		}
+		if gm.Lenient && rv.Kind() == reflect.String {
+			if b, err := strconv.ParseBool(rv.String()); err == nil {
+				return b, nil
+			}
+			return fail("invalid bool value %q", rv.String())
+		}
+		return fail("expecting a bool, got %v", t)
+	case descriptorpb.FieldDescriptorProto_TYPE_STRING:
+		if rv.Kind() == reflect.String {
+			return rv.String(), nil
+		}
+		if gm.Lenient {
+			switch rv.Kind() {
+			case reflect.Bool, reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+				reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64,
+				reflect.Float32, reflect.Float64:
+				return fmt.Sprint(rv.Interface()), nil
+			}
+		}
+		return fail("expecting a string, got %v", t)
+	case descriptorpb.FieldDescriptorProto_TYPE_BYTES:
+		if rv.Kind() == reflect.Slice && rv.Type().Elem().Kind() == reflect.Uint8 {
+			return append([]byte(nil), rv.Bytes()...), nil
+		}
+		if gm.Lenient && rv.Kind() == reflect.String {
+			if b, err := decodeBase64(rv.String()); err == nil {
+				return b, nil
+			}
+			return fail("invalid base64 value %q", rv.String())
+		}
+		return fail("expecting []byte, got %v", t)
+	case descriptorpb.FieldDescriptorProto_TYPE_ENUM:
+		if rv.Kind() == reflect.String && t != typeOfJSONNumber {
+			name := rv.String()
+			if ev := fd.GetEnumType().FindValueByName(name); ev != nil {
+				return ev.GetNumber(), nil
+			}
+			if !gm.Lenient {
+				return fail("enum %s has no value named %s", fd.GetEnumType().GetFullyQualifiedName(), name)
+			}
+		}
+		i, err := gm.intFromGo(rv, 32)
+		if err != nil {
+			return fail("%v", err)
+		}
+		return int32(i), nil
+	case descriptorpb.FieldDescriptorProto_TYPE_MESSAGE,
+		descriptorpb.FieldDescriptorProto_TYPE_GROUP:
+		return gm.messageFromGo(m, fd, rv, path)
+	default:
+		return fail("unable to handle unrecognized field type: %v", fd.GetType())
+	}
+}
+
+var typeOfJSONNumber = reflect.TypeOf(json.Number(""))
+
+func decodeBase64(s string) ([]byte, error) {
+	for _, enc := range []*base64.Encoding{base64.StdEncoding, base64.URLEncoding, base64.RawStdEncoding, base64.RawURLEncoding} {
+		if b, err := enc.DecodeString(s); err == nil {
+			return b, nil
+		}
+	}
+	return nil, errors.New("invalid base64 value")
+}
+
+func (gm *GoValueMapper) intFromGo(rv reflect.Value, bits int) (int64, error) {
+	switch rv.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		i := rv.Int()
+		if bits < 64 && (i < math.MinInt32 || i > math.MaxInt32) {
+			return 0, fmt.Errorf("value %d overflows int%d", i, bits)
+		}
+		return i, nil
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		u := rv.Uint()
+		if (bits < 64 && u > math.MaxInt32) || u > math.MaxInt64 {
+			return 0, fmt.Errorf("value %d overflows int%d", u, bits)
+		}
+		return int64(u), nil
+	case reflect.Float32, reflect.Float64:
+		if gm.Lenient {
+			f := rv.Float()
+			if f != math.Trunc(f) {
+				return 0, fmt.Errorf("value %v is not an integer", f)
+			}
+			if limit := math.Ldexp(1, bits-1); f < -limit || f >= limit {
+				return 0, fmt.Errorf("value %v overflows int%d", f, bits)
+			}
+			return int64(f), nil
+		}
+	case reflect.String:
+		if gm.Lenient || rv.Type() == typeOfJSONNumber {
+			i, err := strconv.ParseInt(rv.String(), 10, bits)
+			if err != nil {
+				if f, ferr := strconv.ParseFloat(rv.String(), 64); ferr == nil && gm.Lenient {
+					return gm.intFromGo(reflect.ValueOf(f), bits)
+				}
+				return 0, fmt.Errorf("invalid int%d value %q: %v", bits, rv.String(), err.(*strconv.NumError).Err)
+			}
+			return i, nil
+		}
+	}
+	return 0, fmt.Errorf("expecting an integer, got %v", goTypeOf(rv))
+}
+
+func (gm *GoValueMapper) uintFromGo(rv reflect.Value, bits int) (uint64, error) {
+	switch rv.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		i := rv.Int()
+		if i < 0 {
+			return 0, fmt.Errorf("value %d overflows uint%d", i, bits)
+		}
+		if bits < 64 && i > math.MaxUint32 {
+			return 0, fmt.Errorf("value %d overflows uint%d", i, bits)
+		}
+		return uint64(i), nil
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		u := rv.Uint()
+		if bits < 64 && u > math.MaxUint32 {
+			return 0, fmt.Errorf("value %d overflows uint%d", u, bits)
+		}
+		return u, nil
+	case reflect.Float32, reflect.Float64:
+		if gm.Lenient {
+			f := rv.Float()
+			if f != math.Trunc(f) {
+				return 0, fmt.Errorf("value %v is not an integer", f)
+			}
+			if f < 0 || f >= math.Ldexp(1, bits) {
+				return 0, fmt.Errorf("value %v overflows uint%d", f, bits)
+			}
+			return uint64(f), nil
+		}
+	case reflect.String:
+		if gm.Lenient || rv.Type() == typeOfJSONNumber {
+			u, err := strconv.ParseUint(rv.String(), 10, bits)
+			if err != nil {
+				if f, ferr := strconv.ParseFloat(rv.String(), 64); ferr == nil && gm.Lenient {
+					return gm.uintFromGo(reflect.ValueOf(f), bits)
+				}
+				return 0, fmt.Errorf("invalid uint%d value %q: %v", bits, rv.String(), err.(*strconv.NumError).Err)
+			}
+			return u, nil
+		}
+	}
+	return 0, fmt.Errorf("expecting an unsigned integer, got %v", goTypeOf(rv))
+}
+
+func (gm *GoValueMapper) floatFromGo(rv reflect.Value, bits int) (float64, error) {
+	var f float64
+	switch rv.Kind() {
+	case reflect.Float32, reflect.Float64:
+		f = rv.Float()
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		f = float64(rv.Int())
+		if int64(f) != rv.Int() && !gm.Lenient {
+			return 0, fmt.Errorf("value %d cannot be represented exactly as float%d", rv.Int(), bits)
+		}
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		f = float64(rv.Uint())
+		if uint64(f) != rv.Uint() && !gm.Lenient {
+			return 0, fmt.Errorf("value %d cannot be represented exactly as float%d", rv.Uint(), bits)
+		}
+	case reflect.String:
+		if !gm.Lenient && rv.Type() != typeOfJSONNumber {
+			return 0, fmt.Errorf("expecting a number, got %v", rv.Type())
+		}
+		s := rv.String()
+		switch s {
+		case "Infinity":
+			s = "inf"
+		case "-Infinity":
+			s = "-inf"
+		}
+		var err error
+		if f, err = strconv.ParseFloat(s, 64); err != nil {
+			return 0, fmt.Errorf("invalid float%d value %q: %v", bits, rv.String(), err.(*strconv.NumError).Err)
+		}
+	default:
+		return 0, fmt.Errorf("expecting a number, got %v", goTypeOf(rv))
+	}
+	if bits == 32 && !math.IsInf(f, 0) && !math.IsNaN(f) && math.Abs(f) > math.MaxFloat32 {
+		return 0, fmt.Errorf("value %v overflows float32", f)
+	}
+	return f, nil
+}
+
+func goTypeOf(rv reflect.Value) interface{} {
+	if !rv.IsValid() {
+		return "nil"
+	}
+	return rv.Type()
+}
+
+func (gm *GoValueMapper) messageFromGo(m *Message, fd *desc.FieldDescriptor, rv reflect.Value, path string) (interface{}, error) {
+	md := fd.GetMessageType()
+	fqn := md.GetFullyQualifiedName()
+	dm := m.mf.NewDynamicMessage(md)
+	var t reflect.Type
+	if rv.IsValid() {
+		t = rv.Type()
+	}
+
+	if rv.IsValid() && rv.Type().Implements(typeOfProtoMessage) {
+		pm := rv.Interface().(proto.Message)
+		var name string
+		if other, ok := pm.(*Message); ok {
+			name = other.GetMessageDescriptor().GetFullyQualifiedName()
+		} else {
+			name = proto.MessageName(pm)
+		}
+		if name != fqn {
+			return nil, goValueError(path, fd, t, fmt.Errorf("message field %s requires value of type %s; received %s", fd.GetFullyQualifiedName(), fqn, name))
+		}
+		if err := dm.MergeFrom(pm); err != nil {
+			return nil, goValueError(path, fd, t, err)
+		}
+		return dm, nil
+	}
+
+	switch {
+	case fqn == "google.protobuf.Timestamp" && t == typeOfTime:
+		tm := rv.Interface().(time.Time)
+		dm.SetFieldByNumber(1, tm.Unix())
+		dm.SetFieldByNumber(2, int32(tm.Nanosecond()))
+		return dm, nil
+	case fqn == "google.protobuf.Duration" && t == typeOfDuration:
+		d := rv.Interface().(time.Duration)
+		dm.SetFieldByNumber(1, int64(d/time.Second))
+		dm.SetFieldByNumber(2, int32(d%time.Second))
+		return dm, nil
+	case isWrapperType(md) && rv.Kind() != reflect.Map && rv.Kind() != reflect.Struct:
+		vfd := md.FindFieldByNumber(1)
+		val, err := gm.elementFromGo(dm, vfd, rv, path)
+		if err != nil {
+			return nil, err
+		}
+		dm.SetField(vfd, val)
+		return dm, nil
+	}
+
+	if _, ok := wellKnownTypeNames[fqn]; ok && rv.Kind() != reflect.Struct {
+		var js []byte
+		if rv.IsValid() {
+			var err error
+			if js, err = json.Marshal(rv.Interface()); err != nil {
+				return nil, goValueError(path, fd, t, err)
+			}
+		} else {
+			js = []byte("null")
+		}
+		u := jsonpb.Unmarshaler{AllowUnknownFields: gm.Lenient}
+		if err := dm.UnmarshalJSONPB(&u, js); err != nil {
+			return nil, goValueError(path, fd, t, err)
+		}
+		return dm, nil
+	}
+
+	switch rv.Kind() {
+	case reflect.Map:
+		if err := gm.mergeFromMap(rv, dm, path); err != nil {
+			return nil, err
+		}
+	case reflect.Struct:
+		if err := gm.mergeFromStruct(rv, dm, path); err != nil {
+			return nil, err
+		}
+	default:
+		return nil, goValueError(path, fd, t, fmt.Errorf("message field %s requires a map, struct, or message, got %v", fd.GetFullyQualifiedName(), t))
+	}
+	return dm, nil
+}
+
+// goStructField is a field of a Go struct that corresponds to a proto field.
+type goStructField struct {
+	index []int
+	sf    reflect.StructField
+	fd    *desc.FieldDescriptor
+}
+
+// goStructFields returns the fields of the given struct type that correspond
+// to fields of the given message. An error is returned if a struct tag names a
+// field that does not exist, if two struct fields correspond to the same proto
+// field, or, in strict mode, if an untagged struct field does not correspond to
+// any proto field.
+func (gm *GoValueMapper) goStructFields(t reflect.Type, m *Message, path string) ([]goStructField, error) {
+	var fields []goStructField
+	seen := map[*desc.FieldDescriptor]string{}
+	for _, sf := range reflect.VisibleFields(t) {
+		if !sf.IsExported() {
+			continue
+		}
+		tag, hasTag := sf.Tag.Lookup("proto")
+		if tag == "-" {
+			continue
+		}
+		if sf.Anonymous && !hasTag {
+			ft := sf.Type
+			if ft.Kind() == reflect.Ptr {
+				ft = ft.Elem()
+			}
+			if ft.Kind() == reflect.Struct {
+				// fields of embedded structs are promoted
+				continue
+			}
+		}
+		// the tag may include other options, such as a field number, after
+		// the name
+		tagName := strings.Split(tag, ",")[0]
+		var fd *desc.FieldDescriptor
+		if tagName != "" {
+			fd = m.FindFieldDescriptorByJSONName(tagName)
+			if fd == nil {
+				return nil, goValueError(goFieldPath(path, sf.Name), nil, t, fmt.Errorf("struct tag names unknown field %s of message type %s", tagName, m.md.GetFullyQualifiedName()))
+			}
+		} else {
+			for _, f := range m.md.GetFields() {
+				if strings.EqualFold(f.GetName(), sf.Name) || strings.EqualFold(f.GetJSONName(), sf.Name) {
+					fd = f
+					break
+				}
+			}
+			if fd == nil {
+				// also try ignoring underscores in the field name
+				for _, f := range m.md.GetFields() {
+					if strings.EqualFold(strings.ReplaceAll(f.GetName(), "_", ""), sf.Name) {
+						fd = f
+						break
+					}
+				}
+			}
+			if fd == nil {
+				if gm.Lenient {
+					continue
+				}
+				return nil, goValueError(goFieldPath(path, sf.Name), nil, t, fmt.Errorf("struct field %s does not correspond to any field of message type %s", sf.Name, m.md.GetFullyQualifiedName()))
+			}
+		}
+		if other, ok := seen[fd]; ok {
+			return nil, goValueError(goFieldPath(path, sf.Name), fd, t, fmt.Errorf("struct fields %s and %s both correspond to field %s", other, sf.Name, fd.GetFullyQualifiedName()))
+		}
+		seen[fd] = sf.Name
+		fields = append(fields, goStructField{index: sf.Index, sf: sf, fd: fd})
+	}
+	return fields, nil
+}
+
+// FromStruct resets the given message and then populates it from the given Go
+// struct or pointer to a struct.
+func (gm *GoValueMapper) FromStruct(src interface{}, m *Message) error {
+	m.Reset()
+	if err := gm.MergeFromStruct(src, m); err != nil {
+		return err
+	}
+	return m.Validate()
+}
+
+// MergeFromStruct populates the given message from the given Go struct or
+// pointer to a struct, merging values into any existing data in the message.
+func (gm *GoValueMapper) MergeFromStruct(src interface{}, m *Message) error {
+	rv := reflect.ValueOf(src)
+	for rv.Kind() == reflect.Ptr && !rv.IsNil() {
+		rv = rv.Elem()
+	}
+	if rv.Kind() != reflect.Struct {
+		return goValueError("", nil, reflect.TypeOf(src), fmt.Errorf("expecting a struct or a non-nil pointer to a struct, got %T", src))
+	}
+	return gm.mergeFromStruct(rv, m, "")
+}
+
+func (gm *GoValueMapper) mergeFromStruct(rv reflect.Value, m *Message, path string) error {
+	fields, err := gm.goStructFields(rv.Type(), m, path)
+	if err != nil {
+		return err
+	}
+	for _, f := range fields {
+		fv, ok := goFieldByIndex(rv, f.index)
+		if !ok {
+			// field is in a nil embedded struct
+			continue
+		}
+		if err := gm.setFieldFromGo(m, f.fd, fv, goFieldPath(path, f.sf.Name)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// goFieldByIndex is like reflect.Value.FieldByIndex except that, instead of
+// panicking, it returns false if the field is in a nil embedded struct.
+func goFieldByIndex(rv reflect.Value, index []int) (reflect.Value, bool) {
+	for i, x := range index {
+		if i > 0 && rv.Kind() == reflect.Ptr {
+			if rv.IsNil() {
+				return reflect.Value{}, false
+			}
+			rv = rv.Elem()
+		}
+		rv = rv.Field(x)
+	}
+	return rv, true
+}
+
+// goFieldByIndexAlloc is like reflect.Value.FieldByIndex except that it
+// allocates any nil embedded structs.
+func goFieldByIndexAlloc(rv reflect.Value, index []int) reflect.Value {
+	for i, x := range index {
+		if i > 0 && rv.Kind() == reflect.Ptr {
+			if rv.IsNil() {
+				rv.Set(reflect.New(rv.Type().Elem()))
+			}
+			rv = rv.Elem()
+		}
+		rv = rv.Field(x)
+	}
+	return rv
+}
+
+// ToStruct populates the given Go struct, which must be supplied as a non-nil
+// pointer, from the given message. Go fields that correspond to proto fields
+// that are not set are left unchanged.
+func (gm *GoValueMapper) ToStruct(m *Message, dest interface{}) error {
+	rv := reflect.ValueOf(dest)
+	if rv.Kind() != reflect.Ptr || rv.IsNil() || rv.Elem().Kind() != reflect.Struct {
+		return goValueError("", nil, reflect.TypeOf(dest), fmt.Errorf("expecting a non-nil pointer to a struct, got %T", dest))
+	}
+	return gm.toStruct(m, rv.Elem(), "")
+}
+
+func (gm *GoValueMapper) toStruct(m *Message, rv reflect.Value, path string) error {
+	fields, err := gm.goStructFields(rv.Type(), m, path)
+	if err != nil {
+		return err
+	}
+	if !gm.Lenient {
+		// make sure no data is lost
+		mapped := make(map[int32]struct{}, len(fields))
+		for _, f := range fields {
+			mapped[f.fd.GetNumber()] = struct{}{}
+		}
+		for _, tag := range m.knownFieldTags() {
+			if _, ok := mapped[int32(tag)]; !ok {
+				fd := m.FindFieldDescriptor(int32(tag))
+				return goValueError(goFieldPath(path, gm.keyName(fd)), fd, rv.Type(), fmt.Errorf("struct type %v has no field for %s", rv.Type(), fd.GetFullyQualifiedName()))
+			}
+		}
+	}
+	for _, f := range fields {
+		v, ok := m.values[f.fd.GetNumber()]
+		if !ok {
+			continue
+		}
+		fpath := goFieldPath(path, f.sf.Name)
+		fv := goFieldByIndexAlloc(rv, f.index)
+		if err := gm.fieldToGoType(m, f.fd, v, fv, fpath); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// fieldToGoType stores the given value of the given field into dest.
+func (gm *GoValueMapper) fieldToGoType(m *Message, fd *desc.FieldDescriptor, v interface{}, dest reflect.Value, path string) error {
+	if dest.Type() == typeOfInterface {
+		gv, err := gm.fieldToGo(m, fd, v, path)
+		if err != nil {
+			return err
+		}
+		if gv != nil {
+			dest.Set(reflect.ValueOf(gv))
+		}
+		return nil
+	}
+	switch {
+	case fd.IsMap():
+		if dest.Kind() != reflect.Map {
+			return goValueError(path, fd, dest.Type(), fmt.Errorf("map field %s cannot be stored in %v", fd.GetFullyQualifiedName(), dest.Type()))
+		}
+		entries := v.(map[interface{}]interface{})
+		if dest.IsNil() {
+			dest.Set(reflect.MakeMapWithSize(dest.Type(), len(entries)))
+		}
+		for k, val := range entries {
+			kpath := goKeyPath(path, k)
+			kv := reflect.New(dest.Type().Key()).Elem()
+			if err := gm.elementToGoType(m, fd.GetMapKeyType(), k, kv, kpath); err != nil {
+				return err
+			}
+			vv := reflect.New(dest.Type().Elem()).Elem()
+			if err := gm.elementToGoType(m, fd.GetMapValueType(), val, vv, kpath); err != nil {
+				return err
+			}
+			dest.SetMapIndex(kv, vv)
+		}
+		return nil
+	case fd.IsRepeated():
+		if dest.Kind() != reflect.Slice {
+			return goValueError(path, fd, dest.Type(), fmt.Errorf("repeated field %s cannot be stored in %v", fd.GetFullyQualifiedName(), dest.Type()))
+		}
+		items := v.([]interface{})
+		s := reflect.MakeSlice(dest.Type(), len(items), len(items))
+		for i, item := range items {
+			if err := gm.elementToGoType(m, fd, item, s.Index(i), goIndexPath(path, i)); err != nil {
+				return err
+			}
+		}
+		dest.Set(s)
+		return nil
+	default:
+		return gm.elementToGoType(m, fd, v, dest, path)
+	}
+}
+
+// elementToGoType stores the given value of the given field, which is a single
+// element for repeated fields, into dest.
+func (gm *GoValueMapper) elementToGoType(m *Message, fd *desc.FieldDescriptor, v interface{}, dest reflect.Value, path string) error {
+	t := dest.Type()
+	fail := func(format string, args ...interface{}) error {
+		return goValueError(path, fd, t, fmt.Errorf(format, args...))
+	}
+	cannotStore := func() error {
+		return fail("value of field %s cannot be stored in %v", fd.GetFullyQualifiedName(), t)
+	}
+
+	if t == typeOfInterface {
+		gv, err := gm.elementToGo(m, fd, v, path)
+		if err != nil {
+			return err
+		}
+		if gv != nil {
+			dest.Set(reflect.ValueOf(gv))
+		}
+		return nil
+	}
+	if fd.GetMessageType() != nil {
+		return gm.messageToGoType(m, fd, v, dest, path)
+	}
+	if dest.Kind() == reflect.Ptr {
+		if dest.IsNil() {
+			dest.Set(reflect.New(t.Elem()))
+		}
+		return gm.elementToGoType(m, fd, v, dest.Elem(), path)
+	}
+
+	rv := reflect.ValueOf(v)
+	switch dest.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		if t == typeOfDuration && !gm.Lenient {
+			return cannotStore()
+		}
+		var i int64
+		switch rv.Kind() {
+		case reflect.Int32, reflect.Int64:
+			i = rv.Int()
+		case reflect.Uint32, reflect.Uint64:
+			if rv.Uint() > math.MaxInt64 {
+				return fail("value %d overflows %v", rv.Uint(), t)
+			}
+			i = int64(rv.Uint())
+		default:
+			return cannotStore()
+		}
+		if dest.OverflowInt(i) {
+			return fail("value %d overflows %v", i, t)
+		}
+		dest.SetInt(i)
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		var u uint64
+		switch rv.Kind() {
+		case reflect.Int32, reflect.Int64:
+			if rv.Int() < 0 {
+				return fail("value %d overflows %v", rv.Int(), t)
+			}
+			u = uint64(rv.Int())
+		case reflect.Uint32, reflect.Uint64:
+			u = rv.Uint()
+		default:
+			return cannotStore()
+		}
+		if dest.OverflowUint(u) {
+			return fail("value %d overflows %v", u, t)
+		}
+		dest.SetUint(u)
+	case reflect.Float32, reflect.Float64:
+		var f float64
+		switch rv.Kind() {
+		case reflect.Float32, reflect.Float64:
+			f = rv.Float()
+		case reflect.Int32, reflect.Int64, reflect.Uint32, reflect.Uint64:
+			if !gm.Lenient {
+				return cannotStore()
+			}
+			f, _ = gm.floatFromGo(rv, 64)
+		default:
+			return cannotStore()
+		}
+		if dest.Kind() == reflect.Float32 && rv.Kind() == reflect.Float64 && !math.IsInf(f, 0) && !math.IsNaN(f) && float64(float32(f)) != f && !gm.Lenient {
+			return fail("value %v cannot be represented exactly as %v", f, t)
+		}
+		dest.SetFloat(f)
+	case reflect.Bool:
+		if rv.Kind() != reflect.Bool {
+			return cannotStore()
+		}
+		dest.SetBool(rv.Bool())
+	case reflect.String:
+		switch {
+		case rv.Kind() == reflect.String:
+			dest.SetString(rv.String())
+		case fd.GetType() == descriptorpb.FieldDescriptorProto_TYPE_ENUM:
+			ev := fd.GetEnumType().FindValueByNumber(v.(int32))
+			if ev == nil {
+				return fail("enum %s has no value with number %d", fd.GetEnumType().GetFullyQualifiedName(), v.(int32))
+			}
+			dest.SetString(ev.GetName())
+		case gm.Lenient && rv.Kind() == reflect.Slice:
+			dest.SetString(base64.StdEncoding.EncodeToString(v.([]byte)))
+		case gm.Lenient:
+			dest.SetString(fmt.Sprint(v))
+		default:
+			return cannotStore()
+		}
+	case reflect.Slice:
+		b, ok := v.([]byte)
+		if !ok || t.Elem().Kind() != reflect.Uint8 {
+			return cannotStore()
+		}
+		dest.SetBytes(append([]byte(nil), b...))
+	default:
+		return cannotStore()
+	}
+	return nil
+}
+
+func (gm *GoValueMapper) messageToGoType(m *Message, fd *desc.FieldDescriptor, v interface{}, dest reflect.Value, path string) error {
+	t := dest.Type()
+	if v == nil || reflect.ValueOf(v).IsNil() {
+		return nil
+	}
+	md := fd.GetMessageType()
+	dm, err := m.asDynamicMessage(md, v)
+	if err != nil {
+		return goValueError(path, fd, t, err)
+	}
+
+	if t.Implements(typeOfProtoMessage) && t.Kind() == reflect.Ptr {
+		if dest.IsNil() {
+			dest.Set(reflect.New(t.Elem()))
+		}
+		target := dest.Interface().(proto.Message)
+		if other, ok := target.(*Message); ok {
+			if err := other.MergeFrom(dm); err != nil {
+				return goValueError(path, fd, t, err)
+			}
+			return nil
+		}
+		if proto.MessageName(target) != md.GetFullyQualifiedName() {
+			return goValueError(path, fd, t, fmt.Errorf("value of field %s cannot be stored in %v", fd.GetFullyQualifiedName(), t))
+		}
+		if err := dm.MergeInto(target); err != nil {
+			return goValueError(path, fd, t, err)
+		}
+		return nil
+	}
+	if dest.Kind() == reflect.Ptr {
+		if dest.IsNil() {
+			dest.Set(reflect.New(t.Elem()))
+		}
+		return gm.messageToGoType(m, fd, dm, dest.Elem(), path)
+	}
+
+	switch fqn := md.GetFullyQualifiedName(); {
+	case fqn == "google.protobuf.Timestamp" && t == typeOfTime:
+		secs, _ := dm.GetFieldByNumber(1).(int64)
+		nanos, _ := dm.GetFieldByNumber(2).(int32)
+		dest.Set(reflect.ValueOf(time.Unix(secs, int64(nanos)).UTC()))
+		return nil
+	case fqn == "google.protobuf.Duration" && t == typeOfDuration:
+		secs, _ := dm.GetFieldByNumber(1).(int64)
+		nanos, _ := dm.GetFieldByNumber(2).(int32)
+		if secs > math.MaxInt64/int64(time.Second) || secs < math.MinInt64/int64(time.Second) {
+			return goValueError(path, fd, t, fmt.Errorf("duration of %d seconds overflows %v", secs, t))
+		}
+		dest.SetInt(secs*int64(time.Second) + int64(nanos))
+		return nil
+	case isWrapperType(md) && dest.Kind() != reflect.Struct:
+		return gm.elementToGoType(dm, md.FindFieldByNumber(1), dm.GetFieldByNumber(1), dest, path)
+	}
+
+	switch dest.Kind() {
+	case reflect.Struct:
+		return gm.toStruct(dm, dest, path)
+	case reflect.Map:
+		if t.Key().Kind() != reflect.String {
+			break
+		}
+		gv, err := gm.elementToGo(m, fd, dm, path)
+		if err != nil {
+			return err
+		}
+		gvv := reflect.ValueOf(gv)
+		if !gvv.Type().AssignableTo(t) {
+			break
+		}
+		dest.Set(gvv)
+		return nil
+	}
+	return goValueError(path, fd, t, fmt.Errorf("value of field %s cannot be stored in %v", fd.GetFullyQualifiedName(), t))
+}
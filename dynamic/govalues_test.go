@@ -0,0 +1,348 @@
+package dynamic
+
+import (
+	"encoding/json"
+	"errors"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/golang/protobuf/proto"
+	"google.golang.org/protobuf/types/known/durationpb"
+	"google.golang.org/protobuf/types/known/structpb"
+	"google.golang.org/protobuf/types/known/timestamppb"
+	"google.golang.org/protobuf/types/known/wrapperspb"
+
+	"github.com/jhump/protoreflect/internal/testprotos"
+	"github.com/jhump/protoreflect/internal/testutil"
+)
+
+func goValuesTestRequest(t *testing.T) *Message {
+	dm, err := AsDynamicMessage(&testprotos.TestRequest{
+		Foo: []testprotos.Proto3Enum{testprotos.Proto3Enum_VALUE1, testprotos.Proto3Enum_VALUE2},
+		Bar: "bar",
+		Baz: &testprotos.TestMessage{Ne: []testprotos.TestMessage_NestedEnum{testprotos.TestMessage_VALUE1}},
+		Flags: map[string]bool{
+			"a": true,
+			"b": false,
+		},
+		Others: map[string]*testprotos.TestMessage{
+			"x": {Ne: []testprotos.TestMessage_NestedEnum{testprotos.TestMessage_VALUE2}},
+		},
+	})
+	testutil.Ok(t, err)
+	return dm
+}
+
+func TestGoValueMapper_ToMap(t *testing.T) {
+	dm := goValuesTestRequest(t)
+	vals, err := dm.ToMap()
+	testutil.Ok(t, err)
+	expected := map[string]interface{}{
+		"foo":   []interface{}{"VALUE1", "VALUE2"},
+		"bar":   "bar",
+		"baz":   map[string]interface{}{"ne": []interface{}{"VALUE1"}},
+		"flags": map[string]interface{}{"a": true, "b": false},
+		"others": map[string]interface{}{
+			"x": map[string]interface{}{"ne": []interface{}{"VALUE2"}},
+		},
+	}
+	testutil.Require(t, reflect.DeepEqual(expected, vals), "unexpected map: %v", vals)
+
+	vals, err = (&GoValueMapper{EnumsAsInts: true}).ToMap(dm)
+	testutil.Ok(t, err)
+	testutil.Require(t, reflect.DeepEqual([]interface{}{int32(1), int32(2)}, vals["foo"]), "unexpected enum values: %v", vals["foo"])
+
+	dm2 := NewMessage(dm.GetMessageDescriptor())
+	testutil.Ok(t, dm2.FromMap(vals))
+	testutil.Ceq(t, dm, dm2, eqdm)
+}
+
+func TestGoValueMapper_ToMapNamesAndDefaults(t *testing.T) {
+	dm, err := AsDynamicMessage(&testprotos.UnaryFields{I: proto.Int32(1), J: proto.Int64(2), U: []byte{1, 2}})
+	testutil.Ok(t, err)
+	vals, err := dm.ToMap()
+	testutil.Ok(t, err)
+	testutil.Require(t, reflect.DeepEqual(map[string]interface{}{"i": int32(1), "j": int64(2), "u": []byte{1, 2}}, vals), "unexpected map: %v", vals)
+
+	vals, err = (&GoValueMapper{EmitDefaults: true}).ToMap(dm)
+	testutil.Ok(t, err)
+	testutil.Eq(t, uint64(0), vals["n"])
+	testutil.Eq(t, "", vals["v"])
+
+	dm, err = AsDynamicMessage(&testprotos.TestWellKnownTypes{StartTime: &timestamppb.Timestamp{}})
+	testutil.Ok(t, err)
+	vals, err = dm.ToMap()
+	testutil.Ok(t, err)
+	_, ok := vals["startTime"]
+	testutil.Require(t, ok, "expecting JSON name: %v", vals)
+	vals, err = (&GoValueMapper{OrigName: true}).ToMap(dm)
+	testutil.Ok(t, err)
+	_, ok = vals["start_time"]
+	testutil.Require(t, ok, "expecting original name: %v", vals)
+}
+
+func TestGoValueMapper_WellKnownTypes(t *testing.T) {
+	dm, err := AsDynamicMessage(&testprotos.TestWellKnownTypes{
+		StartTime: &timestamppb.Timestamp{Seconds: 1, Nanos: 500000000},
+		Elapsed:   durationpb.New(1500 * time.Millisecond),
+		I64:       wrapperspb.Int64(-123),
+		Str:       wrapperspb.String("abc"),
+		Json: []*structpb.Value{
+			structpb.NewNullValue(),
+			structpb.NewStringValue("xyz"),
+		},
+	})
+	testutil.Ok(t, err)
+	vals, err := dm.ToMap()
+	testutil.Ok(t, err)
+	expected := map[string]interface{}{
+		"startTime": "1970-01-01T00:00:01.500Z",
+		"elapsed":   "1.500s",
+		"i64":       int64(-123),
+		"str":       "abc",
+		"json":      []interface{}{nil, "xyz"},
+	}
+	testutil.Require(t, reflect.DeepEqual(expected, vals), "unexpected map: %v", vals)
+
+	dm2 := NewMessage(dm.GetMessageDescriptor())
+	testutil.Ok(t, dm2.FromMap(vals))
+	testutil.Ceq(t, dm, dm2, eqdm)
+
+	// time values can be used, too
+	vals["startTime"] = time.Unix(1, 500000000)
+	vals["elapsed"] = 1500 * time.Millisecond
+	dm2 = NewMessage(dm.GetMessageDescriptor())
+	testutil.Ok(t, dm2.FromMap(vals))
+	testutil.Ceq(t, dm, dm2, eqdm)
+}
+
+func TestGoValueMapper_FromMapStrict(t *testing.T) {
+	md := goValuesTestRequest(t).GetMessageDescriptor()
+	testCases := []struct {
+		name string
+		vals map[string]interface{}
+		path string
+	}{
+		{
+			name: "unknown key",
+			vals: map[string]interface{}{"bar": "x", "fizz": 1},
+			path: "fizz",
+		},
+		{
+			name: "wrong type",
+			vals: map[string]interface{}{"bar": 123},
+			path: "bar",
+		},
+		{
+			name: "unknown enum value",
+			vals: map[string]interface{}{"baz": map[string]interface{}{"ne": []interface{}{"VALUE1", "VALUE9"}}},
+			path: "baz.ne[1]",
+		},
+		{
+			name: "overflow",
+			vals: map[string]interface{}{"foo": []int64{1, 1 << 40}},
+			path: "foo[1]",
+		},
+		{
+			name: "map value",
+			vals: map[string]interface{}{"flags": map[string]interface{}{"a": "true"}},
+			path: `flags["a"]`,
+		},
+		{
+			name: "nested map value",
+			vals: map[string]interface{}{"others": map[string]interface{}{"x": map[string]interface{}{"ne": "VALUE1"}}},
+			path: `others["x"].ne`,
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			err := NewMessage(md).FromMap(tc.vals)
+			var gve *GoValueError
+			testutil.Require(t, errors.As(err, &gve), "expecting *GoValueError, got %v", err)
+			testutil.Eq(t, tc.path, gve.Path, "wrong path: %v", err)
+		})
+	}
+}
+
+func TestGoValueMapper_FromMapLenient(t *testing.T) {
+	dm, err := AsDynamicMessage(&testprotos.UnaryFields{})
+	testutil.Ok(t, err)
+	vals := map[string]interface{}{
+		"i":       "-123",
+		"j":       float64(1 << 40),
+		"m":       json.Number("42"),
+		"s":       "1.5",
+		"u":       "AQI=",
+		"v":       12,
+		"w":       "true",
+		"unknown": "ignored",
+	}
+	err = dm.FromMap(vals)
+	testutil.Require(t, err != nil, "expecting error in strict mode")
+
+	err = (&GoValueMapper{Lenient: true}).FromMap(vals, dm)
+	testutil.Ok(t, err)
+	expected := &testprotos.UnaryFields{
+		I: proto.Int32(-123),
+		J: proto.Int64(1 << 40),
+		M: proto.Uint32(42),
+		S: proto.Float32(1.5),
+		U: []byte{1, 2},
+		V: proto.String("12"),
+		W: proto.Bool(true),
+	}
+	var msg testprotos.UnaryFields
+	testutil.Ok(t, dm.ConvertTo(&msg))
+	testutil.Ceq(t, expected, &msg, eqpm)
+
+	err = (&GoValueMapper{Lenient: true}).FromMap(map[string]interface{}{"i": 1.5}, dm)
+	var gve *GoValueError
+	testutil.Require(t, errors.As(err, &gve), "expecting *GoValueError, got %v", err)
+	testutil.Eq(t, "i", gve.Path)
+	testutil.Eq(t, "testprotos.UnaryFields.i", gve.Field.GetFullyQualifiedName())
+}
+
+type goValuesNested struct {
+	Values []string `proto:"ne"`
+}
+
+type goValuesEmbedded struct {
+	Flags map[string]bool
+}
+
+type goValuesRequest struct {
+	Foo    []string
+	Bar    string `proto:"bar"`
+	Baz    *goValuesNested
+	Others map[string]goValuesNested
+	goValuesEmbedded
+	Ignored int `proto:"-"`
+}
+
+func TestGoValueMapper_Struct(t *testing.T) {
+	dm := goValuesTestRequest(t)
+	var s goValuesRequest
+	testutil.Ok(t, dm.ToStruct(&s))
+	expected := goValuesRequest{
+		Foo:    []string{"VALUE1", "VALUE2"},
+		Bar:    "bar",
+		Baz:    &goValuesNested{Values: []string{"VALUE1"}},
+		Others: map[string]goValuesNested{"x": {Values: []string{"VALUE2"}}},
+		goValuesEmbedded: goValuesEmbedded{
+			Flags: map[string]bool{"a": true, "b": false},
+		},
+	}
+	testutil.Require(t, reflect.DeepEqual(expected, s), "unexpected struct: %+v", s)
+
+	dm2 := NewMessage(dm.GetMessageDescriptor())
+	testutil.Ok(t, dm2.FromStruct(&s))
+	testutil.Ceq(t, dm, dm2, eqdm)
+}
+
+func TestGoValueMapper_StructTypes(t *testing.T) {
+	type wkts struct {
+		StartTime time.Time
+		Elapsed   time.Duration
+		I64       *int64
+		Str       string
+		Json      []interface{}
+	}
+	dm, err := AsDynamicMessage(&testprotos.TestWellKnownTypes{
+		StartTime: timestamppb.New(time.Date(2020, 1, 2, 3, 4, 5, 6, time.UTC)),
+		Elapsed:   durationpb.New(time.Minute),
+		I64:       wrapperspb.Int64(-123),
+		Str:       wrapperspb.String("abc"),
+		Json:      []*structpb.Value{structpb.NewBoolValue(true)},
+	})
+	testutil.Ok(t, err)
+	var s wkts
+	testutil.Ok(t, dm.ToStruct(&s))
+	testutil.Eq(t, time.Date(2020, 1, 2, 3, 4, 5, 6, time.UTC), s.StartTime)
+	testutil.Eq(t, time.Minute, s.Elapsed)
+	testutil.Eq(t, int64(-123), *s.I64)
+	testutil.Eq(t, "abc", s.Str)
+	testutil.Require(t, reflect.DeepEqual([]interface{}{true}, s.Json), "unexpected json: %v", s.Json)
+
+	dm2 := NewMessage(dm.GetMessageDescriptor())
+	testutil.Ok(t, dm2.FromStruct(s))
+	testutil.Ceq(t, dm, dm2, eqdm)
+
+	// generated message types can be used for message fields
+	var gen struct {
+		Baz *testprotos.TestMessage
+		Bar interface{}
+	}
+	dm = goValuesTestRequest(t)
+	err = (&GoValueMapper{Lenient: true}).ToStruct(dm, &gen)
+	testutil.Ok(t, err)
+	testutil.Ceq(t, &testprotos.TestMessage{Ne: []testprotos.TestMessage_NestedEnum{testprotos.TestMessage_VALUE1}}, gen.Baz, eqpm)
+	testutil.Eq(t, "bar", gen.Bar)
+
+	// options after the name in a tag are ignored, and an empty name means
+	// the field is matched as if untagged
+	var tagged struct {
+		Str string                  `proto:"bar,2,json=b"`
+		Baz *testprotos.TestMessage `proto:",3"`
+	}
+	err = (&GoValueMapper{Lenient: true}).ToStruct(dm, &tagged)
+	testutil.Ok(t, err)
+	testutil.Eq(t, "bar", tagged.Str)
+	testutil.Require(t, tagged.Baz != nil)
+
+	// untagged fields may spell out the underscores in the proto field name
+	var underscores struct {
+		Start_time time.Time
+		I64        *int64
+	}
+	dm, err = AsDynamicMessage(&testprotos.TestWellKnownTypes{
+		StartTime: timestamppb.New(time.Date(2020, 1, 2, 3, 4, 5, 6, time.UTC)),
+		I64:       wrapperspb.Int64(-123),
+	})
+	testutil.Ok(t, err)
+	err = (&GoValueMapper{Lenient: true}).ToStruct(dm, &underscores)
+	testutil.Ok(t, err)
+	testutil.Eq(t, time.Date(2020, 1, 2, 3, 4, 5, 6, time.UTC), underscores.Start_time)
+	testutil.Eq(t, int64(-123), *underscores.I64)
+}
+
+func TestGoValueMapper_StructErrors(t *testing.T) {
+	dm := goValuesTestRequest(t)
+
+	// strict mode requires a destination for all fields that are set
+	var partial struct {
+		Bar string
+	}
+	err := dm.ToStruct(&partial)
+	var gve *GoValueError
+	testutil.Require(t, errors.As(err, &gve), "expecting *GoValueError, got %v", err)
+	testutil.Eq(t, "foo", gve.Path)
+	testutil.Ok(t, (&GoValueMapper{Lenient: true}).ToStruct(dm, &partial))
+	testutil.Eq(t, "bar", partial.Bar)
+
+	var badTag struct {
+		Bar string `proto:"nope"`
+	}
+	err = (&GoValueMapper{Lenient: true}).ToStruct(dm, &badTag)
+	testutil.Require(t, errors.As(err, &gve), "expecting *GoValueError, got %v", err)
+	testutil.Eq(t, "Bar", gve.Path)
+
+	var badType struct {
+		Foo  []bool
+		Rest interface{} `proto:"-"`
+	}
+	err = (&GoValueMapper{Lenient: true}).ToStruct(dm, &badType)
+	testutil.Require(t, errors.As(err, &gve), "expecting *GoValueError, got %v", err)
+	testutil.Eq(t, "Foo[0]", gve.Path)
+	testutil.Eq(t, reflect.TypeOf(false), gve.GoType)
+
+	extra := struct {
+		Bar   string
+		Extra int
+	}{Bar: "abc"}
+	err = NewMessage(dm.GetMessageDescriptor()).FromStruct(extra)
+	testutil.Require(t, errors.As(err, &gve), "expecting *GoValueError, got %v", err)
+	testutil.Eq(t, "Extra", gve.Path)
+	testutil.Ok(t, (&GoValueMapper{Lenient: true}).FromStruct(extra, dm))
+	testutil.Eq(t, "abc", dm.GetFieldByName("bar"))
+}
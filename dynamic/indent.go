@@ -7,6 +7,8 @@ type indentBuffer struct {
 	indent      string
 	indentCount int
 	comma       bool
+	// if non-nil, Any messages are expanded
+	anyx *anyExpansion
 }
 
 func (b *indentBuffer) start() error {
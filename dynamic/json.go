@@ -124,6 +124,9 @@ func (m *Message) marshalJSON(b *indentBuffer, opts *jsonpb.Marshaler) error {
 		opts = &newOpts
 	}
 
+	if b.anyx != nil && isAny(m) {
+		return marshalAnyJSON(m, b, opts)
+	}
 	if ok, err := marshalWellKnownType(m, b, opts); ok {
 		return err
 	}
@@ -137,6 +140,25 @@ func (m *Message) marshalJSON(b *indentBuffer, opts *jsonpb.Marshaler) error {
 		return err
 	}
 
+	first := true
+	err = m.marshalJSONFields(b, opts, &first)
+	if err != nil {
+		return err
+	}
+
+	err = b.end()
+	if err != nil {
+		return err
+	}
+	err = b.WriteByte('}')
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+func (m *Message) marshalJSONFields(b *indentBuffer, opts *jsonpb.Marshaler, first *bool) error {
 	var tags []int
 	if opts.EmitDefaults {
 		tags = m.allKnownFieldTags()
@@ -144,8 +166,6 @@ func (m *Message) marshalJSON(b *indentBuffer, opts *jsonpb.Marshaler) error {
 		tags = m.knownFieldTags()
 	}
 
-	first := true
-
 	for _, tag := range tags {
 		itag := int32(tag)
 		fd := m.FindFieldDescriptor(itag)
@@ -159,7 +179,7 @@ func (m *Message) marshalJSON(b *indentBuffer, opts *jsonpb.Marshaler) error {
 			v = fd.GetDefaultValue()
 		}
 
-		err := b.maybeNext(&first)
+		err := b.maybeNext(first)
 		if err != nil {
 			return err
 		}
@@ -168,16 +188,6 @@ func (m *Message) marshalJSON(b *indentBuffer, opts *jsonpb.Marshaler) error {
 			return err
 		}
 	}
-
-	err = b.end()
-	if err != nil {
-		return err
-	}
-	err = b.WriteByte('}')
-	if err != nil {
-		return err
-	}
-
 	return nil
 }
 
@@ -442,6 +452,14 @@ func marshalKnownFieldValueJSON(b *indentBuffer, fd *desc.FieldDescriptor, v int
 		if dm, ok := v.(*Message); ok {
 			return dm.marshalJSON(b, opts)
 		}
+		if b.anyx != nil {
+			// use a dynamic message so that nested Any messages are expanded
+			dm, err := AsDynamicMessage(v.(proto.Message))
+			if err != nil {
+				return err
+			}
+			return dm.marshalJSON(b, opts)
+		}
 
 		var err error
 		if b.indentCount <= 0 || len(b.indent) == 0 {
@@ -546,7 +564,10 @@ func (m *Message) UnmarshalJSONPB(opts *jsonpb.Unmarshaler, js []byte) error {
 // reset the message, instead merging the data in the given bytes into the
 // existing data in this message.
 func (m *Message) UnmarshalMergeJSONPB(opts *jsonpb.Unmarshaler, js []byte) error {
-	r := newJsReader(js)
+	return m.unmarshalJSONMerge(newJsReader(js), opts)
+}
+
+func (m *Message) unmarshalJSONMerge(r *jsReader, opts *jsonpb.Unmarshaler) error {
 	err := m.unmarshalJson(r, opts)
 	if err != nil {
 		return err
@@ -595,6 +616,9 @@ func (m *Message) unmarshalJson(r *jsReader, opts *jsonpb.Unmarshaler) error {
 		opts = &newOpts
 	}
 
+	if r.anyx != nil && isAny(m) {
+		return m.unmarshalAnyJSON(r, opts)
+	}
 	if ok, err := unmarshalWellKnownType(m, r, opts); ok {
 		return err
 	}
@@ -808,6 +832,15 @@ func unmarshalJsFieldElement(fd *desc.FieldDescriptor, r *jsReader, mf *MessageF
 			if err := dm.unmarshalJson(r, opts); err != nil {
 				return nil, err
 			}
+		} else if r.anyx != nil {
+			// use a dynamic message so that nested Any messages are expanded
+			dm := NewMessageWithMessageFactory(fd.GetMessageType(), mf)
+			if err := dm.unmarshalJson(r, opts); err != nil {
+				return nil, err
+			}
+			if err := dm.MergeInto(m); err != nil {
+				return nil, err
+			}
 		} else {
 			var msg json.RawMessage
 			if err := json.NewDecoder(r.unread()).Decode(&msg); err != nil {
@@ -910,6 +943,7 @@ type jsReader struct {
 	dec     *json.Decoder
 	current json.Token
 	peeked  bool
+	anyx    *anyExpansion
 }
 
 func newJsReader(b []byte) *jsReader {
@@ -0,0 +1,761 @@
+package dynamic
+
+// Conversion of dynamic messages from one message type to another
+
+import (
+	"fmt"
+	"math"
+	"sort"
+	"strings"
+	"unicode/utf8"
+
+	"google.golang.org/protobuf/types/descriptorpb"
+
+	"github.com/jhump/protoreflect/desc"
+)
+
+// Migration converts messages of one type into messages of another type,
+// such as an older or newer version of a message's schema. Unlike ConvertTo
+// and ConvertFrom, which require both messages to have compatible wire
+// formats, a migration is driven by the names of fields and by declarative
+// rules.
+//
+// By default, each field of the source message is copied to the field of the
+// target message that has the same name. Values are converted when the two
+// fields have different types, as long as no information is lost: integers
+// can be widened (or narrowed, if the value fits), integers and floating point
+// values can be converted to one another if the value can be represented
+// exactly, wrapper types (like google.protobuf.Int32Value) can be converted
+// to and from the types they wrap, enum values can be converted to and from
+// strings (using the value's name) and integers (using the value's number),
+// and strings can be converted to and from bytes (if they are valid UTF-8).
+// Message fields are converted recursively, so the source and target field
+// need not have the same message type. Singular and repeated fields can be
+// converted to one another, though converting a repeated field with more than
+// one value to a singular field keeps only the last value.
+//
+// Rules are keyed by the path to a field in the source message: the names of
+// the fields that lead to it, separated by dots. For example, "address.zip"
+// refers to the field named "zip" in the message stored in the top-level
+// "address" field. Paths do not indicate indexes into repeated fields or keys
+// of map fields: the rule applies to all elements. Extensions are named by
+// their fully-qualified name in brackets, like "[foo.bar.baz]".
+//
+// Values that cannot be converted, fields that have no corresponding field in
+// the target message, and unrecognized fields are dropped. All dropped values
+// are described in the returned MigrationReport.
+type Migration struct {
+	// The type of the resulting messages.
+	Target *desc.MessageDescriptor
+	// Moves or renames fields. The keys are paths in the source message, and
+	// the values are the corresponding paths in the target message, both
+	// relative to the top-level message. Fields can be moved into or out of
+	// nested messages. But if the source path is inside a repeated or map
+	// field, the target path must be inside the corresponding field in the
+	// target message, since each element is migrated separately. If a value
+	// is the empty string, the field is dropped, without being reported in
+	// the MigrationReport.
+	Paths map[string]string
+	// Re-maps field numbers. The keys are fully-qualified names of message
+	// types in the source schema. The values map field numbers in that message
+	// to field numbers in the corresponding message in the target schema. A
+	// field that is re-mapped is matched by number instead of by name.
+	FieldNumbers map[string]map[int32]int32
+	// Re-maps enum values. The keys are fully-qualified names of enum types in
+	// the source schema. The values map names of values in that enum to names
+	// of values in the target enum. Enum values that are not re-mapped are
+	// matched by name.
+	EnumValues map[string]map[string]string
+	// Custom conversion functions, keyed by paths in the source message. The
+	// function is called instead of the default conversion.
+	Funcs map[string]MigrationFunc
+}
+
+// MigrationFunc is a custom function that converts the value of a field of a
+// source message into a value for the target message. The given value is the
+// same as returned by Message.GetField. The given target is the field to which
+// the result will be assigned, which may be nil if the source field has no
+// corresponding field in the target message.
+//
+// The returned value is assigned to the target field using Message.SetField,
+// so it must be of a suitable type (for example, a []interface{} or other
+// slice for a repeated field). If the function returns nil, no value is
+// assigned.
+type MigrationFunc func(val interface{}, target *desc.FieldDescriptor) (interface{}, error)
+
+// MigrationReport describes the results of a migration.
+type MigrationReport struct {
+	// The values that were dropped because they could not be migrated.
+	Dropped []DroppedValue
+}
+
+// DroppedValue describes a value that could not be migrated.
+type DroppedValue struct {
+	// The path to the value in the source message. Unlike the paths in
+	// migration rules, this includes indexes of repeated fields and keys of
+	// map fields, like `foo.bar[3].baz["abc"]`. Unrecognized fields are
+	// indicated by number, like "foo.#123".
+	Path string
+	// The source field, or nil if the field was not recognized.
+	Field *desc.FieldDescriptor
+	// The dropped value.
+	Value interface{}
+	// A description of why the value was dropped.
+	Reason string
+}
+
+// Migrate converts the given message into a message of the migration's target
+// type. An error is returned if the migration's rules refer to fields that do
+// not exist, if a target path is not valid, or if a custom conversion function
+// fails. Values that cannot be converted do not cause errors; they are instead
+// described by the returned report.
+func (mg *Migration) Migrate(src *Message) (*Message, *MigrationReport, error) {
+	if err := mg.validate(src.md); err != nil {
+		return nil, nil, err
+	}
+	dst := src.mf.NewDynamicMessage(mg.Target)
+	mc := migrationContext{mg: mg, report: &MigrationReport{}}
+	sc := migrationScope{root: dst}
+	if err := mc.migrateMessage(src, dst, "", "", "", &sc); err != nil {
+		return nil, nil, err
+	}
+	return dst, mc.report, nil
+}
+
+// validate checks that the migration's rules refer to valid paths.
+func (mg *Migration) validate(src *desc.MessageDescriptor) error {
+	if mg.Target == nil {
+		return fmt.Errorf("migration has no target message type")
+	}
+	for p, t := range mg.Paths {
+		if _, err := resolveMigrationPath(src, p); err != nil {
+			return fmt.Errorf("invalid source path %q: %v", p, err)
+		}
+		if t == "" {
+			continue
+		}
+		if _, err := resolveMigrationPath(mg.Target, t); err != nil {
+			return fmt.Errorf("invalid target path %q for source path %q: %v", t, p, err)
+		}
+	}
+	for p := range mg.Funcs {
+		if _, err := resolveMigrationPath(src, p); err != nil {
+			return fmt.Errorf("invalid path %q for custom function: %v", p, err)
+		}
+	}
+	return nil
+}
+
+// resolveMigrationPath returns the fields named by the given path, relative
+// to the given message.
+func resolveMigrationPath(md *desc.MessageDescriptor, path string) ([]*desc.FieldDescriptor, error) {
+	if path == "" {
+		return nil, fmt.Errorf("path is empty")
+	}
+	names := splitMigrationPath(path)
+	fields := make([]*desc.FieldDescriptor, len(names))
+	for i, name := range names {
+		if md == nil {
+			return nil, fmt.Errorf("field %s is not a message", fields[i-1].GetFullyQualifiedName())
+		}
+		fd := findMigrationField(md, name)
+		if fd == nil {
+			if strings.HasPrefix(name, "[") {
+				// extensions may be defined in files that are not known until
+				// migration, so the rest of the path cannot be checked now
+				return fields[:i], nil
+			}
+			return nil, fmt.Errorf("message type %s has no field named %s", md.GetFullyQualifiedName(), name)
+		}
+		fields[i] = fd
+		if fd.IsMap() {
+			md = fd.GetMapValueType().GetMessageType()
+		} else {
+			md = fd.GetMessageType()
+		}
+	}
+	return fields, nil
+}
+
+// splitMigrationPath splits the given path into field names. Dots inside of
+// brackets, which enclose extension names, do not separate names.
+func splitMigrationPath(path string) []string {
+	var names []string
+	depth, start := 0, 0
+	for i := 0; i < len(path); i++ {
+		switch path[i] {
+		case '[':
+			depth++
+		case ']':
+			depth--
+		case '.':
+			if depth == 0 {
+				names = append(names, path[start:i])
+				start = i + 1
+			}
+		}
+	}
+	return append(names, path[start:])
+}
+
+func findMigrationField(md *desc.MessageDescriptor, name string) *desc.FieldDescriptor {
+	if strings.HasPrefix(name, "[") && strings.HasSuffix(name, "]") {
+		return findExtension(md, name[1:len(name)-1], md.GetFile(), map[*desc.FileDescriptor]struct{}{})
+	}
+	return md.FindFieldByName(name)
+}
+
+// findExtension searches the given file and its dependencies for an extension
+// of the given message with the given name.
+func findExtension(md *desc.MessageDescriptor, name string, fd *desc.FileDescriptor, seen map[*desc.FileDescriptor]struct{}) *desc.FieldDescriptor {
+	if _, ok := seen[fd]; ok {
+		return nil
+	}
+	seen[fd] = struct{}{}
+	if ext, ok := fd.FindSymbol(name).(*desc.FieldDescriptor); ok && ext.IsExtension() && ext.GetOwner().GetFullyQualifiedName() == md.GetFullyQualifiedName() {
+		return ext
+	}
+	for _, dep := range fd.GetDependencies() {
+		if ext := findExtension(md, name, dep, seen); ext != nil {
+			return ext
+		}
+	}
+	return nil
+}
+
+func migrationFieldName(fd *desc.FieldDescriptor) string {
+	if fd.IsExtension() {
+		return "[" + fd.GetFullyQualifiedName() + "]"
+	}
+	return fd.GetName()
+}
+
+type migrationContext struct {
+	mg     *Migration
+	report *MigrationReport
+}
+
+// migrationScope tracks the message into which target paths are resolved.
+// This is the top-level message, or an element of a repeated or map field.
+type migrationScope struct {
+	root *Message
+	// the path, in the target message, of the repeated or map field that
+	// contains the root; empty for the top-level message
+	dstPath string
+}
+
+func (mc *migrationContext) drop(path string, fd *desc.FieldDescriptor, val interface{}, reason string, args ...interface{}) {
+	mc.report.Dropped = append(mc.report.Dropped, DroppedValue{
+		Path:   path,
+		Field:  fd,
+		Value:  val,
+		Reason: fmt.Sprintf(reason, args...),
+	})
+}
+
+func joinMigrationPath(path, name string) string {
+	if path == "" {
+		return name
+	}
+	return path + "." + name
+}
+
+// migrateMessage migrates the fields of src into dst. The given rule path is
+// the path of src, used to find migration rules, the given target path is the
+// path of dst, and the given value path is used to report dropped values.
+func (mc *migrationContext) migrateMessage(src, dst *Message, rulePath, targetPath, valuePath string, sc *migrationScope) error {
+	for _, tag := range src.knownFieldTags() {
+		fd := src.FindFieldDescriptor(int32(tag))
+		val := src.values[int32(tag)]
+		name := migrationFieldName(fd)
+		fieldRulePath := joinMigrationPath(rulePath, name)
+		fieldValuePath := joinMigrationPath(valuePath, name)
+
+		tm, tfd, fieldTargetPath, err := mc.findTarget(src, dst, fd, fieldRulePath, targetPath, sc)
+		if err != nil {
+			return err
+		}
+
+		if fn := mc.mg.Funcs[fieldRulePath]; fn != nil {
+			res, err := fn(src.GetField(fd), tfd)
+			if err != nil {
+				return fmt.Errorf("%s: %v", fieldValuePath, err)
+			}
+			if res != nil {
+				if tfd == nil {
+					return fmt.Errorf("%s: custom function returned a value but field has no target", fieldValuePath)
+				}
+				if err := tm.TrySetField(tfd, res); err != nil {
+					return fmt.Errorf("%s: %v", fieldValuePath, err)
+				}
+			}
+			continue
+		}
+
+		if tfd == nil {
+			if _, ok := mc.mg.Paths[fieldRulePath]; !ok {
+				mc.drop(fieldValuePath, fd, src.GetField(fd), "no corresponding field in %s", dst.md.GetFullyQualifiedName())
+			}
+			continue
+		}
+		if err := mc.migrateField(fd, val, tm, tfd, fieldRulePath, fieldTargetPath, fieldValuePath, sc); err != nil {
+			return err
+		}
+	}
+	for _, tag := range src.unknownFieldTags() {
+		mc.drop(fmt.Sprintf("%s#%d", joinMigrationPath(valuePath, ""), tag), nil, src.unknownFields[int32(tag)], "unrecognized field")
+	}
+	return nil
+}
+
+// findTarget returns the field to which the given source field should be
+// migrated, along with the message that contains it and its path. It returns
+// a nil field if there is no corresponding field. The given target path is the
+// path of dst.
+func (mc *migrationContext) findTarget(src, dst *Message, fd *desc.FieldDescriptor, rulePath, targetPath string, sc *migrationScope) (*Message, *desc.FieldDescriptor, string, error) {
+	if target, ok := mc.mg.Paths[rulePath]; ok {
+		if target == "" {
+			return nil, nil, "", nil
+		}
+		tm, tfd, err := mc.resolveTarget(target, sc)
+		if err != nil {
+			return nil, nil, "", fmt.Errorf("cannot move %s to %s: %v", rulePath, target, err)
+		}
+		return tm, tfd, target, nil
+	}
+	var tfd *desc.FieldDescriptor
+	if nums, ok := mc.mg.FieldNumbers[src.md.GetFullyQualifiedName()]; ok {
+		if num, ok := nums[fd.GetNumber()]; ok {
+			tfd = dst.FindFieldDescriptor(num)
+		}
+	}
+	if tfd == nil {
+		if fd.IsExtension() {
+			tfd = dst.er.FindExtensionByName(dst.md.GetFullyQualifiedName(), fd.GetFullyQualifiedName())
+			if tfd == nil && fd.GetOwner().GetFullyQualifiedName() == dst.md.GetFullyQualifiedName() {
+				tfd = fd
+			}
+		} else {
+			tfd = dst.md.FindFieldByName(fd.GetName())
+		}
+	}
+	if tfd == nil {
+		return nil, nil, "", nil
+	}
+	return dst, tfd, joinMigrationPath(targetPath, migrationFieldName(tfd)), nil
+}
+
+// resolveTarget resolves the given target path, relative to the given scope.
+// It returns the field named by the path and the message that contains it,
+// creating intermediate messages as necessary.
+func (mc *migrationContext) resolveTarget(path string, sc *migrationScope) (*Message, *desc.FieldDescriptor, error) {
+	rel := path
+	if sc.dstPath != "" {
+		if !strings.HasPrefix(path, sc.dstPath+".") {
+			return nil, nil, fmt.Errorf("target must be inside %s", sc.dstPath)
+		}
+		rel = path[len(sc.dstPath)+1:]
+	}
+	names := splitMigrationPath(rel)
+	m := sc.root
+	for i, name := range names {
+		fd := m.FindFieldDescriptorByName(name)
+		if fd == nil {
+			return nil, nil, fmt.Errorf("message type %s has no field named %s", m.md.GetFullyQualifiedName(), name)
+		}
+		if i == len(names)-1 {
+			return m, fd, nil
+		}
+		if fd.IsRepeated() || fd.GetMessageType() == nil {
+			return nil, nil, fmt.Errorf("field %s is not a singular message field", fd.GetFullyQualifiedName())
+		}
+		m = mc.nestedMessage(m, fd)
+	}
+	panic("unreachable")
+}
+
+// nestedMessage returns the value of the given singular message field,
+// creating it if it is not set.
+func (mc *migrationContext) nestedMessage(m *Message, fd *desc.FieldDescriptor) *Message {
+	if v, ok := m.values[fd.GetNumber()]; ok {
+		if dm, ok := v.(*Message); ok {
+			return dm
+		}
+		// convert generated message to dynamic message, so it can be modified
+		dm, err := m.asDynamicMessage(fd.GetMessageType(), v)
+		if err == nil {
+			m.SetField(fd, dm)
+			return dm
+		}
+	}
+	dm := m.mf.NewDynamicMessage(fd.GetMessageType())
+	m.SetField(fd, dm)
+	return dm
+}
+
+func (mc *migrationContext) migrateField(fd *desc.FieldDescriptor, val interface{}, tm *Message, tfd *desc.FieldDescriptor, rulePath, targetPath, valuePath string, sc *migrationScope) error {
+	// fields in nested messages of repeated and map fields get a new scope
+	newScope := func(root *Message) *migrationScope {
+		return &migrationScope{root: root, dstPath: targetPath}
+	}
+
+	switch {
+	case fd.IsMap():
+		if !tfd.IsMap() {
+			mc.drop(valuePath, fd, val, "cannot convert map field to non-map field %s", tfd.GetFullyQualifiedName())
+			return nil
+		}
+		entries := val.(map[interface{}]interface{})
+		keys := make([]interface{}, 0, len(entries))
+		for k := range entries {
+			keys = append(keys, k)
+		}
+		sort.Slice(keys, func(i, j int) bool {
+			return fmt.Sprint(keys[i]) < fmt.Sprint(keys[j])
+		})
+		for _, k := range keys {
+			entryPath := goKeyPath(valuePath, k)
+			key, reason := mc.convertScalar(fd.GetMapKeyType(), k, tfd.GetMapKeyType())
+			if reason != "" {
+				mc.drop(entryPath, fd, entries[k], "cannot convert map key: %s", reason)
+				continue
+			}
+			v, ok, err := mc.convertElement(fd.GetMapValueType(), entries[k], tfd.GetMapValueType(), tm, rulePath, targetPath, entryPath, newScope)
+			if err != nil {
+				return err
+			}
+			if ok {
+				tm.PutMapField(tfd, key, v)
+			}
+		}
+		return nil
+
+	case fd.IsRepeated():
+		items := val.([]interface{})
+		if !tfd.IsRepeated() {
+			if len(items) == 0 {
+				return nil
+			}
+			for i := 0; i < len(items)-1; i++ {
+				mc.drop(goIndexPath(valuePath, i), fd, items[i], "target field %s is not repeated", tfd.GetFullyQualifiedName())
+			}
+			last := len(items) - 1
+			return mc.migrateSingular(fd, items[last], tm, tfd, rulePath, targetPath, goIndexPath(valuePath, last), sc)
+		}
+		if tfd.IsMap() {
+			mc.drop(valuePath, fd, val, "cannot convert repeated field to map field %s", tfd.GetFullyQualifiedName())
+			return nil
+		}
+		for i, item := range items {
+			v, ok, err := mc.convertElement(fd, item, tfd, tm, rulePath, targetPath, goIndexPath(valuePath, i), newScope)
+			if err != nil {
+				return err
+			}
+			if ok {
+				tm.AddRepeatedField(tfd, v)
+			}
+		}
+		return nil
+
+	default:
+		if tfd.IsMap() {
+			mc.drop(valuePath, fd, val, "cannot convert singular field to map field %s", tfd.GetFullyQualifiedName())
+			return nil
+		}
+		if tfd.IsRepeated() {
+			v, ok, err := mc.convertElement(fd, val, tfd, tm, rulePath, targetPath, valuePath, newScope)
+			if err != nil {
+				return err
+			}
+			if ok {
+				tm.AddRepeatedField(tfd, v)
+			}
+			return nil
+		}
+		return mc.migrateSingular(fd, val, tm, tfd, rulePath, targetPath, valuePath, sc)
+	}
+}
+
+// migrateSingular migrates a single value into a singular target field.
+func (mc *migrationContext) migrateSingular(fd *desc.FieldDescriptor, val interface{}, tm *Message, tfd *desc.FieldDescriptor, rulePath, targetPath, valuePath string, sc *migrationScope) error {
+	if fd.GetMessageType() != nil && tfd.GetMessageType() != nil {
+		// merge into the target message, in the same scope, so that nested
+		// fields can be moved relative to it
+		srcMsg, err := tm.asDynamicMessage(fd.GetMessageType(), val)
+		if err != nil {
+			return fmt.Errorf("%s: %v", valuePath, err)
+		}
+		return mc.migrateMessage(srcMsg, mc.nestedMessage(tm, tfd), rulePath, targetPath, valuePath, sc)
+	}
+	v, ok, err := mc.convertElement(fd, val, tfd, tm, rulePath, targetPath, valuePath, nil)
+	if err != nil {
+		return err
+	}
+	if ok {
+		tm.SetField(tfd, v)
+	}
+	return nil
+}
+
+// convertElement converts a single value of the given source field into a
+// value for the given target field. It returns false if the value was dropped.
+func (mc *migrationContext) convertElement(fd *desc.FieldDescriptor, val interface{}, tfd *desc.FieldDescriptor, tm *Message, rulePath, targetPath, valuePath string, newScope func(*Message) *migrationScope) (interface{}, bool, error) {
+	srcMd, dstMd := fd.GetMessageType(), tfd.GetMessageType()
+	switch {
+	case srcMd != nil && dstMd != nil:
+		srcMsg, err := tm.asDynamicMessage(srcMd, val)
+		if err != nil {
+			return nil, false, fmt.Errorf("%s: %v", valuePath, err)
+		}
+		dm := tm.mf.NewDynamicMessage(dstMd)
+		sc := &migrationScope{root: dm}
+		if newScope != nil {
+			sc = newScope(dm)
+		}
+		if err := mc.migrateMessage(srcMsg, dm, rulePath, targetPath, valuePath, sc); err != nil {
+			return nil, false, err
+		}
+		return dm, true, nil
+
+	case srcMd != nil:
+		if !isWrapperType(srcMd) {
+			mc.drop(valuePath, fd, val, "cannot convert message %s to %s", srcMd.GetFullyQualifiedName(), migrationTypeName(tfd))
+			return nil, false, nil
+		}
+		srcMsg, err := tm.asDynamicMessage(srcMd, val)
+		if err != nil {
+			return nil, false, fmt.Errorf("%s: %v", valuePath, err)
+		}
+		vfd := srcMd.FindFieldByNumber(1)
+		v, reason := mc.convertScalar(vfd, srcMsg.GetField(vfd), tfd)
+		if reason != "" {
+			mc.drop(valuePath, fd, val, "%s", reason)
+			return nil, false, nil
+		}
+		return v, true, nil
+
+	case dstMd != nil:
+		if !isWrapperType(dstMd) {
+			mc.drop(valuePath, fd, val, "cannot convert %s to message %s", migrationTypeName(fd), dstMd.GetFullyQualifiedName())
+			return nil, false, nil
+		}
+		vfd := dstMd.FindFieldByNumber(1)
+		v, reason := mc.convertScalar(fd, val, vfd)
+		if reason != "" {
+			mc.drop(valuePath, fd, val, "%s", reason)
+			return nil, false, nil
+		}
+		dm := tm.mf.NewDynamicMessage(dstMd)
+		dm.SetField(vfd, v)
+		return dm, true, nil
+
+	default:
+		v, reason := mc.convertScalar(fd, val, tfd)
+		if reason != "" {
+			mc.drop(valuePath, fd, val, "%s", reason)
+			return nil, false, nil
+		}
+		return v, true, nil
+	}
+}
+
+func migrationTypeName(fd *desc.FieldDescriptor) string {
+	switch {
+	case fd.GetMessageType() != nil:
+		return fd.GetMessageType().GetFullyQualifiedName()
+	case fd.GetEnumType() != nil:
+		return fd.GetEnumType().GetFullyQualifiedName()
+	default:
+		return strings.ToLower(strings.TrimPrefix(fd.GetType().String(), "TYPE_"))
+	}
+}
+
+// convertScalar converts a scalar or enum value of the given source field into
+// a value for the given target field. If the value cannot be converted without
+// loss, it returns a non-empty reason.
+func (mc *migrationContext) convertScalar(fd *desc.FieldDescriptor, val interface{}, tfd *desc.FieldDescriptor) (interface{}, string) {
+	cannot := func() (interface{}, string) {
+		return nil, fmt.Sprintf("cannot convert %s to %s", migrationTypeName(fd), migrationTypeName(tfd))
+	}
+	doesNotFit := func() (interface{}, string) {
+		return nil, fmt.Sprintf("value %v cannot be represented as %s", val, migrationTypeName(tfd))
+	}
+
+	if fd.GetType() == tfd.GetType() && fd.GetEnumType() == nil {
+		return val, ""
+	}
+
+	// the source value as a number, if it is numeric
+	var i int64
+	var u uint64
+	var f float64
+	var isInt, isUint, isFloat bool
+	switch v := val.(type) {
+	case int32:
+		i, isInt = int64(v), true
+	case int64:
+		i, isInt = v, true
+	case uint32:
+		u, isUint = uint64(v), true
+	case uint64:
+		u, isUint = v, true
+	case float32:
+		f, isFloat = float64(v), true
+	case float64:
+		f, isFloat = v, true
+	}
+	if isUint && u <= math.MaxInt64 {
+		i, isInt = int64(u), true
+	}
+	if isInt && i >= 0 {
+		u, isUint = uint64(i), true
+	}
+	if isFloat && f == math.Trunc(f) && f >= math.MinInt64 && f < math.MaxInt64 {
+		i, isInt = int64(f), true
+		if i >= 0 {
+			u, isUint = uint64(i), true
+		}
+	}
+
+	switch tfd.GetType() {
+	case descriptorpb.FieldDescriptorProto_TYPE_INT32,
+		descriptorpb.FieldDescriptorProto_TYPE_SINT32,
+		descriptorpb.FieldDescriptorProto_TYPE_SFIXED32:
+		if fd.GetType() == descriptorpb.FieldDescriptorProto_TYPE_BOOL || fd.GetType() == descriptorpb.FieldDescriptorProto_TYPE_STRING || fd.GetType() == descriptorpb.FieldDescriptorProto_TYPE_BYTES {
+			return cannot()
+		}
+		if !isInt || i < math.MinInt32 || i > math.MaxInt32 {
+			return doesNotFit()
+		}
+		return int32(i), ""
+	case descriptorpb.FieldDescriptorProto_TYPE_INT64,
+		descriptorpb.FieldDescriptorProto_TYPE_SINT64,
+		descriptorpb.FieldDescriptorProto_TYPE_SFIXED64:
+		if fd.GetType() == descriptorpb.FieldDescriptorProto_TYPE_BOOL || fd.GetType() == descriptorpb.FieldDescriptorProto_TYPE_STRING || fd.GetType() == descriptorpb.FieldDescriptorProto_TYPE_BYTES {
+			return cannot()
+		}
+		if !isInt {
+			return doesNotFit()
+		}
+		return i, ""
+	case descriptorpb.FieldDescriptorProto_TYPE_UINT32,
+		descriptorpb.FieldDescriptorProto_TYPE_FIXED32:
+		if fd.GetType() == descriptorpb.FieldDescriptorProto_TYPE_BOOL || fd.GetType() == descriptorpb.FieldDescriptorProto_TYPE_STRING || fd.GetType() == descriptorpb.FieldDescriptorProto_TYPE_BYTES {
+			return cannot()
+		}
+		if !isUint || u > math.MaxUint32 {
+			return doesNotFit()
+		}
+		return uint32(u), ""
+	case descriptorpb.FieldDescriptorProto_TYPE_UINT64,
+		descriptorpb.FieldDescriptorProto_TYPE_FIXED64:
+		if fd.GetType() == descriptorpb.FieldDescriptorProto_TYPE_BOOL || fd.GetType() == descriptorpb.FieldDescriptorProto_TYPE_STRING || fd.GetType() == descriptorpb.FieldDescriptorProto_TYPE_BYTES {
+			return cannot()
+		}
+		if !isUint {
+			return doesNotFit()
+		}
+		return u, ""
+	case descriptorpb.FieldDescriptorProto_TYPE_FLOAT,
+		descriptorpb.FieldDescriptorProto_TYPE_DOUBLE:
+		var res float64
+		switch {
+		case isFloat:
+			res = f
+		case isInt:
+			res = float64(i)
+			if int64(res) != i || math.Abs(res) > 1<<53 {
+				return doesNotFit()
+			}
+		case isUint:
+			res = float64(u)
+			if uint64(res) != u || res > 1<<53 {
+				return doesNotFit()
+			}
+		default:
+			return cannot()
+		}
+		if tfd.GetType() == descriptorpb.FieldDescriptorProto_TYPE_FLOAT {
+			if !math.IsNaN(res) && float64(float32(res)) != res {
+				return doesNotFit()
+			}
+			return float32(res), ""
+		}
+		return res, ""
+	case descriptorpb.FieldDescriptorProto_TYPE_BOOL:
+		return cannot()
+	case descriptorpb.FieldDescriptorProto_TYPE_STRING:
+		switch v := val.(type) {
+		case []byte:
+			if !utf8.Valid(v) {
+				return nil, "bytes are not valid UTF-8"
+			}
+			return string(v), ""
+		case int32:
+			if fd.GetEnumType() == nil {
+				return cannot()
+			}
+			name, ok := mc.enumValueName(fd.GetEnumType(), v)
+			if !ok {
+				return nil, fmt.Sprintf("enum %s has no value with number %d", fd.GetEnumType().GetFullyQualifiedName(), v)
+			}
+			return name, ""
+		}
+		return cannot()
+	case descriptorpb.FieldDescriptorProto_TYPE_BYTES:
+		if s, ok := val.(string); ok {
+			return []byte(s), ""
+		}
+		return cannot()
+	case descriptorpb.FieldDescriptorProto_TYPE_ENUM:
+		ed := tfd.GetEnumType()
+		switch v := val.(type) {
+		case string:
+			if ev := ed.FindValueByName(v); ev != nil {
+				return ev.GetNumber(), ""
+			}
+			return nil, fmt.Sprintf("enum %s has no value named %q", ed.GetFullyQualifiedName(), v)
+		case bool, []byte:
+			return cannot()
+		}
+		if fd.GetEnumType() != nil {
+			// map enum values by name
+			name, ok := mc.enumValueName(fd.GetEnumType(), val.(int32))
+			if !ok {
+				if ed.GetFile().IsProto3() {
+					// open enums can hold unknown values
+					return val, ""
+				}
+				return nil, fmt.Sprintf("enum %s has no value with number %d", fd.GetEnumType().GetFullyQualifiedName(), val)
+			}
+			if ev := ed.FindValueByName(name); ev != nil {
+				return ev.GetNumber(), ""
+			}
+			return nil, fmt.Sprintf("enum %s has no value named %s", ed.GetFullyQualifiedName(), name)
+		}
+		if !isInt || i < math.MinInt32 || i > math.MaxInt32 {
+			return doesNotFit()
+		}
+		if ed.FindValueByNumber(int32(i)) == nil && !ed.GetFile().IsProto3() {
+			return nil, fmt.Sprintf("enum %s has no value with number %d", ed.GetFullyQualifiedName(), i)
+		}
+		return int32(i), ""
+	default:
+		return cannot()
+	}
+}
+
+// enumValueName returns the name of the given enum value, as re-mapped by the
+// migration's rules.
+func (mc *migrationContext) enumValueName(ed *desc.EnumDescriptor, num int32) (string, bool) {
+	ev := ed.FindValueByNumber(num)
+	if ev == nil {
+		return "", false
+	}
+	if names, ok := mc.mg.EnumValues[ed.GetFullyQualifiedName()]; ok {
+		if name, ok := names[ev.GetName()]; ok {
+			return name, true
+		}
+	}
+	return ev.GetName(), true
+}
@@ -0,0 +1,321 @@
+package dynamic
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/golang/protobuf/proto"
+	"google.golang.org/protobuf/types/descriptorpb"
+
+	"github.com/jhump/protoreflect/desc"
+	"github.com/jhump/protoreflect/internal/testutil"
+)
+
+func migField(name string, num int32, t descriptorpb.FieldDescriptorProto_Type, typeName string) *descriptorpb.FieldDescriptorProto {
+	fld := &descriptorpb.FieldDescriptorProto{
+		Name:     proto.String(name),
+		Number:   proto.Int32(num),
+		Label:    descriptorpb.FieldDescriptorProto_LABEL_OPTIONAL.Enum(),
+		Type:     t.Enum(),
+		JsonName: proto.String(name),
+	}
+	if typeName != "" {
+		fld.TypeName = proto.String(typeName)
+	}
+	return fld
+}
+
+func migRepeated(fld *descriptorpb.FieldDescriptorProto) *descriptorpb.FieldDescriptorProto {
+	fld.Label = descriptorpb.FieldDescriptorProto_LABEL_REPEATED.Enum()
+	return fld
+}
+
+func migEnum(name string, values ...string) *descriptorpb.EnumDescriptorProto {
+	ed := &descriptorpb.EnumDescriptorProto{Name: proto.String(name)}
+	for i, v := range values {
+		ed.Value = append(ed.Value, &descriptorpb.EnumValueDescriptorProto{Name: proto.String(v), Number: proto.Int32(int32(i))})
+	}
+	return ed
+}
+
+func migMapEntry(name, valueType string) *descriptorpb.DescriptorProto {
+	return &descriptorpb.DescriptorProto{
+		Name: proto.String(name),
+		Field: []*descriptorpb.FieldDescriptorProto{
+			migField("key", 1, descriptorpb.FieldDescriptorProto_TYPE_STRING, ""),
+			migField("value", 2, descriptorpb.FieldDescriptorProto_TYPE_MESSAGE, valueType),
+		},
+		Options: &descriptorpb.MessageOptions{MapEntry: proto.Bool(true)},
+	}
+}
+
+// migrationSchemas returns two versions of an Event message, the second of
+// which renames, moves, and changes the types of many of the first's fields.
+func migrationSchemas(t *testing.T) (v1, v2 *desc.MessageDescriptor) {
+	const (
+		tInt32   = descriptorpb.FieldDescriptorProto_TYPE_INT32
+		tInt64   = descriptorpb.FieldDescriptorProto_TYPE_INT64
+		tString  = descriptorpb.FieldDescriptorProto_TYPE_STRING
+		tDouble  = descriptorpb.FieldDescriptorProto_TYPE_DOUBLE
+		tFloat   = descriptorpb.FieldDescriptorProto_TYPE_FLOAT
+		tEnum    = descriptorpb.FieldDescriptorProto_TYPE_ENUM
+		tMessage = descriptorpb.FieldDescriptorProto_TYPE_MESSAGE
+	)
+	wrappers, err := desc.LoadFileDescriptor("google/protobuf/wrappers.proto")
+	testutil.Ok(t, err)
+
+	fd1, err := desc.CreateFileDescriptor(&descriptorpb.FileDescriptorProto{
+		Name:     proto.String("migration/v1.proto"),
+		Package:  proto.String("mig.v1"),
+		Syntax:   proto.String("proto3"),
+		EnumType: []*descriptorpb.EnumDescriptorProto{migEnum("Status", "STATUS_UNKNOWN", "ACTIVE", "DISABLED")},
+		MessageType: []*descriptorpb.DescriptorProto{
+			{
+				Name: proto.String("Address"),
+				Field: []*descriptorpb.FieldDescriptorProto{
+					migField("zip", 1, tString, ""),
+					migField("city", 2, tString, ""),
+				},
+			},
+			{
+				Name: proto.String("Item"),
+				Field: []*descriptorpb.FieldDescriptorProto{
+					migField("name", 1, tString, ""),
+					migField("qty", 2, tInt32, ""),
+				},
+			},
+			{
+				Name: proto.String("Event"),
+				Field: []*descriptorpb.FieldDescriptorProto{
+					migField("id", 1, tInt32, ""),
+					migField("user", 2, tString, ""),
+					migField("status", 3, tEnum, ".mig.v1.Status"),
+					migField("address", 4, tMessage, ".mig.v1.Address"),
+					migRepeated(migField("items", 5, tMessage, ".mig.v1.Item")),
+					migField("legacy", 6, tString, ""),
+					migField("count", 7, tInt32, ""),
+					migField("kind", 8, tString, ""),
+					migRepeated(migField("by_name", 9, tMessage, ".mig.v1.Event.ByNameEntry")),
+					migField("ratio", 10, tDouble, ""),
+					migField("big", 11, tInt64, ""),
+					migField("obsolete", 15, tString, ""),
+					migField("internal", 16, tString, ""),
+				},
+				NestedType: []*descriptorpb.DescriptorProto{migMapEntry("ByNameEntry", ".mig.v1.Item")},
+			},
+		},
+	})
+	testutil.Ok(t, err)
+
+	fd2, err := desc.CreateFileDescriptor(&descriptorpb.FileDescriptorProto{
+		Name:       proto.String("migration/v2.proto"),
+		Package:    proto.String("mig.v2"),
+		Syntax:     proto.String("proto3"),
+		Dependency: []string{"google/protobuf/wrappers.proto"},
+		EnumType: []*descriptorpb.EnumDescriptorProto{
+			migEnum("State", "STATE_UNKNOWN", "ENABLED", "DISABLED"),
+			migEnum("Kind", "KIND_UNKNOWN", "CLICK", "VIEW"),
+		},
+		MessageType: []*descriptorpb.DescriptorProto{
+			{
+				Name: proto.String("Location"),
+				Field: []*descriptorpb.FieldDescriptorProto{
+					migField("postal_code", 1, tString, ""),
+				},
+			},
+			{
+				Name: proto.String("Entry"),
+				Field: []*descriptorpb.FieldDescriptorProto{
+					migField("title", 1, tString, ""),
+					migField("qty", 2, tInt64, ""),
+				},
+			},
+			{
+				Name: proto.String("Event"),
+				Field: []*descriptorpb.FieldDescriptorProto{
+					migField("id", 1, tInt64, ""),
+					migField("user_name", 2, tString, ""),
+					migField("state", 3, tEnum, ".mig.v2.State"),
+					migField("location", 4, tMessage, ".mig.v2.Location"),
+					migRepeated(migField("entries", 5, tMessage, ".mig.v2.Entry")),
+					migField("count", 7, tMessage, ".google.protobuf.Int64Value"),
+					migField("kind", 8, tEnum, ".mig.v2.Kind"),
+					migRepeated(migField("by_name", 9, tMessage, ".mig.v2.Event.ByNameEntry")),
+					migField("ratio", 10, tFloat, ""),
+					migField("big", 11, tInt32, ""),
+					migField("city", 13, tString, ""),
+					migField("upper", 14, tString, ""),
+				},
+				NestedType: []*descriptorpb.DescriptorProto{migMapEntry("ByNameEntry", ".mig.v2.Entry")},
+			},
+		},
+	}, wrappers)
+	testutil.Ok(t, err)
+
+	return fd1.FindMessage("mig.v1.Event"), fd2.FindMessage("mig.v2.Event")
+}
+
+func TestMigration(t *testing.T) {
+	v1, v2 := migrationSchemas(t)
+	src := NewMessage(v1)
+	testutil.Ok(t, src.UnmarshalJSON([]byte(`{
+		"id": 42,
+		"user": "alice",
+		"status": "ACTIVE",
+		"address": {"zip": "12345", "city": "Springfield"},
+		"items": [{"name": "apple", "qty": 3}, {"name": "pear"}],
+		"legacy": "shout",
+		"count": 7,
+		"kind": "VIEW",
+		"by_name": {"x": {"name": "fig", "qty": 1}},
+		"ratio": 0.1,
+		"big": "1099511627776",
+		"obsolete": "gone",
+		"internal": "secret"
+	}`)))
+
+	mg := Migration{
+		Target: v2,
+		Paths: map[string]string{
+			"user":         "user_name",
+			"address":      "location",
+			"address.zip":  "location.postal_code",
+			"address.city": "city",
+			"items":        "entries",
+			"items.name":   "entries.title",
+			"by_name.name": "by_name.title",
+			"legacy":       "upper",
+			"internal":     "",
+		},
+		FieldNumbers: map[string]map[int32]int32{
+			"mig.v1.Event": {3: 3},
+		},
+		EnumValues: map[string]map[string]string{
+			"mig.v1.Status": {"ACTIVE": "ENABLED", "STATUS_UNKNOWN": "STATE_UNKNOWN"},
+		},
+		Funcs: map[string]MigrationFunc{
+			"legacy": func(val interface{}, target *desc.FieldDescriptor) (interface{}, error) {
+				return strings.ToUpper(val.(string)), nil
+			},
+		},
+	}
+	dst, report, err := mg.Migrate(src)
+	testutil.Ok(t, err)
+
+	expected := NewMessage(v2)
+	testutil.Ok(t, expected.UnmarshalJSON([]byte(`{
+		"id": "42",
+		"user_name": "alice",
+		"state": "ENABLED",
+		"location": {"postal_code": "12345"},
+		"city": "Springfield",
+		"entries": [{"title": "apple", "qty": "3"}, {"title": "pear"}],
+		"upper": "SHOUT",
+		"count": "7",
+		"kind": "VIEW",
+		"by_name": {"x": {"title": "fig", "qty": "1"}}
+	}`)))
+	testutil.Ceq(t, expected, dst, eqdm)
+
+	var dropped []string
+	for _, d := range report.Dropped {
+		dropped = append(dropped, fmt.Sprintf("%s: %s", d.Path, d.Reason))
+	}
+	testutil.Eq(t, []string{
+		"ratio: value 0.1 cannot be represented as float",
+		"big: value 1099511627776 cannot be represented as int32",
+		"obsolete: no corresponding field in mig.v2.Event",
+	}, dropped)
+}
+
+func TestMigration_Conversions(t *testing.T) {
+	v1, v2 := migrationSchemas(t)
+	mg := Migration{Target: v2}
+	testCases := []struct {
+		src, dst string
+		dropped  string
+	}{
+		{src: `{"id": -5}`, dst: `{"id": "-5"}`},
+		{src: `{"kind": "bogus"}`, dst: `{}`, dropped: `kind: enum mig.v2.Kind has no value named "bogus"`},
+		{src: `{"ratio": 1.5}`, dst: `{"ratio": 1.5}`},
+		{src: `{"big": "-12"}`, dst: `{"big": -12}`},
+		{src: `{"status": "ACTIVE"}`, dst: `{}`, dropped: "status: no corresponding field in mig.v2.Event"},
+		{src: `{"items": [{"qty": 2}]}`, dst: `{}`, dropped: "items: no corresponding field in mig.v2.Event"},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.src, func(t *testing.T) {
+			src := NewMessage(v1)
+			testutil.Ok(t, src.UnmarshalJSON([]byte(tc.src)))
+			expected := NewMessage(v2)
+			testutil.Ok(t, expected.UnmarshalJSON([]byte(tc.dst)))
+
+			dst, report, err := mg.Migrate(src)
+			testutil.Ok(t, err)
+			testutil.Ceq(t, expected, dst, eqdm)
+			if tc.dropped == "" {
+				testutil.Eq(t, 0, len(report.Dropped), "unexpected dropped values: %v", report.Dropped)
+			} else {
+				testutil.Eq(t, 1, len(report.Dropped), "unexpected dropped values: %v", report.Dropped)
+				testutil.Eq(t, tc.dropped, report.Dropped[0].Path+": "+report.Dropped[0].Reason)
+			}
+		})
+	}
+}
+
+func TestMigration_WrapperToScalar(t *testing.T) {
+	v1, v2 := migrationSchemas(t)
+	// migrate backwards, from wrapper to scalar and from int64 to int32
+	src := NewMessage(v2)
+	testutil.Ok(t, src.UnmarshalJSON([]byte(`{"count": "12", "id": "3", "kind": "CLICK"}`)))
+	dst, report, err := (&Migration{Target: v1}).Migrate(src)
+	testutil.Ok(t, err)
+	testutil.Eq(t, 0, len(report.Dropped))
+
+	expected := NewMessage(v1)
+	testutil.Ok(t, expected.UnmarshalJSON([]byte(`{"count": 12, "id": 3, "kind": "CLICK"}`)))
+	testutil.Ceq(t, expected, dst, eqdm)
+}
+
+func TestMigration_InvalidRules(t *testing.T) {
+	v1, v2 := migrationSchemas(t)
+	src := NewMessage(v1)
+	testutil.Ok(t, src.UnmarshalJSON([]byte(`{"items": [{"name": "apple"}]}`)))
+
+	testCases := []struct {
+		name    string
+		mg      Migration
+		errText string
+	}{
+		{
+			name:    "unknown source field",
+			mg:      Migration{Target: v2, Paths: map[string]string{"nope": "id"}},
+			errText: `invalid source path "nope"`,
+		},
+		{
+			name:    "unknown target field",
+			mg:      Migration{Target: v2, Paths: map[string]string{"user": "nope"}},
+			errText: `invalid target path "nope"`,
+		},
+		{
+			name:    "move out of repeated element",
+			mg:      Migration{Target: v2, Paths: map[string]string{"items": "entries", "items.name": "user_name"}},
+			errText: "target must be inside entries",
+		},
+		{
+			name: "custom function error",
+			mg: Migration{Target: v2, Paths: map[string]string{"items": "entries"}, Funcs: map[string]MigrationFunc{
+				"items.name": func(interface{}, *desc.FieldDescriptor) (interface{}, error) {
+					return nil, fmt.Errorf("oops")
+				},
+			}},
+			errText: "items[0].name: oops",
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			_, _, err := tc.mg.Migrate(src)
+			testutil.Require(t, err != nil && strings.Contains(err.Error(), tc.errText), "unexpected error: %v", err)
+		})
+	}
+}
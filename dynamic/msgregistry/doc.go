@@ -7,4 +7,15 @@
 // for using these dynamically loaded schemas using dynamic messages. The
 // registry also exposes related functionality for inter-op between descriptors
 // and the proto well-known types that model APIs and types.
+//
+// Type definitions are retrieved using a TypeFetcher. Fetchers are provided
+// that download them over HTTP as well as fetchers that serve them from local
+// sources, like protoset files, so that Any messages can be resolved without
+// network access. A TypeServer serves the types in a registry over HTTP, for
+// use with HttpTypeFetcher.
+//
+// The package also supports schema registries, like those commonly used with
+// Kafka, which identify the schema of each payload with a numeric ID. The
+// SchemaResolver loads and caches the descriptors for schema IDs from a
+// SchemaSource and decodes payloads that use the registry's wire format.
 package msgregistry
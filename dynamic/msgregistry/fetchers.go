@@ -6,10 +6,17 @@ import (
 	"io"
 	"net/http"
 	"net/url"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
 	"sync"
 
 	"github.com/golang/protobuf/proto"
+	"google.golang.org/protobuf/types/descriptorpb"
 	"google.golang.org/protobuf/types/known/typepb"
+
+	"github.com/jhump/protoreflect/desc"
 )
 
 // TypeFetcher is a simple operation that retrieves a type definition for a given type URL.
@@ -96,7 +103,10 @@ func (c *protoCache) getOrLoad(key string, loader func() (proto.Message, error))
 // download type definitions. The given szLimit is the maximum response size accepted. If
 // used from multiple goroutines (like when a type's dependency graph is resolved in
 // parallel), this resolver limits the number of parallel queries/downloads to the given
-// parLimit.
+// parLimit. Results are cached indefinitely.
+//
+// Use HttpTypeFetcherOptions for more control, such as timeouts, retries, and
+// revalidation of cached results.
 func HttpTypeFetcher(transport http.RoundTripper, szLimit, parLimit int) TypeFetcher {
 	sem := semaphore{count: parLimit, permits: parLimit}
 	return CachingTypeFetcher(func(typeUrl string, enum bool) (proto.Message, error) {
@@ -109,7 +119,13 @@ func HttpTypeFetcher(transport http.RoundTripper, szLimit, parLimit int) TypeFet
 			return nil, err
 		}
 
-		resp, err := transport.RoundTrip(&http.Request{URL: u})
+		req := &http.Request{
+			Method: http.MethodGet,
+			URL:    u,
+			Header: http.Header{},
+			Host:   u.Host,
+		}
+		resp, err := transport.RoundTrip(req)
 		if err != nil {
 			return nil, err
 		}
@@ -161,6 +177,173 @@ func HttpTypeFetcher(transport http.RoundTripper, szLimit, parLimit int) TypeFet
 	})
 }
 
+// FileTypeFetcher returns a TypeFetcher that serves type definitions for the
+// message and enum types in the given files and in their transitive
+// dependencies, without any network access. The host and path of a requested
+// URL are ignored: the type is identified by the last path element, which must
+// be its fully-qualified name.
+//
+// Types are converted using the same logic as MessageRegistry.MessageAsPType
+// and EnumAsPType. Type URLs for fields with message or enum types use the
+// given base URL, so that a registry resolves them using the same source. If
+// baseUrl is empty, "type.googleapis.com" is used. If more than one file
+// defines the same type name, the first one wins.
+func FileTypeFetcher(baseUrl string, files ...*desc.FileDescriptor) TypeFetcher {
+	mr := &MessageRegistry{}
+	if baseUrl != "" {
+		mr.WithDefaultBaseUrl(baseUrl)
+	}
+	types := map[string]desc.Descriptor{}
+	seen := map[string]struct{}{}
+	for _, fd := range files {
+		addFileTypes(fd, types, seen)
+	}
+	return func(typeUrl string, enum bool) (proto.Message, error) {
+		d := types[typeName(typeUrl)]
+		switch d := d.(type) {
+		case *desc.MessageDescriptor:
+			if enum {
+				return nil, &ErrUnexpectedType{URL: typeUrl, ShouldBeEnum: true}
+			}
+			return mr.MessageAsPType(d), nil
+		case *desc.EnumDescriptor:
+			if !enum {
+				return nil, &ErrUnexpectedType{URL: typeUrl}
+			}
+			return mr.EnumAsPType(d), nil
+		default:
+			return nil, fmt.Errorf("type for URL %v not found", typeUrl)
+		}
+	}
+}
+
+func addFileTypes(fd *desc.FileDescriptor, types map[string]desc.Descriptor, seen map[string]struct{}) {
+	if _, ok := seen[fd.GetName()]; ok {
+		return
+	}
+	seen[fd.GetName()] = struct{}{}
+	for _, ed := range fd.GetEnumTypes() {
+		addType(ed, types)
+	}
+	for _, md := range fd.GetMessageTypes() {
+		addMessageTypes(md, types)
+	}
+	for _, dep := range fd.GetDependencies() {
+		addFileTypes(dep, types, seen)
+	}
+}
+
+func addMessageTypes(md *desc.MessageDescriptor, types map[string]desc.Descriptor) {
+	addType(md, types)
+	for _, ed := range md.GetNestedEnumTypes() {
+		addType(ed, types)
+	}
+	for _, nmd := range md.GetNestedMessageTypes() {
+		addMessageTypes(nmd, types)
+	}
+}
+
+func addType(d desc.Descriptor, types map[string]desc.Descriptor) {
+	if _, ok := types[d.GetFullyQualifiedName()]; !ok {
+		types[d.GetFullyQualifiedName()] = d
+	}
+}
+
+// FileDescriptorSetTypeFetcher returns a TypeFetcher that serves type
+// definitions for all types in the given file descriptor set. The set must be
+// self-contained: it must include all dependencies of the files therein. See
+// FileTypeFetcher for more details.
+func FileDescriptorSetTypeFetcher(baseUrl string, fds *descriptorpb.FileDescriptorSet) (TypeFetcher, error) {
+	files, err := desc.CreateFileDescriptorsFromSet(fds)
+	if err != nil {
+		return nil, err
+	}
+	return FileTypeFetcher(baseUrl, sortedFiles(files)...), nil
+}
+
+// ProtosetDirTypeFetcher returns a TypeFetcher that serves type definitions for
+// all types in the ".protoset" files in the given directory. Each such file
+// must contain a serialized, self-contained FileDescriptorSet, like those
+// produced by protoc's --descriptor_set_out option with --include_imports.
+// All files are loaded eagerly, when this function is called, so that any
+// errors are reported immediately. Files are processed in lexical order. See
+// FileTypeFetcher for more details.
+func ProtosetDirTypeFetcher(baseUrl, dir string) (TypeFetcher, error) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+	var files []*desc.FileDescriptor
+	for _, entry := range entries {
+		if entry.IsDir() || filepath.Ext(entry.Name()) != ".protoset" {
+			continue
+		}
+		fileName := filepath.Join(dir, entry.Name())
+		data, err := os.ReadFile(fileName)
+		if err != nil {
+			return nil, err
+		}
+		var fds descriptorpb.FileDescriptorSet
+		if err := proto.Unmarshal(data, &fds); err != nil {
+			return nil, fmt.Errorf("failed to parse %s: %v", fileName, err)
+		}
+		fdsFiles, err := desc.CreateFileDescriptorsFromSet(&fds)
+		if err != nil {
+			return nil, fmt.Errorf("failed to process %s: %v", fileName, err)
+		}
+		files = append(files, sortedFiles(fdsFiles)...)
+	}
+	return FileTypeFetcher(baseUrl, files...), nil
+}
+
+func sortedFiles(files map[string]*desc.FileDescriptor) []*desc.FileDescriptor {
+	names := make([]string, 0, len(files))
+	for name := range files {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	sorted := make([]*desc.FileDescriptor, len(names))
+	for i, name := range names {
+		sorted[i] = files[name]
+	}
+	return sorted
+}
+
+// PrefixTypeFetcher returns a TypeFetcher that routes each query to one of the
+// given fetchers, based on the URL. The keys of the given map are URL prefixes,
+// like "type.example.com" or "https://types.example.com/v1". A URL matches a
+// prefix if it starts with the prefix followed by a slash. If multiple prefixes
+// match, the longest one is used. A missing scheme is treated as "https://",
+// as is done when resolving URLs. The empty prefix matches all URLs, so it can
+// be used to provide a fallback for URLs that match no other prefix. If no
+// prefix matches, the fetcher returns an error.
+func PrefixTypeFetcher(fetchers map[string]TypeFetcher) TypeFetcher {
+	type route struct {
+		prefix  string
+		fetcher TypeFetcher
+	}
+	routes := make([]route, 0, len(fetchers))
+	for prefix, fetcher := range fetchers {
+		if prefix != "" {
+			prefix = stripTrailingSlash(ensureScheme(prefix)) + "/"
+		}
+		routes = append(routes, route{prefix: prefix, fetcher: fetcher})
+	}
+	// longest prefixes first
+	sort.Slice(routes, func(i, j int) bool {
+		return len(routes[i].prefix) > len(routes[j].prefix)
+	})
+	return func(typeUrl string, enum bool) (proto.Message, error) {
+		u := ensureScheme(typeUrl)
+		for _, r := range routes {
+			if strings.HasPrefix(u, r.prefix) {
+				return r.fetcher(typeUrl, enum)
+			}
+		}
+		return nil, fmt.Errorf("no type fetcher for URL %v", typeUrl)
+	}
+}
+
 var bufferPool = sync.Pool{New: func() interface{} {
 	buf := make([]byte, 8192)
 	return &buf
@@ -7,6 +7,8 @@ import (
 	"fmt"
 	"io/ioutil"
 	"net/http"
+	"os"
+	"path/filepath"
 	"strings"
 	"sync"
 	"sync/atomic"
@@ -14,9 +16,13 @@ import (
 	"time"
 
 	"github.com/golang/protobuf/proto"
+	"google.golang.org/protobuf/types/known/anypb"
 	"google.golang.org/protobuf/types/known/sourcecontextpb"
 	"google.golang.org/protobuf/types/known/typepb"
 
+	"github.com/jhump/protoreflect/desc"
+	"github.com/jhump/protoreflect/dynamic"
+	"github.com/jhump/protoreflect/internal/testprotos"
 	"github.com/jhump/protoreflect/internal/testutil"
 )
 
@@ -199,6 +205,145 @@ func TestHttpTypeFetcher_SizeLimits(t *testing.T) {
 	// without size in the name, no content-length (e.g. streaming response)
 	_, err = fetcher("blah.blah.blah/fee.fi.fo.Fum", false)
 	testutil.Require(t, err != nil && strings.Contains(err.Error(), "is larger than limit of 32"))
+
+	// unlike HttpTypeFetcherOptions, a zero limit does not mean the default
+	fetcher = HttpTypeFetcher(trt, 0, 10)
+	_, err = fetcher("blah.blah.blah/fee.fi.fo.Fum", false)
+	testutil.Require(t, err != nil && strings.Contains(err.Error(), "is larger than limit of 0"))
+}
+
+func TestFileTypeFetcher(t *testing.T) {
+	fd, err := desc.LoadFileDescriptor("desc_test_proto3.proto")
+	testutil.Ok(t, err)
+	fetcher := FileTypeFetcher("types.example.com", fd)
+
+	// the host in the URL is ignored
+	pm, err := fetcher("https://foo.bar/testprotos.TestRequest", false)
+	testutil.Ok(t, err)
+	typ := pm.(*typepb.Type)
+	testutil.Eq(t, "testprotos.TestRequest", typ.Name)
+	testutil.Eq(t, "desc_test_proto3.proto", typ.SourceContext.FileName)
+	// type URLs for fields use the given base URL
+	for _, f := range typ.Fields {
+		if f.Name == "baz" {
+			testutil.Eq(t, "types.example.com/testprotos.TestMessage", f.TypeUrl)
+		}
+	}
+
+	// types in dependencies are also available
+	pm, err = fetcher("https://foo.bar/testprotos.TestMessage.NestedEnum", true)
+	testutil.Ok(t, err)
+	testutil.Eq(t, "testprotos.TestMessage.NestedEnum", pm.(*typepb.Enum).Name)
+
+	_, err = fetcher("https://foo.bar/testprotos.TestMessage.NestedEnum", false)
+	_, ok := err.(*ErrUnexpectedType)
+	testutil.Require(t, ok, "unexpected error: %v", err)
+	_, err = fetcher("https://foo.bar/testprotos.TestRequest", true)
+	_, ok = err.(*ErrUnexpectedType)
+	testutil.Require(t, ok, "unexpected error: %v", err)
+	_, err = fetcher("https://foo.bar/testprotos.DoesNotExist", false)
+	testutil.Nok(t, err)
+}
+
+func TestFileTypeFetcher_ResolveAny(t *testing.T) {
+	fd, err := desc.LoadFileDescriptor("desc_test_proto3.proto")
+	testutil.Ok(t, err)
+	mr := (&MessageRegistry{}).WithFetcher(FileTypeFetcher("", fd))
+
+	msg := &testprotos.TestRequest{
+		Foo:   []testprotos.Proto3Enum{testprotos.Proto3Enum_VALUE2},
+		Bar:   "bar",
+		Baz:   &testprotos.TestMessage{Ne: []testprotos.TestMessage_NestedEnum{testprotos.TestMessage_VALUE2}},
+		Flags: map[string]bool{"a": true},
+	}
+	a, err := anypb.New(msg)
+	testutil.Ok(t, err)
+	pm, err := mr.UnmarshalAny(a)
+	testutil.Ok(t, err)
+	dm := pm.(*dynamic.Message)
+	testutil.Eq(t, "testprotos.TestRequest", dm.GetMessageDescriptor().GetFullyQualifiedName())
+	testutil.Require(t, dynamic.MessagesEqual(msg, dm), "%v != %v", msg, dm)
+}
+
+func TestProtosetDirTypeFetcher(t *testing.T) {
+	dir := t.TempDir()
+	for _, name := range []string{"desc_test1.proto", "desc_test_proto3.proto"} {
+		fd, err := desc.LoadFileDescriptor(name)
+		testutil.Ok(t, err)
+		data, err := proto.Marshal(desc.ToFileDescriptorSet(fd))
+		testutil.Ok(t, err)
+		testutil.Ok(t, os.WriteFile(filepath.Join(dir, strings.TrimSuffix(name, ".proto")+".protoset"), data, 0644))
+	}
+	// files with other extensions are ignored
+	testutil.Ok(t, os.WriteFile(filepath.Join(dir, "README"), []byte("not a protoset"), 0644))
+
+	fetcher, err := ProtosetDirTypeFetcher("", dir)
+	testutil.Ok(t, err)
+	pm, err := fetcher("type.googleapis.com/testprotos.AnotherTestMessage.RockNRoll", false)
+	testutil.Ok(t, err)
+	testutil.Eq(t, "testprotos.AnotherTestMessage.RockNRoll", pm.(*typepb.Type).Name)
+	pm, err = fetcher("type.googleapis.com/testprotos.TestResponse", false)
+	testutil.Ok(t, err)
+	testutil.Eq(t, "testprotos.TestResponse", pm.(*typepb.Type).Name)
+
+	// the set must be self-contained
+	fd, err := desc.LoadFileDescriptor("desc_test_proto3.proto")
+	testutil.Ok(t, err)
+	fds := desc.ToFileDescriptorSet(fd)
+	fds.File = fds.File[len(fds.File)-1:]
+	_, err = FileDescriptorSetTypeFetcher("", fds)
+	testutil.Nok(t, err)
+	data, err := proto.Marshal(fds)
+	testutil.Ok(t, err)
+	testutil.Ok(t, os.WriteFile(filepath.Join(dir, "broken.protoset"), data, 0644))
+	_, err = ProtosetDirTypeFetcher("", dir)
+	testutil.Nok(t, err)
+
+	_, err = ProtosetDirTypeFetcher("", filepath.Join(dir, "does-not-exist"))
+	testutil.Nok(t, err)
+}
+
+func TestPrefixTypeFetcher(t *testing.T) {
+	var calls []string
+	named := func(name string) TypeFetcher {
+		return func(url string, enum bool) (proto.Message, error) {
+			calls = append(calls, name)
+			return testFetcher(url, enum)
+		}
+	}
+	fetcher := PrefixTypeFetcher(map[string]TypeFetcher{
+		"types.example.com":              named("a"),
+		"https://types.example.com/v2/":  named("b"),
+		"http://types.example.com":       named("c"),
+		"types.example.com.evil.example": named("d"),
+	})
+	for _, url := range []string{
+		"types.example.com/foo.Bar",
+		"https://types.example.com/v2/foo.Bar",
+		"http://types.example.com/foo.Bar",
+		"https://types.example.com/v1/foo.Bar",
+		"types.example.com.evil.example/foo.Bar",
+	} {
+		pm, err := fetcher(url, false)
+		testutil.Ok(t, err)
+		testutil.Eq(t, "foo.Bar", pm.(*typepb.Type).Name)
+	}
+	testutil.Eq(t, []string{"a", "b", "c", "a", "d"}, calls)
+
+	_, err := fetcher("types.example.org/foo.Bar", false)
+	testutil.Nok(t, err)
+
+	// empty prefix is a fallback
+	calls = nil
+	fetcher = PrefixTypeFetcher(map[string]TypeFetcher{
+		"types.example.com": named("a"),
+		"":                  named("default"),
+	})
+	_, err = fetcher("types.example.org/foo.Bar", false)
+	testutil.Ok(t, err)
+	_, err = fetcher("types.example.com/foo.Bar", false)
+	testutil.Ok(t, err)
+	testutil.Eq(t, []string{"default", "a"}, calls)
 }
 
 type testRoundTripper struct {
@@ -287,3 +432,30 @@ func testFetcher(url string, enum bool) (proto.Message, error) {
 		}, nil
 	}
 }
+
+func TestFileTypeFetcher_ExpandAny(t *testing.T) {
+	fd, err := desc.LoadFileDescriptor("desc_test_proto3.proto")
+	testutil.Ok(t, err)
+	mr := (&MessageRegistry{}).WithFetcher(FileTypeFetcher("types.example.com", fd))
+
+	a, err := anypb.New(&testprotos.TestRequest{Bar: "bar"})
+	testutil.Ok(t, err)
+	a.TypeUrl = "types.example.com/testprotos.TestRequest"
+	dm, err := dynamic.AsDynamicMessage(&testprotos.TestWellKnownTypes{Extras: []*anypb.Any{a}})
+	testutil.Ok(t, err)
+
+	anyOpts := &dynamic.AnyOptions{Resolver: mr}
+	js, err := (&dynamic.JSONMarshaler{Any: anyOpts}).Marshal(dm)
+	testutil.Ok(t, err)
+	testutil.Eq(t, `{"extras":[{"@type":"types.example.com/testprotos.TestRequest","bar":"bar"}]}`, string(js))
+	dm2 := dynamic.NewMessage(dm.GetMessageDescriptor())
+	testutil.Ok(t, (&dynamic.JSONUnmarshaler{Any: anyOpts}).Unmarshal(js, dm2))
+	testutil.Require(t, dynamic.MessagesEqual(dm, dm2), "%v != %v", dm, dm2)
+
+	txt, err := (&dynamic.TextMarshaler{Any: anyOpts}).Marshal(dm)
+	testutil.Ok(t, err)
+	testutil.Eq(t, `extras:<[types.example.com/testprotos.TestRequest]:<bar:"bar">>`, string(txt))
+	dm2.Reset()
+	testutil.Ok(t, (&dynamic.TextUnmarshaler{Any: anyOpts}).Unmarshal(txt, dm2))
+	testutil.Require(t, dynamic.MessagesEqual(dm, dm2), "%v != %v", dm, dm2)
+}
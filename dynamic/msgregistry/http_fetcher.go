@@ -0,0 +1,380 @@
+package msgregistry
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"mime"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/golang/protobuf/jsonpb"
+	"github.com/golang/protobuf/proto"
+	"google.golang.org/protobuf/types/known/typepb"
+)
+
+// DefaultTypeSizeLimit is the maximum size of a downloaded type definition
+// used by HttpTypeFetcherOptions when no size limit is configured.
+const DefaultTypeSizeLimit = 1 << 20
+
+// HttpTypeFetcherOptions describes how a TypeFetcher downloads type definitions
+// over HTTP. The zero value is valid and uses http.DefaultTransport, with no
+// timeouts, retries, caching, or concurrency limits.
+//
+// A type URL is downloaded by issuing a GET request to that URL, using
+// "https://" as the scheme if the URL has none. A successful response must
+// have a 200 status code, and its body must be a google.protobuf.Type (for
+// message types) or a google.protobuf.Enum (for enum types), in either the
+// protobuf binary format or the protobuf JSON format, as indicated by the
+// Content-Type header of the response. TypeServer serves responses in this
+// form.
+type HttpTypeFetcherOptions struct {
+	// The transport used to issue requests. If nil, http.DefaultTransport is
+	// used.
+	Transport http.RoundTripper
+
+	// The context for all requests issued by the fetcher. Canceling this
+	// context aborts in-progress requests and causes subsequent queries to
+	// fail. If nil, context.Background() is used.
+	Context context.Context
+	// The maximum amount of time for a single request, including reading the
+	// response body. If zero, requests do not time out. Each retry gets its
+	// own timeout.
+	Timeout time.Duration
+
+	// The maximum size of a type definition. If the response body is larger,
+	// the query fails. If zero, DefaultTypeSizeLimit is used.
+	SizeLimit int
+
+	// The maximum number of requests that may be in progress at once. If
+	// zero, the number is not limited.
+	ConcurrencyLimit int
+	// The maximum number of requests to the same host that may be in progress
+	// at once. If zero, the number is not limited.
+	PerHostConcurrencyLimit int
+
+	// The maximum number of times a request is retried when the server
+	// responds with a 5xx status code. If zero, requests are not retried.
+	MaxRetries int
+	// The delay before the first retry. The delay doubles for each subsequent
+	// retry, up to MaxRetryBackoff. If zero, 100 milliseconds is used.
+	RetryBackoff time.Duration
+	// The maximum delay between retries. If zero, the delay is not capped.
+	MaxRetryBackoff time.Duration
+
+	// The content type to request from the server via the Accept header. This
+	// should be ContentTypeProtobuf or ContentTypeJSON. Regardless of this
+	// value, the response is decoded according to its Content-Type header. If
+	// empty, ContentTypeProtobuf is requested.
+	ContentType string
+
+	// A store for downloaded type definitions. If nil, nothing is cached and
+	// every query results in a request. If non-nil, cached definitions are
+	// used until they expire and are then revalidated with the server using a
+	// conditional request, based on the ETag and Last-Modified headers of the
+	// original response.
+	Cache TypeCache
+	// How long a cached definition is used without revalidating it with the
+	// server. If zero, the max-age in the Cache-Control header of the response
+	// is used. If the response has no max-age, cached definitions are always
+	// revalidated, which is still cheaper than downloading them again.
+	MaxAge time.Duration
+}
+
+// TypeFetcher returns a TypeFetcher that downloads type definitions as
+// described by these options. Unlike HttpTypeFetcher, the returned fetcher
+// does not cache results indefinitely. To avoid repeated requests, configure
+// a Cache and/or wrap the result with CachingTypeFetcher.
+func (opts HttpTypeFetcherOptions) TypeFetcher() TypeFetcher {
+	f := &httpTypeFetcher{opts: opts}
+	if f.opts.Transport == nil {
+		f.opts.Transport = http.DefaultTransport
+	}
+	if f.opts.Context == nil {
+		f.opts.Context = context.Background()
+	}
+	if f.opts.SizeLimit <= 0 {
+		f.opts.SizeLimit = DefaultTypeSizeLimit
+	}
+	if f.opts.RetryBackoff <= 0 {
+		f.opts.RetryBackoff = 100 * time.Millisecond
+	}
+	if f.opts.ContentType == "" {
+		f.opts.ContentType = ContentTypeProtobuf
+	}
+	if f.opts.ConcurrencyLimit > 0 {
+		f.sem = &semaphore{count: f.opts.ConcurrencyLimit, permits: f.opts.ConcurrencyLimit}
+	}
+	return f.fetch
+}
+
+// TypeCache stores downloaded type definitions, keyed by type URL. It must be
+// safe for concurrent use. Implementations may persist entries, so that they
+// can be revalidated across process restarts.
+type TypeCache interface {
+	// Get returns the cached entry for the given URL or false if there is no
+	// such entry.
+	Get(url string) (*CachedType, bool)
+	// Put stores the given entry for the given URL, replacing any prior entry.
+	// The entry must not be modified after it is stored.
+	Put(url string, entry *CachedType)
+}
+
+// CachedType is an entry in a TypeCache.
+type CachedType struct {
+	// The response body that contains the type definition.
+	Data []byte
+	// The content type of Data.
+	ContentType string
+	// The ETag header of the response, if any.
+	ETag string
+	// The Last-Modified header of the response, if any.
+	LastModified string
+	// The time after which the entry must be revalidated.
+	Expires time.Time
+}
+
+// NewMemoryTypeCache returns a TypeCache that stores entries in memory.
+func NewMemoryTypeCache() TypeCache {
+	return &memoryTypeCache{entries: map[string]*CachedType{}}
+}
+
+type memoryTypeCache struct {
+	mu      sync.RWMutex
+	entries map[string]*CachedType
+}
+
+func (c *memoryTypeCache) Get(url string) (*CachedType, bool) {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	e, ok := c.entries[url]
+	return e, ok
+}
+
+func (c *memoryTypeCache) Put(url string, entry *CachedType) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.entries[url] = entry
+}
+
+type httpTypeFetcher struct {
+	opts HttpTypeFetcherOptions
+	sem  *semaphore
+
+	mu      sync.Mutex
+	hostSem map[string]*semaphore
+}
+
+func (f *httpTypeFetcher) fetch(typeUrl string, enum bool) (proto.Message, error) {
+	u, err := url.Parse(ensureScheme(typeUrl))
+	if err != nil {
+		return nil, err
+	}
+
+	var cached *CachedType
+	if f.opts.Cache != nil {
+		var ok bool
+		cached, ok = f.opts.Cache.Get(u.String())
+		if ok && time.Now().Before(cached.Expires) {
+			return decodeType(cached.Data, cached.ContentType, enum)
+		}
+	}
+
+	entry, err := f.download(u, cached)
+	if err != nil {
+		return nil, err
+	}
+	if f.opts.Cache != nil {
+		f.opts.Cache.Put(u.String(), entry)
+	}
+	return decodeType(entry.Data, entry.ContentType, enum)
+}
+
+// download fetches the type definition at the given URL, retrying on server
+// errors. If cached is not nil, the request is conditional and the returned
+// entry has the cached data if the server indicates that it is unmodified.
+func (f *httpTypeFetcher) download(u *url.URL, cached *CachedType) (*CachedType, error) {
+	// acquire the per-host permit first, so that requests waiting on a busy
+	// host do not hold up requests to other hosts
+	if hs := f.hostSemaphore(u.Host); hs != nil {
+		hs.Acquire()
+		defer hs.Release()
+	}
+	if f.sem != nil {
+		f.sem.Acquire()
+		defer f.sem.Release()
+	}
+
+	backoff := f.opts.RetryBackoff
+	for attempt := 0; ; attempt++ {
+		entry, retry, err := f.doRequest(u, cached)
+		if !retry || attempt >= f.opts.MaxRetries {
+			return entry, err
+		}
+		timer := time.NewTimer(backoff)
+		select {
+		case <-f.opts.Context.Done():
+			timer.Stop()
+			return nil, f.opts.Context.Err()
+		case <-timer.C:
+		}
+		backoff *= 2
+		if f.opts.MaxRetryBackoff > 0 && backoff > f.opts.MaxRetryBackoff {
+			backoff = f.opts.MaxRetryBackoff
+		}
+	}
+}
+
+func (f *httpTypeFetcher) hostSemaphore(host string) *semaphore {
+	if f.opts.PerHostConcurrencyLimit <= 0 {
+		return nil
+	}
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.hostSem == nil {
+		f.hostSem = map[string]*semaphore{}
+	}
+	s := f.hostSem[host]
+	if s == nil {
+		s = &semaphore{count: f.opts.PerHostConcurrencyLimit, permits: f.opts.PerHostConcurrencyLimit}
+		f.hostSem[host] = s
+	}
+	return s
+}
+
+// doRequest issues a single request. The returned bool is true if the request
+// failed due to a server error and may be retried.
+func (f *httpTypeFetcher) doRequest(u *url.URL, cached *CachedType) (*CachedType, bool, error) {
+	ctx := f.opts.Context
+	if f.opts.Timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, f.opts.Timeout)
+		defer cancel()
+	}
+	req, err := http.NewRequest(http.MethodGet, u.String(), nil)
+	if err != nil {
+		return nil, false, err
+	}
+	req = req.WithContext(ctx)
+	req.Header.Set("Accept", f.opts.ContentType)
+	if cached != nil {
+		if cached.ETag != "" {
+			req.Header.Set("If-None-Match", cached.ETag)
+		}
+		if cached.LastModified != "" {
+			req.Header.Set("If-Modified-Since", cached.LastModified)
+		}
+	}
+
+	resp, err := f.opts.Transport.RoundTrip(req)
+	if err != nil {
+		return nil, false, err
+	}
+	defer resp.Body.Close()
+
+	switch {
+	case resp.StatusCode == http.StatusNotModified && cached != nil:
+		entry := *cached
+		if etag := resp.Header.Get("ETag"); etag != "" {
+			entry.ETag = etag
+		}
+		if lastModified := resp.Header.Get("Last-Modified"); lastModified != "" {
+			entry.LastModified = lastModified
+		}
+		entry.Expires = f.expires(resp.Header)
+		return &entry, false, nil
+	case resp.StatusCode >= 500:
+		// drain the body so the connection can be reused
+		_, _ = io.Copy(ioutil.Discard, io.LimitReader(resp.Body, int64(f.opts.SizeLimit)))
+		return nil, true, fmt.Errorf("HTTP request returned non-200 status code: %s", resp.Status)
+	case resp.StatusCode != http.StatusOK:
+		return nil, false, fmt.Errorf("HTTP request returned non-200 status code: %s", resp.Status)
+	}
+
+	data, err := readLimited(resp, f.opts.SizeLimit)
+	if err != nil {
+		return nil, false, err
+	}
+	return &CachedType{
+		Data:         data,
+		ContentType:  resp.Header.Get("Content-Type"),
+		ETag:         resp.Header.Get("ETag"),
+		LastModified: resp.Header.Get("Last-Modified"),
+		Expires:      f.expires(resp.Header),
+	}, false, nil
+}
+
+// expires computes when a response with the given headers must be revalidated.
+func (f *httpTypeFetcher) expires(h http.Header) time.Time {
+	now := time.Now()
+	if f.opts.MaxAge > 0 {
+		return now.Add(f.opts.MaxAge)
+	}
+	for _, directive := range strings.Split(h.Get("Cache-Control"), ",") {
+		directive = strings.TrimSpace(directive)
+		if strings.HasPrefix(directive, "max-age=") {
+			secs, err := strconv.ParseInt(directive[len("max-age="):], 10, 64)
+			if err == nil && secs > 0 {
+				return now.Add(time.Duration(secs) * time.Second)
+			}
+		}
+	}
+	return now
+}
+
+// readLimited reads the given response body, up to the given size limit.
+func readLimited(resp *http.Response, szLimit int) ([]byte, error) {
+	if resp.ContentLength > int64(szLimit) {
+		return nil, fmt.Errorf("type definition size %d is larger than limit of %d", resp.ContentLength, szLimit)
+	}
+
+	// download the response, up to the given size limit, into a buffer
+	bufptr := bufferPool.Get().(*[]byte)
+	defer bufferPool.Put(bufptr)
+	buf := *bufptr
+	var b bytes.Buffer
+	for {
+		n, err := resp.Body.Read(buf)
+		if err != nil && err != io.EOF {
+			return nil, err
+		}
+		if n > 0 {
+			if b.Len()+n > szLimit {
+				return nil, fmt.Errorf("type definition size %d+ is larger than limit of %d", b.Len()+n, szLimit)
+			}
+			b.Write(buf[:n])
+		}
+		if err == io.EOF {
+			break
+		}
+	}
+	return b.Bytes(), nil
+}
+
+// decodeType de-serializes a type definition, using the protobuf JSON format if
+// the given content type indicates JSON and the binary format otherwise.
+func decodeType(data []byte, contentType string, enum bool) (proto.Message, error) {
+	var ret proto.Message
+	if enum {
+		ret = &typepb.Enum{}
+	} else {
+		ret = &typepb.Type{}
+	}
+	if mediaType, _, _ := mime.ParseMediaType(contentType); mediaType == ContentTypeJSON {
+		u := jsonpb.Unmarshaler{AllowUnknownFields: true}
+		if err := u.Unmarshal(bytes.NewReader(data), ret); err != nil {
+			return nil, err
+		}
+		return ret, nil
+	}
+	if err := proto.Unmarshal(data, ret); err != nil {
+		return nil, err
+	}
+	return ret, nil
+}
@@ -0,0 +1,249 @@
+package msgregistry
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/golang/protobuf/proto"
+	"google.golang.org/protobuf/types/known/typepb"
+
+	"github.com/jhump/protoreflect/desc"
+	"github.com/jhump/protoreflect/internal/testutil"
+)
+
+// countingHandler records the requests handled by the given handler.
+type countingHandler struct {
+	http.Handler
+	mu       sync.Mutex
+	requests []*http.Request
+}
+
+func (h *countingHandler) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	h.mu.Lock()
+	h.requests = append(h.requests, req)
+	h.mu.Unlock()
+	h.Handler.ServeHTTP(w, req)
+}
+
+// newCountingTypeServer starts a TypeServer for the types in desc_test_proto3.proto
+// and its dependencies, which records all requests.
+func newCountingTypeServer(t *testing.T, maxAge time.Duration) (*countingHandler, *httptest.Server) {
+	fd, err := desc.LoadFileDescriptor("desc_test_proto3.proto")
+	testutil.Ok(t, err)
+	mr := NewMessageRegistryWithDefaults()
+	mr.AddFile("types.example.com", fd)
+	for _, dep := range fd.GetDependencies() {
+		mr.AddFile("types.example.com", dep)
+	}
+	h := &countingHandler{Handler: NewTypeServer(mr).WithMaxAge(maxAge)}
+	s := httptest.NewServer(h)
+	t.Cleanup(s.Close)
+	return h, s
+}
+
+func TestHttpTypeFetcherOptions_Revalidate(t *testing.T) {
+	h, s := newCountingTypeServer(t, time.Minute)
+	fetcher := HttpTypeFetcherOptions{Cache: NewMemoryTypeCache()}.TypeFetcher()
+	for i := 0; i < 3; i++ {
+		pm, err := fetcher(s.URL+"/testprotos.TestRequest", false)
+		testutil.Ok(t, err)
+		testutil.Eq(t, "testprotos.TestRequest", pm.(*typepb.Type).Name)
+	}
+	// the server's max-age is one minute, so the cached definition is used
+	testutil.Eq(t, 1, len(h.requests))
+
+	// without max-age, cached definitions are revalidated on every query
+	h, s = newCountingTypeServer(t, 0)
+	fetcher = HttpTypeFetcherOptions{Cache: NewMemoryTypeCache()}.TypeFetcher()
+	for i := 0; i < 3; i++ {
+		pm, err := fetcher(s.URL+"/testprotos.TestRequest", false)
+		testutil.Ok(t, err)
+		testutil.Eq(t, "testprotos.TestRequest", pm.(*typepb.Type).Name)
+	}
+	testutil.Eq(t, 3, len(h.requests))
+	testutil.Eq(t, "", h.requests[0].Header.Get("If-None-Match"))
+	testutil.Require(t, h.requests[1].Header.Get("If-None-Match") != "")
+	testutil.Eq(t, h.requests[1].Header.Get("If-None-Match"), h.requests[2].Header.Get("If-None-Match"))
+
+	// unless the fetcher is configured with a max age
+	fetcher = HttpTypeFetcherOptions{Cache: NewMemoryTypeCache(), MaxAge: time.Hour}.TypeFetcher()
+	for i := 0; i < 3; i++ {
+		_, err := fetcher(s.URL+"/testprotos.TestRequest", false)
+		testutil.Ok(t, err)
+	}
+	testutil.Eq(t, 4, len(h.requests))
+}
+
+func TestHttpTypeFetcherOptions_Updates(t *testing.T) {
+	var version int32 = 1
+	const lastModified = "Mon, 02 Jan 2006 15:04:05 GMT"
+	var conditional int32
+	s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		v := atomic.LoadInt32(&version)
+		if req.Header.Get("If-Modified-Since") == lastModified {
+			atomic.AddInt32(&conditional, 1)
+			if v == 1 {
+				w.WriteHeader(http.StatusNotModified)
+				return
+			}
+		}
+		data, err := proto.Marshal(&typepb.Type{Name: fmt.Sprintf("foo.Bar%d", v)})
+		testutil.Ok(t, err)
+		if v == 1 {
+			w.Header().Set("Last-Modified", lastModified)
+		}
+		_, _ = w.Write(data)
+	}))
+	defer s.Close()
+
+	cache := NewMemoryTypeCache()
+	fetcher := HttpTypeFetcherOptions{Cache: cache}.TypeFetcher()
+	pm, err := fetcher(s.URL+"/foo.Bar", false)
+	testutil.Ok(t, err)
+	testutil.Eq(t, "foo.Bar1", pm.(*typepb.Type).Name)
+	pm, err = fetcher(s.URL+"/foo.Bar", false)
+	testutil.Ok(t, err)
+	testutil.Eq(t, "foo.Bar1", pm.(*typepb.Type).Name)
+	testutil.Eq(t, int32(1), atomic.LoadInt32(&conditional))
+
+	// updates are noticed on the next query
+	atomic.StoreInt32(&version, 2)
+	pm, err = fetcher(s.URL+"/foo.Bar", false)
+	testutil.Ok(t, err)
+	testutil.Eq(t, "foo.Bar2", pm.(*typepb.Type).Name)
+	testutil.Eq(t, int32(2), atomic.LoadInt32(&conditional))
+	entry, ok := cache.Get(s.URL + "/foo.Bar")
+	testutil.Require(t, ok)
+	testutil.Eq(t, "", entry.LastModified)
+}
+
+func TestHttpTypeFetcherOptions_Retries(t *testing.T) {
+	var failures, requests int32
+	s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		atomic.AddInt32(&requests, 1)
+		if atomic.AddInt32(&failures, -1) >= 0 {
+			http.Error(w, "try again later", http.StatusServiceUnavailable)
+			return
+		}
+		pm, _ := testFetcher(req.URL.Path, false)
+		data, err := proto.Marshal(pm)
+		testutil.Ok(t, err)
+		_, _ = w.Write(data)
+	}))
+	defer s.Close()
+
+	fetcher := HttpTypeFetcherOptions{MaxRetries: 2, RetryBackoff: time.Millisecond}.TypeFetcher()
+	atomic.StoreInt32(&failures, 2)
+	pm, err := fetcher(s.URL+"/foo.Bar", false)
+	testutil.Ok(t, err)
+	testutil.Eq(t, "foo.Bar", pm.(*typepb.Type).Name)
+	testutil.Eq(t, int32(3), atomic.LoadInt32(&requests))
+
+	atomic.StoreInt32(&requests, 0)
+	atomic.StoreInt32(&failures, 3)
+	_, err = fetcher(s.URL+"/foo.Bar", false)
+	testutil.Nok(t, err)
+	testutil.Eq(t, int32(3), atomic.LoadInt32(&requests))
+
+	// other errors are not retried
+	notFound := httptest.NewServer(http.NotFoundHandler())
+	defer notFound.Close()
+	_, err = fetcher(notFound.URL+"/foo.Bar", false)
+	testutil.Nok(t, err)
+}
+
+func TestHttpTypeFetcherOptions_Timeouts(t *testing.T) {
+	release := make(chan struct{})
+	s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		select {
+		case <-release:
+		case <-req.Context().Done():
+		}
+	}))
+	defer s.Close()
+	defer close(release)
+
+	fetcher := HttpTypeFetcherOptions{Timeout: 20 * time.Millisecond}.TypeFetcher()
+	_, err := fetcher(s.URL+"/foo.Bar", false)
+	testutil.Nok(t, err)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	fetcher = HttpTypeFetcherOptions{Context: ctx}.TypeFetcher()
+	time.AfterFunc(20*time.Millisecond, cancel)
+	_, err = fetcher(s.URL+"/foo.Bar", false)
+	testutil.Nok(t, err)
+}
+
+func TestHttpTypeFetcherOptions_JSON(t *testing.T) {
+	h, s := newCountingTypeServer(t, 0)
+
+	fetcher := HttpTypeFetcherOptions{ContentType: ContentTypeJSON}.TypeFetcher()
+	pm, err := fetcher(s.URL+"/testprotos.TestRequest", false)
+	testutil.Ok(t, err)
+	testutil.Eq(t, "testprotos.TestRequest", pm.(*typepb.Type).Name)
+	pm, err = fetcher(s.URL+"/testprotos.Proto3Enum", true)
+	testutil.Ok(t, err)
+	testutil.Eq(t, "testprotos.Proto3Enum", pm.(*typepb.Enum).Name)
+	testutil.Eq(t, ContentTypeJSON, h.requests[0].Header.Get("Accept"))
+}
+
+// hostRoundTripper records the maximum number of concurrent requests per host.
+type hostRoundTripper struct {
+	mu     sync.Mutex
+	active map[string]int
+	max    map[string]int
+	total  int
+	maxAll int
+}
+
+func (t *hostRoundTripper) RoundTrip(req *http.Request) (*http.Response, error) {
+	host := req.URL.Host
+	t.mu.Lock()
+	t.active[host]++
+	if t.active[host] > t.max[host] {
+		t.max[host] = t.active[host]
+	}
+	t.total++
+	if t.total > t.maxAll {
+		t.maxAll = t.total
+	}
+	t.mu.Unlock()
+	defer func() {
+		t.mu.Lock()
+		t.active[host]--
+		t.total--
+		t.mu.Unlock()
+	}()
+
+	time.Sleep(50 * time.Millisecond)
+	return (&testRoundTripper{counts: map[string]int{}}).RoundTrip(req)
+}
+
+func TestHttpTypeFetcherOptions_PerHostConcurrency(t *testing.T) {
+	trt := &hostRoundTripper{active: map[string]int{}, max: map[string]int{}}
+	fetcher := HttpTypeFetcherOptions{
+		Transport:               trt,
+		PerHostConcurrencyLimit: 2,
+		ConcurrencyLimit:        3,
+	}.TypeFetcher()
+	var wg sync.WaitGroup
+	for i := 0; i < 20; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			url := fmt.Sprintf("host%d.example.com/foo.Bar%d", i%2, i)
+			_, err := fetcher(url, false)
+			testutil.Ok(t, err)
+		}(i)
+	}
+	wg.Wait()
+	testutil.Eq(t, 2, trt.max["host0.example.com"])
+	testutil.Eq(t, 2, trt.max["host1.example.com"])
+	testutil.Eq(t, 3, trt.maxAll)
+}
@@ -433,6 +433,7 @@ func (r *MessageRegistry) MessageAsPType(md *desc.MessageDescriptor) *typepb.Typ
 		Oneofs:        oneOfs,
 		Options:       r.options(md.GetOptions()),
 		Syntax:        syntax(md.GetFile()),
+		Edition:       edition(md.GetFile()),
 		SourceContext: &sourcecontextpb.SourceContext{FileName: md.GetFile().GetName()},
 	}
 }
@@ -532,6 +533,7 @@ func (r *MessageRegistry) EnumAsPType(ed *desc.EnumDescriptor) *typepb.Enum {
 		Enumvalue:     vals,
 		Options:       r.options(ed.GetOptions()),
 		Syntax:        syntax(ed.GetFile()),
+		Edition:       edition(ed.GetFile()),
 		SourceContext: &sourcecontextpb.SourceContext{FileName: ed.GetFile().GetName()},
 	}
 }
@@ -684,13 +686,22 @@ func wrap(v reflect.Value) proto.Message {
 }
 
 func syntax(fd *desc.FileDescriptor) typepb.Syntax {
-	if fd.IsProto3() {
+	if fd.IsEditions() {
+		return typepb.Syntax_SYNTAX_EDITIONS
+	} else if fd.IsProto3() {
 		return typepb.Syntax_SYNTAX_PROTO3
 	} else {
 		return typepb.Syntax_SYNTAX_PROTO2
 	}
 }
 
+func edition(fd *desc.FileDescriptor) string {
+	if !fd.IsEditions() {
+		return ""
+	}
+	return strings.TrimPrefix(fd.GetEdition().String(), "EDITION_")
+}
+
 // ComputeUrl computes a type URL for element described by the given descriptor.
 // The given descriptor must be an enum or message descriptor. This will use any
 // registered URLs and base URLs to determine the appropriate URL for the given
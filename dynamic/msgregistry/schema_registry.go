@@ -0,0 +1,437 @@
+package msgregistry
+
+import (
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/golang/protobuf/proto"
+	"google.golang.org/protobuf/types/descriptorpb"
+
+	"github.com/jhump/protoreflect/desc"
+	"github.com/jhump/protoreflect/dynamic"
+)
+
+// LatestVersion can be used with SchemaSource.SchemaBySubject to request the
+// latest version of a subject's schema.
+const LatestVersion = -1
+
+// ErrSchemaNotFound is returned (possibly wrapped) by a SchemaSource when the
+// requested schema does not exist.
+var ErrSchemaNotFound = errors.New("schema not found")
+
+// SchemaSource provides schemas from a schema registry, like those used with
+// Kafka, where each schema has a numeric ID and may also be registered as a
+// version of one or more subjects.
+//
+// Schemas are returned as file descriptor sets. The schema's own file must be
+// the last file in the set, and the other files must be its transitive
+// dependencies, which is the format produced by protoc when invoked with the
+// --include_imports flag (and the same format used by
+// desc.CreateFileDescriptorFromSet).
+type SchemaSource interface {
+	// SchemaByID returns the schema with the given ID.
+	SchemaByID(ctx context.Context, id int32) (*descriptorpb.FileDescriptorSet, error)
+	// SchemaBySubject returns the given version of the given subject's
+	// schema, along with the schema's ID. If version is LatestVersion, the
+	// latest version is returned.
+	SchemaBySubject(ctx context.Context, subject string, version int) (int32, *descriptorpb.FileDescriptorSet, error)
+}
+
+// DirSchemaSource is a SchemaSource that reads schemas from files in a local
+// directory. This is useful for tests and for jobs that must run without access
+// to a schema registry. The directory has the following layout:
+//
+//	<dir>/<id>.protoset                   schema with the given ID, a
+//	                                      serialized FileDescriptorSet
+//	<dir>/subjects/<subject>/<version>    a version of a subject; its contents
+//	                                      are the ID of the schema, in decimal
+type DirSchemaSource string
+
+var _ SchemaSource = DirSchemaSource("")
+
+// SchemaByID implements SchemaSource by reading the file <dir>/<id>.protoset.
+func (d DirSchemaSource) SchemaByID(_ context.Context, id int32) (*descriptorpb.FileDescriptorSet, error) {
+	path := filepath.Join(string(d), strconv.Itoa(int(id))+".protoset")
+	data, err := os.ReadFile(path)
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return nil, fmt.Errorf("schema ID %d: %w", id, ErrSchemaNotFound)
+		}
+		return nil, err
+	}
+	var fds descriptorpb.FileDescriptorSet
+	if err := proto.Unmarshal(data, &fds); err != nil {
+		return nil, fmt.Errorf("failed to parse %s: %w", path, err)
+	}
+	return &fds, nil
+}
+
+// SchemaBySubject implements SchemaSource by reading the ID from the file
+// <dir>/subjects/<subject>/<version> and then loading the schema with that ID.
+// If version is LatestVersion, the file with the largest numeric name is used.
+func (d DirSchemaSource) SchemaBySubject(ctx context.Context, subject string, version int) (int32, *descriptorpb.FileDescriptorSet, error) {
+	if subject == "" || strings.ContainsAny(subject, `/\`) || subject == "." || subject == ".." {
+		return 0, nil, fmt.Errorf("invalid subject name %q", subject)
+	}
+	subjectDir := filepath.Join(string(d), "subjects", subject)
+	if version == LatestVersion {
+		entries, err := os.ReadDir(subjectDir)
+		if err != nil && !errors.Is(err, os.ErrNotExist) {
+			return 0, nil, err
+		}
+		var versions []int
+		for _, e := range entries {
+			if v, err := strconv.Atoi(e.Name()); err == nil && !e.IsDir() && v > 0 {
+				versions = append(versions, v)
+			}
+		}
+		if len(versions) == 0 {
+			return 0, nil, fmt.Errorf("subject %q: %w", subject, ErrSchemaNotFound)
+		}
+		sort.Ints(versions)
+		version = versions[len(versions)-1]
+	}
+	data, err := os.ReadFile(filepath.Join(subjectDir, strconv.Itoa(version)))
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return 0, nil, fmt.Errorf("subject %q version %d: %w", subject, version, ErrSchemaNotFound)
+		}
+		return 0, nil, err
+	}
+	id, err := strconv.ParseInt(strings.TrimSpace(string(data)), 10, 32)
+	if err != nil {
+		return 0, nil, fmt.Errorf("subject %q version %d: invalid schema ID: %w", subject, version, err)
+	}
+	fds, err := d.SchemaByID(ctx, int32(id))
+	if err != nil {
+		return 0, nil, err
+	}
+	return int32(id), fds, nil
+}
+
+// SchemaResolver resolves schema IDs into file descriptors using a
+// SchemaSource. Since the schema for an ID never changes, the descriptors are
+// cached, so each schema is only fetched and linked once. It can also decode
+// payloads that use the schema registry wire format into dynamic messages.
+//
+// It is safe to use a SchemaResolver concurrently from multiple goroutines.
+type SchemaResolver struct {
+	src SchemaSource
+	mf  *dynamic.MessageFactory
+
+	mu    sync.Mutex
+	files map[int32]*schemaEntry
+}
+
+type schemaEntry struct {
+	fd   *desc.FileDescriptor
+	err  error
+	done chan struct{}
+}
+
+// NewSchemaResolver creates a new resolver that loads schemas from the given
+// source.
+func NewSchemaResolver(src SchemaSource) *SchemaResolver {
+	return &SchemaResolver{src: src, files: map[int32]*schemaEntry{}}
+}
+
+// WithMessageFactory sets the MessageFactory used to instantiate messages
+// that are decoded by the resolver. This method is not thread-safe and is
+// intended to be used for one-time initialization of the resolver, before it
+// is published for use by other threads.
+func (r *SchemaResolver) WithMessageFactory(mf *dynamic.MessageFactory) *SchemaResolver {
+	r.mf = mf
+	return r
+}
+
+// FileForID returns the file descriptor for the schema with the given ID.
+//
+// If several goroutines request the same ID concurrently, the schema is only
+// loaded once, by the first of them, using its context. If that load fails
+// because the first caller's context was cancelled or its deadline exceeded,
+// the other callers, whose contexts are still live, try again.
+func (r *SchemaResolver) FileForID(ctx context.Context, id int32) (*desc.FileDescriptor, error) {
+	for {
+		r.mu.Lock()
+		e := r.files[id]
+		if e == nil {
+			e = &schemaEntry{done: make(chan struct{})}
+			r.files[id] = e
+			r.mu.Unlock()
+			e.fd, e.err = r.load(ctx, id)
+			if e.err != nil {
+				// don't leave broken entry in the cache
+				r.mu.Lock()
+				delete(r.files, id)
+				r.mu.Unlock()
+			}
+			close(e.done)
+			return e.fd, e.err
+		}
+		r.mu.Unlock()
+		select {
+		case <-e.done:
+			if isContextError(e.err) && ctx.Err() == nil {
+				// the load was abandoned by the goroutine that started it,
+				// not by us; so try again
+				continue
+			}
+			return e.fd, e.err
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+	}
+}
+
+func isContextError(err error) bool {
+	return errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded)
+}
+
+func (r *SchemaResolver) load(ctx context.Context, id int32) (*desc.FileDescriptor, error) {
+	fds, err := r.src.SchemaByID(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	return r.link(id, fds)
+}
+
+func (r *SchemaResolver) link(id int32, fds *descriptorpb.FileDescriptorSet) (*desc.FileDescriptor, error) {
+	fd, err := desc.CreateFileDescriptorFromSet(fds)
+	if err != nil {
+		return nil, fmt.Errorf("schema ID %d: %w", id, err)
+	}
+	return fd, nil
+}
+
+// FileForSubject returns the ID and file descriptor for the given version of
+// the given subject's schema. If version is LatestVersion, the latest version
+// is returned. Since a subject's versions can change, the source is always
+// consulted, but the file descriptor for the resulting ID is cached.
+func (r *SchemaResolver) FileForSubject(ctx context.Context, subject string, version int) (int32, *desc.FileDescriptor, error) {
+	id, fds, err := r.src.SchemaBySubject(ctx, subject, version)
+	if err != nil {
+		return 0, nil, err
+	}
+	r.mu.Lock()
+	e := r.files[id]
+	r.mu.Unlock()
+	if e != nil {
+		select {
+		case <-e.done:
+			if e.err == nil {
+				return id, e.fd, nil
+			}
+			// the load failed, so try again with the schema we already have
+		case <-ctx.Done():
+			return 0, nil, ctx.Err()
+		}
+	}
+	fd, err := r.link(id, fds)
+	if err != nil {
+		return 0, nil, err
+	}
+	r.mu.Lock()
+	if r.files[id] == nil {
+		e = &schemaEntry{fd: fd, done: make(chan struct{})}
+		close(e.done)
+		r.files[id] = e
+	}
+	r.mu.Unlock()
+	return id, fd, nil
+}
+
+// MessageForID returns the descriptor for the message in the schema with the
+// given ID that is identified by the given message indexes. See
+// WireHeader.MessageIndexes for more details.
+func (r *SchemaResolver) MessageForID(ctx context.Context, id int32, messageIndexes []int) (*desc.MessageDescriptor, error) {
+	fd, err := r.FileForID(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	md, err := FindMessageByIndexes(fd, messageIndexes)
+	if err != nil {
+		return nil, fmt.Errorf("schema ID %d: %w", id, err)
+	}
+	return md, nil
+}
+
+// Unmarshal decodes the given payload, which must be in the schema registry
+// wire format, into a dynamic message. The schema ID and message indexes in
+// the payload's header identify the message type.
+func (r *SchemaResolver) Unmarshal(ctx context.Context, data []byte) (*dynamic.Message, error) {
+	hdr, payload, err := ParseWireHeader(data)
+	if err != nil {
+		return nil, err
+	}
+	md, err := r.MessageForID(ctx, hdr.SchemaID, hdr.MessageIndexes)
+	if err != nil {
+		return nil, err
+	}
+	dm := r.mf.NewDynamicMessage(md)
+	if err := dm.Unmarshal(payload); err != nil {
+		return nil, err
+	}
+	return dm, nil
+}
+
+// WireMagicByte is the first byte of payloads in the schema registry wire
+// format.
+const WireMagicByte = 0
+
+// WireHeader is the header that precedes a serialized message in the schema
+// registry wire format. The header is encoded as follows:
+//
+//   - The magic byte, which is always zero.
+//   - The schema ID, as a 4-byte big-endian integer.
+//   - The message indexes: a count followed by each index, all encoded as
+//     zig-zag varints. The common case of a single index of zero is instead
+//     encoded as a single zero byte.
+type WireHeader struct {
+	SchemaID int32
+	// MessageIndexes identify a message in the schema's file. The first index
+	// is that of a top-level message in the file; each subsequent one is the
+	// index of a message nested in the previous one. If empty, it refers to
+	// the first message in the file.
+	MessageIndexes []int
+}
+
+// ParseWireHeader parses the header of the given payload, which must be in the
+// schema registry wire format. It returns the header and the rest of the data,
+// which is the serialized message.
+func ParseWireHeader(data []byte) (WireHeader, []byte, error) {
+	var hdr WireHeader
+	if len(data) < 5 {
+		return hdr, nil, fmt.Errorf("payload is too short (%d bytes) to have a schema registry header", len(data))
+	}
+	if data[0] != WireMagicByte {
+		return hdr, nil, fmt.Errorf("payload has unknown magic byte %#x", data[0])
+	}
+	hdr.SchemaID = int32(binary.BigEndian.Uint32(data[1:5]))
+	data = data[5:]
+	count, n := binary.Varint(data)
+	if n <= 0 {
+		return hdr, nil, fmt.Errorf("payload has invalid message indexes")
+	}
+	data = data[n:]
+	if count < 0 || count > int64(len(data)) {
+		return hdr, nil, fmt.Errorf("payload has invalid message index count %d", count)
+	}
+	if count == 0 {
+		hdr.MessageIndexes = []int{0}
+		return hdr, data, nil
+	}
+	hdr.MessageIndexes = make([]int, count)
+	for i := range hdr.MessageIndexes {
+		idx, n := binary.Varint(data)
+		if n <= 0 || idx < 0 || idx > int64(maxInt) {
+			return hdr, nil, fmt.Errorf("payload has invalid message indexes")
+		}
+		hdr.MessageIndexes[i] = int(idx)
+		data = data[n:]
+	}
+	return hdr, data, nil
+}
+
+const maxInt = int(^uint(0) >> 1)
+
+// AppendWireHeader appends the given header, in the schema registry wire
+// format, to b and returns the result. The serialized message should then be
+// appended to the result.
+func AppendWireHeader(b []byte, hdr WireHeader) []byte {
+	var id [4]byte
+	binary.BigEndian.PutUint32(id[:], uint32(hdr.SchemaID))
+	b = append(b, WireMagicByte)
+	b = append(b, id[:]...)
+	if len(hdr.MessageIndexes) == 0 || (len(hdr.MessageIndexes) == 1 && hdr.MessageIndexes[0] == 0) {
+		return append(b, 0)
+	}
+	var buf [binary.MaxVarintLen64]byte
+	n := binary.PutVarint(buf[:], int64(len(hdr.MessageIndexes)))
+	b = append(b, buf[:n]...)
+	for _, idx := range hdr.MessageIndexes {
+		n = binary.PutVarint(buf[:], int64(idx))
+		b = append(b, buf[:n]...)
+	}
+	return b
+}
+
+// MarshalWire serializes the given message in the schema registry wire format,
+// using the given schema ID. The message indexes in the header are computed
+// from the message's descriptor, so the message's type must be defined in the
+// file for the given schema.
+func MarshalWire(schemaID int32, msg proto.Message) ([]byte, error) {
+	md, err := messageDescriptor(msg)
+	if err != nil {
+		return nil, err
+	}
+	data, err := proto.Marshal(msg)
+	if err != nil {
+		return nil, err
+	}
+	hdr := AppendWireHeader(nil, WireHeader{SchemaID: schemaID, MessageIndexes: MessageIndexes(md)})
+	return append(hdr, data...), nil
+}
+
+func messageDescriptor(msg proto.Message) (*desc.MessageDescriptor, error) {
+	if dm, ok := msg.(*dynamic.Message); ok {
+		return dm.GetMessageDescriptor(), nil
+	}
+	return desc.LoadMessageDescriptorForMessage(msg)
+}
+
+// MessageIndexes returns the message indexes that identify the given message
+// in its file, for use in a WireHeader.
+func MessageIndexes(md *desc.MessageDescriptor) []int {
+	var indexes []int
+	for {
+		var siblings []*desc.MessageDescriptor
+		switch p := md.GetParent().(type) {
+		case *desc.MessageDescriptor:
+			siblings = p.GetNestedMessageTypes()
+		case *desc.FileDescriptor:
+			siblings = p.GetMessageTypes()
+		}
+		for i, sibling := range siblings {
+			if sibling == md {
+				indexes = append(indexes, i)
+				break
+			}
+		}
+		parent, ok := md.GetParent().(*desc.MessageDescriptor)
+		if !ok {
+			break
+		}
+		md = parent
+	}
+	// we built the path from the inside out, so reverse it
+	for i, j := 0, len(indexes)-1; i < j; i, j = i+1, j-1 {
+		indexes[i], indexes[j] = indexes[j], indexes[i]
+	}
+	return indexes
+}
+
+// FindMessageByIndexes returns the message in the given file that is
+// identified by the given message indexes. See WireHeader.MessageIndexes.
+func FindMessageByIndexes(fd *desc.FileDescriptor, indexes []int) (*desc.MessageDescriptor, error) {
+	if len(indexes) == 0 {
+		indexes = []int{0}
+	}
+	msgs := fd.GetMessageTypes()
+	var md *desc.MessageDescriptor
+	for _, idx := range indexes {
+		if idx < 0 || idx >= len(msgs) {
+			return nil, fmt.Errorf("message index %v is out of range for file %q", indexes, fd.GetName())
+		}
+		md = msgs[idx]
+		msgs = md.GetNestedMessageTypes()
+	}
+	return md, nil
+}
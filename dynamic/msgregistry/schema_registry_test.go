@@ -0,0 +1,283 @@
+package msgregistry
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/golang/protobuf/proto"
+	"google.golang.org/protobuf/types/descriptorpb"
+
+	"github.com/jhump/protoreflect/desc"
+	"github.com/jhump/protoreflect/dynamic"
+	"github.com/jhump/protoreflect/internal/testprotos"
+	"github.com/jhump/protoreflect/internal/testutil"
+)
+
+func TestWireHeader(t *testing.T) {
+	testCases := []struct {
+		hdr      WireHeader
+		encoded  []byte
+		expected []int
+	}{
+		{WireHeader{SchemaID: 1}, []byte{0, 0, 0, 0, 1, 0}, []int{0}},
+		{WireHeader{SchemaID: 258, MessageIndexes: []int{0}}, []byte{0, 0, 0, 1, 2, 0}, []int{0}},
+		{WireHeader{SchemaID: 3, MessageIndexes: []int{1}}, []byte{0, 0, 0, 0, 3, 2, 2}, []int{1}},
+		{WireHeader{SchemaID: -1, MessageIndexes: []int{0, 2, 65}}, []byte{0, 0xff, 0xff, 0xff, 0xff, 6, 0, 4, 0x82, 1}, []int{0, 2, 65}},
+	}
+	for _, tc := range testCases {
+		data := AppendWireHeader(nil, tc.hdr)
+		testutil.Eq(t, tc.encoded, data)
+		hdr, rest, err := ParseWireHeader(append(data, 1, 2, 3))
+		testutil.Ok(t, err)
+		testutil.Eq(t, tc.hdr.SchemaID, hdr.SchemaID)
+		testutil.Eq(t, tc.expected, hdr.MessageIndexes)
+		testutil.Eq(t, []byte{1, 2, 3}, rest)
+	}
+
+	for name, data := range map[string][]byte{
+		"too short":      {0, 0, 0, 1},
+		"bad magic byte": {1, 0, 0, 0, 1, 0},
+		"no indexes":     {0, 0, 0, 0, 1},
+		"bad count":      {0, 0, 0, 0, 1, 3},
+		"truncated":      {0, 0, 0, 0, 1, 4, 2},
+		"negative index": {0, 0, 0, 0, 1, 2, 1},
+	} {
+		_, _, err := ParseWireHeader(data)
+		testutil.Nok(t, err, "%s: expected error", name)
+	}
+}
+
+func TestMessageIndexes(t *testing.T) {
+	fd, err := desc.LoadFileDescriptor("desc_test1.proto")
+	testutil.Ok(t, err)
+	msgs := []proto.Message{
+		(*testprotos.TestMessage)(nil),
+		(*testprotos.TestMessage_NestedMessage_AnotherNestedMessage_YetAnotherNestedMessage)(nil),
+		(*testprotos.AnotherTestMessage)(nil),
+		(*testprotos.AnotherTestMessage_RockNRoll)(nil),
+	}
+	// map entries are nested messages, too, so they count
+	expected := [][]int{{0}, {0, 0, 0, 0}, {1}, {1, 4}}
+	for i, msg := range msgs {
+		md, err := desc.LoadMessageDescriptorForMessage(msg)
+		testutil.Ok(t, err)
+		indexes := MessageIndexes(md)
+		testutil.Eq(t, expected[i], indexes, "wrong indexes for %s", md.GetFullyQualifiedName())
+		found, err := FindMessageByIndexes(fd, indexes)
+		testutil.Ok(t, err)
+		testutil.Eq(t, md, found)
+	}
+
+	found, err := FindMessageByIndexes(fd, nil)
+	testutil.Ok(t, err)
+	testutil.Eq(t, "testprotos.TestMessage", found.GetFullyQualifiedName())
+
+	_, err = FindMessageByIndexes(fd, []int{2})
+	testutil.Nok(t, err)
+	_, err = FindMessageByIndexes(fd, []int{0, 5})
+	testutil.Nok(t, err)
+}
+
+// writeSchemaDir creates a directory for a DirSchemaSource with two versions
+// of one subject.
+func writeSchemaDir(t *testing.T) string {
+	dir := t.TempDir()
+	for id, name := range map[string]string{"1": "desc_test1.proto", "2": "desc_test_proto3.proto"} {
+		fd, err := desc.LoadFileDescriptor(name)
+		testutil.Ok(t, err)
+		data, err := proto.Marshal(desc.ToFileDescriptorSet(fd))
+		testutil.Ok(t, err)
+		testutil.Ok(t, os.WriteFile(filepath.Join(dir, id+".protoset"), data, 0644))
+	}
+	subjectDir := filepath.Join(dir, "subjects", "test-value")
+	testutil.Ok(t, os.MkdirAll(subjectDir, 0755))
+	testutil.Ok(t, os.WriteFile(filepath.Join(subjectDir, "1"), []byte("1\n"), 0644))
+	testutil.Ok(t, os.WriteFile(filepath.Join(subjectDir, "2"), []byte("2\n"), 0644))
+	return dir
+}
+
+func TestDirSchemaSource(t *testing.T) {
+	src := DirSchemaSource(writeSchemaDir(t))
+	ctx := context.Background()
+
+	fds, err := src.SchemaByID(ctx, 1)
+	testutil.Ok(t, err)
+	testutil.Eq(t, "desc_test1.proto", fds.File[len(fds.File)-1].GetName())
+
+	id, fds, err := src.SchemaBySubject(ctx, "test-value", 1)
+	testutil.Ok(t, err)
+	testutil.Eq(t, int32(1), id)
+	testutil.Eq(t, "desc_test1.proto", fds.File[len(fds.File)-1].GetName())
+
+	id, fds, err = src.SchemaBySubject(ctx, "test-value", LatestVersion)
+	testutil.Ok(t, err)
+	testutil.Eq(t, int32(2), id)
+	testutil.Eq(t, "desc_test_proto3.proto", fds.File[len(fds.File)-1].GetName())
+
+	_, err = src.SchemaByID(ctx, 3)
+	testutil.Require(t, errors.Is(err, ErrSchemaNotFound), "unexpected error: %v", err)
+	_, _, err = src.SchemaBySubject(ctx, "test-value", 3)
+	testutil.Require(t, errors.Is(err, ErrSchemaNotFound), "unexpected error: %v", err)
+	_, _, err = src.SchemaBySubject(ctx, "other-value", LatestVersion)
+	testutil.Require(t, errors.Is(err, ErrSchemaNotFound), "unexpected error: %v", err)
+	_, _, err = src.SchemaBySubject(ctx, "../subjects", LatestVersion)
+	testutil.Nok(t, err)
+}
+
+type countingSchemaSource struct {
+	SchemaSource
+	byID, bySubject int32
+}
+
+func (s *countingSchemaSource) SchemaByID(ctx context.Context, id int32) (*descriptorpb.FileDescriptorSet, error) {
+	atomic.AddInt32(&s.byID, 1)
+	return s.SchemaSource.SchemaByID(ctx, id)
+}
+
+func (s *countingSchemaSource) SchemaBySubject(ctx context.Context, subject string, version int) (int32, *descriptorpb.FileDescriptorSet, error) {
+	atomic.AddInt32(&s.bySubject, 1)
+	return s.SchemaSource.SchemaBySubject(ctx, subject, version)
+}
+
+func TestSchemaResolver_Caching(t *testing.T) {
+	src := &countingSchemaSource{SchemaSource: DirSchemaSource(writeSchemaDir(t))}
+	r := NewSchemaResolver(src)
+	ctx := context.Background()
+
+	var wg sync.WaitGroup
+	fds := make([]*desc.FileDescriptor, 10)
+	for i := range fds {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			fd, err := r.FileForID(ctx, 1)
+			testutil.Ok(t, err)
+			fds[i] = fd
+		}(i)
+	}
+	wg.Wait()
+	testutil.Eq(t, int32(1), src.byID)
+	for _, fd := range fds {
+		testutil.Require(t, fd == fds[0])
+	}
+	testutil.Eq(t, "desc_test1.proto", fds[0].GetName())
+
+	// subjects are always queried, but the file for the ID is cached
+	id, fd, err := r.FileForSubject(ctx, "test-value", 1)
+	testutil.Ok(t, err)
+	testutil.Eq(t, int32(1), id)
+	testutil.Require(t, fd == fds[0])
+	id, fd, err = r.FileForSubject(ctx, "test-value", LatestVersion)
+	testutil.Ok(t, err)
+	testutil.Eq(t, int32(2), id)
+	testutil.Eq(t, "desc_test_proto3.proto", fd.GetName())
+	testutil.Eq(t, int32(2), src.bySubject)
+	fd2, err := r.FileForID(ctx, 2)
+	testutil.Ok(t, err)
+	testutil.Require(t, fd == fd2)
+	testutil.Eq(t, int32(1), src.byID)
+
+	// errors are not cached
+	_, err = r.FileForID(ctx, 3)
+	testutil.Require(t, errors.Is(err, ErrSchemaNotFound), "unexpected error: %v", err)
+	_, err = r.FileForID(ctx, 3)
+	testutil.Require(t, errors.Is(err, ErrSchemaNotFound), "unexpected error: %v", err)
+	testutil.Eq(t, int32(3), src.byID)
+}
+
+// blockingSchemaSource blocks the first request for a schema ID until the
+// request's context is done.
+type blockingSchemaSource struct {
+	SchemaSource
+	started chan struct{}
+	calls   int32
+}
+
+func (s *blockingSchemaSource) SchemaByID(ctx context.Context, id int32) (*descriptorpb.FileDescriptorSet, error) {
+	if atomic.AddInt32(&s.calls, 1) == 1 {
+		close(s.started)
+		<-ctx.Done()
+		return nil, ctx.Err()
+	}
+	return s.SchemaSource.SchemaByID(ctx, id)
+}
+
+func TestSchemaResolver_CancelledLoad(t *testing.T) {
+	src := &blockingSchemaSource{SchemaSource: DirSchemaSource(writeSchemaDir(t)), started: make(chan struct{})}
+	r := NewSchemaResolver(src)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	errs := make(chan error, 1)
+	go func() {
+		_, err := r.FileForID(ctx, 1)
+		errs <- err
+	}()
+	<-src.started
+
+	// another caller waits for the same schema, but the first caller gives up
+	var fd *desc.FileDescriptor
+	var err error
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		fd, err = r.FileForID(context.Background(), 1)
+	}()
+	time.Sleep(50 * time.Millisecond)
+	cancel()
+
+	testutil.Require(t, errors.Is(<-errs, context.Canceled))
+	<-done
+	// the waiter is not affected by the other caller's cancellation
+	testutil.Ok(t, err)
+	testutil.Eq(t, "desc_test1.proto", fd.GetName())
+	testutil.Eq(t, int32(2), atomic.LoadInt32(&src.calls))
+}
+
+func TestSchemaResolver_Unmarshal(t *testing.T) {
+	r := NewSchemaResolver(DirSchemaSource(writeSchemaDir(t)))
+	ctx := context.Background()
+
+	msg := &testprotos.AnotherTestMessage{
+		Rocknroll: &testprotos.AnotherTestMessage_RockNRoll{Beatles: proto.String("abbey road")},
+		Atmoo:     &testprotos.AnotherTestMessage_Int{Int: 42},
+	}
+	data, err := MarshalWire(1, msg)
+	testutil.Ok(t, err)
+	testutil.Eq(t, []byte{0, 0, 0, 0, 1, 2, 2}, data[:7])
+
+	dm, err := r.Unmarshal(ctx, data)
+	testutil.Ok(t, err)
+	testutil.Eq(t, "testprotos.AnotherTestMessage", dm.GetMessageDescriptor().GetFullyQualifiedName())
+	testutil.Require(t, dynamic.MessagesEqual(msg, dm), "%v != %v", msg, dm)
+
+	// nested messages are identified by a path of indexes
+	nested := dm.GetMessageDescriptor().GetFile().FindMessage("testprotos.AnotherTestMessage.RockNRoll")
+	dm = dynamic.NewMessage(nested)
+	dm.SetFieldByName("stones", "sticky fingers")
+	data, err = MarshalWire(1, dm)
+	testutil.Ok(t, err)
+	decoded, err := r.Unmarshal(ctx, data)
+	testutil.Ok(t, err)
+	testutil.Eq(t, "testprotos.AnotherTestMessage.RockNRoll", decoded.GetMessageDescriptor().GetFullyQualifiedName())
+	testutil.Eq(t, "sticky fingers", decoded.GetFieldByName("stones"))
+
+	// the message factory is used for nested messages
+	data, err = MarshalWire(1, msg)
+	testutil.Ok(t, err)
+	mf := dynamic.NewMessageFactoryWithDefaults()
+	decoded, err = NewSchemaResolver(DirSchemaSource(writeSchemaDir(t))).WithMessageFactory(mf).Unmarshal(ctx, data)
+	testutil.Ok(t, err)
+	_, ok := decoded.GetFieldByName("rocknroll").(*testprotos.AnotherTestMessage_RockNRoll)
+	testutil.Require(t, ok, "unexpected type %T", decoded.GetFieldByName("rocknroll"))
+
+	_, err = r.Unmarshal(ctx, []byte{0, 0, 0, 0, 9, 0})
+	testutil.Require(t, errors.Is(err, ErrSchemaNotFound), "unexpected error: %v", err)
+	_, err = r.Unmarshal(ctx, []byte{0, 0, 0, 0, 1, 2, 8})
+	testutil.Nok(t, err)
+}
@@ -0,0 +1,174 @@
+package msgregistry
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"mime"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/golang/protobuf/jsonpb"
+	"github.com/golang/protobuf/proto"
+
+	"github.com/jhump/protoreflect/desc"
+)
+
+const (
+	// ContentTypeProtobuf is the content type used for type definitions in
+	// the protobuf binary format.
+	ContentTypeProtobuf = "application/x-protobuf"
+	// ContentTypeJSON is the content type used for type definitions in the
+	// protobuf JSON format.
+	ContentTypeJSON = "application/json"
+)
+
+// TypeServer is an http.Handler that serves type definitions for the types in
+// a MessageRegistry. It is the server counterpart to HttpTypeFetcher: a type
+// URL whose host refers to the server can be resolved by a MessageRegistry in
+// another process.
+//
+// The type is identified by the last element of the request path, which must
+// be its fully-qualified name. So the handler can be mounted at any path, and
+// the host name and other path elements in the type URL are ignored. Only
+// types explicitly added to the registry are served. Message types are served
+// as a google.protobuf.Type and enum types as a google.protobuf.Enum, computed
+// using the registry's MessageAsPType and EnumAsPType methods.
+//
+// The response is in the protobuf binary format unless the request's Accept
+// header prefers JSON. Responses include an ETag header, derived from the
+// response body, and conditional requests with an If-None-Match header are
+// supported. Only GET and HEAD requests are allowed.
+type TypeServer struct {
+	registry *MessageRegistry
+	maxAge   time.Duration
+}
+
+// NewTypeServer creates a new TypeServer that serves the types in the given
+// registry.
+func NewTypeServer(registry *MessageRegistry) *TypeServer {
+	return &TypeServer{registry: registry}
+}
+
+// WithMaxAge sets the max age advertised to clients and caches in the
+// Cache-Control header of successful responses. If zero (the default), no
+// Cache-Control header is sent, and clients must revalidate using the ETag.
+// This method is not thread-safe and is intended to be used for one-time
+// initialization of the server, before it starts serving requests.
+func (s *TypeServer) WithMaxAge(maxAge time.Duration) *TypeServer {
+	s.maxAge = maxAge
+	return s
+}
+
+// ServeHTTP implements the http.Handler interface.
+func (s *TypeServer) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	if req.Method != http.MethodGet && req.Method != http.MethodHead {
+		w.Header().Set("Allow", "GET, HEAD")
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	name := typeName(req.URL.Path)
+	d := s.registry.findRegisteredType(name)
+	if d == nil {
+		http.NotFound(w, req)
+		return
+	}
+	var msg proto.Message
+	switch d := d.(type) {
+	case *desc.MessageDescriptor:
+		msg = s.registry.MessageAsPType(d)
+	case *desc.EnumDescriptor:
+		msg = s.registry.EnumAsPType(d)
+	}
+
+	contentType, ok := negotiateContentType(req.Header.Get("Accept"))
+	if !ok {
+		http.Error(w, "type definitions are only available as "+ContentTypeProtobuf+" or "+ContentTypeJSON, http.StatusNotAcceptable)
+		return
+	}
+	var data []byte
+	var err error
+	if contentType == ContentTypeJSON {
+		var buf bytes.Buffer
+		m := jsonpb.Marshaler{AnyResolver: s.registry}
+		err = m.Marshal(&buf, msg)
+		data = buf.Bytes()
+	} else {
+		data, err = proto.Marshal(msg)
+	}
+	if err != nil {
+		http.Error(w, "failed to encode type definition: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	sum := sha256.Sum256(data)
+	h := w.Header()
+	h.Set("Content-Type", contentType)
+	h.Set("ETag", `"`+hex.EncodeToString(sum[:16])+`"`)
+	h.Add("Vary", "Accept")
+	if s.maxAge > 0 {
+		h.Set("Cache-Control", "max-age="+strconv.FormatInt(int64(s.maxAge/time.Second), 10))
+	}
+	// ServeContent takes care of HEAD requests and of If-None-Match and
+	// other conditional request headers
+	http.ServeContent(w, req, "", time.Time{}, bytes.NewReader(data))
+}
+
+// findRegisteredType returns the message or enum type with the given fully-qualified
+// name that was explicitly added to the registry, or nil if there is no such type.
+func (r *MessageRegistry) findRegisteredType(name string) desc.Descriptor {
+	if name == "" {
+		return nil
+	}
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	baseUrl, ok := r.baseUrls[name]
+	if !ok {
+		return nil
+	}
+	d := r.types[ensureScheme(baseUrl+"/"+name)]
+	if d == nil || d.GetFullyQualifiedName() != name {
+		return nil
+	}
+	return d
+}
+
+// negotiateContentType picks the content type of the response based on the
+// given Accept header. The media ranges in the header are considered in order
+// of their quality values. It returns false if the header does not accept any
+// supported content type.
+func negotiateContentType(accept string) (string, bool) {
+	if strings.TrimSpace(accept) == "" {
+		return ContentTypeProtobuf, true
+	}
+	best, bestQ := "", 0.0
+	for _, mediaRange := range strings.Split(accept, ",") {
+		mediaType, params, err := mime.ParseMediaType(mediaRange)
+		if err != nil {
+			continue
+		}
+		q := 1.0
+		if qs, ok := params["q"]; ok {
+			q, err = strconv.ParseFloat(qs, 64)
+			if err != nil || q < 0 || q > 1 {
+				continue
+			}
+		}
+		var contentType string
+		switch mediaType {
+		case ContentTypeProtobuf, "application/protobuf", "application/octet-stream", "application/*", "*/*":
+			contentType = ContentTypeProtobuf
+		case ContentTypeJSON:
+			contentType = ContentTypeJSON
+		default:
+			continue
+		}
+		if q > bestQ {
+			best, bestQ = contentType, q
+		}
+	}
+	return best, best != ""
+}
@@ -0,0 +1,154 @@
+package msgregistry
+
+import (
+	"bytes"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/golang/protobuf/jsonpb"
+	"github.com/golang/protobuf/proto"
+	"google.golang.org/protobuf/types/known/anypb"
+	"google.golang.org/protobuf/types/known/typepb"
+
+	"github.com/jhump/protoreflect/desc"
+	"github.com/jhump/protoreflect/dynamic"
+	"github.com/jhump/protoreflect/internal/testprotos"
+	"github.com/jhump/protoreflect/internal/testutil"
+)
+
+func newTestTypeServer(t *testing.T) (*MessageRegistry, *httptest.Server) {
+	fd, err := desc.LoadFileDescriptor("desc_test_proto3.proto")
+	testutil.Ok(t, err)
+	mr := NewMessageRegistryWithDefaults()
+	s := httptest.NewServer(NewTypeServer(mr).WithMaxAge(time.Minute))
+	t.Cleanup(s.Close)
+	// type URLs refer to the server, so clients can resolve field types, too
+	mr.AddFile(s.URL, fd)
+	for _, dep := range fd.GetDependencies() {
+		mr.AddFile(s.URL, dep)
+	}
+	return mr, s
+}
+
+func doTypeRequest(t *testing.T, method, url string, header map[string]string) (*http.Response, []byte) {
+	req, err := http.NewRequest(method, url, nil)
+	testutil.Ok(t, err)
+	for k, v := range header {
+		req.Header.Set(k, v)
+	}
+	resp, err := http.DefaultClient.Do(req)
+	testutil.Ok(t, err)
+	defer resp.Body.Close()
+	body, err := ioutil.ReadAll(resp.Body)
+	testutil.Ok(t, err)
+	return resp, body
+}
+
+func TestTypeServer(t *testing.T) {
+	mr, s := newTestTypeServer(t)
+	md, err := desc.LoadMessageDescriptorForMessage((*testprotos.TestRequest)(nil))
+	testutil.Ok(t, err)
+
+	// binary is the default
+	resp, body := doTypeRequest(t, http.MethodGet, s.URL+"/testprotos.TestRequest", nil)
+	testutil.Eq(t, http.StatusOK, resp.StatusCode)
+	testutil.Eq(t, ContentTypeProtobuf, resp.Header.Get("Content-Type"))
+	testutil.Eq(t, "max-age=60", resp.Header.Get("Cache-Control"))
+	var typ typepb.Type
+	testutil.Ok(t, proto.Unmarshal(body, &typ))
+	testutil.Require(t, proto.Equal(mr.MessageAsPType(md), &typ), "unexpected type: %v", &typ)
+	etag := resp.Header.Get("ETag")
+	testutil.Require(t, etag != "")
+
+	// other path elements are ignored
+	resp, body2 := doTypeRequest(t, http.MethodGet, s.URL+"/some/path/testprotos.TestRequest", map[string]string{"Accept": "*/*"})
+	testutil.Eq(t, http.StatusOK, resp.StatusCode)
+	testutil.Eq(t, body, body2)
+	testutil.Eq(t, etag, resp.Header.Get("ETag"))
+
+	// enums
+	resp, body = doTypeRequest(t, http.MethodGet, s.URL+"/testprotos.Proto3Enum", nil)
+	testutil.Eq(t, http.StatusOK, resp.StatusCode)
+	var en typepb.Enum
+	testutil.Ok(t, proto.Unmarshal(body, &en))
+	testutil.Eq(t, "testprotos.Proto3Enum", en.Name)
+
+	// JSON
+	resp, body = doTypeRequest(t, http.MethodGet, s.URL+"/testprotos.TestRequest", map[string]string{"Accept": "application/x-protobuf;q=0.5, application/json"})
+	testutil.Eq(t, http.StatusOK, resp.StatusCode)
+	testutil.Eq(t, ContentTypeJSON, resp.Header.Get("Content-Type"))
+	testutil.Require(t, etag != resp.Header.Get("ETag"))
+	typ = typepb.Type{}
+	testutil.Ok(t, jsonpb.Unmarshal(bytes.NewReader(body), &typ))
+	testutil.Require(t, proto.Equal(mr.MessageAsPType(md), &typ), "unexpected type: %v", &typ)
+
+	// HEAD
+	resp, body = doTypeRequest(t, http.MethodHead, s.URL+"/testprotos.TestRequest", nil)
+	testutil.Eq(t, http.StatusOK, resp.StatusCode)
+	testutil.Eq(t, etag, resp.Header.Get("ETag"))
+	testutil.Eq(t, 0, len(body))
+}
+
+func TestTypeServer_Conditional(t *testing.T) {
+	_, s := newTestTypeServer(t)
+	resp, _ := doTypeRequest(t, http.MethodGet, s.URL+"/testprotos.TestRequest", nil)
+	etag := resp.Header.Get("ETag")
+
+	for _, inm := range []string{etag, `"abc", ` + etag, "W/" + etag, "*"} {
+		resp, body := doTypeRequest(t, http.MethodGet, s.URL+"/testprotos.TestRequest", map[string]string{"If-None-Match": inm})
+		testutil.Eq(t, http.StatusNotModified, resp.StatusCode, "If-None-Match: %s", inm)
+		testutil.Eq(t, etag, resp.Header.Get("ETag"))
+		testutil.Eq(t, 0, len(body))
+	}
+
+	resp, body := doTypeRequest(t, http.MethodGet, s.URL+"/testprotos.TestRequest", map[string]string{"If-None-Match": `"abc"`})
+	testutil.Eq(t, http.StatusOK, resp.StatusCode)
+	testutil.Require(t, len(body) > 0)
+
+	// a different encoding has a different ETag
+	resp, _ = doTypeRequest(t, http.MethodGet, s.URL+"/testprotos.TestRequest", map[string]string{"If-None-Match": etag, "Accept": ContentTypeJSON})
+	testutil.Eq(t, http.StatusOK, resp.StatusCode)
+}
+
+func TestTypeServer_Errors(t *testing.T) {
+	_, s := newTestTypeServer(t)
+
+	resp, _ := doTypeRequest(t, http.MethodGet, s.URL+"/testprotos.DoesNotExist", nil)
+	testutil.Eq(t, http.StatusNotFound, resp.StatusCode)
+	resp, _ = doTypeRequest(t, http.MethodGet, s.URL+"/", nil)
+	testutil.Eq(t, http.StatusNotFound, resp.StatusCode)
+	// packages are not types
+	resp, _ = doTypeRequest(t, http.MethodGet, s.URL+"/testprotos", nil)
+	testutil.Eq(t, http.StatusNotFound, resp.StatusCode)
+
+	resp, _ = doTypeRequest(t, http.MethodPost, s.URL+"/testprotos.TestRequest", nil)
+	testutil.Eq(t, http.StatusMethodNotAllowed, resp.StatusCode)
+	testutil.Eq(t, "GET, HEAD", resp.Header.Get("Allow"))
+
+	resp, _ = doTypeRequest(t, http.MethodGet, s.URL+"/testprotos.TestRequest", map[string]string{"Accept": "text/html, application/json;q=0"})
+	testutil.Eq(t, http.StatusNotAcceptable, resp.StatusCode)
+}
+
+func TestTypeServer_WithHttpTypeFetcher(t *testing.T) {
+	_, s := newTestTypeServer(t)
+
+	// a registry in another process resolves Any messages using the server
+	mr := (&MessageRegistry{}).WithFetcher(HttpTypeFetcher(http.DefaultTransport, 65536, 10))
+	msg := &testprotos.TestRequest{
+		Foo: []testprotos.Proto3Enum{testprotos.Proto3Enum_VALUE1},
+		Bar: "bar",
+		Baz: &testprotos.TestMessage{Ne: []testprotos.TestMessage_NestedEnum{testprotos.TestMessage_VALUE2}},
+	}
+	a, err := anypb.New(msg)
+	testutil.Ok(t, err)
+	a.TypeUrl = s.URL + "/" + strings.TrimPrefix(a.TypeUrl, "type.googleapis.com/")
+	pm, err := mr.UnmarshalAny(a)
+	testutil.Ok(t, err)
+	dm := pm.(*dynamic.Message)
+	testutil.Eq(t, "testprotos.TestRequest", dm.GetMessageDescriptor().GetFullyQualifiedName())
+	testutil.Require(t, dynamic.MessagesEqual(msg, dm), "%v != %v", msg, dm)
+}
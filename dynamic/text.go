@@ -4,6 +4,7 @@ package dynamic
 
 import (
 	"bytes"
+	"errors"
 	"fmt"
 	"io"
 	"math"
@@ -13,6 +14,8 @@ import (
 	"strings"
 	"text/scanner"
 	"unicode"
+	"unicode/utf16"
+	"unicode/utf8"
 
 	"github.com/golang/protobuf/proto"
 	"google.golang.org/protobuf/types/descriptorpb"
@@ -41,10 +44,11 @@ func (m *Message) MarshalText() ([]byte, error) {
 // be a valid UTF8 string.
 //
 // This method uses a "pretty-printed" form, with each field on its own line and
-// spaces between field identifiers and values.
+// spaces between field identifiers and values. Use a TextMarshaler to control
+// the indentation.
 func (m *Message) MarshalTextIndent() ([]byte, error) {
 	var b indentBuffer
-	b.indent = "  " // TODO: option for indent?
+	b.indent = "  "
 	if err := m.marshalText(&b); err != nil {
 		return nil, err
 	}
@@ -52,7 +56,13 @@ func (m *Message) MarshalTextIndent() ([]byte, error) {
 }
 
 func (m *Message) marshalText(b *indentBuffer) error {
-	// TODO: option for emitting extended Any format?
+	if b.anyx != nil && isAny(m) {
+		r, _ := wrapResolver(b.anyx.resolver, m.mf, m.md.GetFile())
+		if typeUrl, dm := b.anyx.expand(m, r); dm != nil {
+			return marshalExpandedAnyText(b, typeUrl, dm)
+		}
+		// otherwise, fall through to write Any in raw form
+	}
 	first := true
 	// first the known fields
 	for _, tag := range m.knownFieldTags() {
@@ -160,6 +170,36 @@ func (m *Message) marshalText(b *indentBuffer) error {
 	return nil
 }
 
+func marshalExpandedAnyText(b *indentBuffer, typeUrl string, dm *Message) error {
+	_, err := fmt.Fprintf(b, "[%s]", typeUrl)
+	if err != nil {
+		return err
+	}
+	err = b.sep()
+	if err != nil {
+		return err
+	}
+	err = b.WriteByte('<')
+	if err != nil {
+		return err
+	}
+	err = b.start()
+	if err != nil {
+		return err
+	}
+	b.anyx.depth++
+	err = dm.marshalText(b)
+	b.anyx.depth--
+	if err != nil {
+		return err
+	}
+	err = b.end()
+	if err != nil {
+		return err
+	}
+	return b.WriteByte('>')
+}
+
 func marshalKnownFieldMapEntryText(b *indentBuffer, fd *desc.FieldDescriptor, kfd *desc.FieldDescriptor, mk interface{}, vfd *desc.FieldDescriptor, mv interface{}) error {
 	var name string
 	if fd.IsExtension() {
@@ -207,8 +247,26 @@ func marshalKnownFieldMapEntryText(b *indentBuffer, fd *desc.FieldDescriptor, kf
 	return b.WriteByte('>')
 }
 
+// isGroupLike returns true if the given field should be named in the text
+// format using the name of its message type, like a proto2 group. In files
+// that use editions, a delimited field is only group-like when the field name
+// is the lower-case form of its message's name and the message is declared in
+// the same scope as the field.
+func isGroupLike(fd *desc.FieldDescriptor) bool {
+	if fd.GetType() != descriptorpb.FieldDescriptorProto_TYPE_GROUP {
+		return false
+	}
+	if !fd.GetFile().IsEditions() {
+		return true
+	}
+	md := fd.GetMessageType()
+	return fd.GetName() == strings.ToLower(md.GetName()) &&
+		md.GetFile() == fd.GetFile() &&
+		md.GetParent() == fd.GetParent()
+}
+
 func marshalKnownFieldText(b *indentBuffer, fd *desc.FieldDescriptor, v interface{}) error {
-	group := fd.GetType() == descriptorpb.FieldDescriptorProto_TYPE_GROUP
+	group := isGroupLike(fd)
 	if group {
 		var name string
 		if fd.IsExtension() {
@@ -304,6 +362,16 @@ func marshalKnownFieldText(b *indentBuffer, fd *desc.FieldDescriptor, v interfac
 			if err != nil {
 				return err
 			}
+		} else if b.anyx != nil {
+			// use a dynamic message so that nested Any messages are expanded
+			dm, err := AsDynamicMessage(v.(proto.Message))
+			if err != nil {
+				return err
+			}
+			err = dm.marshalText(b)
+			if err != nil {
+				return err
+			}
 		} else {
 			err = proto.CompactText(b, v.(proto.Message))
 			if err != nil {
@@ -451,7 +519,14 @@ func marshalUnknownGroupText(b *indentBuffer, in *codec.Buffer, topLevel bool) e
 // UnmarshalText de-serializes the message that is present, in text format, in
 // the given bytes into this message. It first resets the current message. It
 // returns an error if the given bytes do not contain a valid encoding of this
-// message type in the standard text format
+// message type in the standard text format. If the input is malformed, the
+// error is a *TextParseError, which indicates where the problem was found.
+//
+// Extension fields, named like "[pkg.ext]", are resolved using the message's
+// ExtensionRegistry. Expanded Any messages, named like
+// "[type.googleapis.com/pkg.Msg]", can refer to types known to the message's
+// descriptor or linked into the program. Use a TextUnmarshaler to resolve
+// other types.
 func (m *Message) UnmarshalText(text []byte) error {
 	m.Reset()
 	if err := m.UnmarshalMergeText(text); err != nil {
@@ -475,15 +550,17 @@ func (m *Message) unmarshalText(tr *txtReader, end tokenType) error {
 			return nil
 		}
 		if tok.tokTyp == tokenEOF {
-			return io.ErrUnexpectedEOF
+			return eofError(tok)
 		}
+		// copy the token since parsing the field name overwrites it
+		nameTok := *tok
 		var fd *desc.FieldDescriptor
 		var extendedAnyType *desc.MessageDescriptor
 		if tok.tokTyp == tokenInt {
 			// tag number (indicates unknown field)
 			tag, err := strconv.ParseInt(tok.val.(string), 10, 32)
 			if err != nil {
-				return err
+				return textError(tok, "Invalid tag number %q: %v", tok.txt, err.(*strconv.NumError).Err)
 			}
 			itag := int32(tag)
 			fd = m.FindFieldDescriptor(itag)
@@ -491,9 +568,9 @@ func (m *Message) unmarshalText(tr *txtReader, end tokenType) error {
 				// can't parse the value w/out field descriptor, so skip it
 				tok = tr.next()
 				if tok.tokTyp == tokenEOF {
-					return io.ErrUnexpectedEOF
-				} else if tok.tokTyp == tokenOpenBrace {
-					if err := skipMessageText(tr, true); err != nil {
+					return eofError(tok)
+				} else if tok.tokTyp == tokenOpenBrace || tok.tokTyp == tokenOpenAngle {
+					if err := skipMessageText(tr, tok.tokTyp == tokenOpenBrace); err != nil {
 						return err
 					}
 				} else if tok.tokTyp == tokenColon {
@@ -501,7 +578,7 @@ func (m *Message) unmarshalText(tr *txtReader, end tokenType) error {
 						return err
 					}
 				} else {
-					return textError(tok, "Expecting a colon ':' or brace '{'; instead got %q", tok.txt)
+					return textError(tok, "Expecting a colon ':' or brace '{' or '<'; instead got %q", tok.txt)
 				}
 				tok = tr.peek()
 				if tok.tokTyp.IsSep() {
@@ -518,11 +595,15 @@ func (m *Message) unmarshalText(tr *txtReader, end tokenType) error {
 			if fd == nil {
 				// See if it's a group name
 				for _, field := range m.md.GetFields() {
-					if field.GetType() == descriptorpb.FieldDescriptorProto_TYPE_GROUP && field.GetMessageType().GetName() == fieldName {
+					if isGroupLike(field) && field.GetMessageType().GetName() == fieldName {
 						fd = field
 						break
 					}
 				}
+				if fd == nil && fieldName[0] == '[' {
+					// group-like extensions are named using their message type
+					fd = m.findGroupLikeExtension(fieldName[1 : len(fieldName)-1])
+				}
 				if fd == nil {
 					// maybe this is an extended Any
 					if m.md.GetFullyQualifiedName() == "google.protobuf.Any" && fieldName[0] == '[' && strings.Contains(fieldName, "/") {
@@ -532,10 +613,18 @@ func (m *Message) unmarshalText(tr *txtReader, end tokenType) error {
 						if slash := strings.LastIndex(mname, "/"); slash >= 0 {
 							mname = mname[slash+1:]
 						}
-						// TODO: add a way to weave an AnyResolver to this point
-						extendedAnyType = findMessageDescriptor(mname, m.md.GetFile())
+						if tr.anyx != nil {
+							r, _ := wrapResolver(tr.anyx.resolver, m.mf, m.md.GetFile())
+							dm, err := tr.anyx.resolve(m, r, typeUrl)
+							if err != nil {
+								return textError(&nameTok, "could not parse Any with type URL %q: %v", fieldName, err)
+							}
+							extendedAnyType = dm.md
+						} else {
+							extendedAnyType = findMessageDescriptor(mname, m.md.GetFile())
+						}
 						if extendedAnyType == nil {
-							return textError(tok, "could not parse Any with unknown type URL %q", fieldName)
+							return textError(&nameTok, "could not parse Any with unknown type URL %q", fieldName)
 						}
 						// field 1 is "type_url"
 						typeUrlField := m.md.FindFieldByNumber(1)
@@ -544,21 +633,21 @@ func (m *Message) unmarshalText(tr *txtReader, end tokenType) error {
 						}
 					} else {
 						// TODO: add a flag to just ignore unrecognized field names
-						return textError(tok, "%q is not a recognized field name of %q", fieldName, m.md.GetFullyQualifiedName())
+						return textError(&nameTok, "%q is not a recognized field name of %q", fieldName, m.md.GetFullyQualifiedName())
 					}
 				}
 			}
 		}
 		tok = tr.next()
 		if tok.tokTyp == tokenEOF {
-			return io.ErrUnexpectedEOF
+			return eofError(tok)
 		}
 		if extendedAnyType != nil {
 			// consume optional colon; make sure this is a "start message" token
 			if tok.tokTyp == tokenColon {
 				tok = tr.next()
 				if tok.tokTyp == tokenEOF {
-					return io.ErrUnexpectedEOF
+					return eofError(tok)
 				}
 			}
 			if tok.tokTyp.EndToken() == tokenError {
@@ -567,7 +656,14 @@ func (m *Message) unmarshalText(tr *txtReader, end tokenType) error {
 
 			// TODO: use mf.NewMessage and, if not a dynamic message, use proto.UnmarshalText to unmarshal it
 			g := m.mf.NewDynamicMessage(extendedAnyType)
-			if err := g.unmarshalText(tr, tok.tokTyp.EndToken()); err != nil {
+			if tr.anyx != nil {
+				tr.anyx.depth++
+			}
+			err := g.unmarshalText(tr, tok.tokTyp.EndToken())
+			if tr.anyx != nil {
+				tr.anyx.depth--
+			}
+			if err != nil {
 				return err
 			}
 			// now we marshal the message to bytes and store in the Any
@@ -613,6 +709,23 @@ func (m *Message) unmarshalText(tr *txtReader, end tokenType) error {
 		}
 	}
 }
+
+// findGroupLikeExtension returns the group-like extension of this message whose
+// message type has the given fully-qualified name, or nil if there is none.
+func (m *Message) findGroupLikeExtension(name string) *desc.FieldDescriptor {
+	for _, fd := range m.er.AllExtensionsForType(m.md.GetFullyQualifiedName()) {
+		if isGroupLike(fd) && fd.GetMessageType().GetFullyQualifiedName() == name {
+			return fd
+		}
+	}
+	for _, fd := range m.extraFields {
+		if fd.IsExtension() && isGroupLike(fd) && fd.GetMessageType().GetFullyQualifiedName() == name {
+			return fd
+		}
+	}
+	return nil
+}
+
 func findMessageDescriptor(name string, fd *desc.FileDescriptor) *desc.MessageDescriptor {
 	md := findMessageInTransitiveDeps(name, fd, map[*desc.FileDescriptor]struct{}{})
 	if md == nil {
@@ -643,14 +756,44 @@ func findMessageInTransitiveDeps(name string, fd *desc.FileDescriptor, seen map[
 	return nil
 }
 
+// TextParseError is the type of error returned when text format input cannot
+// be parsed. It indicates where in the input the problem was found.
+type TextParseError struct {
+	// The line and column of the input where the error occurred. Both are
+	// one-based.
+	Line, Column int
+	// The underlying cause. If the input was truncated, this will be
+	// io.ErrUnexpectedEOF.
+	Err error
+}
+
+// Error implements the error interface.
+func (e *TextParseError) Error() string {
+	return fmt.Sprintf("line %d, col %d: %v", e.Line, e.Column, e.Err)
+}
+
+// Unwrap returns the underlying cause of the error.
+func (e *TextParseError) Unwrap() error {
+	return e.Err
+}
+
 func textError(tok *token, format string, args ...interface{}) error {
-	var msg string
-	if tok.tokTyp == tokenError {
-		msg = tok.val.(error).Error()
-	} else {
-		msg = fmt.Sprintf(format, args...)
+	var err error
+	switch tok.tokTyp {
+	case tokenError:
+		err = tok.val.(error)
+	case tokenEOF:
+		err = io.ErrUnexpectedEOF
+	default:
+		err = fmt.Errorf(format, args...)
 	}
-	return fmt.Errorf("line %d, col %d: %s", tok.pos.Line, tok.pos.Column, msg)
+	return &TextParseError{Line: tok.pos.Line, Column: tok.pos.Column, Err: err}
+}
+
+// eofError returns an error that indicates the input ended prematurely at the
+// given token.
+func eofError(tok *token) error {
+	return textError(tok, "")
 }
 
 type setFunction func(*Message, *desc.FieldDescriptor, interface{}) error
@@ -682,93 +825,81 @@ func (m *Message) unmarshalFieldValueText(fd *desc.FieldDescriptor, tr *txtReade
 }
 
 func (m *Message) unmarshalFieldElementText(fd *desc.FieldDescriptor, tr *txtReader, set setFunction) error {
-	tok := tr.next()
+	// copy the token since peeking at subsequent tokens overwrites it
+	tok := *tr.next()
 	if tok.tokTyp == tokenEOF {
-		return io.ErrUnexpectedEOF
+		return eofError(&tok)
+	}
+	if tok.tokTyp == tokenMinus {
+		// allow whitespace between a minus sign and the number it negates
+		if peeked := tr.peek(); peeked.tokTyp == tokenInt || peeked.tokTyp == tokenFloat {
+			num := *tr.next()
+			num.pos = tok.pos
+			num.txt = "-" + num.txt
+			if num.tokTyp == tokenInt {
+				num.val = "-" + num.val.(string)
+			} else {
+				num.val = -num.val.(float64)
+			}
+			tok = num
+		}
+	}
+	origSet := set
+	set = func(m *Message, fd *desc.FieldDescriptor, v interface{}) error {
+		if err := origSet(m, fd, v); err != nil {
+			return textError(&tok, "%w", err)
+		}
+		return nil
 	}
 
 	var expected string
 	switch fd.GetType() {
 	case descriptorpb.FieldDescriptorProto_TYPE_BOOL:
+		// same spellings as the reference implementation: these identifiers
+		// and any unsigned integer literal whose value is 0 or 1
 		if tok.tokTyp == tokenIdent {
-			if tok.val.(string) == "true" {
+			switch tok.txt {
+			case "true", "True", "t":
 				return set(m, fd, true)
-			} else if tok.val.(string) == "false" {
+			case "false", "False", "f":
 				return set(m, fd, false)
 			}
+		} else if tok.tokTyp == tokenInt {
+			digits, base := textIntDigits(tok.val.(string))
+			if u, err := strconv.ParseUint(digits, base, 64); err == nil && u <= 1 {
+				return set(m, fd, u == 1)
+			}
 		}
 		expected = "boolean value"
 	case descriptorpb.FieldDescriptorProto_TYPE_BYTES:
 		if tok.tokTyp == tokenString {
-			return set(m, fd, []byte(tok.val.(string)))
+			return set(m, fd, []byte(tr.stringValue(&tok)))
 		}
 		expected = "bytes string value"
 	case descriptorpb.FieldDescriptorProto_TYPE_STRING:
 		if tok.tokTyp == tokenString {
-			return set(m, fd, tok.val)
+			return set(m, fd, tr.stringValue(&tok))
 		}
 		expected = "string value"
 	case descriptorpb.FieldDescriptorProto_TYPE_FLOAT:
-		switch tok.tokTyp {
-		case tokenFloat:
-			return set(m, fd, float32(tok.val.(float64)))
-		case tokenInt:
-			if f, err := strconv.ParseFloat(tok.val.(string), 32); err != nil {
-				return err
-			} else {
-				return set(m, fd, float32(f))
-			}
-		case tokenIdent:
-			ident := strings.ToLower(tok.val.(string))
-			if ident == "inf" {
-				return set(m, fd, float32(math.Inf(1)))
-			} else if ident == "nan" {
-				return set(m, fd, float32(math.NaN()))
-			}
-		case tokenMinus:
-			peeked := tr.peek()
-			if peeked.tokTyp == tokenIdent {
-				ident := strings.ToLower(peeked.val.(string))
-				if ident == "inf" {
-					tr.next() // consume peeked token
-					return set(m, fd, float32(math.Inf(-1)))
-				}
-			}
+		if f, ok, err := parseTextFloat(&tok, tr, 32); err != nil {
+			return err
+		} else if ok {
+			return set(m, fd, float32(f))
 		}
 		expected = "float value"
 	case descriptorpb.FieldDescriptorProto_TYPE_DOUBLE:
-		switch tok.tokTyp {
-		case tokenFloat:
-			return set(m, fd, tok.val)
-		case tokenInt:
-			if f, err := strconv.ParseFloat(tok.val.(string), 64); err != nil {
-				return err
-			} else {
-				return set(m, fd, f)
-			}
-		case tokenIdent:
-			ident := strings.ToLower(tok.val.(string))
-			if ident == "inf" {
-				return set(m, fd, math.Inf(1))
-			} else if ident == "nan" {
-				return set(m, fd, math.NaN())
-			}
-		case tokenMinus:
-			peeked := tr.peek()
-			if peeked.tokTyp == tokenIdent {
-				ident := strings.ToLower(peeked.val.(string))
-				if ident == "inf" {
-					tr.next() // consume peeked token
-					return set(m, fd, math.Inf(-1))
-				}
-			}
+		if f, ok, err := parseTextFloat(&tok, tr, 64); err != nil {
+			return err
+		} else if ok {
+			return set(m, fd, f)
 		}
 		expected = "float value"
 	case descriptorpb.FieldDescriptorProto_TYPE_INT32,
 		descriptorpb.FieldDescriptorProto_TYPE_SINT32,
 		descriptorpb.FieldDescriptorProto_TYPE_SFIXED32:
 		if tok.tokTyp == tokenInt {
-			if i, err := strconv.ParseInt(tok.val.(string), 10, 32); err != nil {
+			if i, err := parseTextInt(&tok, 32); err != nil {
 				return err
 			} else {
 				return set(m, fd, int32(i))
@@ -779,7 +910,7 @@ func (m *Message) unmarshalFieldElementText(fd *desc.FieldDescriptor, tr *txtRea
 		descriptorpb.FieldDescriptorProto_TYPE_SINT64,
 		descriptorpb.FieldDescriptorProto_TYPE_SFIXED64:
 		if tok.tokTyp == tokenInt {
-			if i, err := strconv.ParseInt(tok.val.(string), 10, 64); err != nil {
+			if i, err := parseTextInt(&tok, 64); err != nil {
 				return err
 			} else {
 				return set(m, fd, i)
@@ -789,7 +920,7 @@ func (m *Message) unmarshalFieldElementText(fd *desc.FieldDescriptor, tr *txtRea
 	case descriptorpb.FieldDescriptorProto_TYPE_UINT32,
 		descriptorpb.FieldDescriptorProto_TYPE_FIXED32:
 		if tok.tokTyp == tokenInt {
-			if i, err := strconv.ParseUint(tok.val.(string), 10, 32); err != nil {
+			if i, err := parseTextUint(&tok, 32); err != nil {
 				return err
 			} else {
 				return set(m, fd, uint32(i))
@@ -799,7 +930,7 @@ func (m *Message) unmarshalFieldElementText(fd *desc.FieldDescriptor, tr *txtRea
 	case descriptorpb.FieldDescriptorProto_TYPE_UINT64,
 		descriptorpb.FieldDescriptorProto_TYPE_FIXED64:
 		if tok.tokTyp == tokenInt {
-			if i, err := strconv.ParseUint(tok.val.(string), 10, 64); err != nil {
+			if i, err := parseTextUint(&tok, 64); err != nil {
 				return err
 			} else {
 				return set(m, fd, i)
@@ -814,7 +945,7 @@ func (m *Message) unmarshalFieldElementText(fd *desc.FieldDescriptor, tr *txtRea
 				return set(m, fd, vd.GetNumber())
 			}
 		} else if tok.tokTyp == tokenInt {
-			if i, err := strconv.ParseInt(tok.val.(string), 10, 32); err != nil {
+			if i, err := parseTextInt(&tok, 32); err != nil {
 				return err
 			} else {
 				return set(m, fd, int32(i))
@@ -858,7 +989,7 @@ func (m *Message) unmarshalFieldElementText(fd *desc.FieldDescriptor, tr *txtRea
 	} else {
 		article = "a"
 	}
-	return textError(tok, "Expecting %s %s; got %q", article, expected, tok.txt)
+	return textError(&tok, "Expecting %s %s; got %q", article, expected, tok.txt)
 }
 
 func unmarshalFieldNameText(tr *txtReader, tok *token) (string, error) {
@@ -878,7 +1009,7 @@ func unmarshalFieldNameText(tr *txtReader, tok *token) (string, error) {
 		for {
 			tok = tr.next()
 			if tok.tokTyp == tokenEOF {
-				return "", io.ErrUnexpectedEOF
+				return "", eofError(tok)
 			} else if tok.tokTyp != tokenIdent {
 				return "", textError(tok, "Expecting an identifier; instead got %q", tok.txt)
 			}
@@ -886,7 +1017,7 @@ func unmarshalFieldNameText(tr *txtReader, tok *token) (string, error) {
 			// and then close bracket/paren, or "/" to keep adding URL elements to name
 			tok = tr.next()
 			if tok.tokTyp == tokenEOF {
-				return "", io.ErrUnexpectedEOF
+				return "", eofError(tok)
 			} else if tok.tokTyp == closeType {
 				break
 			} else if tok.tokTyp != tokenSlash {
@@ -905,7 +1036,7 @@ func unmarshalFieldNameText(tr *txtReader, tok *token) (string, error) {
 func skipFieldNameText(tr *txtReader) error {
 	tok := tr.next()
 	if tok.tokTyp == tokenEOF {
-		return io.ErrUnexpectedEOF
+		return eofError(tok)
 	} else if tok.tokTyp == tokenInt || tok.tokTyp == tokenIdent {
 		return nil
 	} else {
@@ -939,11 +1070,26 @@ func skipFieldElementText(tr *txtReader) error {
 	tok := tr.next()
 	switch tok.tokTyp {
 	case tokenEOF:
-		return io.ErrUnexpectedEOF
-	case tokenInt, tokenFloat, tokenString, tokenIdent:
+		return eofError(tok)
+	case tokenInt, tokenFloat, tokenIdent:
 		return nil
+	case tokenString:
+		tr.stringValue(tok)
+		return nil
+	case tokenMinus:
+		// negative number or negative infinity
+		tok = tr.next()
+		switch tok.tokTyp {
+		case tokenEOF:
+			return eofError(tok)
+		case tokenInt, tokenFloat, tokenIdent:
+			return nil
+		}
+		return textError(tok, "Expecting a number; instead got %q", tok.txt)
 	case tokenOpenAngle:
 		return skipMessageText(tr, false)
+	case tokenOpenBrace:
+		return skipMessageText(tr, true)
 	default:
 		return textError(tok, "Expecting an angle bracket '<' or a value; instead got %q", tok.txt)
 	}
@@ -953,10 +1099,10 @@ func skipMessageText(tr *txtReader, isGroup bool) error {
 	for {
 		tok := tr.peek()
 		if tok.tokTyp == tokenEOF {
-			return io.ErrUnexpectedEOF
-		} else if isGroup && tok.tokTyp == tokenCloseBrace {
-			return nil
-		} else if !isGroup && tok.tokTyp == tokenCloseAngle {
+			return eofError(tok)
+		} else if (isGroup && tok.tokTyp == tokenCloseBrace) ||
+			(!isGroup && tok.tokTyp == tokenCloseAngle) {
+			tr.next() // consume tok
 			return nil
 		}
 
@@ -968,9 +1114,9 @@ func skipMessageText(tr *txtReader, isGroup bool) error {
 		// field value
 		tok = tr.next()
 		if tok.tokTyp == tokenEOF {
-			return io.ErrUnexpectedEOF
-		} else if tok.tokTyp == tokenOpenBrace {
-			if err := skipMessageText(tr, true); err != nil {
+			return eofError(tok)
+		} else if tok.tokTyp == tokenOpenBrace || tok.tokTyp == tokenOpenAngle {
+			if err := skipMessageText(tr, tok.tokTyp == tokenOpenBrace); err != nil {
 				return err
 			}
 		} else if tok.tokTyp == tokenColon {
@@ -978,7 +1124,7 @@ func skipMessageText(tr *txtReader, isGroup bool) error {
 				return err
 			}
 		} else {
-			return textError(tok, "Expecting a colon ':' or brace '{'; instead got %q", tok.txt)
+			return textError(tok, "Expecting a colon ':' or brace '{' or '<'; instead got %q", tok.txt)
 		}
 
 		tok = tr.peek()
@@ -1038,6 +1184,8 @@ type txtReader struct {
 	scanner    scanner.Scanner
 	peeked     token
 	havePeeked bool
+	// if non-nil, used to resolve types of expanded Any messages
+	anyx *anyExpansion
 }
 
 func newReader(text []byte) *txtReader {
@@ -1062,6 +1210,11 @@ func (p *txtReader) peek() *token {
 		return &p.peeked
 	}
 	t := p.scanner.Scan()
+	for t == '#' {
+		// comment that runs to the end of the line
+		p.skipLine()
+		t = p.scanner.Scan()
+	}
 	if t == scanner.EOF {
 		p.peeked.tokTyp = tokenEOF
 		p.peeked.val = nil
@@ -1075,6 +1228,25 @@ func (p *txtReader) peek() *token {
 	return &p.peeked
 }
 
+// stringValue returns the value of the given string token, concatenated with
+// the values of any string tokens that immediately follow it.
+func (p *txtReader) stringValue(tok *token) string {
+	str := tok.val.(string)
+	for p.peek().tokTyp == tokenString {
+		str += p.next().val.(string)
+	}
+	return str
+}
+
+func (p *txtReader) skipLine() {
+	for {
+		ch := p.scanner.Next()
+		if ch == '\n' || ch == scanner.EOF {
+			return
+		}
+	}
+}
+
 func (p *txtReader) processToken(t rune, text string, pos scanner.Position) error {
 	p.peeked.pos = pos
 	p.peeked.txt = text
@@ -1082,48 +1254,26 @@ func (p *txtReader) processToken(t rune, text string, pos scanner.Position) erro
 	case scanner.Ident:
 		p.peeked.tokTyp = tokenIdent
 		p.peeked.val = text
-	case scanner.Int:
-		p.peeked.tokTyp = tokenInt
-		p.peeked.val = text // can't parse the number because we don't know if it's signed or unsigned
-	case scanner.Float:
-		p.peeked.tokTyp = tokenFloat
-		var err error
-		if p.peeked.val, err = strconv.ParseFloat(text, 64); err != nil {
-			return err
-		}
+	case scanner.Int, scanner.Float:
+		return p.processNumber(t, text)
 	case scanner.Char, scanner.String:
 		p.peeked.tokTyp = tokenString
 		var err error
-		if p.peeked.val, err = strconv.Unquote(text); err != nil {
+		if p.peeked.val, err = unquoteText(text); err != nil {
 			return err
 		}
 	case '-': // unary minus, for negative ints and floats
 		ch := p.scanner.Peek()
-		if ch < '0' || ch > '9' {
+		if (ch < '0' || ch > '9') && ch != '.' {
 			p.peeked.tokTyp = tokenMinus
 			p.peeked.val = '-'
 		} else {
 			t := p.scanner.Scan()
-			if t == scanner.EOF {
-				return io.ErrUnexpectedEOF
-			} else if t == scanner.Float {
-				p.peeked.tokTyp = tokenFloat
-				text += p.scanner.TokenText()
-				p.peeked.txt = text
-				var err error
-				if p.peeked.val, err = strconv.ParseFloat(text, 64); err != nil {
-					p.peeked.pos = p.scanner.Position
-					return err
-				}
-			} else if t == scanner.Int {
-				p.peeked.tokTyp = tokenInt
-				text += p.scanner.TokenText()
-				p.peeked.txt = text
-				p.peeked.val = text // can't parse the number because we don't know if it's signed or unsigned
-			} else {
+			if t != scanner.Int && t != scanner.Float {
 				p.peeked.pos = p.scanner.Position
 				return fmt.Errorf("expecting an int or float but got %q", p.scanner.TokenText())
 			}
+			return p.processNumber(t, text+p.scanner.TokenText())
 		}
 	case ':':
 		p.peeked.tokTyp = tokenColon
@@ -1168,6 +1318,34 @@ func (p *txtReader) processToken(t rune, text string, pos scanner.Position) erro
 	return nil
 }
 
+// processNumber sets the peeked token to the given numeric literal. Integers
+// remain unparsed since their interpretation depends on the type of the field
+// they are used with. A literal that is followed by an "f" or "F" suffix is a
+// float.
+func (p *txtReader) processNumber(t rune, text string) error {
+	p.peeked.txt = text
+	if ch := p.scanner.Peek(); ch == 'f' || ch == 'F' {
+		if _, base := textIntDigits(text); t == scanner.Float || base == 10 {
+			p.scanner.Next()
+			p.peeked.txt += string(ch)
+			t = scanner.Float
+		}
+	}
+	if t == scanner.Int {
+		p.peeked.tokTyp = tokenInt
+		p.peeked.val = text // can't parse the number because we don't know if it's signed or unsigned
+		return nil
+	}
+	p.peeked.tokTyp = tokenFloat
+	f, err := strconv.ParseFloat(text, 64)
+	if err != nil && !errors.Is(err, strconv.ErrRange) {
+		return err
+	}
+	// out of range values are rounded to zero or infinity
+	p.peeked.val = f
+	return nil
+}
+
 func (p *txtReader) next() *token {
 	t := p.peek()
 	if t.tokTyp != tokenEOF && t.tokTyp != tokenError {
@@ -1175,3 +1353,201 @@ func (p *txtReader) next() *token {
 	}
 	return t
 }
+
+// textIntDigits returns the digits of the given integer literal, with any
+// sign retained but the base prefix removed, along with the base. The text
+// format supports decimal, hexadecimal (with a "0x" prefix), and octal (with
+// a leading zero) literals.
+func textIntDigits(s string) (string, int) {
+	var sign string
+	if strings.HasPrefix(s, "-") {
+		sign, s = "-", s[1:]
+	}
+	switch {
+	case len(s) > 2 && (s[:2] == "0x" || s[:2] == "0X"):
+		return sign + s[2:], 16
+	case len(s) > 1 && s[0] == '0':
+		return sign + s[1:], 8
+	default:
+		return sign + s, 10
+	}
+}
+
+func parseTextInt(tok *token, bitSize int) (int64, error) {
+	digits, base := textIntDigits(tok.val.(string))
+	i, err := strconv.ParseInt(digits, base, bitSize)
+	if err != nil {
+		return 0, textError(tok, "Invalid int value %q: %v", tok.txt, err.(*strconv.NumError).Err)
+	}
+	return i, nil
+}
+
+func parseTextUint(tok *token, bitSize int) (uint64, error) {
+	digits, base := textIntDigits(tok.val.(string))
+	u, err := strconv.ParseUint(digits, base, bitSize)
+	if err != nil {
+		return 0, textError(tok, "Invalid unsigned int value %q: %v", tok.txt, err.(*strconv.NumError).Err)
+	}
+	return u, nil
+}
+
+// parseTextFloat returns the value of the given token as a float. The token
+// may be a numeric literal or one of the identifiers "inf", "infinity", or
+// "nan" (case-insensitive). If the token is a minus sign, the identifier that
+// follows it is consumed and the negated value is returned. The returned bool
+// is false if the token does not represent a float.
+func parseTextFloat(tok *token, tr *txtReader, bitSize int) (float64, bool, error) {
+	switch tok.tokTyp {
+	case tokenFloat:
+		return tok.val.(float64), true, nil
+	case tokenInt:
+		digits, base := textIntDigits(tok.val.(string))
+		if base == 10 {
+			f, err := strconv.ParseFloat(digits, bitSize)
+			if err != nil && !errors.Is(err, strconv.ErrRange) {
+				return 0, false, textError(tok, "Invalid float value %q: %v", tok.txt, err.(*strconv.NumError).Err)
+			}
+			return f, true, nil
+		}
+		i, err := strconv.ParseInt(digits, base, 64)
+		if err != nil {
+			return 0, false, textError(tok, "Invalid float value %q: %v", tok.txt, err.(*strconv.NumError).Err)
+		}
+		return float64(i), true, nil
+	case tokenIdent:
+		switch strings.ToLower(tok.val.(string)) {
+		case "inf", "infinity":
+			return math.Inf(1), true, nil
+		case "nan":
+			return math.NaN(), true, nil
+		}
+	case tokenMinus:
+		peeked := tr.peek()
+		if peeked.tokTyp == tokenIdent {
+			switch strings.ToLower(peeked.val.(string)) {
+			case "inf", "infinity":
+				tr.next() // consume peeked token
+				return math.Inf(-1), true, nil
+			case "nan":
+				tr.next() // consume peeked token
+				return math.NaN(), true, nil
+			}
+		}
+	}
+	return 0, false, nil
+}
+
+// unquoteText returns the value of the given string literal, which may be
+// enclosed in single or double quotes. Unlike strconv.Unquote, this supports
+// the escape sequences of the text format: octal and hex escapes may have
+// fewer than three and two digits, respectively, and denote bytes, so the
+// result is not necessarily valid UTF8.
+func unquoteText(s string) (string, error) {
+	if len(s) < 2 || (s[0] != '"' && s[0] != '\'') || s[len(s)-1] != s[0] {
+		return "", fmt.Errorf("string literal not terminated: %s", s)
+	}
+	quote := s[0]
+	s = s[1 : len(s)-1]
+	buf := make([]byte, 0, len(s))
+	for i := 0; i < len(s); {
+		c := s[i]
+		i++
+		if c == quote || c == '\n' {
+			return "", fmt.Errorf("invalid character %q in string literal", c)
+		}
+		if c != '\\' {
+			buf = append(buf, c)
+			continue
+		}
+		if i >= len(s) {
+			return "", errors.New("string literal not terminated")
+		}
+		c = s[i]
+		i++
+		switch c {
+		case 'a':
+			buf = append(buf, '\a')
+		case 'b':
+			buf = append(buf, '\b')
+		case 'f':
+			buf = append(buf, '\f')
+		case 'n':
+			buf = append(buf, '\n')
+		case 'r':
+			buf = append(buf, '\r')
+		case 't':
+			buf = append(buf, '\t')
+		case 'v':
+			buf = append(buf, '\v')
+		case '\\', '\'', '"', '?':
+			buf = append(buf, c)
+		case '0', '1', '2', '3', '4', '5', '6', '7':
+			// up to three octal digits
+			start := i - 1
+			for i < len(s) && i-start < 3 && s[i] >= '0' && s[i] <= '7' {
+				i++
+			}
+			v, err := strconv.ParseUint(s[start:i], 8, 8)
+			if err != nil {
+				return "", fmt.Errorf("invalid octal escape \\%s", s[start:i])
+			}
+			buf = append(buf, byte(v))
+		case 'x', 'X':
+			// one or two hex digits
+			start := i
+			for i < len(s) && i-start < 2 && isHexDigit(s[i]) {
+				i++
+			}
+			if i == start {
+				return "", fmt.Errorf("invalid hex escape \\%c", c)
+			}
+			v, _ := strconv.ParseUint(s[start:i], 16, 8)
+			buf = append(buf, byte(v))
+		case 'u', 'U':
+			r, n, err := unquoteUnicodeEscape(s[i-2:])
+			if err != nil {
+				return "", err
+			}
+			i += n - 2
+			if utf16.IsSurrogate(r) {
+				// must be a pair of surrogates
+				var r2 rune
+				var n2 int
+				if strings.HasPrefix(s[i:], "\\u") {
+					r2, n2, err = unquoteUnicodeEscape(s[i:])
+				}
+				if err != nil || n2 == 0 || utf16.DecodeRune(r, r2) == unicode.ReplacementChar {
+					return "", fmt.Errorf("invalid unicode escape %s: unpaired surrogate", s[i-n:i])
+				}
+				i += n2
+				r = utf16.DecodeRune(r, r2)
+			}
+			var enc [utf8.UTFMax]byte
+			buf = append(buf, enc[:utf8.EncodeRune(enc[:], r)]...)
+		default:
+			return "", fmt.Errorf("invalid escape sequence \\%c", c)
+		}
+	}
+	return string(buf), nil
+}
+
+// unquoteUnicodeEscape parses the "\u" or "\U" escape sequence at the start of
+// s, returning the code point and the length of the sequence.
+func unquoteUnicodeEscape(s string) (rune, int, error) {
+	n := 6
+	if s[1] == 'U' {
+		n = 10
+	}
+	if len(s) < n {
+		return 0, 0, fmt.Errorf("invalid unicode escape %s", s)
+	}
+	v, err := strconv.ParseUint(s[2:n], 16, 32)
+	if err != nil || v > unicode.MaxRune {
+		return 0, 0, fmt.Errorf("invalid unicode escape %s", s[:n])
+	}
+	return rune(v), n, nil
+}
+
+func isHexDigit(c byte) bool {
+	return (c >= '0' && c <= '9') || (c >= 'a' && c <= 'f') || (c >= 'A' && c <= 'F')
+}
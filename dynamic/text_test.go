@@ -1,12 +1,19 @@
 package dynamic
 
 import (
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"reflect"
+	"strings"
 	"testing"
 
 	"github.com/golang/protobuf/proto"
 
 	"github.com/jhump/protoreflect/desc"
 	"github.com/jhump/protoreflect/internal/testprotos"
+	"github.com/jhump/protoreflect/internal/testprotos/nopkg"
 	"github.com/jhump/protoreflect/internal/testutil"
 )
 
@@ -35,11 +42,295 @@ func TestTextMapValueFields(t *testing.T) {
 }
 
 func TestTextUnknownFields(t *testing.T) {
-	// TODO
+	md, err := desc.LoadMessageDescriptorForMessage((*nopkg.TopLevel)(nil))
+	testutil.Ok(t, err)
+	dm := NewMessage(md)
+	// unrecognized tag numbers are skipped
+	err = dm.UnmarshalText([]byte(`99 { 1: 2 3 { 4: -5 } } 98: < a: "x" "y" b: [1, - 2] c: { d: 0x1 } > 97: -inf 96 < > w: true`))
+	testutil.Ok(t, err)
+	testutil.Ceq(t, &nopkg.TopLevel{W: proto.Bool(true)}, dm, eqm)
 }
 
 func TestTextExtensionFields(t *testing.T) {
-	// TODO
+	msg := &nopkg.TopLevel{I: proto.Int32(1)}
+	err := proto.SetExtension(msg, testprotos.E_Otl, &nopkg.TopLevel{J: proto.Int64(2)})
+	testutil.Ok(t, err)
+	err = proto.SetExtension(msg, testprotos.E_Groupx, &testprotos.GroupX{Groupxi: proto.Int64(3)})
+	testutil.Ok(t, err)
+	extreg := NewExtensionRegistryWithDefaults()
+	md, err := desc.LoadMessageDescriptorForMessage(msg)
+	testutil.Ok(t, err)
+
+	// extension groups are named using the group's message type, like
+	// normal groups
+	text := `i:1 [testprotos.otl]:<j:2> [testprotos.GroupX]{groupxi:3}`
+	dm := NewMessageWithExtensionRegistry(md, extreg)
+	err = dm.UnmarshalText([]byte(text))
+	testutil.Ok(t, err)
+	testutil.Ceq(t, msg, dm, eqm)
+	b, err := dm.MarshalText()
+	testutil.Ok(t, err)
+	testutil.Eq(t, text, string(b))
+
+	for _, text := range []string{
+		string(b),
+		// extension names
+		`i: 1 [testprotos.otl] { j: 2 } [testprotos.groupx] { groupxi: 3 }`,
+		`i: 1 [testprotos.otl]: < j: 2 > [testprotos.groupx]: { groupxi: 3 }`,
+		// tag numbers
+		`1: 1 100 { 2: 2 } 104 { 1041: 3 }`,
+	} {
+		dm2 := NewMessageWithExtensionRegistry(md, extreg)
+		err = dm2.UnmarshalText([]byte(text))
+		testutil.Ok(t, err, "failed to unmarshal %q", text)
+		testutil.Ceq(t, msg, dm2, eqm, "incorrect result for %q", text)
+	}
+
+	// without the registry, extensions are not recognized
+	dm2 := NewMessage(md)
+	err = dm2.UnmarshalText(b)
+	testutil.Require(t, err != nil && strings.Contains(err.Error(), `"[testprotos.otl]" is not a recognized field name`), "unexpected error: %v", err)
+}
+
+func TestTextNumericFormats(t *testing.T) {
+	md, err := desc.LoadMessageDescriptorForMessage((*nopkg.TopLevel)(nil))
+	testutil.Ok(t, err)
+	testCases := []struct {
+		text     string
+		expected *nopkg.TopLevel
+	}{
+		{
+			text: `i: 0x1F j: -0x10 k: 017 l: - 5 m: 0XfF n: 18446744073709551615 o: 00 p: 0xffffffffffffffff q: -2147483648 r: -010`,
+			expected: &nopkg.TopLevel{
+				I: proto.Int32(31), J: proto.Int64(-16), K: proto.Int32(15), L: proto.Int64(-5),
+				M: proto.Uint32(255), N: proto.Uint64(18446744073709551615), O: proto.Uint32(0),
+				P: proto.Uint64(0xffffffffffffffff), Q: proto.Int32(-2147483648), R: proto.Int64(-8),
+			},
+		},
+		{
+			text:     `s: 1.5f t: 2F`,
+			expected: &nopkg.TopLevel{S: proto.Float32(1.5), T: proto.Float64(2)},
+		},
+		{
+			text:     `s: 10 t: 0x10`,
+			expected: &nopkg.TopLevel{S: proto.Float32(10), T: proto.Float64(16)},
+		},
+		{
+			text:     `s: -.5 t: 1e400`,
+			expected: &nopkg.TopLevel{S: proto.Float32(-0.5), T: proto.Float64(math.Inf(1))},
+		},
+		{
+			text:     `s: Infinity t: -INF`,
+			expected: &nopkg.TopLevel{S: proto.Float32(float32(math.Inf(1))), T: proto.Float64(math.Inf(-1))},
+		},
+		{
+			text:     `s: -infinity t: inf`,
+			expected: &nopkg.TopLevel{S: proto.Float32(float32(math.Inf(-1))), T: proto.Float64(math.Inf(1))},
+		},
+		{
+			text:     `w: True`,
+			expected: &nopkg.TopLevel{W: proto.Bool(true)},
+		},
+		{
+			text:     `w: t`,
+			expected: &nopkg.TopLevel{W: proto.Bool(true)},
+		},
+		{
+			text:     `w: 1`,
+			expected: &nopkg.TopLevel{W: proto.Bool(true)},
+		},
+		{
+			text:     `w: False`,
+			expected: &nopkg.TopLevel{W: proto.Bool(false)},
+		},
+		{
+			text:     `w: f`,
+			expected: &nopkg.TopLevel{W: proto.Bool(false)},
+		},
+		{
+			text:     `w: 0`,
+			expected: &nopkg.TopLevel{W: proto.Bool(false)},
+		},
+		{
+			text:     `w: 0x1`,
+			expected: &nopkg.TopLevel{W: proto.Bool(true)},
+		},
+		{
+			text:     `w: 00`,
+			expected: &nopkg.TopLevel{W: proto.Bool(false)},
+		},
+	}
+	for _, testCase := range testCases {
+		dm := NewMessage(md)
+		err := dm.UnmarshalText([]byte(testCase.text))
+		testutil.Ok(t, err, "failed to unmarshal %q", testCase.text)
+		testutil.Ceq(t, testCase.expected, dm, eqm, "incorrect result for %q", testCase.text)
+	}
+
+	for _, text := range []string{`s: nan`, `t: NaN`, `t: -nan`} {
+		dm := NewMessage(md)
+		err := dm.UnmarshalText([]byte(text))
+		testutil.Ok(t, err, "failed to unmarshal %q", text)
+		v := dm.GetFieldByName(text[:1])
+		testutil.Require(t, math.IsNaN(reflect.ValueOf(v).Float()), "%q: expecting NaN, got %v", text, v)
+	}
+
+	for _, text := range []string{
+		`i: 0x`, `i: 08`, `i: 2147483648`, `i: 1.5`, `i: 0b1`, `i: 1_000`, `i: 0o7`,
+		`m: -1`, `n: -0x1`, `s: 017f`, `s: foo`, `w: 2`, `w: yes`, `w: "true"`,
+		`w: TRUE`, `w: T`, `w: tRuE`, `w: FALSE`, `w: F`, `w: -0`, `w: -1`, `w: 1.0`, `w: 0x2`,
+	} {
+		dm := NewMessage(md)
+		err := dm.UnmarshalText([]byte(text))
+		testutil.Nok(t, err, "expecting error for %q", text)
+	}
+}
+
+func TestTextComments(t *testing.T) {
+	text := `# leading comment
+i: 1 # trailing comment
+# comment with "quotes" and <brackets
+v: "a # not a comment" # another comment
+[testprotos.otl] {
+  # nested comment
+  j: 2 // also a comment
+  /* and this */ k: 3
+}
+#
+# comment at end without newline`
+	msg := &nopkg.TopLevel{I: proto.Int32(1), V: proto.String("a # not a comment")}
+	err := proto.SetExtension(msg, testprotos.E_Otl, &nopkg.TopLevel{J: proto.Int64(2), K: proto.Int32(3)})
+	testutil.Ok(t, err)
+	md, err := desc.LoadMessageDescriptorForMessage(msg)
+	testutil.Ok(t, err)
+	dm := NewMessageWithExtensionRegistry(md, NewExtensionRegistryWithDefaults())
+	err = dm.UnmarshalText([]byte(text))
+	testutil.Ok(t, err)
+	testutil.Ceq(t, msg, dm, eqm)
+}
+
+func TestTextStringEscapes(t *testing.T) {
+	md, err := desc.LoadMessageDescriptorForMessage((*nopkg.TopLevel)(nil))
+	testutil.Ok(t, err)
+	testCases := []struct {
+		text     string
+		expected *nopkg.TopLevel
+	}{
+		{
+			text:     `v: 'it\'s "quoted"'`,
+			expected: &nopkg.TopLevel{V: proto.String(`it's "quoted"`)},
+		},
+		{
+			text:     `v: "abc" 'def' "ghi"`,
+			expected: &nopkg.TopLevel{V: proto.String("abcdefghi")},
+		},
+		{
+			text:     `u: "\0\01\001\1234\x1\xfF\X41"`,
+			expected: &nopkg.TopLevel{U: []byte{0, 1, 1, 0123, '4', 1, 0xff, 'A'}},
+		},
+		{
+			text:     `u: "\a\b\f\n\r\t\v\\\'\"\?"`,
+			expected: &nopkg.TopLevel{U: []byte("\a\b\f\n\r\t\v\\'\"?")},
+		},
+		{
+			text:     `v: "\u00e9\U0001F600\ud83d\ude00"`,
+			expected: &nopkg.TopLevel{V: proto.String("\u00e9\U0001F600\U0001F600")},
+		},
+	}
+	for _, testCase := range testCases {
+		dm := NewMessage(md)
+		err := dm.UnmarshalText([]byte(testCase.text))
+		testutil.Ok(t, err, "failed to unmarshal %q", testCase.text)
+		testutil.Ceq(t, testCase.expected, dm, eqm, "incorrect result for %q", testCase.text)
+	}
+
+	for _, text := range []string{
+		`v: "\q"`, `v: "\u12"`, `v: "\ud83d"`, `v: "\ude00\ud83d"`, `v: "\U00110000"`,
+		`v: "\400"`, `v: "\x"`, `v: "abc`, "v: \"abc\ndef\"", `v: 'abc"`,
+	} {
+		dm := NewMessage(md)
+		err := dm.UnmarshalText([]byte(text))
+		testutil.Nok(t, err, "expecting error for %q", text)
+	}
+
+	// all byte values survive a round trip
+	data := make([]byte, 256)
+	for i := range data {
+		data[i] = byte(i)
+	}
+	dm := NewMessage(md)
+	dm.SetFieldByName("u", data)
+	dm.SetFieldByName("v", "\u00e9\U0001F600\x00'\"")
+	b, err := dm.MarshalText()
+	testutil.Ok(t, err)
+	dm2 := NewMessage(md)
+	err = dm2.UnmarshalText(b)
+	testutil.Ok(t, err)
+	testutil.Require(t, Equal(dm, dm2), "%v != %v", dm, dm2)
+	var msg nopkg.TopLevel
+	err = proto.UnmarshalText(string(b), &msg)
+	testutil.Ok(t, err)
+	testutil.Ceq(t, &msg, dm, eqm)
+}
+
+func TestTextParseErrors(t *testing.T) {
+	md, err := desc.LoadMessageDescriptorForMessage((*nopkg.TopLevel)(nil))
+	testutil.Ok(t, err)
+	testCases := []struct {
+		text         string
+		line, column int
+		eof          bool
+	}{
+		{text: "i: 1\nj: foo", line: 2, column: 4},
+		{text: "i: 1\n  foo: 2", line: 2, column: 3},
+		{text: "i: 1\n  [foo.bar]: 2", line: 2, column: 3},
+		{text: "i: 1\n\n\ti: 0x1ffffffff", line: 3, column: 5},
+		{text: "i: 1\nv: \"\\q\"", line: 2, column: 4},
+		{text: "i: 1\nw: - 1", line: 2, column: 4},
+		{text: "i: 1\nw:", line: 2, column: 3, eof: true},
+		{text: "i: 1\n99 {\n  1: 2", line: 3, column: 7, eof: true},
+	}
+	for _, testCase := range testCases {
+		dm := NewMessage(md)
+		err := dm.UnmarshalText([]byte(testCase.text))
+		testutil.Require(t, err != nil, "expecting error for %q", testCase.text)
+		tpe, ok := err.(*TextParseError)
+		testutil.Require(t, ok, "%q: expecting *TextParseError, got %T: %v", testCase.text, err, err)
+		testutil.Eq(t, testCase.line, tpe.Line, "%q: wrong line: %v", testCase.text, err)
+		testutil.Eq(t, testCase.column, tpe.Column, "%q: wrong column: %v", testCase.text, err)
+		testutil.Eq(t, testCase.eof, errors.Is(err, io.ErrUnexpectedEOF), "%q: %v", testCase.text, err)
+		testutil.Require(t, strings.HasPrefix(err.Error(), fmt.Sprintf("line %d, col %d: ", testCase.line, testCase.column)), "%q: %v", testCase.text, err)
+	}
+}
+
+func TestTextMarshaler_Multiline(t *testing.T) {
+	msg := &nopkg.TopLevel{I: proto.Int32(1)}
+	err := proto.SetExtension(msg, testprotos.E_Otl, &nopkg.TopLevel{J: proto.Int64(2)})
+	testutil.Ok(t, err)
+	md, err := desc.LoadMessageDescriptorForMessage(msg)
+	testutil.Ok(t, err)
+	dm := NewMessageWithExtensionRegistry(md, NewExtensionRegistryWithDefaults())
+	err = dm.UnmarshalText([]byte(`i: 1 [testprotos.otl] { j: 2 }`))
+	testutil.Ok(t, err)
+	testutil.Ceq(t, msg, dm, eqm)
+
+	compact, err := (&TextMarshaler{}).Marshal(dm)
+	testutil.Ok(t, err)
+	expected, err := dm.MarshalText()
+	testutil.Ok(t, err)
+	testutil.Eq(t, string(expected), string(compact))
+	testutil.Eq(t, `i:1 [testprotos.otl]:<j:2>`, string(compact))
+
+	multiline, err := (&TextMarshaler{Multiline: true}).Marshal(dm)
+	testutil.Ok(t, err)
+	expected, err = dm.MarshalTextIndent()
+	testutil.Ok(t, err)
+	testutil.Eq(t, string(expected), string(multiline))
+	testutil.Eq(t, "i: 1\n[testprotos.otl]: <\n  j: 2\n>", string(multiline))
+
+	tabs, err := (&TextMarshaler{Indent: "\t"}).Marshal(dm)
+	testutil.Ok(t, err)
+	testutil.Eq(t, "i: 1\n[testprotos.otl]: <\n\tj: 2\n>", string(tabs))
 }
 
 func TestTextLenientParsing(t *testing.T) {
@@ -175,3 +466,24 @@ func textTranslationParty(t *testing.T, msg proto.Message, includesNaN bool) {
 		// indentation/pretty-printing
 		false, true)
 }
+
+func TestTextEditionsDelimitedFields(t *testing.T) {
+	md := loadEditionsTestMessage(t)
+	dm := NewMessage(md)
+	dm.SetFieldByName("key", uint64(1))
+	bar := NewMessage(md.FindFieldByName("bar").GetMessageType())
+	bar.SetFieldByName("baz", "abc")
+	dm.SetFieldByName("bar", bar)
+	dm.SetFieldByName("not_a_group", bar)
+
+	// group-like delimited fields use the message name, like groups;
+	// other delimited fields use the field name
+	b, err := dm.MarshalText()
+	testutil.Ok(t, err)
+	testutil.Eq(t, `key:1 Bar{baz:"abc"} not_a_group:<baz:"abc">`, string(b))
+
+	dm2 := NewMessage(md)
+	err = dm2.UnmarshalText(b)
+	testutil.Ok(t, err)
+	testutil.Require(t, Equal(dm, dm2))
+}
@@ -0,0 +1,1481 @@
+package dynamic
+
+// Marshalling and unmarshalling of dynamic messages to/from YAML
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/golang/protobuf/jsonpb"
+	"google.golang.org/protobuf/types/descriptorpb"
+
+	"github.com/jhump/protoreflect/desc"
+)
+
+// MarshalYAMLBytes serializes this message to bytes in YAML format, returning an
+// error if the operation fails. The resulting bytes will be a valid UTF8
+// string. Use a YAMLMarshaler for more control over the output.
+//
+// The YAML format uses the same mapping as the proto3 JSON format: fields are
+// named using their JSON names, enum values are written by name, and
+// well-known types have special representations. Unlike JSON, fields are
+// written in the order in which they are declared in the message descriptor.
+//
+// This method is not named MarshalYAML because that name, with a different
+// signature, is used by the Marshaler interfaces of the gopkg.in/yaml packages.
+func (m *Message) MarshalYAMLBytes() ([]byte, error) {
+	return (&YAMLMarshaler{}).Marshal(m)
+}
+
+// UnmarshalYAMLBytes de-serializes the message that is present, in YAML format, in
+// the given bytes into this message. It first resets the current message. It
+// returns an error if the given bytes do not contain a valid encoding of this
+// message type in YAML format. If the problem can be attributed to a location
+// in the input, the error is a *YAMLParseError. Use a YAMLUnmarshaler for more
+// control over how the input is handled.
+//
+// The input may name fields using their JSON names or their original names in
+// the proto source. Scalar values are interpreted according to the type of
+// the field to which they are assigned, so a string field can be assigned an
+// unquoted value that looks like a number, for example.
+//
+// This method is not named UnmarshalYAML because that name, with a different
+// signature, is used by the Unmarshaler interfaces of the gopkg.in/yaml
+// packages.
+func (m *Message) UnmarshalYAMLBytes(yml []byte) error {
+	return (&YAMLUnmarshaler{}).Unmarshal(yml, m)
+}
+
+// UnmarshalMergeYAML de-serializes the message that is present, in YAML format,
+// in the given bytes into this message. Unlike UnmarshalYAMLBytes, it does not
+// first reset the message, instead merging the data in the given bytes into the
+// existing data in this message.
+func (m *Message) UnmarshalMergeYAML(yml []byte) error {
+	return (&YAMLUnmarshaler{}).UnmarshalMerge(yml, m)
+}
+
+// YAMLMarshaler marshals dynamic messages to YAML, with options that mirror
+// those of jsonpb.Marshaler.
+type YAMLMarshaler struct {
+	// If true, fields are named using their original names in the proto
+	// source instead of their JSON names.
+	OrigName bool
+	// If true, enum values are written as numbers instead of names.
+	EnumsAsInts bool
+	// If true, fields with default values are written.
+	EmitDefaults bool
+	// If true, 64-bit integer values are written as YAML integers. Otherwise,
+	// they are written as quoted strings, like in the proto3 JSON format.
+	Int64AsNumber bool
+	// The number of spaces used for each level of indentation. If zero, two
+	// spaces are used.
+	Indent int
+	// Used to resolve the types of Any messages. If nil, the types are
+	// resolved using the message's descriptor and any types linked into the
+	// program.
+	AnyResolver jsonpb.AnyResolver
+	// Options for expanding Any messages. If nil, an error is returned if the
+	// type of an Any message cannot be resolved.
+	Any *AnyOptions
+}
+
+// Marshal serializes the given message to bytes in YAML format.
+func (ym *YAMLMarshaler) Marshal(m *Message) ([]byte, error) {
+	// we first marshal to JSON, which handles well-known types, Any messages,
+	// and the formatting of scalar values, and then convert to YAML
+	jm := JSONMarshaler{
+		JSONPB: jsonpb.Marshaler{
+			OrigName:     ym.OrigName,
+			EnumsAsInts:  ym.EnumsAsInts,
+			EmitDefaults: ym.EmitDefaults,
+			AnyResolver:  ym.AnyResolver,
+		},
+		Any: ym.Any,
+	}
+	js, err := jm.Marshal(m)
+	if err != nil {
+		return nil, err
+	}
+	n, err := jsonToYAML(js)
+	if err != nil {
+		return nil, err
+	}
+	sortYAMLFields(n, m.md, m.er, ym.Int64AsNumber)
+	indent := ym.Indent
+	if indent <= 0 {
+		indent = 2
+	}
+	w := yamlWriter{indent: indent}
+	w.writeNode(n, 0)
+	return w.buf.Bytes(), nil
+}
+
+// YAMLUnmarshaler unmarshals dynamic messages from YAML, with options that
+// mirror those of jsonpb.Unmarshaler.
+//
+// Only a subset of YAML is supported: a single document comprised of block
+// and flow collections and plain, quoted, and block scalars. Anchors,
+// aliases, tags, and complex mapping keys are not supported.
+type YAMLUnmarshaler struct {
+	// If true, fields that are not recognized are ignored. Otherwise, they
+	// result in an error.
+	AllowUnknownFields bool
+	// Used to resolve the types of Any messages. If nil, the types are
+	// resolved using the message's descriptor and any types linked into the
+	// program.
+	AnyResolver jsonpb.AnyResolver
+	// Options for expanding Any messages. If nil, Any messages must use the
+	// proto3 JSON format.
+	Any *AnyOptions
+}
+
+// Unmarshal de-serializes the message that is present, in YAML format, in the
+// given bytes into the given message. It first resets the message.
+func (yu *YAMLUnmarshaler) Unmarshal(yml []byte, m *Message) error {
+	m.Reset()
+	if err := yu.UnmarshalMerge(yml, m); err != nil {
+		return err
+	}
+	return m.Validate()
+}
+
+// UnmarshalMerge de-serializes the message that is present, in YAML format, in
+// the given bytes into the given message, merging the data into the existing
+// data in the message.
+func (yu *YAMLUnmarshaler) UnmarshalMerge(yml []byte, m *Message) error {
+	n, err := parseYAML(yml)
+	if err != nil {
+		return err
+	}
+	opts := jsonpb.Unmarshaler{
+		AllowUnknownFields: yu.AllowUnknownFields,
+		AnyResolver:        yu.AnyResolver,
+	}
+	if yu.Any != nil && yu.Any.Resolver != nil {
+		opts.AnyResolver = yu.Any.Resolver
+	}
+	return m.unmarshalYAML(n, &opts, yu.Any)
+}
+
+// YAMLParseError is the type of error returned when YAML input cannot be
+// parsed or does not match the message's schema. It indicates where in the
+// input the problem was found.
+type YAMLParseError struct {
+	// The line and column of the input where the error occurred. Both are
+	// one-based.
+	Line, Column int
+	// The underlying cause.
+	Err error
+}
+
+// Error implements the error interface.
+func (e *YAMLParseError) Error() string {
+	return fmt.Sprintf("line %d, col %d: %v", e.Line, e.Column, e.Err)
+}
+
+// Unwrap returns the underlying cause of the error.
+func (e *YAMLParseError) Unwrap() error {
+	return e.Err
+}
+
+func yamlError(n *yamlNode, err error) error {
+	var ype *YAMLParseError
+	if errors.As(err, &ype) {
+		return err
+	}
+	return &YAMLParseError{Line: n.line, Column: n.col, Err: err}
+}
+
+func (m *Message) unmarshalYAML(n *yamlNode, opts *jsonpb.Unmarshaler, anyOpts *AnyOptions) error {
+	if n.isNull() {
+		return nil
+	}
+	if !isYAMLMessage(m.md) {
+		// well-known types and Any messages have special representations,
+		// which we let the JSON unmarshaller handle
+		return m.unmarshalYAMLViaJSON(n, n.appendJSON(nil, nil), opts, anyOpts)
+	}
+	if n.kind != yamlMapping {
+		return yamlError(n, fmt.Errorf("expecting a mapping for message %s", m.md.GetFullyQualifiedName()))
+	}
+	for i := 0; i < len(n.children); i += 2 {
+		k, v := n.children[i], n.children[i+1]
+		fd := m.FindFieldDescriptorByJSONName(k.value)
+		if fd == nil {
+			if opts.AllowUnknownFields {
+				continue
+			}
+			return yamlError(k, fmt.Errorf("message type %s has no known field named %s", m.md.GetFullyQualifiedName(), k.value))
+		}
+		var err error
+		switch {
+		case fd.IsMap() && v.kind == yamlMapping && isYAMLMessage(fd.GetMapValueType().GetMessageType()):
+			err = m.unmarshalYAMLMap(k, fd, v, opts, anyOpts)
+		case fd.IsRepeated() && !fd.IsMap() && v.kind == yamlSequence && isYAMLMessage(fd.GetMessageType()):
+			for _, item := range v.children {
+				if item.kind != yamlMapping {
+					// let the JSON unmarshaller report the problem
+					js := appendYAMLField(nil, k.value, item.appendJSON([]byte{'['}, fd))
+					if err = m.unmarshalYAMLViaJSON(item, append(js, ']', '}'), opts, anyOpts); err != nil {
+						break
+					}
+					continue
+				}
+				dm := m.mf.NewDynamicMessage(fd.GetMessageType())
+				if err = dm.unmarshalYAML(item, opts, anyOpts); err != nil {
+					break
+				}
+				if err = m.TryAddRepeatedField(fd, dm); err != nil {
+					err = yamlError(item, err)
+					break
+				}
+			}
+		case !fd.IsRepeated() && v.kind == yamlMapping && isYAMLMessage(fd.GetMessageType()):
+			dm := m.mf.NewDynamicMessage(fd.GetMessageType())
+			if err = dm.unmarshalYAML(v, opts, anyOpts); err == nil {
+				if err = mergeField(m, fd, dm); err != nil {
+					err = yamlError(k, err)
+				}
+			}
+		default:
+			js := appendYAMLField(nil, k.value, v.appendJSON(nil, fd))
+			err = m.unmarshalYAMLViaJSON(v, append(js, '}'), opts, anyOpts)
+		}
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (m *Message) unmarshalYAMLMap(k *yamlNode, fd *desc.FieldDescriptor, v *yamlNode, opts *jsonpb.Unmarshaler, anyOpts *AnyOptions) error {
+	for i := 0; i < len(v.children); i += 2 {
+		mk, mv := v.children[i], v.children[i+1]
+		if mv.kind != yamlMapping {
+			// let the JSON unmarshaller handle it
+			entry := appendYAMLField(nil, mk.value, mv.appendJSON(nil, fd.GetMapValueType()))
+			js := append(appendYAMLField(nil, k.value, append(entry, '}')), '}')
+			if err := m.unmarshalYAMLViaJSON(mv, js, opts, anyOpts); err != nil {
+				return err
+			}
+			continue
+		}
+		key, err := yamlMapKey(fd.GetMapKeyType(), mk.value)
+		if err != nil {
+			return yamlError(mk, err)
+		}
+		dm := m.mf.NewDynamicMessage(fd.GetMapValueType().GetMessageType())
+		if err := dm.unmarshalYAML(mv, opts, anyOpts); err != nil {
+			return err
+		}
+		if err := m.TryPutMapField(fd, key, dm); err != nil {
+			return yamlError(mk, err)
+		}
+	}
+	return nil
+}
+
+func (m *Message) unmarshalYAMLViaJSON(n *yamlNode, js []byte, opts *jsonpb.Unmarshaler, anyOpts *AnyOptions) error {
+	r := newJsReader(js)
+	r.anyx = newAnyExpansion(anyOpts)
+	if err := m.unmarshalJSONMerge(r, opts); err != nil {
+		return yamlError(n, err)
+	}
+	return nil
+}
+
+// isYAMLMessage returns true if the given message is represented in YAML as a
+// mapping of field names to values.
+func isYAMLMessage(md *desc.MessageDescriptor) bool {
+	if md == nil {
+		return false
+	}
+	_, wkt := wellKnownTypeNames[md.GetFullyQualifiedName()]
+	return !wkt
+}
+
+// appendYAMLField appends the start of a JSON object with a single field with
+// the given name, followed by the given value.
+func appendYAMLField(b []byte, name string, value []byte) []byte {
+	b = append(b, '{')
+	b = appendJSONString(b, name)
+	b = append(b, ':')
+	return append(b, value...)
+}
+
+func appendJSONString(b []byte, s string) []byte {
+	// json.Marshal of a string never fails
+	js, _ := json.Marshal(s)
+	return append(b, js...)
+}
+
+func yamlMapKey(fd *desc.FieldDescriptor, s string) (interface{}, error) {
+	switch fd.GetType() {
+	case descriptorpb.FieldDescriptorProto_TYPE_STRING:
+		return s, nil
+	case descriptorpb.FieldDescriptorProto_TYPE_BOOL:
+		switch s {
+		case "true":
+			return true, nil
+		case "false":
+			return false, nil
+		}
+		return nil, fmt.Errorf("invalid map key %q: expecting a boolean", s)
+	case descriptorpb.FieldDescriptorProto_TYPE_INT32,
+		descriptorpb.FieldDescriptorProto_TYPE_SINT32,
+		descriptorpb.FieldDescriptorProto_TYPE_SFIXED32:
+		i, err := strconv.ParseInt(s, 10, 32)
+		if err != nil {
+			return nil, fmt.Errorf("invalid map key %q: %v", s, err.(*strconv.NumError).Err)
+		}
+		return int32(i), nil
+	case descriptorpb.FieldDescriptorProto_TYPE_INT64,
+		descriptorpb.FieldDescriptorProto_TYPE_SINT64,
+		descriptorpb.FieldDescriptorProto_TYPE_SFIXED64:
+		i, err := strconv.ParseInt(s, 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("invalid map key %q: %v", s, err.(*strconv.NumError).Err)
+		}
+		return i, nil
+	case descriptorpb.FieldDescriptorProto_TYPE_UINT32,
+		descriptorpb.FieldDescriptorProto_TYPE_FIXED32:
+		u, err := strconv.ParseUint(s, 10, 32)
+		if err != nil {
+			return nil, fmt.Errorf("invalid map key %q: %v", s, err.(*strconv.NumError).Err)
+		}
+		return uint32(u), nil
+	case descriptorpb.FieldDescriptorProto_TYPE_UINT64,
+		descriptorpb.FieldDescriptorProto_TYPE_FIXED64:
+		u, err := strconv.ParseUint(s, 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("invalid map key %q: %v", s, err.(*strconv.NumError).Err)
+		}
+		return u, nil
+	default:
+		return nil, fmt.Errorf("invalid map key type: %v", fd.GetType())
+	}
+}
+
+type yamlKind int
+
+const (
+	yamlScalar yamlKind = iota
+	yamlMapping
+	yamlSequence
+)
+
+// yamlNode is a YAML value. Mappings retain the order of their keys.
+type yamlNode struct {
+	kind yamlKind
+	// for scalars, the value
+	value string
+	// for scalars, true if the value is a string. Otherwise, the value is a
+	// plain scalar that may represent a null, boolean, or number. Strings
+	// that could be mistaken for other kinds of values are quoted when
+	// written.
+	str bool
+	// for sequences, the items; for mappings, alternating keys and values
+	children []*yamlNode
+	// location of the node in the input
+	line, col int
+}
+
+func (n *yamlNode) isNull() bool {
+	if n.kind != yamlScalar || n.str {
+		return false
+	}
+	switch n.value {
+	case "", "~", "null", "Null", "NULL":
+		return true
+	}
+	return false
+}
+
+// appendJSON appends the JSON form of this node to b. Scalar values are
+// converted according to the type of the given field, if non-nil. Otherwise,
+// they are converted according to YAML's core schema.
+func (n *yamlNode) appendJSON(b []byte, fd *desc.FieldDescriptor) []byte {
+	switch n.kind {
+	case yamlSequence:
+		b = append(b, '[')
+		for i, item := range n.children {
+			if i > 0 {
+				b = append(b, ',')
+			}
+			b = item.appendJSON(b, fd)
+		}
+		return append(b, ']')
+	case yamlMapping:
+		var vfd *desc.FieldDescriptor
+		if fd != nil && fd.IsMap() {
+			vfd = fd.GetMapValueType()
+		}
+		b = append(b, '{')
+		for i := 0; i < len(n.children); i += 2 {
+			if i > 0 {
+				b = append(b, ',')
+			}
+			b = appendJSONString(b, n.children[i].value)
+			b = append(b, ':')
+			b = n.children[i+1].appendJSON(b, vfd)
+		}
+		return append(b, '}')
+	}
+
+	if n.isNull() {
+		return append(b, "null"...)
+	}
+	if n.str {
+		return appendJSONString(b, n.value)
+	}
+	var t descriptorpb.FieldDescriptorProto_Type
+	if fd != nil {
+		t = fd.GetType()
+	}
+	switch t {
+	case descriptorpb.FieldDescriptorProto_TYPE_STRING,
+		descriptorpb.FieldDescriptorProto_TYPE_BYTES:
+		return appendJSONString(b, n.value)
+	case descriptorpb.FieldDescriptorProto_TYPE_ENUM:
+		if _, err := strconv.ParseInt(n.value, 10, 32); err == nil {
+			return append(b, n.value...)
+		}
+		return appendJSONString(b, n.value)
+	case descriptorpb.FieldDescriptorProto_TYPE_BOOL:
+		if v, ok := yamlBool(n.value); ok {
+			return strconv.AppendBool(b, v)
+		}
+		return appendJSONString(b, n.value)
+	case descriptorpb.FieldDescriptorProto_TYPE_MESSAGE,
+		descriptorpb.FieldDescriptorProto_TYPE_GROUP:
+		// well-known type, so use core schema
+		t = 0
+	}
+	if num, ok := yamlNumber(n.value); ok {
+		return append(b, num...)
+	}
+	if t == 0 {
+		if v, ok := yamlBool(n.value); ok {
+			return strconv.AppendBool(b, v)
+		}
+	}
+	// let the JSON unmarshaller decide if a string is acceptable
+	return appendJSONString(b, n.value)
+}
+
+func yamlBool(s string) (bool, bool) {
+	switch s {
+	case "true", "True", "TRUE":
+		return true, true
+	case "false", "False", "FALSE":
+		return false, true
+	}
+	return false, false
+}
+
+// yamlNumber returns the JSON form of the given plain scalar if it is a number
+// according to YAML's core schema. Infinity and NaN are returned as quoted
+// strings, like in the proto3 JSON format.
+func yamlNumber(s string) (string, bool) {
+	switch strings.ToLower(s) {
+	case ".inf", "+.inf":
+		return `"Infinity"`, true
+	case "-.inf":
+		return `"-Infinity"`, true
+	case ".nan":
+		return `"NaN"`, true
+	}
+	digits := strings.TrimPrefix(s, "+")
+	var sign string
+	if strings.HasPrefix(digits, "-") {
+		sign, digits = "-", digits[1:]
+	}
+	base := 10
+	switch {
+	case strings.HasPrefix(digits, "0x"):
+		base, digits = 16, digits[2:]
+	case strings.HasPrefix(digits, "0o"):
+		base, digits = 8, digits[2:]
+	}
+	if digits == "" || digits[0] == '+' || digits[0] == '-' {
+		return "", false
+	}
+	if u, err := strconv.ParseUint(digits, base, 64); err == nil {
+		return sign + strconv.FormatUint(u, 10), true
+	}
+	if base != 10 || strings.ContainsAny(digits, "_xXpP") {
+		return "", false
+	}
+	f, err := strconv.ParseFloat(digits, 64)
+	if err != nil || math.IsInf(f, 0) || math.IsNaN(f) {
+		return "", false
+	}
+	if sign != "" {
+		f = -f
+	}
+	return strconv.FormatFloat(f, 'g', -1, 64), true
+}
+
+// jsonToYAML converts the given JSON value into a YAML node.
+func jsonToYAML(js []byte) (*yamlNode, error) {
+	dec := json.NewDecoder(bytes.NewReader(js))
+	dec.UseNumber()
+	return jsonToYAMLNode(dec)
+}
+
+func jsonToYAMLNode(dec *json.Decoder) (*yamlNode, error) {
+	t, err := dec.Token()
+	if err != nil {
+		return nil, err
+	}
+	switch t := t.(type) {
+	case json.Delim:
+		var n yamlNode
+		if t == '{' {
+			n.kind = yamlMapping
+		} else {
+			n.kind = yamlSequence
+		}
+		for dec.More() {
+			if n.kind == yamlMapping {
+				k, err := dec.Token()
+				if err != nil {
+					return nil, err
+				}
+				n.children = append(n.children, &yamlNode{value: k.(string), str: true})
+			}
+			child, err := jsonToYAMLNode(dec)
+			if err != nil {
+				return nil, err
+			}
+			n.children = append(n.children, child)
+		}
+		// consume closing delimiter
+		if _, err := dec.Token(); err != nil {
+			return nil, err
+		}
+		return &n, nil
+	case string:
+		return &yamlNode{value: t, str: true}, nil
+	case json.Number:
+		return &yamlNode{value: t.String()}, nil
+	case bool:
+		return &yamlNode{value: strconv.FormatBool(t)}, nil
+	case nil:
+		return &yamlNode{value: "null"}, nil
+	default:
+		return nil, fmt.Errorf("unexpected JSON token: %v", t)
+	}
+}
+
+// sortYAMLFields re-orders the fields of the given node, which represents a
+// message of the given type, so they appear in the order they are declared in
+// the message descriptor. Extensions appear after normal fields. If
+// int64AsNumber is true, values of 64-bit integer fields are converted from
+// strings to numbers.
+func sortYAMLFields(n *yamlNode, md *desc.MessageDescriptor, er *ExtensionRegistry, int64AsNumber bool) {
+	if n.kind != yamlMapping || !isYAMLMessage(md) {
+		return
+	}
+	type entry struct {
+		k, v *yamlNode
+		rank int
+	}
+	fields := md.GetFields()
+	entries := make([]entry, len(n.children)/2)
+	for i := range entries {
+		k, v := n.children[i*2], n.children[i*2+1]
+		entries[i] = entry{k: k, v: v, rank: len(fields) + 1}
+		var fd *desc.FieldDescriptor
+		if strings.HasPrefix(k.value, "[") {
+			fd = er.FindExtensionByJSONName(md.GetFullyQualifiedName(), strings.Trim(k.value, "[]"))
+			if fd == nil {
+				fd = er.FindExtensionByName(md.GetFullyQualifiedName(), strings.Trim(k.value, "[]"))
+			}
+			if fd != nil {
+				entries[i].rank = len(fields)
+			}
+		} else {
+			for j, f := range fields {
+				if f.GetJSONName() == k.value || f.GetName() == k.value {
+					fd = f
+					entries[i].rank = j
+					break
+				}
+			}
+		}
+		if fd != nil {
+			sortYAMLFieldValue(v, fd, er, int64AsNumber)
+		}
+	}
+	sort.SliceStable(entries, func(i, j int) bool {
+		return entries[i].rank < entries[j].rank
+	})
+	for i, e := range entries {
+		n.children[i*2], n.children[i*2+1] = e.k, e.v
+	}
+}
+
+func sortYAMLFieldValue(v *yamlNode, fd *desc.FieldDescriptor, er *ExtensionRegistry, int64AsNumber bool) {
+	if fd.IsMap() {
+		if v.kind == yamlMapping {
+			for i := 1; i < len(v.children); i += 2 {
+				sortYAMLFieldValue(v.children[i], fd.GetMapValueType(), er, int64AsNumber)
+			}
+		}
+		return
+	}
+	if fd.IsRepeated() && v.kind == yamlSequence {
+		for _, item := range v.children {
+			sortYAMLElement(item, fd, er, int64AsNumber)
+		}
+		return
+	}
+	sortYAMLElement(v, fd, er, int64AsNumber)
+}
+
+func sortYAMLElement(v *yamlNode, fd *desc.FieldDescriptor, er *ExtensionRegistry, int64AsNumber bool) {
+	switch fd.GetType() {
+	case descriptorpb.FieldDescriptorProto_TYPE_MESSAGE,
+		descriptorpb.FieldDescriptorProto_TYPE_GROUP:
+		sortYAMLFields(v, fd.GetMessageType(), er, int64AsNumber)
+	case descriptorpb.FieldDescriptorProto_TYPE_INT64,
+		descriptorpb.FieldDescriptorProto_TYPE_SINT64,
+		descriptorpb.FieldDescriptorProto_TYPE_SFIXED64,
+		descriptorpb.FieldDescriptorProto_TYPE_UINT64,
+		descriptorpb.FieldDescriptorProto_TYPE_FIXED64:
+		if int64AsNumber && v.kind == yamlScalar && v.str {
+			v.str = false
+		}
+	}
+}
+
+type yamlWriter struct {
+	buf    bytes.Buffer
+	indent int
+}
+
+// writeNode writes the given node, starting at the current position. Any
+// subsequent lines of the node are indented to the given column.
+func (w *yamlWriter) writeNode(n *yamlNode, col int) {
+	if len(n.children) == 0 {
+		switch n.kind {
+		case yamlMapping:
+			w.buf.WriteString("{}\n")
+		case yamlSequence:
+			w.buf.WriteString("[]\n")
+		default:
+			w.writeScalar(n)
+			w.buf.WriteByte('\n')
+		}
+		return
+	}
+	if n.kind == yamlSequence {
+		for i, item := range n.children {
+			if i > 0 {
+				w.writeIndent(col)
+			}
+			w.buf.WriteString("- ")
+			w.writeNode(item, col+2)
+		}
+		return
+	}
+	for i := 0; i < len(n.children); i += 2 {
+		if i > 0 {
+			w.writeIndent(col)
+		}
+		k, v := n.children[i], n.children[i+1]
+		w.writeScalar(k)
+		w.buf.WriteByte(':')
+		if len(v.children) == 0 {
+			w.buf.WriteByte(' ')
+			w.writeNode(v, col)
+		} else {
+			w.buf.WriteByte('\n')
+			w.writeIndent(col + w.indent)
+			w.writeNode(v, col+w.indent)
+		}
+	}
+}
+
+func (w *yamlWriter) writeIndent(col int) {
+	for i := 0; i < col; i++ {
+		w.buf.WriteByte(' ')
+	}
+}
+
+func (w *yamlWriter) writeScalar(n *yamlNode) {
+	if !n.str || isPlainYAMLString(n.value) {
+		w.buf.WriteString(n.value)
+		return
+	}
+	w.buf.WriteByte('"')
+	for _, r := range n.value {
+		switch r {
+		case '"':
+			w.buf.WriteString(`\"`)
+		case '\\':
+			w.buf.WriteString(`\\`)
+		case '\n':
+			w.buf.WriteString(`\n`)
+		case '\r':
+			w.buf.WriteString(`\r`)
+		case '\t':
+			w.buf.WriteString(`\t`)
+		default:
+			if unicode.IsPrint(r) {
+				w.buf.WriteRune(r)
+			} else if r <= 0xffff {
+				fmt.Fprintf(&w.buf, `\u%04x`, r)
+			} else {
+				fmt.Fprintf(&w.buf, `\U%08x`, r)
+			}
+		}
+	}
+	w.buf.WriteByte('"')
+}
+
+// isPlainYAMLString returns true if the given string can be written as a plain
+// (unquoted) scalar without being mistaken for another kind of value, even by
+// YAML parsers that use the YAML 1.1 rules for booleans and timestamps.
+func isPlainYAMLString(s string) bool {
+	if s == "" || s[0] == ' ' || s[len(s)-1] == ' ' || s[len(s)-1] == ':' {
+		return false
+	}
+	if strings.ContainsAny(s[:1], "-?:,[]{}#&*!|>'\"%@`+.0123456789") {
+		return false
+	}
+	if strings.Contains(s, ": ") || strings.Contains(s, " #") {
+		return false
+	}
+	for _, r := range s {
+		if r == utf8.RuneError || !unicode.IsPrint(r) {
+			return false
+		}
+	}
+	switch strings.ToLower(s) {
+	case "~", "null", "true", "false", "yes", "no", "on", "off", "y", "n":
+		return false
+	}
+	return true
+}
+
+// parseYAML parses the given YAML document.
+func parseYAML(data []byte) (*yamlNode, error) {
+	p := yamlParser{data: data, line: 1, col: 1}
+	if err := p.skipDocumentStart(); err != nil {
+		return nil, err
+	}
+	var n *yamlNode
+	if p.atDocumentEnd() {
+		n = p.newNode(yamlScalar)
+	} else {
+		var err error
+		if n, err = p.parseNode(p.col, 0, true); err != nil {
+			return nil, err
+		}
+		if err := p.skipToContent(); err != nil {
+			return nil, err
+		}
+	}
+	if p.atMarker("...") {
+		p.advance(3)
+		if err := p.skipToContent(); err != nil {
+			return nil, err
+		}
+	}
+	if p.pos < len(p.data) {
+		if p.atMarker("---") {
+			return nil, p.errorf("multiple documents are not supported")
+		}
+		return nil, p.errorf("unexpected %s", p.describe())
+	}
+	return n, nil
+}
+
+type yamlParser struct {
+	data      []byte
+	pos       int
+	line, col int
+}
+
+func (p *yamlParser) newNode(kind yamlKind) *yamlNode {
+	return &yamlNode{kind: kind, line: p.line, col: p.col}
+}
+
+func (p *yamlParser) errorf(format string, args ...interface{}) error {
+	return &YAMLParseError{Line: p.line, Column: p.col, Err: fmt.Errorf(format, args...)}
+}
+
+func (p *yamlParser) describe() string {
+	if p.pos >= len(p.data) {
+		return "end of input"
+	}
+	r, _ := utf8.DecodeRune(p.data[p.pos:])
+	return fmt.Sprintf("character %q", r)
+}
+
+func (p *yamlParser) peek(offset int) byte {
+	if p.pos+offset >= len(p.data) {
+		return 0
+	}
+	return p.data[p.pos+offset]
+}
+
+func (p *yamlParser) advance(n int) {
+	for i := 0; i < n && p.pos < len(p.data); i++ {
+		if p.data[p.pos] == '\n' {
+			p.line++
+			p.col = 1
+		} else if p.data[p.pos]&0xc0 != 0x80 {
+			// only count the first byte of multi-byte characters
+			p.col++
+		}
+		p.pos++
+	}
+}
+
+func isYAMLBlank(c byte) bool {
+	return c == ' ' || c == '\t' || c == '\n' || c == '\r' || c == 0
+}
+
+func isYAMLFlowIndicator(c byte) bool {
+	return c == ',' || c == '[' || c == ']' || c == '{' || c == '}'
+}
+
+func (p *yamlParser) skipSpaces() {
+	for c := p.peek(0); c == ' ' || c == '\t'; c = p.peek(0) {
+		p.advance(1)
+	}
+}
+
+// atLineEnd returns true if the rest of the current line, after any spaces,
+// is empty or a comment.
+func (p *yamlParser) atLineEnd() bool {
+	p.skipSpaces()
+	c := p.peek(0)
+	return c == '\n' || c == '\r' || c == '#' || p.pos >= len(p.data)
+}
+
+// skipToContent skips whitespace, comments, and line breaks, up to the next
+// content character.
+func (p *yamlParser) skipToContent() error {
+	for p.pos < len(p.data) {
+		switch p.peek(0) {
+		case ' ':
+			p.advance(1)
+		case '\t':
+			if p.col == 1 || p.lineIndentOnly() {
+				return p.errorf("tabs are not allowed for indentation")
+			}
+			p.advance(1)
+		case '\n', '\r':
+			p.advance(1)
+		case '#':
+			for p.pos < len(p.data) && p.peek(0) != '\n' {
+				p.advance(1)
+			}
+		default:
+			return nil
+		}
+	}
+	return nil
+}
+
+// lineIndentOnly returns true if only spaces precede the current position on
+// the current line.
+func (p *yamlParser) lineIndentOnly() bool {
+	for i := p.pos - 1; i >= 0 && p.data[i] != '\n'; i-- {
+		if p.data[i] != ' ' {
+			return false
+		}
+	}
+	return true
+}
+
+func (p *yamlParser) atMarker(marker string) bool {
+	return p.col == 1 && bytes.HasPrefix(p.data[p.pos:], []byte(marker)) && isYAMLBlank(p.peek(len(marker)))
+}
+
+func (p *yamlParser) atDocumentEnd() bool {
+	return p.pos >= len(p.data) || p.atMarker("---") || p.atMarker("...")
+}
+
+func (p *yamlParser) skipDocumentStart() error {
+	if err := p.skipToContent(); err != nil {
+		return err
+	}
+	for p.col == 1 && p.peek(0) == '%' {
+		// skip directives
+		for p.pos < len(p.data) && p.peek(0) != '\n' {
+			p.advance(1)
+		}
+		if err := p.skipToContent(); err != nil {
+			return err
+		}
+	}
+	if p.atMarker("---") {
+		p.advance(3)
+		p.skipSpaces()
+		if !p.atLineEnd() {
+			// content on the same line as the marker
+			return nil
+		}
+		return p.skipToContent()
+	}
+	return nil
+}
+
+// parseNode parses the node at the current position, which is at the given
+// column. The parent's column is used to determine the extent of block
+// scalars. If block is false, the node may not be a block collection, which
+// is the case for values on the same line as their mapping key.
+func (p *yamlParser) parseNode(col, parentCol int, block bool) (*yamlNode, error) {
+	c := p.peek(0)
+	switch {
+	case c == '-' && isYAMLBlank(p.peek(1)):
+		if !block {
+			return nil, p.errorf("block sequence is not allowed here")
+		}
+		return p.parseBlockSequence(col)
+	case c == '|' || c == '>':
+		return p.parseBlockScalar(parentCol)
+	case c == '&' || c == '*' || c == '!':
+		return nil, p.errorf("anchors, aliases, and tags are not supported")
+	case c == '?' && isYAMLBlank(p.peek(1)):
+		return nil, p.errorf("complex mapping keys are not supported")
+	}
+
+	var n *yamlNode
+	var err error
+	switch c {
+	case '[', '{':
+		n, err = p.parseFlow()
+	case '"', '\'':
+		n, err = p.parseQuoted()
+	default:
+		n, err = p.parsePlain(parentCol, false)
+	}
+	if err != nil {
+		return nil, err
+	}
+	p.skipSpaces()
+	if p.peek(0) == ':' && isYAMLBlank(p.peek(1)) {
+		if !block {
+			return nil, p.errorf("mapping values are not allowed here")
+		}
+		if n.kind != yamlScalar || n.line != p.line {
+			return nil, yamlError(n, errors.New("complex mapping keys are not supported"))
+		}
+		return p.parseBlockMapping(col, n)
+	}
+	if !p.atLineEnd() {
+		return nil, p.errorf("unexpected %s", p.describe())
+	}
+	return n, nil
+}
+
+func (p *yamlParser) parseBlockSequence(col int) (*yamlNode, error) {
+	n := p.newNode(yamlSequence)
+	for {
+		// consume "-"
+		p.advance(1)
+		item, err := p.parseBlockValue(col)
+		if err != nil {
+			return nil, err
+		}
+		n.children = append(n.children, item)
+
+		if err := p.skipToContent(); err != nil {
+			return nil, err
+		}
+		if p.atDocumentEnd() || p.col < col {
+			return n, nil
+		}
+		if p.col > col {
+			return nil, p.errorf("unexpected indentation")
+		}
+		if p.peek(0) != '-' || !isYAMLBlank(p.peek(1)) {
+			// the rest of the enclosing mapping
+			return n, nil
+		}
+	}
+}
+
+func (p *yamlParser) parseBlockMapping(col int, key *yamlNode) (*yamlNode, error) {
+	n := &yamlNode{kind: yamlMapping, line: key.line, col: key.col}
+	keys := map[string]struct{}{}
+	for {
+		if _, ok := keys[key.value]; ok {
+			return nil, yamlError(key, fmt.Errorf("duplicate key %q", key.value))
+		}
+		keys[key.value] = struct{}{}
+		// consume ":"
+		p.advance(1)
+		p.skipSpaces()
+		var v *yamlNode
+		var err error
+		if p.atLineEnd() {
+			v, err = p.parseBlockValue(col)
+		} else {
+			v, err = p.parseNode(p.col, col, false)
+		}
+		if err != nil {
+			return nil, err
+		}
+		n.children = append(n.children, key, v)
+
+		if err := p.skipToContent(); err != nil {
+			return nil, err
+		}
+		if p.atDocumentEnd() || p.col < col {
+			return n, nil
+		}
+		if p.col > col {
+			return nil, p.errorf("unexpected indentation")
+		}
+		switch c := p.peek(0); {
+		case c == '-' && isYAMLBlank(p.peek(1)):
+			return nil, p.errorf("expecting a mapping key but found a sequence item")
+		case c == '"' || c == '\'':
+			key, err = p.parseQuoted()
+		case c == '[' || c == '{':
+			return nil, p.errorf("complex mapping keys are not supported")
+		default:
+			key, err = p.parsePlain(col, true)
+		}
+		if err != nil {
+			return nil, err
+		}
+		p.skipSpaces()
+		if p.peek(0) != ':' || !isYAMLBlank(p.peek(1)) {
+			return nil, p.errorf("expecting ':' after mapping key %q", key.value)
+		}
+	}
+}
+
+// parseBlockValue parses the value of a sequence item or mapping entry whose
+// indicator is at the given column. The value may start on the current line
+// or on a subsequent line.
+func (p *yamlParser) parseBlockValue(col int) (*yamlNode, error) {
+	p.skipSpaces()
+	if !p.atLineEnd() {
+		return p.parseNode(p.col, col, true)
+	}
+	null := p.newNode(yamlScalar)
+	if err := p.skipToContent(); err != nil {
+		return nil, err
+	}
+	if p.atDocumentEnd() {
+		return null, nil
+	}
+	if p.col > col {
+		return p.parseNode(p.col, col, true)
+	}
+	if p.col == col && p.peek(0) == '-' && isYAMLBlank(p.peek(1)) && null.col > col+1 {
+		// a sequence that is the value of a mapping entry may have the same
+		// indentation as the mapping
+		return p.parseBlockSequence(col)
+	}
+	return null, nil
+}
+
+// parsePlain parses a plain (unquoted) scalar. Plain scalars that are not keys
+// may span multiple lines, as long as continuation lines are indented more
+// than the parent node.
+func (p *yamlParser) parsePlain(parentCol int, key bool) (*yamlNode, error) {
+	n := p.newNode(yamlScalar)
+	var buf []byte
+	for {
+		start := p.pos
+		end := p.pos
+		for p.pos < len(p.data) {
+			c := p.peek(0)
+			if c == '\n' || c == '\r' {
+				break
+			}
+			if c == ':' && isYAMLBlank(p.peek(1)) {
+				break
+			}
+			if c == '#' && p.pos > start && (p.data[p.pos-1] == ' ' || p.data[p.pos-1] == '\t') {
+				break
+			}
+			p.advance(1)
+			if c != ' ' && c != '\t' {
+				end = p.pos
+			}
+		}
+		buf = append(buf, p.data[start:end]...)
+		if key || p.peek(0) != '\n' && p.peek(0) != '\r' {
+			break
+		}
+
+		// see if the scalar continues on the next line
+		save := *p
+		breaks := 0
+		for c := p.peek(0); c == ' ' || c == '\t' || c == '\n' || c == '\r'; c = p.peek(0) {
+			if c == '\n' {
+				breaks++
+			}
+			p.advance(1)
+		}
+		if p.pos >= len(p.data) || p.col <= parentCol || p.peek(0) == '#' || p.atDocumentEnd() ||
+			(p.peek(0) == '-' && isYAMLBlank(p.peek(1))) || len(buf) == 0 {
+			*p = save
+			break
+		}
+		if breaks > 1 {
+			for i := 1; i < breaks; i++ {
+				buf = append(buf, '\n')
+			}
+		} else {
+			buf = append(buf, ' ')
+		}
+	}
+	n.value = string(buf)
+	if p.peek(0) == ':' && n.line != p.line {
+		return nil, p.errorf("mapping values are not allowed here")
+	}
+	return n, nil
+}
+
+func (p *yamlParser) parseQuoted() (*yamlNode, error) {
+	n := p.newNode(yamlScalar)
+	n.str = true
+	quote := p.peek(0)
+	p.advance(1)
+	var buf []byte
+	// length of buf that cannot be trimmed when folding lines
+	keep := 0
+	for {
+		if p.pos >= len(p.data) {
+			return nil, yamlError(n, errors.New("unterminated quoted string"))
+		}
+		c := p.peek(0)
+		switch {
+		case c == quote && quote == '\'' && p.peek(1) == '\'':
+			buf = append(buf, '\'')
+			p.advance(2)
+			keep = len(buf)
+		case c == quote:
+			p.advance(1)
+			n.value = string(buf)
+			return n, nil
+		case c == '\\' && quote == '"':
+			p.advance(1)
+			if p.peek(0) == '\n' || p.peek(0) == '\r' {
+				// escaped line break: join lines
+				for c := p.peek(0); c == ' ' || c == '\t' || c == '\n' || c == '\r'; c = p.peek(0) {
+					p.advance(1)
+				}
+				keep = len(buf)
+				continue
+			}
+			var err error
+			if buf, err = p.appendEscape(buf); err != nil {
+				return nil, err
+			}
+			keep = len(buf)
+		case c == '\n' || c == '\r':
+			// fold line break, trimming surrounding white space
+			for len(buf) > keep && (buf[len(buf)-1] == ' ' || buf[len(buf)-1] == '\t') {
+				buf = buf[:len(buf)-1]
+			}
+			breaks := 0
+			for c := p.peek(0); c == ' ' || c == '\t' || c == '\n' || c == '\r'; c = p.peek(0) {
+				if c == '\n' {
+					breaks++
+				}
+				p.advance(1)
+			}
+			if p.atDocumentEnd() {
+				return nil, yamlError(n, errors.New("unterminated quoted string"))
+			}
+			if breaks > 1 {
+				for i := 1; i < breaks; i++ {
+					buf = append(buf, '\n')
+				}
+			} else {
+				buf = append(buf, ' ')
+			}
+			keep = len(buf)
+		default:
+			buf = append(buf, c)
+			p.advance(1)
+		}
+	}
+}
+
+func (p *yamlParser) appendEscape(buf []byte) ([]byte, error) {
+	c := p.peek(0)
+	simple := map[byte]string{
+		'0': "\x00", 'a': "\a", 'b': "\b", 't': "\t", '\t': "\t", 'n': "\n", 'v': "\v",
+		'f': "\f", 'r': "\r", 'e': "\x1b", ' ': " ", '"': "\"", '/': "/", '\\': "\\",
+		'N': "\u0085", '_': " ", 'L': " ", 'P': " ",
+	}
+	if s, ok := simple[c]; ok {
+		p.advance(1)
+		return append(buf, s...), nil
+	}
+	var n int
+	switch c {
+	case 'x':
+		n = 2
+	case 'u':
+		n = 4
+	case 'U':
+		n = 8
+	default:
+		return nil, p.errorf("invalid escape sequence \\%c", c)
+	}
+	if p.pos+1+n > len(p.data) {
+		return nil, p.errorf("invalid escape sequence \\%c", c)
+	}
+	digits := string(p.data[p.pos+1 : p.pos+1+n])
+	v, err := strconv.ParseUint(digits, 16, 32)
+	if err != nil || v > unicode.MaxRune || (v >= 0xd800 && v <= 0xdfff) {
+		return nil, p.errorf("invalid escape sequence \\%c%s", c, digits)
+	}
+	p.advance(1 + n)
+	var enc [utf8.UTFMax]byte
+	return append(buf, enc[:utf8.EncodeRune(enc[:], rune(v))]...), nil
+}
+
+// parseBlockScalar parses a literal ("|") or folded (">") block scalar. Its
+// content is the following lines that are indented more than parentCol.
+func (p *yamlParser) parseBlockScalar(parentCol int) (*yamlNode, error) {
+	n := p.newNode(yamlScalar)
+	n.str = true
+	folded := p.peek(0) == '>'
+	p.advance(1)
+	chomp := byte(0)
+	indent := 0
+	for i := 0; i < 2; i++ {
+		c := p.peek(0)
+		if (c == '+' || c == '-') && chomp == 0 {
+			chomp = c
+		} else if c >= '1' && c <= '9' && indent == 0 {
+			// parentCol is one-based, so the parent's indentation is one less
+			indent = int(c - '0')
+			if parentCol > 0 {
+				indent += parentCol - 1
+			}
+		} else {
+			break
+		}
+		p.advance(1)
+	}
+	if !p.atLineEnd() {
+		return nil, p.errorf("unexpected %s in block scalar header", p.describe())
+	}
+	for p.pos < len(p.data) && p.peek(0) != '\n' {
+		p.advance(1)
+	}
+	p.advance(1)
+
+	var lines []string
+	for p.pos < len(p.data) {
+		// measure indentation of the line
+		spaces := 0
+		for p.peek(spaces) == ' ' {
+			spaces++
+		}
+		c := p.peek(spaces)
+		if c == '\n' || c == '\r' || p.pos+spaces >= len(p.data) {
+			// empty line
+			lines = append(lines, "")
+			p.advance(spaces + 1)
+			continue
+		}
+		if indent == 0 {
+			if spaces < parentCol {
+				break
+			}
+			indent = spaces
+		}
+		if spaces < indent || (p.col == 1 && (p.atMarker("---") || p.atMarker("..."))) {
+			break
+		}
+		p.advance(indent)
+		start := p.pos
+		for p.pos < len(p.data) && p.peek(0) != '\n' {
+			p.advance(1)
+		}
+		lines = append(lines, strings.TrimSuffix(string(p.data[start:p.pos]), "\r"))
+		p.advance(1)
+	}
+
+	// separate trailing empty lines
+	trailing := 0
+	for len(lines) > 0 && lines[len(lines)-1] == "" {
+		lines = lines[:len(lines)-1]
+		trailing++
+	}
+	var buf bytes.Buffer
+	for i, line := range lines {
+		if i > 0 {
+			prev := lines[i-1]
+			switch {
+			case !folded:
+				buf.WriteByte('\n')
+			case prev != "" && line != "" && !isMoreIndented(prev) && !isMoreIndented(line):
+				// line break between two lines is folded into a space
+				buf.WriteByte(' ')
+			case prev != "" && line == "" && !isMoreIndented(prev) && !isMoreIndented(nextNonEmpty(lines[i:])):
+				// line break before a run of empty lines is dropped
+			default:
+				buf.WriteByte('\n')
+			}
+		}
+		buf.WriteString(line)
+	}
+	n.value = buf.String()
+	switch chomp {
+	case '-':
+	case '+':
+		if len(lines) > 0 {
+			n.value += "\n"
+		}
+		n.value += strings.Repeat("\n", trailing)
+	default:
+		if len(lines) > 0 {
+			n.value += "\n"
+		}
+	}
+	return n, nil
+}
+
+func isMoreIndented(line string) bool {
+	return line != "" && (line[0] == ' ' || line[0] == '\t')
+}
+
+func nextNonEmpty(lines []string) string {
+	for _, line := range lines {
+		if line != "" {
+			return line
+		}
+	}
+	return ""
+}
+
+// parseFlow parses a flow sequence ("[...]") or flow mapping ("{...}"), which
+// may span multiple lines.
+func (p *yamlParser) parseFlow() (*yamlNode, error) {
+	var n *yamlNode
+	var end byte
+	if p.peek(0) == '[' {
+		n = p.newNode(yamlSequence)
+		end = ']'
+	} else {
+		n = p.newNode(yamlMapping)
+		end = '}'
+	}
+	p.advance(1)
+	var keys map[string]struct{}
+	if n.kind == yamlMapping {
+		keys = map[string]struct{}{}
+	}
+	for {
+		if err := p.skipFlowSpace(); err != nil {
+			return nil, err
+		}
+		if p.peek(0) == end {
+			p.advance(1)
+			return n, nil
+		}
+		item, err := p.parseFlowItem()
+		if err != nil {
+			return nil, err
+		}
+		if n.kind == yamlMapping {
+			if item.kind != yamlScalar {
+				return nil, yamlError(item, errors.New("complex mapping keys are not supported"))
+			}
+			if _, ok := keys[item.value]; ok {
+				return nil, yamlError(item, fmt.Errorf("duplicate key %q", item.value))
+			}
+			keys[item.value] = struct{}{}
+			if err := p.skipFlowSpace(); err != nil {
+				return nil, err
+			}
+			if p.peek(0) != ':' {
+				return nil, p.errorf("expecting ':' after mapping key %q", item.value)
+			}
+			p.advance(1)
+			if err := p.skipFlowSpace(); err != nil {
+				return nil, err
+			}
+			var v *yamlNode
+			if c := p.peek(0); c == ',' || c == end {
+				v = p.newNode(yamlScalar)
+			} else if v, err = p.parseFlowItem(); err != nil {
+				return nil, err
+			}
+			n.children = append(n.children, item, v)
+		} else {
+			n.children = append(n.children, item)
+		}
+		if err := p.skipFlowSpace(); err != nil {
+			return nil, err
+		}
+		switch p.peek(0) {
+		case ',':
+			p.advance(1)
+		case end:
+		default:
+			return nil, p.errorf("expecting ',' or '%c' but found %s", end, p.describe())
+		}
+	}
+}
+
+func (p *yamlParser) skipFlowSpace() error {
+	if err := p.skipToContent(); err != nil {
+		return err
+	}
+	if p.pos >= len(p.data) || p.atDocumentEnd() {
+		return p.errorf("unterminated flow collection")
+	}
+	return nil
+}
+
+func (p *yamlParser) parseFlowItem() (*yamlNode, error) {
+	switch c := p.peek(0); c {
+	case '[', '{':
+		return p.parseFlow()
+	case '"', '\'':
+		return p.parseQuoted()
+	case '&', '*', '!':
+		return nil, p.errorf("anchors, aliases, and tags are not supported")
+	case ',', ']', '}', ':':
+		return nil, p.errorf("unexpected %s", p.describe())
+	}
+	n := p.newNode(yamlScalar)
+	start := p.pos
+	end := p.pos
+	for p.pos < len(p.data) {
+		c := p.peek(0)
+		if c == '\n' || c == '\r' || isYAMLFlowIndicator(c) {
+			break
+		}
+		if c == ':' && (isYAMLBlank(p.peek(1)) || isYAMLFlowIndicator(p.peek(1))) {
+			break
+		}
+		if c == '#' && (p.data[p.pos-1] == ' ' || p.data[p.pos-1] == '\t') {
+			break
+		}
+		p.advance(1)
+		if c != ' ' && c != '\t' {
+			end = p.pos
+		}
+	}
+	n.value = string(p.data[start:end])
+	return n, nil
+}
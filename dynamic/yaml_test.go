@@ -0,0 +1,343 @@
+package dynamic
+
+import (
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/golang/protobuf/proto"
+	"google.golang.org/protobuf/types/descriptorpb"
+	"google.golang.org/protobuf/types/known/anypb"
+	"google.golang.org/protobuf/types/known/durationpb"
+	"google.golang.org/protobuf/types/known/structpb"
+	"google.golang.org/protobuf/types/known/timestamppb"
+	"google.golang.org/protobuf/types/known/wrapperspb"
+
+	"github.com/jhump/protoreflect/desc"
+	"github.com/jhump/protoreflect/internal/testprotos"
+	"github.com/jhump/protoreflect/internal/testutil"
+)
+
+func yamlTranslationParty(t *testing.T, msg proto.Message) {
+	dm, err := AsDynamicMessage(msg)
+	testutil.Ok(t, err)
+	yml, err := dm.MarshalYAMLBytes()
+	testutil.Ok(t, err)
+
+	dm2 := NewMessage(dm.GetMessageDescriptor())
+	err = dm2.UnmarshalYAMLBytes(yml)
+	testutil.Ok(t, err, "failed to unmarshal from:\n%s", yml)
+	testutil.Ceq(t, dm, dm2, eqdm, "round trip failed for:\n%s", yml)
+}
+
+func TestYAMLUnaryFields(t *testing.T) {
+	yamlTranslationParty(t, unaryFieldsPosMsg)
+	yamlTranslationParty(t, unaryFieldsNegMsg)
+	yamlTranslationParty(t, unaryFieldsPosInfMsg)
+	yamlTranslationParty(t, unaryFieldsNegInfMsg)
+}
+
+func TestYAMLRepeatedFields(t *testing.T) {
+	yamlTranslationParty(t, repeatedFieldsMsg)
+}
+
+func TestYAMLMapFields(t *testing.T) {
+	yamlTranslationParty(t, mapKeyFieldsMsg)
+	yamlTranslationParty(t, mapValueFieldsMsg)
+}
+
+func TestYAMLWellKnownTypes(t *testing.T) {
+	wkts := &testprotos.TestWellKnownTypes{
+		StartTime: &timestamppb.Timestamp{Seconds: 1010101, Nanos: 20202},
+		Elapsed:   &durationpb.Duration{Seconds: 30303, Nanos: 40404},
+		Dbl:       &wrapperspb.DoubleValue{Value: 3.14159},
+		I64:       &wrapperspb.Int64Value{Value: -9090909090},
+		Str:       &wrapperspb.StringValue{Value: "123"},
+		Byt:       &wrapperspb.BytesValue{Value: []byte("snafu")},
+		Json: []*structpb.Value{
+			{Kind: &structpb.Value_BoolValue{BoolValue: true}},
+			{Kind: &structpb.Value_StructValue{StructValue: &structpb.Struct{Fields: map[string]*structpb.Value{
+				"foo": {Kind: &structpb.Value_NullValue{}},
+				"bar": {Kind: &structpb.Value_StringValue{StringValue: "true"}},
+				"baz": {Kind: &structpb.Value_NumberValue{NumberValue: 30303.40404}},
+			}}}},
+		},
+		Extras: []*anypb.Any{newAny(t, &testprotos.TestRequest{
+			Foo: []testprotos.Proto3Enum{testprotos.Proto3Enum_VALUE1, testprotos.Proto3Enum_VALUE2},
+			Bar: "bar",
+		})},
+	}
+	yamlTranslationParty(t, wkts)
+}
+
+func TestYAMLMarshaler_Options(t *testing.T) {
+	msg := &testprotos.TestRequest{
+		Foo:   []testprotos.Proto3Enum{testprotos.Proto3Enum_VALUE1},
+		Bar:   "bar",
+		Baz:   &testprotos.TestMessage{Ne: []testprotos.TestMessage_NestedEnum{testprotos.TestMessage_VALUE1}},
+		Flags: map[string]bool{"a": true},
+	}
+	dm, err := AsDynamicMessage(msg)
+	testutil.Ok(t, err)
+
+	yml, err := dm.MarshalYAMLBytes()
+	testutil.Ok(t, err)
+	testutil.Eq(t, "foo:\n  - VALUE1\nbar: bar\nbaz:\n  ne:\n    - VALUE1\nflags:\n  a: true\n", string(yml))
+
+	yml, err = (&YAMLMarshaler{EnumsAsInts: true, Indent: 4}).Marshal(dm)
+	testutil.Ok(t, err)
+	testutil.Eq(t, "foo:\n    - 1\nbar: bar\nbaz:\n    ne:\n        - 1\nflags:\n    a: true\n", string(yml))
+}
+
+func TestYAMLMarshaler_Int64AsNumber(t *testing.T) {
+	msg := &testprotos.UnaryFields{I: proto.Int32(1), J: proto.Int64(2), N: proto.Uint64(3), V: proto.String("4")}
+	dm, err := AsDynamicMessage(msg)
+	testutil.Ok(t, err)
+
+	yml, err := dm.MarshalYAMLBytes()
+	testutil.Ok(t, err)
+	testutil.Eq(t, "i: 1\nj: \"2\"\n\"n\": \"3\"\nv: \"4\"\n", string(yml))
+
+	yml, err = (&YAMLMarshaler{Int64AsNumber: true}).Marshal(dm)
+	testutil.Ok(t, err)
+	testutil.Eq(t, "i: 1\nj: 2\n\"n\": 3\nv: \"4\"\n", string(yml))
+
+	dm2 := NewMessage(dm.GetMessageDescriptor())
+	testutil.Ok(t, dm2.UnmarshalYAMLBytes(yml))
+	testutil.Ceq(t, dm, dm2, eqdm)
+}
+
+// yamlOrderedMessage returns a descriptor whose fields are declared in a
+// different order than their numbers, and whose names differ from their JSON
+// names.
+func yamlOrderedMessage(t *testing.T) *desc.MessageDescriptor {
+	fdp := &descriptorpb.FileDescriptorProto{
+		Name:    proto.String("yaml_order.proto"),
+		Package: proto.String("yaml.test"),
+		Syntax:  proto.String("proto3"),
+		MessageType: []*descriptorpb.DescriptorProto{{
+			Name: proto.String("Ordered"),
+			Field: []*descriptorpb.FieldDescriptorProto{
+				{
+					Name:     proto.String("last_name"),
+					JsonName: proto.String("lastName"),
+					Number:   proto.Int32(3),
+					Label:    descriptorpb.FieldDescriptorProto_LABEL_OPTIONAL.Enum(),
+					Type:     descriptorpb.FieldDescriptorProto_TYPE_STRING.Enum(),
+				},
+				{
+					Name:     proto.String("first_name"),
+					JsonName: proto.String("firstName"),
+					Number:   proto.Int32(1),
+					Label:    descriptorpb.FieldDescriptorProto_LABEL_OPTIONAL.Enum(),
+					Type:     descriptorpb.FieldDescriptorProto_TYPE_STRING.Enum(),
+				},
+				{
+					Name:     proto.String("nicknames"),
+					JsonName: proto.String("nicknames"),
+					Number:   proto.Int32(2),
+					Label:    descriptorpb.FieldDescriptorProto_LABEL_REPEATED.Enum(),
+					Type:     descriptorpb.FieldDescriptorProto_TYPE_STRING.Enum(),
+				},
+			},
+		}},
+	}
+	fd, err := desc.CreateFileDescriptor(fdp)
+	testutil.Ok(t, err)
+	return fd.GetMessageTypes()[0]
+}
+
+func TestYAMLMarshal_DescriptorOrder(t *testing.T) {
+	dm := NewMessage(yamlOrderedMessage(t))
+	dm.SetFieldByName("first_name", "Alice")
+	dm.SetFieldByName("last_name", "null")
+	dm.SetFieldByName("nicknames", []string{"", "a: b", "it's", "line1\nline2"})
+
+	yml, err := dm.MarshalYAMLBytes()
+	testutil.Ok(t, err)
+	testutil.Eq(t, `lastName: "null"
+firstName: Alice
+nicknames:
+  - ""
+  - "a: b"
+  - it's
+  - "line1\nline2"
+`, string(yml))
+
+	yml, err = (&YAMLMarshaler{OrigName: true}).Marshal(dm)
+	testutil.Ok(t, err)
+	testutil.Require(t, strings.HasPrefix(string(yml), "last_name: \"null\"\nfirst_name: Alice\n"), "unexpected output:\n%s", yml)
+
+	dm2 := NewMessage(dm.GetMessageDescriptor())
+	testutil.Ok(t, dm2.UnmarshalYAMLBytes(yml))
+	testutil.Ceq(t, dm, dm2, eqdm)
+}
+
+func TestYAMLUnmarshal_Syntax(t *testing.T) {
+	md := yamlOrderedMessage(t)
+	expected := NewMessage(md)
+	expected.SetFieldByName("first_name", "Alice Smith")
+	expected.SetFieldByName("last_name", "123")
+	expected.SetFieldByName("nicknames", []string{"al", "line1\nline2\n", "folded text\n", "x y", "true"})
+
+	testCases := map[string]string{
+		"block": `
+# a comment
+---
+firstName: Alice Smith  # trailing comment
+last_name: 123
+nicknames:
+- al
+- |
+  line1
+  line2
+- >
+  folded
+  text
+- "x \
+  y"
+- true
+...
+`,
+		"flow": `{first_name: "Alice Smith", lastName: '123',
+  nicknames: [al, "line1\nline2\n", 'folded
+  text
+
+', x y, true]}`,
+		"multi-line plain": `
+firstName: Alice
+  Smith
+lastName: "123"
+nicknames: [al, "line1\nline2\n", "folded text\n", "x y", "true"]
+`,
+	}
+	for name, yml := range testCases {
+		t.Run(name, func(t *testing.T) {
+			dm := NewMessage(md)
+			err := dm.UnmarshalYAMLBytes([]byte(yml))
+			testutil.Ok(t, err)
+			testutil.Ceq(t, expected, dm, eqdm)
+		})
+	}
+}
+
+func TestYAMLUnmarshal_NestedMessages(t *testing.T) {
+	yml := `
+foo: [VALUE1, 2]
+bar: bar
+baz:
+  ne:
+    - VALUE1
+others:
+  x:
+    ne: [VALUE2]
+  "y": {}
+flags:
+  a: true
+  b: false
+`
+	md, err := desc.LoadMessageDescriptorForMessage((*testprotos.TestRequest)(nil))
+	testutil.Ok(t, err)
+	dm := NewMessage(md)
+	testutil.Ok(t, dm.UnmarshalYAMLBytes([]byte(yml)))
+
+	var msg testprotos.TestRequest
+	testutil.Ok(t, dm.ConvertTo(&msg))
+	expected := &testprotos.TestRequest{
+		Foo: []testprotos.Proto3Enum{testprotos.Proto3Enum_VALUE1, testprotos.Proto3Enum_VALUE2},
+		Bar: "bar",
+		Baz: &testprotos.TestMessage{Ne: []testprotos.TestMessage_NestedEnum{testprotos.TestMessage_VALUE1}},
+		Others: map[string]*testprotos.TestMessage{
+			"x": {Ne: []testprotos.TestMessage_NestedEnum{testprotos.TestMessage_VALUE2}},
+			"y": {},
+		},
+		Flags: map[string]bool{"a": true, "b": false},
+	}
+	testutil.Ceq(t, expected, &msg, eqpm)
+}
+
+func TestYAMLUnmarshal_Extensions(t *testing.T) {
+	md, err := desc.LoadMessageDescriptorForMessage((*testprotos.AnotherTestMessage)(nil))
+	testutil.Ok(t, err)
+	er := NewExtensionRegistryWithDefaults()
+	mf := NewMessageFactoryWithExtensionRegistry(er)
+
+	yml := `
+mapField1:
+  1: one
+"[testprotos.xs]": hello
+`
+	dm := mf.NewDynamicMessage(md)
+	testutil.Ok(t, dm.UnmarshalYAMLBytes([]byte(yml)))
+	testutil.Eq(t, "one", dm.GetMapFieldByName("map_field1", int32(1)))
+	testutil.Eq(t, "hello", dm.GetFieldByName("testprotos.xs"))
+
+	out, err := dm.MarshalYAMLBytes()
+	testutil.Ok(t, err)
+	dm2 := mf.NewDynamicMessage(md)
+	testutil.Ok(t, dm2.UnmarshalYAMLBytes(out))
+	testutil.Ceq(t, dm, dm2, eqdm)
+}
+
+func TestYAMLUnmarshal_AllowUnknownFields(t *testing.T) {
+	md := yamlOrderedMessage(t)
+	yml := []byte("firstName: Alice\nunknown:\n  nested: [1, 2]\n")
+
+	dm := NewMessage(md)
+	err := dm.UnmarshalYAMLBytes(yml)
+	var ype *YAMLParseError
+	testutil.Require(t, errors.As(err, &ype), "expecting *YAMLParseError, got %v", err)
+	testutil.Eq(t, 2, ype.Line)
+	testutil.Eq(t, 1, ype.Column)
+
+	err = (&YAMLUnmarshaler{AllowUnknownFields: true}).Unmarshal(yml, dm)
+	testutil.Ok(t, err)
+	testutil.Eq(t, "Alice", dm.GetFieldByName("first_name"))
+}
+
+func TestYAMLUnmarshal_Errors(t *testing.T) {
+	md, err := desc.LoadMessageDescriptorForMessage((*testprotos.UnaryFields)(nil))
+	testutil.Ok(t, err)
+	testCases := []struct {
+		name      string
+		yml       string
+		line, col int
+		contains  string
+	}{
+		{name: "bad int", yml: "i: 1\nj: abc\n", line: 2, col: 4},
+		{name: "bad bool", yml: "w: yes\n", line: 1, col: 4},
+		{name: "unknown field", yml: "i: 1\n  \nfoo: 1\n", line: 3, col: 1, contains: "no known field named foo"},
+		{name: "duplicate key", yml: "i: 1\ni: 2\n", line: 2, col: 1, contains: "duplicate key"},
+		{name: "bad indentation", yml: "i: 1\n  j: 2\n", line: 2, col: 4, contains: "mapping values are not allowed"},
+		{name: "tab indentation", yml: "u:\n\t- 1\n", line: 2, col: 1, contains: "tabs"},
+		{name: "unterminated string", yml: "v: \"abc\n", line: 1, col: 4, contains: "unterminated"},
+		{name: "unterminated flow", yml: "v: [a, b\n", line: 2, col: 1, contains: "unterminated"},
+		{name: "bad escape", yml: "v: \"\\q\"\n", line: 1, col: 6, contains: "invalid escape"},
+		{name: "alias", yml: "v: *foo\n", line: 1, col: 4, contains: "not supported"},
+		{name: "multiple documents", yml: "v: a\n---\nv: b\n", line: 2, col: 1, contains: "multiple documents"},
+		{name: "not a mapping", yml: "- a\n- b\n", line: 1, col: 1, contains: "expecting a mapping"},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			dm := NewMessage(md)
+			err := dm.UnmarshalYAMLBytes([]byte(tc.yml))
+			var ype *YAMLParseError
+			testutil.Require(t, errors.As(err, &ype), "expecting *YAMLParseError, got %v", err)
+			testutil.Eq(t, tc.line, ype.Line, "wrong line: %v", err)
+			testutil.Eq(t, tc.col, ype.Column, "wrong column: %v", err)
+			testutil.Require(t, strings.Contains(err.Error(), tc.contains), "unexpected error: %v", err)
+		})
+	}
+}
+
+func TestYAMLMarshaler_ExpandAny(t *testing.T) {
+	dm := nestedAnyMessage(t)
+	yml, err := (&YAMLMarshaler{Any: &AnyOptions{}}).Marshal(dm)
+	testutil.Ok(t, err)
+	testutil.Require(t, strings.Contains(string(yml), `"@type": type.googleapis.com/testprotos.TestRequest`), "unexpected output:\n%s", yml)
+
+	dm2 := NewMessage(dm.GetMessageDescriptor())
+	err = (&YAMLUnmarshaler{Any: &AnyOptions{}}).Unmarshal(yml, dm2)
+	testutil.Ok(t, err, "failed to unmarshal from:\n%s", yml)
+	testutil.Ceq(t, dm, dm2, eqdm)
+}
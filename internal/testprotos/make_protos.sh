@@ -49,6 +49,8 @@ ${PROTOC} --descriptor_set_out=./desc_test_complex.protoset -I. desc_test_comple
 ${PROTOC} --descriptor_set_out=./desc_test_complex_source_info.protoset --include_source_info --include_imports -I. desc_test_complex.proto
 ${PROTOC} --descriptor_set_out=./descriptor.protoset --include_source_info --include_imports -I./protoc/include/ google/protobuf/descriptor.proto
 ${PROTOC} --descriptor_set_out=./duration.protoset -I./protoc/include/ google/protobuf/duration.proto
+# NB: editions require protoc v27 or newer
+${PROTOC} --descriptor_set_out=./desc_test_editions.protoset --include_source_info --include_imports -I. desc_test_editions.proto
 ${PROTOC} --descriptor_set_out=./proto3_optional/desc_test_proto3_optional.protoset --include_source_info --include_imports -I. proto3_optional/desc_test_proto3_optional.proto
 
 # The grpc library doesn't yet have generated code for v1 of the reflection service.